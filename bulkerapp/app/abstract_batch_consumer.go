@@ -29,9 +29,12 @@ type ShouldConsumeFunction func(committedOffset, highOffset int64) bool
 type BatchConsumer interface {
 	Consumer
 	RunJob()
+	// RunJobIfTriggered runs job if any of threshold triggers fired
+	RunJobIfTriggered()
 	ConsumeAll() (consumed BatchCounters, err error)
-	BatchPeriodSec() int
-	UpdateBatchPeriod(batchPeriodSec int)
+	Triggers() BatchTriggers
+	UpdateTriggers(triggers BatchTriggers)
+	Status() ConsumerStatus
 }
 
 type AbstractBatchConsumer struct {
@@ -39,7 +42,7 @@ type AbstractBatchConsumer struct {
 	*AbstractConsumer
 	repository      *Repository
 	destinationId   string
-	batchPeriodSec  int
+	triggers        atomic.Pointer[BatchTriggers]
 	consumerConfig  kafka.ConfigMap
 	consumer        atomic.Pointer[kafka.Consumer]
 	producerConfig  kafka.ConfigMap
@@ -50,6 +53,13 @@ type AbstractBatchConsumer struct {
 	closed chan struct{}
 
 	running atomic.Bool
+	// lastRun outcome of the latest run that consumed messages
+	lastRun atomic.Pointer[BatchRun]
+
+	// totals of consumed messages used to estimate number and size of pending events for threshold triggers
+	consumedMessages atomic.Int64
+	consumedEvents   atomic.Int64
+	consumedBytes    atomic.Int64
 
 	//AbstractBatchConsumer marked as no longer needed. We cannot close it immediately because it can be in the middle of processing batch
 	retired atomic.Bool
@@ -63,8 +73,15 @@ type AbstractBatchConsumer struct {
 	shouldConsumeFunc ShouldConsumeFunction
 }
 
-func NewAbstractBatchConsumer(repository *Repository, destinationId string, batchPeriodSec int, topicId, mode string, config *Config, kafkaConfig *kafka.ConfigMap, bulkerProducer *Producer) (*AbstractBatchConsumer, error) {
-	abstract := NewAbstractConsumer(config, repository, topicId, bulkerProducer)
+func NewAbstractBatchConsumer(repository *Repository, destinationId string, triggers BatchTriggers, topicId, mode string, config *Config, kafkaConfig *kafka.ConfigMap, bulkerProducer *Producer) (*AbstractBatchConsumer, error) {
+	streamOptions := &bulker.StreamOptions{}
+	if destinationId != "" {
+		if destination := repository.GetDestination(destinationId); destination != nil {
+			streamOptions = destination.streamOptions
+		}
+	}
+	groupSettings := NewConsumerGroupSettings(config, streamOptions, topicId, mode == retryTopicMode)
+	abstract := NewAbstractConsumer(config, repository, topicId, bulkerProducer, groupSettings)
 	var tableName string
 	var err error
 	if destinationId != "" {
@@ -75,17 +92,14 @@ func NewAbstractBatchConsumer(repository *Repository, destinationId string, batc
 		}
 	}
 
-	consumerConfig := kafka.ConfigMap(utils.MapPutAll(kafka.ConfigMap{
-		"group.id":                      topicId,
-		"auto.offset.reset":             "earliest",
+	consumerConfig := kafka.ConfigMap(utils.MapPutAll(utils.MapPutAll(kafka.ConfigMap{
 		"allow.auto.create.topics":      false,
 		"group.instance.id":             abstract.GetInstanceId(),
 		"enable.auto.commit":            false,
 		"partition.assignment.strategy": config.KafkaConsumerPartitionsAssigmentStrategy,
 		"isolation.level":               "read_committed",
 		"session.timeout.ms":            config.KafkaSessionTimeoutMs,
-		"max.poll.interval.ms":          config.KafkaMaxPollIntervalMs,
-	}, *kafkaConfig))
+	}, groupSettings.configMap()), *kafkaConfig))
 	consumer, err := kafka.NewConsumer(&consumerConfig)
 	if err != nil {
 		metrics.ConsumerErrors(topicId, mode, destinationId, tableName, metrics.KafkaErrorCode(err)).Inc()
@@ -103,7 +117,6 @@ func NewAbstractBatchConsumer(repository *Repository, destinationId string, batc
 		repository:       repository,
 		destinationId:    destinationId,
 		tableName:        tableName,
-		batchPeriodSec:   batchPeriodSec,
 		mode:             mode,
 		consumerConfig:   consumerConfig,
 		producerConfig:   producerConfig,
@@ -112,6 +125,7 @@ func NewAbstractBatchConsumer(repository *Repository, destinationId string, batc
 		resumeChannel:    make(chan struct{}),
 	}
 	bc.consumer.Store(consumer)
+	bc.triggers.Store(&triggers)
 	bc.idle.Store(true)
 
 	err = consumer.Subscribe(topicId, bc.rebalanceCallback)
@@ -168,18 +182,30 @@ func (bc *AbstractBatchConsumer) initTransactionalProducer() (*kafka.Producer, e
 	return producer, nil
 }
 
-func (bc *AbstractBatchConsumer) BatchPeriodSec() int {
-	return bc.batchPeriodSec
+func (bc *AbstractBatchConsumer) Triggers() BatchTriggers {
+	return *bc.triggers.Load()
 }
 
-func (bc *AbstractBatchConsumer) UpdateBatchPeriod(batchPeriodSec int) {
-	bc.batchPeriodSec = batchPeriodSec
+func (bc *AbstractBatchConsumer) UpdateTriggers(triggers BatchTriggers) {
+	bc.triggers.Store(&triggers)
 }
 
 func (bc *AbstractBatchConsumer) TopicId() string {
 	return bc.topicId
 }
 
+// Status returns status of consumer and outcome of its latest run
+func (bc *AbstractBatchConsumer) Status() ConsumerStatus {
+	return ConsumerStatus{
+		Mode:    bc.mode,
+		GroupId: bc.groupSettings.GroupId,
+		Running: bc.running.Load(),
+		Paused:  bc.paused.Load(),
+		Retired: bc.retired.Load(),
+		LastRun: bc.lastRun.Load(),
+	}
+}
+
 func (bc *AbstractBatchConsumer) RunJob() {
 	if bc.running.CompareAndSwap(false, true) {
 		defer func() {
@@ -191,6 +217,61 @@ func (bc *AbstractBatchConsumer) RunJob() {
 	}
 }
 
+func (bc *AbstractBatchConsumer) RunJobIfTriggered() {
+	triggers := bc.Triggers()
+	if !triggers.HasThresholds() || bc.running.Load() || bc.retired.Load() {
+		return
+	}
+	lag, err := bc.lag()
+	if err != nil {
+		bc.errorMetric("query_lag_failed")
+		bc.Errorf("Failed to query consumer lag: %v", err)
+		return
+	}
+	if lag <= 0 {
+		return
+	}
+	rows, bytes := estimatePending(lag, bc.consumedMessages.Load(), bc.consumedEvents.Load(), bc.consumedBytes.Load())
+	trigger := triggers.firedThreshold(lag, rows, bytes)
+	if trigger == "" {
+		return
+	}
+	bc.Debugf("Batch triggered by %s threshold. Lag: %d estimated rows: %.0f", trigger, lag, rows)
+	metrics.ConsumerTriggers(bc.topicId, bc.mode, bc.destinationId, bc.tableName, trigger).Inc()
+	bc.RunJob()
+}
+
+// lag returns number of messages in partitions assigned to consumer that are not yet committed by consumer group
+func (bc *AbstractBatchConsumer) lag() (int64, error) {
+	consumer := bc.consumer.Load()
+	partitions, err := consumer.Assignment()
+	if err != nil || len(partitions) == 0 {
+		return 0, err
+	}
+	committed, err := consumer.Committed(partitions, 1000)
+	if err != nil {
+		return 0, err
+	}
+	var lag int64
+	for _, tp := range committed {
+		lowOffset, highOffset, err := consumer.QueryWatermarkOffsets(*tp.Topic, tp.Partition, 10_000)
+		if err != nil {
+			return 0, err
+		}
+		lag += partitionLag(lowOffset, highOffset, tp.Offset)
+	}
+	return lag, nil
+}
+
+// trackConsumed accounts consumed message in estimates of pending events size
+func (bc *AbstractBatchConsumer) trackConsumed(events [][]byte) {
+	bc.consumedMessages.Add(1)
+	bc.consumedEvents.Add(int64(len(events)))
+	for _, event := range events {
+		bc.consumedBytes.Add(int64(len(event)))
+	}
+}
+
 func (bc *AbstractBatchConsumer) ConsumeAll() (counters BatchCounters, err error) {
 	bc.Lock()
 	defer bc.Unlock()
@@ -207,6 +288,9 @@ func (bc *AbstractBatchConsumer) ConsumeAll() (counters BatchCounters, err error
 		bc.idle.Store(true)
 		bc.pause()
 		bc.countersMetric(counters)
+		if err != nil || counters.consumed > 0 {
+			bc.lastRun.Store(newBatchRun(counters, err))
+		}
 		if err != nil {
 			metrics.ConsumerRuns(bc.topicId, bc.mode, bc.destinationId, bc.tableName, "fail").Inc()
 			bc.Errorf("Consume finished with error: %v stats: %s offsets: %d-%d", err, counters.String(), lowOffset, highOffset)
@@ -5,8 +5,11 @@ import (
 	"encoding/json"
 	"fmt"
 	kafka2 "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
 	"github.com/jitsucom/bulker/jitsubase/appbase"
 	"github.com/jitsucom/bulker/jitsubase/timestamp"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"github.com/jitsucom/bulker/kafkabase"
 	"math"
 	"time"
 )
@@ -19,23 +22,61 @@ type AbstractConsumer struct {
 	topicId        string
 	bulkerProducer *Producer
 	repository     *Repository
+	groupSettings  ConsumerGroupSettings
 }
 
 type Consumer interface {
 	Retire()
 	TopicId() string
+	GroupSettings() ConsumerGroupSettings
 }
 
-func NewAbstractConsumer(config *Config, repository *Repository, topicId string, bulkerProducer *Producer) *AbstractConsumer {
+// ConsumerGroupSettings consumer group of topic and its settings. Per destination options override global config
+type ConsumerGroupSettings struct {
+	GroupId           string
+	OffsetReset       string
+	MaxPollIntervalMs int
+}
+
+// NewConsumerGroupSettings returns consumer group settings of topic.
+// Retry topics are always consumed from the earliest offset so scheduled retries are not lost
+func NewConsumerGroupSettings(config *Config, streamOptions *bulker.StreamOptions, topicId string, retry bool) ConsumerGroupSettings {
+	settings := ConsumerGroupSettings{
+		GroupId:           bulker.ConsumerGroupPrefixOption.Get(streamOptions) + topicId,
+		OffsetReset:       bulker.OffsetResetOption.Get(streamOptions),
+		MaxPollIntervalMs: utils.Nvl(bulker.MaxPollIntervalMsOption.Get(streamOptions), config.KafkaMaxPollIntervalMs),
+	}
+	if retry {
+		settings.OffsetReset = bulker.OffsetResetOption.DefaultValue
+	}
+	return settings
+}
+
+// configMap returns kafka consumer properties of consumer group settings
+func (s ConsumerGroupSettings) configMap() kafka2.ConfigMap {
+	return kafka2.ConfigMap{
+		"group.id":             s.GroupId,
+		"auto.offset.reset":    s.OffsetReset,
+		"max.poll.interval.ms": s.MaxPollIntervalMs,
+	}
+}
+
+func NewAbstractConsumer(config *Config, repository *Repository, topicId string, bulkerProducer *Producer, groupSettings ConsumerGroupSettings) *AbstractConsumer {
 	return &AbstractConsumer{
 		Service:        appbase.NewServiceBase(topicId),
 		config:         config,
 		topicId:        topicId,
 		bulkerProducer: bulkerProducer,
 		repository:     repository,
+		groupSettings:  groupSettings,
 	}
 }
 
+// GroupSettings returns consumer group settings consumer was created with
+func (ac *AbstractConsumer) GroupSettings() ConsumerGroupSettings {
+	return ac.groupSettings
+}
+
 func (ac *AbstractConsumer) GetInstanceId() string {
 	// range partitioner assigner distributes partitions between consumers in alphabetical order
 	// since bulker topics mostly have only 1 partition – instance with the lowest instanceId will be assigned for all topic.
@@ -77,6 +118,20 @@ func (ac *AbstractConsumer) SendMetrics(metricsMeta string, status string, event
 	}
 }
 
+// deadLetter sends message rejected by bulker stream (see bulker.RejectedObjectError) to dead-letter topic without retries
+func (ac *AbstractConsumer) deadLetter(destinationId string, message *kafka2.Message, rejectErr error) error {
+	deadTopic, _ := MakeTopicId(destinationId, deadTopicMode, allTablesToken, false)
+	headers := message.Headers
+	kafkabase.PutKafkaHeader(&headers, errorHeader, utils.ShortenStringWithEllipsis(rejectErr.Error(), 256))
+	kafkabase.PutKafkaHeader(&headers, originalTopicHeader, ac.topicId)
+	return ac.bulkerProducer.ProduceSync(deadTopic, kafka2.Message{
+		Key:            message.Key,
+		TopicPartition: kafka2.TopicPartition{Topic: &deadTopic, Partition: kafka2.PartitionAny},
+		Headers:        headers,
+		Value:          message.Value,
+	})
+}
+
 func RetryBackOffTime(config *Config, attempt int) time.Time {
 	backOffDelay := time.Duration(math.Min(math.Pow(config.MessagesRetryBackoffBase, float64(attempt)), config.MessagesRetryBackoffMaxDelay)) * time.Minute
 	return time.Now().Add(backOffDelay)
@@ -10,6 +10,7 @@ import (
 	"github.com/jitsucom/bulker/jitsubase/logging"
 	"github.com/jitsucom/bulker/jitsubase/safego"
 	"github.com/jitsucom/bulker/jitsubase/utils"
+	"github.com/jitsucom/bulker/kafkabase"
 	"net/http"
 	"runtime/debug"
 	"time"
@@ -23,8 +24,11 @@ type Context struct {
 	cron                *Cron
 	batchProducer       *Producer
 	streamProducer      *Producer
+	envelope            *kafkabase.EnvelopeNegotiator
 	eventsLogService    eventslog.EventsLogService
 	topicManager        *TopicManager
+	lagMonitor          *LagMonitor
+	stateCheckpointer   *StateCheckpointer
 	fastStore           *FastStore
 	server              *http.Server
 	metricsServer       *MetricsServer
@@ -68,7 +72,7 @@ func (a *Context) InitContext(settings *appbase.AppSettings) error {
 			return err
 		}
 	} else if eventsLogRedisUrl := utils.NvlString(a.config.EventsLogRedisURL, a.config.RedisURL); eventsLogRedisUrl != "" {
-		a.eventsLogService, err = eventslog.NewRedisEventsLog(eventsLogRedisUrl, a.config.RedisTLSCA, a.config.EventsLogMaxSize)
+		a.eventsLogService, err = eventslog.NewRedisEventsLog(eventsLogRedisUrl, a.config.RedisTLS(), a.config.EventsLogMaxSize)
 		if err != nil {
 			return err
 		}
@@ -79,8 +83,24 @@ func (a *Context) InitContext(settings *appbase.AppSettings) error {
 		return err
 	}
 
+	stateStore, err := NewStateStore(a.config)
+	if err != nil {
+		return err
+	}
+	if stateStore != nil {
+		a.stateCheckpointer = NewStateCheckpointer(stateStore, a.config.StateCheckpointPeriodSec)
+	}
+
 	a.kafkaConfig = a.config.GetKafkaConfig()
 	if a.kafkaConfig != nil {
+		a.envelope, err = kafkabase.NewEnvelopeNegotiator(&a.config.KafkaConfig, a.kafkaConfig, "bulker", a.config.InstanceId, true)
+		if err != nil {
+			return err
+		}
+		err = a.envelope.Start()
+		if err != nil {
+			return err
+		}
 		//batch producer uses higher linger.ms and doesn't suit for sync delivery used by stream consumer when retrying messages
 		batchProducerConfig := kafka.ConfigMap(utils.MapPutAll(kafka.ConfigMap{
 			"queue.buffering.max.messages": a.config.ProducerQueueSize,
@@ -92,6 +112,7 @@ func (a *Context) InitContext(settings *appbase.AppSettings) error {
 		if err != nil {
 			return err
 		}
+		a.batchProducer.SetEnvelopeNegotiator(a.envelope)
 		a.batchProducer.Start()
 
 		streamProducerConfig := kafka.ConfigMap(utils.MapPutAll(kafka.ConfigMap{
@@ -101,6 +122,7 @@ func (a *Context) InitContext(settings *appbase.AppSettings) error {
 		if err != nil {
 			return err
 		}
+		a.streamProducer.SetEnvelopeNegotiator(a.envelope)
 		a.streamProducer.Start()
 
 		a.topicManager, err = NewTopicManager(a)
@@ -108,6 +130,14 @@ func (a *Context) InitContext(settings *appbase.AppSettings) error {
 			return err
 		}
 		a.topicManager.Start()
+
+		if a.config.AutoscalingPeriodSec > 0 {
+			a.lagMonitor, err = NewLagMonitor(a)
+			if err != nil {
+				return err
+			}
+			a.lagMonitor.Start()
+		}
 	}
 
 	router := NewRouter(a)
@@ -117,7 +147,7 @@ func (a *Context) InitContext(settings *appbase.AppSettings) error {
 		ReadTimeout: time.Minute * 30,
 		IdleTimeout: time.Minute * 5,
 	}
-	a.metricsServer = NewMetricsServer(a.config)
+	a.metricsServer = NewMetricsServer(a.config, a.lagMonitor)
 	return nil
 }
 
@@ -132,12 +162,15 @@ func (a *Context) Cleanup() error {
 	time.Sleep(2 * time.Second)
 	a.cron.Close()
 	_ = a.topicManager.Close()
+	_ = a.lagMonitor.Close()
 	_ = a.repository.Close()
 	_ = a.configurationSource.Close()
 	_ = a.eventsLogService.Close()
+	_ = a.stateCheckpointer.Close()
 	_ = a.fastStore.Close()
 	_ = a.batchProducer.Close()
 	_ = a.streamProducer.Close()
+	_ = a.envelope.Close()
 	if a.config.ShutdownExtraDelay > 0 {
 		logging.Infof("Waiting %d seconds before http server shutdown...", a.config.ShutdownExtraDelay)
 		time.Sleep(time.Duration(a.config.ShutdownExtraDelay) * time.Second)
@@ -47,6 +47,26 @@ type Config struct {
 	// RedisURL that will be used by default by all services that need Redis
 	RedisURL   string `mapstructure:"REDIS_URL"`
 	RedisTLSCA string `mapstructure:"REDIS_TLS_CA"`
+	// RedisTLSCert and RedisTLSKey client certificate and private key for mutual TLS. PEM content or path to PEM file
+	RedisTLSCert       string `mapstructure:"REDIS_TLS_CERT"`
+	RedisTLSKey        string `mapstructure:"REDIS_TLS_KEY"`
+	RedisTLSServerName string `mapstructure:"REDIS_TLS_SERVER_NAME"`
+	// RedisTLSSkipVerify disables verification of Redis server certificate. Not recommended outside of development
+	RedisTLSSkipVerify bool `mapstructure:"REDIS_TLS_SKIP_VERIFY" default:"false"`
+
+	// # SECRETS - resolution of secret references in destinations credentials:
+	// `vault://<path>#<key>` and `aws-sm://<secret id or arn>[#<key>]`
+
+	VaultAddr      string `mapstructure:"VAULT_ADDR"`
+	VaultToken     string `mapstructure:"VAULT_TOKEN"`
+	VaultNamespace string `mapstructure:"VAULT_NAMESPACE"`
+	// SecretsAwsRegion region of AWS Secrets Manager for secret ids that are not ARNs. AWS credentials are taken from default credentials chain
+	SecretsAwsRegion string `mapstructure:"SECRETS_AWS_REGION"`
+	// SecretsTestAllowedPrefixes comma separated list of secret reference prefixes (e.g. `vault://secret/data/test/`)
+	// that may be used in ad-hoc configs sent to /test endpoint. Other references are accepted only if they are used by configured destination with the same id
+	SecretsTestAllowedPrefixes string `mapstructure:"SECRETS_TEST_ALLOWED_PREFIXES"`
+	// SecretsCacheTTLSec how long resolved secrets are cached. Destinations with rotated secrets are recreated after cache expiration
+	SecretsCacheTTLSec int `mapstructure:"SECRETS_CACHE_TTL_SEC" default:"300"`
 
 	// TopicManagerRefreshPeriodSec how often topic manager will check for new topics
 	TopicManagerRefreshPeriodSec int `mapstructure:"TOPIC_MANAGER_REFRESH_PERIOD_SEC" default:"5"`
@@ -56,6 +76,10 @@ type Config struct {
 	BatchRunnerPeriodSec          int `mapstructure:"BATCH_RUNNER_DEFAULT_PERIOD_SEC" default:"300"`
 	BatchRunnerDefaultBatchSize   int `mapstructure:"BATCH_RUNNER_DEFAULT_BATCH_SIZE" default:"10000"`
 	BatchRunnerWaitForMessagesSec int `mapstructure:"BATCH_RUNNER_WAIT_FOR_MESSAGES_SEC" default:"5"`
+	// BatchRunnerTriggerCheckPeriodSec how often consumer lag is checked for destinations with threshold batch triggers
+	BatchRunnerTriggerCheckPeriodSec int `mapstructure:"BATCH_RUNNER_TRIGGER_CHECK_PERIOD_SEC" default:"10"`
+	// BatchRunnerMaxInFlightEvents max number of events consumed by batch consumers of destination and not yet committed. 0 - unbounded
+	BatchRunnerMaxInFlightEvents int `mapstructure:"BATCH_RUNNER_MAX_IN_FLIGHT_EVENTS" default:"0"`
 
 	// # ERROR RETRYING
 
@@ -69,6 +93,13 @@ type Config struct {
 	// MessagesRetryBackoffMaxDelay defines maximum possible retry delay in minutes. Default: 1440 minutes = 24 hours
 	MessagesRetryBackoffMaxDelay float64 `mapstructure:"MESSAGES_RETRY_BACKOFF_MAX_DELAY" default:"1440"`
 
+	// # STATE CHECKPOINTS
+
+	// StateStore where checkpoints of streams states are persisted: redis://, postgres:// or file:// URL. Empty - checkpoints are not persisted
+	StateStore string `mapstructure:"STATE_STORE"`
+	// StateCheckpointPeriodSec how often changed states of streams are persisted to StateStore
+	StateCheckpointPeriodSec int `mapstructure:"STATE_CHECKPOINT_PERIOD_SEC" default:"10"`
+
 	// # EVENTS REDIS LOGGING
 
 	EventsLogRedisURL string `mapstructure:"EVENTS_LOG_REDIS_URL"`
@@ -79,6 +110,8 @@ type Config struct {
 	MetricsPort             int    `mapstructure:"METRICS_PORT" default:"9091"`
 	MetricsRelayDestination string `mapstructure:"METRICS_RELAY_DESTINATION"`
 	MetricsRelayPeriodSec   int    `mapstructure:"METRICS_RELAY_PERIOD_SEC" default:"60"`
+	// AutoscalingPeriodSec how often consumer lag and processing rate of destination topics are measured. 0 - disabled
+	AutoscalingPeriodSec int `mapstructure:"AUTOSCALING_PERIOD_SEC" default:"30"`
 
 	InstanceIndex int `mapstructure:"INSTANCE_INDEX" default:"0"`
 	ShardsCount   int `mapstructure:"SHARDS" default:"1"`
@@ -104,3 +137,14 @@ func (ac *Config) PostInit(settings *appbase.AppSettings) error {
 	ac.GlobalHashSecrets = strings.Split(ac.GlobalHashSecret, ",")
 	return nil
 }
+
+// RedisTLS returns TLS configuration for Redis connections
+func (ac *Config) RedisTLS() *utils.TLSConfig {
+	return &utils.TLSConfig{
+		CA:                 ac.RedisTLSCA,
+		ClientCert:         ac.RedisTLSCert,
+		ClientKey:          ac.RedisTLSKey,
+		ServerName:         ac.RedisTLSServerName,
+		InsecureSkipVerify: ac.RedisTLSSkipVerify,
+	}
+}
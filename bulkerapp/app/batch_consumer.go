@@ -7,6 +7,7 @@ import (
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
 	"github.com/jitsucom/bulker/bulkerapp/metrics"
 	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/implementations/sql"
 	"github.com/jitsucom/bulker/bulkerlib/types"
 	"github.com/jitsucom/bulker/eventslog"
 	"github.com/jitsucom/bulker/jitsubase/timestamp"
@@ -19,18 +20,20 @@ import (
 
 type BatchConsumerImpl struct {
 	*AbstractBatchConsumer
-	eventsLogService eventslog.EventsLogService
+	eventsLogService  eventslog.EventsLogService
+	stateCheckpointer *StateCheckpointer
 }
 
-func NewBatchConsumer(repository *Repository, destinationId string, batchPeriodSec int, topicId string, config *Config, kafkaConfig *kafka.ConfigMap, bulkerProducer *Producer, eventsLogService eventslog.EventsLogService) (*BatchConsumerImpl, error) {
+func NewBatchConsumer(repository *Repository, destinationId string, triggers BatchTriggers, topicId string, config *Config, kafkaConfig *kafka.ConfigMap, bulkerProducer *Producer, eventsLogService eventslog.EventsLogService, stateCheckpointer *StateCheckpointer) (*BatchConsumerImpl, error) {
 
-	base, err := NewAbstractBatchConsumer(repository, destinationId, batchPeriodSec, topicId, "batch", config, kafkaConfig, bulkerProducer)
+	base, err := NewAbstractBatchConsumer(repository, destinationId, triggers, topicId, "batch", config, kafkaConfig, bulkerProducer)
 	if err != nil {
 		return nil, err
 	}
 	bc := BatchConsumerImpl{
 		AbstractBatchConsumer: base,
 		eventsLogService:      eventsLogService,
+		stateCheckpointer:     stateCheckpointer,
 	}
 	bc.batchFunc = bc.processBatchImpl
 	bc.pause()
@@ -59,7 +62,7 @@ func (bc *BatchConsumerImpl) processBatchImpl(destination *Destination, batchNum
 			}
 			if failedPosition != nil {
 				cnts, err2 := bc.processFailed(firstPosition, failedPosition, err)
-				counters.deadLettered = cnts.deadLettered
+				counters.deadLettered += cnts.deadLettered
 				counters.retryScheduled = cnts.retryScheduled
 				if err2 != nil {
 					bc.errorMetric("PROCESS_FAILED_ERROR")
@@ -74,8 +77,23 @@ func (bc *BatchConsumerImpl) processBatchImpl(destination *Destination, batchNum
 			bc.SendMetrics(kafkabase.GetKafkaHeader(latestMessage, MetricsMetaHeader), "success", counters.processed)
 		}
 	}()
+	inFlight := bc.repository.InFlightEvents(bc.destinationId)
+	maxInFlight := maxInFlightEvents(bc.config, destination.streamOptions)
+	if !bc.waitForInFlightCapacity(inFlight, maxInFlight) {
+		return counters, false, nil
+	}
+	//in-flight bound of destination was reached: batch is committed earlier to free the capacity
+	boundReached := false
 	var processedObjectSample types.Object
+	//events of the batch consumed to bulker stream. They are in-flight until batch is committed or aborted
 	processed := 0
+	defer func() {
+		bc.addInFlight(inFlight, -int64(processed))
+	}()
+	//events rejected by bulker stream and moved to dead-letter topic. See bulker.RejectedObjectError
+	rejected := 0
+	//number of consumed messages. Framed message carries multiple events
+	messages := 0
 	for i := 0; i < batchSize; i++ {
 		if bc.retired.Load() {
 			if bulkerStream != nil {
@@ -89,6 +107,11 @@ func (bc *BatchConsumerImpl) processBatchImpl(destination *Destination, batchNum
 			// we reached the end of the topic
 			break
 		}
+		if maxInFlight > 0 && processed > 0 && inFlight.Load() >= maxInFlight {
+			bc.Debugf("In-flight events of destination reached the bound: %d. Stopping batch", maxInFlight)
+			boundReached = true
+			break
+		}
 		message, err := bc.consumer.Load().ReadMessage(bc.waitForMessages)
 		if err != nil {
 			kafkaErr := err.(kafka.Error)
@@ -114,28 +137,73 @@ func (bc *BatchConsumerImpl) processBatchImpl(destination *Destination, batchNum
 			firstPosition = &message.TopicPartition
 			counters.firstOffset = int64(message.TopicPartition.Offset)
 		}
-		obj := types.Object{}
-		dec := jsoniter.NewDecoder(bytes.NewReader(message.Value))
-		dec.UseNumber()
-		err = dec.Decode(&obj)
-		if err == nil {
-			if bulkerStream == nil {
-				destination.InitBulkerInstance()
-				bulkerStream, err = destination.bulker.CreateStream(bc.topicId, bc.tableName, bulker.Batch, destination.streamOptions.Options...)
-				if err != nil {
-					bc.errorMetric("failed to create bulker stream")
-					err = bc.NewError("Failed to create bulker stream: %v", err)
+		var events [][]byte
+		if err = kafkabase.CheckEnvelopeVersion(message); err == nil {
+			events, err = kafkabase.UnpackEvents(message)
+			if err != nil {
+				bc.errorMetric("unpack_frame_error")
+			} else {
+				bc.trackConsumed(events)
+				// events of frame are counted individually
+				counters.consumed += len(events) - 1
+				if retriesHeader != "" {
+					counters.retried += len(events) - 1
 				}
 			}
-			if err == nil {
-				bc.Debugf("%d. Consumed Message ID: %s Offset: %s (Retries: %s) for: %s", i, obj.Id(), message.TopicPartition.Offset.String(), kafkabase.GetKafkaHeader(message, retriesCountHeader), destination.config.BulkerType)
-				_, processedObjectSample, err = bulkerStream.Consume(ctx, obj)
-				if err != nil {
-					bc.errorMetric("bulker_stream_error")
+		} else {
+			// message produced by newer release during rolling upgrade goes to retry topic and waits for upgraded instance
+			bc.errorMetric("envelope_version_error")
+		}
+		objects := make([]types.Object, 0, len(events))
+		for _, event := range events {
+			obj := types.Object{}
+			dec := jsoniter.NewDecoder(bytes.NewReader(event))
+			dec.UseNumber()
+			err = dec.Decode(&obj)
+			if err != nil {
+				bc.errorMetric("parse_event_error")
+				break
+			}
+			bc.Debugf("%d. Consumed Message ID: %s Offset: %s (Retries: %s) for: %s", i, obj.Id(), message.TopicPartition.Offset.String(), kafkabase.GetKafkaHeader(message, retriesCountHeader), destination.config.BulkerType)
+			objects = append(objects, obj)
+		}
+		if err == nil && len(objects) > 0 && bulkerStream == nil {
+			destination.InitBulkerInstance()
+			bulkMode := bulker.Batch
+			if sql.CDCOption.Get(destination.streamOptions) != nil {
+				//events of destinations with cdc option carry operation type
+				bulkMode = bulker.CDC
+			}
+			bulkerStream, err = destination.CreateStream(bc.topicId, bc.tableName, bulkMode)
+			if err != nil {
+				bc.errorMetric("failed to create bulker stream")
+				err = bc.NewError("Failed to create bulker stream: %v", err)
+			}
+		}
+		//events of frame are consumed with a single call. Consumption continues after rejected event
+		for offset := 0; err == nil && offset < len(objects); {
+			var processedObjects []types.Object
+			_, processedObjects, err = bulkerStream.ConsumeBatch(ctx, objects[offset:])
+			processed += len(processedObjects)
+			inFlight.Add(int64(len(processedObjects)))
+			if len(processedObjects) > 0 {
+				processedObjectSample = processedObjects[len(processedObjects)-1]
+			}
+			offset += len(processedObjects)
+			if bulker.IsRejectedObjectError(err) {
+				bc.errorMetric("rejected_event")
+				// rejected event doesn't fail the batch. Only rejected event of frame is moved to dead-letter topic
+				bc.Warnf("Event at offset %s was rejected. Moving to dead-letter topic: %v", message.TopicPartition.Offset.String(), err)
+				if err = bc.deadLetter(bc.destinationId, kafkabase.FrameEventMessage(message, events[offset]), err); err == nil {
+					rejected++
+					counters.deadLettered++
+					offset++
+					continue
 				}
+				err = bc.NewError("Failed to move rejected event to dead-letter topic: %v", err)
+			} else if err != nil {
+				bc.errorMetric("bulker_stream_error")
 			}
-		} else {
-			bc.errorMetric("parse_event_error")
 		}
 		if err != nil {
 			failedPosition = &latestMessage.TopicPartition
@@ -148,17 +216,18 @@ func (bc *BatchConsumerImpl) processBatchImpl(destination *Destination, batchNum
 			state.ProcessingTimeSec = time.Since(startTime).Seconds()
 			bc.postEventsLog(state, processedObjectSample, err)
 			return counters, false, bc.NewError("Failed to process event to bulker stream: %v", err)
-		} else {
-			processed++
 		}
+		messages++
 	}
 	//we've processed some messages. it is time to commit them
 	if processed > 0 {
-		if processed == batchSize {
+		if messages == batchSize || boundReached {
 			nextBatch = true
 		}
 		// we need to pause consumer to avoid kafka session timeout while loading huge batches to slow destinations
 		bc.pause()
+		// report events of the batch waiting for commit
+		bc.addInFlight(inFlight, 0)
 
 		bc.Infof("Committing %d events to %s", processed, destination.config.BulkerType)
 		var state bulker.State
@@ -178,8 +247,22 @@ func (bc *BatchConsumerImpl) processBatchImpl(destination *Destination, batchNum
 			err = bc.NewError("Failed to commit kafka consumer: %v", err)
 			return
 		}
-	} else if bulkerStream != nil {
-		_, _ = bulkerStream.Abort(ctx)
+	} else {
+		if bulkerStream != nil {
+			_, _ = bulkerStream.Abort(ctx)
+		}
+		if rejected > 0 {
+			//all events of the batch were rejected and moved to dead-letter topic
+			if messages == batchSize {
+				nextBatch = true
+			}
+			_, err = bc.consumer.Load().CommitMessage(latestMessage)
+			if err != nil {
+				bc.errorMetric("KAFKA_COMMIT_ERR:" + metrics.KafkaErrorCode(err))
+				bc.SystemErrorf("Failed to commit kafka consumer after rejected events were moved to dead-letter topic: %v", err)
+				err = bc.NewError("Failed to commit kafka consumer: %v", err)
+			}
+		}
 	}
 	return
 }
@@ -253,8 +336,8 @@ func (bc *BatchConsumerImpl) processFailed(firstPosition *kafka.TopicPartition,
 		if err != nil {
 			bc.Errorf("failed to read retry header: %v", err)
 		}
-		if retries >= bc.config.MessagesRetryCount {
-			//no attempts left - send to dead-letter topic
+		if retries >= bc.config.MessagesRetryCount && !kafkabase.EnvelopeVersionTooNew(message) {
+			//no attempts left - send to dead-letter topic. Messages of newer envelope version are kept for upgraded instances
 			deadLettered = true
 			failedTopic, _ = MakeTopicId(bc.destinationId, deadTopicMode, allTablesToken, false)
 		}
@@ -307,6 +390,8 @@ func (bc *BatchConsumerImpl) postEventsLog(state bulker.State, processedObjectSa
 	if batchErr != nil && state.LastError == nil {
 		state.SetError(batchErr)
 	}
+	bc.stateCheckpointer.Checkpoint(bc.destinationId, bc.tableName, "batch", state)
+	bc.stateCheckpointer.RecordFiles(bc.destinationId, bc.tableName, "batch", state.Files)
 	batchState := BatchState{State: state, LastMappedRow: processedObjectSample}
 	level := eventslog.LevelInfo
 	if batchErr != nil {
@@ -0,0 +1,101 @@
+package app
+
+import (
+	"fmt"
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"strings"
+)
+
+// defaultEventSizeEstimate size of event assumed by bytes trigger until the first batch of consumer is processed
+const defaultEventSizeEstimate = 1024
+
+// BatchTriggers conditions that start batch of batch consumer. Batch starts when any of configured triggers fires
+type BatchTriggers struct {
+	// PeriodSec period of batch runs. 0 - no periodic runs
+	PeriodSec int
+	// Schedule cron expression of batch runs
+	Schedule string
+	// Rows threshold of estimated number of pending events
+	Rows int
+	// Bytes threshold of estimated size of pending events
+	Bytes int
+	// Lag threshold of pending messages in topic
+	Lag int
+}
+
+// NewBatchTriggers returns triggers of batch consumer configured in destination stream options
+func NewBatchTriggers(config *Config, streamOptions *bulker.StreamOptions) BatchTriggers {
+	schedule := bulker.BatchScheduleOption.Get(streamOptions)
+	periodSec := int(bulker.BatchFrequencyOption.Get(streamOptions) * 60)
+	if periodSec == 0 && schedule == "" {
+		periodSec = config.BatchRunnerPeriodSec
+	}
+	return BatchTriggers{
+		PeriodSec: periodSec,
+		Schedule:  schedule,
+		Rows:      bulker.BatchTriggerRowsOption.Get(streamOptions),
+		Bytes:     bulker.BatchTriggerBytesOption.Get(streamOptions),
+		Lag:       bulker.BatchTriggerLagOption.Get(streamOptions),
+	}
+}
+
+// HasThresholds returns true if any of thresholds triggers that require periodic checks of consumer lag is configured
+func (t BatchTriggers) HasThresholds() bool {
+	return t.Rows > 0 || t.Bytes > 0 || t.Lag > 0
+}
+
+// firedThreshold returns name of threshold trigger fired by lag and estimated size of pending events. Empty string if none fired
+func (t BatchTriggers) firedThreshold(lag int64, rows, bytes float64) string {
+	switch {
+	case t.Lag > 0 && lag >= int64(t.Lag):
+		return "lag"
+	case t.Rows > 0 && rows >= float64(t.Rows):
+		return "rows"
+	case t.Bytes > 0 && bytes >= float64(t.Bytes):
+		return "bytes"
+	}
+	return ""
+}
+
+// estimatePending estimates number and size of events in pending messages from previously consumed messages
+func estimatePending(lag, consumedMessages, consumedEvents, consumedBytes int64) (rows, bytes float64) {
+	eventsPerMessage, bytesPerEvent := 1.0, float64(defaultEventSizeEstimate)
+	if consumedMessages > 0 {
+		eventsPerMessage = float64(consumedEvents) / float64(consumedMessages)
+		if consumedEvents > 0 {
+			bytesPerEvent = float64(consumedBytes) / float64(consumedEvents)
+		}
+	}
+	rows = float64(lag) * eventsPerMessage
+	return rows, rows * bytesPerEvent
+}
+
+// partitionLag returns number of messages of partition after committed offset. Negative offset means that nothing was committed yet
+func partitionLag(lowOffset, highOffset int64, committed kafka.Offset) int64 {
+	committedOffset := lowOffset
+	if committed >= 0 {
+		committedOffset = max(int64(committed), lowOffset)
+	}
+	return max(highOffset-committedOffset, 0)
+}
+
+func (t BatchTriggers) String() string {
+	parts := make([]string, 0, 5)
+	if t.PeriodSec > 0 {
+		parts = append(parts, fmt.Sprintf("period: %ds", t.PeriodSec))
+	}
+	if t.Schedule != "" {
+		parts = append(parts, fmt.Sprintf("schedule: '%s'", t.Schedule))
+	}
+	if t.Rows > 0 {
+		parts = append(parts, fmt.Sprintf("rows: %d", t.Rows))
+	}
+	if t.Bytes > 0 {
+		parts = append(parts, fmt.Sprintf("bytes: %d", t.Bytes))
+	}
+	if t.Lag > 0 {
+		parts = append(parts, fmt.Sprintf("lag: %d", t.Lag))
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,96 @@
+package app
+
+import (
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestNewBatchTriggers(t *testing.T) {
+	config := &Config{BatchRunnerPeriodSec: 300}
+	tests := []struct {
+		name    string
+		options []bulker.StreamOption
+		want    BatchTriggers
+		string  string
+	}{
+		{"default_period", nil, BatchTriggers{PeriodSec: 300}, "period: 300s"},
+		{"frequency", []bulker.StreamOption{bulker.WithOption(&bulker.BatchFrequencyOption, 0.5)}, BatchTriggers{PeriodSec: 30}, "period: 30s"},
+		{"schedule_replaces_default_period", []bulker.StreamOption{bulker.WithOption(&bulker.BatchScheduleOption, "0 * * * *")},
+			BatchTriggers{Schedule: "0 * * * *"}, "schedule: '0 * * * *'"},
+		{"schedule_and_frequency", []bulker.StreamOption{bulker.WithOption(&bulker.BatchScheduleOption, "0 * * * *"), bulker.WithOption(&bulker.BatchFrequencyOption, 10.0)},
+			BatchTriggers{PeriodSec: 600, Schedule: "0 * * * *"}, "period: 600s schedule: '0 * * * *'"},
+		{"thresholds_with_default_period", []bulker.StreamOption{
+			bulker.WithOption(&bulker.BatchTriggerRowsOption, 1000),
+			bulker.WithOption(&bulker.BatchTriggerBytesOption, 1<<20),
+			bulker.WithOption(&bulker.BatchTriggerLagOption, 100)},
+			BatchTriggers{PeriodSec: 300, Rows: 1000, Bytes: 1 << 20, Lag: 100}, "period: 300s rows: 1000 bytes: 1048576 lag: 100"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := bulker.StreamOptions{}
+			for _, option := range tt.options {
+				option(&options)
+			}
+			triggers := NewBatchTriggers(config, &options)
+			require.Equal(t, tt.want, triggers)
+			require.Equal(t, tt.string, triggers.String())
+			require.Equal(t, tt.want.Rows > 0 || tt.want.Bytes > 0 || tt.want.Lag > 0, triggers.HasThresholds())
+		})
+	}
+}
+
+func TestFiredThreshold(t *testing.T) {
+	tests := []struct {
+		name     string
+		triggers BatchTriggers
+		lag      int64
+		// consumed so far
+		messages, events, bytes int64
+		want                    string
+	}{
+		{"no_thresholds", BatchTriggers{PeriodSec: 300}, 1_000_000, 0, 0, 0, ""},
+		{"lag_below", BatchTriggers{Lag: 100}, 99, 0, 0, 0, ""},
+		{"lag_reached", BatchTriggers{Lag: 100}, 100, 0, 0, 0, "lag"},
+		// without consumed messages one event of default size per message is assumed
+		{"rows_default_estimate", BatchTriggers{Rows: 100}, 100, 0, 0, 0, "rows"},
+		{"rows_framed_messages", BatchTriggers{Rows: 100}, 10, 10, 100, 10_000, "rows"},
+		{"rows_below", BatchTriggers{Rows: 100}, 9, 10, 100, 10_000, ""},
+		{"bytes_default_estimate", BatchTriggers{Bytes: 10 * defaultEventSizeEstimate}, 10, 0, 0, 0, "bytes"},
+		{"bytes_consumed_estimate", BatchTriggers{Bytes: 10_000}, 10, 10, 10, 10_000, "bytes"},
+		{"bytes_below", BatchTriggers{Bytes: 10_000}, 9, 10, 10, 10_000, ""},
+		{"lag_wins", BatchTriggers{Rows: 10, Bytes: 10, Lag: 10}, 10, 0, 0, 0, "lag"},
+		{"rows_before_bytes", BatchTriggers{Rows: 10, Bytes: 10, Lag: 1000}, 10, 0, 0, 0, "rows"},
+		{"bytes_when_rows_below", BatchTriggers{Rows: 1000, Bytes: 10, Lag: 1000}, 10, 0, 0, 0, "bytes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, bytes := estimatePending(tt.lag, tt.messages, tt.events, tt.bytes)
+			require.Equal(t, tt.want, tt.triggers.firedThreshold(tt.lag, rows, bytes))
+		})
+	}
+}
+
+func TestPartitionLag(t *testing.T) {
+	tests := []struct {
+		name      string
+		low, high int64
+		committed kafka.Offset
+		want      int64
+	}{
+		{"nothing_committed", 10, 50, kafka.OffsetInvalid, 40},
+		{"committed", 10, 50, 45, 5},
+		{"committed_up_to_date", 10, 50, 50, 0},
+		{"committed_before_retention", 10, 50, 5, 40},
+		{"empty_partition", 0, 0, kafka.OffsetInvalid, 0},
+	}
+	var total int64
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, partitionLag(tt.low, tt.high, tt.committed))
+		})
+		total += partitionLag(tt.low, tt.high, tt.committed)
+	}
+	require.Equal(t, int64(85), total, "lag of consumer is a sum of lags of assigned partitions")
+}
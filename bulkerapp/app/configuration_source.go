@@ -24,6 +24,8 @@ type DestinationConfig struct {
 	bulker.Config       `mapstructure:",squash"`
 	bulker.StreamConfig `mapstructure:",squash"`
 	Special             string `mapstructure:"special" json:"special"`
+	// WorkspaceId workspace of destination. Used to enable feature flags and default options per workspace. See FeatureFlagRule, DefaultOptionsRule
+	WorkspaceId string `mapstructure:"workspaceId" json:"workspaceId,omitempty"`
 }
 
 func (dc *DestinationConfig) Id() string {
@@ -99,6 +101,9 @@ type YamlConfigurationSource struct {
 
 	config       map[string]any
 	destinations map[string]*DestinationConfig
+	featureFlags []*FeatureFlagRule
+	// defaultOptions default stream options inherited by destinations
+	defaultOptions []*DefaultOptionsRule
 }
 
 func NewYamlConfigurationSource(data []byte) (*YamlConfigurationSource, error) {
@@ -121,6 +126,16 @@ func NewYamlConfigurationSource(data []byte) (*YamlConfigurationSource, error) {
 }
 
 func (ycp *YamlConfigurationSource) init() error {
+	if featureFlagsRaw, ok := ycp.config[featureFlagsKey]; ok {
+		if err := mapstructure.Decode(featureFlagsRaw, &ycp.featureFlags); err != nil {
+			return ycp.NewError("failed to parse feature flags: %v", err)
+		}
+	}
+	if defaultOptionsRaw, ok := ycp.config[defaultOptionsKey]; ok {
+		if err := mapstructure.Decode(defaultOptionsRaw, &ycp.defaultOptions); err != nil {
+			return ycp.NewError("failed to parse default options: %v", err)
+		}
+	}
 	destinationsRaw, ok := ycp.config[destinationsKey]
 	if !ok {
 		return nil
@@ -159,6 +174,14 @@ func (ycp *YamlConfigurationSource) GetDestinationConfig(id string) *Destination
 	return ycp.destinations[id]
 }
 
+func (ycp *YamlConfigurationSource) GetFeatureFlags() []*FeatureFlagRule {
+	return ycp.featureFlags
+}
+
+func (ycp *YamlConfigurationSource) GetDefaultOptions() []*DefaultOptionsRule {
+	return ycp.defaultOptions
+}
+
 func (ycp *YamlConfigurationSource) GetValue(key string) any {
 	return ycp.config[key]
 }
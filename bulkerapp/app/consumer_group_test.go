@@ -0,0 +1,89 @@
+package app
+
+import (
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/jitsubase/appbase"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"github.com/jitsucom/bulker/kafkabase"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// consumerGroupTestConsumer consumer that only records retirement
+type consumerGroupTestConsumer struct {
+	topicId       string
+	groupSettings ConsumerGroupSettings
+	retired       bool
+}
+
+func (c *consumerGroupTestConsumer) Retire() {
+	c.retired = true
+}
+
+func (c *consumerGroupTestConsumer) TopicId() string {
+	return c.topicId
+}
+
+func (c *consumerGroupTestConsumer) GroupSettings() ConsumerGroupSettings {
+	return c.groupSettings
+}
+
+func consumerGroupTestDestination(t *testing.T, options map[string]any) *Destination {
+	streamOptions := &bulker.StreamOptions{}
+	for name, value := range options {
+		option, err := bulker.ParseOption(name, value)
+		require.NoError(t, err)
+		streamOptions.Add(option)
+	}
+	config := &DestinationConfig{}
+	config.Config.Id = "d1"
+	return &Destination{config: config, streamOptions: streamOptions}
+}
+
+func TestConsumerGroupSettings(t *testing.T) {
+	config := &Config{KafkaConfig: kafkabase.KafkaConfig{KafkaMaxPollIntervalMs: 300000}}
+	tests := []struct {
+		name    string
+		options map[string]any
+		retry   bool
+		want    ConsumerGroupSettings
+	}{
+		{"defaults", nil, false, ConsumerGroupSettings{GroupId: "in.id.d1.m.batch.t.events", OffsetReset: "earliest", MaxPollIntervalMs: 300000}},
+		{"options", map[string]any{"consumerGroupPrefix": "v2_", "autoOffsetReset": "latest", "maxPollIntervalMs": 600000}, false,
+			ConsumerGroupSettings{GroupId: "v2_in.id.d1.m.batch.t.events", OffsetReset: "latest", MaxPollIntervalMs: 600000}},
+		{"retry_from_earliest", map[string]any{"consumerGroupPrefix": "v2_", "autoOffsetReset": "latest"}, true,
+			ConsumerGroupSettings{GroupId: "v2_in.id.d1.m.batch.t.events", OffsetReset: "earliest", MaxPollIntervalMs: 300000}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			destination := consumerGroupTestDestination(t, tt.options)
+			settings := NewConsumerGroupSettings(config, destination.streamOptions, "in.id.d1.m.batch.t.events", tt.retry)
+			require.Equal(t, tt.want, settings)
+			require.Equal(t, kafka.ConfigMap{"group.id": tt.want.GroupId, "auto.offset.reset": tt.want.OffsetReset, "max.poll.interval.ms": tt.want.MaxPollIntervalMs}, settings.configMap())
+		})
+	}
+	_, err := bulker.ParseOption("autoOffsetReset", "smallest")
+	require.ErrorContains(t, err, "unknown autoOffsetReset: smallest")
+}
+
+func TestExcludeConsumersWithChangedGroup(t *testing.T) {
+	config := &Config{KafkaConfig: kafkabase.KafkaConfig{KafkaMaxPollIntervalMs: 300000}}
+	batchTopic, retryTopic := "in.id.d1.m.batch.t.events", "in.id.d1.m.retry.t._all_"
+	tm := &TopicManager{Service: appbase.NewServiceBase("topic-manager"), config: config,
+		destinationTopics: map[string]utils.Set[string]{"d1": utils.NewSet(batchTopic, retryTopic)}}
+	destination := consumerGroupTestDestination(t, nil)
+	batchConsumer := &consumerGroupTestConsumer{topicId: batchTopic, groupSettings: NewConsumerGroupSettings(config, destination.streamOptions, batchTopic, false)}
+	retryConsumer := &consumerGroupTestConsumer{topicId: retryTopic, groupSettings: NewConsumerGroupSettings(config, destination.streamOptions, retryTopic, true)}
+	consumers := []*consumerGroupTestConsumer{batchConsumer, retryConsumer}
+
+	//unchanged settings keep consumers
+	require.Equal(t, consumers, excludeConsumersWithChangedGroup(tm, consumers, destination))
+
+	//retry consumers ignore offset reset
+	destination = consumerGroupTestDestination(t, map[string]any{"autoOffsetReset": "latest"})
+	require.Equal(t, []*consumerGroupTestConsumer{retryConsumer}, excludeConsumersWithChangedGroup(tm, consumers, destination))
+	require.True(t, batchConsumer.retired)
+	require.False(t, retryConsumer.retired)
+	require.Equal(t, utils.NewSet(retryTopic), tm.destinationTopics["d1"])
+}
@@ -1,6 +1,7 @@
 package app
 
 import (
+	"fmt"
 	"github.com/go-co-op/gocron/v2"
 	"github.com/jitsucom/bulker/jitsubase/appbase"
 	"github.com/jitsucom/bulker/jitsubase/utils"
@@ -21,22 +22,47 @@ func NewCron(config *Config) *Cron {
 	return &Cron{Service: base, scheduler: s, config: config}
 }
 
-func (c *Cron) AddBatchConsumer(batchConsumer BatchConsumer) (gocron.Job, error) {
-	options := []gocron.JobOption{gocron.WithTags(batchConsumer.TopicId())}
-	if batchConsumer.BatchPeriodSec() > 1 {
-		//randomize start time to avoid all batch run at the same time
-		delay := rand.Intn(batchConsumer.BatchPeriodSec())
-		//don't do small delays. gocron doesn't like StartDateTime at past. with small delays that may be possible
-		if delay > 5 {
-			options = append(options, gocron.WithStartAt(gocron.WithStartDateTime(time.Now().Add(time.Duration(delay)*time.Second))))
+// AddBatchConsumer schedules jobs of batch consumer: one job per configured trigger. All jobs are tagged with topic id
+func (c *Cron) AddBatchConsumer(batchConsumer BatchConsumer) error {
+	triggers := batchConsumer.Triggers()
+	tags := gocron.WithTags(batchConsumer.TopicId())
+	if triggers.PeriodSec > 0 {
+		options := []gocron.JobOption{tags}
+		if triggers.PeriodSec > 1 {
+			//randomize start time to avoid all batch run at the same time
+			delay := rand.Intn(triggers.PeriodSec)
+			//don't do small delays. gocron doesn't like StartDateTime at past. with small delays that may be possible
+			if delay > 5 {
+				options = append(options, gocron.WithStartAt(gocron.WithStartDateTime(time.Now().Add(time.Duration(delay)*time.Second))))
+			}
+		}
+		_, err := c.scheduler.NewJob(gocron.DurationJob(time.Duration(triggers.PeriodSec)*time.Second),
+			gocron.NewTask(batchConsumer.RunJob),
+			options...)
+		if err != nil {
+			return err
+		}
+	}
+	if triggers.Schedule != "" {
+		_, err := c.scheduler.NewJob(gocron.CronJob(triggers.Schedule, false), gocron.NewTask(batchConsumer.RunJob), tags)
+		if err != nil {
+			c.RemoveBatchConsumer(batchConsumer)
+			return fmt.Errorf("invalid batch schedule '%s': %v", triggers.Schedule, err)
+		}
+	}
+	if triggers.HasThresholds() {
+		_, err := c.scheduler.NewJob(gocron.DurationJob(time.Duration(c.config.BatchRunnerTriggerCheckPeriodSec)*time.Second),
+			gocron.NewTask(batchConsumer.RunJobIfTriggered),
+			tags, gocron.WithSingletonMode(gocron.LimitModeReschedule))
+		if err != nil {
+			c.RemoveBatchConsumer(batchConsumer)
+			return err
 		}
 	}
-	return c.scheduler.NewJob(gocron.DurationJob(time.Duration(batchConsumer.BatchPeriodSec())*time.Second),
-		gocron.NewTask(batchConsumer.RunJob),
-		options...)
+	return nil
 }
 
-func (c *Cron) ReplaceBatchConsumer(batchConsumer BatchConsumer) (gocron.Job, error) {
+func (c *Cron) ReplaceBatchConsumer(batchConsumer BatchConsumer) error {
 	c.RemoveBatchConsumer(batchConsumer)
 	return c.AddBatchConsumer(batchConsumer)
 }
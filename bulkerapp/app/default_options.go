@@ -0,0 +1,72 @@
+package app
+
+import (
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"sort"
+)
+
+// defaultOptionsKey key of default options rules in configuration source
+const defaultOptionsKey = "defaultOptions"
+
+// DefaultOptionsRule default stream options inherited by destinations of listed workspaces and destination types.
+// Rule without workspaces and types applies to all destinations
+type DefaultOptionsRule struct {
+	Workspaces []string       `mapstructure:"workspaces" json:"workspaces,omitempty"`
+	Types      []string       `mapstructure:"types" json:"types,omitempty"`
+	Options    map[string]any `mapstructure:"options" json:"options,omitempty"`
+}
+
+// DefaultOptionsSource optional interface for ConfigurationSource that delivers default options
+type DefaultOptionsSource interface {
+	GetDefaultOptions() []*DefaultOptionsRule
+}
+
+// specificityFor returns -1 if rule doesn't apply to destination.
+// Otherwise, the more specific rule is, the higher value: workspace rules win over type rules, both win over global rules
+func (r *DefaultOptionsRule) specificityFor(cfg *DestinationConfig) int {
+	specificity := 0
+	if len(r.Workspaces) > 0 {
+		if cfg.WorkspaceId == "" || !utils.ArrayContains(r.Workspaces, cfg.WorkspaceId) {
+			return -1
+		}
+		specificity += 2
+	}
+	if len(r.Types) > 0 {
+		if !utils.ArrayContains(r.Types, cfg.BulkerType) {
+			return -1
+		}
+		specificity += 1
+	}
+	return specificity
+}
+
+// defaultOptionsFor returns default options inherited by destination.
+// Options of more specific rules override less specific ones, among equally specific rules the latter wins
+func defaultOptionsFor(rules []*DefaultOptionsRule, cfg *DestinationConfig) map[string]any {
+	type matchedRule struct {
+		rule        *DefaultOptionsRule
+		specificity int
+	}
+	var matched []matchedRule
+	for _, rule := range rules {
+		if specificity := rule.specificityFor(cfg); specificity >= 0 {
+			matched = append(matched, matchedRule{rule: rule, specificity: specificity})
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].specificity < matched[j].specificity
+	})
+	options := map[string]any{}
+	for _, m := range matched {
+		utils.MapPutAll(options, m.rule.Options)
+	}
+	return options
+}
+
+// getDefaultOptions returns default options rules of configuration source if it supports them
+func getDefaultOptions(configurationSource ConfigurationSource) []*DefaultOptionsRule {
+	if dos, ok := configurationSource.(DefaultOptionsSource); ok {
+		return dos.GetDefaultOptions()
+	}
+	return nil
+}
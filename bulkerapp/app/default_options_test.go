@@ -0,0 +1,26 @@
+package app
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestDefaultOptionsFor(t *testing.T) {
+	rules := []*DefaultOptionsRule{
+		{Workspaces: []string{"ws1"}, Options: map[string]any{"batchSize": 500}},
+		{Types: []string{"postgres"}, Options: map[string]any{"batchSize": 100, "deduplicate": true}},
+		{Options: map[string]any{"batchSize": 10, "timestamp": "_ingested_at"}},
+		{Workspaces: []string{"ws1"}, Types: []string{"clickhouse"}, Options: map[string]any{"batchSize": 1000}},
+	}
+	dst := func(workspaceId, bulkerType string) *DestinationConfig {
+		cfg := &DestinationConfig{WorkspaceId: workspaceId}
+		cfg.BulkerType = bulkerType
+		return cfg
+	}
+	require.Equal(t, map[string]any{"batchSize": 10, "timestamp": "_ingested_at"}, defaultOptionsFor(rules, dst("ws2", "clickhouse")))
+	require.Equal(t, map[string]any{"batchSize": 100, "deduplicate": true, "timestamp": "_ingested_at"}, defaultOptionsFor(rules, dst("ws2", "postgres")))
+	//workspace rules win over type rules
+	require.Equal(t, map[string]any{"batchSize": 500, "deduplicate": true, "timestamp": "_ingested_at"}, defaultOptionsFor(rules, dst("ws1", "postgres")))
+	require.Equal(t, map[string]any{"batchSize": 1000, "timestamp": "_ingested_at"}, defaultOptionsFor(rules, dst("ws1", "clickhouse")))
+	require.Empty(t, defaultOptionsFor(nil, dst("ws1", "clickhouse")))
+}
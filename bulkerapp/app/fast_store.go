@@ -3,6 +3,7 @@ package app
 import (
 	"github.com/gomodule/redigo/redis"
 	"github.com/jitsucom/bulker/jitsubase/appbase"
+	"github.com/jitsucom/bulker/jitsubase/redispool"
 	"github.com/jitsucom/bulker/jitsubase/utils"
 	jsoniter "github.com/json-iterator/go"
 	"strings"
@@ -78,7 +79,10 @@ type StreamWithDestinations struct {
 func NewFastStore(config *Config) (*FastStore, error) {
 	base := appbase.NewServiceBase(fastStoreServiceName)
 	base.Debugf("Creating FastStore with redisURL: %s", config.RedisURL)
-	redisPool := newPool(config.RedisURL, config.RedisTLSCA)
+	redisPool, err := redispool.NewRedisPool(config.RedisURL, config.RedisTLS())
+	if err != nil {
+		return nil, err
+	}
 	fs := FastStore{
 		Service:             base,
 		redisPool:           redisPool,
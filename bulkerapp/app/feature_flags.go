@@ -0,0 +1,67 @@
+package app
+
+import (
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"hash/fnv"
+)
+
+// featureFlagsKey key of feature flags rules in configuration source
+const featureFlagsKey = "featureFlags"
+
+// FeatureFlagRule feature flag delivered with configuration source and rules of its rollout.
+// Flag is enabled for destination that is listed in destinations, belongs to one of workspaces
+// or falls into percent of destinations selected by hash of destination id
+type FeatureFlagRule struct {
+	bulker.FeatureFlag `mapstructure:",squash"`
+	Destinations       []string `mapstructure:"destinations" json:"destinations,omitempty"`
+	Workspaces         []string `mapstructure:"workspaces" json:"workspaces,omitempty"`
+	// Percent of destinations (0-100) that have flag enabled. The same destinations stay selected while percent grows
+	Percent int `mapstructure:"percent" json:"percent,omitempty"`
+}
+
+// FeatureFlagsSource optional interface for ConfigurationSource that delivers feature flags
+type FeatureFlagsSource interface {
+	GetFeatureFlags() []*FeatureFlagRule
+}
+
+// enabledFor returns true if flag is enabled for destination
+func (f *FeatureFlagRule) enabledFor(cfg *DestinationConfig) bool {
+	for _, id := range f.Destinations {
+		if id == cfg.Id() {
+			return true
+		}
+	}
+	if cfg.WorkspaceId != "" {
+		for _, id := range f.Workspaces {
+			if id == cfg.WorkspaceId {
+				return true
+			}
+		}
+	}
+	if f.Percent <= 0 {
+		return false
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(f.Name + ":" + cfg.Id()))
+	return int(h.Sum32()%100) < f.Percent
+}
+
+// featureFlagsFor returns feature flags enabled for destination
+func featureFlagsFor(rules []*FeatureFlagRule, cfg *DestinationConfig) []*bulker.FeatureFlag {
+	var flags []*bulker.FeatureFlag
+	for _, rule := range rules {
+		if rule.enabledFor(cfg) {
+			flag := rule.FeatureFlag
+			flags = append(flags, &flag)
+		}
+	}
+	return flags
+}
+
+// getFeatureFlags returns feature flags of configuration source if it supports them
+func getFeatureFlags(configurationSource ConfigurationSource) []*FeatureFlagRule {
+	if ffs, ok := configurationSource.(FeatureFlagsSource); ok {
+		return ffs.GetFeatureFlags()
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package app
+
+import (
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestFeatureFlagsFor(t *testing.T) {
+	rules := []*FeatureFlagRule{
+		{FeatureFlag: bulker.FeatureFlag{Name: "msgpack", Options: map[string]any{"internalBatchFileFormat": "msgpack"}}, Destinations: []string{"dst1"}},
+		{FeatureFlag: bulker.FeatureFlag{Name: "workspace_canary"}, Workspaces: []string{"ws1"}},
+		{FeatureFlag: bulker.FeatureFlag{Name: "everyone"}, Percent: 100},
+		{FeatureFlag: bulker.FeatureFlag{Name: "nobody"}, Percent: 0},
+	}
+	names := func(flags []*bulker.FeatureFlag) []string {
+		result := make([]string, len(flags))
+		for i, flag := range flags {
+			result[i] = flag.Name
+		}
+		return result
+	}
+	dst1 := &DestinationConfig{WorkspaceId: "ws2"}
+	dst1.Config.Id = "dst1"
+	require.Equal(t, []string{"msgpack", "everyone"}, names(featureFlagsFor(rules, dst1)))
+	dst2 := &DestinationConfig{WorkspaceId: "ws1"}
+	dst2.Config.Id = "dst2"
+	require.Equal(t, []string{"workspace_canary", "everyone"}, names(featureFlagsFor(rules, dst2)))
+}
+
+func TestFeatureFlagPercentIsStable(t *testing.T) {
+	rule := &FeatureFlagRule{FeatureFlag: bulker.FeatureFlag{Name: "canary"}, Percent: 30}
+	enabled := 0
+	for i := 0; i < 1000; i++ {
+		cfg := &DestinationConfig{}
+		cfg.Config.Id = "dst" + string(rune('a'+i%26)) + string(rune('a'+i/26))
+		if rule.enabledFor(cfg) {
+			enabled++
+			//destinations stay selected when percent grows
+			wider := &FeatureFlagRule{FeatureFlag: rule.FeatureFlag, Percent: 50}
+			require.True(t, wider.enabledFor(cfg))
+		}
+	}
+	require.InDelta(t, 300, enabled, 60)
+}
+
+func TestFeatureFlagsOption(t *testing.T) {
+	flags := []*bulker.FeatureFlag{{Name: "msgpack", Options: map[string]any{"deduplicate": true, "batchSize": 100}}}
+	options := bulker.StreamOptions{}
+	options.Add(bulker.WithOption(&bulker.BatchSizeOption, 10))
+	options.Add(bulker.WithFeatureFlags(flags...))
+	require.True(t, bulker.FeatureEnabled(&options, "msgpack"))
+	require.False(t, bulker.FeatureEnabled(&options, "other"))
+	require.True(t, bulker.DeduplicateOption.Get(&options))
+	//explicit options are not overridden by flags
+	require.Equal(t, 10, bulker.BatchSizeOption.Get(&options))
+}
@@ -0,0 +1,85 @@
+package app
+
+import (
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"sort"
+	"time"
+)
+
+// defaultFileManifestLimit maximum number of files returned by /files endpoint when limit is not provided
+const defaultFileManifestLimit = 1000
+
+// FileManifestEntry file object produced by batch of file storage destination
+type FileManifestEntry struct {
+	ConnectionId string `json:"connectionId"`
+	TableName    string `json:"tableName"`
+	Mode         string `json:"mode"`
+	bulker.FileInfo
+	// CreatedAt time when batch that produced the file was completed
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// FileManifestQuery filters files of connection. Zero values mean no filter
+type FileManifestQuery struct {
+	ConnectionId string
+	TableName    string
+	// From and To range of CreatedAt: From inclusive, To exclusive
+	From  time.Time
+	To    time.Time
+	Limit int
+}
+
+func (q *FileManifestQuery) matches(entry *FileManifestEntry) bool {
+	return entry.ConnectionId == q.ConnectionId &&
+		(q.TableName == "" || entry.TableName == q.TableName) &&
+		(q.From.IsZero() || !entry.CreatedAt.Before(q.From)) &&
+		(q.To.IsZero() || entry.CreatedAt.Before(q.To))
+}
+
+// filter returns entries matching query ordered by CreatedAt and limited to query limit
+func (q *FileManifestQuery) filter(entries []*FileManifestEntry) []*FileManifestEntry {
+	result := make([]*FileManifestEntry, 0, len(entries))
+	for _, entry := range entries {
+		if q.matches(entry) {
+			result = append(result, entry)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+	if q.Limit > 0 && len(result) > q.Limit {
+		result = result[:q.Limit]
+	}
+	return result
+}
+
+// FileManifestStore persists manifest of files produced by file storage destinations
+type FileManifestStore interface {
+	// SaveFiles appends entries to the manifest
+	SaveFiles(entries []*FileManifestEntry) error
+	// ListFiles returns entries matching query ordered by CreatedAt
+	ListFiles(query FileManifestQuery) ([]*FileManifestEntry, error)
+}
+
+// RecordFiles appends files produced by stream to the manifest. Files are persisted immediately
+func (sc *StateCheckpointer) RecordFiles(connectionId, tableName, mode string, files []bulker.FileInfo) {
+	if sc == nil || len(files) == 0 {
+		return
+	}
+	createdAt := time.Now().UTC()
+	entries := make([]*FileManifestEntry, len(files))
+	for i, file := range files {
+		entries[i] = &FileManifestEntry{ConnectionId: connectionId, TableName: tableName, Mode: mode, FileInfo: file, CreatedAt: createdAt}
+	}
+	if err := sc.store.SaveFiles(entries); err != nil {
+		sc.Errorf("Failed to save manifest of %d files of %s/%s: %v", len(files), connectionId, tableName, err)
+	}
+}
+
+// ListFiles returns files produced by connection matching query
+func (sc *StateCheckpointer) ListFiles(query FileManifestQuery) ([]*FileManifestEntry, error) {
+	if query.Limit <= 0 {
+		query.Limit = defaultFileManifestLimit
+	}
+	return sc.store.ListFiles(query)
+}
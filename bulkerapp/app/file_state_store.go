@@ -0,0 +1,143 @@
+package app
+
+import (
+	"bufio"
+	"github.com/jitsucom/bulker/jitsubase/appbase"
+	jsoniter "github.com/json-iterator/go"
+	"net/url"
+	"os"
+	"path"
+	"sync"
+)
+
+// fileManifestExtension files manifest of connection is stored in <connection id>.files.ndjson file
+const fileManifestExtension = ".files.ndjson"
+
+// FileStateStore stores checkpoints of each connection in json file of the directory.
+// Suitable for single instance deployments with persistent volume
+type FileStateStore struct {
+	sync.Mutex
+	appbase.Service
+	dir string
+}
+
+func NewFileStateStore(dir string) (*FileStateStore, error) {
+	base := appbase.NewServiceBase("file_state_store")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, base.NewError("cannot create state store directory %s: %v", dir, err)
+	}
+	return &FileStateStore{Service: base, dir: dir}, nil
+}
+
+func (fs *FileStateStore) filePath(connectionId string) string {
+	return path.Join(fs.dir, url.PathEscape(connectionId)+".json")
+}
+
+// read returns checkpoints of connection by stream key
+func (fs *FileStateStore) read(connectionId string) (map[string]*StreamCheckpoint, error) {
+	checkpoints := map[string]*StreamCheckpoint{}
+	payload, err := os.ReadFile(fs.filePath(connectionId))
+	if os.IsNotExist(err) {
+		return checkpoints, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err = jsoniter.Unmarshal(payload, &checkpoints); err != nil {
+		return nil, fs.NewError("failed to parse checkpoints of %s: %v", connectionId, err)
+	}
+	return checkpoints, nil
+}
+
+func (fs *FileStateStore) Save(checkpoint *StreamCheckpoint) error {
+	fs.Lock()
+	defer fs.Unlock()
+	checkpoints, err := fs.read(checkpoint.ConnectionId)
+	if err != nil {
+		return err
+	}
+	checkpoints[checkpoint.Key()] = checkpoint
+	payload, err := jsoniter.Marshal(checkpoints)
+	if err != nil {
+		return err
+	}
+	// write to temporary file and rename so file is never left partially written
+	filePath := fs.filePath(checkpoint.ConnectionId)
+	if err = os.WriteFile(filePath+".tmp", payload, 0644); err != nil {
+		return err
+	}
+	return os.Rename(filePath+".tmp", filePath)
+}
+
+func (fs *FileStateStore) Load(connectionId string) ([]*StreamCheckpoint, error) {
+	fs.Lock()
+	defer fs.Unlock()
+	checkpoints, err := fs.read(connectionId)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*StreamCheckpoint, 0, len(checkpoints))
+	for _, checkpoint := range checkpoints {
+		result = append(result, checkpoint)
+	}
+	return result, nil
+}
+
+func (fs *FileStateStore) SaveFiles(entries []*FileManifestEntry) error {
+	fs.Lock()
+	defer fs.Unlock()
+	files := map[string]*os.File{}
+	defer func() {
+		for _, file := range files {
+			_ = file.Close()
+		}
+	}()
+	for _, entry := range entries {
+		file, ok := files[entry.ConnectionId]
+		if !ok {
+			var err error
+			file, err = os.OpenFile(path.Join(fs.dir, url.PathEscape(entry.ConnectionId)+fileManifestExtension), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+			if err != nil {
+				return err
+			}
+			files[entry.ConnectionId] = file
+		}
+		payload, err := jsoniter.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		if _, err = file.Write(append(payload, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (fs *FileStateStore) ListFiles(query FileManifestQuery) ([]*FileManifestEntry, error) {
+	fs.Lock()
+	defer fs.Unlock()
+	file, err := os.Open(path.Join(fs.dir, url.PathEscape(query.ConnectionId)+fileManifestExtension))
+	if os.IsNotExist(err) {
+		return []*FileManifestEntry{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	entries := make([]*FileManifestEntry, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*100), 1024*1024*10)
+	for scanner.Scan() {
+		entry := &FileManifestEntry{}
+		if err = jsoniter.Unmarshal(scanner.Bytes(), entry); err != nil {
+			return nil, fs.NewError("failed to parse files manifest of %s: %v", query.ConnectionId, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return query.filter(entries), nil
+}
+
+func (fs *FileStateStore) Close() error {
+	return nil
+}
@@ -0,0 +1,112 @@
+package app
+
+import (
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestFileStateStore(t *testing.T) {
+	updatedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	checkpoint := func(connectionId, mode, tableName string, rows int) *StreamCheckpoint {
+		return &StreamCheckpoint{ConnectionId: connectionId, TableName: tableName, Mode: mode,
+			State: bulker.State{Status: bulker.Completed, SuccessfulRows: rows}, UpdatedAt: updatedAt}
+	}
+	tests := []struct {
+		name         string
+		saves        []*StreamCheckpoint
+		connectionId string
+		want         []*StreamCheckpoint
+	}{
+		{"no_checkpoints", nil, "conn1", []*StreamCheckpoint{}},
+		{"single_checkpoint", []*StreamCheckpoint{checkpoint("conn1", "batch", "events", 10)}, "conn1",
+			[]*StreamCheckpoint{checkpoint("conn1", "batch", "events", 10)}},
+		{"replaces_checkpoint_of_the_same_stream",
+			[]*StreamCheckpoint{checkpoint("conn1", "batch", "events", 10), checkpoint("conn1", "batch", "events", 20)}, "conn1",
+			[]*StreamCheckpoint{checkpoint("conn1", "batch", "events", 20)}},
+		{"streams_of_connection",
+			[]*StreamCheckpoint{checkpoint("conn1", "batch", "events", 10), checkpoint("conn1", "stream", "events", 5), checkpoint("conn1", "batch", "users", 3)}, "conn1",
+			[]*StreamCheckpoint{checkpoint("conn1", "batch", "events", 10), checkpoint("conn1", "batch", "users", 3), checkpoint("conn1", "stream", "events", 5)}},
+		{"other_connection_is_not_loaded",
+			[]*StreamCheckpoint{checkpoint("conn1", "batch", "events", 10), checkpoint("conn2", "batch", "events", 20)}, "conn2",
+			[]*StreamCheckpoint{checkpoint("conn2", "batch", "events", 20)}},
+		{"connection_id_with_path_separators",
+			[]*StreamCheckpoint{checkpoint("../ws/conn 1", "batch", "events", 10)}, "../ws/conn 1",
+			[]*StreamCheckpoint{checkpoint("../ws/conn 1", "batch", "events", 10)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := path.Join(t.TempDir(), "state")
+			store, err := NewFileStateStore(dir)
+			require.NoError(t, err)
+			for _, c := range tt.saves {
+				require.NoError(t, store.Save(c))
+			}
+			// checkpoints survive restart
+			require.NoError(t, store.Close())
+			store, err = NewFileStateStore(dir)
+			require.NoError(t, err)
+			loaded, err := store.Load(tt.connectionId)
+			require.NoError(t, err)
+			sort.Slice(loaded, func(i, j int) bool {
+				return loaded[i].Key() < loaded[j].Key()
+			})
+			require.Equal(t, tt.want, loaded)
+			entries, err := os.ReadDir(dir)
+			require.NoError(t, err)
+			for _, entry := range entries {
+				require.Equal(t, ".json", path.Ext(entry.Name()), "only checkpoint files are left in the directory")
+			}
+		})
+	}
+}
+
+func TestFileStateStoreCorruptedFile(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileStateStore(dir)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path.Join(dir, "conn1.json"), []byte("{not json"), 0644))
+	_, err = store.Load("conn1")
+	require.Error(t, err)
+	require.Error(t, store.Save(&StreamCheckpoint{ConnectionId: "conn1", TableName: "events", Mode: "batch"}))
+}
+
+func TestFileStateStoreFilesManifest(t *testing.T) {
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	entry := func(connectionId, tableName, path string, hour int) *FileManifestEntry {
+		return &FileManifestEntry{ConnectionId: connectionId, TableName: tableName, Mode: "batch",
+			FileInfo: bulker.FileInfo{Path: path, Rows: 10, Bytes: 100, FirstEventTime: createdAt, LastEventTime: createdAt}, CreatedAt: createdAt.Add(time.Duration(hour) * time.Hour)}
+	}
+	dir := t.TempDir()
+	store, err := NewFileStateStore(dir)
+	require.NoError(t, err)
+	require.NoError(t, store.SaveFiles([]*FileManifestEntry{entry("conn1", "events", "events_2", 2), entry("conn1", "users", "users_1", 1)}))
+	require.NoError(t, store.SaveFiles([]*FileManifestEntry{entry("conn1", "events", "events_0", 0), entry("conn2", "events", "other", 0)}))
+
+	tests := []struct {
+		name  string
+		query FileManifestQuery
+		want  []*FileManifestEntry
+	}{
+		{"all_files_of_connection", FileManifestQuery{ConnectionId: "conn1"},
+			[]*FileManifestEntry{entry("conn1", "events", "events_0", 0), entry("conn1", "users", "users_1", 1), entry("conn1", "events", "events_2", 2)}},
+		{"table", FileManifestQuery{ConnectionId: "conn1", TableName: "events"},
+			[]*FileManifestEntry{entry("conn1", "events", "events_0", 0), entry("conn1", "events", "events_2", 2)}},
+		{"time_range", FileManifestQuery{ConnectionId: "conn1", From: createdAt.Add(time.Hour), To: createdAt.Add(2 * time.Hour)},
+			[]*FileManifestEntry{entry("conn1", "users", "users_1", 1)}},
+		{"limit", FileManifestQuery{ConnectionId: "conn1", Limit: 1},
+			[]*FileManifestEntry{entry("conn1", "events", "events_0", 0)}},
+		{"unknown_connection", FileManifestQuery{ConnectionId: "conn3"}, []*FileManifestEntry{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := store.ListFiles(tt.query)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, files)
+		})
+	}
+}
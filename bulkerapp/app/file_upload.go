@@ -0,0 +1,390 @@
+package app
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/jitsucom/bulker/bulkerapp/metrics"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/appbase"
+	"github.com/jitsucom/bulker/jitsubase/uuid"
+	"io"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	uploadFormatCSV  = "csv"
+	uploadFormatXLSX = "xlsx"
+)
+
+// rowsReader reads rows of uploaded file. Returns io.EOF after the last row
+type rowsReader interface {
+	Read() ([]any, error)
+}
+
+// UploadHandler loads rows of CSV or XLSX file uploaded as multipart form to destination table as a bulk stream.
+// Form fields: 'file' - uploaded file, 'format' - csv or xlsx (detected by file extension if not provided),
+// 'mapping' - optional JSON object mapping file column headers to event fields. With mapping only mapped columns are loaded.
+// Query parameters are the same as of BulkHandler
+func (r *Router) UploadHandler(c *gin.Context) {
+	start := time.Now()
+	destinationId := c.Param("destinationId")
+	tableName := c.Query("tableName")
+	taskId := c.DefaultQuery("taskId", uuid.New())
+	jobId := c.DefaultQuery("jobId", fmt.Sprintf("%s_%s_%s", destinationId, tableName, taskId))
+	bulkMode := bulker.BulkMode(c.DefaultQuery("mode", string(bulker.ReplaceTable)))
+	mode := ""
+	var rError *appbase.RouterError
+	var processedObjectSample types.Object
+	var state bulker.State
+	defer func() {
+		state.ProcessingTimeSec = time.Since(start).Seconds()
+		if rError != nil {
+			r.postEventsLog(destinationId, tableName, state, processedObjectSample, rError.PublicError)
+			metrics.BulkHandlerRequests(destinationId, mode, tableName, "error", rError.ErrorType).Inc()
+		} else {
+			r.postEventsLog(destinationId, tableName, state, processedObjectSample, nil)
+			metrics.BulkHandlerRequests(destinationId, mode, tableName, "success", "").Inc()
+		}
+	}()
+
+	destination := r.repository.GetDestination(destinationId)
+	if destination == nil {
+		rError = r.ResponseError(c, http.StatusNotFound, "destination not found", false, fmt.Errorf("destination not found: %s", destinationId), true)
+		return
+	}
+	mode = string(destination.Mode())
+	if tableName == "" {
+		rError = r.ResponseError(c, http.StatusBadRequest, "missing required parameter", false, fmt.Errorf("tableName query parameter is required"), true)
+		return
+	}
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		rError = r.ResponseError(c, http.StatusBadRequest, "missing file", false, fmt.Errorf("multipart form with 'file' field is required: %v", err), true)
+		return
+	}
+	var mapping map[string]string
+	if mappingField := c.PostForm("mapping"); mappingField != "" {
+		if err = json.Unmarshal([]byte(mappingField), &mapping); err != nil {
+			rError = r.ResponseError(c, http.StatusBadRequest, "mapping unmarshal error", false, err, true)
+			return
+		}
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		rError = r.ResponseError(c, http.StatusBadRequest, "file open error", false, err, true)
+		return
+	}
+	defer file.Close()
+	format := strings.ToLower(c.DefaultPostForm("format", strings.TrimPrefix(filepath.Ext(fileHeader.Filename), ".")))
+	var reader rowsReader
+	switch format {
+	case uploadFormatCSV:
+		reader = newCSVRowsReader(file)
+	case uploadFormatXLSX:
+		reader, err = newXLSXRowsReader(file, fileHeader.Size)
+	default:
+		err = fmt.Errorf("unsupported file format: '%s'. Supported formats: %s, %s", format, uploadFormatCSV, uploadFormatXLSX)
+	}
+	if err != nil {
+		rError = r.ResponseError(c, http.StatusBadRequest, "file format error", false, err, true)
+		return
+	}
+	header, err := reader.Read()
+	if err != nil {
+		rError = r.ResponseError(c, http.StatusBadRequest, "file header error", false, fmt.Errorf("failed to read header row: %v", err), true)
+		return
+	}
+	fields := uploadFields(header, mapping)
+
+	request, err := r.parseBulkRequest(c, jobId)
+	if err != nil {
+		rError = r.ResponseError(c, http.StatusBadRequest, "schema unmarshal error", false, err, true)
+		return
+	}
+	destination.InitBulkerInstance()
+	bulkerStream, err := destination.bulker.CreateStream(jobId, tableName, bulkMode, request.streamOptions...)
+	if err != nil {
+		rError = r.ResponseError(c, http.StatusInternalServerError, "create stream error", true, err, true)
+		return
+	}
+	consumed := 0
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			state, _ = bulkerStream.Abort(c)
+			rError = r.ResponseError(c, http.StatusBadRequest, "file read error", false, fmt.Errorf("failed to read row %d: %v", consumed+2, err), true)
+			return
+		}
+		obj := uploadObject(fields, row)
+		if len(obj) == 0 {
+			continue
+		}
+		if _, processedObjectSample, err = bulkerStream.Consume(c, obj); bulker.IsRejectedObjectError(err) {
+			r.Warnf("Upload stream for %s: row was rejected: %v", jobId, err)
+			continue
+		} else if err != nil {
+			state, _ = bulkerStream.Abort(c)
+			rError = r.ResponseError(c, http.StatusBadRequest, "stream consume error", false, err, true)
+			return
+		}
+		consumed++
+	}
+	if consumed == 0 {
+		state, _ = bulkerStream.Abort(c)
+		c.JSON(http.StatusOK, gin.H{"message": "ok"})
+		return
+	}
+	state, err = bulkerStream.Complete(c)
+	if err != nil {
+		rError = r.ResponseError(c, http.StatusBadRequest, "stream complete error", false, err, true)
+		return
+	}
+	r.Infof("Upload stream for %s mode: %s file: %s Completed. Processed: %d in %dms.", jobId, mode, fileHeader.Filename, state.SuccessfulRows, time.Since(start).Milliseconds())
+	c.JSON(http.StatusOK, gin.H{"message": "ok", "state": state})
+}
+
+// uploadFields returns event field for each column of file. Empty field - column is skipped
+func uploadFields(header []any, mapping map[string]string) []string {
+	fields := make([]string, len(header))
+	for i, h := range header {
+		if h == nil {
+			continue
+		}
+		//CSV files exported by Excel start with byte order mark
+		name := strings.TrimSpace(strings.TrimPrefix(fmt.Sprint(h), "\ufeff"))
+		if mapping == nil {
+			fields[i] = name
+		} else {
+			fields[i] = mapping[name]
+		}
+	}
+	return fields
+}
+
+// uploadObject makes event of row. Empty cells are omitted
+func uploadObject(fields []string, row []any) types.Object {
+	obj := types.Object{}
+	for i, value := range row {
+		if i >= len(fields) || fields[i] == "" || value == nil || value == "" {
+			continue
+		}
+		obj[fields[i]] = value
+	}
+	return obj
+}
+
+type csvRowsReader struct {
+	reader *csv.Reader
+}
+
+func newCSVRowsReader(r io.Reader) *csvRowsReader {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	return &csvRowsReader{reader: reader}
+}
+
+func (cr *csvRowsReader) Read() ([]any, error) {
+	record, err := cr.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	row := make([]any, len(record))
+	for i, value := range record {
+		row[i] = value
+	}
+	return row, nil
+}
+
+// xlsxRowsReader reads rows of the first sheet of XLSX workbook. Numeric cells are returned as json.Number,
+// boolean cells as bool, other cells as strings. Dates are stored in XLSX as numbers and are returned as such
+type xlsxRowsReader struct {
+	sharedStrings []string
+	decoder       *xml.Decoder
+	closer        io.Closer
+}
+
+type xlsxRow struct {
+	Cells []xlsxCell `xml:"c"`
+}
+
+type xlsxCell struct {
+	Ref    string     `xml:"r,attr"`
+	Type   string     `xml:"t,attr"`
+	Value  string     `xml:"v"`
+	Inline xlsxString `xml:"is"`
+}
+
+// xlsxString rich or plain text of shared strings table or inline string cell
+type xlsxString struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (s xlsxString) String() string {
+	if len(s.Runs) == 0 {
+		return s.Text
+	}
+	var sb strings.Builder
+	for _, run := range s.Runs {
+		sb.WriteString(run.Text)
+	}
+	return sb.String()
+}
+
+func newXLSXRowsReader(r io.ReaderAt, size int64) (*xlsxRowsReader, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open xlsx file: %v", err)
+	}
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, f := range archive.File {
+		files[f.Name] = f
+	}
+	xr := &xlsxRowsReader{}
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		sst := struct {
+			Items []xlsxString `xml:"si"`
+		}{}
+		if err = decodeZipXML(f, &sst); err != nil {
+			return nil, err
+		}
+		xr.sharedStrings = make([]string, len(sst.Items))
+		for i, item := range sst.Items {
+			xr.sharedStrings[i] = item.String()
+		}
+	}
+	sheet, ok := files[xlsxFirstSheetPath(files)]
+	if !ok {
+		return nil, fmt.Errorf("xlsx file has no sheets")
+	}
+	rc, err := sheet.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open xlsx sheet: %v", err)
+	}
+	xr.decoder = xml.NewDecoder(rc)
+	xr.closer = rc
+	return xr, nil
+}
+
+// xlsxFirstSheetPath resolves path of the first sheet of workbook
+func xlsxFirstSheetPath(files map[string]*zip.File) string {
+	const defaultPath = "xl/worksheets/sheet1.xml"
+	workbook := struct {
+		Sheets []struct {
+			Id string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}{}
+	rels := struct {
+		Relationships []struct {
+			Id     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}{}
+	wf, ok1 := files["xl/workbook.xml"]
+	rf, ok2 := files["xl/_rels/workbook.xml.rels"]
+	if !ok1 || !ok2 || decodeZipXML(wf, &workbook) != nil || decodeZipXML(rf, &rels) != nil || len(workbook.Sheets) == 0 {
+		return defaultPath
+	}
+	for _, rel := range rels.Relationships {
+		if rel.Id == workbook.Sheets[0].Id {
+			if strings.HasPrefix(rel.Target, "/") {
+				return strings.TrimPrefix(rel.Target, "/")
+			}
+			return path.Join("xl", rel.Target)
+		}
+	}
+	return defaultPath
+}
+
+func decodeZipXML(f *zip.File, v any) error {
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", f.Name, err)
+	}
+	defer rc.Close()
+	if err = xml.NewDecoder(rc).Decode(v); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", f.Name, err)
+	}
+	return nil
+}
+
+func (xr *xlsxRowsReader) Read() ([]any, error) {
+	for {
+		token, err := xr.decoder.Token()
+		if err == io.EOF {
+			_ = xr.closer.Close()
+			return nil, io.EOF
+		} else if err != nil {
+			return nil, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+		row := xlsxRow{}
+		if err = xr.decoder.DecodeElement(&row, &start); err != nil {
+			return nil, err
+		}
+		return xr.values(row)
+	}
+}
+
+// values returns values of row cells placed by their column references, so skipped empty cells don't shift values
+func (xr *xlsxRowsReader) values(row xlsxRow) ([]any, error) {
+	var values []any
+	for i, cell := range row.Cells {
+		column := xlsxColumnIndex(cell.Ref)
+		if column < 0 {
+			column = i
+		}
+		for len(values) <= column {
+			values = append(values, nil)
+		}
+		switch cell.Type {
+		case "s":
+			index, err := strconv.Atoi(cell.Value)
+			if err != nil || index < 0 || index >= len(xr.sharedStrings) {
+				return nil, fmt.Errorf("invalid shared string index in cell %s: %s", cell.Ref, cell.Value)
+			}
+			values[column] = xr.sharedStrings[index]
+		case "inlineStr":
+			values[column] = cell.Inline.String()
+		case "b":
+			values[column] = cell.Value == "1"
+		case "str", "e":
+			values[column] = cell.Value
+		default:
+			if cell.Value != "" {
+				values[column] = json.Number(cell.Value)
+			}
+		}
+	}
+	return values, nil
+}
+
+// xlsxColumnIndex returns zero based column index of cell reference, e.g. 0 for A1, 27 for AB3. -1 if reference is missing
+func xlsxColumnIndex(ref string) int {
+	index := 0
+	for _, ch := range ref {
+		if ch < 'A' || ch > 'Z' {
+			break
+		}
+		index = index*26 + int(ch-'A'+1)
+	}
+	return index - 1
+}
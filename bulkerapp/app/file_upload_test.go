@@ -0,0 +1,66 @@
+package app
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/stretchr/testify/require"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCSVUpload(t *testing.T) {
+	reader := newCSVRowsReader(strings.NewReader("\ufeffEmail,Full Name,Ignored\njohn@example.com,John Doe,x\n,Jane,y\n"))
+	header, err := reader.Read()
+	require.NoError(t, err)
+	fields := uploadFields(header, map[string]string{"Email": "email", "Full Name": "name"})
+	var objects []types.Object
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		objects = append(objects, uploadObject(fields, row))
+	}
+	require.Equal(t, []types.Object{{"email": "john@example.com", "name": "John Doe"}, {"name": "Jane"}}, objects)
+}
+
+func TestXLSXUpload(t *testing.T) {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for name, content := range map[string]string{
+		"xl/workbook.xml":            `<workbook xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Data" sheetId="1" r:id="rId2"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships><Relationship Id="rId1" Target="worksheets/sheet1.xml"/><Relationship Id="rId2" Target="worksheets/data.xml"/></Relationships>`,
+		"xl/sharedStrings.xml":       `<sst><si><t>id</t></si><si><t>name</t></si><si><r><t>John </t></r><r><t>Doe</t></r></si></sst>`,
+		"xl/worksheets/data.xml": `<worksheet><sheetData>
+<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="C1" t="inlineStr"><is><t>active</t></is></c></row>
+<row r="2"><c r="A2"><v>1.5</v></c><c r="B2" t="s"><v>2</v></c><c r="C2" t="b"><v>1</v></c></row>
+<row r="3"><c r="A3"><v>2</v></c><c r="C3" t="b"><v>0</v></c></row>
+</sheetData></worksheet>`,
+	} {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+
+	reader, err := newXLSXRowsReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	header, err := reader.Read()
+	require.NoError(t, err)
+	fields := uploadFields(header, nil)
+	require.Equal(t, []string{"id", "name", "active"}, fields)
+	row, err := reader.Read()
+	require.NoError(t, err)
+	require.Equal(t, types.Object{"id": json.Number("1.5"), "name": "John Doe", "active": true}, uploadObject(fields, row))
+	//skipped cell doesn't shift values
+	row, err = reader.Read()
+	require.NoError(t, err)
+	require.Equal(t, types.Object{"id": json.Number("2"), "active": false}, uploadObject(fields, row))
+	_, err = reader.Read()
+	require.Equal(t, io.EOF, err)
+}
@@ -0,0 +1,54 @@
+package app
+
+import (
+	"github.com/jitsucom/bulker/bulkerapp/metrics"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"sync/atomic"
+	"time"
+)
+
+// inFlightWaitTimeout how long batch consumer waits for in-flight events of destination to drop below the bound before giving up the run
+const inFlightWaitTimeout = time.Minute
+
+// inFlightCheckPeriod how often in-flight events are rechecked while consumer waits
+const inFlightCheckPeriod = time.Second
+
+// InFlightEvents counter of events consumed by batch consumers of destination and not yet committed to destination.
+// Counter is shared by all versions of destination
+func (r *Repository) InFlightEvents(destinationId string) *atomic.Int64 {
+	counter, _ := r.inFlight.LoadOrStore(destinationId, &atomic.Int64{})
+	return counter.(*atomic.Int64)
+}
+
+// maxInFlightEvents returns bound of in-flight events of destination. 0 - unbounded
+func maxInFlightEvents(config *Config, streamOptions *bulker.StreamOptions) int64 {
+	return int64(utils.Nvl(bulker.MaxInFlightEventsOption.Get(streamOptions), config.BatchRunnerMaxInFlightEvents))
+}
+
+// addInFlight adds delta to in-flight events of destination
+func (bc *AbstractBatchConsumer) addInFlight(inFlight *atomic.Int64, delta int64) {
+	metrics.ConsumerInFlightEvents(bc.destinationId).Set(float64(inFlight.Add(delta)))
+}
+
+// waitForInFlightCapacity pauses consumer while in-flight events of destination exceed the bound so temp files of slow destinations don't grow unbounded.
+// Returns false if capacity wasn't freed within inFlightWaitTimeout or consumer was retired
+func (bc *AbstractBatchConsumer) waitForInFlightCapacity(inFlight *atomic.Int64, maxInFlight int64) bool {
+	if maxInFlight <= 0 || inFlight.Load() < maxInFlight {
+		return true
+	}
+	bc.Infof("In-flight events of destination reached the bound: %d. Pausing consumer", maxInFlight)
+	bc.pause()
+	ticker := time.NewTicker(inFlightCheckPeriod)
+	defer ticker.Stop()
+	deadline := time.Now().Add(inFlightWaitTimeout)
+	for inFlight.Load() >= maxInFlight {
+		if bc.retired.Load() || time.Now().After(deadline) {
+			bc.Warnf("In-flight events of destination are still above the bound: %d. Skipping run", maxInFlight)
+			return false
+		}
+		<-ticker.C
+	}
+	bc.resume()
+	return true
+}
@@ -0,0 +1,73 @@
+package app
+
+import (
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/jitsucom/bulker/jitsubase/appbase"
+	"github.com/jitsucom/bulker/kafkabase"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// newInFlightTestConsumer creates batch consumer of destination d1 with kafka consumer assigned to partition of mock cluster topic
+func newInFlightTestConsumer(t *testing.T) *AbstractBatchConsumer {
+	cluster, err := kafka.NewMockCluster(1)
+	require.NoError(t, err)
+	t.Cleanup(cluster.Close)
+	topic := lagMonitorTestTopic
+	require.NoError(t, cluster.CreateTopic(topic, 1, 1))
+	consumer, err := kafka.NewConsumer(&kafka.ConfigMap{"bootstrap.servers": cluster.BootstrapServers(), "group.id": topic})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = consumer.Close() })
+	require.NoError(t, consumer.Assign([]kafka.TopicPartition{{Topic: &topic, Partition: 0, Offset: kafka.OffsetBeginning}}))
+	config := &Config{KafkaConfig: kafkabase.KafkaConfig{KafkaMaxPollIntervalMs: 1000}}
+	bc := &AbstractBatchConsumer{
+		AbstractConsumer: &AbstractConsumer{Service: appbase.NewServiceBase(topic), config: config, topicId: topic},
+		repository:       &Repository{},
+		destinationId:    "d1",
+		mode:             "batch",
+		waitForMessages:  100 * time.Millisecond,
+		closed:           make(chan struct{}),
+		resumeChannel:    make(chan struct{}),
+	}
+	bc.consumer.Store(consumer)
+	return bc
+}
+
+func TestMaxInFlightEvents(t *testing.T) {
+	config := &Config{BatchRunnerMaxInFlightEvents: 1000}
+	require.Equal(t, int64(1000), maxInFlightEvents(config, consumerGroupTestDestination(t, nil).streamOptions))
+	require.Equal(t, int64(50), maxInFlightEvents(config, consumerGroupTestDestination(t, map[string]any{"maxInFlightEvents": 50}).streamOptions))
+	require.Equal(t, int64(0), maxInFlightEvents(&Config{}, consumerGroupTestDestination(t, nil).streamOptions))
+}
+
+func TestWaitForInFlightCapacity(t *testing.T) {
+	reqr := require.New(t)
+	bc := newInFlightTestConsumer(t)
+	inFlight := bc.repository.InFlightEvents(bc.destinationId)
+	reqr.Same(inFlight, bc.repository.InFlightEvents(bc.destinationId))
+
+	//below the bound or unbounded: consumer isn't paused
+	bc.addInFlight(inFlight, 10)
+	reqr.Equal(int64(10), inFlight.Load())
+	reqr.True(bc.waitForInFlightCapacity(inFlight, 0))
+	reqr.True(bc.waitForInFlightCapacity(inFlight, 11))
+	reqr.False(bc.paused.Load())
+
+	//consumer is paused until batches of other consumers are committed
+	go func() {
+		time.Sleep(500 * time.Millisecond)
+		bc.addInFlight(inFlight, -5)
+	}()
+	started := time.Now()
+	reqr.True(bc.waitForInFlightCapacity(inFlight, 10))
+	reqr.GreaterOrEqual(time.Since(started), 500*time.Millisecond)
+	reqr.Eventually(func() bool { return !bc.paused.Load() }, 5*time.Second, 10*time.Millisecond)
+
+	//retired consumer gives up the run
+	bc.addInFlight(inFlight, 5)
+	bc.retired.Store(true)
+	t.Cleanup(bc.resume)
+	reqr.False(bc.waitForInFlightCapacity(inFlight, 10))
+	reqr.True(bc.paused.Load())
+}
@@ -0,0 +1,239 @@
+package app
+
+import (
+	"context"
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/jitsucom/bulker/bulkerapp/metrics"
+	"github.com/jitsucom/bulker/jitsubase/appbase"
+	"github.com/jitsucom/bulker/jitsubase/safego"
+	"sync/atomic"
+	"time"
+)
+
+const lagMonitorRequestTimeout = 10 * time.Second
+
+// DestinationLag backlog of destination topics and rate of its processing
+type DestinationLag struct {
+	// Lag messages not yet processed by consumers
+	Lag int64 `json:"lag"`
+	// Rate messages processed per second since previous measurement
+	Rate float64 `json:"rate"`
+}
+
+// AutoscalingSignals consumer lag and processing rate of all destinations. Format is suitable for KEDA metrics-api scaler
+type AutoscalingSignals struct {
+	Lag          int64                     `json:"lag"`
+	Rate         float64                   `json:"rate"`
+	Destinations map[string]DestinationLag `json:"destinations"`
+	// Topics lag by topic including retry topics which lag isn't counted in lag of destinations
+	Topics    map[string]int64 `json:"-"`
+	UpdatedAt time.Time        `json:"updatedAt"`
+}
+
+// LagMonitor periodically measures lag of consumer groups of batch, stream and retry destination topics. Lag of retry topics isn't counted in lag of destinations.
+// All instances measure lag of all topics regardless of sharding so any instance may serve autoscaling signals
+type LagMonitor struct {
+	appbase.Service
+	config     *Config
+	repository *Repository
+	admin      *kafka.AdminClient
+	signals    atomic.Pointer[AutoscalingSignals]
+
+	// committed offsets of topics at previous measurement
+	committed  map[string]int64
+	measuredAt time.Time
+	closed     chan struct{}
+}
+
+func NewLagMonitor(appContext *Context) (*LagMonitor, error) {
+	base := appbase.NewServiceBase("lag-monitor")
+	admin, err := kafka.NewAdminClient(appContext.kafkaConfig)
+	if err != nil {
+		return nil, base.NewError("Error creating kafka admin client: %v", err)
+	}
+	return &LagMonitor{
+		Service:    base,
+		config:     appContext.config,
+		repository: appContext.repository,
+		admin:      admin,
+		committed:  map[string]int64{},
+		closed:     make(chan struct{}),
+	}, nil
+}
+
+// Start starts periodic measurements
+func (lm *LagMonitor) Start() {
+	safego.RunWithRestart(func() {
+		ticker := time.NewTicker(time.Duration(lm.config.AutoscalingPeriodSec) * time.Second)
+		defer ticker.Stop()
+		for {
+			lm.measure()
+			select {
+			case <-lm.closed:
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+}
+
+// Signals returns the latest measurement. nil if nothing was measured yet
+func (lm *LagMonitor) Signals() *AutoscalingSignals {
+	if lm == nil {
+		return nil
+	}
+	return lm.signals.Load()
+}
+
+func (lm *LagMonitor) measure() {
+	metadata, err := lm.admin.GetMetadata(nil, true, lm.config.KafkaAdminMetadataTimeoutMs)
+	if err != nil {
+		metrics.TopicManagerError("lag_monitor_metadata_error").Inc()
+		lm.Errorf("Error getting metadata: %v", err)
+		return
+	}
+	topicPartitions := map[string][]kafka.TopicPartition{}
+	groupSettings := map[string]ConsumerGroupSettings{}
+	earliestSpecs := map[kafka.TopicPartition]kafka.OffsetSpec{}
+	latestSpecs := map[kafka.TopicPartition]kafka.OffsetSpec{}
+	for topic, topicMetadata := range metadata.Topics {
+		destinationId, mode, _, err := ParseTopicId(topic)
+		if err != nil || (mode != "batch" && mode != "stream" && mode != retryTopicMode) {
+			continue
+		}
+		destination := lm.repository.GetDestination(destinationId)
+		if destination == nil {
+			continue
+		}
+		groupSettings[topic] = NewConsumerGroupSettings(lm.config, destination.streamOptions, topic, mode == retryTopicMode)
+		t := topic
+		for _, partition := range topicMetadata.Partitions {
+			tp := kafka.TopicPartition{Topic: &t, Partition: partition.ID}
+			topicPartitions[topic] = append(topicPartitions[topic], tp)
+			earliestSpecs[tp] = kafka.EarliestOffsetSpec
+			latestSpecs[tp] = kafka.LatestOffsetSpec
+		}
+	}
+	earliest, err := lm.listOffsets(earliestSpecs)
+	if err != nil {
+		metrics.TopicManagerError("lag_monitor_offsets_error").Inc()
+		lm.Errorf("Error getting topic offsets: %v", err)
+		return
+	}
+	latest, err := lm.listOffsets(latestSpecs)
+	if err != nil {
+		metrics.TopicManagerError("lag_monitor_offsets_error").Inc()
+		lm.Errorf("Error getting topic offsets: %v", err)
+		return
+	}
+	now := time.Now()
+	elapsed := now.Sub(lm.measuredAt).Seconds()
+	signals := &AutoscalingSignals{Destinations: map[string]DestinationLag{}, Topics: map[string]int64{}, UpdatedAt: now.UTC()}
+	committedSums := map[string]int64{}
+	for topic, partitions := range topicPartitions {
+		settings := groupSettings[topic]
+		committed, err := lm.committedOffsets(settings.GroupId, partitions)
+		if err != nil {
+			metrics.TopicManagerError("lag_monitor_committed_error").Inc()
+			lm.Errorf("Error getting committed offsets of topic %s: %v", topic, err)
+			continue
+		}
+		var lag, committedSum int64
+		for _, tp := range partitions {
+			low, high := earliest[tp.Partition][topic], latest[tp.Partition][topic]
+			offset, ok := committed[tp.Partition]
+			if !ok {
+				// consumer group without committed offset starts according to auto.offset.reset
+				offset = low
+				if settings.OffsetReset == "latest" {
+					offset = high
+				}
+			}
+			lag += max(high-max(offset, low), 0)
+			committedSum += offset
+		}
+		signals.Topics[topic] = lag
+		destinationId, mode, _, _ := ParseTopicId(topic)
+		if mode == retryTopicMode {
+			// retried messages are reprocessed by batch consumers so retry queue isn't part of destination backlog
+			continue
+		}
+		committedSums[topic] = committedSum
+		destinationLag := signals.Destinations[destinationId]
+		destinationLag.Lag += lag
+		if previous, ok := lm.committed[topic]; ok && elapsed > 0 {
+			// committed offset may go backwards when consumer group was changed
+			destinationLag.Rate += float64(max(committedSum-previous, 0)) / elapsed
+		}
+		signals.Destinations[destinationId] = destinationLag
+	}
+	if previous := lm.signals.Load(); previous != nil {
+		for destinationId := range previous.Destinations {
+			if _, ok := signals.Destinations[destinationId]; !ok {
+				metrics.DeleteAutoscaling(destinationId)
+			}
+		}
+	}
+	for destinationId, destinationLag := range signals.Destinations {
+		signals.Lag += destinationLag.Lag
+		signals.Rate += destinationLag.Rate
+		metrics.AutoscalingLag(destinationId).Set(float64(destinationLag.Lag))
+		metrics.AutoscalingRate(destinationId).Set(destinationLag.Rate)
+	}
+	lm.committed = committedSums
+	lm.measuredAt = now
+	lm.signals.Store(signals)
+	lm.Debugf("Measured lag of %d topics in %v. Total lag: %d rate: %.2f", len(topicPartitions), time.Since(now), signals.Lag, signals.Rate)
+}
+
+// listOffsets returns offsets by partition and topic
+func (lm *LagMonitor) listOffsets(specs map[kafka.TopicPartition]kafka.OffsetSpec) (map[int32]map[string]int64, error) {
+	result := map[int32]map[string]int64{}
+	if len(specs) == 0 {
+		return result, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), lagMonitorRequestTimeout)
+	defer cancel()
+	res, err := lm.admin.ListOffsets(ctx, specs)
+	if err != nil {
+		return nil, err
+	}
+	for tp, info := range res.ResultInfos {
+		if info.Error.Code() != kafka.ErrNoError || info.Offset < 0 {
+			continue
+		}
+		if result[tp.Partition] == nil {
+			result[tp.Partition] = map[string]int64{}
+		}
+		result[tp.Partition][*tp.Topic] = int64(info.Offset)
+	}
+	return result, nil
+}
+
+// committedOffsets returns committed offsets of consumer group by partition. Partitions without committed offset are omitted
+func (lm *LagMonitor) committedOffsets(groupId string, partitions []kafka.TopicPartition) (map[int32]int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), lagMonitorRequestTimeout)
+	defer cancel()
+	res, err := lm.admin.ListConsumerGroupOffsets(ctx, []kafka.ConsumerGroupTopicPartitions{{Group: groupId, Partitions: partitions}})
+	if err != nil {
+		return nil, err
+	}
+	committed := map[int32]int64{}
+	for _, group := range res.ConsumerGroupsTopicPartitions {
+		for _, tp := range group.Partitions {
+			if tp.Error == nil && tp.Offset >= 0 {
+				committed[tp.Partition] = int64(tp.Offset)
+			}
+		}
+	}
+	return committed, nil
+}
+
+func (lm *LagMonitor) Close() error {
+	if lm == nil {
+		return nil
+	}
+	close(lm.closed)
+	lm.admin.Close()
+	return nil
+}
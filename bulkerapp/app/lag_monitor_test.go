@@ -0,0 +1,108 @@
+package app
+
+import (
+	"encoding/json"
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/jitsucom/bulker/jitsubase/appbase"
+	"github.com/jitsucom/bulker/kafkabase"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const lagMonitorTestTopic = "in.id.d1.m.batch.t.events"
+
+// newLagMonitorTestCluster creates mock Kafka cluster with messagesCount messages in destination topic
+func newLagMonitorTestCluster(t *testing.T, messagesCount int) *kafka.MockCluster {
+	cluster, err := kafka.NewMockCluster(1)
+	require.NoError(t, err)
+	t.Cleanup(cluster.Close)
+	require.NoError(t, cluster.CreateTopic(lagMonitorTestTopic, 1, 1))
+	producer, err := kafka.NewProducer(&kafka.ConfigMap{"bootstrap.servers": cluster.BootstrapServers(), "go.delivery.reports": false})
+	require.NoError(t, err)
+	defer producer.Close()
+	topic := lagMonitorTestTopic
+	for i := 0; i < messagesCount; i++ {
+		require.NoError(t, producer.Produce(&kafka.Message{TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 0}, Value: []byte("{}")}, nil))
+	}
+	require.Equal(t, 0, producer.Flush(10000))
+	return cluster
+}
+
+// commitLagMonitorTestOffset commits offset of destination topic consumer group
+func commitLagMonitorTestOffset(t *testing.T, cluster *kafka.MockCluster, offset int64) {
+	consumer, err := kafka.NewConsumer(&kafka.ConfigMap{"bootstrap.servers": cluster.BootstrapServers(), "group.id": lagMonitorTestTopic})
+	require.NoError(t, err)
+	defer consumer.Close()
+	topic := lagMonitorTestTopic
+	_, err = consumer.CommitOffsets([]kafka.TopicPartition{{Topic: &topic, Partition: 0, Offset: kafka.Offset(offset)}})
+	require.NoError(t, err)
+}
+
+func newTestLagMonitor(t *testing.T, cluster *kafka.MockCluster) *LagMonitor {
+	admin, err := kafka.NewAdminClient(&kafka.ConfigMap{"bootstrap.servers": cluster.BootstrapServers()})
+	require.NoError(t, err)
+	repository := &Repository{}
+	repository.repository.Store(&repositoryInternal{destinations: map[string]*Destination{"d1": consumerGroupTestDestination(t, nil)}})
+	lm := &LagMonitor{Service: appbase.NewServiceBase("lag-monitor"), config: &Config{KafkaConfig: kafkabase.KafkaConfig{KafkaAdminMetadataTimeoutMs: 5000}},
+		repository: repository, admin: admin, committed: map[string]int64{}, closed: make(chan struct{})}
+	t.Cleanup(func() { _ = lm.Close() })
+	return lm
+}
+
+func TestLagMonitor(t *testing.T) {
+	reqr := require.New(t)
+	cluster := newLagMonitorTestCluster(t, 5)
+	lm := newTestLagMonitor(t, cluster)
+	reqr.Nil(lm.Signals())
+
+	//consumer group without committed offset starts from the earliest offset
+	lm.measure()
+	signals := lm.Signals()
+	reqr.NotNil(signals)
+	reqr.Equal(int64(5), signals.Lag)
+	reqr.Equal(DestinationLag{Lag: 5}, signals.Destinations["d1"])
+
+	commitLagMonitorTestOffset(t, cluster, 4)
+	time.Sleep(100 * time.Millisecond)
+	lm.measure()
+	signals = lm.Signals()
+	reqr.Equal(int64(1), signals.Lag)
+	reqr.Equal(int64(1), signals.Destinations["d1"].Lag)
+	reqr.Greater(signals.Rate, 0.0)
+	reqr.Equal(signals.Rate, signals.Destinations["d1"].Rate)
+}
+
+func TestAutoscalingHandler(t *testing.T) {
+	request := func(m *MetricsServer, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		m.server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+	//autoscaling is disabled
+	m := NewMetricsServer(&Config{}, nil)
+	t.Cleanup(func() { _ = m.Stop() })
+	require.Equal(t, http.StatusServiceUnavailable, request(m, "/autoscaling").Code)
+
+	lm := newTestLagMonitor(t, newLagMonitorTestCluster(t, 3))
+	lm.measure()
+	m = NewMetricsServer(&Config{}, lm)
+	t.Cleanup(func() { _ = m.Stop() })
+
+	w := request(m, "/autoscaling")
+	require.Equal(t, http.StatusOK, w.Code)
+	signals := AutoscalingSignals{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &signals))
+	require.Equal(t, int64(3), signals.Lag)
+	require.Equal(t, map[string]DestinationLag{"d1": {Lag: 3}}, signals.Destinations)
+
+	w = request(m, "/autoscaling?destinationId=d1")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"lag": 3, "rate": 0}`, w.Body.String())
+	//destination without topics has zero lag
+	w = request(m, "/autoscaling?destinationId=d2")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"lag": 0, "rate": 0}`, w.Body.String())
+}
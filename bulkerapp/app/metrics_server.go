@@ -13,15 +13,19 @@ import (
 
 type MetricsServer struct {
 	appbase.Service
-	server *http.Server
+	server     *http.Server
+	lagMonitor *LagMonitor
 }
 
-func NewMetricsServer(appconfig *Config) *MetricsServer {
+func NewMetricsServer(appconfig *Config, lagMonitor *LagMonitor) *MetricsServer {
 	base := appbase.NewServiceBase("metrics_server")
 	engine := gin.New()
 	engine.Use(gin.Recovery())
+	m := &MetricsServer{Service: base, lagMonitor: lagMonitor}
 	//expose prometheus metrics
 	engine.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	//consumer lag and processing rate for KEDA metrics-api scaler
+	engine.GET("/autoscaling", m.AutoscalingHandler)
 
 	server := &http.Server{
 		Addr:              fmt.Sprintf("0.0.0.0:%d", appconfig.MetricsPort),
@@ -30,7 +34,7 @@ func NewMetricsServer(appconfig *Config) *MetricsServer {
 		ReadHeaderTimeout: time.Second * 60,
 		IdleTimeout:       time.Second * 65,
 	}
-	m := &MetricsServer{Service: base, server: server}
+	m.server = server
 	m.start()
 	return m
 }
@@ -42,6 +46,22 @@ func (s *MetricsServer) start() {
 	})
 }
 
+// AutoscalingHandler returns autoscaling signals of all destinations or of destination selected by destinationId query parameter
+func (s *MetricsServer) AutoscalingHandler(c *gin.Context) {
+	signals := s.lagMonitor.Signals()
+	if signals == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "autoscaling signals are not available yet"})
+		return
+	}
+	destinationId := c.Query("destinationId")
+	if destinationId == "" {
+		c.JSON(http.StatusOK, signals)
+		return
+	}
+	// destination without messages in topics has zero lag
+	c.JSON(http.StatusOK, signals.Destinations[destinationId])
+}
+
 func (s *MetricsServer) Stop() error {
 	s.Infof("Stopping metrics server")
 	return s.server.Shutdown(context.Background())
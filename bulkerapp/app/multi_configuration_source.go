@@ -58,6 +58,22 @@ func (mcs *MultiConfigurationSource) GetDestinationConfig(id string) *Destinatio
 	return nil
 }
 
+func (mcs *MultiConfigurationSource) GetFeatureFlags() []*FeatureFlagRule {
+	var results []*FeatureFlagRule
+	for _, cs := range mcs.configurationSources {
+		results = append(results, getFeatureFlags(cs)...)
+	}
+	return results
+}
+
+func (mcs *MultiConfigurationSource) GetDefaultOptions() []*DefaultOptionsRule {
+	var results []*DefaultOptionsRule
+	for _, cs := range mcs.configurationSources {
+		results = append(results, getDefaultOptions(cs)...)
+	}
+	return results
+}
+
 func (mcs *MultiConfigurationSource) ChangesChannel() <-chan bool {
 	return mcs.changesChan
 }
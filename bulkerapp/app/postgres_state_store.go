@@ -0,0 +1,140 @@
+package app
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jitsucom/bulker/jitsubase/appbase"
+	"github.com/jitsucom/bulker/jitsubase/pg"
+	jsoniter "github.com/json-iterator/go"
+	"time"
+)
+
+const (
+	pgCheckpointsCreateTableQuery = `create table if not exists bulker_stream_checkpoints (
+    connection_id text not null,
+    stream_key text not null,
+    checkpoint jsonb not null,
+    updated_at timestamptz not null,
+    primary key (connection_id, stream_key))`
+	pgCheckpointsUpsertQuery = `insert into bulker_stream_checkpoints (connection_id, stream_key, checkpoint, updated_at) values ($1, $2, $3, $4)
+on conflict (connection_id, stream_key) do update set checkpoint = excluded.checkpoint, updated_at = excluded.updated_at`
+	pgCheckpointsSelectQuery = `select checkpoint from bulker_stream_checkpoints where connection_id = $1`
+
+	pgFilesCreateTableQuery = `create table if not exists bulker_file_manifest (
+    connection_id text not null,
+    table_name text not null,
+    created_at timestamptz not null,
+    entry jsonb not null)`
+	pgFilesCreateIndexQuery = `create index if not exists bulker_file_manifest_connection_idx on bulker_file_manifest (connection_id, created_at)`
+	pgFilesInsertQuery      = `insert into bulker_file_manifest (connection_id, table_name, created_at, entry) values ($1, $2, $3, $4)`
+	pgFilesSelectQuery      = `select entry from bulker_file_manifest where connection_id = $1
+and ($2 = '' or table_name = $2) and ($3::timestamptz is null or created_at >= $3) and ($4::timestamptz is null or created_at < $4)
+order by created_at limit $5`
+)
+
+// PostgresStateStore stores checkpoints in bulker_stream_checkpoints table. Table is created if not exists
+type PostgresStateStore struct {
+	appbase.Service
+	dbpool *pgxpool.Pool
+}
+
+func NewPostgresStateStore(url string) (*PostgresStateStore, error) {
+	base := appbase.NewServiceBase("postgres_state_store")
+	dbpool, err := pg.NewPGPool(url)
+	if err != nil {
+		return nil, base.NewError("Unable to create postgres connection pool: %v", err)
+	}
+	if _, err = dbpool.Exec(context.Background(), pgCheckpointsCreateTableQuery); err != nil {
+		dbpool.Close()
+		return nil, base.NewError("Unable to create checkpoints table: %v", err)
+	}
+	for _, query := range []string{pgFilesCreateTableQuery, pgFilesCreateIndexQuery} {
+		if _, err = dbpool.Exec(context.Background(), query); err != nil {
+			dbpool.Close()
+			return nil, base.NewError("Unable to create files manifest table: %v", err)
+		}
+	}
+	return &PostgresStateStore{Service: base, dbpool: dbpool}, nil
+}
+
+func (ps *PostgresStateStore) Save(checkpoint *StreamCheckpoint) error {
+	payload, err := jsoniter.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	_, err = ps.dbpool.Exec(context.Background(), pgCheckpointsUpsertQuery, checkpoint.ConnectionId, checkpoint.Key(), payload, checkpoint.UpdatedAt)
+	if err != nil {
+		return ps.NewError("failed to save checkpoint: %v", err)
+	}
+	return nil
+}
+
+func (ps *PostgresStateStore) Load(connectionId string) ([]*StreamCheckpoint, error) {
+	rows, err := ps.dbpool.Query(context.Background(), pgCheckpointsSelectQuery, connectionId)
+	if err != nil {
+		return nil, ps.NewError("failed to load checkpoints: %v", err)
+	}
+	defer rows.Close()
+	checkpoints := make([]*StreamCheckpoint, 0)
+	for rows.Next() {
+		var payload []byte
+		if err = rows.Scan(&payload); err != nil {
+			return nil, ps.NewError("failed to scan checkpoint: %v", err)
+		}
+		checkpoint := &StreamCheckpoint{}
+		if err = jsoniter.Unmarshal(payload, checkpoint); err != nil {
+			return nil, ps.NewError("failed to parse checkpoint: %v", err)
+		}
+		checkpoints = append(checkpoints, checkpoint)
+	}
+	return checkpoints, rows.Err()
+}
+
+func (ps *PostgresStateStore) SaveFiles(entries []*FileManifestEntry) error {
+	batch := &pgx.Batch{}
+	for _, entry := range entries {
+		payload, err := jsoniter.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		batch.Queue(pgFilesInsertQuery, entry.ConnectionId, entry.TableName, entry.CreatedAt, payload)
+	}
+	if err := ps.dbpool.SendBatch(context.Background(), batch).Close(); err != nil {
+		return ps.NewError("failed to save files manifest: %v", err)
+	}
+	return nil
+}
+
+func (ps *PostgresStateStore) ListFiles(query FileManifestQuery) ([]*FileManifestEntry, error) {
+	var from, to *time.Time
+	if !query.From.IsZero() {
+		from = &query.From
+	}
+	if !query.To.IsZero() {
+		to = &query.To
+	}
+	rows, err := ps.dbpool.Query(context.Background(), pgFilesSelectQuery, query.ConnectionId, query.TableName, from, to, query.Limit)
+	if err != nil {
+		return nil, ps.NewError("failed to load files manifest: %v", err)
+	}
+	defer rows.Close()
+	entries := make([]*FileManifestEntry, 0)
+	for rows.Next() {
+		var payload []byte
+		if err = rows.Scan(&payload); err != nil {
+			return nil, ps.NewError("failed to scan files manifest entry: %v", err)
+		}
+		entry := &FileManifestEntry{}
+		if err = jsoniter.Unmarshal(payload, entry); err != nil {
+			return nil, ps.NewError("failed to parse files manifest entry: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (ps *PostgresStateStore) Close() error {
+	ps.dbpool.Close()
+	return nil
+}
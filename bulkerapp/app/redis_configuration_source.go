@@ -1,14 +1,14 @@
 package app
 
 import (
-	"crypto/tls"
-	"crypto/x509"
 	"fmt"
 	"github.com/gomodule/redigo/redis"
 	"github.com/jitsucom/bulker/bulkerapp/metrics"
 	"github.com/jitsucom/bulker/jitsubase/appbase"
+	"github.com/jitsucom/bulker/jitsubase/redispool"
 	"github.com/jitsucom/bulker/jitsubase/safego"
 	"github.com/jitsucom/bulker/jitsubase/utils"
+	jsoniter "github.com/json-iterator/go"
 	"regexp"
 	"strconv"
 	"strings"
@@ -17,6 +17,12 @@ import (
 )
 
 const redisDestinationsKey = "enrichedConnections"
+
+// redisFeatureFlagsKey key of JSON array with feature flags rules. See FeatureFlagRule
+const redisFeatureFlagsKey = "bulkerFeatureFlags"
+
+// redisDefaultOptionsKey key of JSON array with default options rules. See DefaultOptionsRule
+const redisDefaultOptionsKey = "bulkerDefaultOptions"
 const redisConfigurationSourceServiceName = "redis_configuration"
 
 var redisDatabaseNumberRegexp = regexp.MustCompile(`/(\d{1,2})$`)
@@ -28,10 +34,12 @@ type RedisConfigurationSource struct {
 	refreshChan chan bool
 	changesChan chan bool
 
-	redisPool    *redis.Pool
-	database     int
-	config       map[string]any
-	destinations map[string]*DestinationConfig
+	redisPool      *redis.Pool
+	database       int
+	config         map[string]any
+	destinations   map[string]*DestinationConfig
+	featureFlags   []*FeatureFlagRule
+	defaultOptions []*DefaultOptionsRule
 }
 
 func NewRedisConfigurationSource(appconfig *Config) (*RedisConfigurationSource, error) {
@@ -42,7 +50,10 @@ func NewRedisConfigurationSource(appconfig *Config) (*RedisConfigurationSource,
 	if len(redisDbStr) == 2 {
 		redisDbNumber, _ = strconv.Atoi(redisDbStr[1])
 	}
-	redisPool := newPool(appconfig.ConfigSource, appconfig.RedisTLSCA)
+	redisPool, err := redispool.NewRedisPool(appconfig.ConfigSource, appconfig.RedisTLS())
+	if err != nil {
+		return nil, err
+	}
 	r := RedisConfigurationSource{
 		Service:      base,
 		redisPool:    redisPool,
@@ -52,7 +63,7 @@ func NewRedisConfigurationSource(appconfig *Config) (*RedisConfigurationSource,
 		config:       make(map[string]any),
 		destinations: make(map[string]*DestinationConfig),
 	}
-	err := r.init()
+	err = r.init()
 	if err != nil {
 		return nil, err
 	}
@@ -78,6 +89,8 @@ func (rcs *RedisConfigurationSource) init() error {
 
 func (rcs *RedisConfigurationSource) pubsub() {
 	redisPubSubChannel := fmt.Sprintf("__keyspace@%d__:%s", rcs.database, redisDestinationsKey)
+	featureFlagsChannel := fmt.Sprintf("__keyspace@%d__:%s", rcs.database, redisFeatureFlagsKey)
+	defaultOptionsChannel := fmt.Sprintf("__keyspace@%d__:%s", rcs.database, redisDefaultOptionsKey)
 	for {
 		select {
 		case refresh := <-rcs.refreshChan:
@@ -92,9 +105,9 @@ func (rcs *RedisConfigurationSource) pubsub() {
 		pubSubConn := rcs.redisPool.Get()
 		// Subscribe to the channel
 		psc := redis.PubSubConn{Conn: pubSubConn}
-		err := psc.Subscribe(redisPubSubChannel)
+		err := psc.Subscribe(redisPubSubChannel, featureFlagsChannel, defaultOptionsChannel)
 		if err != nil {
-			_ = psc.Unsubscribe(redisPubSubChannel)
+			_ = psc.Unsubscribe(redisPubSubChannel, featureFlagsChannel, defaultOptionsChannel)
 			_ = pubSubConn.Close()
 			rcs.Errorf("Failed to subscribe to Redis Pub/Sub channel %s: %v", redisPubSubChannel, err)
 			time.Sleep(10 * time.Second)
@@ -116,7 +129,7 @@ func (rcs *RedisConfigurationSource) pubsub() {
 				break loop
 			}
 		}
-		_ = psc.Unsubscribe(redisPubSubChannel)
+		_ = psc.Unsubscribe(redisPubSubChannel, featureFlagsChannel, defaultOptionsChannel)
 		_ = pubSubConn.Close()
 
 	}
@@ -140,7 +153,17 @@ func (rcs *RedisConfigurationSource) load(notify bool) error {
 		metrics.ConfigurationSourceError(RedisError(err)).Inc()
 		return rcs.NewError("failed to load destinations by key: %s : %v", redisDestinationsKey, err)
 	}
-	newHash, err := utils.HashAny(configsById)
+	featureFlagsJson, err := redis.String(conn.Do("GET", redisFeatureFlagsKey))
+	if err != nil && err != redis.ErrNil {
+		metrics.ConfigurationSourceError(RedisError(err)).Inc()
+		return rcs.NewError("failed to load feature flags by key: %s : %v", redisFeatureFlagsKey, err)
+	}
+	defaultOptionsJson, err := redis.String(conn.Do("GET", redisDefaultOptionsKey))
+	if err != nil && err != redis.ErrNil {
+		metrics.ConfigurationSourceError(RedisError(err)).Inc()
+		return rcs.NewError("failed to load default options by key: %s : %v", redisDefaultOptionsKey, err)
+	}
+	newHash, err := utils.HashAny(map[string]any{"destinations": configsById, "featureFlags": featureFlagsJson, "defaultOptions": defaultOptionsJson})
 	if err != nil {
 		metrics.ConfigurationSourceError("hash_error").Inc()
 		return rcs.NewError("failed generate hash of redis config: %v", err)
@@ -162,8 +185,24 @@ func (rcs *RedisConfigurationSource) load(notify bool) error {
 			newDsts[id] = &dstCfg
 		}
 	}
+	var featureFlags []*FeatureFlagRule
+	if featureFlagsJson != "" {
+		if err = jsoniter.UnmarshalFromString(featureFlagsJson, &featureFlags); err != nil {
+			metrics.ConfigurationSourceError("parse_error").Inc()
+			rcs.Errorf("failed to parse feature flags: %s: %v", featureFlagsJson, err)
+		}
+	}
+	var defaultOptions []*DefaultOptionsRule
+	if defaultOptionsJson != "" {
+		if err = jsoniter.UnmarshalFromString(defaultOptionsJson, &defaultOptions); err != nil {
+			metrics.ConfigurationSourceError("parse_error").Inc()
+			rcs.Errorf("failed to parse default options: %s: %v", defaultOptionsJson, err)
+		}
+	}
 	rcs.Lock()
 	rcs.destinations = newDsts
+	rcs.featureFlags = featureFlags
+	rcs.defaultOptions = defaultOptions
 	rcs.currentHash = newHash
 	rcs.Unlock()
 	if notify {
@@ -177,33 +216,22 @@ func (rcs *RedisConfigurationSource) load(notify bool) error {
 	return nil
 }
 
-func newPool(redisURL string, ca string) *redis.Pool {
-	opts := make([]redis.DialOption, 0)
-	if ca != "" || strings.HasPrefix(redisURL, "rediss://") {
-		tlsConfig := tls.Config{InsecureSkipVerify: true}
-		if ca != "" {
-			rootCAs, _ := x509.SystemCertPool()
-			if rootCAs == nil {
-				rootCAs = x509.NewCertPool()
-			}
-			rootCAs.AppendCertsFromPEM([]byte(ca))
-			tlsConfig.RootCAs = rootCAs
-		}
-		opts = append(opts, redis.DialUseTLS(true), redis.DialTLSConfig(&tlsConfig))
-	}
+func (rcs *RedisConfigurationSource) GetDestinationConfig(id string) *DestinationConfig {
+	rcs.Lock()
+	defer rcs.Unlock()
+	return rcs.destinations[id]
+}
 
-	return &redis.Pool{
-		MaxIdle:     3,
-		IdleTimeout: 240 * time.Second,
-		// Dial or DialContext must be set. When both are set, DialContext takes precedence over Dial.
-		Dial: func() (redis.Conn, error) { return redis.DialURL(redisURL, opts...) },
-	}
+func (rcs *RedisConfigurationSource) GetFeatureFlags() []*FeatureFlagRule {
+	rcs.Lock()
+	defer rcs.Unlock()
+	return rcs.featureFlags
 }
 
-func (rcs *RedisConfigurationSource) GetDestinationConfig(id string) *DestinationConfig {
+func (rcs *RedisConfigurationSource) GetDefaultOptions() []*DefaultOptionsRule {
 	rcs.Lock()
 	defer rcs.Unlock()
-	return rcs.destinations[id]
+	return rcs.defaultOptions
 }
 
 func (rcs *RedisConfigurationSource) GetValue(key string) any {
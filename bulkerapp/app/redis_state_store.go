@@ -0,0 +1,111 @@
+package app
+
+import (
+	"github.com/gomodule/redigo/redis"
+	"github.com/jitsucom/bulker/jitsubase/appbase"
+	"github.com/jitsucom/bulker/jitsubase/redispool"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	jsoniter "github.com/json-iterator/go"
+	"strconv"
+)
+
+const (
+	// redisCheckpointsKeyPrefix checkpoints of connection are stored in hash: bulker_checkpoints:<connection id> -> <mode>/<table name>
+	redisCheckpointsKeyPrefix = "bulker_checkpoints:"
+	// redisFilesKeyPrefix files manifest of connection is stored in sorted set: bulker_files:<connection id> scored by creation time in ms
+	redisFilesKeyPrefix = "bulker_files:"
+)
+
+// RedisStateStore stores checkpoints in Redis hashes
+type RedisStateStore struct {
+	appbase.Service
+	redisPool *redis.Pool
+}
+
+func NewRedisStateStore(redisURL string, tlsConfig *utils.TLSConfig) (*RedisStateStore, error) {
+	base := appbase.NewServiceBase("redis_state_store")
+	redisPool, err := redispool.NewRedisPool(redisURL, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisStateStore{Service: base, redisPool: redisPool}, nil
+}
+
+func (rs *RedisStateStore) Save(checkpoint *StreamCheckpoint) error {
+	payload, err := jsoniter.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	connection := rs.redisPool.Get()
+	defer connection.Close()
+	_, err = connection.Do("HSET", redisCheckpointsKeyPrefix+checkpoint.ConnectionId, checkpoint.Key(), payload)
+	if err != nil {
+		return rs.NewError("failed to save checkpoint: %v", err)
+	}
+	return nil
+}
+
+func (rs *RedisStateStore) Load(connectionId string) ([]*StreamCheckpoint, error) {
+	connection := rs.redisPool.Get()
+	defer connection.Close()
+	values, err := redis.ByteSlices(connection.Do("HVALS", redisCheckpointsKeyPrefix+connectionId))
+	if err != nil {
+		return nil, rs.NewError("failed to load checkpoints: %v", err)
+	}
+	checkpoints := make([]*StreamCheckpoint, 0, len(values))
+	for _, value := range values {
+		checkpoint := &StreamCheckpoint{}
+		if err = jsoniter.Unmarshal(value, checkpoint); err != nil {
+			return nil, rs.NewError("failed to parse checkpoint: %v", err)
+		}
+		checkpoints = append(checkpoints, checkpoint)
+	}
+	return checkpoints, nil
+}
+
+func (rs *RedisStateStore) SaveFiles(entries []*FileManifestEntry) error {
+	connection := rs.redisPool.Get()
+	defer connection.Close()
+	for _, entry := range entries {
+		payload, err := jsoniter.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		if err = connection.Send("ZADD", redisFilesKeyPrefix+entry.ConnectionId, entry.CreatedAt.UnixMilli(), payload); err != nil {
+			return rs.NewError("failed to save files manifest: %v", err)
+		}
+	}
+	if _, err := connection.Do(""); err != nil {
+		return rs.NewError("failed to save files manifest: %v", err)
+	}
+	return nil
+}
+
+func (rs *RedisStateStore) ListFiles(query FileManifestQuery) ([]*FileManifestEntry, error) {
+	from, to := "-inf", "+inf"
+	if !query.From.IsZero() {
+		from = strconv.FormatInt(query.From.UnixMilli(), 10)
+	}
+	if !query.To.IsZero() {
+		to = "(" + strconv.FormatInt(query.To.UnixMilli(), 10)
+	}
+	connection := rs.redisPool.Get()
+	defer connection.Close()
+	values, err := redis.ByteSlices(connection.Do("ZRANGEBYSCORE", redisFilesKeyPrefix+query.ConnectionId, from, to))
+	if err != nil {
+		return nil, rs.NewError("failed to load files manifest: %v", err)
+	}
+	entries := make([]*FileManifestEntry, 0, len(values))
+	for _, value := range values {
+		entry := &FileManifestEntry{}
+		if err = jsoniter.Unmarshal(value, entry); err != nil {
+			return nil, rs.NewError("failed to parse files manifest entry: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	return query.filter(entries), nil
+}
+
+func (rs *RedisStateStore) Close() error {
+	return rs.redisPool.Close()
+}
@@ -1,17 +1,22 @@
 package app
 
 import (
+	"context"
 	"fmt"
 	"github.com/jitsucom/bulker/bulkerapp/metrics"
 	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/secrets"
 	"github.com/jitsucom/bulker/jitsubase/appbase"
 	"github.com/jitsucom/bulker/jitsubase/logging"
 	"github.com/jitsucom/bulker/jitsubase/safego"
 	"github.com/jitsucom/bulker/jitsubase/utils"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
+const secretsResolveTimeout = 30 * time.Second
+
 type RepositoryChange struct {
 	AddedDestinations     []*Destination
 	ChangedDestinations   []*Destination
@@ -22,6 +27,11 @@ type Repository struct {
 	appbase.Service
 	configurationSource ConfigurationSource
 	repository          atomic.Pointer[repositoryInternal]
+	secretsResolver     *secrets.Resolver
+	// secretsRefreshPeriod how often destinations with secret references are checked for rotated secrets
+	secretsRefreshPeriod time.Duration
+	// inFlight in-flight events counters by destination id. See InFlightEvents
+	inFlight sync.Map
 
 	changesChan chan RepositoryChange
 }
@@ -42,8 +52,9 @@ func (r *Repository) GetDestinations() []*Destination {
 func (r *Repository) init() error {
 	base := appbase.NewServiceBase("repository")
 	internal := &repositoryInternal{
-		Service:      base,
-		destinations: make(map[string]*Destination),
+		Service:         base,
+		destinations:    make(map[string]*Destination),
+		secretsResolver: r.secretsResolver,
 	}
 	err := internal.init(r.configurationSource)
 	if err != nil {
@@ -100,13 +111,27 @@ func (r *Repository) ChangesChannel() <-chan RepositoryChange {
 }
 
 func (r *Repository) changeListener() {
-	for range r.configurationSource.ChangesChannel() {
+	ticker := time.NewTicker(r.secretsRefreshPeriod)
+	defer ticker.Stop()
+	changes := r.configurationSource.ChangesChannel()
+	for {
+		select {
+		case _, ok := <-changes:
+			if !ok {
+				r.Infof("change listener stopped.")
+				return
+			}
+		case <-ticker.C:
+			// reload repository to recreate destinations with rotated secrets
+			if !r.repository.Load().hasSecretReferences {
+				continue
+			}
+		}
 		err := r.init()
 		if err != nil {
 			r.Errorf("failed to reload repository: %v", err)
 		}
 	}
-	r.Infof("change listener stopped.")
 }
 
 // Close Repository
@@ -117,15 +142,26 @@ func (r *Repository) Close() error {
 type repositoryInternal struct {
 	appbase.Service
 	sync.Mutex
-	destinations map[string]*Destination
+	destinations        map[string]*Destination
+	secretsResolver     *secrets.Resolver
+	hasSecretReferences bool
 }
 
-func NewRepository(_ *Config, configurationSource ConfigurationSource) (*Repository, error) {
+func NewRepository(config *Config, configurationSource ConfigurationSource) (*Repository, error) {
 	base := appbase.NewServiceBase("repository")
+	secretsCacheTTL := utils.Nvl(config.SecretsCacheTTLSec, 300)
 	r := Repository{
 		Service:             base,
 		configurationSource: configurationSource,
 		changesChan:         make(chan RepositoryChange, 10),
+		secretsResolver: secrets.NewResolver(secrets.Config{
+			VaultAddr:      config.VaultAddr,
+			VaultToken:     config.VaultToken,
+			VaultNamespace: config.VaultNamespace,
+			AwsRegion:      config.SecretsAwsRegion,
+			CacheTTLSec:    int64(secretsCacheTTL),
+		}),
+		secretsRefreshPeriod: time.Duration(secretsCacheTTL) * time.Second,
 	}
 	err := r.init()
 	if err != nil {
@@ -137,15 +173,27 @@ func NewRepository(_ *Config, configurationSource ConfigurationSource) (*Reposit
 
 func (r *repositoryInternal) init(configurationSource ConfigurationSource) error {
 	r.Debugf("Initializing repository")
+	featureFlags := getFeatureFlags(configurationSource)
+	defaultOptions := getDefaultOptions(configurationSource)
 	for _, cfg := range configurationSource.GetDestinationConfigs() {
-		r.addDestination(cfg)
+		r.addDestination(cfg, featureFlags, defaultOptions)
 	}
 	return nil
 }
 
-func (r *repositoryInternal) addDestination(cfg *DestinationConfig) {
+func (r *repositoryInternal) addDestination(cfg *DestinationConfig, featureFlags []*FeatureFlagRule, defaultOptions []*DefaultOptionsRule) {
+	flags := featureFlagsFor(featureFlags, cfg)
+	// destination inherits default options of its workspace and type and may override them.
+	// Options of enabled feature flags win over defaults
+	inherited := defaultOptionsFor(defaultOptions, cfg)
+	for _, flag := range flags {
+		for name := range flag.Options {
+			delete(inherited, name)
+		}
+	}
+	serializedOptions := utils.MapPutAll(utils.MapCopy(inherited), cfg.StreamConfig.Options)
 	options := bulker.StreamOptions{}
-	for name, serializedOption := range cfg.StreamConfig.Options {
+	for name, serializedOption := range serializedOptions {
 		opt, err := bulker.ParseOption(name, serializedOption)
 		if err != nil {
 			metrics.RepositoryDestinationInitError(cfg.Id()).Inc()
@@ -155,8 +203,26 @@ func (r *repositoryInternal) addDestination(cfg *DestinationConfig) {
 		}
 		options.Add(opt)
 	}
-	configHash, _ := utils.HashAny(cfg)
-	r.destinations[cfg.Id()] = &Destination{config: cfg, configHash: configHash, mode: bulker.ModeOption.Get(&options), streamOptions: &options, owner: r}
+	// options of flags are applied at stream setup unless the same options are set for destination explicitly
+	if len(flags) > 0 {
+		options.Add(bulker.WithFeatureFlags(flags...))
+	}
+	// secrets are resolved into a copy of config so secret values never get to config source or logs
+	resolvedCfg := *cfg
+	var secretsErr error
+	if secrets.HasReferences(cfg.DestinationConfig) {
+		r.hasSecretReferences = true
+		ctx, cancel := context.WithTimeout(context.Background(), secretsResolveTimeout)
+		resolvedCfg.DestinationConfig, secretsErr = r.secretsResolver.Resolve(ctx, cfg.DestinationConfig)
+		cancel()
+		if secretsErr != nil {
+			metrics.RepositoryDestinationInitError(cfg.Id()).Inc()
+			r.Errorf("destination %s – %v", cfg.Id(), secretsErr)
+		}
+	}
+	// hash of resolved config changes when secret is rotated, feature flags or inherited options of destination change
+	configHash, _ := utils.HashAny(map[string]any{"config": resolvedCfg, "featureFlags": flags, "defaultOptions": inherited})
+	r.destinations[cfg.Id()] = &Destination{config: cfg, bulkerConfig: resolvedCfg.Config, secretsErr: secretsErr, configHash: configHash, mode: bulker.ModeOption.Get(&options), streamOptions: &options, owner: r}
 }
 
 func (r *repositoryInternal) GetDestination(id string) *Destination {
@@ -201,7 +267,10 @@ func (r *repositoryInternal) GetDestinations() []*Destination {
 
 type Destination struct {
 	sync.Mutex
-	config        *DestinationConfig
+	config *DestinationConfig
+	// bulkerConfig config with resolved secrets
+	bulkerConfig  bulker.Config
+	secretsErr    error
 	configHash    uint64
 	mode          bulker.BulkMode
 	bulker        bulker.Bulker
@@ -242,7 +311,11 @@ func (d *Destination) InitBulkerInstance() {
 		}
 	}()
 
-	d.bulker, err = bulker.CreateBulker(d.config.Config)
+	if d.secretsErr != nil {
+		d.bulker = &bulker.DummyBulker{Error: fmt.Errorf("failed to resolve secrets: %v", d.secretsErr)}
+		return
+	}
+	d.bulker, err = bulker.CreateBulker(d.bulkerConfig)
 	if err != nil {
 		metrics.RepositoryDestinationInitError(d.Id()).Inc()
 		if d.bulker == nil {
@@ -295,8 +368,9 @@ func (d *Destination) Release() {
 }
 
 // equals compares destination with another destination
+// destinations with unresolved secrets are never equal so resolution is retried on reload
 func (d *Destination) equals(o *Destination) bool {
-	return d.configHash == o.configHash && d.config.UpdatedAt == o.config.UpdatedAt
+	return d.secretsErr == nil && o.secretsErr == nil && d.configHash == o.configHash && d.config.UpdatedAt == o.config.UpdatedAt
 }
 
 //// AddBatchConsumer Add batch consumer to destination
@@ -13,8 +13,8 @@ type RetryConsumer struct {
 	*AbstractBatchConsumer
 }
 
-func NewRetryConsumer(repository *Repository, destinationId string, batchPeriodSec int, topicId string, config *Config, kafkaConfig *kafka.ConfigMap, bulkerProducer *Producer) (*RetryConsumer, error) {
-	base, err := NewAbstractBatchConsumer(repository, destinationId, batchPeriodSec, topicId, "retry", config, kafkaConfig, bulkerProducer)
+func NewRetryConsumer(repository *Repository, destinationId string, retryPeriodSec int, topicId string, config *Config, kafkaConfig *kafka.ConfigMap, bulkerProducer *Producer) (*RetryConsumer, error) {
+	base, err := NewAbstractBatchConsumer(repository, destinationId, BatchTriggers{PeriodSec: retryPeriodSec}, topicId, "retry", config, kafkaConfig, bulkerProducer)
 	if err != nil {
 		return nil, err
 	}
@@ -163,7 +163,10 @@ func (rc *RetryConsumer) processBatchImpl(_ *Destination, _, _, retryBatchSize i
 			// retry time is not yet come. requeueing message
 			topic = rc.topicId
 		} else {
-			retries++
+			if !kafkabase.EnvelopeVersionTooNew(message) {
+				// attempts of instances that don't support message envelope version are not counted
+				retries++
+			}
 			singleCount.retryScheduled++
 		}
 		kafkabase.PutKafkaHeader(&headers, retriesCountHeader, strconv.Itoa(retries))
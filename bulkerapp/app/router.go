@@ -5,12 +5,15 @@ import (
 	"bytes"
 	"crypto/sha512"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
 	"github.com/gin-gonic/gin"
 	"github.com/hjson/hjson-go/v4"
 	"github.com/jitsucom/bulker/bulkerapp/metrics"
 	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/implementations/sql"
+	"github.com/jitsucom/bulker/bulkerlib/secrets"
 	"github.com/jitsucom/bulker/bulkerlib/types"
 	"github.com/jitsucom/bulker/eventslog"
 	"github.com/jitsucom/bulker/jitsubase/appbase"
@@ -18,6 +21,7 @@ import (
 	"github.com/jitsucom/bulker/jitsubase/timestamp"
 	"github.com/jitsucom/bulker/jitsubase/utils"
 	"github.com/jitsucom/bulker/jitsubase/uuid"
+	"github.com/jitsucom/bulker/kafkabase"
 	jsoniter "github.com/json-iterator/go"
 	timeout "github.com/vearne/gin-timeout"
 	"io"
@@ -41,20 +45,26 @@ type Router struct {
 	producer         *Producer
 	eventsLogService eventslog.EventsLogService
 	fastStore        *FastStore
+	// stateCheckpointer nil if state store is not configured
+	stateCheckpointer *StateCheckpointer
+	// lagMonitor nil if autoscaling is disabled
+	lagMonitor *LagMonitor
 }
 
 func NewRouter(appContext *Context) *Router {
 	base := appbase.NewRouterBase(appContext.config.Config, []string{"/ready", "/health"})
 
 	router := &Router{
-		Router:           base,
-		config:           appContext.config,
-		kafkaConfig:      appContext.kafkaConfig,
-		repository:       appContext.repository,
-		topicManager:     appContext.topicManager,
-		producer:         appContext.batchProducer,
-		eventsLogService: appContext.eventsLogService,
-		fastStore:        appContext.fastStore,
+		Router:            base,
+		config:            appContext.config,
+		kafkaConfig:       appContext.kafkaConfig,
+		repository:        appContext.repository,
+		topicManager:      appContext.topicManager,
+		lagMonitor:        appContext.lagMonitor,
+		producer:          appContext.batchProducer,
+		eventsLogService:  appContext.eventsLogService,
+		fastStore:         appContext.fastStore,
+		stateCheckpointer: appContext.stateCheckpointer,
 	}
 	engine := router.Engine()
 	fast := engine.Group("")
@@ -66,7 +76,14 @@ func NewRouter(appContext *Context) *Router {
 	fast.GET("/health", router.Health)
 
 	engine.POST("/bulk/:destinationId", router.BulkHandler)
+	engine.POST("/upload/:destinationId", router.UploadHandler)
 	engine.GET("/failed/:destinationId", router.FailedHandler)
+	engine.POST("/delete/:destinationId", router.DeleteRowsHandler)
+	engine.GET("/state/:destinationId", router.StateHandler)
+	engine.GET("/files/:destinationId", router.FilesHandler)
+	engine.GET("/topology", router.TopologyHandler)
+	engine.GET("/config-schema", router.ConfigSchemaHandler)
+	engine.GET("/config-schema/:destinationType", router.ConfigSchemaHandler)
 
 	engine.GET("/debug/pprof/profile", gin.WrapF(pprof.Profile))
 	engine.GET("/debug/pprof/heap", gin.WrapF(pprof.Handler("heap").ServeHTTP))
@@ -121,6 +138,12 @@ func (r *Router) EventsHandler(c *gin.Context) {
 		rError = r.ResponseError(c, http.StatusBadRequest, "missing required parameter", false, fmt.Errorf("tableName query parameter is required"), true)
 		return
 	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		rError = r.ResponseError(c, http.StatusBadRequest, "error reading HTTP body", false, err, true)
+		return
+	}
+	bytesRead = len(body)
 	topicId, err := destination.TopicId(tableName)
 	if err != nil {
 		rError = r.ResponseError(c, http.StatusInternalServerError, "couldn't generate topicId", false, err, true)
@@ -137,13 +160,7 @@ func (r *Router) EventsHandler(c *gin.Context) {
 		}
 	}
 
-	body, err := io.ReadAll(c.Request.Body)
-	if err != nil {
-		rError = r.ResponseError(c, http.StatusBadRequest, "error reading HTTP body", false, err, true)
-		return
-	}
-	bytesRead = len(body)
-	err = r.producer.ProduceAsync(topicId, uuid.New(), body, map[string]string{MetricsMetaHeader: metricsMeta}, kafka.PartitionAny)
+	err = r.producer.ProduceFramed(topicId, body, map[string]string{MetricsMetaHeader: metricsMeta})
 	if err != nil {
 		rError = r.ResponseError(c, http.StatusInternalServerError, "producer error", true, err, true)
 		return
@@ -158,8 +175,6 @@ func (r *Router) BulkHandler(c *gin.Context) {
 	taskId := c.DefaultQuery("taskId", uuid.New())
 	jobId := c.DefaultQuery("jobId", fmt.Sprintf("%s_%s_%s", destinationId, tableName, taskId))
 	bulkMode := bulker.BulkMode(c.DefaultQuery("mode", string(bulker.ReplaceTable)))
-	pkeys := c.QueryArray("pk")
-	schemaHeader := c.GetHeader("X-Jitsu-Schema")
 	mode := ""
 	bytesRead := 0
 	var err error
@@ -169,10 +184,10 @@ func (r *Router) BulkHandler(c *gin.Context) {
 	defer func() {
 		state.ProcessingTimeSec = time.Since(start).Seconds()
 		if rError != nil {
-			r.postEventsLog(destinationId, state, processedObjectSample, rError.PublicError)
+			r.postEventsLog(destinationId, tableName, state, processedObjectSample, rError.PublicError)
 			metrics.BulkHandlerRequests(destinationId, mode, tableName, "error", rError.ErrorType).Inc()
 		} else {
-			r.postEventsLog(destinationId, state, processedObjectSample, nil)
+			r.postEventsLog(destinationId, tableName, state, processedObjectSample, nil)
 			metrics.BulkHandlerRequests(destinationId, mode, tableName, "success", "").Inc()
 			metrics.EventsHandlerBytes(destinationId, mode, tableName, "success", "").Add(float64(bytesRead))
 		}
@@ -188,25 +203,14 @@ func (r *Router) BulkHandler(c *gin.Context) {
 		rError = r.ResponseError(c, http.StatusBadRequest, "missing required parameter", false, fmt.Errorf("tableName query parameter is required"), true)
 		return
 	}
-	var streamOptions []bulker.StreamOption
-	if len(pkeys) > 0 {
-		streamOptions = append(streamOptions, bulker.WithPrimaryKey(pkeys...), bulker.WithDeduplicate())
-	}
-	if schemaHeader != "" {
-		schema := types.Schema{}
-		err = json.Unmarshal([]byte(schemaHeader), &schema)
-		if err != nil {
-			rError = r.ResponseError(c, http.StatusBadRequest, "schema unmarshal error", false, err, true)
-			return
-		}
-		if !schema.IsEmpty() {
-			streamOptions = append(streamOptions, bulker.WithSchema(schema))
-		}
-		r.Infof("Schema for %s: %v", jobId, schema)
+	request, err := r.parseBulkRequest(c, jobId)
+	if err != nil {
+		rError = r.ResponseError(c, http.StatusBadRequest, "schema unmarshal error", false, err, true)
+		return
 	}
 	//streamOptions = append(streamOptions, sql.WithoutOmitNils())
 	destination.InitBulkerInstance()
-	bulkerStream, err := destination.bulker.CreateStream(jobId, tableName, bulkMode, streamOptions...)
+	bulkerStream, err := destination.bulker.CreateStream(jobId, tableName, bulkMode, request.streamOptions...)
 	if err != nil {
 		rError = r.ResponseError(c, http.StatusInternalServerError, "create stream error", true, err, true)
 		return
@@ -230,7 +234,11 @@ func (r *Router) BulkHandler(c *gin.Context) {
 			rError = r.ResponseError(c, http.StatusBadRequest, "unmarhsal error", false, err, true)
 			return
 		}
-		if _, processedObjectSample, err = bulkerStream.Consume(c, obj); err != nil {
+		if _, processedObjectSample, err = bulkerStream.Consume(c, obj); bulker.IsRejectedObjectError(err) {
+			//rejected events are skipped and counted in 'rejectedRows' of the resulting state
+			r.Warnf("Bulk stream for %s: event was rejected: %v", jobId, err)
+			continue
+		} else if err != nil {
 			state, _ = bulkerStream.Abort(c)
 			rError = r.ResponseError(c, http.StatusBadRequest, "stream consume error", false, err, true)
 			return
@@ -248,7 +256,13 @@ func (r *Router) BulkHandler(c *gin.Context) {
 			rError = r.ResponseError(c, http.StatusBadRequest, "stream complete error", false, err, true)
 			return
 		}
-		r.Infof("Bulk stream for %s mode: %s Completed. Processed: %d in %dms.", jobId, mode, state.SuccessfulRows, time.Since(start).Milliseconds())
+		if state.Duplicate {
+			r.Infof("Bulk stream for %s mode: %s with idempotency key %s was already completed. Skipped.", jobId, mode, request.idempotencyKey)
+		} else if request.dryRun {
+			r.Infof("Bulk stream for %s mode: %s Dry run completed. Planned statements: %d.", jobId, mode, len(state.DryRunStatements))
+		} else {
+			r.Infof("Bulk stream for %s mode: %s Completed. Processed: %d in %dms.", jobId, mode, state.SuccessfulRows, time.Since(start).Milliseconds())
+		}
 		c.JSON(http.StatusOK, gin.H{"message": "ok", "state": state})
 	} else {
 		state, _ = bulkerStream.Abort(c)
@@ -256,10 +270,92 @@ func (r *Router) BulkHandler(c *gin.Context) {
 	}
 }
 
-func (r *Router) postEventsLog(destinationId string, state bulker.State, processedObjectSample types.Object, batchErr error) {
+// bulkRequest parameters of bulk stream provided with request
+type bulkRequest struct {
+	streamOptions  []bulker.StreamOption
+	idempotencyKey string
+	dryRun         bool
+}
+
+// parseBulkRequest returns options of bulk stream provided with request: primary key (pk), schema (X-Jitsu-Schema header),
+// idempotency key and dry run. Returns error if schema can't be parsed
+func (r *Router) parseBulkRequest(c *gin.Context, jobId string) (*bulkRequest, error) {
+	var streamOptions []bulker.StreamOption
+	if pkeys := c.QueryArray("pk"); len(pkeys) > 0 {
+		streamOptions = append(streamOptions, bulker.WithPrimaryKey(pkeys...), bulker.WithDeduplicate())
+	}
+	if schemaHeader := c.GetHeader("X-Jitsu-Schema"); schemaHeader != "" {
+		schema := types.Schema{}
+		if err := json.Unmarshal([]byte(schemaHeader), &schema); err != nil {
+			return nil, err
+		}
+		if !schema.IsEmpty() {
+			streamOptions = append(streamOptions, bulker.WithSchema(schema))
+		}
+		r.Infof("Schema for %s: %v", jobId, schema)
+	}
+	idempotencyKey := c.DefaultQuery("idempotencyKey", c.GetHeader("Idempotency-Key"))
+	if idempotencyKey != "" {
+		streamOptions = append(streamOptions, bulker.WithIdempotencyKey(idempotencyKey))
+	}
+	dryRun := c.Query("dryRun") == "true"
+	if dryRun {
+		streamOptions = append(streamOptions, sql.WithDryRun())
+	}
+	return &bulkRequest{streamOptions: streamOptions, idempotencyKey: idempotencyKey, dryRun: dryRun}, nil
+}
+
+type DeleteRowsPayload struct {
+	Filters []sql.RowsFilter `json:"filters"`
+	// ExpectedCount if set, rows are deleted only if number of matching rows equals to this value (usually taken from dry run).
+	// Rows are counted and deleted in the same transaction
+	ExpectedCount *int `json:"expectedCount,omitempty"`
+}
+
+// DeleteRowsHandler deletes rows of destination table matching all filters.
+// Runs in dry-run mode (only counts matching rows) unless dryRun=false query parameter is provided
+func (r *Router) DeleteRowsHandler(c *gin.Context) {
+	destinationId := c.Param("destinationId")
+	tableName := c.Query("tableName")
+	dryRun := c.Query("dryRun") != "false"
+	destination := r.repository.GetDestination(destinationId)
+	if destination == nil {
+		_ = r.ResponseError(c, http.StatusNotFound, "destination not found", false, fmt.Errorf("destination not found: %s", destinationId), true)
+		return
+	}
+	if tableName == "" {
+		_ = r.ResponseError(c, http.StatusBadRequest, "missing required parameter", false, fmt.Errorf("tableName query parameter is required"), true)
+		return
+	}
+	payload := DeleteRowsPayload{}
+	dec := jsoniter.NewDecoder(c.Request.Body)
+	dec.UseNumber()
+	if err := dec.Decode(&payload); err != nil {
+		_ = r.ResponseError(c, http.StatusBadRequest, "unmarhsal error", false, err, true)
+		return
+	}
+	destination.InitBulkerInstance()
+	count, err := sql.DeleteRows(c, destination.bulker, tableName, payload.Filters, dryRun, payload.ExpectedCount)
+	var unexpectedCountErr *sql.UnexpectedRowsCountError
+	if errors.As(err, &unexpectedCountErr) {
+		_ = r.ResponseError(c, http.StatusConflict, "unexpected rows count", false, err, true)
+		return
+	} else if err != nil {
+		_ = r.ResponseError(c, http.StatusBadRequest, "delete rows error", false, err, true)
+		return
+	}
+	if !dryRun {
+		r.Infof("Deleted %d rows from table %s of destination %s by filters: %+v", count, tableName, destinationId, payload.Filters)
+	}
+	c.JSON(http.StatusOK, gin.H{"dryRun": dryRun, "count": count})
+}
+
+func (r *Router) postEventsLog(destinationId, tableName string, state bulker.State, processedObjectSample types.Object, batchErr error) {
 	if batchErr != nil && state.LastError == nil {
 		state.SetError(batchErr)
 	}
+	r.stateCheckpointer.Checkpoint(destinationId, tableName, "bulk", state)
+	r.stateCheckpointer.RecordFiles(destinationId, tableName, "bulk", state.Files)
 	batchState := BatchState{State: state, LastMappedRow: processedObjectSample}
 	level := eventslog.LevelInfo
 	if batchErr != nil {
@@ -268,6 +364,91 @@ func (r *Router) postEventsLog(destinationId string, state bulker.State, process
 	r.eventsLogService.PostAsync(&eventslog.ActorEvent{EventType: eventslog.EventTypeBatch, Level: level, ActorId: destinationId, Event: batchState})
 }
 
+// StateHandler returns the last known states of streams of destination persisted by state store
+func (r *Router) StateHandler(c *gin.Context) {
+	destinationId := c.Param("destinationId")
+	if r.stateCheckpointer == nil {
+		_ = r.ResponseError(c, http.StatusNotFound, "state store is not configured", false, fmt.Errorf("STATE_STORE is not set"), true)
+		return
+	}
+	checkpoints, err := r.stateCheckpointer.Load(destinationId)
+	if err != nil {
+		_ = r.ResponseError(c, http.StatusInternalServerError, "failed to load state", false, err, true)
+		return
+	}
+	if tableName := c.Query("tableName"); tableName != "" {
+		filtered := make([]*StreamCheckpoint, 0, len(checkpoints))
+		for _, checkpoint := range checkpoints {
+			if checkpoint.TableName == tableName {
+				filtered = append(filtered, checkpoint)
+			}
+		}
+		checkpoints = filtered
+	}
+	c.JSON(http.StatusOK, gin.H{"checkpoints": checkpoints})
+}
+
+// FilesHandler lists files produced by file storage destination. Optional query parameters:
+// tableName, from and to (RFC3339 range of files creation time) and limit
+func (r *Router) FilesHandler(c *gin.Context) {
+	destinationId := c.Param("destinationId")
+	if r.stateCheckpointer == nil {
+		_ = r.ResponseError(c, http.StatusNotFound, "state store is not configured", false, fmt.Errorf("STATE_STORE is not set"), true)
+		return
+	}
+	query := FileManifestQuery{ConnectionId: destinationId, TableName: c.Query("tableName")}
+	var err error
+	for param, value := range map[string]*time.Time{"from": &query.From, "to": &query.To} {
+		if raw := c.Query(param); raw != "" {
+			if *value, err = time.Parse(time.RFC3339Nano, raw); err != nil {
+				_ = r.ResponseError(c, http.StatusBadRequest, "invalid "+param+" parameter", false, err, true)
+				return
+			}
+		}
+	}
+	if raw := c.Query("limit"); raw != "" {
+		if query.Limit, err = strconv.Atoi(raw); err != nil || query.Limit <= 0 {
+			_ = r.ResponseError(c, http.StatusBadRequest, "invalid limit parameter", false, fmt.Errorf("limit must be positive integer: %s", raw), true)
+			return
+		}
+	}
+	files, err := r.stateCheckpointer.ListFiles(query)
+	if err != nil {
+		_ = r.ResponseError(c, http.StatusInternalServerError, "failed to load files manifest", false, err, true)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"files": files})
+}
+
+// TopologyHandler returns destinations, their topics, consumers status, outcomes of the latest batches and retry queues depths as one document
+func (r *Router) TopologyHandler(c *gin.Context) {
+	if r.topicManager == nil {
+		_ = r.ResponseError(c, http.StatusNotFound, "topic manager is not running", false, fmt.Errorf("instance doesn't run consumers"), true)
+		return
+	}
+	c.JSON(http.StatusOK, r.topicManager.Topology(r.lagMonitor.Signals()))
+}
+
+// ConfigSchemaHandler returns JSON Schemas of destination configs (credentials) and stream options.
+// With destinationType param returns schemas for that destination type only
+func (r *Router) ConfigSchemaHandler(c *gin.Context) {
+	destinationType := c.Param("destinationType")
+	if destinationType == "" {
+		destinations := map[string]*bulker.JSONSchema{}
+		for _, bulkerType := range bulker.ConfigSchemaTypes() {
+			destinations[bulkerType], _ = bulker.ConfigSchema(bulkerType)
+		}
+		c.JSON(http.StatusOK, gin.H{"destinations": destinations, "options": bulker.OptionsSchema()})
+		return
+	}
+	credentials, ok := bulker.ConfigSchema(destinationType)
+	if !ok {
+		_ = r.ResponseError(c, http.StatusNotFound, "unknown destination type", false, fmt.Errorf("unknown destination type: %s", destinationType), true)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"credentials": credentials, "options": bulker.OptionsSchema()})
+}
+
 func maskWriteKey(wk string) string {
 	arr := strings.Split(wk, ":")
 	if len(arr) > 1 {
@@ -305,7 +486,7 @@ func (r *Router) FailedHandler(c *gin.Context) {
 	c.Header("Content-Type", "application/x-ndjson")
 	for {
 		msg, err := consumer.ReadMessage(time.Second * 5)
-		jsn := make(map[string]any)
+		jsns := make([]map[string]any, 0, 1)
 		if err != nil {
 			kafkaErr := err.(kafka.Error)
 			if kafkaErr.Code() == kafka.ErrTimedOut {
@@ -314,17 +495,28 @@ func (r *Router) FailedHandler(c *gin.Context) {
 			errorID := uuid.NewLettersNumbers()
 			err = fmt.Errorf("error# %s: couldn't read kafka message from topic: %s : %v", errorID, topicId, kafkaErr)
 			r.Errorf(err.Error())
-			jsn["ERROR"] = fmt.Errorf("error# %s: couldn't read kafka message", errorID).Error()
+			jsns = append(jsns, map[string]any{"ERROR": fmt.Errorf("error# %s: couldn't read kafka message", errorID).Error()})
 		} else {
-			err = hjson.Unmarshal(msg.Value, &jsn)
+			values, err := kafkabase.UnpackEvents(msg)
 			if err != nil {
-				jsn["UNPARSABLE_MESSAGE"] = string(msg.Value)
+				values = [][]byte{msg.Value}
+			}
+			// framed message carries multiple events
+			for _, value := range values {
+				jsn := make(map[string]any)
+				err = hjson.Unmarshal(value, &jsn)
+				if err != nil {
+					jsn["UNPARSABLE_MESSAGE"] = string(value)
+				}
+				jsns = append(jsns, jsn)
 			}
 		}
 
-		bytes, _ := jsoniter.Marshal(jsn)
-		_, _ = c.Writer.Write(bytes)
-		_, _ = c.Writer.Write([]byte("\n"))
+		for _, jsn := range jsns {
+			bytes, _ := jsoniter.Marshal(jsn)
+			_, _ = c.Writer.Write(bytes)
+			_, _ = c.Writer.Write([]byte("\n"))
+		}
 		if msg.Timestamp.After(start) {
 			break
 		}
@@ -332,6 +524,33 @@ func (r *Router) FailedHandler(c *gin.Context) {
 	_ = consumer.Close()
 }
 
+// checkTestSecretReferences prevents reading arbitrary secrets with ad-hoc configs:
+// secret reference is allowed only if configured destination with the same id uses it or if it matches SECRETS_TEST_ALLOWED_PREFIXES
+func (r *Router) checkTestSecretReferences(destinationId string, destinationConfig map[string]any) error {
+	refs := secrets.References(destinationConfig)
+	if len(refs) == 0 {
+		return nil
+	}
+	allowed := utils.NewSet[string]()
+	if destination := r.repository.GetDestination(destinationId); destination != nil {
+		allowed.PutAll(secrets.References(destination.config.DestinationConfig))
+	}
+	allowedPrefixes := utils.ArrayFilter(strings.Split(r.config.SecretsTestAllowedPrefixes, ","), func(prefix string) bool {
+		return strings.TrimSpace(prefix) != ""
+	})
+	for _, ref := range refs {
+		if allowed.Contains(ref) {
+			continue
+		}
+		if !utils.ArrayContainsF(allowedPrefixes, func(prefix string) bool { return strings.HasPrefix(ref, strings.TrimSpace(prefix)) }) {
+			// don't echo the whole reference: it may reveal secrets layout
+			address, _, _ := strings.Cut(ref, "#")
+			return fmt.Errorf("secret reference %s is not used by destination '%s' and doesn't match allowed prefixes", address, destinationId)
+		}
+	}
+	return nil
+}
+
 func (r *Router) TestConnectionHandler(c *gin.Context) {
 	body, err := io.ReadAll(c.Request.Body)
 	if err != nil {
@@ -347,9 +566,17 @@ func (r *Router) TestConnectionHandler(c *gin.Context) {
 	} else {
 		r.Debugf("[test] parsed config for destination %s: %+v", utils.MapNVL(destinationConfig, "id", ""), destinationConfig)
 	}
-	bulkerCfg.DestinationConfig = destinationConfig
 	bulkerCfg.Id = utils.MapNVL(destinationConfig, "id", "").(string)
 	bulkerCfg.BulkerType = utils.MapNVL(destinationConfig, "destinationType", "").(string)
+	if err = r.checkTestSecretReferences(bulkerCfg.Id, destinationConfig); err != nil {
+		_ = r.ResponseError(c, http.StatusUnprocessableEntity, "secret references are not allowed", false, err, true)
+		return
+	}
+	bulkerCfg.DestinationConfig, err = r.repository.secretsResolver.Resolve(c.Request.Context(), destinationConfig)
+	if err != nil {
+		_ = r.ResponseError(c, http.StatusUnprocessableEntity, "error resolving secrets", false, err, true)
+		return
+	}
 
 	b, err := bulker.CreateBulker(bulkerCfg)
 	if err != nil {
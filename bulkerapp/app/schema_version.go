@@ -0,0 +1,169 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var schemaVersionUnsupportedChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// applySchemaVersion returns version-suffixed table for event when 'schemaVersionField' option is set for destination
+// and applies version-specific field mappings from 'schemaVersionMappings' option to the event in place.
+// Returns original tableName when versioning is not configured or event has no version field.
+func (d *Destination) applySchemaVersion(tableName string, event types.Object) string {
+	versionField := bulker.SchemaVersionFieldOption.Get(d.streamOptions)
+	if versionField == "" {
+		return tableName
+	}
+	version := schemaVersionString(event[versionField])
+	if version == "" {
+		return tableName
+	}
+	for source, target := range bulker.SchemaVersionMappingsOption.Get(d.streamOptions)[version] {
+		value, ok := event[source]
+		if !ok {
+			continue
+		}
+		delete(event, source)
+		if target != "" {
+			event[target] = value
+		}
+	}
+	return VersionedTableName(tableName, version)
+}
+
+// schemaVersionString returns version value as it was written in event: numbers keep their original representation.
+// Returns empty string for missing values and values of unsupported types
+func schemaVersionString(rawVersion any) string {
+	switch v := rawVersion.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return ""
+	}
+}
+
+// VersionedTableName returns table name with version suffix, e.g. events_v2.
+// Table that already has the suffix of version is returned as is
+func VersionedTableName(tableName, version string) string {
+	suffix := "_v" + schemaVersionUnsupportedChars.ReplaceAllString(version, "_")
+	if strings.HasSuffix(tableName, suffix) {
+		return tableName
+	}
+	return tableName + suffix
+}
+
+// CreateStream creates bulker stream for the table. When 'schemaVersionField' option is set for destination
+// events are routed to streams of version-suffixed tables
+func (d *Destination) CreateStream(id, tableName string, mode bulker.BulkMode) (bulker.BulkerStream, error) {
+	if bulker.SchemaVersionFieldOption.Get(d.streamOptions) == "" {
+		return d.bulker.CreateStream(id, tableName, mode, d.streamOptions.Options...)
+	}
+	return &schemaVersionStream{
+		destination: d,
+		id:          id,
+		tableName:   tableName,
+		mode:        mode,
+		streams:     map[string]bulker.BulkerStream{},
+	}, nil
+}
+
+// schemaVersionStream routes events to streams of version-suffixed tables. See Destination.applySchemaVersion
+type schemaVersionStream struct {
+	destination *Destination
+	id          string
+	tableName   string
+	mode        bulker.BulkMode
+	streams     map[string]bulker.BulkerStream
+	// tables in order of the first event, so streams are completed in stable order
+	tables []string
+}
+
+func (s *schemaVersionStream) stream(table string) (bulker.BulkerStream, error) {
+	if stream, ok := s.streams[table]; ok {
+		return stream, nil
+	}
+	// ids of streams of versioned tables get the same version suffix
+	id := s.id + strings.TrimPrefix(table, s.tableName)
+	stream, err := s.destination.bulker.CreateStream(id, table, s.mode, s.destination.streamOptions.Options...)
+	if err != nil {
+		return nil, err
+	}
+	s.streams[table] = stream
+	s.tables = append(s.tables, table)
+	return stream, nil
+}
+
+// Consume puts object to the stream of its versioned table and returns state of that stream
+func (s *schemaVersionStream) Consume(ctx context.Context, object types.Object) (state bulker.State, processedObject types.Object, err error) {
+	stream, err := s.stream(s.destination.applySchemaVersion(s.tableName, object))
+	if err != nil {
+		return bulker.State{}, nil, err
+	}
+	return stream.Consume(ctx, object)
+}
+
+func (s *schemaVersionStream) ConsumeBatch(ctx context.Context, objects []types.Object) (state bulker.State, processedObjects []types.Object, err error) {
+	return bulker.ConsumeEach(ctx, s, objects)
+}
+
+// Complete completes streams of all tables. On failure streams of remaining tables are aborted
+func (s *schemaVersionStream) Complete(ctx context.Context) (bulker.State, error) {
+	states := make(map[string]bulker.State, len(s.tables))
+	for i, table := range s.tables {
+		state, err := s.streams[table].Complete(ctx)
+		states[table] = state
+		if err != nil {
+			for _, rest := range s.tables[i+1:] {
+				states[rest], _ = s.streams[rest].Abort(ctx)
+			}
+			merged := mergeVersionStates(states)
+			merged.Status = bulker.Failed
+			merged.SetError(err)
+			return merged, err
+		}
+	}
+	merged := mergeVersionStates(states)
+	merged.Status = bulker.Completed
+	return merged, nil
+}
+
+// Abort aborts streams of all tables
+func (s *schemaVersionStream) Abort(ctx context.Context) (bulker.State, error) {
+	states := make(map[string]bulker.State, len(s.tables))
+	var firstErr error
+	for _, table := range s.tables {
+		state, err := s.streams[table].Abort(ctx)
+		states[table] = state
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	merged := mergeVersionStates(states)
+	merged.Status = bulker.Aborted
+	return merged, firstErr
+}
+
+// mergeVersionStates sums counters of streams states. Representation is map of representations by table
+func mergeVersionStates(states map[string]bulker.State) bulker.State {
+	merged := bulker.State{}
+	representations := make(map[string]any, len(states))
+	for table, state := range states {
+		representations[table] = state.Representation
+		merged.ProcessedRows += state.ProcessedRows
+		merged.SuccessfulRows += state.SuccessfulRows
+		merged.RejectedRows += state.RejectedRows
+		merged.ProcessingTimeSec += state.ProcessingTimeSec
+	}
+	merged.Representation = representations
+	return merged
+}
@@ -0,0 +1,147 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// schemaVersionTestBulker records streams created for tables
+type schemaVersionTestBulker struct {
+	streams map[string]*schemaVersionTestStream
+}
+
+func (b *schemaVersionTestBulker) CreateStream(id, tableName string, mode bulker.BulkMode, streamOptions ...bulker.StreamOption) (bulker.BulkerStream, error) {
+	stream := &schemaVersionTestStream{id: id}
+	b.streams[tableName] = stream
+	return stream, nil
+}
+
+func (b *schemaVersionTestBulker) Close() error {
+	return nil
+}
+
+type schemaVersionTestStream struct {
+	id        string
+	consumed  []types.Object
+	completed bool
+	aborted   bool
+	fail      bool
+}
+
+func (s *schemaVersionTestStream) Consume(ctx context.Context, object types.Object) (bulker.State, types.Object, error) {
+	s.consumed = append(s.consumed, object)
+	return bulker.State{ProcessedRows: len(s.consumed), SuccessfulRows: len(s.consumed)}, object, nil
+}
+
+func (s *schemaVersionTestStream) ConsumeBatch(ctx context.Context, objects []types.Object) (bulker.State, []types.Object, error) {
+	return bulker.ConsumeEach(ctx, s, objects)
+}
+
+func (s *schemaVersionTestStream) Complete(ctx context.Context) (bulker.State, error) {
+	if s.fail {
+		return bulker.State{}, fmt.Errorf("failed to complete")
+	}
+	s.completed = true
+	return bulker.State{ProcessedRows: len(s.consumed), SuccessfulRows: len(s.consumed)}, nil
+}
+
+func (s *schemaVersionTestStream) Abort(ctx context.Context) (bulker.State, error) {
+	s.aborted = true
+	return bulker.State{ProcessedRows: len(s.consumed)}, nil
+}
+
+func schemaVersionTestDestination(b bulker.Bulker, options ...bulker.StreamOption) *Destination {
+	streamOptions := &bulker.StreamOptions{}
+	for _, option := range options {
+		streamOptions.Add(option)
+	}
+	return &Destination{bulker: b, streamOptions: streamOptions}
+}
+
+func TestVersionedTableName(t *testing.T) {
+	require.Equal(t, "events_v2", VersionedTableName("events", "2"))
+	require.Equal(t, "events_v2_0", VersionedTableName("events", "2.0"))
+	require.Equal(t, "events_v1_beta", VersionedTableName("events", "1-beta"))
+	//table that already has version suffix is not suffixed again
+	require.Equal(t, "events_v2", VersionedTableName("events_v2", "2"))
+}
+
+func TestApplySchemaVersion(t *testing.T) {
+	d := schemaVersionTestDestination(nil, bulker.WithSchemaVersionField("schema_version"),
+		bulker.WithSchemaVersionMappings(map[string]map[string]string{"2": {"user_name": "username", "legacy": ""}}))
+
+	tests := []struct {
+		name          string
+		event         types.Object
+		expectedTable string
+		expectedEvent types.Object
+	}{
+		{"no version", types.Object{"id": 1}, "events", types.Object{"id": 1}},
+		{"unsupported version type", types.Object{"schema_version": []any{1}}, "events", types.Object{"schema_version": []any{1}}},
+		{"version without mappings", types.Object{"schema_version": "1", "user_name": "john"}, "events_v1", types.Object{"schema_version": "1", "user_name": "john"}},
+		{"number version keeps representation", types.Object{"schema_version": json.Number("2.0")}, "events_v2_0", types.Object{"schema_version": json.Number("2.0")}},
+		{"mappings", types.Object{"schema_version": json.Number("2"), "user_name": "john", "legacy": true}, "events_v2",
+			types.Object{"schema_version": json.Number("2"), "username": "john"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expectedTable, d.applySchemaVersion("events", tt.event))
+			require.Equal(t, tt.expectedEvent, tt.event)
+		})
+	}
+
+	//versioning isn't configured
+	require.Equal(t, "events", schemaVersionTestDestination(nil).applySchemaVersion("events", types.Object{"schema_version": "2"}))
+}
+
+func TestSchemaVersionStream(t *testing.T) {
+	reqr := require.New(t)
+	ctx := context.Background()
+	b := &schemaVersionTestBulker{streams: map[string]*schemaVersionTestStream{}}
+	d := schemaVersionTestDestination(b, bulker.WithSchemaVersionField("schema_version"))
+
+	stream, err := d.CreateStream("topic", "events", bulker.Batch)
+	reqr.NoError(err)
+	_, processedObjects, err := stream.ConsumeBatch(ctx, []types.Object{
+		{"id": 1, "schema_version": "1"},
+		{"id": 2, "schema_version": "2"},
+		{"id": 3},
+		{"id": 4, "schema_version": "2"},
+	})
+	reqr.NoError(err)
+	reqr.Len(processedObjects, 4)
+	state, err := stream.Complete(ctx)
+	reqr.NoError(err)
+	reqr.Equal(bulker.Completed, state.Status)
+	reqr.Equal(4, state.SuccessfulRows)
+	reqr.Len(b.streams["events_v1"].consumed, 1)
+	reqr.Len(b.streams["events_v2"].consumed, 2)
+	reqr.Equal("topic_v2", b.streams["events_v2"].id)
+	reqr.Len(b.streams["events"].consumed, 1)
+	reqr.True(b.streams["events"].completed)
+
+	//failure of one table aborts the rest
+	b.streams = map[string]*schemaVersionTestStream{}
+	stream, err = d.CreateStream("topic", "events", bulker.Batch)
+	reqr.NoError(err)
+	for _, version := range []string{"1", "2"} {
+		_, _, err = stream.Consume(ctx, types.Object{"schema_version": version})
+		reqr.NoError(err)
+	}
+	b.streams["events_v1"].fail = true
+	state, err = stream.Complete(ctx)
+	reqr.Error(err)
+	reqr.Equal(bulker.Failed, state.Status)
+	reqr.True(b.streams["events_v2"].aborted)
+
+	//without versioning stream is created for the table as is
+	b.streams = map[string]*schemaVersionTestStream{}
+	_, err = schemaVersionTestDestination(b).CreateStream("topic", "events", bulker.Batch)
+	reqr.NoError(err)
+	reqr.Contains(b.streams, "events")
+}
@@ -0,0 +1,162 @@
+package app
+
+import (
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/jitsubase/appbase"
+	"github.com/jitsucom/bulker/jitsubase/safego"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StreamCheckpoint last known state of stream of connection. Mode: batch, stream or bulk
+type StreamCheckpoint struct {
+	ConnectionId string       `json:"connectionId"`
+	TableName    string       `json:"tableName"`
+	Mode         string       `json:"mode"`
+	State        bulker.State `json:"state"`
+	UpdatedAt    time.Time    `json:"updatedAt"`
+}
+
+// Key identifies stream within connection
+func (c *StreamCheckpoint) Key() string {
+	return c.Mode + "/" + c.TableName
+}
+
+// StateStore persists checkpoints of streams states so progress of connections remains visible after process restarts.
+// It also keeps manifest of files produced by file storage destinations
+type StateStore interface {
+	io.Closer
+	FileManifestStore
+	// Save replaces checkpoint of stream with the same connection id, mode and table name
+	Save(checkpoint *StreamCheckpoint) error
+	// Load returns last known checkpoints of all streams of connection
+	Load(connectionId string) ([]*StreamCheckpoint, error)
+}
+
+// NewStateStore creates StateStore according to STATE_STORE setting. Returns nil if state store is not configured
+func NewStateStore(config *Config) (StateStore, error) {
+	storeUrl := config.StateStore
+	switch {
+	case storeUrl == "":
+		return nil, nil
+	case strings.HasPrefix(storeUrl, "redis://") || strings.HasPrefix(storeUrl, "rediss://"):
+		return NewRedisStateStore(storeUrl, config.RedisTLS())
+	case strings.HasPrefix(storeUrl, "postgres://") || strings.HasPrefix(storeUrl, "postgresql://"):
+		return NewPostgresStateStore(storeUrl)
+	case strings.HasPrefix(storeUrl, "file://"):
+		return NewFileStateStore(strings.TrimPrefix(storeUrl, "file://"))
+	case strings.HasPrefix(storeUrl, "/"):
+		return NewFileStateStore(storeUrl)
+	default:
+		return nil, fmt.Errorf("unsupported STATE_STORE: %s. Supported: redis://, postgres://, file:// URLs", storeUrl)
+	}
+}
+
+// StateCheckpointer keeps the latest states of streams in memory and periodically persists changed ones to StateStore.
+// All methods are safe to call on nil StateCheckpointer: states are not persisted then
+type StateCheckpointer struct {
+	sync.Mutex
+	appbase.Service
+	store   StateStore
+	pending map[string]*StreamCheckpoint
+	closed  chan struct{}
+	flushed chan struct{}
+}
+
+func NewStateCheckpointer(store StateStore, periodSec int) *StateCheckpointer {
+	sc := &StateCheckpointer{
+		Service: appbase.NewServiceBase("state-checkpointer"),
+		store:   store,
+		pending: map[string]*StreamCheckpoint{},
+		closed:  make(chan struct{}),
+		flushed: make(chan struct{}),
+	}
+	safego.RunWithRestart(func() {
+		ticker := time.NewTicker(time.Duration(periodSec) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-sc.closed:
+				sc.flush()
+				close(sc.flushed)
+				return
+			case <-ticker.C:
+				sc.flush()
+			}
+		}
+	})
+	return sc
+}
+
+// Checkpoint records the latest state of stream. State is persisted on the next flush
+func (sc *StateCheckpointer) Checkpoint(connectionId, tableName, mode string, state bulker.State) {
+	if sc == nil {
+		return
+	}
+	if state.LastError != nil && state.LastErrorText == "" {
+		state.LastErrorText = state.LastError.Error()
+	}
+	checkpoint := &StreamCheckpoint{ConnectionId: connectionId, TableName: tableName, Mode: mode, State: state, UpdatedAt: time.Now().UTC()}
+	sc.Lock()
+	sc.pending[connectionId+"/"+checkpoint.Key()] = checkpoint
+	sc.Unlock()
+}
+
+// Load returns the last known checkpoints of all streams of connection including not yet persisted ones
+func (sc *StateCheckpointer) Load(connectionId string) ([]*StreamCheckpoint, error) {
+	stored, err := sc.store.Load(connectionId)
+	if err != nil {
+		return nil, err
+	}
+	checkpoints := make(map[string]*StreamCheckpoint, len(stored))
+	for _, checkpoint := range stored {
+		checkpoints[checkpoint.Key()] = checkpoint
+	}
+	sc.Lock()
+	for _, checkpoint := range sc.pending {
+		if checkpoint.ConnectionId == connectionId {
+			checkpoints[checkpoint.Key()] = checkpoint
+		}
+	}
+	sc.Unlock()
+	result := make([]*StreamCheckpoint, 0, len(checkpoints))
+	for _, checkpoint := range checkpoints {
+		result = append(result, checkpoint)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Key() < result[j].Key()
+	})
+	return result, nil
+}
+
+func (sc *StateCheckpointer) flush() {
+	sc.Lock()
+	pending := sc.pending
+	sc.pending = map[string]*StreamCheckpoint{}
+	sc.Unlock()
+	for key, checkpoint := range pending {
+		if err := sc.store.Save(checkpoint); err != nil {
+			sc.Errorf("Failed to save checkpoint of %s: %v", key, err)
+			// keep checkpoint for the next flush unless it was replaced by newer one
+			sc.Lock()
+			if _, ok := sc.pending[key]; !ok {
+				sc.pending[key] = checkpoint
+			}
+			sc.Unlock()
+		}
+	}
+}
+
+// Close persists pending checkpoints and closes state store
+func (sc *StateCheckpointer) Close() error {
+	if sc == nil {
+		return nil
+	}
+	close(sc.closed)
+	<-sc.flushed
+	return sc.store.Close()
+}
@@ -29,7 +29,8 @@ type StreamConsumerImpl struct {
 	consumerConfig kafka.ConfigMap
 	consumer       *kafka.Consumer
 
-	eventsLogService eventslog.EventsLogService
+	eventsLogService  eventslog.EventsLogService
+	stateCheckpointer *StateCheckpointer
 
 	tableName string
 
@@ -39,26 +40,25 @@ type StreamConsumerImpl struct {
 type StreamConsumer interface {
 	Consumer
 	UpdateDestination(destination *Destination) error
+	Status() ConsumerStatus
 }
 
-func NewStreamConsumer(repository *Repository, destination *Destination, topicId string, config *Config, kafkaConfig *kafka.ConfigMap, bulkerProducer *Producer, eventsLogService eventslog.EventsLogService) (*StreamConsumerImpl, error) {
-	abstract := NewAbstractConsumer(config, repository, topicId, bulkerProducer)
+func NewStreamConsumer(repository *Repository, destination *Destination, topicId string, config *Config, kafkaConfig *kafka.ConfigMap, bulkerProducer *Producer, eventsLogService eventslog.EventsLogService, stateCheckpointer *StateCheckpointer) (*StreamConsumerImpl, error) {
+	groupSettings := NewConsumerGroupSettings(config, destination.streamOptions, topicId, false)
+	abstract := NewAbstractConsumer(config, repository, topicId, bulkerProducer, groupSettings)
 	_, _, tableName, err := ParseTopicId(topicId)
 	if err != nil {
 		metrics.ConsumerErrors(topicId, "stream", "INVALID_TOPIC", "INVALID_TOPIC:"+topicId, "failed to parse topic").Inc()
 		return nil, abstract.NewError("Failed to parse topic: %v", err)
 	}
-	consumerConfig := kafka.ConfigMap(utils.MapPutAll(kafka.ConfigMap{
-		"group.id":                      topicId,
-		"auto.offset.reset":             "earliest",
+	consumerConfig := kafka.ConfigMap(utils.MapPutAll(utils.MapPutAll(kafka.ConfigMap{
 		"allow.auto.create.topics":      false,
 		"group.instance.id":             abstract.GetInstanceId(),
 		"partition.assignment.strategy": config.KafkaConsumerPartitionsAssigmentStrategy,
 		"enable.auto.commit":            true,
 		"isolation.level":               "read_committed",
 		"session.timeout.ms":            config.KafkaSessionTimeoutMs,
-		"max.poll.interval.ms":          config.KafkaMaxPollIntervalMs,
-	}, *kafkaConfig))
+	}, groupSettings.configMap()), *kafkaConfig))
 
 	consumer, err := kafka.NewConsumer(&consumerConfig)
 	if err != nil {
@@ -79,14 +79,15 @@ func NewStreamConsumer(repository *Repository, destination *Destination, topicId
 	//}
 
 	sc := &StreamConsumerImpl{
-		AbstractConsumer: abstract,
-		repository:       repository,
-		destination:      destination,
-		tableName:        tableName,
-		consumerConfig:   consumerConfig,
-		consumer:         consumer,
-		eventsLogService: eventsLogService,
-		closed:           make(chan struct{}),
+		AbstractConsumer:  abstract,
+		repository:        repository,
+		destination:       destination,
+		tableName:         tableName,
+		consumerConfig:    consumerConfig,
+		consumer:          consumer,
+		eventsLogService:  eventsLogService,
+		stateCheckpointer: stateCheckpointer,
+		closed:            make(chan struct{}),
 	}
 	var bs bulker.BulkerStream
 	bs = &StreamWrapper{destination: destination, topicId: topicId, tableName: tableName}
@@ -106,7 +107,7 @@ func (sw *StreamWrapper) Consume(ctx context.Context, object types.Object) (stat
 	if sw.stream == nil {
 		sw.destination.Lease()
 		sw.destination.InitBulkerInstance()
-		bulkerStream, err := sw.destination.bulker.CreateStream(sw.topicId, sw.tableName, bulker.Stream, sw.destination.streamOptions.Options...)
+		bulkerStream, err := sw.destination.CreateStream(sw.topicId, sw.tableName, bulker.Stream)
 		if err != nil {
 			metrics.ConsumerErrors(sw.topicId, "stream", sw.destination.Id(), sw.tableName, "failed to create bulker stream").Inc()
 			return bulker.State{}, nil, fmt.Errorf("Failed to create bulker stream: %v", err)
@@ -116,6 +117,10 @@ func (sw *StreamWrapper) Consume(ctx context.Context, object types.Object) (stat
 	return sw.stream.Consume(ctx, object)
 }
 
+func (sw *StreamWrapper) ConsumeBatch(ctx context.Context, objects []types.Object) (state bulker.State, processedObjects []types.Object, err error) {
+	return bulker.ConsumeEach(ctx, sw, objects)
+}
+
 func (sw *StreamWrapper) Abort(ctx context.Context) (bulker.State, error) {
 	if sw.stream == nil {
 		return bulker.State{}, nil
@@ -202,77 +207,120 @@ func (sc *StreamConsumerImpl) start() {
 					continue
 				}
 				metricsMeta := kafkabase.GetKafkaHeader(message, MetricsMetaHeader)
-				metrics.ConsumerMessages(sc.topicId, "stream", sc.destination.Id(), sc.tableName, "consumed").Inc()
-				obj := types.Object{}
-				dec := jsoniter.NewDecoder(bytes.NewReader(message.Value))
-				dec.UseNumber()
-				err = dec.Decode(&obj)
-				if err != nil {
-					metrics.ConsumerErrors(sc.topicId, "stream", sc.destination.Id(), sc.tableName, "parse_event_error").Inc()
-					sc.postEventsLog(message.Value, nil, nil, err)
-					sc.Errorf("Failed to parse event from message: %s offset: %s: %v", message.Value, message.TopicPartition.Offset.String(), err)
-				} else {
-					sc.Debugf("Consumed Message ID: %s Offset: %s (Retries: %s) for: %s", obj.Id(), message.TopicPartition.Offset.String(), kafkabase.GetKafkaHeader(message, retriesCountHeader), sc.destination.config.BulkerType)
-					var state bulker.State
-					var processedObject types.Object
-					state, processedObject, err = (*sc.stream.Load()).Consume(context.Background(), obj)
-					sc.postEventsLog(message.Value, state.Representation, processedObject, err)
-					if err != nil {
-						metrics.ConsumerErrors(sc.topicId, "stream", sc.destination.Id(), sc.tableName, "bulker_stream_error").Inc()
-						sc.Errorf("Failed to inject event to bulker stream: %v", err)
-					} else {
-						sc.SendMetrics(metricsMeta, "success", 1)
-						metrics.ConsumerMessages(sc.topicId, "stream", sc.destination.Id(), sc.tableName, "processed").Inc()
-					}
+				var events [][]byte
+				if err = kafkabase.CheckEnvelopeVersion(message); err != nil {
+					// message produced by newer release during rolling upgrade goes to retry topic and waits for upgraded instance
+					metrics.ConsumerMessages(sc.topicId, "stream", sc.destination.Id(), sc.tableName, "consumed").Inc()
+					metrics.ConsumerErrors(sc.topicId, "stream", sc.destination.Id(), sc.tableName, "envelope_version_error").Inc()
+					sc.Errorf("Failed to process message offset: %s: %v", message.TopicPartition.Offset.String(), err)
+					sc.retryMessage(message, metricsMeta, err)
+					continue
 				}
-				if err != nil {
-					originalError := err
-					failedTopic, _ := MakeTopicId(sc.destination.Id(), retryTopicMode, allTablesToken, false)
-					retries, err := kafkabase.GetKafkaIntHeader(message, retriesCountHeader)
-					if err != nil {
-						sc.Errorf("failed to read retry header: %v", err)
-					}
-					metricStatus := "error"
-					if retries > 0 {
-						metricStatus = "retry_error"
-					}
-					sc.SendMetrics(metricsMeta, metricStatus, 1)
-					status := "retryScheduled"
-					if retries >= sc.config.MessagesRetryCount {
-						//no attempts left - send to dead-letter topic
-						status = "deadLettered"
-						failedTopic, _ = MakeTopicId(sc.destination.Id(), deadTopicMode, allTablesToken, false)
-					}
-					headers := message.Headers
-					kafkabase.PutKafkaHeader(&headers, errorHeader, originalError.Error())
-					kafkabase.PutKafkaHeader(&headers, originalTopicHeader, sc.topicId)
-					kafkabase.PutKafkaHeader(&headers, retriesCountHeader, strconv.Itoa(retries))
-					kafkabase.PutKafkaHeader(&headers, retryTimeHeader, timestamp.ToISOFormat(RetryBackOffTime(sc.config, retries+1).UTC()))
-					retryMessage := kafka.Message{
-						Key:            message.Key,
-						TopicPartition: kafka.TopicPartition{Topic: &failedTopic, Partition: kafka.PartitionAny},
-						Headers:        headers,
-						Value:          message.Value,
-					}
-					err = sc.bulkerProducer.ProduceSync(failedTopic, retryMessage)
-					if err != nil {
-						sc.Errorf("failed to store event to 'failed' topic: %s: %v", failedTopic, err)
-						metrics.ConsumerMessages(sc.topicId, "stream", sc.destination.Id(), sc.tableName, "LOST").Inc()
-						continue
+				if events, err = kafkabase.UnpackEvents(message); err != nil {
+					metrics.ConsumerMessages(sc.topicId, "stream", sc.destination.Id(), sc.tableName, "consumed").Inc()
+					metrics.ConsumerErrors(sc.topicId, "stream", sc.destination.Id(), sc.tableName, "unpack_frame_error").Inc()
+					sc.Errorf("Failed to unpack frame offset: %s: %v", message.TopicPartition.Offset.String(), err)
+					sc.retryMessage(message, metricsMeta, err)
+					continue
+				}
+				// events of frame are processed and retried individually
+				for _, event := range events {
+					eventMessage := kafkabase.FrameEventMessage(message, event)
+					if err = sc.processEvent(eventMessage, metricsMeta); err != nil {
+						sc.retryMessage(eventMessage, metricsMeta, err)
 					}
-					metrics.ConsumerMessages(sc.topicId, "stream", sc.destination.Id(), sc.tableName, "failed").Inc()
-					metrics.ConsumerMessages(sc.topicId, "stream", sc.destination.Id(), sc.tableName, status).Inc()
 				}
-
 			}
 		}
 	})
 }
 
+// processEvent consumes event of message to bulker stream
+func (sc *StreamConsumerImpl) processEvent(message *kafka.Message, metricsMeta string) (err error) {
+	metrics.ConsumerMessages(sc.topicId, "stream", sc.destination.Id(), sc.tableName, "consumed").Inc()
+	obj := types.Object{}
+	dec := jsoniter.NewDecoder(bytes.NewReader(message.Value))
+	dec.UseNumber()
+	if err = dec.Decode(&obj); err != nil {
+		metrics.ConsumerErrors(sc.topicId, "stream", sc.destination.Id(), sc.tableName, "parse_event_error").Inc()
+		sc.postEventsLog(message.Value, nil, nil, err)
+		sc.Errorf("Failed to parse event from message: %s offset: %s: %v", message.Value, message.TopicPartition.Offset.String(), err)
+		return err
+	}
+	sc.Debugf("Consumed Message ID: %s Offset: %s (Retries: %s) for: %s", obj.Id(), message.TopicPartition.Offset.String(), kafkabase.GetKafkaHeader(message, retriesCountHeader), sc.destination.config.BulkerType)
+	var state bulker.State
+	var processedObject types.Object
+	state, processedObject, err = (*sc.stream.Load()).Consume(context.Background(), obj)
+	sc.postEventsLog(message.Value, state.Representation, processedObject, err)
+	if err != nil && state.LastError == nil {
+		state.SetError(err)
+	}
+	sc.stateCheckpointer.Checkpoint(sc.destination.Id(), sc.tableName, "stream", state)
+	if err != nil {
+		metrics.ConsumerErrors(sc.topicId, "stream", sc.destination.Id(), sc.tableName, "bulker_stream_error").Inc()
+		sc.Errorf("Failed to inject event to bulker stream: %v", err)
+		return err
+	}
+	sc.SendMetrics(metricsMeta, "success", 1)
+	metrics.ConsumerMessages(sc.topicId, "stream", sc.destination.Id(), sc.tableName, "processed").Inc()
+	return nil
+}
+
+// retryMessage sends failed message to retry topic or to dead-letter topic if no attempts left
+func (sc *StreamConsumerImpl) retryMessage(message *kafka.Message, metricsMeta string, originalError error) {
+	failedTopic, _ := MakeTopicId(sc.destination.Id(), retryTopicMode, allTablesToken, false)
+	retries, err := kafkabase.GetKafkaIntHeader(message, retriesCountHeader)
+	if err != nil {
+		sc.Errorf("failed to read retry header: %v", err)
+	}
+	metricStatus := "error"
+	if retries > 0 {
+		metricStatus = "retry_error"
+	}
+	sc.SendMetrics(metricsMeta, metricStatus, 1)
+	status := "retryScheduled"
+	if (retries >= sc.config.MessagesRetryCount && !kafkabase.EnvelopeVersionTooNew(message)) || bulker.IsRejectedObjectError(originalError) {
+		//no attempts left or event was rejected - send to dead-letter topic
+		status = "deadLettered"
+		failedTopic, _ = MakeTopicId(sc.destination.Id(), deadTopicMode, allTablesToken, false)
+	}
+	headers := message.Headers
+	kafkabase.PutKafkaHeader(&headers, errorHeader, originalError.Error())
+	kafkabase.PutKafkaHeader(&headers, originalTopicHeader, sc.topicId)
+	kafkabase.PutKafkaHeader(&headers, retriesCountHeader, strconv.Itoa(retries))
+	kafkabase.PutKafkaHeader(&headers, retryTimeHeader, timestamp.ToISOFormat(RetryBackOffTime(sc.config, retries+1).UTC()))
+	retryMessage := kafka.Message{
+		Key:            message.Key,
+		TopicPartition: kafka.TopicPartition{Topic: &failedTopic, Partition: kafka.PartitionAny},
+		Headers:        headers,
+		Value:          message.Value,
+	}
+	err = sc.bulkerProducer.ProduceSync(failedTopic, retryMessage)
+	if err != nil {
+		sc.Errorf("failed to store event to 'failed' topic: %s: %v", failedTopic, err)
+		metrics.ConsumerMessages(sc.topicId, "stream", sc.destination.Id(), sc.tableName, "LOST").Inc()
+		return
+	}
+	metrics.ConsumerMessages(sc.topicId, "stream", sc.destination.Id(), sc.tableName, "failed").Inc()
+	metrics.ConsumerMessages(sc.topicId, "stream", sc.destination.Id(), sc.tableName, status).Inc()
+}
+
 func (sc *StreamConsumerImpl) TopicId() string {
 	return sc.topicId
 }
 
+// Status returns status of consumer. Stream consumer is running until retired
+func (sc *StreamConsumerImpl) Status() ConsumerStatus {
+	status := ConsumerStatus{Mode: "stream", GroupId: sc.groupSettings.GroupId, Running: true}
+	select {
+	case <-sc.closed:
+		status.Running = false
+		status.Retired = true
+	default:
+	}
+	return status
+}
+
 // Close consumer
 func (sc *StreamConsumerImpl) Retire() {
 	select {
@@ -56,11 +56,12 @@ type TopicManager struct {
 	retryConsumers  map[string][]BatchConsumer
 	streamConsumers map[string][]StreamConsumer
 
-	batchProducer    *Producer
-	streamProducer   *Producer
-	eventsLogService eventslog.EventsLogService
-	refreshChan      chan bool
-	closed           chan struct{}
+	batchProducer     *Producer
+	streamProducer    *Producer
+	eventsLogService  eventslog.EventsLogService
+	stateCheckpointer *StateCheckpointer
+	refreshChan       chan bool
+	closed            chan struct{}
 }
 
 // NewTopicManager returns TopicManager
@@ -84,6 +85,7 @@ func NewTopicManager(appContext *Context) (*TopicManager, error) {
 		batchProducer:        appContext.batchProducer,
 		streamProducer:       appContext.streamProducer,
 		eventsLogService:     appContext.eventsLogService,
+		stateCheckpointer:    appContext.stateCheckpointer,
 		batchConsumers:       make(map[string][]BatchConsumer),
 		retryConsumers:       make(map[string][]BatchConsumer),
 		streamConsumers:      make(map[string][]StreamConsumer),
@@ -218,7 +220,7 @@ func (tm *TopicManager) processMetadata(metadata *kafka.Metadata, nonEmptyTopics
 				}
 				switch mode {
 				case "stream":
-					streamConsumer, err := NewStreamConsumer(tm.repository, destination, topic, tm.config, tm.kafkaConfig, tm.streamProducer, tm.eventsLogService)
+					streamConsumer, err := NewStreamConsumer(tm.repository, destination, topic, tm.config, tm.kafkaConfig, tm.streamProducer, tm.eventsLogService, tm.stateCheckpointer)
 					if err != nil {
 						topicsErrorsByMode[mode]++
 						tm.SystemErrorf("Failed to create consumer for destination topic: %s: %v", topic, err)
@@ -228,7 +230,7 @@ func (tm *TopicManager) processMetadata(metadata *kafka.Metadata, nonEmptyTopics
 					}
 					tm.streamConsumers[destinationId] = append(tm.streamConsumers[destinationId], streamConsumer)
 				case "batch":
-					batchPeriodSec := utils.Nvl(int(bulker.BatchFrequencyOption.Get(destination.streamOptions)*60), tm.config.BatchRunnerPeriodSec)
+					triggers := NewBatchTriggers(tm.config, destination.streamOptions)
 					// check topic partitions count
 					var err error
 					if len(topicMetadata.Partitions) > 1 {
@@ -237,7 +239,7 @@ func (tm *TopicManager) processMetadata(metadata *kafka.Metadata, nonEmptyTopics
 					}
 					var batchConsumer *BatchConsumerImpl
 					if err == nil {
-						batchConsumer, err = NewBatchConsumer(tm.repository, destinationId, batchPeriodSec, topic, tm.config, tm.kafkaConfig, tm.batchProducer, tm.eventsLogService)
+						batchConsumer, err = NewBatchConsumer(tm.repository, destinationId, triggers, topic, tm.config, tm.kafkaConfig, tm.batchProducer, tm.eventsLogService, tm.stateCheckpointer)
 					}
 					if err != nil {
 						topicsErrorsByMode[mode]++
@@ -245,14 +247,14 @@ func (tm *TopicManager) processMetadata(metadata *kafka.Metadata, nonEmptyTopics
 						continue
 					}
 					tm.batchConsumers[destinationId] = append(tm.batchConsumers[destinationId], batchConsumer)
-					_, err = tm.cron.AddBatchConsumer(batchConsumer)
+					err = tm.cron.AddBatchConsumer(batchConsumer)
 					if err != nil {
 						topicsErrorsByMode[mode]++
 						batchConsumer.Retire()
 						tm.Errorf("Failed to schedule consumer for destination topic: %s: %v", topic, err)
 						continue
 					} else {
-						tm.Infof("Consumer for destination topic %s was scheduled with batch period %ds.", topic, batchConsumer.BatchPeriodSec())
+						tm.Infof("Consumer for destination topic %s was scheduled with batch triggers: %s.", topic, batchConsumer.Triggers())
 					}
 				case retryTopicMode:
 					retryPeriodSec := utils.Nvl(int(bulker.RetryFrequencyOption.Get(destination.streamOptions)*60), tm.config.BatchRunnerRetryPeriodSec)
@@ -271,14 +273,14 @@ func (tm *TopicManager) processMetadata(metadata *kafka.Metadata, nonEmptyTopics
 						continue
 					}
 					tm.retryConsumers[destinationId] = append(tm.retryConsumers[destinationId], retryConsumer)
-					_, err = tm.cron.AddBatchConsumer(retryConsumer)
+					err = tm.cron.AddBatchConsumer(retryConsumer)
 					if err != nil {
 						topicsErrorsByMode[mode]++
 						retryConsumer.Retire()
 						tm.Errorf("Failed to schedule retry consumer for destination topic: %s: %v", topic, err)
 						continue
 					} else {
-						tm.Infof("Retry consumer for destination topic %s was scheduled with batch period %ds", topic, retryConsumer.BatchPeriodSec())
+						tm.Infof("Retry consumer for destination topic %s was scheduled with batch period %ds", topic, retryConsumer.Triggers().PeriodSec)
 					}
 				case deadTopicMode:
 					tm.Debugf("Found topic %s for 'dead' events", topic)
@@ -378,12 +380,12 @@ func (tm *TopicManager) processMetadata(metadata *kafka.Metadata, nonEmptyTopics
 			tm.SystemErrorf("Failed to create retry consumer for destination topic: %s: %v", destinationsRetryTopicName, err)
 		} else {
 			tm.retryConsumers[destinationsRetryTopicName] = append(tm.retryConsumers[destinationsRetryTopicName], retryConsumer)
-			_, err = tm.cron.AddBatchConsumer(retryConsumer)
+			err = tm.cron.AddBatchConsumer(retryConsumer)
 			if err != nil {
 				retryConsumer.Retire()
 				tm.SystemErrorf("Failed to schedule retry consumer for destination topic: %s: %v", destinationsRetryTopicName, err)
 			} else {
-				tm.Infof("Retry consumer for destination topic %s was scheduled with batch period %ds", destinationsRetryTopicName, retryConsumer.BatchPeriodSec())
+				tm.Infof("Retry consumer for destination topic %s was scheduled with batch period %ds", destinationsRetryTopicName, retryConsumer.Triggers().PeriodSec)
 			}
 		}
 	}
@@ -419,35 +421,60 @@ func ExcludeConsumerForTopic[T Consumer](consumers []T, topicId string, cron *Cr
 	return newConsumers
 }
 
+// excludeConsumersWithChangedGroup retires consumers which consumer group settings differ from settings of changed destination.
+// Topics of retired consumers are forgotten so consumers are recreated on the next topics refresh
+func excludeConsumersWithChangedGroup[T Consumer](tm *TopicManager, consumers []T, destination *Destination) []T {
+	newConsumers := make([]T, 0, len(consumers))
+	for _, consumer := range consumers {
+		_, mode, _, _ := ParseTopicId(consumer.TopicId())
+		if consumer.GroupSettings() == NewConsumerGroupSettings(tm.config, destination.streamOptions, consumer.TopicId(), mode == retryTopicMode) {
+			newConsumers = append(newConsumers, consumer)
+			continue
+		}
+		tm.Infof("Consumer group settings for destination topic %s were changed. Consumer will be re-created", consumer.TopicId())
+		if batchConsumer, ok := any(consumer).(BatchConsumer); ok {
+			tm.cron.RemoveBatchConsumer(batchConsumer)
+		}
+		consumer.Retire()
+		if dstTopics, ok := tm.destinationTopics[destination.Id()]; ok {
+			dstTopics.Remove(consumer.TopicId())
+		}
+	}
+	return newConsumers
+}
+
 func (tm *TopicManager) changeListener(changes RepositoryChange) {
 	for _, changedDst := range changes.ChangedDestinations {
 		tm.Lock()
+		tm.batchConsumers[changedDst.Id()] = excludeConsumersWithChangedGroup(tm, tm.batchConsumers[changedDst.Id()], changedDst)
+		tm.retryConsumers[changedDst.Id()] = excludeConsumersWithChangedGroup(tm, tm.retryConsumers[changedDst.Id()], changedDst)
+		tm.streamConsumers[changedDst.Id()] = excludeConsumersWithChangedGroup(tm, tm.streamConsumers[changedDst.Id()], changedDst)
 		for _, consumer := range tm.batchConsumers[changedDst.Id()] {
-			batchPeriodSec := utils.Nvl(int(bulker.BatchFrequencyOption.Get(changedDst.streamOptions)*60), tm.config.BatchRunnerPeriodSec)
-			if consumer.BatchPeriodSec() != batchPeriodSec {
-				consumer.UpdateBatchPeriod(batchPeriodSec)
-				_, err := tm.cron.ReplaceBatchConsumer(consumer)
+			triggers := NewBatchTriggers(tm.config, changedDst.streamOptions)
+			if consumer.Triggers() != triggers {
+				consumer.UpdateTriggers(triggers)
+				err := tm.cron.ReplaceBatchConsumer(consumer)
 				if err != nil {
 					metrics.TopicManagerError("reschedule_batch_consumer_error").Inc()
 					consumer.Retire()
 					tm.SystemErrorf("Failed to re-schedule consumer for destination topic: %s: %v", consumer.TopicId(), err)
 					continue
 				}
-				tm.Infof("Consumer for destination topic %s was re-scheduled with new batch period %d", consumer.TopicId(), consumer.BatchPeriodSec())
+				tm.Infof("Consumer for destination topic %s was re-scheduled with new batch triggers: %s", consumer.TopicId(), consumer.Triggers())
 			}
 		}
 		for _, consumer := range tm.retryConsumers[changedDst.Id()] {
 			retryPeriodSec := utils.Nvl(int(bulker.RetryFrequencyOption.Get(changedDst.streamOptions)*60), tm.config.BatchRunnerRetryPeriodSec)
-			if consumer.BatchPeriodSec() != retryPeriodSec {
-				consumer.UpdateBatchPeriod(retryPeriodSec)
-				_, err := tm.cron.ReplaceBatchConsumer(consumer)
+			if consumer.Triggers().PeriodSec != retryPeriodSec {
+				consumer.UpdateTriggers(BatchTriggers{PeriodSec: retryPeriodSec})
+				err := tm.cron.ReplaceBatchConsumer(consumer)
 				if err != nil {
 					metrics.TopicManagerError("reschedule_batch_consumer_error").Inc()
 					consumer.Retire()
 					tm.SystemErrorf("Failed to re-schedule consumer for destination topic: %s: %v", consumer.TopicId(), err)
 					continue
 				}
-				tm.Infof("Consumer for destination topic %s was re-scheduled with new batch period %d", consumer.TopicId(), consumer.BatchPeriodSec())
+				tm.Infof("Consumer for destination topic %s was re-scheduled with new batch period %d", consumer.TopicId(), consumer.Triggers().PeriodSec)
 			}
 		}
 		for _, consumer := range tm.streamConsumers[changedDst.Id()] {
@@ -0,0 +1,148 @@
+package app
+
+import (
+	"sort"
+	"time"
+)
+
+// Topology destinations, their topics and consumers that instance currently operates on. Served by /topology endpoint for monitoring dashboards
+type Topology struct {
+	// Shard number of instance. Instance runs consumers only for topics of its shard
+	Shard        int                    `json:"shard"`
+	Destinations []*DestinationTopology `json:"destinations"`
+	// LagUpdatedAt time of the latest lag measurement. Lags are measured only when autoscaling is enabled
+	LagUpdatedAt *time.Time `json:"lagUpdatedAt,omitempty"`
+	GeneratedAt  time.Time  `json:"generatedAt"`
+}
+
+// DestinationTopology destination with its topics
+type DestinationTopology struct {
+	Id          string `json:"id"`
+	Type        string `json:"type"`
+	WorkspaceId string `json:"workspaceId,omitempty"`
+	Mode        string `json:"mode,omitempty"`
+	UpdatedAt   string `json:"updatedAt,omitempty"`
+	// Error of destination initialization, e.g. secrets resolution error
+	Error string          `json:"error,omitempty"`
+	Lag   *DestinationLag `json:"lag,omitempty"`
+	// InFlightEvents events consumed by batch consumers and not yet committed to destination
+	InFlightEvents int64            `json:"inFlightEvents"`
+	Topics         []*TopicTopology `json:"topics"`
+}
+
+// TopicTopology topic of destination and consumers of the topic running on instance
+type TopicTopology struct {
+	Topic     string `json:"topic"`
+	Mode      string `json:"mode"`
+	TableName string `json:"tableName"`
+	// Lag messages not yet processed by consumers. For retry topics – depth of retry queue
+	Lag          *int64           `json:"lag,omitempty"`
+	LastActiveAt *time.Time       `json:"lastActiveAt,omitempty"`
+	Consumers    []ConsumerStatus `json:"consumers,omitempty"`
+}
+
+// ConsumerStatus status of consumer
+type ConsumerStatus struct {
+	Mode    string `json:"mode"`
+	GroupId string `json:"groupId"`
+	// Running consumer is processing batch right now
+	Running bool `json:"running"`
+	Paused  bool `json:"paused"`
+	Retired bool `json:"retired"`
+	// LastRun outcome of the latest batch run that consumed messages
+	LastRun *BatchRun `json:"lastRun,omitempty"`
+}
+
+// BatchRun outcome of batch consumer run
+type BatchRun struct {
+	FinishedAt     time.Time `json:"finishedAt"`
+	Status         string    `json:"status"`
+	Error          string    `json:"error,omitempty"`
+	Consumed       int       `json:"consumed"`
+	Processed      int       `json:"processed"`
+	Skipped        int       `json:"skipped,omitempty"`
+	Failed         int       `json:"failed,omitempty"`
+	RetryScheduled int       `json:"retryScheduled,omitempty"`
+	DeadLettered   int       `json:"deadLettered,omitempty"`
+}
+
+// newBatchRun returns outcome of batch consumer run
+func newBatchRun(counters BatchCounters, err error) *BatchRun {
+	run := &BatchRun{
+		FinishedAt:     time.Now().UTC(),
+		Status:         "success",
+		Consumed:       counters.consumed,
+		Processed:      counters.processed,
+		Skipped:        counters.skipped,
+		Failed:         counters.failed,
+		RetryScheduled: counters.retryScheduled,
+		DeadLettered:   counters.deadLettered,
+	}
+	if err != nil {
+		run.Status = "fail"
+		run.Error = err.Error()
+	}
+	return run
+}
+
+// Topology returns destinations of repository with their topics and consumers running on instance.
+// signals provides lags of topics, nil if lag isn't measured
+func (tm *TopicManager) Topology(signals *AutoscalingSignals) *Topology {
+	tm.Lock()
+	defer tm.Unlock()
+	topology := &Topology{Shard: tm.shardNumber, GeneratedAt: time.Now().UTC()}
+	if signals != nil {
+		topology.LagUpdatedAt = &signals.UpdatedAt
+	}
+	for _, destination := range tm.repository.GetDestinations() {
+		cfg := destination.config
+		dt := &DestinationTopology{
+			Id:          destination.Id(),
+			Type:        cfg.BulkerType,
+			WorkspaceId: cfg.WorkspaceId,
+			Mode:        string(destination.Mode()),
+			Topics:      []*TopicTopology{},
+			// in-flight events are counted only for consumers running on instance
+			InFlightEvents: tm.repository.InFlightEvents(destination.Id()).Load(),
+		}
+		if !cfg.UpdatedAt.IsZero() {
+			dt.UpdatedAt = cfg.UpdatedAt.Format(time.RFC3339)
+		}
+		if destination.secretsErr != nil {
+			dt.Error = destination.secretsErr.Error()
+		}
+		if signals != nil {
+			if lag, ok := signals.Destinations[dt.Id]; ok {
+				dt.Lag = &lag
+			}
+		}
+		consumers := map[string][]ConsumerStatus{}
+		for _, consumer := range tm.batchConsumers[dt.Id] {
+			consumers[consumer.TopicId()] = append(consumers[consumer.TopicId()], consumer.Status())
+		}
+		for _, consumer := range tm.retryConsumers[dt.Id] {
+			consumers[consumer.TopicId()] = append(consumers[consumer.TopicId()], consumer.Status())
+		}
+		for _, consumer := range tm.streamConsumers[dt.Id] {
+			consumers[consumer.TopicId()] = append(consumers[consumer.TopicId()], consumer.Status())
+		}
+		for topic := range tm.destinationTopics[dt.Id] {
+			_, mode, tableName, _ := ParseTopicId(topic)
+			tt := &TopicTopology{Topic: topic, Mode: mode, TableName: tableName, LastActiveAt: tm.topicLastActiveDate[topic], Consumers: consumers[topic]}
+			if signals != nil {
+				if lag, ok := signals.Topics[topic]; ok {
+					tt.Lag = &lag
+				}
+			}
+			dt.Topics = append(dt.Topics, tt)
+		}
+		sort.Slice(dt.Topics, func(i, j int) bool {
+			return dt.Topics[i].Topic < dt.Topics[j].Topic
+		})
+		topology.Destinations = append(topology.Destinations, dt)
+	}
+	sort.Slice(topology.Destinations, func(i, j int) bool {
+		return topology.Destinations[i].Id < topology.Destinations[j].Id
+	})
+	return topology
+}
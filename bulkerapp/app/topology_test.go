@@ -0,0 +1,99 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTopologyHandler(t *testing.T) {
+	reqr := require.New(t)
+	request := func(router *Router) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.Engine().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/topology", nil))
+		return w
+	}
+
+	//instance without topic manager doesn't run consumers
+	w := request(NewRouter(&Context{config: &Config{}}))
+	reqr.Equal(http.StatusNotFound, w.Code)
+
+	const batchTopic, retryTopic = "in.id.d1.m.batch.t.events", "in.id.d1.m.retry.t.events"
+	repository := &Repository{}
+	destination := consumerGroupTestDestination(t, nil)
+	destination.config.BulkerType = "postgres"
+	destination.config.WorkspaceId = "w1"
+	repository.repository.Store(&repositoryInternal{destinations: map[string]*Destination{"d1": destination}})
+	repository.InFlightEvents("d1").Store(7)
+
+	batchConsumer := &BatchConsumerImpl{AbstractBatchConsumer: &AbstractBatchConsumer{
+		AbstractConsumer: &AbstractConsumer{topicId: batchTopic, groupSettings: ConsumerGroupSettings{GroupId: batchTopic}},
+		mode:             "batch",
+	}}
+	batchConsumer.paused.Store(true)
+	batchConsumer.lastRun.Store(newBatchRun(BatchCounters{consumed: 10, processed: 8, failed: 2}, errors.New("connection refused")))
+	lastActive := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	topicManager := &TopicManager{
+		shardNumber:         1,
+		repository:          repository,
+		destinationTopics:   map[string]utils.Set[string]{"d1": utils.NewSet(retryTopic, batchTopic)},
+		topicLastActiveDate: map[string]*time.Time{batchTopic: &lastActive},
+		batchConsumers:      map[string][]BatchConsumer{"d1": {batchConsumer}},
+	}
+
+	//lags are omitted until measured
+	w = request(NewRouter(&Context{config: &Config{}, repository: repository, topicManager: topicManager}))
+	reqr.Equal(http.StatusOK, w.Code)
+	topology := &Topology{}
+	reqr.NoError(json.Unmarshal(w.Body.Bytes(), topology))
+	reqr.Equal(1, topology.Shard)
+	reqr.Nil(topology.LagUpdatedAt)
+	reqr.Len(topology.Destinations, 1)
+	dt := topology.Destinations[0]
+	reqr.Equal("d1", dt.Id)
+	reqr.Equal("postgres", dt.Type)
+	reqr.Equal("w1", dt.WorkspaceId)
+	reqr.Equal(int64(7), dt.InFlightEvents)
+	reqr.Nil(dt.Lag)
+	reqr.Len(dt.Topics, 2)
+	reqr.Equal(batchTopic, dt.Topics[0].Topic)
+	reqr.Equal("events", dt.Topics[0].TableName)
+	reqr.True(lastActive.Equal(*dt.Topics[0].LastActiveAt))
+	reqr.Nil(dt.Topics[0].Lag)
+	reqr.Len(dt.Topics[0].Consumers, 1)
+	consumer := dt.Topics[0].Consumers[0]
+	reqr.Equal("batch", consumer.Mode)
+	reqr.Equal(batchTopic, consumer.GroupId)
+	reqr.True(consumer.Paused)
+	reqr.False(consumer.Running)
+	reqr.Equal("fail", consumer.LastRun.Status)
+	reqr.Equal("connection refused", consumer.LastRun.Error)
+	reqr.Equal(10, consumer.LastRun.Consumed)
+	reqr.Equal(2, consumer.LastRun.Failed)
+	reqr.Equal(retryTopic, dt.Topics[1].Topic)
+	reqr.Equal(retryTopicMode, dt.Topics[1].Mode)
+	reqr.Empty(dt.Topics[1].Consumers)
+
+	//retry topic lag is depth of retry queue
+	lagMonitor := &LagMonitor{}
+	lagMonitor.signals.Store(&AutoscalingSignals{
+		Lag:          5,
+		Destinations: map[string]DestinationLag{"d1": {Lag: 5, Rate: 1.5}},
+		Topics:       map[string]int64{batchTopic: 5, retryTopic: 3},
+		UpdatedAt:    lastActive,
+	})
+	w = request(NewRouter(&Context{config: &Config{}, repository: repository, topicManager: topicManager, lagMonitor: lagMonitor}))
+	reqr.Equal(http.StatusOK, w.Code)
+	topology = &Topology{}
+	reqr.NoError(json.Unmarshal(w.Body.Bytes(), topology))
+	reqr.True(lastActive.Equal(*topology.LagUpdatedAt))
+	dt = topology.Destinations[0]
+	reqr.Equal(&DestinationLag{Lag: 5, Rate: 1.5}, dt.Lag)
+	reqr.Equal(int64(5), *dt.Topics[0].Lag)
+	reqr.Equal(int64(3), *dt.Topics[1].Lag)
+}
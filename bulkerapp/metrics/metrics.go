@@ -132,6 +132,26 @@ var (
 		return consumerRuns.WithLabelValues(topicId, mode, destinationId, tableName, status)
 	}
 
+	consumerInFlightEvents = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "bulkerapp",
+		Subsystem: "consumer",
+		Name:      "in_flight_events",
+		Help:      "Events consumed by batch consumers of destination and not yet committed to destination",
+	}, []string{"destinationId"})
+	ConsumerInFlightEvents = func(destinationId string) prometheus.Gauge {
+		return consumerInFlightEvents.WithLabelValues(destinationId)
+	}
+
+	consumerTriggers = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "bulkerapp",
+		Subsystem: "consumer",
+		Name:      "triggers",
+		Help:      "Batch runs started by threshold triggers",
+	}, []string{"topicId", "mode", "destinationId", "tableName", "trigger"})
+	ConsumerTriggers = func(topicId, mode, destinationId, tableName, trigger string) prometheus.Counter {
+		return consumerTriggers.WithLabelValues(topicId, mode, destinationId, tableName, trigger)
+	}
+
 	configurationSourceError = promauto.NewCounterVec(prometheus.CounterOpts{
 		Namespace: "bulkerapp",
 		Subsystem: "configuration",
@@ -159,6 +179,31 @@ var (
 		return repositoryDestinationInitError.WithLabelValues(destinationId)
 	}
 
+	autoscalingLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "bulkerapp",
+		Subsystem: "autoscaling",
+		Name:      "lag",
+		Help:      "Messages in destination topics not yet processed by consumers",
+	}, []string{"destinationId"})
+	AutoscalingLag = func(destinationId string) prometheus.Gauge {
+		return autoscalingLag.WithLabelValues(destinationId)
+	}
+
+	autoscalingRate = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "bulkerapp",
+		Subsystem: "autoscaling",
+		Name:      "rate",
+		Help:      "Messages of destination topics processed per second",
+	}, []string{"destinationId"})
+	AutoscalingRate = func(destinationId string) prometheus.Gauge {
+		return autoscalingRate.WithLabelValues(destinationId)
+	}
+	// DeleteAutoscaling removes autoscaling metrics of destination that no longer exists
+	DeleteAutoscaling = func(destinationId string) {
+		autoscalingLag.DeleteLabelValues(destinationId)
+		autoscalingRate.DeleteLabelValues(destinationId)
+	}
+
 	panics = promauto.NewCounter(prometheus.CounterOpts{
 		Namespace: "bulkerapp",
 		Subsystem: "safego",
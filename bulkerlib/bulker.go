@@ -2,11 +2,13 @@ package bulkerlib
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/jitsucom/bulker/bulkerlib/types"
 	"io"
 	"reflect"
 	"strings"
+	"time"
 )
 
 type InitFunction func(Config) (Bulker, error)
@@ -41,6 +43,28 @@ const (
 	//ReplaceTable implies Batch, meaning that the new data will be available only after BulkerStream.complete() call
 	ReplaceTable BulkMode = "replace_table"
 
+	//UpdateColumns - updates only columns present in consumed objects for existing rows matched by primary key.
+	//Other columns are left untouched and objects that don't match any existing row are skipped.
+	//Useful for enrichment backfills, e.g. adding columns computed later without reloading full rows.
+	//Requires WithPrimaryKey option and existing destination table.
+	//
+	//UpdateColumns implies Batch, meaning that the new data will be available only after BulkerStream.complete() call
+	UpdateColumns BulkMode = "update_columns"
+
+	//SCD2 - slowly changing dimension type 2. Every consumed object is inserted as a new version of row with valid_from, valid_to and is_current columns.
+	//Current version of row with the same primary key is closed: valid_to is set to valid_from of the new version and is_current to false.
+	//Requires WithPrimaryKey option. Only the latest object with the same primary key within batch becomes a new version.
+	//
+	//SCD2 implies Batch, meaning that the new data will be available only after BulkerStream.complete() call
+	SCD2 BulkMode = "scd2"
+
+	//CDC - applies change data capture events, e.g. produced by Debezium. Every consumed object carries operation type:
+	//inserts and updates are upserted by primary key, deletes remove rows with the same primary key.
+	//Requires WithPrimaryKey option. The latest operation with the same primary key within batch wins.
+	//
+	//CDC implies Batch, meaning that the new data will be available only after BulkerStream.complete() call
+	CDC BulkMode = "cdc"
+
 	Unknown BulkMode = ""
 
 	BatchNumberCtxKey = "batch_number"
@@ -77,6 +101,11 @@ type BulkerStream interface {
 	//Consume - put object to the stream. If stream is in Stream mode it will be immediately committed to the database.
 	//Otherwise, it will be buffered and committed on Complete call.
 	Consume(ctx context.Context, object types.Object) (state State, processedObject types.Object, err error)
+	//ConsumeBatch - put objects to the stream in order. Same as calling Consume for every object, but stream may amortize per-call work
+	//(initialization, state bookkeeping) over the whole batch.
+	//Stops at the first error: processedObjects contains results of objects consumed before the failed one,
+	//so objects[len(processedObjects)] is the failed object and caller may continue with the rest (e.g. after RejectedObjectError)
+	ConsumeBatch(ctx context.Context, objects []types.Object) (state State, processedObjects []types.Object, err error)
 	//Abort - abort stream and rollback all uncommitted objects. For stream in Stream mode does nothing.
 	//Returns stream statistics. BulkerStream cannot be used after Abort call.
 	Abort(ctx context.Context) (State, error)
@@ -87,6 +116,49 @@ type BulkerStream interface {
 	//TODO: TestConnection
 }
 
+// ConsumeEach consumes objects one by one with Consume method of stream.
+// ConsumeBatch implementation for streams that have nothing to amortize over the batch
+func ConsumeEach(ctx context.Context, stream BulkerStream, objects []types.Object) (state State, processedObjects []types.Object, err error) {
+	processedObjects = make([]types.Object, 0, len(objects))
+	for _, object := range objects {
+		var processedObject types.Object
+		state, processedObject, err = stream.Consume(ctx, object)
+		if err != nil {
+			return state, processedObjects, err
+		}
+		processedObjects = append(processedObjects, processedObject)
+	}
+	return state, processedObjects, nil
+}
+
+// Checkpointer optional interface of BulkerStream that can make consumed objects durable,
+// so stream interrupted by process crash can be re-opened with resume token and continue from the checkpoint.
+// Caller is responsible for storing token together with position of the last consumed object in its source
+type Checkpointer interface {
+	Checkpoint(ctx context.Context) (resumeToken string, err error)
+}
+
+// RejectedObjectError is returned by BulkerStream.Consume when object must be moved to dead-letter queue without retries,
+// e.g. its value cannot be coerced to the type of existing column.
+// Rejected object is not written, stream remains active and other objects of the batch are not affected.
+type RejectedObjectError struct {
+	Err error
+}
+
+func (e *RejectedObjectError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RejectedObjectError) Unwrap() error {
+	return e.Err
+}
+
+// IsRejectedObjectError returns true if object was rejected by stream. See RejectedObjectError
+func IsRejectedObjectError(err error) bool {
+	var rejected *RejectedObjectError
+	return errors.As(err, &rejected)
+}
+
 type Config struct {
 	//id of Bulker instance for logging and metrics
 	Id string `mapstructure:"id"  json:"id"`
@@ -94,6 +166,10 @@ type Config struct {
 	BulkerType string `mapstructure:"type" json:"type"`
 	//destinationConfig - config of destination - may be struct type supported by destination implementation of map[string]any
 	DestinationConfig any `mapstructure:"credentials" json:"credentials"`
+	//StatementTimeoutSec - timeout for statements executed in destination database. Timed out statements are cancelled and returned as errors so batch can be retried. 0 - no timeout
+	StatementTimeoutSec int `mapstructure:"statementTimeoutSec,omitempty" json:"statementTimeoutSec,omitempty"`
+	//ConnMaxLifetimeSec - max lifetime of pooled connections to destination database. Older connections are closed and reopened on demand. 0 - default of adapter
+	ConnMaxLifetimeSec int `mapstructure:"connMaxLifetimeSec,omitempty" json:"connMaxLifetimeSec,omitempty"`
 	//TODO: think about logging approach for library
 	LogLevel LogLevel `mapstructure:"logLevel,omitempty"`
 }
@@ -141,7 +217,78 @@ type State struct {
 	SuccessfulRows    int     `json:"successfulRows"`
 	ErrorRowIndex     int     `json:"errorRowIndex,omitempty"`
 	ProcessingTimeSec float64 `json:"processingTimeSec"`
-	*WarehouseState   `json:",inline,omitempty"`
+	//RejectedRows number of objects rejected by Consume with RejectedObjectError. Such objects are not written
+	RejectedRows int `json:"rejectedRows,omitempty"`
+	//ColumnStats per-column statistics of written rows. Collected when 'collectColumnStats' option is enabled
+	ColumnStats map[string]*ColumnStatistics `json:"columnStats,omitempty"`
+	//QualityChecks results of data quality rules evaluated over the batch. See 'qualityRules' option
+	QualityChecks []QualityCheckResult `json:"qualityChecks,omitempty"`
+	//Transform state of transform from raw table to clean table. See 'transformSql' option
+	Transform *TransformState `json:"transform,omitempty"`
+	//Snapshot location of data snapshot made before destructive operation. See 'snapshot' option
+	Snapshot string `json:"snapshot,omitempty"`
+	//Duplicate true when Complete was a no-op because stream with the same idempotency key was already completed
+	Duplicate bool `json:"duplicate,omitempty"`
+	//SkippedDuplicates number of consumed events skipped because events with the same id were already loaded. See 'crossBatchDedup' option
+	SkippedDuplicates int `json:"skippedDuplicates,omitempty"`
+	//StreamingFallback set when stream switched from streaming inserts to batch loading after hitting streaming quota or size limit
+	StreamingFallback *StreamingFallbackState `json:"streamingFallback,omitempty"`
+	//Files objects uploaded by file storage destinations
+	Files []FileInfo `json:"files,omitempty"`
+	//DryRunStatements DDL and load statements that would have been executed by Complete. See 'dryRun' option
+	DryRunStatements []string `json:"dryRunStatements,omitempty"`
+	*WarehouseState  `json:",inline,omitempty"`
+}
+
+// FileInfo describes file object uploaded by file storage destination
+type FileInfo struct {
+	Path  string `json:"path"`
+	Rows  int    `json:"rows"`
+	Bytes int64  `json:"bytes"`
+	// FirstEventTime and LastEventTime time range of events in file. Taken from 'timestamp' option field or consume time
+	FirstEventTime time.Time `json:"firstEventTime"`
+	LastEventTime  time.Time `json:"lastEventTime"`
+}
+
+// ColumnStatistics statistics of column values in a batch
+type ColumnStatistics struct {
+	Nulls int `json:"nulls"`
+	// Min and Max are collected for numbers, timestamps and strings
+	Min any `json:"min,omitempty"`
+	Max any `json:"max,omitempty"`
+	// DistinctEstimate approximate number of distinct non-null values (HyperLogLog)
+	DistinctEstimate uint64 `json:"distinctEstimate"`
+}
+
+// QualityCheckResult result of a single data quality rule evaluated over the batch
+type QualityCheckResult struct {
+	Rule   string `json:"rule"`
+	Field  string `json:"field"`
+	Action string `json:"action"`
+	Passed bool   `json:"passed"`
+	// Message describes violation. Empty for passed checks
+	Message string `json:"message,omitempty"`
+}
+
+// TransformState result of transform SQL run after batch was landed to raw table
+type TransformState struct {
+	CleanTable string `json:"cleanTable"`
+	// Executed false when transform was skipped because its schedule interval hasn't passed yet
+	Executed bool `json:"executed"`
+	// LastRunAt time of the latest successful transform run
+	LastRunAt         time.Time `json:"lastRunAt"`
+	ProcessingTimeSec float64   `json:"processingTimeSec,omitempty"`
+}
+
+// StreamingFallbackState describes switch of a stream from streaming inserts to batch loading
+type StreamingFallbackState struct {
+	Reason string `json:"reason"`
+	// RowIndex index of the first row that was loaded with batch path
+	RowIndex int `json:"rowIndex"`
+	// BatchesLoaded number of batches committed since fallback
+	BatchesLoaded int `json:"batchesLoaded"`
+	// PendingRows rows buffered for the next batch
+	PendingRows int `json:"pendingRows"`
 }
 
 type WarehouseState struct {
@@ -0,0 +1,150 @@
+package bulkerlib
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// JSONSchema subset of JSON Schema describing destination configs and stream options
+type JSONSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	Default              any                    `json:"default,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	AdditionalProperties *JSONSchema            `json:"additionalProperties,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	UniqueItems          bool                   `json:"uniqueItems,omitempty"`
+}
+
+// configTypesRegistry types of destination configs by bulker type
+var configTypesRegistry = make(map[string]reflect.Type)
+
+// RegisterConfigType registers type of destination config of bulker implementation, so JSON Schema of config can be generated. See ConfigSchema
+func RegisterConfigType(bulkerType string, config any) {
+	configTypesRegistry[bulkerType] = reflect.TypeOf(config)
+}
+
+// ConfigSchemaTypes returns sorted bulker types with registered config type
+func ConfigSchemaTypes() []string {
+	bulkerTypes := make([]string, 0, len(configTypesRegistry))
+	for bulkerType := range configTypesRegistry {
+		bulkerTypes = append(bulkerTypes, bulkerType)
+	}
+	sort.Strings(bulkerTypes)
+	return bulkerTypes
+}
+
+// ConfigSchema returns JSON Schema of destination config of provided bulker type.
+// Properties are named after 'mapstructure' tags of config fields, fields without tag are not part of serialized config and are skipped
+func ConfigSchema(bulkerType string) (*JSONSchema, bool) {
+	configType, ok := configTypesRegistry[bulkerType]
+	if !ok {
+		return nil, false
+	}
+	schema := typeSchema(configType)
+	schema.Schema = jsonSchemaDialect
+	schema.Title = bulkerType
+	return schema, true
+}
+
+// OptionsSchema returns JSON Schema of all registered stream options
+func OptionsSchema() *JSONSchema {
+	schema := &JSONSchema{Schema: jsonSchemaDialect, Title: "options", Type: "object", Properties: make(map[string]*JSONSchema, len(optionsRegistry))}
+	for key, option := range optionsRegistry {
+		optionSchema := typeSchema(option.valueType())
+		if defaultValue := option.defaultValue(); defaultValue != nil && !reflect.ValueOf(defaultValue).IsZero() {
+			optionSchema.Default = defaultValue
+		}
+		schema.Properties[key] = optionSchema
+	}
+	return schema
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// typeSchema returns JSON Schema of values of provided type
+func typeSchema(t reflect.Type) *JSONSchema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == durationType {
+		return &JSONSchema{Type: "integer", Format: "duration"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &JSONSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &JSONSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &JSONSchema{Type: "number"}
+	case reflect.String:
+		return &JSONSchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &JSONSchema{Type: "string"}
+		}
+		return &JSONSchema{Type: "array", Items: typeSchema(t.Elem())}
+	case reflect.Map:
+		if t.Elem().Kind() == reflect.Struct && t.Elem().NumField() == 0 {
+			//sets are serialized as arrays of unique values
+			return &JSONSchema{Type: "array", Items: typeSchema(t.Key()), UniqueItems: true}
+		}
+		return &JSONSchema{Type: "object", AdditionalProperties: typeSchema(t.Elem())}
+	case reflect.Struct:
+		schema := &JSONSchema{Type: "object", Properties: map[string]*JSONSchema{}}
+		addStructProperties(schema, t)
+		return schema
+	}
+	//interfaces and other types accept any value
+	return &JSONSchema{}
+}
+
+// addStructProperties adds properties of struct fields to schema. Fields of embedded structs with ',squash' (',inline' for json) tag are added to the same schema.
+// Structs without 'mapstructure' tags (e.g. values of stream options) are described by 'json' tags
+func addStructProperties(schema *JSONSchema, t reflect.Type) {
+	tagKey := "mapstructure"
+	if !hasTag(t, tagKey) {
+		tagKey = "json"
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, ok := field.Tag.Lookup(tagKey)
+		if !ok || !field.IsExported() {
+			continue
+		}
+		name, flags, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			continue
+		}
+		if strings.Contains(flags, "squash") || (name == "" && strings.Contains(flags, "inline")) {
+			fieldType := field.Type
+			for fieldType.Kind() == reflect.Pointer {
+				fieldType = fieldType.Elem()
+			}
+			if fieldType.Kind() == reflect.Struct {
+				addStructProperties(schema, fieldType)
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		schema.Properties[name] = typeSchema(field.Type)
+	}
+}
+
+func hasTag(t reflect.Type, tagKey string) bool {
+	for i := 0; i < t.NumField(); i++ {
+		if _, ok := t.Field(i).Tag.Lookup(tagKey); ok {
+			return true
+		}
+	}
+	return false
+}
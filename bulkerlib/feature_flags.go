@@ -0,0 +1,108 @@
+package bulkerlib
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/jitsucom/bulker/jitsubase/logging"
+)
+
+// FeatureFlag named set of stream options that enables new behavior of streams, e.g. for canary rollouts.
+// Options of flag are applied at stream setup unless the same options are set explicitly.
+// Code may also check if flag is enabled with FeatureEnabled
+type FeatureFlag struct {
+	Name    string         `mapstructure:"name" json:"name"`
+	Options map[string]any `mapstructure:"options" json:"options,omitempty"`
+}
+
+// FeatureFlagsOption - feature flags enabled for stream: ["flag_name"] or [{"name": "flag_name", "options": {"internalBatchFileFormat": "msgpack"}}]
+var FeatureFlagsOption = ImplementationOption[[]*FeatureFlag]{
+	Key: "featureFlags",
+	AdvancedParseFunc: func(o *ImplementationOption[[]*FeatureFlag], serialized any) (StreamOption, error) {
+		flags, err := parseFeatureFlags(serialized)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse 'featureFlags' option: %v", err)
+		}
+		return withFeatureFlags(o, flags...), nil
+	},
+}
+
+func init() {
+	RegisterOption(&FeatureFlagsOption)
+}
+
+func parseFeatureFlags(serialized any) ([]*FeatureFlag, error) {
+	var raw []byte
+	switch v := serialized.(type) {
+	case []*FeatureFlag:
+		return v, nil
+	case []string:
+		flags := make([]*FeatureFlag, len(v))
+		for i, name := range v {
+			flags[i] = &FeatureFlag{Name: name}
+		}
+		return flags, nil
+	case string:
+		raw = []byte(v)
+	default:
+		var err error
+		raw, err = json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value type of featureFlags option: %T", v)
+		}
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil, err
+	}
+	flags := make([]*FeatureFlag, 0, len(items))
+	for _, item := range items {
+		flag := &FeatureFlag{}
+		if err := json.Unmarshal(item, &flag.Name); err != nil {
+			if err = json.Unmarshal(item, flag); err != nil {
+				return nil, err
+			}
+		}
+		if flag.Name == "" {
+			return nil, fmt.Errorf("feature flag name is required")
+		}
+		flags = append(flags, flag)
+	}
+	return flags, nil
+}
+
+// withFeatureFlags adds flags to the enabled ones and applies their options that are not set explicitly
+func withFeatureFlags(o *ImplementationOption[[]*FeatureFlag], flags ...*FeatureFlag) StreamOption {
+	return func(options *StreamOptions) {
+		enabled := append([]*FeatureFlag{}, o.Get(options)...)
+		for _, flag := range flags {
+			enabled = append(enabled, flag)
+			for key, value := range flag.Options {
+				if _, explicit := options.valuesMap[key]; explicit {
+					continue
+				}
+				opt, err := ParseOption(key, value)
+				if err != nil {
+					logging.Errorf("feature flag %s: %v", flag.Name, err)
+					continue
+				}
+				opt(options)
+			}
+		}
+		o.Set(options, enabled)
+	}
+}
+
+// WithFeatureFlags enables feature flags for stream
+func WithFeatureFlags(flags ...*FeatureFlag) StreamOption {
+	return withFeatureFlags(&FeatureFlagsOption, flags...)
+}
+
+// FeatureEnabled returns true if feature flag with provided name is enabled for stream
+func FeatureEnabled(options *StreamOptions, name string) bool {
+	for _, flag := range FeatureFlagsOption.Get(options) {
+		if flag.Name == name {
+			return true
+		}
+	}
+	return false
+}
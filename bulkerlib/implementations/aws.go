@@ -0,0 +1,31 @@
+package implementations
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// NewAwsSession returns AWS session that uses static credentials if access key is provided
+// or default credentials chain (env variables, shared config, instance or task role) otherwise.
+// If roleArn is provided, the role is assumed using those base credentials and temporary credentials are refreshed automatically
+func NewAwsSession(region, accessKey, secretKey, roleArn, externalId string) (*session.Session, error) {
+	awsConfig := aws.NewConfig().WithRegion(region)
+	if accessKey != "" {
+		awsConfig.WithCredentials(credentials.NewStaticCredentials(accessKey, secretKey, ""))
+	}
+	sess, err := session.NewSession(awsConfig)
+	if err != nil {
+		return nil, err
+	}
+	if roleArn != "" {
+		roleCredentials := stscreds.NewCredentials(sess, roleArn, func(p *stscreds.AssumeRoleProvider) {
+			if externalId != "" {
+				p.ExternalID = aws.String(externalId)
+			}
+		})
+		sess = sess.Copy(aws.NewConfig().WithCredentials(roleCredentials))
+	}
+	return sess, nil
+}
@@ -0,0 +1,220 @@
+package implementations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	types2 "github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/errorj"
+	"github.com/jitsucom/bulker/jitsubase/logging"
+	"go.uber.org/atomic"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	// azureBlobBlockSize size of block of block blob multipart upload
+	azureBlobBlockSize = 8 * 1024 * 1024
+	// azureBlobUploadConcurrency number of blocks uploaded in parallel
+	azureBlobUploadConcurrency = 4
+	azureBlobOperationTimeout  = 10 * time.Minute
+)
+
+// AzureBlobConfig is a dto for config deserialization
+type AzureBlobConfig struct {
+	FileConfig  `mapstructure:",squash" json:",inline" yaml:",inline"`
+	AccountName string `mapstructure:"accountName,omitempty" json:"accountName,omitempty" yaml:"accountName,omitempty"`
+	Container   string `mapstructure:"container,omitempty" json:"container,omitempty" yaml:"container,omitempty"`
+	// SASToken shared access signature token. When empty, managed identity of the host is used
+	SASToken string `mapstructure:"sasToken,omitempty" json:"sasToken,omitempty" yaml:"sasToken,omitempty"`
+	// ManagedIdentityClientID client id of user-assigned managed identity. System-assigned identity is used when empty
+	ManagedIdentityClientID string `mapstructure:"managedIdentityClientId,omitempty" json:"managedIdentityClientId,omitempty" yaml:"managedIdentityClientId,omitempty"`
+	// Endpoint custom blob service endpoint, e.g. for Azurite emulator or sovereign clouds.
+	// Default: https://<accountName>.blob.core.windows.net/
+	Endpoint string `mapstructure:"endpoint,omitempty" json:"endpoint,omitempty" yaml:"endpoint,omitempty"`
+}
+
+// Validate returns err if invalid
+func (ac *AzureBlobConfig) Validate() error {
+	if ac == nil {
+		return errors.New("Azure Blob Storage config is required")
+	}
+	if ac.AccountName == "" && ac.Endpoint == "" {
+		return errors.New("Azure Blob Storage accountName is required parameter")
+	}
+	if ac.Container == "" {
+		return errors.New("Azure Blob Storage container is required parameter")
+	}
+	return nil
+}
+
+// ServiceURL returns url of blob service of the storage account
+func (ac *AzureBlobConfig) ServiceURL() string {
+	if ac.Endpoint != "" {
+		return strings.TrimSuffix(ac.Endpoint, "/") + "/"
+	}
+	return fmt.Sprintf("https://%s.blob.core.windows.net/", ac.AccountName)
+}
+
+// AzureBlob is a Azure Blob Storage adapter for uploading/deleting files
+type AzureBlob struct {
+	AbstractFileAdapter
+	config *AzureBlobConfig
+	client *azblob.Client
+
+	closed *atomic.Bool
+}
+
+// NewAzureBlob returns configured Azure Blob Storage adapter. Creates container if it doesn't exist
+func NewAzureBlob(config *AzureBlobConfig) (*AzureBlob, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if config.Format == "" {
+		config.Format = types2.FileFormatNDJSON
+	}
+	var client *azblob.Client
+	var err error
+	if config.SASToken != "" {
+		client, err = azblob.NewClientWithNoCredential(config.ServiceURL()+"?"+strings.TrimPrefix(config.SASToken, "?"), nil)
+	} else {
+		options := &azidentity.ManagedIdentityCredentialOptions{}
+		if config.ManagedIdentityClientID != "" {
+			options.ID = azidentity.ClientID(config.ManagedIdentityClientID)
+		}
+		var credential *azidentity.ManagedIdentityCredential
+		credential, err = azidentity.NewManagedIdentityCredential(options)
+		if err == nil {
+			client, err = azblob.NewClient(config.ServiceURL(), credential, nil)
+		}
+	}
+	if err != nil {
+		return nil, errorj.SaveOnStageError.Wrap(err, "failed to create azure blob client")
+	}
+	abstractAdapter, err := newAbstractFileAdapter(&config.FileConfig)
+	if err != nil {
+		return nil, err
+	}
+	a := &AzureBlob{AbstractFileAdapter: abstractAdapter, config: config, client: client, closed: atomic.NewBool(false)}
+	if err = a.createContainer(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *AzureBlob) createContainer() error {
+	ctx, cancel := context.WithTimeout(context.Background(), azureBlobOperationTimeout)
+	defer cancel()
+	_, err := a.client.CreateContainer(ctx, a.config.Container, nil)
+	if err == nil {
+		logging.Infof("Azure Blob Storage container %s created", a.config.Container)
+		return nil
+	}
+	if bloberror.HasCode(err, bloberror.ContainerAlreadyExists) {
+		return nil
+	}
+	if bloberror.HasCode(err, bloberror.AuthorizationFailure, bloberror.AuthorizationPermissionMismatch, bloberror.AuthorizationResourceTypeMismatch) {
+		// container scoped SAS tokens and identities are not allowed to create containers
+		logging.Warnf("Cannot ensure that Azure Blob Storage container %s exists: %v", a.config.Container, err)
+		return nil
+	}
+	return errorj.SaveOnStageError.Wrap(err, "failed to create azure blob container").
+		WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+			Bucket: a.config.Container,
+		})
+}
+
+func (a *AzureBlob) UploadBytes(fileName string, fileBytes []byte) error {
+	return a.Upload(fileName, strings.NewReader(string(fileBytes)))
+}
+
+// Upload creates named block blob with payload. Payload is uploaded in blocks in parallel
+func (a *AzureBlob) Upload(fileName string, fileReader io.ReadSeeker) error {
+	fileName = a.Path(fileName)
+
+	if a.closed.Load() {
+		return fmt.Errorf("attempt to use closed Azure Blob Storage instance")
+	}
+	headers := &blob.HTTPHeaders{}
+	contentType, contentEncoding := types2.FileContentType(a.config.Format, a.config.Compression)
+	if contentType != "" {
+		headers.BlobContentType = azblobString(contentType)
+	}
+	if contentEncoding != "" {
+		headers.BlobContentEncoding = azblobString(contentEncoding)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), azureBlobOperationTimeout)
+	defer cancel()
+	_, err := a.client.UploadStream(ctx, a.config.Container, fileName, fileReader, &azblob.UploadStreamOptions{
+		BlockSize:   azureBlobBlockSize,
+		Concurrency: azureBlobUploadConcurrency,
+		HTTPHeaders: headers,
+	})
+	if err != nil {
+		return errorj.SaveOnStageError.Wrap(err, "failed to write file to azure blob storage").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Bucket:    a.config.Container,
+				Statement: fmt.Sprintf("file: %s", fileName),
+			})
+	}
+	return nil
+}
+
+// Download downloads file from azure blob container
+func (a *AzureBlob) Download(fileName string) ([]byte, error) {
+	fileName = a.Path(fileName)
+
+	if a.closed.Load() {
+		return nil, fmt.Errorf("attempt to use closed Azure Blob Storage instance")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), azureBlobOperationTimeout)
+	defer cancel()
+	resp, err := a.client.DownloadStream(ctx, a.config.Container, fileName, nil)
+	if err == nil {
+		defer resp.Body.Close()
+		var data []byte
+		data, err = io.ReadAll(resp.Body)
+		if err == nil {
+			return data, nil
+		}
+	}
+	return nil, errorj.SaveOnStageError.Wrap(err, "failed to read file from azure blob storage").
+		WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+			Bucket:    a.config.Container,
+			Statement: fmt.Sprintf("file: %s", fileName),
+		})
+}
+
+// DeleteObject deletes blob from azure blob container by key
+func (a *AzureBlob) DeleteObject(key string) error {
+	key = a.Path(key)
+
+	if a.closed.Load() {
+		return fmt.Errorf("attempt to use closed Azure Blob Storage instance")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), azureBlobOperationTimeout)
+	defer cancel()
+	if _, err := a.client.DeleteBlob(ctx, a.config.Container, key, nil); err != nil && !bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return errorj.SaveOnStageError.Wrap(err, "failed to delete from azure blob storage").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Bucket:    a.config.Container,
+				Statement: fmt.Sprintf("file: %s", key),
+			})
+	}
+	return nil
+}
+
+// Close returns nil
+func (a *AzureBlob) Close() error {
+	a.closed.Store(true)
+	return nil
+}
+
+func azblobString(s string) *string {
+	return &s
+}
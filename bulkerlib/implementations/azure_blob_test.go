@@ -0,0 +1,125 @@
+package implementations
+
+import (
+	"encoding/xml"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// azureBlobTestServer emulates Blob service REST API for a single storage account
+type azureBlobTestServer struct {
+	sync.Mutex
+	t            *testing.T
+	containers   map[string]bool
+	blocks       map[string][]byte
+	blobs        map[string][]byte
+	contentTypes map[string]string
+}
+
+func (s *azureBlobTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	require.Equal(s.t, "test_sig", r.URL.Query().Get("sig"))
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	query := r.URL.Query()
+	switch {
+	case r.Method == http.MethodPut && query.Get("restype") == "container":
+		if s.containers[path] {
+			s.error(w, http.StatusConflict, "ContainerAlreadyExists")
+			return
+		}
+		s.containers[path] = true
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPut && query.Get("comp") == "block":
+		body, _ := io.ReadAll(r.Body)
+		s.blocks[path+"/"+query.Get("blockid")] = body
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPut && query.Get("comp") == "blocklist":
+		blockList := struct {
+			Latest []string `xml:"Latest"`
+		}{}
+		require.NoError(s.t, xml.NewDecoder(r.Body).Decode(&blockList))
+		var content []byte
+		for _, id := range blockList.Latest {
+			content = append(content, s.blocks[path+"/"+id]...)
+		}
+		s.blobs[path] = content
+		s.contentTypes[path] = r.Header.Get("x-ms-blob-content-type")
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		s.blobs[path] = body
+		s.contentTypes[path] = r.Header.Get("x-ms-blob-content-type")
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodGet:
+		content, ok := s.blobs[path]
+		if !ok {
+			s.error(w, http.StatusNotFound, "BlobNotFound")
+			return
+		}
+		_, _ = w.Write(content)
+	case r.Method == http.MethodDelete:
+		if _, ok := s.blobs[path]; !ok {
+			s.error(w, http.StatusNotFound, "BlobNotFound")
+			return
+		}
+		delete(s.blobs, path)
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *azureBlobTestServer) error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("x-ms-error-code", code)
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?><Error><Code>` + code + `</Code></Error>`))
+}
+
+func newAzureBlobTestServer(t *testing.T) (*azureBlobTestServer, string) {
+	server := &azureBlobTestServer{t: t, containers: map[string]bool{}, blocks: map[string][]byte{}, blobs: map[string][]byte{}, contentTypes: map[string]string{}}
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+	return server, httpServer.URL + "/"
+}
+
+func TestAzureBlob(t *testing.T) {
+	reqr := require.New(t)
+	server, endpoint := newAzureBlobTestServer(t)
+	config := &AzureBlobConfig{Endpoint: endpoint, Container: "events", SASToken: "?sv=2022-11-02&sig=test_sig", FileConfig: FileConfig{Folder: "bulker"}}
+	adapter, err := NewAzureBlob(config)
+	reqr.NoError(err)
+	reqr.True(server.containers["events"])
+	//existing container is reused
+	_, err = NewAzureBlob(config)
+	reqr.NoError(err)
+
+	reqr.NoError(adapter.Upload("batch.ndjson", strings.NewReader("{\"id\": 1}\n")))
+	reqr.Equal("{\"id\": 1}\n", string(server.blobs["events/bulker/batch.ndjson"]))
+	reqr.Equal("application/x-ndjson", server.contentTypes["events/bulker/batch.ndjson"])
+	content, err := adapter.Download("batch.ndjson")
+	reqr.NoError(err)
+	reqr.Equal("{\"id\": 1}\n", string(content))
+
+	reqr.NoError(adapter.DeleteObject("batch.ndjson"))
+	reqr.Empty(server.blobs)
+	//deleting missing blob isn't an error
+	reqr.NoError(adapter.DeleteObject("batch.ndjson"))
+	_, err = adapter.Download("batch.ndjson")
+	reqr.ErrorContains(err, "failed to read file from azure blob storage")
+
+	reqr.NoError(adapter.Close())
+	reqr.ErrorContains(adapter.UploadBytes("batch.ndjson", []byte("{}")), "closed Azure Blob Storage instance")
+}
+
+func TestAzureBlobConfig(t *testing.T) {
+	require.EqualError(t, (&AzureBlobConfig{Container: "events"}).Validate(), "Azure Blob Storage accountName is required parameter")
+	require.EqualError(t, (&AzureBlobConfig{AccountName: "acc"}).Validate(), "Azure Blob Storage container is required parameter")
+	require.Equal(t, "https://acc.blob.core.windows.net/", (&AzureBlobConfig{AccountName: "acc"}).ServiceURL())
+	require.Equal(t, "http://127.0.0.1:10000/devstoreaccount1/", (&AzureBlobConfig{Endpoint: "http://127.0.0.1:10000/devstoreaccount1"}).ServiceURL())
+}
@@ -1,8 +1,14 @@
 package implementations
 
 import (
+	"cloud.google.com/go/storage"
+	"errors"
 	"fmt"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/errorj"
 	"io"
 	"strings"
 	"time"
@@ -28,16 +34,56 @@ type FileAdapter interface {
 	AddFileExtension(fileName string) string
 	Format() types.FileFormat
 	Compression() types.FileCompression
+	// SchemaRegistry returns Schema Registry client for schemas of Avro files or nil if it is not configured
+	SchemaRegistry() *types.SchemaRegistry
+	// MarshallerConfig returns compression level and buffering settings for marshalling of files
+	MarshallerConfig() types.MarshallerConfig
 }
 
 type FileConfig struct {
 	Folder      string                `mapstructure:"folder" json:"folder,omitempty" yaml:"folder,omitempty"`
 	Format      types.FileFormat      `mapstructure:"format,omitempty" json:"format,omitempty" yaml:"format,omitempty"`
 	Compression types.FileCompression `mapstructure:"compression,omitempty" json:"compression,omitempty" yaml:"compression,omitempty"`
+	// SchemaRegistry Confluent Schema Registry for schemas of files in "avro" format
+	SchemaRegistry *types.SchemaRegistryConfig `mapstructure:"schemaRegistry,omitempty" json:"schemaRegistry,omitempty" yaml:"schemaRegistry,omitempty"`
+	// MarshallerConfig compression level, write buffer size and flush cadence of files
+	types.MarshallerConfig `mapstructure:",squash" yaml:",inline"`
+}
+
+// Validate returns err if invalid
+func (c *FileConfig) Validate() error {
+	if c.Format == types.FileFormatAVRO {
+		if c.Compression != types.FileCompressionUNKNOWN && c.Compression != types.FileCompressionNONE {
+			return fmt.Errorf("compression is not supported for %s format: blocks of files are compressed with snappy codec", c.Format)
+		}
+	} else if c.Format == types.FileFormatXLSX && c.Compression != types.FileCompressionUNKNOWN && c.Compression != types.FileCompressionNONE {
+		return fmt.Errorf("compression is not supported for %s format: files are zip archives", c.Format)
+	} else if c.Format == types.FileFormatArrow && c.Compression != types.FileCompressionUNKNOWN && c.Compression != types.FileCompressionNONE {
+		return fmt.Errorf("compression is not supported for %s format: files must stay readable with random access", c.Format)
+	}
+	if c.Format != types.FileFormatAVRO && c.SchemaRegistry != nil {
+		return fmt.Errorf("schemaRegistry is supported only for %s format", types.FileFormatAVRO)
+	}
+	if err := c.MarshallerConfig.Validate(c.Compression); err != nil {
+		return err
+	}
+	return c.SchemaRegistry.Validate()
 }
 
 type AbstractFileAdapter struct {
-	config *FileConfig
+	config         *FileConfig
+	schemaRegistry *types.SchemaRegistry
+}
+
+func newAbstractFileAdapter(config *FileConfig) (AbstractFileAdapter, error) {
+	if err := config.Validate(); err != nil {
+		return AbstractFileAdapter{}, err
+	}
+	a := AbstractFileAdapter{config: config}
+	if config.SchemaRegistry != nil {
+		a.schemaRegistry = types.NewSchemaRegistry(config.SchemaRegistry)
+	}
+	return a, nil
 }
 
 func (a *AbstractFileAdapter) Format() types.FileFormat {
@@ -48,19 +94,31 @@ func (a *AbstractFileAdapter) Compression() types.FileCompression {
 	return a.config.Compression
 }
 
+func (a *AbstractFileAdapter) SchemaRegistry() *types.SchemaRegistry {
+	return a.schemaRegistry
+}
+
+func (a *AbstractFileAdapter) MarshallerConfig() types.MarshallerConfig {
+	return a.config.MarshallerConfig
+}
+
 func (a *AbstractFileAdapter) AddFileExtension(fileName string) string {
-	gz := ""
 	ext := ""
 	switch a.config.Format {
 	case types.FileFormatCSV:
 		ext = ".csv"
 	case types.FileFormatNDJSON, types.FileFormatNDJSONFLAT:
 		ext = ".ndjson"
+	case types.FileFormatAVRO:
+		ext = ".avro"
+	case types.FileFormatProtobuf:
+		ext = ".pb"
+	case types.FileFormatXLSX:
+		ext = ".xlsx"
+	case types.FileFormatArrow:
+		ext = ".arrow"
 	}
-	switch a.config.Compression {
-	case types.FileCompressionGZIP:
-		gz += ".gz"
-	}
+	gz := a.config.Compression.Extension()
 	if strings.HasSuffix(fileName, ext) {
 		return fileName + gz
 	} else if strings.HasSuffix(fileName, ext+gz) {
@@ -81,6 +139,22 @@ func (a *AbstractFileAdapter) Path(fileName string) string {
 	return fmt.Sprintf("%s%s", folder, fileName)
 }
 
+// IsFileNotFoundError returns true if error returned by FileAdapter Download method means that file doesn't exist
+func IsFileNotFoundError(err error) bool {
+	if err == nil {
+		return false
+	}
+	cause := errorj.Cause(err)
+	var awsErr awserr.Error
+	if errors.As(cause, &awsErr) {
+		return awsErr.Code() == s3.ErrCodeNoSuchKey || awsErr.Code() == "NotFound"
+	}
+	if errors.Is(cause, storage.ErrObjectNotExist) || bloberror.HasCode(cause, bloberror.BlobNotFound) {
+		return true
+	}
+	return strings.Contains(cause.Error(), "FileNotFoundException")
+}
+
 func replaceMacro(folder string) string {
 	for macro, fn := range folderMacro {
 		folder = strings.ReplaceAll(folder, macro, fn())
@@ -22,6 +22,7 @@ import (
 
 type AbstractFileStorageStream struct {
 	id           string
+	tableName    string
 	mode         bulker.BulkMode
 	fileAdapter  implementations2.FileAdapter
 	options      bulker.StreamOptions
@@ -39,6 +40,10 @@ type AbstractFileStorageStream struct {
 	batchFileLinesByPK map[string]int
 	batchFileSkipLines utils.Set[int]
 	csvHeader          utils.Set[string]
+	// avroTypes data types of columns of avro or protobuf file inferred from values
+	avroTypes map[string]types2.DataType
+	// sidecarFields fields of batch file with observed types. Collected when SchemaSidecarOption is set
+	sidecarFields map[string]*sidecarField
 
 	firstEventTime time.Time
 	lastEventTime  time.Time
@@ -49,8 +54,8 @@ type AbstractFileStorageStream struct {
 	startTime time.Time
 }
 
-func newAbstractFileStorageStream(id string, p implementations2.FileAdapter, filenameFunc func(ctx context.Context) string, mode bulker.BulkMode, streamOptions ...bulker.StreamOption) (AbstractFileStorageStream, error) {
-	ps := AbstractFileStorageStream{id: id, fileAdapter: p, filenameFunc: filenameFunc, mode: mode}
+func newAbstractFileStorageStream(id string, p implementations2.FileAdapter, tableName string, filenameFunc func(ctx context.Context) string, mode bulker.BulkMode, streamOptions ...bulker.StreamOption) (AbstractFileStorageStream, error) {
+	ps := AbstractFileStorageStream{id: id, tableName: tableName, fileAdapter: p, filenameFunc: filenameFunc, mode: mode}
 	ps.options = bulker.StreamOptions{}
 	for _, option := range streamOptions {
 		ps.options.Add(option)
@@ -67,6 +72,8 @@ func newAbstractFileStorageStream(id string, p implementations2.FileAdapter, fil
 		ps.batchFileSkipLines = utils.NewSet[int]()
 	}
 	ps.csvHeader = utils.NewSet[string]()
+	ps.avroTypes = map[string]types2.DataType{}
+	ps.sidecarFields = map[string]*sidecarField{}
 	ps.state = bulker.State{Status: bulker.Active}
 	ps.startTime = time.Now()
 	return ps, nil
@@ -84,17 +91,33 @@ func (ps *AbstractFileStorageStream) init(ctx context.Context) error {
 			return err
 		}
 		ps.marshaller, _ = types2.NewMarshaller(types2.FileFormatNDJSON, types2.FileCompressionNONE)
-		ps.targetMarshaller, err = types2.NewMarshaller(ps.fileAdapter.Format(), ps.fileAdapter.Compression())
+		ps.targetMarshaller, err = types2.NewMarshaller(ps.fileAdapter.Format(), ps.fileAdapter.Compression(), types2.WithMarshallerConfig(ps.fileAdapter.MarshallerConfig()))
 		if err != nil {
 			return err
 		}
 		if !ps.merge && ps.fileAdapter.Format() == types2.FileFormatNDJSON {
 			//without merge we can write file with compression - no need to convert
-			ps.marshaller, _ = types2.NewMarshaller(ps.fileAdapter.Format(), ps.fileAdapter.Compression())
+			ps.marshaller, _ = types2.NewMarshaller(ps.fileAdapter.Format(), ps.fileAdapter.Compression(), types2.WithMarshallerConfig(ps.fileAdapter.MarshallerConfig()))
 		}
-		if ps.fileAdapter.Format() == types2.FileFormatCSV || ps.fileAdapter.Format() == types2.FileFormatNDJSONFLAT {
+		if headerFileFormat(ps.fileAdapter.Format()) || ps.fileAdapter.Format() == types2.FileFormatNDJSONFLAT || typedFileFormat(ps.fileAdapter.Format()) {
 			ps.flatten = true
 		}
+		if typedFileFormat(ps.fileAdapter.Format()) {
+			// objects are written with field names valid for Avro (and Protobuf)
+			ps.pkColumns = utils.ArrayMap(ps.pkColumns, avroFieldName)
+		}
+		if protobufMarshaller, ok := ps.targetMarshaller.(*types2.ProtobufMarshaller); ok {
+			if schema := ProtobufSchemaOption.Get(&ps.options); schema != nil {
+				descriptor, err := schema.MessageDescriptor()
+				if err != nil {
+					return err
+				}
+				protobufMarshaller.UseSchema(descriptor)
+			}
+		}
+		if avroMarshaller, ok := ps.targetMarshaller.(*types2.AvroMarshaller); ok && ps.fileAdapter.SchemaRegistry() != nil {
+			avroMarshaller.UseSchemaRegistry(ps.fileAdapter.SchemaRegistry(), ps.fileAdapter.SchemaRegistry().SubjectName(ps.tableName))
+		}
 	}
 	ps.inited = true
 	return nil
@@ -184,7 +207,14 @@ func (ps *AbstractFileStorageStream) flushBatchFile(ctx context.Context) (err er
 			if needToConvert {
 				header := ps.csvHeader.ToSlice()
 				sort.Strings(header)
-				err = ps.targetMarshaller.Init(workingFile, header)
+				if typedFileFormat(ps.targetMarshaller.Format()) {
+					schema := ps.avroSchema()
+					// columns are used by arrow marshaller only
+					columns := utils.ArrayMap(schema.Fields, func(f types2.AvroType) string { return f.Name })
+					err = ps.targetMarshaller.InitSchema(workingFile, columns, schema)
+				} else {
+					err = ps.targetMarshaller.Init(workingFile, header)
+				}
 				if err != nil {
 					return errorj.Decorate(err, "failed to write header for converted batch file")
 				}
@@ -251,6 +281,35 @@ func (ps *AbstractFileStorageStream) flushBatchFile(ctx context.Context) (err er
 		} else {
 			logging.Infof("[%s] Batch file loaded to %s in %.2f s.", ps.id, ps.fileAdapter.Type(), time.Since(loadTime).Seconds())
 		}
+		representation := map[string]string{
+			"name": ps.fileAdapter.Path(fileName),
+		}
+		schemaPath, err := ps.uploadProtobufDescriptor(fileName)
+		if err != nil {
+			return errorj.Decorate(err, "failed to upload protobuf schema of batch file")
+		}
+		if schemaPath != "" {
+			representation["schema"] = schemaPath
+		}
+		sidecarPath, err := ps.uploadSchemaSidecar(fileName, ps.eventsInBatch-len(ps.batchFileSkipLines))
+		if err != nil {
+			return errorj.Decorate(err, "failed to upload schema sidecar of batch file")
+		}
+		if sidecarPath != "" {
+			representation["schemaSidecar"] = sidecarPath
+		}
+		ps.state.Representation = representation
+		var fileSize int64
+		if stat, _ = workingFile.Stat(); stat != nil {
+			fileSize = stat.Size()
+		}
+		ps.state.Files = append(ps.state.Files, bulker.FileInfo{
+			Path:           ps.fileAdapter.Path(fileName),
+			Rows:           ps.eventsInBatch - len(ps.batchFileSkipLines),
+			Bytes:          fileSize,
+			FirstEventTime: ps.firstEventTime,
+			LastEventTime:  ps.lastEventTime,
+		})
 	}
 	return nil
 }
@@ -300,6 +359,36 @@ func (ps *AbstractFileStorageStream) writeToBatchFile(ctx context.Context, proce
 	return nil
 }
 
+// forEachObject reads objects from batch file skipping lines replaced by deduplication
+func (ps *AbstractFileStorageStream) forEachObject(f func(object map[string]any) error) error {
+	file, err := os.Open(ps.batchFile.Name())
+	if err != nil {
+		return errorj.Decorate(err, "failed to open batch file")
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*100), 1024*1024*10)
+	i := 0
+	for scanner.Scan() {
+		if ps.batchFileSkipLines == nil || !ps.batchFileSkipLines.Contains(i) {
+			dec := jsoniter.NewDecoder(bytes.NewReader(scanner.Bytes()))
+			dec.UseNumber()
+			object := make(map[string]any)
+			if err = dec.Decode(&object); err != nil {
+				return errorj.Decorate(err, "failed to decode json object from batch file")
+			}
+			if err = f(object); err != nil {
+				return err
+			}
+		}
+		i++
+	}
+	if err = scanner.Err(); err != nil {
+		return errorj.Decorate(err, "failed to read batch file")
+	}
+	return nil
+}
+
 func (ps *AbstractFileStorageStream) Consume(ctx context.Context, object types2.Object) (state bulker.State, processedObject types2.Object, err error) {
 	defer func() {
 		err = ps.postConsume(err)
@@ -308,6 +397,28 @@ func (ps *AbstractFileStorageStream) Consume(ctx context.Context, object types2.
 	if err = ps.init(ctx); err != nil {
 		return
 	}
+	processedObject, err = ps.consume(ctx, object)
+	return
+}
+
+// ConsumeBatch initializes stream once for the whole batch and consumes objects in order. Stops at the first error
+func (ps *AbstractFileStorageStream) ConsumeBatch(ctx context.Context, objects []types2.Object) (state bulker.State, processedObjects []types2.Object, err error) {
+	if err = ps.init(ctx); err != nil {
+		return ps.state, nil, ps.postConsume(err)
+	}
+	processedObjects = make([]types2.Object, 0, len(objects))
+	for _, object := range objects {
+		processedObject, err := ps.consume(ctx, object)
+		if err = ps.postConsume(err); err != nil {
+			return ps.state, processedObjects, err
+		}
+		processedObjects = append(processedObjects, processedObject)
+	}
+	return ps.state, processedObjects, nil
+}
+
+// consume writes object to the batch file. Stream must be initialized
+func (ps *AbstractFileStorageStream) consume(ctx context.Context, object types2.Object) (processedObject types2.Object, err error) {
 	eventTime := ps.getEventTime(object)
 	if ps.lastEventTime.IsZero() || eventTime.After(ps.lastEventTime) {
 		ps.lastEventTime = eventTime
@@ -322,9 +433,16 @@ func (ps *AbstractFileStorageStream) Consume(ctx context.Context, object types2.
 		return
 	}
 
-	if ps.targetMarshaller.Format() == "csv" {
+	if headerFileFormat(ps.targetMarshaller.Format()) {
 		ps.csvHeader.PutAllKeys(processedObject)
 	}
+	if typedFileFormat(ps.targetMarshaller.Format()) {
+		processedObject = avroObject(processedObject)
+		ps.collectAvroTypes(processedObject)
+	}
+	if SchemaSidecarOption.Get(&ps.options) != "" {
+		ps.collectSidecarFields(processedObject)
+	}
 
 	err = ps.writeToBatchFile(ctx, processedObject)
 
@@ -376,3 +494,37 @@ func (ps *AbstractFileStorageStream) Complete(ctx context.Context) (state bulker
 		return
 	}
 }
+
+// inferDeltaSchema returns current schema of the table extended with columns of the batch. stringColumns are typed as strings.
+// Types of existing columns are preserved: values of batch are converted to them
+func (ps *AbstractFileStorageStream) inferDeltaSchema(current deltaSchema, stringColumns []string) (deltaSchema, error) {
+	inferred := map[string]string{}
+	err := ps.forEachObject(func(object map[string]any) error {
+		for name, value := range object {
+			inferred[name] = mergeDeltaTypes(inferred[name], deltaTypeOf(value))
+		}
+		return nil
+	})
+	if err != nil {
+		return current, err
+	}
+	for _, column := range stringColumns {
+		inferred[column] = deltaString
+	}
+	newColumns := make([]string, 0)
+	for name := range inferred {
+		if current.field(name) == nil {
+			newColumns = append(newColumns, name)
+		}
+	}
+	sort.Strings(newColumns)
+	for _, name := range newColumns {
+		current.Fields = append(current.Fields, deltaField{Name: name, Type: utils.DefaultString(inferred[name], deltaString), Nullable: true, Metadata: map[string]any{}})
+	}
+	return current, nil
+}
+
+// headerFileFormat returns true for formats of files with header row built from fields of consumed objects: csv and xlsx
+func headerFileFormat(format types2.FileFormat) bool {
+	return format == types2.FileFormatCSV || format == types2.FileFormatXLSX
+}
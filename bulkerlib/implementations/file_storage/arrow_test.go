@@ -0,0 +1,49 @@
+package file_storage
+
+import (
+	"encoding/json"
+	types2 "github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/stretchr/testify/require"
+	"maps"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestArrowFile(t *testing.T) {
+	ps := &AbstractFileStorageStream{tableName: "events", avroTypes: map[string]types2.DataType{}}
+	objects := []types2.Object{
+		{"id": json.Number("1"), "price": json.Number("1.5"), "context_ip": "1.1.1.1", "timestamp": "2024-05-01T12:30:00Z"},
+		{"id": json.Number("2"), "tags": []any{"a"}},
+	}
+	for i, object := range objects {
+		objects[i] = avroObject(object)
+		ps.collectAvroTypes(objects[i])
+	}
+	schema := ps.avroSchema()
+	columns := make([]string, len(schema.Fields))
+	for i, field := range schema.Fields {
+		columns[i] = field.Name
+	}
+	marshaller, err := types2.NewMarshaller(types2.FileFormatArrow, types2.FileCompressionNONE)
+	require.NoError(t, err)
+	file, err := os.CreateTemp(t.TempDir(), "*.arrow")
+	require.NoError(t, err)
+	defer file.Close()
+	require.NoError(t, marshaller.InitSchema(file, columns, schema))
+	require.NoError(t, marshaller.Marshal(objects...))
+	require.NoError(t, marshaller.Flush())
+
+	var rows []types2.Object
+	require.NoError(t, types2.ReadArrowFile(file, func(row types2.Object) error {
+		rows = append(rows, maps.Clone(row))
+		return nil
+	}))
+	require.Len(t, rows, 2)
+	require.Equal(t, int64(1), rows[0]["id"])
+	require.Equal(t, 1.5, rows[0]["price"])
+	require.Equal(t, "1.1.1.1", rows[0]["context_ip"])
+	require.Equal(t, time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC), rows[0]["timestamp"])
+	require.Equal(t, `["a"]`, rows[1]["tags"])
+	require.Nil(t, rows[1]["price"])
+}
@@ -0,0 +1,91 @@
+package file_storage
+
+import (
+	types2 "github.com/jitsucom/bulker/bulkerlib/types"
+	"sort"
+	"strings"
+)
+
+// typedFileFormat returns true for formats of files with schema built from types of consumed objects: avro, protobuf and arrow.
+// Protobuf and Arrow field names follow the same rules as Avro ones
+func typedFileFormat(format types2.FileFormat) bool {
+	return format == types2.FileFormatAVRO || format == types2.FileFormatProtobuf || format == types2.FileFormatArrow
+}
+
+// avroFieldName returns name valid for Avro record field: [A-Za-z_][A-Za-z0-9_]*
+func avroFieldName(name string) string {
+	var builder strings.Builder
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				builder.WriteRune('_')
+			}
+		default:
+			r = '_'
+		}
+		builder.WriteRune(r)
+	}
+	if builder.Len() == 0 {
+		return "_"
+	}
+	return builder.String()
+}
+
+// avroObject returns object with field names valid for Avro records
+func avroObject(object types2.Object) types2.Object {
+	result := make(types2.Object, len(object))
+	for k, v := range object {
+		result[avroFieldName(k)] = v
+	}
+	return result
+}
+
+// collectAvroTypes updates types of avro file columns with types of object values
+func (ps *AbstractFileStorageStream) collectAvroTypes(object types2.Object) {
+	for k, v := range object {
+		dt, err := types2.TypeFromValue(types2.ReformatValue(v))
+		if err != nil {
+			if _, ok := ps.avroTypes[k]; !ok {
+				ps.avroTypes[k] = types2.UNKNOWN
+			}
+			continue
+		}
+		if dt == types2.JSON {
+			// arrays are written as JSON strings
+			dt = types2.STRING
+		}
+		current, ok := ps.avroTypes[k]
+		if !ok || current == types2.UNKNOWN {
+			ps.avroTypes[k] = dt
+		} else if current != dt {
+			ps.avroTypes[k] = types2.GetCommonAncestorType(current, dt)
+		}
+	}
+}
+
+// avroSchema returns schema of avro file with columns of consumed objects in alphabetical order.
+// All fields are nullable
+func (ps *AbstractFileStorageStream) avroSchema() *types2.AvroSchema {
+	columns := make([]string, 0, len(ps.avroTypes))
+	for name := range ps.avroTypes {
+		columns = append(columns, name)
+	}
+	sort.Strings(columns)
+	schema := &types2.AvroSchema{
+		Type:      "record",
+		Name:      avroFieldName(ps.tableName),
+		Fields:    make([]types2.AvroType, len(columns)),
+		DataTypes: make(map[string]types2.DataType, len(columns)),
+	}
+	for i, name := range columns {
+		dt := ps.avroTypes[name]
+		if dt == types2.UNKNOWN {
+			dt = types2.STRING
+		}
+		schema.Fields[i] = types2.AvroType{Name: name, Type: dt.AvroType(), Default: nil}
+		schema.DataTypes[name] = dt
+	}
+	return schema
+}
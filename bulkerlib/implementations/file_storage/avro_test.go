@@ -0,0 +1,36 @@
+package file_storage
+
+import (
+	"encoding/json"
+	types2 "github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestAvroSchema(t *testing.T) {
+	ps := &AbstractFileStorageStream{tableName: "web-events", avroTypes: map[string]types2.DataType{}}
+	objects := []types2.Object{
+		{"id": json.Number("1"), "price": json.Number("1"), "flag": true, "context_page-url": "https://a", "1st": "x", "tags": []any{"a"}, "empty": nil},
+		{"id": json.Number("2"), "price": json.Number("1.5"), "flag": "yes", "timestamp": "2024-05-01T12:30:00Z", "empty": nil},
+	}
+	for _, object := range objects {
+		ps.collectAvroTypes(avroObject(object))
+	}
+	schema := ps.avroSchema()
+	require.Equal(t, "web_events", schema.Name)
+	require.Equal(t, map[string]types2.DataType{
+		"id":               types2.INT64,
+		"price":            types2.FLOAT64,
+		"flag":             types2.STRING,
+		"context_page_url": types2.STRING,
+		"_1st":             types2.STRING,
+		"tags":             types2.STRING,
+		"empty":            types2.STRING,
+		"timestamp":        types2.TIMESTAMP,
+	}, schema.DataTypes)
+	names := make([]string, len(schema.Fields))
+	for i, field := range schema.Fields {
+		names[i] = field.Name
+	}
+	require.Equal(t, []string{"_1st", "context_page_url", "empty", "flag", "id", "price", "tags", "timestamp"}, names)
+}
@@ -47,6 +47,10 @@ func init() {
 	if gcsConfig != "" {
 		configRegistry[GCSBulkerTypeId] = TestConfig{BulkerType: GCSBulkerTypeId, Config: gcsConfig}
 	}
+	azureBlobConfig := os.Getenv("BULKER_TEST_AZURE_BLOB")
+	if azureBlobConfig != "" {
+		configRegistry[AzureBlobBulkerTypeId] = TestConfig{BulkerType: AzureBlobBulkerTypeId, Config: azureBlobConfig}
+	}
 	s3Config := os.Getenv("BULKER_TEST_S3")
 	if s3Config != "" {
 		configRegistry[S3BulkerTypeId] = TestConfig{BulkerType: S3BulkerTypeId, Config: s3Config}
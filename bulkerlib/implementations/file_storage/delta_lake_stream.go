@@ -0,0 +1,352 @@
+package file_storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/implementations"
+	types2 "github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/errorj"
+	"github.com/jitsucom/bulker/jitsubase/logging"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"github.com/jitsucom/bulker/jitsubase/uuid"
+	jsoniter "github.com/json-iterator/go"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// deltaPartitionIdColumn partition column of tables written in ReplacePartition mode
+const deltaPartitionIdColumn = "__partition_id"
+
+// DeltaLakeStream writes batch to Delta Lake table: a parquet data file and a commit to the _delta_log transaction log.
+// Batch mode appends data file to the table, ReplaceTable mode replaces all files of the table,
+// ReplacePartition mode replaces files of the partition identified by __partition_id partition column.
+type DeltaLakeStream struct {
+	AbstractFileStorageStream
+	table       *deltaTable
+	partitionId string
+}
+
+func NewDeltaLakeStream(id string, p implementations.FileAdapter, tableName string, mode bulker.BulkMode, streamOptions ...bulker.StreamOption) (bulker.BulkerStream, error) {
+	switch mode {
+	case bulker.Batch, bulker.ReplaceTable, bulker.ReplacePartition:
+	default:
+		return nil, fmt.Errorf("unsupported bulk mode for Delta Lake table: %s", mode)
+	}
+	ds := DeltaLakeStream{table: &deltaTable{fileAdapter: p, name: tableName}}
+	var err error
+	ds.AbstractFileStorageStream, err = newAbstractFileStorageStream(id, p, tableName, func(ctx context.Context) string {
+		return tableName
+	}, mode, streamOptions...)
+	if err != nil {
+		return nil, err
+	}
+	if mode == bulker.ReplacePartition {
+		ds.partitionId = bulker.PartitionIdOption.Get(&ds.options)
+		if ds.partitionId == "" {
+			return nil, errors.New("WithPartition is required option for ReplacePartitionStream")
+		}
+	}
+	return &ds, nil
+}
+
+// init creates batch file where flattened objects are buffered as ndjson until Complete
+func (ds *DeltaLakeStream) init() (err error) {
+	if ds.inited {
+		return nil
+	}
+	ds.batchFile, err = os.CreateTemp("", fmt.Sprintf("bulker_%s", utils.SanitizeString(ds.id)))
+	if err != nil {
+		return err
+	}
+	ds.marshaller, _ = types2.NewMarshaller(types2.FileFormatNDJSON, types2.FileCompressionNONE)
+	ds.flatten = true
+	ds.inited = true
+	return nil
+}
+
+func (ds *DeltaLakeStream) Consume(ctx context.Context, object types2.Object) (state bulker.State, processedObject types2.Object, err error) {
+	defer func() {
+		err = ds.postConsume(err)
+		state = ds.state
+	}()
+	if err = ds.init(); err != nil {
+		return
+	}
+	processedObject, err = ds.preprocess(object)
+	if err != nil {
+		return
+	}
+	err = ds.writeToBatchFile(ctx, processedObject)
+	return
+}
+
+func (ds *DeltaLakeStream) ConsumeBatch(ctx context.Context, objects []types2.Object) (state bulker.State, processedObjects []types2.Object, err error) {
+	return bulker.ConsumeEach(ctx, ds, objects)
+}
+
+func (ds *DeltaLakeStream) Complete(ctx context.Context) (state bulker.State, err error) {
+	if ds.state.Status != bulker.Active {
+		return ds.state, errors.New("stream is not active")
+	}
+	if err = ds.init(); err != nil {
+		return ds.state, err
+	}
+	defer func() {
+		state, err = ds.postComplete(err)
+	}()
+	if ds.state.LastError != nil {
+		err = ds.state.LastError
+		return
+	}
+	if ds.state.SuccessfulRows == 0 && ds.mode == bulker.Batch {
+		return
+	}
+	err = ds.commit()
+	return
+}
+
+// commit writes data file and commits it to transaction log along with removal of replaced files
+func (ds *DeltaLakeStream) commit() error {
+	snapshot, err := ds.table.snapshot()
+	if err != nil {
+		return errorj.Decorate(err, "failed to read Delta table transaction log")
+	}
+	currentSchema, err := snapshot.schema()
+	if err != nil {
+		return err
+	}
+	partitionColumns := []string{}
+	if snapshot.MetaData != nil {
+		partitionColumns = snapshot.MetaData.PartitionColumns
+	} else if ds.mode == bulker.ReplacePartition {
+		partitionColumns = []string{deltaPartitionIdColumn}
+	}
+	if ds.mode == bulker.ReplacePartition && !utils.ArrayContains(partitionColumns, deltaPartitionIdColumn) {
+		return fmt.Errorf("Delta table %s exists but it is not partitioned by %s column", ds.table.name, deltaPartitionIdColumn)
+	}
+	if err = ds.marshaller.Flush(); err != nil {
+		return errorj.Decorate(err, "failed to flush marshaller")
+	}
+	schema, err := ds.inferDeltaSchema(currentSchema, partitionColumns)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	operation := map[string]string{"mode": "Append"}
+	if ds.mode != bulker.Batch {
+		operation["mode"] = "Overwrite"
+	}
+	if ds.mode == bulker.ReplacePartition {
+		operation["predicate"] = fmt.Sprintf("%s = '%s'", deltaPartitionIdColumn, ds.partitionId)
+	}
+	actions := []deltaAction{{CommitInfo: &deltaCommitInfo{Timestamp: now.UnixMilli(), Operation: "WRITE", OperationParameters: operation, EngineInfo: "bulker"}}}
+
+	schemaString, _ := json.Marshal(schema)
+	if snapshot.MetaData == nil {
+		actions = append(actions,
+			deltaAction{Protocol: &deltaProtocol{MinReaderVersion: 1, MinWriterVersion: 2}},
+			deltaAction{MetaData: &deltaMetaData{
+				ID:               uuid.New(),
+				Format:           deltaFormat{Provider: "parquet", Options: map[string]string{}},
+				SchemaString:     string(schemaString),
+				PartitionColumns: partitionColumns,
+				Configuration:    map[string]string{},
+				CreatedTime:      now.UnixMilli(),
+			}})
+	} else if snapshot.MetaData.SchemaString != string(schemaString) {
+		metaData := *snapshot.MetaData
+		metaData.SchemaString = string(schemaString)
+		actions = append(actions, deltaAction{MetaData: &metaData})
+	}
+	if ds.mode != bulker.Batch {
+		paths := make([]string, 0, len(snapshot.Files))
+		for filePath, file := range snapshot.Files {
+			if ds.mode == bulker.ReplacePartition {
+				value := file.PartitionValues[deltaPartitionIdColumn]
+				if value == nil || *value != ds.partitionId {
+					continue
+				}
+			}
+			paths = append(paths, filePath)
+		}
+		sort.Strings(paths)
+		for _, filePath := range paths {
+			file := snapshot.Files[filePath]
+			actions = append(actions, deltaAction{Remove: &deltaRemove{Path: filePath, DeletionTimestamp: now.UnixMilli(), DataChange: true,
+				ExtendedFileMetadata: true, PartitionValues: file.PartitionValues, Size: file.Size}})
+		}
+	}
+	if ds.eventsInBatch > 0 {
+		add, err := ds.writeDataFile(schema, partitionColumns)
+		if err != nil {
+			return err
+		}
+		actions = append(actions, deltaAction{Add: add})
+	}
+	if err = ds.table.commit(snapshot, actions); err != nil {
+		return err
+	}
+	ds.state.Representation = map[string]string{
+		"name":    ds.fileAdapter.Path(ds.table.name),
+		"version": strconv.FormatInt(snapshot.Version, 10),
+	}
+	logging.Infof("[%s] Committed version %d of Delta table %s", ds.id, snapshot.Version, ds.table.name)
+	return nil
+}
+
+// writeDataFile writes buffered objects to parquet file and uploads it to the table folder
+func (ds *DeltaLakeStream) writeDataFile(schema deltaSchema, partitionColumns []string) (*deltaAdd, error) {
+	dataFields := make([]deltaField, 0, len(schema.Fields))
+	for _, field := range schema.Fields {
+		// values of partition columns are stored in transaction log only
+		if !utils.ArrayContains(partitionColumns, field.Name) {
+			dataFields = append(dataFields, field)
+		}
+	}
+	dataFile, err := newParquetFile(path.Base(ds.batchFile.Name()), dataFields, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer dataFile.release()
+	err = ds.forEachObject(dataFile.append)
+	if err == nil {
+		err = dataFile.close()
+	}
+	if err != nil {
+		return nil, errorj.Decorate(err, "failed to write parquet file")
+	}
+	parquetFile, err := dataFile.open()
+	if err != nil {
+		return nil, err
+	}
+	defer parquetFile.Close()
+	partitionValues := map[string]*string{}
+	folder := ""
+	for _, column := range partitionColumns {
+		partitionValues[column] = nil
+	}
+	if ds.partitionId != "" {
+		partitionValues[deltaPartitionIdColumn] = &ds.partitionId
+		folder = fmt.Sprintf("%s=%s/", deltaPartitionIdColumn, utils.SanitizeString(ds.partitionId))
+	}
+	fileName := fmt.Sprintf("%spart-00000-%s-c000.snappy.parquet", folder, uuid.New())
+	loadTime := time.Now()
+	if err = ds.fileAdapter.Upload(ds.table.name+"/"+fileName, parquetFile); err != nil {
+		return nil, errorj.Decorate(err, "failed to upload parquet file")
+	}
+	logging.Infof("[%s] %s loaded to %s in %.2f s.", ds.id, dataFile, ds.fileAdapter.Type(), time.Since(loadTime).Seconds())
+	stats, _ := json.Marshal(map[string]any{"numRecords": dataFile.rows})
+	return &deltaAdd{
+		Path:             fileName,
+		PartitionValues:  partitionValues,
+		Size:             dataFile.size,
+		ModificationTime: time.Now().UnixMilli(),
+		DataChange:       true,
+		Stats:            string(stats),
+	}, nil
+}
+
+func deltaTypeOf(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case bool:
+		return deltaBoolean
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return deltaLong
+		}
+		return deltaDouble
+	case string:
+		if _, ok := types2.ReformatTimeValue(v, false); ok {
+			return deltaTimestamp
+		}
+		return deltaString
+	default:
+		return deltaString
+	}
+}
+
+// mergeDeltaTypes returns type that can hold values of both types
+func mergeDeltaTypes(a, b string) string {
+	switch {
+	case a == "" || a == b:
+		return b
+	case b == "":
+		return a
+	case (a == deltaLong && b == deltaDouble) || (a == deltaDouble && b == deltaLong):
+		return deltaDouble
+	default:
+		return deltaString
+	}
+}
+
+func deltaArrowType(deltaType string) arrow.DataType {
+	switch deltaType {
+	case deltaLong:
+		return arrow.PrimitiveTypes.Int64
+	case deltaDouble:
+		return arrow.PrimitiveTypes.Float64
+	case deltaBoolean:
+		return arrow.FixedWidthTypes.Boolean
+	case deltaTimestamp:
+		return arrow.FixedWidthTypes.Timestamp_us
+	default:
+		return arrow.BinaryTypes.String
+	}
+}
+
+// appendDeltaValue converts value to the type of column and appends it to the column builder
+func appendDeltaValue(builder array.Builder, field deltaField, value any) (err error) {
+	if value == nil {
+		builder.AppendNull()
+		return nil
+	}
+	str := fmt.Sprint(value)
+	switch b := builder.(type) {
+	case *array.Int64Builder:
+		var v int64
+		if v, err = strconv.ParseInt(str, 10, 64); err == nil {
+			b.Append(v)
+		}
+	case *array.Float64Builder:
+		var v float64
+		if v, err = strconv.ParseFloat(str, 64); err == nil {
+			b.Append(v)
+		}
+	case *array.BooleanBuilder:
+		var v bool
+		if v, err = strconv.ParseBool(str); err == nil {
+			b.Append(v)
+		}
+	case *array.TimestampBuilder:
+		if t, ok := types2.ReformatTimeValue(value, false); ok {
+			b.Append(arrow.Timestamp(t.UnixMicro()))
+		} else {
+			err = errors.New("not a timestamp")
+		}
+	case *array.StringBuilder:
+		if _, ok := value.(map[string]any); ok {
+			var v []byte
+			if v, err = jsoniter.Marshal(value); err == nil {
+				b.Append(string(v))
+			}
+		} else {
+			b.Append(str)
+		}
+	default:
+		err = fmt.Errorf("unsupported builder %T", builder)
+	}
+	if err != nil {
+		return fmt.Errorf("value '%v' of column %s can't be converted to %s: %v", value, field.Name, field.Type, err)
+	}
+	return nil
+}
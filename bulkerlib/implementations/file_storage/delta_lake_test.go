@@ -0,0 +1,91 @@
+package file_storage
+
+import (
+	"context"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/implementations"
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/uuid"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestDeltaLake(t *testing.T) {
+	if minioContainer == nil {
+		t.Skip("Delta Lake test requires minio container")
+	}
+	reqr := require.New(t)
+	blk, err := bulker.CreateBulker(bulker.Config{Id: "delta", BulkerType: S3BulkerTypeId, LogLevel: bulker.Verbose,
+		DestinationConfig: implementations.S3Config{
+			FileConfig: implementations.FileConfig{
+				Folder: "tests",
+				Format: types.FileFormatDelta,
+			},
+			Endpoint:  fmt.Sprintf("http://%s:%d", minioContainer.Host, minioContainer.Port),
+			Region:    "us-east-1",
+			Bucket:    "bulkertests",
+			AccessKey: minioContainer.AccessKey,
+			SecretKey: minioContainer.SecretKey,
+		}})
+	reqr.NoError(err)
+	defer func() {
+		_ = blk.Close()
+	}()
+	tableName := "delta_" + strings.ReplaceAll(uuid.New(), "-", "")
+	table := &deltaTable{fileAdapter: blk.(implementations.FileAdapter), name: tableName}
+
+	write := func(mode bulker.BulkMode, objects []types.Object, options ...bulker.StreamOption) {
+		stream, err := blk.CreateStream(tableName, tableName, mode, options...)
+		reqr.NoError(err)
+		for _, object := range objects {
+			_, _, err = stream.Consume(context.Background(), object)
+			reqr.NoError(err)
+		}
+		state, err := stream.Complete(context.Background())
+		reqr.NoError(err)
+		reqr.Equal(bulker.Completed, state.Status)
+	}
+	snapshot := func() (*deltaSnapshot, deltaSchema) {
+		// replay whole log to check it without cached snapshot
+		_ = table.fileAdapter.DeleteObject(table.logPath(deltaSnapshotFile))
+		s, err := table.snapshot()
+		reqr.NoError(err)
+		schema, err := s.schema()
+		reqr.NoError(err)
+		return s, schema
+	}
+
+	write(bulker.Batch, []types.Object{{"id": 1, "name": "a"}, {"id": 2, "name": "b"}})
+	write(bulker.Batch, []types.Object{{"id": 3, "name": "c", "value": 1.5}})
+	s, schema := snapshot()
+	reqr.EqualValues(1, s.Version)
+	reqr.Len(s.Files, 2)
+	reqr.Equal(deltaLong, schema.field("id").Type)
+	reqr.Equal(deltaDouble, schema.field("value").Type)
+	reqr.Equal([]string{deltaPartitionIdColumn}, s.MetaData.PartitionColumns)
+
+	partitionId := uuid.New()
+	write(bulker.ReplacePartition, []types.Object{{"id": 4, "name": "d"}}, bulker.WithPartition(partitionId))
+	write(bulker.ReplacePartition, []types.Object{{"id": 5, "name": "e"}}, bulker.WithPartition(partitionId))
+	s, _ = snapshot()
+	reqr.EqualValues(3, s.Version)
+	reqr.Len(s.Files, 3)
+	partitionFiles := 0
+	for _, add := range s.Files {
+		if v := add.PartitionValues[deltaPartitionIdColumn]; v != nil && *v == partitionId {
+			partitionFiles++
+		}
+	}
+	reqr.Equal(1, partitionFiles)
+
+	write(bulker.ReplaceTable, []types.Object{{"id": 6, "name": "f"}})
+	s, _ = snapshot()
+	reqr.EqualValues(4, s.Version)
+	reqr.Len(s.Files, 1)
+	for path := range s.Files {
+		_, err = table.fileAdapter.Download(tableName + "/" + path)
+		reqr.NoError(err)
+	}
+}
@@ -0,0 +1,241 @@
+package file_storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/jitsucom/bulker/bulkerlib/implementations"
+	"github.com/jitsucom/bulker/jitsubase/errorj"
+	"github.com/jitsucom/bulker/jitsubase/logging"
+	"strings"
+)
+
+const (
+	deltaLogFolder = "_delta_log"
+	// deltaSnapshotFile cache of table state replayed from transaction log. Delta readers ignore unknown files in _delta_log
+	deltaSnapshotFile = "_bulker_snapshot.json"
+	// deltaLastCheckpointFile is written by engines that compact transaction log into parquet checkpoints
+	deltaLastCheckpointFile = "_last_checkpoint"
+)
+
+// Delta Lake column types supported by writer
+const (
+	deltaString    = "string"
+	deltaLong      = "long"
+	deltaDouble    = "double"
+	deltaBoolean   = "boolean"
+	deltaTimestamp = "timestamp"
+)
+
+type deltaField struct {
+	Name     string         `json:"name"`
+	Type     string         `json:"type"`
+	Nullable bool           `json:"nullable"`
+	Metadata map[string]any `json:"metadata"`
+}
+
+type deltaSchema struct {
+	Type   string       `json:"type"`
+	Fields []deltaField `json:"fields"`
+}
+
+func (ds *deltaSchema) field(name string) *deltaField {
+	for i := range ds.Fields {
+		if ds.Fields[i].Name == name {
+			return &ds.Fields[i]
+		}
+	}
+	return nil
+}
+
+type deltaFormat struct {
+	Provider string            `json:"provider"`
+	Options  map[string]string `json:"options"`
+}
+
+type deltaMetaData struct {
+	ID               string            `json:"id"`
+	Format           deltaFormat       `json:"format"`
+	SchemaString     string            `json:"schemaString"`
+	PartitionColumns []string          `json:"partitionColumns"`
+	Configuration    map[string]string `json:"configuration"`
+	CreatedTime      int64             `json:"createdTime,omitempty"`
+}
+
+type deltaProtocol struct {
+	MinReaderVersion int `json:"minReaderVersion"`
+	MinWriterVersion int `json:"minWriterVersion"`
+}
+
+type deltaAdd struct {
+	Path             string             `json:"path"`
+	PartitionValues  map[string]*string `json:"partitionValues"`
+	Size             int64              `json:"size"`
+	ModificationTime int64              `json:"modificationTime"`
+	DataChange       bool               `json:"dataChange"`
+	Stats            string             `json:"stats,omitempty"`
+}
+
+type deltaRemove struct {
+	Path                 string             `json:"path"`
+	DeletionTimestamp    int64              `json:"deletionTimestamp"`
+	DataChange           bool               `json:"dataChange"`
+	ExtendedFileMetadata bool               `json:"extendedFileMetadata"`
+	PartitionValues      map[string]*string `json:"partitionValues"`
+	Size                 int64              `json:"size"`
+}
+
+type deltaCommitInfo struct {
+	Timestamp           int64             `json:"timestamp"`
+	Operation           string            `json:"operation"`
+	OperationParameters map[string]string `json:"operationParameters"`
+	EngineInfo          string            `json:"engineInfo"`
+}
+
+// deltaAction single line of Delta transaction log commit file
+type deltaAction struct {
+	CommitInfo *deltaCommitInfo `json:"commitInfo,omitempty"`
+	Protocol   *deltaProtocol   `json:"protocol,omitempty"`
+	MetaData   *deltaMetaData   `json:"metaData,omitempty"`
+	Add        *deltaAdd        `json:"add,omitempty"`
+	Remove     *deltaRemove     `json:"remove,omitempty"`
+}
+
+// deltaSnapshot state of Delta table at Version: current metadata and active data files
+type deltaSnapshot struct {
+	// Version of the last commit. -1 if table doesn't exist
+	Version  int64                `json:"version"`
+	MetaData *deltaMetaData       `json:"metaData,omitempty"`
+	Files    map[string]*deltaAdd `json:"files"`
+}
+
+func (s *deltaSnapshot) apply(action deltaAction) {
+	if action.MetaData != nil {
+		s.MetaData = action.MetaData
+	}
+	if action.Add != nil {
+		s.Files[action.Add.Path] = action.Add
+	}
+	if action.Remove != nil {
+		delete(s.Files, action.Remove.Path)
+	}
+}
+
+func (s *deltaSnapshot) schema() (deltaSchema, error) {
+	schema := deltaSchema{Type: "struct", Fields: []deltaField{}}
+	if s.MetaData == nil {
+		return schema, nil
+	}
+	if err := json.Unmarshal([]byte(s.MetaData.SchemaString), &schema); err != nil {
+		return schema, fmt.Errorf("failed to parse Delta table schema: %v", err)
+	}
+	return schema, nil
+}
+
+// deltaTable reads and commits transaction log of Delta table stored in 'name' folder of file adapter.
+// Only one writer per table is supported: commits made concurrently by other writers may be lost.
+type deltaTable struct {
+	fileAdapter implementations.FileAdapter
+	name        string
+}
+
+func (t *deltaTable) logPath(file string) string {
+	return fmt.Sprintf("%s/%s/%s", t.name, deltaLogFolder, file)
+}
+
+func (t *deltaTable) commitPath(version int64) string {
+	return t.logPath(fmt.Sprintf("%020d.json", version))
+}
+
+// snapshot loads cached snapshot and replays commits made after it
+func (t *deltaTable) snapshot() (*deltaSnapshot, error) {
+	snapshot := &deltaSnapshot{Version: -1, Files: map[string]*deltaAdd{}}
+	data, err := t.fileAdapter.Download(t.logPath(deltaSnapshotFile))
+	if err == nil {
+		cached := &deltaSnapshot{}
+		if err = json.Unmarshal(data, cached); err == nil && cached.Files != nil {
+			snapshot = cached
+		} else {
+			logging.Warnf("Ignoring malformed snapshot of Delta table %s: %v", t.name, err)
+		}
+	} else if !implementations.IsFileNotFoundError(err) {
+		return nil, err
+	}
+	for {
+		data, err = t.fileAdapter.Download(t.commitPath(snapshot.Version + 1))
+		if err != nil {
+			if !implementations.IsFileNotFoundError(err) {
+				return nil, err
+			}
+			break
+		}
+		actions, err := parseDeltaCommit(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse commit %d of Delta table %s: %v", snapshot.Version+1, t.name, err)
+		}
+		for _, action := range actions {
+			snapshot.apply(action)
+		}
+		snapshot.Version++
+	}
+	if snapshot.Version == -1 {
+		// log of table written by other engine may be compacted into checkpoints and old commits removed
+		if _, err = t.fileAdapter.Download(t.logPath(deltaLastCheckpointFile)); err == nil {
+			return nil, fmt.Errorf("Delta table %s has checkpoints written by other engine. Appending to such tables is not supported", t.name)
+		} else if !implementations.IsFileNotFoundError(err) {
+			return nil, err
+		}
+	}
+	return snapshot, nil
+}
+
+// commit writes actions as the next version of the table and applies them to snapshot
+func (t *deltaTable) commit(snapshot *deltaSnapshot, actions []deltaAction) error {
+	version := snapshot.Version + 1
+	buf := bytes.Buffer{}
+	for _, action := range actions {
+		line, err := json.Marshal(action)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	// storages don't support conditional writes: check protects from overwriting commits made since snapshot was loaded
+	if _, err := t.fileAdapter.Download(t.commitPath(version)); err == nil {
+		return fmt.Errorf("version %d of Delta table %s was committed concurrently", version, t.name)
+	} else if !implementations.IsFileNotFoundError(err) {
+		return err
+	}
+	if err := t.fileAdapter.UploadBytes(t.commitPath(version), buf.Bytes()); err != nil {
+		return errorj.Decorate(err, "failed to write commit to Delta transaction log")
+	}
+	for _, action := range actions {
+		snapshot.apply(action)
+	}
+	snapshot.Version = version
+	// snapshot is only a cache of transaction log. It is replayed from log when missing
+	data, err := json.Marshal(snapshot)
+	if err == nil {
+		err = t.fileAdapter.UploadBytes(t.logPath(deltaSnapshotFile), data)
+	}
+	if err != nil {
+		logging.Warnf("Failed to save snapshot of Delta table %s: %v", t.name, err)
+	}
+	return nil
+}
+
+func parseDeltaCommit(data []byte) ([]deltaAction, error) {
+	var actions []deltaAction
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		action := deltaAction{}
+		if err := json.Unmarshal([]byte(line), &action); err != nil {
+			return nil, err
+		}
+		actions = append(actions, action)
+	}
+	return actions, nil
+}
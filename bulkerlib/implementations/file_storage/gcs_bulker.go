@@ -5,6 +5,7 @@ import (
 	"fmt"
 	bulker "github.com/jitsucom/bulker/bulkerlib"
 	implementations2 "github.com/jitsucom/bulker/bulkerlib/implementations"
+	"github.com/jitsucom/bulker/bulkerlib/types"
 	"github.com/jitsucom/bulker/jitsubase/utils"
 )
 
@@ -13,12 +14,16 @@ const GCSAutocommitUnsupported = "Stream mode is not supported for GCS. Please u
 
 func init() {
 	bulker.RegisterBulker(GCSBulkerTypeId, NewGCSBulker)
+	bulker.RegisterConfigType(GCSBulkerTypeId, GCSConfig{})
 }
 
 type GCSConfig struct {
 	implementations2.FileConfig `mapstructure:",squash" json:",inline" yaml:",inline"`
 	Bucket                      string `mapstructure:"bucket,omitempty" json:"bucket,omitempty" yaml:"bucket,omitempty"`
-	AccessKey                   any    `mapstructure:"accessKey,omitempty" json:"accessKey,omitempty" yaml:"accessKey,omitempty"`
+	// AccessKey service account key JSON or "workload_identity" to use credentials of the environment
+	AccessKey any `mapstructure:"accessKey,omitempty" json:"accessKey,omitempty" yaml:"accessKey,omitempty"`
+
+	implementations2.GCSObjectConfig `mapstructure:",squash" json:",inline" yaml:",inline"`
 }
 type GCSBulker struct {
 	implementations2.GoogleCloudStorage
@@ -33,6 +38,8 @@ func NewGCSBulker(bulkerConfig bulker.Config) (bulker.Bulker, error) {
 		FileConfig: gcsConfig.FileConfig,
 		Bucket:     gcsConfig.Bucket,
 		KeyFile:    gcsConfig.AccessKey,
+		// resumable uploads, encryption key and storage class
+		GCSObjectConfig: gcsConfig.GCSObjectConfig,
 	}
 	//TODO: auto recoonect the same way as in SQL bulkers
 	gcsAdapter, err := implementations2.NewGoogleCloudStorage(&googleConfig)
@@ -43,6 +50,12 @@ func NewGCSBulker(bulkerConfig bulker.Config) (bulker.Bulker, error) {
 }
 
 func (gcs *GCSBulker) CreateStream(id, tableName string, mode bulker.BulkMode, streamOptions ...bulker.StreamOption) (bulker.BulkerStream, error) {
+	if gcs.Format() == types.FileFormatDelta && mode != bulker.Stream {
+		return NewDeltaLakeStream(id, gcs, tableName, mode, streamOptions...)
+	}
+	if gcs.Format() == types.FileFormatHudi && mode != bulker.Stream {
+		return NewHudiStream(id, gcs, tableName, mode, streamOptions...)
+	}
 	switch mode {
 	case bulker.Stream:
 		return nil, errors.New(GCSAutocommitUnsupported)
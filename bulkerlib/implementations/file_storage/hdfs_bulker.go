@@ -0,0 +1,51 @@
+package file_storage
+
+import (
+	"errors"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/implementations"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+)
+
+const HDFSBulkerTypeId = "hdfs"
+const HDFSAutocommitUnsupported = "Stream mode is not supported for HDFS. Please use 'batch' mode"
+
+func init() {
+	bulker.RegisterBulker(HDFSBulkerTypeId, NewHDFSBulker)
+	bulker.RegisterConfigType(HDFSBulkerTypeId, implementations.HDFSConfig{})
+}
+
+type HDFSBulker struct {
+	implementations.HDFS
+}
+
+func NewHDFSBulker(bulkerConfig bulker.Config) (bulker.Bulker, error) {
+	hdfsConfig := &implementations.HDFSConfig{}
+	if err := utils.ParseObject(bulkerConfig.DestinationConfig, hdfsConfig); err != nil {
+		return nil, fmt.Errorf("failed to parse destination config: %v", err)
+	}
+	hdfsAdapter, err := implementations.NewHDFS(hdfsConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &HDFSBulker{*hdfsAdapter}, nil
+}
+
+func (hb *HDFSBulker) CreateStream(id, tableName string, mode bulker.BulkMode, streamOptions ...bulker.StreamOption) (bulker.BulkerStream, error) {
+	switch mode {
+	case bulker.Stream:
+		return nil, errors.New(HDFSAutocommitUnsupported)
+	case bulker.Batch:
+		return NewTransactionalStream(id, hb, tableName, streamOptions...)
+	case bulker.ReplaceTable:
+		return NewReplaceTableStream(id, hb, tableName, streamOptions...)
+	case bulker.ReplacePartition:
+		return NewReplacePartitionStream(id, hb, tableName, streamOptions...)
+	}
+	return nil, fmt.Errorf("unsupported bulk mode: %s", mode)
+}
+
+func (hb *HDFSBulker) Type() string {
+	return HDFSBulkerTypeId
+}
@@ -0,0 +1,399 @@
+package file_storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/implementations"
+	types2 "github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/errorj"
+	"github.com/jitsucom/bulker/jitsubase/logging"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"github.com/jitsucom/bulker/jitsubase/uuid"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// hudiPartitionIdColumn partition column of tables written in ReplacePartition mode
+const hudiPartitionIdColumn = "__partition_id"
+
+// hudiWriteToken write token part of data file names. Bulker writes each file in a single attempt
+const hudiWriteToken = "0-0-0"
+
+// HudiStream writes batch to Hudi copy-on-write table: parquet base files and an instant in the .hoodie timeline.
+// Batch mode inserts records into a new file group. With deduplication enabled (WithDeduplicate and WithPrimaryKey)
+// table is keyed by primary key columns and batch is upserted: file groups containing keys of the batch are rewritten
+// with updated records, records with new keys are inserted into a new file group.
+// ReplaceTable mode replaces all file groups of the table,
+// ReplacePartition mode replaces file groups of the partition identified by __partition_id partition column.
+type HudiStream struct {
+	AbstractFileStorageStream
+	table       *hudiTable
+	partitionId string
+}
+
+func NewHudiStream(id string, p implementations.FileAdapter, tableName string, mode bulker.BulkMode, streamOptions ...bulker.StreamOption) (bulker.BulkerStream, error) {
+	switch mode {
+	case bulker.Batch, bulker.ReplaceTable, bulker.ReplacePartition:
+	default:
+		return nil, fmt.Errorf("unsupported bulk mode for Hudi table: %s", mode)
+	}
+	hs := HudiStream{table: &hudiTable{fileAdapter: p, name: tableName}}
+	var err error
+	hs.AbstractFileStorageStream, err = newAbstractFileStorageStream(id, p, tableName, func(ctx context.Context) string {
+		return tableName
+	}, mode, streamOptions...)
+	if err != nil {
+		return nil, err
+	}
+	// record key fields of Hudi table are ordered
+	sort.Strings(hs.pkColumns)
+	if mode == bulker.ReplacePartition {
+		hs.partitionId = bulker.PartitionIdOption.Get(&hs.options)
+		if hs.partitionId == "" {
+			return nil, errors.New("WithPartition is required option for ReplacePartitionStream")
+		}
+	}
+	return &hs, nil
+}
+
+// init creates batch file where flattened objects are buffered as ndjson until Complete
+func (hs *HudiStream) init() (err error) {
+	if hs.inited {
+		return nil
+	}
+	hs.batchFile, err = os.CreateTemp("", fmt.Sprintf("bulker_%s", utils.SanitizeString(hs.id)))
+	if err != nil {
+		return err
+	}
+	hs.marshaller, _ = types2.NewMarshaller(types2.FileFormatNDJSON, types2.FileCompressionNONE)
+	hs.flatten = true
+	hs.inited = true
+	return nil
+}
+
+func (hs *HudiStream) Consume(ctx context.Context, object types2.Object) (state bulker.State, processedObject types2.Object, err error) {
+	defer func() {
+		err = hs.postConsume(err)
+		state = hs.state
+	}()
+	if err = hs.init(); err != nil {
+		return
+	}
+	processedObject, err = hs.preprocess(object)
+	if err != nil {
+		return
+	}
+	if hs.partitionId != "" {
+		processedObject[hudiPartitionIdColumn] = hs.partitionId
+	}
+	err = hs.writeToBatchFile(ctx, processedObject)
+	return
+}
+
+func (hs *HudiStream) ConsumeBatch(ctx context.Context, objects []types2.Object) (state bulker.State, processedObjects []types2.Object, err error) {
+	return bulker.ConsumeEach(ctx, hs, objects)
+}
+
+func (hs *HudiStream) Complete(ctx context.Context) (state bulker.State, err error) {
+	if hs.state.Status != bulker.Active {
+		return hs.state, errors.New("stream is not active")
+	}
+	if err = hs.init(); err != nil {
+		return hs.state, err
+	}
+	defer func() {
+		state, err = hs.postComplete(err)
+	}()
+	if hs.state.LastError != nil {
+		err = hs.state.LastError
+		return
+	}
+	if hs.state.SuccessfulRows == 0 && hs.mode == bulker.Batch {
+		return
+	}
+	err = hs.commit()
+	return
+}
+
+// hudiFileWriter base file of file group written by commit
+type hudiFileWriter struct {
+	fileId     string
+	fileName   string
+	prevCommit string
+	file       *parquetFile
+	inserts    int64
+	updates    int64
+}
+
+// commit writes base files and completes instant on the timeline
+func (hs *HudiStream) commit() (err error) {
+	snapshot, err := hs.table.snapshot()
+	if err != nil {
+		return errorj.Decorate(err, "failed to read state of Hudi table")
+	}
+	if snapshot.Instant == "" {
+		if hs.mode == bulker.ReplacePartition {
+			snapshot.PartitionFields = []string{hudiPartitionIdColumn}
+		}
+		if hs.merge {
+			snapshot.RecordKeyFields = hs.pkColumns
+			snapshot.PrecombineField = hs.timestampColumn
+		}
+	}
+	if hs.mode == bulker.ReplacePartition && !slices.Equal(snapshot.PartitionFields, []string{hudiPartitionIdColumn}) {
+		return fmt.Errorf("Hudi table %s exists but it is not partitioned by %s column", hs.table.name, hudiPartitionIdColumn)
+	}
+	if hs.merge && !slices.Equal(snapshot.RecordKeyFields, hs.pkColumns) {
+		return fmt.Errorf("Hudi table %s has record key fields [%s] that don't match primary key [%s]", hs.table.name,
+			strings.Join(snapshot.RecordKeyFields, ","), strings.Join(hs.pkColumns, ","))
+	}
+	if err = hs.marshaller.Flush(); err != nil {
+		return errorj.Decorate(err, "failed to flush marshaller")
+	}
+	schema, err := hs.inferDeltaSchema(snapshot.Schema, snapshot.PartitionFields)
+	if err != nil {
+		return err
+	}
+	snapshot.Schema = schema
+	partitionPath := ""
+	if len(snapshot.PartitionFields) > 0 {
+		partitionPath = hudiPartitionIdColumn + "=" + utils.DefaultString(utils.SanitizeString(hs.partitionId), hudiDefaultPartition)
+	}
+
+	action, operation := hudiCommitAction, "INSERT"
+	var replacedFileIds []string
+	switch {
+	case hs.mode == bulker.ReplaceTable:
+		action, operation = hudiReplaceCommitAction, "INSERT_OVERWRITE_TABLE"
+	case hs.mode == bulker.ReplacePartition:
+		action, operation = hudiReplaceCommitAction, "INSERT_OVERWRITE"
+	case hs.merge:
+		operation = "UPSERT"
+	}
+	instant := hs.table.newInstant(snapshot)
+	if err = hs.table.begin(snapshot, instant, action); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			hs.table.abort(instant, action)
+		}
+	}()
+	metadata := hudiCommitMetadata{
+		PartitionToWriteStats: map[string][]hudiWriteStat{},
+		ExtraMetadata:         map[string]string{"schema": hudiAvroSchema(hs.table.tableName(), schema)},
+		OperationType:         operation,
+	}
+	if action == hudiReplaceCommitAction {
+		metadata.PartitionToReplaceFileIds = map[string][]string{}
+		for groupPartition, fileGroups := range snapshot.FileGroups {
+			if hs.mode == bulker.ReplacePartition && groupPartition != partitionPath {
+				continue
+			}
+			replacedFileIds = make([]string, 0, len(fileGroups))
+			for fileId := range fileGroups {
+				replacedFileIds = append(replacedFileIds, fileId)
+			}
+			sort.Strings(replacedFileIds)
+			metadata.PartitionToReplaceFileIds[groupPartition] = replacedFileIds
+		}
+	}
+	writers, err := hs.writeBaseFiles(snapshot, schema, instant, partitionPath)
+	defer func() {
+		for _, writer := range writers {
+			writer.file.release()
+		}
+	}()
+	if err != nil {
+		return err
+	}
+	if _, ok := snapshot.FileGroups[partitionPath]; !ok {
+		if err = hs.table.fileAdapter.UploadBytes(hs.table.path(path.Join(partitionPath, hudiPartitionMetadataFile)), hudiPartitionMetadata(instant, partitionPath)); err != nil {
+			return errorj.Decorate(err, "failed to write Hudi partition metadata")
+		}
+	}
+	newSlices := make([]*hudiFileSlice, 0, len(writers))
+	rows := int64(0)
+	for _, writer := range writers {
+		filePath := path.Join(partitionPath, writer.fileName)
+		if err = hs.uploadBaseFile(filePath, writer.file); err != nil {
+			return err
+		}
+		rows += int64(writer.file.rows)
+		metadata.PartitionToWriteStats[partitionPath] = append(metadata.PartitionToWriteStats[partitionPath], hudiWriteStat{
+			FileID:          writer.fileId,
+			Path:            filePath,
+			PrevCommit:      utils.DefaultString(writer.prevCommit, "null"),
+			NumWrites:       int64(writer.file.rows),
+			NumUpdateWrites: writer.updates,
+			NumInserts:      writer.inserts,
+			TotalWriteBytes: writer.file.size,
+			PartitionPath:   partitionPath,
+			FileSizeInBytes: writer.file.size,
+		})
+		newSlices = append(newSlices, &hudiFileSlice{FileID: writer.fileId, Path: filePath, Instant: instant, Rows: int64(writer.file.rows), Size: writer.file.size})
+	}
+	if err = hs.table.commit(snapshot, instant, action, metadata, map[string][]*hudiFileSlice{partitionPath: newSlices}); err != nil {
+		return err
+	}
+	hs.state.Representation = map[string]string{
+		"name":    hs.fileAdapter.Path(hs.table.name),
+		"instant": instant,
+	}
+	logging.Infof("[%s] Committed %s %s of Hudi table %s: %d rows in %d files", hs.id, action, instant, hs.table.name, rows, len(writers))
+	return nil
+}
+
+// writeBaseFiles writes batch to local parquet files. In upsert mode file groups of the partition that contain keys of the batch
+// are rewritten: their records that are not updated are kept with original commit time
+func (hs *HudiStream) writeBaseFiles(snapshot *hudiSnapshot, schema deltaSchema, instant, partitionPath string) ([]*hudiFileWriter, error) {
+	fields := make([]deltaField, 0, len(hudiMetaColumns)+len(schema.Fields))
+	for _, column := range hudiMetaColumns {
+		fields = append(fields, deltaField{Name: column, Type: deltaString})
+	}
+	fields = append(fields, schema.Fields...)
+	writers := make([]*hudiFileWriter, 0)
+	newWriter := func(fileId, prevCommit string) (*hudiFileWriter, error) {
+		file, err := newParquetFile(path.Base(hs.batchFile.Name()), fields, nil)
+		if err != nil {
+			return nil, err
+		}
+		writer := &hudiFileWriter{fileId: fileId, fileName: fmt.Sprintf("%s_%s_%s.parquet", fileId, hudiWriteToken, instant), prevCommit: prevCommit, file: file}
+		writers = append(writers, writer)
+		return writer, nil
+	}
+	// file groups containing keys of the batch
+	keyWriters := map[string]*hudiFileWriter{}
+	if hs.merge && hs.mode == bulker.Batch && len(snapshot.FileGroups[partitionPath]) > 0 {
+		batchKeys := utils.NewSet[string]()
+		err := hs.forEachObject(func(object map[string]any) error {
+			key, err := hs.recordKey(snapshot, object, instant, 0)
+			batchKeys.Put(key)
+			return err
+		})
+		if err != nil {
+			return writers, err
+		}
+		fileIds := make([]string, 0, len(snapshot.FileGroups[partitionPath]))
+		for fileId := range snapshot.FileGroups[partitionPath] {
+			fileIds = append(fileIds, fileId)
+		}
+		sort.Strings(fileIds)
+		for _, fileId := range fileIds {
+			if err = hs.rewriteFileGroup(snapshot.FileGroups[partitionPath][fileId], batchKeys, keyWriters, newWriter); err != nil {
+				return writers, err
+			}
+		}
+	}
+	var insertWriter *hudiFileWriter
+	seqNo := 0
+	err := hs.forEachObject(func(object map[string]any) error {
+		key, err := hs.recordKey(snapshot, object, instant, seqNo)
+		if err != nil {
+			return err
+		}
+		writer, ok := keyWriters[key]
+		if ok {
+			writer.updates++
+		} else {
+			if insertWriter == nil {
+				if insertWriter, err = newWriter(uuid.New()+"-0", ""); err != nil {
+					return err
+				}
+			}
+			writer = insertWriter
+			writer.inserts++
+		}
+		object[hudiCommitTimeColumn] = instant
+		object[hudiCommitSeqnoColumn] = fmt.Sprintf("%s_%d_%d", instant, slices.Index(writers, writer), seqNo)
+		object[hudiRecordKeyColumn] = key
+		object[hudiPartitionPathColumn] = partitionPath
+		object[hudiFileNameColumn] = writer.fileName
+		seqNo++
+		return writer.file.append(object)
+	})
+	if err != nil {
+		return writers, err
+	}
+	for _, writer := range writers {
+		if err = writer.file.close(); err != nil {
+			return writers, errorj.Decorate(err, "failed to write parquet file")
+		}
+	}
+	return writers, nil
+}
+
+// rewriteFileGroup starts new file slice of file group if it contains any of batch keys. Records that are not updated are copied to it
+func (hs *HudiStream) rewriteFileGroup(slice *hudiFileSlice, batchKeys utils.Set[string], keyWriters map[string]*hudiFileWriter,
+	newWriter func(fileId, prevCommit string) (*hudiFileWriter, error)) error {
+	data, err := hs.table.fileAdapter.Download(hs.table.path(slice.Path))
+	if err != nil {
+		return errorj.Decorate(err, "failed to download Hudi base file")
+	}
+	var writer *hudiFileWriter
+	var retained []map[string]any
+	err = readParquetObjects(data, func(object map[string]any) error {
+		key := fmt.Sprint(object[hudiRecordKeyColumn])
+		if !batchKeys.Contains(key) {
+			retained = append(retained, object)
+			return nil
+		}
+		if writer == nil {
+			if writer, err = newWriter(slice.FileID, slice.Instant); err != nil {
+				return err
+			}
+		}
+		keyWriters[key] = writer
+		return nil
+	})
+	if err != nil || writer == nil {
+		return err
+	}
+	for _, object := range retained {
+		object[hudiFileNameColumn] = writer.fileName
+		if err = writer.file.append(object); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordKey returns value of _hoodie_record_key: value of the single key field, 'field1:value1,field2:value2' for multiple fields
+// or generated unique key for tables without record key fields
+func (hs *HudiStream) recordKey(snapshot *hudiSnapshot, object map[string]any, instant string, seqNo int) (string, error) {
+	if len(snapshot.RecordKeyFields) == 0 {
+		return fmt.Sprintf("%s_0_%d", instant, seqNo), nil
+	}
+	parts := make([]string, len(snapshot.RecordKeyFields))
+	for i, field := range snapshot.RecordKeyFields {
+		value, ok := object[field]
+		if !ok || value == nil {
+			return "", fmt.Errorf("value of record key field %s is missing", field)
+		}
+		if len(snapshot.RecordKeyFields) == 1 {
+			return fmt.Sprint(value), nil
+		}
+		parts[i] = field + ":" + fmt.Sprint(value)
+	}
+	return strings.Join(parts, ","), nil
+}
+
+func (hs *HudiStream) uploadBaseFile(filePath string, file *parquetFile) error {
+	reader, err := file.open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	loadTime := time.Now()
+	if err = hs.table.fileAdapter.Upload(hs.table.path(filePath), reader); err != nil {
+		return errorj.Decorate(err, "failed to upload parquet file")
+	}
+	logging.Infof("[%s] %s loaded to %s in %.2f s.", hs.id, file, hs.fileAdapter.Type(), time.Since(loadTime).Seconds())
+	return nil
+}
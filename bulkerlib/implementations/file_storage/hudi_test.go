@@ -0,0 +1,99 @@
+package file_storage
+
+import (
+	"context"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/implementations"
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/uuid"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestHudi(t *testing.T) {
+	if minioContainer == nil {
+		t.Skip("Hudi test requires minio container")
+	}
+	reqr := require.New(t)
+	blk, err := bulker.CreateBulker(bulker.Config{Id: "hudi", BulkerType: S3BulkerTypeId, LogLevel: bulker.Verbose,
+		DestinationConfig: implementations.S3Config{
+			FileConfig: implementations.FileConfig{
+				Folder: "tests",
+				Format: types.FileFormatHudi,
+			},
+			Endpoint:  fmt.Sprintf("http://%s:%d", minioContainer.Host, minioContainer.Port),
+			Region:    "us-east-1",
+			Bucket:    "bulkertests",
+			AccessKey: minioContainer.AccessKey,
+			SecretKey: minioContainer.SecretKey,
+		}})
+	reqr.NoError(err)
+	defer func() {
+		_ = blk.Close()
+	}()
+	tableName := "hudi_" + strings.ReplaceAll(uuid.New(), "-", "")
+	table := &hudiTable{fileAdapter: blk.(implementations.FileAdapter), name: tableName}
+
+	write := func(mode bulker.BulkMode, objects []types.Object, options ...bulker.StreamOption) {
+		stream, err := blk.CreateStream(tableName, tableName, mode, options...)
+		reqr.NoError(err)
+		for _, object := range objects {
+			_, _, err = stream.Consume(context.Background(), object)
+			reqr.NoError(err)
+		}
+		state, err := stream.Complete(context.Background())
+		reqr.NoError(err)
+		reqr.Equal(bulker.Completed, state.Status)
+	}
+	// rows returns records of the latest file slices by record key
+	rows := func() (*hudiSnapshot, map[string]map[string]any) {
+		s, err := table.snapshot()
+		reqr.NoError(err)
+		result := map[string]map[string]any{}
+		for _, fileGroups := range s.FileGroups {
+			for _, slice := range fileGroups {
+				data, err := table.fileAdapter.Download(table.path(slice.Path))
+				reqr.NoError(err)
+				reqr.NoError(readParquetObjects(data, func(object map[string]any) error {
+					result[object[hudiRecordKeyColumn].(string)] = object
+					return nil
+				}))
+			}
+		}
+		return s, result
+	}
+
+	upsert := []bulker.StreamOption{bulker.WithPrimaryKey("id"), bulker.WithDeduplicate()}
+	write(bulker.Batch, []types.Object{{"id": 1, "name": "a"}, {"id": 2, "name": "b"}}, upsert...)
+	write(bulker.Batch, []types.Object{{"id": 2, "name": "b2", "value": 1.5}, {"id": 3, "name": "c"}, {"id": 3, "name": "c2"}}, upsert...)
+	s, records := rows()
+	reqr.Equal([]string{"id"}, s.RecordKeyFields)
+	reqr.Len(s.FileGroups[""], 2)
+	reqr.Len(records, 3)
+	reqr.Equal("a", records["1"]["name"])
+	reqr.Equal("b2", records["2"]["name"])
+	reqr.Equal(1.5, records["2"]["value"])
+	reqr.Equal("c2", records["3"]["name"])
+	// not updated record keeps commit time of its insert
+	reqr.NotEqual(records["1"][hudiCommitTimeColumn], records["2"][hudiCommitTimeColumn])
+
+	write(bulker.ReplaceTable, []types.Object{{"id": 4, "name": "d"}}, upsert...)
+	s, records = rows()
+	reqr.Len(s.FileGroups[""], 1)
+	reqr.Len(records, 1)
+	_, err = table.fileAdapter.Download(table.metaPath(s.Instant + "." + hudiReplaceCommitAction))
+	reqr.NoError(err)
+
+	tableName += "_partitioned"
+	table.name = tableName
+	partitionId := uuid.New()
+	write(bulker.ReplacePartition, []types.Object{{"id": 1}, {"id": 2}}, bulker.WithPartition(partitionId))
+	write(bulker.ReplacePartition, []types.Object{{"id": 3}}, bulker.WithPartition(uuid.New()))
+	write(bulker.ReplacePartition, []types.Object{{"id": 4}}, bulker.WithPartition(partitionId))
+	s, records = rows()
+	reqr.Equal([]string{hudiPartitionIdColumn}, s.PartitionFields)
+	reqr.Len(s.FileGroups, 2)
+	reqr.Len(records, 2)
+}
@@ -0,0 +1,294 @@
+package file_storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/jitsucom/bulker/bulkerlib/implementations"
+	"github.com/jitsucom/bulker/jitsubase/errorj"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	hudiMetaFolder     = ".hoodie"
+	hudiPropertiesFile = "hoodie.properties"
+	// hudiSnapshotFile state of table maintained by bulker: storages don't support listing, so timeline can't be replayed.
+	// Hudi ignores files of .aux folder
+	hudiSnapshotFile          = ".aux/bulker_snapshot.json"
+	hudiPartitionMetadataFile = ".hoodie_partition_metadata"
+	// hudiDefaultPartition partition of rows with null value of partition column
+	hudiDefaultPartition = "__HIVE_DEFAULT_PARTITION__"
+)
+
+// Hudi timeline actions
+const (
+	hudiCommitAction        = "commit"
+	hudiReplaceCommitAction = "replacecommit"
+)
+
+// Hudi meta columns. They precede data columns in every data file
+const (
+	hudiCommitTimeColumn    = "_hoodie_commit_time"
+	hudiCommitSeqnoColumn   = "_hoodie_commit_seqno"
+	hudiRecordKeyColumn     = "_hoodie_record_key"
+	hudiPartitionPathColumn = "_hoodie_partition_path"
+	hudiFileNameColumn      = "_hoodie_file_name"
+)
+
+var hudiMetaColumns = []string{hudiCommitTimeColumn, hudiCommitSeqnoColumn, hudiRecordKeyColumn, hudiPartitionPathColumn, hudiFileNameColumn}
+
+// hudiWriteStat stats of file slice written by commit
+type hudiWriteStat struct {
+	FileID           string `json:"fileId"`
+	Path             string `json:"path"`
+	PrevCommit       string `json:"prevCommit"`
+	NumWrites        int64  `json:"numWrites"`
+	NumDeletes       int64  `json:"numDeletes"`
+	NumUpdateWrites  int64  `json:"numUpdateWrites"`
+	NumInserts       int64  `json:"numInserts"`
+	TotalWriteBytes  int64  `json:"totalWriteBytes"`
+	TotalWriteErrors int64  `json:"totalWriteErrors"`
+	PartitionPath    string `json:"partitionPath"`
+	FileSizeInBytes  int64  `json:"fileSizeInBytes"`
+}
+
+// hudiCommitMetadata content of completed commit and replacecommit instants
+type hudiCommitMetadata struct {
+	PartitionToWriteStats     map[string][]hudiWriteStat `json:"partitionToWriteStats"`
+	PartitionToReplaceFileIds map[string][]string        `json:"partitionToReplaceFileIds,omitempty"`
+	Compacted                 bool                       `json:"compacted"`
+	ExtraMetadata             map[string]string          `json:"extraMetadata"`
+	OperationType             string                     `json:"operationType"`
+}
+
+// hudiFileSlice the latest base file of file group
+type hudiFileSlice struct {
+	FileID  string `json:"fileId"`
+	Path    string `json:"path"`
+	Instant string `json:"instant"`
+	Rows    int64  `json:"rows"`
+	Size    int64  `json:"size"`
+}
+
+// hudiSnapshot state of Hudi table as of the last completed Instant
+type hudiSnapshot struct {
+	// Instant of the last commit. Empty if table doesn't exist
+	Instant         string      `json:"instant"`
+	Schema          deltaSchema `json:"schema"`
+	RecordKeyFields []string    `json:"recordKeyFields"`
+	PartitionFields []string    `json:"partitionFields"`
+	PrecombineField string      `json:"precombineField,omitempty"`
+	// FileGroups latest file slices by partition path and file id
+	FileGroups map[string]map[string]*hudiFileSlice `json:"fileGroups"`
+}
+
+// hudiTable reads state and commits instants to the timeline of Hudi copy-on-write table stored in 'name' folder of file adapter.
+// Only one writer per table is supported: commits made concurrently by other writers may be lost.
+type hudiTable struct {
+	fileAdapter implementations.FileAdapter
+	name        string
+}
+
+func (t *hudiTable) path(file string) string {
+	return t.name + "/" + file
+}
+
+func (t *hudiTable) metaPath(file string) string {
+	return fmt.Sprintf("%s/%s/%s", t.name, hudiMetaFolder, file)
+}
+
+// snapshot loads state of the table
+func (t *hudiTable) snapshot() (*hudiSnapshot, error) {
+	snapshot := &hudiSnapshot{Schema: deltaSchema{Type: "struct", Fields: []deltaField{}}, FileGroups: map[string]map[string]*hudiFileSlice{}}
+	data, err := t.fileAdapter.Download(t.metaPath(hudiSnapshotFile))
+	if err == nil {
+		if err = json.Unmarshal(data, snapshot); err != nil {
+			return nil, fmt.Errorf("failed to parse state of Hudi table %s: %v", t.name, err)
+		}
+		return snapshot, nil
+	} else if !implementations.IsFileNotFoundError(err) {
+		return nil, err
+	}
+	if _, err = t.fileAdapter.Download(t.metaPath(hudiPropertiesFile)); err == nil {
+		return nil, fmt.Errorf("Hudi table %s was created by other engine. Writing to such tables is not supported", t.name)
+	} else if !implementations.IsFileNotFoundError(err) {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// newInstant returns instant time for the next commit. Instants must grow monotonically
+func (t *hudiTable) newInstant(snapshot *hudiSnapshot) string {
+	now := time.Now().UTC()
+	for {
+		instant := now.Format("20060102150405") + fmt.Sprintf("%03d", now.Nanosecond()/int(time.Millisecond))
+		if instant > snapshot.Instant {
+			return instant
+		}
+		now = now.Add(time.Millisecond)
+	}
+}
+
+func hudiInflightFile(instant, action string) string {
+	if action == hudiCommitAction {
+		return instant + ".inflight"
+	}
+	return instant + "." + action + ".inflight"
+}
+
+// begin writes requested and inflight instants. Data files of pending instants are ignored by readers
+func (t *hudiTable) begin(snapshot *hudiSnapshot, instant, action string) error {
+	if snapshot.Instant == "" {
+		if err := t.fileAdapter.UploadBytes(t.metaPath(hudiPropertiesFile), t.properties(snapshot)); err != nil {
+			return errorj.Decorate(err, "failed to write hoodie.properties")
+		}
+	}
+	if err := t.fileAdapter.UploadBytes(t.metaPath(instant+"."+action+".requested"), []byte{}); err != nil {
+		return errorj.Decorate(err, "failed to write requested instant to Hudi timeline")
+	}
+	if err := t.fileAdapter.UploadBytes(t.metaPath(hudiInflightFile(instant, action)), []byte{}); err != nil {
+		return errorj.Decorate(err, "failed to write inflight instant to Hudi timeline")
+	}
+	return nil
+}
+
+// abort removes pending instant from timeline
+func (t *hudiTable) abort(instant, action string) {
+	_ = t.fileAdapter.DeleteObject(t.metaPath(hudiInflightFile(instant, action)))
+	_ = t.fileAdapter.DeleteObject(t.metaPath(instant + "." + action + ".requested"))
+}
+
+// commit completes instant and applies written file slices and replaced file groups to snapshot
+func (t *hudiTable) commit(snapshot *hudiSnapshot, instant, action string, metadata hudiCommitMetadata, slices map[string][]*hudiFileSlice) error {
+	// storages don't support conditional writes: check protects from overwriting commits made since snapshot was loaded
+	current := hudiSnapshot{}
+	data, err := t.fileAdapter.Download(t.metaPath(hudiSnapshotFile))
+	if err == nil {
+		err = json.Unmarshal(data, &current)
+	} else if implementations.IsFileNotFoundError(err) {
+		err = nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read state of Hudi table %s: %v", t.name, err)
+	}
+	if current.Instant != snapshot.Instant {
+		return fmt.Errorf("Hudi table %s was changed concurrently: instant %s was committed", t.name, current.Instant)
+	}
+	data, err = json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = t.fileAdapter.UploadBytes(t.metaPath(instant+"."+action), data); err != nil {
+		return errorj.Decorate(err, "failed to write commit to Hudi timeline")
+	}
+	for partitionPath, fileIds := range metadata.PartitionToReplaceFileIds {
+		for _, fileId := range fileIds {
+			delete(snapshot.FileGroups[partitionPath], fileId)
+		}
+	}
+	for partitionPath, partitionSlices := range slices {
+		if snapshot.FileGroups[partitionPath] == nil {
+			snapshot.FileGroups[partitionPath] = map[string]*hudiFileSlice{}
+		}
+		for _, slice := range partitionSlices {
+			snapshot.FileGroups[partitionPath][slice.FileID] = slice
+		}
+	}
+	snapshot.Instant = instant
+	data, err = json.Marshal(snapshot)
+	if err == nil {
+		err = t.fileAdapter.UploadBytes(t.metaPath(hudiSnapshotFile), data)
+	}
+	if err != nil {
+		// without snapshot next commits can't find file groups of the table
+		return errorj.Decorate(err, "failed to save state of Hudi table")
+	}
+	return nil
+}
+
+// properties returns content of hoodie.properties of new table
+func (t *hudiTable) properties(snapshot *hudiSnapshot) []byte {
+	keyGenerator := "org.apache.hudi.keygen.NonpartitionedKeyGenerator"
+	if len(snapshot.RecordKeyFields) > 1 || (len(snapshot.PartitionFields) > 0 && len(snapshot.RecordKeyFields) == 0) {
+		keyGenerator = "org.apache.hudi.keygen.ComplexKeyGenerator"
+	} else if len(snapshot.PartitionFields) > 0 {
+		keyGenerator = "org.apache.hudi.keygen.SimpleKeyGenerator"
+	}
+	properties := map[string]string{
+		"hoodie.table.name":                               t.tableName(),
+		"hoodie.table.type":                               "COPY_ON_WRITE",
+		"hoodie.table.version":                            "6",
+		"hoodie.timeline.layout.version":                  "1",
+		"hoodie.table.timeline.timezone":                  "UTC",
+		"hoodie.table.base.file.format":                   "PARQUET",
+		"hoodie.archivelog.folder":                        "archived",
+		"hoodie.populate.meta.fields":                     "true",
+		"hoodie.table.recordkey.fields":                   strings.Join(snapshot.RecordKeyFields, ","),
+		"hoodie.table.partition.fields":                   strings.Join(snapshot.PartitionFields, ","),
+		"hoodie.table.keygenerator.class":                 keyGenerator,
+		"hoodie.datasource.write.hive_style_partitioning": "true",
+		"hoodie.partition.metafile.use.base.format":       "false",
+		"hoodie.table.create.schema":                      hudiAvroSchema(t.tableName(), snapshot.Schema),
+	}
+	if snapshot.PrecombineField != "" {
+		properties["hoodie.table.precombine.field"] = snapshot.PrecombineField
+	}
+	keys := make([]string, 0, len(properties))
+	for key := range properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	buf := strings.Builder{}
+	buf.WriteString("#Properties saved by bulker\n")
+	for _, key := range keys {
+		buf.WriteString(key + "=" + hudiEscapeProperty(properties[key]) + "\n")
+	}
+	return []byte(buf.String())
+}
+
+func (t *hudiTable) tableName() string {
+	return t.name[strings.LastIndex(t.name, "/")+1:]
+}
+
+// hudiEscapeProperty escapes value of Java properties file
+func hudiEscapeProperty(value string) string {
+	return strings.NewReplacer(`\`, `\\`, ":", `\:`, "=", `\=`, "\n", `\n`).Replace(value)
+}
+
+// hudiAvroSchema Avro schema of table rows stored in commit metadata: meta columns followed by nullable data columns
+func hudiAvroSchema(tableName string, schema deltaSchema) string {
+	fields := make([]map[string]any, 0, len(hudiMetaColumns)+len(schema.Fields))
+	for _, column := range hudiMetaColumns {
+		fields = append(fields, map[string]any{"name": column, "type": []any{"null", "string"}, "default": nil})
+	}
+	for _, field := range schema.Fields {
+		var avroType any = field.Type
+		if field.Type == deltaTimestamp {
+			avroType = map[string]any{"type": "long", "logicalType": "timestamp-micros"}
+		}
+		fields = append(fields, map[string]any{"name": field.Name, "type": []any{"null", avroType}, "default": nil})
+	}
+	name := hudiAvroName(tableName)
+	avroSchema, _ := json.Marshal(map[string]any{"type": "record", "name": name + "_record", "namespace": "hoodie." + name, "fields": fields})
+	return string(avroSchema)
+}
+
+// hudiAvroName replaces characters that are not allowed in Avro names
+func hudiAvroName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// hudiPartitionMetadata content of partition metadata file written to each partition folder
+func hudiPartitionMetadata(instant, partitionPath string) []byte {
+	depth := 0
+	if partitionPath != "" {
+		depth = strings.Count(partitionPath, "/") + 1
+	}
+	return []byte(fmt.Sprintf("#partition metadata\ncommitTime=%s\npartitionDepth=%d\n", instant, depth))
+}
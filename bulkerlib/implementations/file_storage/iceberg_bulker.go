@@ -0,0 +1,137 @@
+package file_storage
+
+import (
+	"errors"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/implementations"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"strings"
+)
+
+const IcebergBulkerTypeId = "iceberg"
+const IcebergAutocommitUnsupported = "Stream mode is not supported for Iceberg. Please use 'batch' mode"
+
+// Iceberg catalog types. All of them are accessed via Iceberg REST catalog API
+const (
+	IcebergCatalogREST   = "rest"
+	IcebergCatalogGlue   = "glue"
+	IcebergCatalogNessie = "nessie"
+)
+
+var (
+	// IcebergPartitionSpecOption - partition spec of Iceberg tables created by bulker, e.g. ["day(_timestamp)", "bucket[16](user_id)"].
+	// Field without transform means identity transform. Partition spec of existing tables is not changed
+	IcebergPartitionSpecOption = bulker.ImplementationOption[[]string]{
+		Key:       "icebergPartitionSpec",
+		ParseFunc: parseIcebergPartitionSpec,
+	}
+)
+
+func init() {
+	bulker.RegisterBulker(IcebergBulkerTypeId, NewIcebergBulker)
+	bulker.RegisterConfigType(IcebergBulkerTypeId, IcebergConfig{})
+	bulker.RegisterOption(&IcebergPartitionSpecOption)
+}
+
+// WithIcebergPartitionSpec sets partition spec of Iceberg tables created by stream
+func WithIcebergPartitionSpec(partitionFields ...string) bulker.StreamOption {
+	return bulker.WithOption(&IcebergPartitionSpecOption, partitionFields)
+}
+
+// IcebergConfig Iceberg catalog and S3 storage of table files
+type IcebergConfig struct {
+	implementations.S3Config `mapstructure:",squash" json:",inline" yaml:",inline"`
+	// CatalogType rest (default), glue or nessie
+	CatalogType string `mapstructure:"catalogType,omitempty" json:"catalogType,omitempty" yaml:"catalogType,omitempty"`
+	// CatalogURI base URI of Iceberg REST catalog API (without /v1), e.g. http://nessie:19120/iceberg. Default for glue: https://glue.{region}.amazonaws.com/iceberg
+	CatalogURI string `mapstructure:"catalogUri,omitempty" json:"catalogUri,omitempty" yaml:"catalogUri,omitempty"`
+	// Warehouse passed to catalog config endpoint. For glue: AWS account id
+	Warehouse string `mapstructure:"warehouse,omitempty" json:"warehouse,omitempty" yaml:"warehouse,omitempty"`
+	// Namespace of tables. Nested namespaces are separated with dot. Default: default
+	Namespace string `mapstructure:"namespace,omitempty" json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	// CatalogToken bearer token for catalog requests
+	CatalogToken string `mapstructure:"catalogToken,omitempty" json:"catalogToken,omitempty" yaml:"catalogToken,omitempty"`
+	// CatalogCredential OAuth2 client credentials in 'client_id:client_secret' form exchanged for token at catalog /v1/oauth/tokens endpoint
+	CatalogCredential string `mapstructure:"catalogCredential,omitempty" json:"catalogCredential,omitempty" yaml:"catalogCredential,omitempty"`
+	CatalogScope      string `mapstructure:"catalogScope,omitempty" json:"catalogScope,omitempty" yaml:"catalogScope,omitempty"`
+}
+
+// Validate returns err if invalid. Sets default values
+func (ic *IcebergConfig) Validate() error {
+	if err := ic.S3Config.Validate(); err != nil {
+		return err
+	}
+	switch ic.CatalogType {
+	case "":
+		ic.CatalogType = IcebergCatalogREST
+	case IcebergCatalogREST, IcebergCatalogGlue, IcebergCatalogNessie:
+	default:
+		return fmt.Errorf("unsupported Iceberg catalog type: %s. Supported: rest, glue, nessie", ic.CatalogType)
+	}
+	if ic.CatalogType == IcebergCatalogGlue {
+		if ic.Region == "" {
+			return errors.New("region is required parameter for glue catalog")
+		}
+		if ic.CatalogURI == "" {
+			ic.CatalogURI = fmt.Sprintf("https://glue.%s.amazonaws.com/iceberg", ic.Region)
+		}
+	}
+	if ic.CatalogURI == "" {
+		return errors.New("catalogUri is required parameter")
+	}
+	if ic.Namespace == "" {
+		ic.Namespace = "default"
+	}
+	return nil
+}
+
+// IcebergBulker writes to Iceberg tables: data and metadata files are uploaded to S3, snapshots are committed via catalog
+type IcebergBulker struct {
+	implementations.S3
+	config  *IcebergConfig
+	catalog *icebergCatalog
+}
+
+func NewIcebergBulker(bulkerConfig bulker.Config) (bulker.Bulker, error) {
+	config := &IcebergConfig{}
+	if err := utils.ParseObject(bulkerConfig.DestinationConfig, config); err != nil {
+		return nil, fmt.Errorf("failed to parse destination config: %v", err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	storageConfig := config.S3Config
+	// keys of files are derived from table location, so folder must not be prepended to them
+	storageConfig.Folder = ""
+	s3adapter, err := implementations.NewS3(&storageConfig)
+	if err != nil {
+		return nil, err
+	}
+	awsSession, err := implementations.NewAwsSession(config.Region, config.AccessKey, config.SecretKey, config.RoleARN, config.ExternalID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create aws session: %v", err)
+	}
+	return &IcebergBulker{S3: *s3adapter, config: config, catalog: newIcebergCatalog(config, awsSession.Config.Credentials)}, nil
+}
+
+func (ib *IcebergBulker) CreateStream(id, tableName string, mode bulker.BulkMode, streamOptions ...bulker.StreamOption) (bulker.BulkerStream, error) {
+	if mode == bulker.Stream {
+		return nil, errors.New(IcebergAutocommitUnsupported)
+	}
+	return NewIcebergStream(id, ib, tableName, mode, streamOptions...)
+}
+
+// tableLocation returns location for new table under configured folder.
+// Empty location means that catalog chooses location in its warehouse
+func (ib *IcebergBulker) tableLocation(tableName string) string {
+	folder := strings.Trim(ib.config.Folder, "/")
+	if folder == "" {
+		return ""
+	}
+	return fmt.Sprintf("s3://%s/%s/%s/%s", ib.config.Bucket, folder, strings.ReplaceAll(ib.config.Namespace, ".", "/"), tableName)
+}
+
+func (ib *IcebergBulker) Type() string {
+	return IcebergBulkerTypeId
+}
@@ -0,0 +1,390 @@
+package file_storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/jitsucom/bulker/bulkerlib/implementations"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const icebergCatalogTimeout = 2 * time.Minute
+
+// icebergField column of Iceberg table schema. Type is either primitive type name or object of nested type
+type icebergField struct {
+	ID       int             `json:"id"`
+	Name     string          `json:"name"`
+	Required bool            `json:"required"`
+	Type     json.RawMessage `json:"type"`
+	Doc      string          `json:"doc,omitempty"`
+}
+
+// primitiveType returns type name of primitive type or empty string for nested types
+func (f icebergField) primitiveType() string {
+	var typeName string
+	_ = json.Unmarshal(f.Type, &typeName)
+	return typeName
+}
+
+type icebergSchema struct {
+	Type               string         `json:"type"`
+	SchemaID           int            `json:"schema-id"`
+	IdentifierFieldIDs []int          `json:"identifier-field-ids,omitempty"`
+	Fields             []icebergField `json:"fields"`
+}
+
+func (s *icebergSchema) field(name string) *icebergField {
+	for i := range s.Fields {
+		if s.Fields[i].Name == name {
+			return &s.Fields[i]
+		}
+	}
+	return nil
+}
+
+func (s *icebergSchema) fieldById(id int) *icebergField {
+	for i := range s.Fields {
+		if s.Fields[i].ID == id {
+			return &s.Fields[i]
+		}
+	}
+	return nil
+}
+
+type icebergPartitionField struct {
+	SourceID  int    `json:"source-id"`
+	FieldID   int    `json:"field-id,omitempty"`
+	Name      string `json:"name"`
+	Transform string `json:"transform"`
+}
+
+type icebergPartitionSpec struct {
+	SpecID int                     `json:"spec-id"`
+	Fields []icebergPartitionField `json:"fields"`
+}
+
+type icebergSnapshot struct {
+	SnapshotID       int64             `json:"snapshot-id"`
+	ParentSnapshotID *int64            `json:"parent-snapshot-id,omitempty"`
+	SequenceNumber   int64             `json:"sequence-number"`
+	TimestampMs      int64             `json:"timestamp-ms"`
+	ManifestList     string            `json:"manifest-list"`
+	Summary          map[string]string `json:"summary"`
+	SchemaID         *int              `json:"schema-id,omitempty"`
+}
+
+// icebergTableMetadata part of Iceberg table metadata used by writer
+type icebergTableMetadata struct {
+	FormatVersion      int                    `json:"format-version"`
+	TableUUID          string                 `json:"table-uuid"`
+	Location           string                 `json:"location"`
+	LastSequenceNumber int64                  `json:"last-sequence-number"`
+	LastColumnID       int                    `json:"last-column-id"`
+	CurrentSchemaID    int                    `json:"current-schema-id"`
+	Schemas            []icebergSchema        `json:"schemas"`
+	DefaultSpecID      int                    `json:"default-spec-id"`
+	PartitionSpecs     []icebergPartitionSpec `json:"partition-specs"`
+	LastPartitionID    int                    `json:"last-partition-id"`
+	Properties         map[string]string      `json:"properties"`
+	CurrentSnapshotID  *int64                 `json:"current-snapshot-id"`
+	Snapshots          []icebergSnapshot      `json:"snapshots"`
+}
+
+func (m *icebergTableMetadata) currentSchema() (icebergSchema, error) {
+	for _, schema := range m.Schemas {
+		if schema.SchemaID == m.CurrentSchemaID {
+			return schema, nil
+		}
+	}
+	return icebergSchema{}, fmt.Errorf("current schema %d not found in table metadata", m.CurrentSchemaID)
+}
+
+func (m *icebergTableMetadata) defaultSpec() (icebergPartitionSpec, error) {
+	for _, spec := range m.PartitionSpecs {
+		if spec.SpecID == m.DefaultSpecID {
+			return spec, nil
+		}
+	}
+	return icebergPartitionSpec{}, fmt.Errorf("default partition spec %d not found in table metadata", m.DefaultSpecID)
+}
+
+// currentSnapshot returns nil for tables without snapshots
+func (m *icebergTableMetadata) currentSnapshot() *icebergSnapshot {
+	if m.CurrentSnapshotID == nil || *m.CurrentSnapshotID < 0 {
+		return nil
+	}
+	for i := range m.Snapshots {
+		if m.Snapshots[i].SnapshotID == *m.CurrentSnapshotID {
+			return &m.Snapshots[i]
+		}
+	}
+	return nil
+}
+
+type icebergLoadTableResult struct {
+	MetadataLocation string               `json:"metadata-location"`
+	Metadata         icebergTableMetadata `json:"metadata"`
+	Config           map[string]string    `json:"config"`
+}
+
+// icebergCreateTableRequest request of table creation. Catalog assigns field ids of schema and partition spec
+type icebergCreateTableRequest struct {
+	Name          string               `json:"name"`
+	Location      string               `json:"location,omitempty"`
+	Schema        icebergSchema        `json:"schema"`
+	PartitionSpec icebergPartitionSpec `json:"partition-spec"`
+	Properties    map[string]string    `json:"properties"`
+}
+
+// icebergCommitRequest request of table commit: updates are applied only if all requirements are met
+type icebergCommitRequest struct {
+	Requirements []map[string]any `json:"requirements"`
+	Updates      []map[string]any `json:"updates"`
+}
+
+// icebergError error response of Iceberg REST catalog
+type icebergError struct {
+	Code    int    `json:"code"`
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+func (e *icebergError) Error() string {
+	return fmt.Sprintf("iceberg catalog error %d %s: %s", e.Code, e.Type, e.Message)
+}
+
+func isIcebergErrorCode(err error, code int) bool {
+	var icebergErr *icebergError
+	return errors.As(err, &icebergErr) && icebergErr.Code == code
+}
+
+// icebergCatalog client of Iceberg REST catalog API. AWS Glue and Nessie catalogs are used via their Iceberg REST endpoints
+type icebergCatalog struct {
+	config *IcebergConfig
+	client *http.Client
+	// signer signs requests to AWS Glue with SigV4
+	signer *v4.Signer
+
+	sync.Mutex
+	prefix      string
+	configured  bool
+	token       string
+	tokenExpiry time.Time
+}
+
+func newIcebergCatalog(config *IcebergConfig, awsCredentials *credentials.Credentials) *icebergCatalog {
+	catalog := &icebergCatalog{config: config, client: &http.Client{Timeout: icebergCatalogTimeout}, token: config.CatalogToken}
+	if config.CatalogType == IcebergCatalogGlue {
+		catalog.signer = v4.NewSigner(awsCredentials)
+	}
+	return catalog
+}
+
+// configure requests catalog config that may override path prefix for the warehouse
+func (c *icebergCatalog) configure(ctx context.Context) error {
+	c.Lock()
+	configured := c.configured
+	c.Unlock()
+	if configured {
+		return nil
+	}
+	params := url.Values{}
+	if c.config.Warehouse != "" {
+		params.Set("warehouse", c.config.Warehouse)
+	}
+	catalogConfig := struct {
+		Defaults  map[string]string `json:"defaults"`
+		Overrides map[string]string `json:"overrides"`
+	}{}
+	if err := c.do(ctx, http.MethodGet, "config?"+params.Encode(), nil, &catalogConfig); err != nil {
+		return fmt.Errorf("failed to get Iceberg catalog config: %w", err)
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.prefix = catalogConfig.Overrides["prefix"]
+	if c.prefix == "" {
+		c.prefix = catalogConfig.Defaults["prefix"]
+	}
+	c.configured = true
+	return nil
+}
+
+func (c *icebergCatalog) namespacePath() string {
+	return c.prefixed("namespaces/" + url.PathEscape(strings.Join(strings.Split(c.config.Namespace, "."), "\x1f")))
+}
+
+func (c *icebergCatalog) prefixed(path string) string {
+	if c.prefix == "" {
+		return path
+	}
+	return strings.Trim(c.prefix, "/") + "/" + path
+}
+
+// loadTable returns nil result if table doesn't exist
+func (c *icebergCatalog) loadTable(ctx context.Context, tableName string) (*icebergLoadTableResult, error) {
+	if err := c.configure(ctx); err != nil {
+		return nil, err
+	}
+	result := &icebergLoadTableResult{}
+	err := c.do(ctx, http.MethodGet, c.namespacePath()+"/tables/"+url.PathEscape(tableName), nil, result)
+	if isIcebergErrorCode(err, http.StatusNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load Iceberg table %s: %w", tableName, err)
+	}
+	return result, nil
+}
+
+// createTable creates namespace if necessary and the table
+func (c *icebergCatalog) createTable(ctx context.Context, request icebergCreateTableRequest) (*icebergLoadTableResult, error) {
+	if err := c.configure(ctx); err != nil {
+		return nil, err
+	}
+	namespace := map[string]any{"namespace": strings.Split(c.config.Namespace, "."), "properties": map[string]string{}}
+	err := c.do(ctx, http.MethodPost, c.prefixed("namespaces"), namespace, nil)
+	if err != nil && !isIcebergErrorCode(err, http.StatusConflict) {
+		return nil, fmt.Errorf("failed to create Iceberg namespace %s: %w", c.config.Namespace, err)
+	}
+	result := &icebergLoadTableResult{}
+	if err = c.do(ctx, http.MethodPost, c.namespacePath()+"/tables", request, result); err != nil {
+		return nil, fmt.Errorf("failed to create Iceberg table %s: %w", request.Name, err)
+	}
+	return result, nil
+}
+
+// commitTable applies updates to the table. Returns error with http.StatusConflict code if requirements are not met
+func (c *icebergCatalog) commitTable(ctx context.Context, tableName string, request icebergCommitRequest) (*icebergLoadTableResult, error) {
+	result := &icebergLoadTableResult{}
+	if err := c.do(ctx, http.MethodPost, c.namespacePath()+"/tables/"+url.PathEscape(tableName), request, result); err != nil {
+		return nil, fmt.Errorf("failed to commit Iceberg table %s: %w", tableName, err)
+	}
+	return result, nil
+}
+
+// authorize sets bearer token or SigV4 signature of the request
+func (c *icebergCatalog) authorize(ctx context.Context, req *http.Request, body []byte) error {
+	if c.signer != nil {
+		_, err := c.signer.Sign(req, bytes.NewReader(body), "glue", c.config.Region, time.Now())
+		return err
+	}
+	token, err := c.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return nil
+}
+
+// accessToken returns configured token or exchanges client credentials for OAuth2 token
+func (c *icebergCatalog) accessToken(ctx context.Context) (string, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.config.CatalogCredential == "" || (c.token != "" && time.Now().Before(c.tokenExpiry)) {
+		return c.token, nil
+	}
+	clientId, clientSecret, ok := strings.Cut(c.config.CatalogCredential, ":")
+	if !ok {
+		clientId, clientSecret = "", c.config.CatalogCredential
+	}
+	form := url.Values{"grant_type": []string{"client_credentials"}, "client_id": []string{clientId},
+		"client_secret": []string{clientSecret}, "scope": []string{c.config.CatalogScope}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url("oauth/tokens"), strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get Iceberg catalog access token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get Iceberg catalog access token: %w", icebergResponseError(resp))
+	}
+	token := struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}{}
+	if err = json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to parse Iceberg catalog access token: %w", err)
+	}
+	c.token = token.AccessToken
+	expiresIn := time.Duration(token.ExpiresIn) * time.Second
+	if expiresIn <= 0 {
+		expiresIn = time.Hour
+	}
+	// refresh token before it expires
+	c.tokenExpiry = time.Now().Add(expiresIn * 9 / 10)
+	return c.token, nil
+}
+
+func (c *icebergCatalog) url(path string) string {
+	return strings.TrimSuffix(c.config.CatalogURI, "/") + "/v1/" + path
+}
+
+// do sends request with JSON payload and decodes JSON response into result if not nil
+func (c *icebergCatalog) do(ctx context.Context, method, path string, payload any, result any) error {
+	var body []byte
+	if payload != nil {
+		var err error
+		if body, err = json.Marshal(payload); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.url(path), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if err = c.authorize(ctx, req, body); err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return icebergResponseError(resp)
+	}
+	if result == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+func icebergResponseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	errorResponse := struct {
+		Error icebergError `json:"error"`
+	}{}
+	if err := json.Unmarshal(body, &errorResponse); err == nil && errorResponse.Error.Message != "" {
+		errorResponse.Error.Code = resp.StatusCode
+		return &errorResponse.Error
+	}
+	return &icebergError{Code: resp.StatusCode, Type: resp.Status, Message: strings.TrimSpace(string(body))}
+}
+
+// icebergStorageKey returns key of object in bucket for location of Iceberg file, e.g. s3://bucket/warehouse/table/data/file.parquet
+func icebergStorageKey(location string, s3Config *implementations.S3Config) (string, error) {
+	for _, scheme := range []string{"s3://", "s3a://", "s3n://"} {
+		if rest, ok := strings.CutPrefix(location, scheme+s3Config.Bucket+"/"); ok {
+			return rest, nil
+		}
+	}
+	return "", fmt.Errorf("location %s is outside of configured bucket %s", location, s3Config.Bucket)
+}
@@ -0,0 +1,231 @@
+package file_storage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"github.com/hamba/avro/v2"
+	"github.com/hamba/avro/v2/ocf"
+)
+
+// status of manifest entry
+const (
+	icebergEntryExisting = 0
+	icebergEntryAdded    = 1
+	icebergEntryDeleted  = 2
+)
+
+// icebergManifestListSchema Avro schema of manifest list (format version 2). Iceberg readers resolve fields by field-id
+const icebergManifestListSchema = `{"type":"record","name":"manifest_file","fields":[
+{"name":"manifest_path","type":"string","field-id":500},
+{"name":"manifest_length","type":"long","field-id":501},
+{"name":"partition_spec_id","type":"int","field-id":502},
+{"name":"content","type":"int","field-id":517},
+{"name":"sequence_number","type":"long","field-id":515},
+{"name":"min_sequence_number","type":"long","field-id":516},
+{"name":"added_snapshot_id","type":"long","field-id":503},
+{"name":"added_files_count","type":"int","field-id":504},
+{"name":"existing_files_count","type":"int","field-id":505},
+{"name":"deleted_files_count","type":"int","field-id":506},
+{"name":"added_rows_count","type":"long","field-id":512},
+{"name":"existing_rows_count","type":"long","field-id":513},
+{"name":"deleted_rows_count","type":"long","field-id":514},
+{"name":"partitions","type":["null",{"type":"array","items":{"type":"record","name":"r508","fields":[
+{"name":"contains_null","type":"boolean","field-id":509},
+{"name":"contains_nan","type":["null","boolean"],"default":null,"field-id":518},
+{"name":"lower_bound","type":["null","bytes"],"default":null,"field-id":510},
+{"name":"upper_bound","type":["null","bytes"],"default":null,"field-id":511}]},"element-id":508}],"default":null,"field-id":507}]}`
+
+// icebergManifestEntrySchema Avro schema of data manifest entry (format version 2). Optional column metrics are not written
+const icebergManifestEntrySchema = `{"type":"record","name":"manifest_entry","fields":[
+{"name":"status","type":"int","field-id":0},
+{"name":"snapshot_id","type":["null","long"],"default":null,"field-id":1},
+{"name":"sequence_number","type":["null","long"],"default":null,"field-id":3},
+{"name":"file_sequence_number","type":["null","long"],"default":null,"field-id":4},
+{"name":"data_file","type":{"type":"record","name":"r2","fields":[
+{"name":"content","type":"int","field-id":134},
+{"name":"file_path","type":"string","field-id":100},
+{"name":"file_format","type":"string","field-id":101},
+{"name":"partition","type":%s,"field-id":102},
+{"name":"record_count","type":"long","field-id":103},
+{"name":"file_size_in_bytes","type":"long","field-id":104}]},"field-id":2}]}`
+
+var icebergAvroMagic = [4]byte{'O', 'b', 'j', 1}
+
+// icebergFieldSummary summary of partition field values of manifest
+type icebergFieldSummary struct {
+	ContainsNull bool    `avro:"contains_null"`
+	ContainsNaN  *bool   `avro:"contains_nan"`
+	LowerBound   *[]byte `avro:"lower_bound"`
+	UpperBound   *[]byte `avro:"upper_bound"`
+}
+
+// icebergManifestFile entry of manifest list
+type icebergManifestFile struct {
+	ManifestPath       string                 `avro:"manifest_path"`
+	ManifestLength     int64                  `avro:"manifest_length"`
+	PartitionSpecID    int32                  `avro:"partition_spec_id"`
+	Content            int32                  `avro:"content"`
+	SequenceNumber     int64                  `avro:"sequence_number"`
+	MinSequenceNumber  int64                  `avro:"min_sequence_number"`
+	AddedSnapshotID    int64                  `avro:"added_snapshot_id"`
+	AddedFilesCount    int32                  `avro:"added_files_count"`
+	ExistingFilesCount int32                  `avro:"existing_files_count"`
+	DeletedFilesCount  int32                  `avro:"deleted_files_count"`
+	AddedRowsCount     int64                  `avro:"added_rows_count"`
+	ExistingRowsCount  int64                  `avro:"existing_rows_count"`
+	DeletedRowsCount   int64                  `avro:"deleted_rows_count"`
+	Partitions         *[]icebergFieldSummary `avro:"partitions"`
+}
+
+// icebergDataFile parquet data file written by stream
+type icebergDataFile struct {
+	path      string
+	size      int64
+	rows      int64
+	partition []any
+}
+
+// writeIcebergAvro writes Avro object container file. Unlike ocf.Encoder it keeps schema as is:
+// field-id attributes are required by Iceberg readers
+func writeIcebergAvro(schemaJSON string, metadata map[string]string, records []any) ([]byte, error) {
+	schema, err := avro.Parse(schemaJSON)
+	if err != nil {
+		return nil, err
+	}
+	block := &bytes.Buffer{}
+	encoder := avro.NewEncoderForSchema(schema, block)
+	for _, record := range records {
+		if err = encoder.Encode(record); err != nil {
+			return nil, fmt.Errorf("failed to encode avro record: %v", err)
+		}
+	}
+	header := ocf.Header{Magic: icebergAvroMagic, Meta: map[string][]byte{"avro.schema": []byte(schemaJSON), "avro.codec": []byte(ocf.Null)}}
+	for key, value := range metadata {
+		header.Meta[key] = []byte(value)
+	}
+	_, _ = rand.Read(header.Sync[:])
+	result := &bytes.Buffer{}
+	writer := avro.NewWriter(result, 512)
+	writer.WriteVal(ocf.HeaderSchema, header)
+	if len(records) > 0 {
+		writer.WriteLong(int64(len(records)))
+		writer.WriteLong(int64(block.Len()))
+		_, _ = writer.Write(block.Bytes())
+		_, _ = writer.Write(header.Sync[:])
+	}
+	if err = writer.Flush(); err != nil {
+		return nil, err
+	}
+	return result.Bytes(), nil
+}
+
+// readIcebergAvro decodes all records of Avro object container file and returns them along with file metadata
+func readIcebergAvro[T any](data []byte) ([]T, map[string][]byte, error) {
+	decoder, err := ocf.NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	records := make([]T, 0)
+	for decoder.HasNext() {
+		var record T
+		if err = decoder.Decode(&record); err != nil {
+			return nil, nil, err
+		}
+		records = append(records, record)
+	}
+	if err = decoder.Error(); err != nil {
+		return nil, nil, err
+	}
+	return records, decoder.Metadata(), nil
+}
+
+// icebergPartitionAvroType Avro record of partition values of manifest entry
+func icebergPartitionAvroType(spec icebergPartitionSpec, partitionTypes []string) string {
+	fields := make([]map[string]any, len(spec.Fields))
+	for i, field := range spec.Fields {
+		fields[i] = map[string]any{"name": field.Name, "type": []any{"null", icebergAvroTypes[partitionTypes[i]]}, "default": nil, "field-id": field.FieldID}
+	}
+	partitionType, _ := json.Marshal(map[string]any{"type": "record", "name": "r102", "fields": fields})
+	return string(partitionType)
+}
+
+// icebergManifestMetadata Avro file metadata of manifest required by Iceberg readers
+func icebergManifestMetadata(schema icebergSchema, spec icebergPartitionSpec) map[string]string {
+	schemaJSON, _ := json.Marshal(schema)
+	specFields, _ := json.Marshal(spec.Fields)
+	return map[string]string{
+		"schema":            string(schemaJSON),
+		"schema-id":         fmt.Sprint(schema.SchemaID),
+		"partition-spec":    string(specFields),
+		"partition-spec-id": fmt.Sprint(spec.SpecID),
+		"format-version":    "2",
+		"content":           "data",
+	}
+}
+
+// writeIcebergManifest returns manifest with entries of added data files. Sequence numbers are inherited from manifest list
+func writeIcebergManifest(schema icebergSchema, spec icebergPartitionSpec, partitionTypes []string, snapshotId int64, files []icebergDataFile) ([]byte, error) {
+	entries := make([]any, len(files))
+	for i, file := range files {
+		partition := map[string]any{}
+		for j, field := range spec.Fields {
+			partition[field.Name] = nil
+			if file.partition[j] != nil {
+				partition[field.Name] = map[string]any{icebergAvroUnionName(partitionTypes[j]): file.partition[j]}
+			}
+		}
+		entries[i] = map[string]any{
+			"status":               icebergEntryAdded,
+			"snapshot_id":          map[string]any{"long": snapshotId},
+			"sequence_number":      nil,
+			"file_sequence_number": nil,
+			"data_file": map[string]any{
+				"content":            0,
+				"file_path":          file.path,
+				"file_format":        "PARQUET",
+				"partition":          partition,
+				"record_count":       file.rows,
+				"file_size_in_bytes": file.size,
+			},
+		}
+	}
+	return writeIcebergAvro(fmt.Sprintf(icebergManifestEntrySchema, icebergPartitionAvroType(spec, partitionTypes)), icebergManifestMetadata(schema, spec), entries)
+}
+
+// icebergPartitionSummaries returns summaries of partition values of data files
+func icebergPartitionSummaries(spec icebergPartitionSpec, files []icebergDataFile) *[]icebergFieldSummary {
+	summaries := make([]icebergFieldSummary, len(spec.Fields))
+	for i := range spec.Fields {
+		var lower, upper any
+		for _, file := range files {
+			value := file.partition[i]
+			if value == nil {
+				summaries[i].ContainsNull = true
+				continue
+			}
+			if lower == nil || icebergCompare(value, lower) < 0 {
+				lower = value
+			}
+			if upper == nil || icebergCompare(value, upper) > 0 {
+				upper = value
+			}
+		}
+		if lower != nil {
+			lowerBound, upperBound := icebergBinaryValue(lower), icebergBinaryValue(upper)
+			summaries[i].LowerBound, summaries[i].UpperBound = &lowerBound, &upperBound
+		}
+	}
+	return &summaries
+}
+
+// avroUnionValue returns value of nullable union decoded into generic record
+func avroUnionValue(value any) any {
+	if union, ok := value.(map[string]any); ok && len(union) == 1 {
+		for _, v := range union {
+			return v
+		}
+	}
+	return value
+}
@@ -0,0 +1,306 @@
+package file_storage
+
+import (
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Iceberg column types supported by writer
+const (
+	icebergString      = "string"
+	icebergLong        = "long"
+	icebergDouble      = "double"
+	icebergBoolean     = "boolean"
+	icebergTimestampTz = "timestamptz"
+	// icebergInt and icebergDate are types of partition values produced by transforms
+	icebergInt  = "int"
+	icebergDate = "date"
+)
+
+var icebergPartitionFieldRegex = regexp.MustCompile(`^\s*([a-z]+(?:\[\d+])?)\s*\(\s*([^()]+?)\s*\)\s*$`)
+
+// icebergPartitionTransform partition transform: identity, year, month, day, hour, bucket[N] or truncate[W]
+type icebergPartitionTransform struct {
+	name  string
+	param int
+}
+
+func parseIcebergTransform(transform string) (icebergPartitionTransform, error) {
+	name, param, hasParam := strings.Cut(strings.TrimSuffix(transform, "]"), "[")
+	t := icebergPartitionTransform{name: name}
+	switch name {
+	case "identity", "year", "month", "day", "hour":
+		if hasParam {
+			return t, fmt.Errorf("transform %s doesn't accept parameter", name)
+		}
+	case "bucket", "truncate":
+		var err error
+		t.param, err = strconv.Atoi(param)
+		if !hasParam || err != nil || t.param <= 0 {
+			return t, fmt.Errorf("transform %s requires positive parameter, e.g. %s[16]", name, name)
+		}
+	default:
+		return t, fmt.Errorf("unsupported partition transform: %s. Supported: identity, year, month, day, hour, bucket[N], truncate[W]", transform)
+	}
+	return t, nil
+}
+
+// parseIcebergPartitionField parses partition field in form 'transform(column)' or just 'column' for identity transform
+func parseIcebergPartitionField(partitionField string) (column string, transform icebergPartitionTransform, err error) {
+	if !strings.Contains(partitionField, "(") {
+		return strings.TrimSpace(partitionField), icebergPartitionTransform{name: "identity"}, nil
+	}
+	match := icebergPartitionFieldRegex.FindStringSubmatch(partitionField)
+	if match == nil {
+		return "", transform, fmt.Errorf("invalid partition field '%s'. Expected format: transform(column), e.g. day(_timestamp)", partitionField)
+	}
+	transform, err = parseIcebergTransform(match[1])
+	return match[2], transform, err
+}
+
+// parseIcebergPartitionSpec parses value of IcebergPartitionSpecOption
+func parseIcebergPartitionSpec(serialized any) ([]string, error) {
+	var fields []string
+	switch v := serialized.(type) {
+	case []string:
+		fields = v
+	case string:
+		if v == "" {
+			return nil, nil
+		}
+		fields = strings.Split(v, ",")
+	case []any:
+		fields = make([]string, 0, len(v))
+		for _, field := range v {
+			str, ok := field.(string)
+			if !ok {
+				return nil, fmt.Errorf("failed to parse 'icebergPartitionSpec' option: %v incorrect type: %T expected string", field, field)
+			}
+			fields = append(fields, str)
+		}
+	default:
+		return nil, fmt.Errorf("failed to parse 'icebergPartitionSpec' option: %v incorrect type: %T expected string or []string", v, v)
+	}
+	for i, field := range fields {
+		fields[i] = strings.TrimSpace(field)
+		if _, _, err := parseIcebergPartitionField(fields[i]); err != nil {
+			return nil, fmt.Errorf("failed to parse 'icebergPartitionSpec' option: %v", err)
+		}
+	}
+	return fields, nil
+}
+
+func (t icebergPartitionTransform) String() string {
+	if t.param > 0 {
+		return fmt.Sprintf("%s[%d]", t.name, t.param)
+	}
+	return t.name
+}
+
+// fieldName returns default name of partition field for source column
+func (t icebergPartitionTransform) fieldName(column string) string {
+	switch t.name {
+	case "identity":
+		return column
+	case "truncate":
+		return column + "_trunc"
+	default:
+		return column + "_" + t.name
+	}
+}
+
+// resultType returns type of partition values produced from source column of provided type
+func (t icebergPartitionTransform) resultType(sourceType string) (string, error) {
+	supported := false
+	resultType := sourceType
+	switch t.name {
+	case "identity":
+		supported = icebergAvroTypes[sourceType] != nil
+	case "year", "month", "hour":
+		supported, resultType = sourceType == icebergTimestampTz, icebergInt
+	case "day":
+		supported, resultType = sourceType == icebergTimestampTz, icebergDate
+	case "bucket":
+		supported, resultType = sourceType == icebergLong || sourceType == icebergString || sourceType == icebergTimestampTz, icebergInt
+	case "truncate":
+		supported = sourceType == icebergLong || sourceType == icebergString
+	}
+	if !supported {
+		return "", fmt.Errorf("partition transform %s is not supported for column type %s", t, sourceType)
+	}
+	return resultType, nil
+}
+
+// apply returns partition value for column value converted with icebergValue
+func (t icebergPartitionTransform) apply(value any) any {
+	if value == nil {
+		return nil
+	}
+	switch t.name {
+	case "year", "month", "day", "hour":
+		micros := value.(int64)
+		switch t.name {
+		case "day":
+			return int32(floorDiv(micros, int64(24*time.Hour/time.Microsecond)))
+		case "hour":
+			return int32(floorDiv(micros, int64(time.Hour/time.Microsecond)))
+		}
+		ts := time.UnixMicro(micros).UTC()
+		if t.name == "year" {
+			return int32(ts.Year() - 1970)
+		}
+		return int32((ts.Year()-1970)*12 + int(ts.Month()) - 1)
+	case "bucket":
+		var hash int32
+		switch v := value.(type) {
+		case int64:
+			hash = murmur3Hash32(binary.LittleEndian.AppendUint64(nil, uint64(v)))
+		case string:
+			hash = murmur3Hash32([]byte(v))
+		}
+		return (hash & math.MaxInt32) % int32(t.param)
+	case "truncate":
+		switch v := value.(type) {
+		case int64:
+			w := int64(t.param)
+			return v - (((v % w) + w) % w)
+		case string:
+			if runes := []rune(v); len(runes) > t.param {
+				return string(runes[:t.param])
+			}
+			return v
+		}
+	}
+	return value
+}
+
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && a < 0 {
+		q--
+	}
+	return q
+}
+
+// murmur3Hash32 32-bit x86 murmur3 hash with zero seed used by Iceberg bucket transform
+func murmur3Hash32(data []byte) int32 {
+	const c1, c2 = 0xcc9e2d51, 0x1b873593
+	var h uint32
+	n := len(data) / 4
+	for i := 0; i < n; i++ {
+		k := binary.LittleEndian.Uint32(data[i*4:])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+		h = bits.RotateLeft32(h, 13)
+		h = h*5 + 0xe6546b64
+	}
+	var k uint32
+	tail := data[n*4:]
+	switch len(tail) {
+	case 3:
+		k ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(tail[0])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+	}
+	h ^= uint32(len(data))
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return int32(h)
+}
+
+// icebergAvroTypes Avro types of values in manifests
+var icebergAvroTypes = map[string]any{
+	icebergString:      "string",
+	icebergLong:        "long",
+	icebergDouble:      "double",
+	icebergBoolean:     "boolean",
+	icebergInt:         "int",
+	icebergDate:        map[string]any{"type": "int", "logicalType": "date"},
+	icebergTimestampTz: map[string]any{"type": "long", "logicalType": "timestamp-micros", "adjust-to-utc": true},
+}
+
+// icebergAvroUnionName returns name of type in nullable union used to encode value of generic record
+func icebergAvroUnionName(icebergType string) string {
+	switch icebergType {
+	case icebergDate:
+		return "int.date"
+	case icebergTimestampTz:
+		return "long.timestamp-micros"
+	default:
+		return icebergAvroTypes[icebergType].(string)
+	}
+}
+
+// icebergBinaryValue single-value binary serialization used for lower and upper bounds
+func icebergBinaryValue(value any) []byte {
+	switch v := value.(type) {
+	case string:
+		return []byte(v)
+	case int32:
+		return binary.LittleEndian.AppendUint32(nil, uint32(v))
+	case int64:
+		return binary.LittleEndian.AppendUint64(nil, uint64(v))
+	case float64:
+		return binary.LittleEndian.AppendUint64(nil, math.Float64bits(v))
+	case bool:
+		if v {
+			return []byte{1}
+		}
+		return []byte{0}
+	}
+	return nil
+}
+
+// icebergCompare compares partition values of the same type
+func icebergCompare(a, b any) int {
+	switch v := a.(type) {
+	case string:
+		return strings.Compare(v, b.(string))
+	case int32:
+		return cmp.Compare(v, b.(int32))
+	case int64:
+		return cmp.Compare(v, b.(int64))
+	case float64:
+		return cmp.Compare(v, b.(float64))
+	case bool:
+		return cmp.Compare(icebergBinaryValue(v)[0], icebergBinaryValue(b)[0])
+	}
+	return 0
+}
+
+// icebergPartitionPath human readable path of partition value, e.g. _timestamp_day=2024-01-31
+func icebergPartitionPath(name, valueType string, value any) string {
+	str := "null"
+	if value != nil {
+		switch valueType {
+		case icebergDate:
+			str = time.Unix(int64(value.(int32))*24*3600, 0).UTC().Format(time.DateOnly)
+		case icebergTimestampTz:
+			str = time.UnixMicro(value.(int64)).UTC().Format(time.RFC3339)
+		default:
+			str = fmt.Sprint(value)
+		}
+	}
+	return url.PathEscape(name) + "=" + url.PathEscape(str)
+}
@@ -0,0 +1,705 @@
+package file_storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	types2 "github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/errorj"
+	"github.com/jitsucom/bulker/jitsubase/logging"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"github.com/jitsucom/bulker/jitsubase/uuid"
+	jsoniter "github.com/json-iterator/go"
+	"math"
+	"math/big"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// icebergPartitionIdColumn identity partition column of tables written in ReplacePartition mode
+const icebergPartitionIdColumn = "__partition_id"
+
+// icebergCommitAttempts number of commit attempts when table was changed concurrently
+const icebergCommitAttempts = 5
+
+// deltaIcebergTypes Iceberg types of columns inferred from batch
+var deltaIcebergTypes = map[string]string{
+	deltaString:    icebergString,
+	deltaLong:      icebergLong,
+	deltaDouble:    icebergDouble,
+	deltaBoolean:   icebergBoolean,
+	deltaTimestamp: icebergTimestampTz,
+}
+
+// icebergDeltaTypes types of values written to data files for Iceberg column types
+var icebergDeltaTypes = map[string]string{
+	icebergString:      deltaString,
+	icebergLong:        deltaLong,
+	icebergDouble:      deltaDouble,
+	icebergBoolean:     deltaBoolean,
+	icebergTimestampTz: deltaTimestamp,
+}
+
+// IcebergStream writes batch to Iceberg table: parquet data files (one per partition), manifest and manifest list,
+// then commits new snapshot via Iceberg catalog.
+// Batch mode appends data files to the table, ReplaceTable mode replaces all files of the table,
+// ReplacePartition mode replaces files of the partition identified by __partition_id identity partition field.
+type IcebergStream struct {
+	AbstractFileStorageStream
+	bulker        *IcebergBulker
+	tableName     string
+	partitionId   string
+	partitionSpec []string
+}
+
+func NewIcebergStream(id string, b *IcebergBulker, tableName string, mode bulker.BulkMode, streamOptions ...bulker.StreamOption) (bulker.BulkerStream, error) {
+	switch mode {
+	case bulker.Batch, bulker.ReplaceTable, bulker.ReplacePartition:
+	default:
+		return nil, fmt.Errorf("unsupported bulk mode for Iceberg table: %s", mode)
+	}
+	is := IcebergStream{bulker: b, tableName: tableName}
+	var err error
+	is.AbstractFileStorageStream, err = newAbstractFileStorageStream(id, b, tableName, func(ctx context.Context) string {
+		return tableName
+	}, mode, streamOptions...)
+	if err != nil {
+		return nil, err
+	}
+	is.partitionSpec = IcebergPartitionSpecOption.Get(&is.options)
+	if mode == bulker.ReplacePartition {
+		is.partitionId = bulker.PartitionIdOption.Get(&is.options)
+		if is.partitionId == "" {
+			return nil, errors.New("WithPartition is required option for ReplacePartitionStream")
+		}
+	}
+	return &is, nil
+}
+
+// init creates batch file where flattened objects are buffered as ndjson until Complete
+func (is *IcebergStream) init() (err error) {
+	if is.inited {
+		return nil
+	}
+	is.batchFile, err = os.CreateTemp("", fmt.Sprintf("bulker_%s", utils.SanitizeString(is.id)))
+	if err != nil {
+		return err
+	}
+	is.marshaller, _ = types2.NewMarshaller(types2.FileFormatNDJSON, types2.FileCompressionNONE)
+	is.flatten = true
+	is.inited = true
+	return nil
+}
+
+func (is *IcebergStream) Consume(ctx context.Context, object types2.Object) (state bulker.State, processedObject types2.Object, err error) {
+	defer func() {
+		err = is.postConsume(err)
+		state = is.state
+	}()
+	if err = is.init(); err != nil {
+		return
+	}
+	processedObject, err = is.preprocess(object)
+	if err != nil {
+		return
+	}
+	err = is.writeToBatchFile(ctx, processedObject)
+	return
+}
+
+func (is *IcebergStream) ConsumeBatch(ctx context.Context, objects []types2.Object) (state bulker.State, processedObjects []types2.Object, err error) {
+	return bulker.ConsumeEach(ctx, is, objects)
+}
+
+func (is *IcebergStream) Complete(ctx context.Context) (state bulker.State, err error) {
+	if is.state.Status != bulker.Active {
+		return is.state, errors.New("stream is not active")
+	}
+	if err = is.init(); err != nil {
+		return is.state, err
+	}
+	defer func() {
+		state, err = is.postComplete(err)
+	}()
+	if is.state.LastError != nil {
+		err = is.state.LastError
+		return
+	}
+	if is.state.SuccessfulRows == 0 && is.mode == bulker.Batch {
+		return
+	}
+	err = is.commit(ctx)
+	return
+}
+
+// commit commits snapshot with batch data. Commit is retried when table was changed concurrently
+func (is *IcebergStream) commit(ctx context.Context) error {
+	if err := is.marshaller.Flush(); err != nil {
+		return errorj.Decorate(err, "failed to flush marshaller")
+	}
+	inferred, err := is.inferTypes()
+	if err != nil {
+		return err
+	}
+	for attempt := 1; ; attempt++ {
+		err = is.commitSnapshot(ctx, inferred)
+		if isIcebergErrorCode(err, http.StatusConflict) && attempt < icebergCommitAttempts {
+			logging.Warnf("[%s] Iceberg table %s was changed concurrently. Retrying commit: %v", is.id, is.tableName, err)
+			continue
+		}
+		return err
+	}
+}
+
+// inferTypes returns Iceberg types of batch columns. Empty type means that column has only null values
+func (is *IcebergStream) inferTypes() (map[string]string, error) {
+	inferred := map[string]string{}
+	err := is.forEachObject(func(object map[string]any) error {
+		for name, value := range object {
+			inferred[name] = mergeDeltaTypes(inferred[name], deltaTypeOf(value))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for name, deltaType := range inferred {
+		inferred[name] = deltaIcebergTypes[deltaType]
+	}
+	if is.partitionId != "" {
+		inferred[icebergPartitionIdColumn] = icebergString
+	}
+	return inferred, nil
+}
+
+func (is *IcebergStream) commitSnapshot(ctx context.Context, inferred map[string]string) error {
+	catalog := is.bulker.catalog
+	table, err := catalog.loadTable(ctx, is.tableName)
+	if err != nil {
+		return err
+	}
+	if table == nil {
+		if table, err = is.createTable(ctx, inferred); err != nil {
+			return err
+		}
+	}
+	metadata := &table.Metadata
+	if metadata.FormatVersion != 2 {
+		return fmt.Errorf("Iceberg table %s has format version %d. Only format version 2 is supported", is.tableName, metadata.FormatVersion)
+	}
+	currentSchema, err := metadata.currentSchema()
+	if err != nil {
+		return err
+	}
+	spec, err := metadata.defaultSpec()
+	if err != nil {
+		return err
+	}
+	schema, lastColumnId := is.evolveSchema(metadata, currentSchema, inferred)
+	partitionTypes := make([]string, len(spec.Fields))
+	partitionIdField := -1
+	for i, field := range spec.Fields {
+		source := schema.fieldById(field.SourceID)
+		if source == nil {
+			return fmt.Errorf("source column %d of partition field %s not found in schema of Iceberg table %s", field.SourceID, field.Name, is.tableName)
+		}
+		transform, err := parseIcebergTransform(field.Transform)
+		if err != nil {
+			return err
+		}
+		if partitionTypes[i], err = transform.resultType(source.primitiveType()); err != nil {
+			return fmt.Errorf("partition field %s: %v", field.Name, err)
+		}
+		if source.Name == icebergPartitionIdColumn && transform.name == "identity" {
+			partitionIdField = i
+		}
+	}
+	if is.mode == bulker.ReplacePartition && partitionIdField < 0 {
+		return fmt.Errorf("Iceberg table %s exists but it is not partitioned by %s column", is.tableName, icebergPartitionIdColumn)
+	}
+
+	snapshotId := newIcebergSnapshotId()
+	sequenceNumber := metadata.LastSequenceNumber + 1
+	files, err := is.writeDataFiles(metadata.Location, schema, spec, inferred)
+	if err != nil {
+		return err
+	}
+	manifests := make([]icebergManifestFile, 0)
+	var addedRows, deletedFiles, deletedRows int64
+	if len(files) > 0 {
+		manifest, err := writeIcebergManifest(schema, spec, partitionTypes, snapshotId, files)
+		if err != nil {
+			return errorj.Decorate(err, "failed to write Iceberg manifest")
+		}
+		manifestPath := fmt.Sprintf("%s/metadata/%s-m0.avro", metadata.Location, uuid.New())
+		if err = is.upload(manifestPath, manifest); err != nil {
+			return err
+		}
+		for _, file := range files {
+			addedRows += file.rows
+		}
+		manifests = append(manifests, icebergManifestFile{
+			ManifestPath:      manifestPath,
+			ManifestLength:    int64(len(manifest)),
+			PartitionSpecID:   int32(spec.SpecID),
+			SequenceNumber:    sequenceNumber,
+			MinSequenceNumber: sequenceNumber,
+			AddedSnapshotID:   snapshotId,
+			AddedFilesCount:   int32(len(files)),
+			AddedRowsCount:    addedRows,
+			Partitions:        icebergPartitionSummaries(spec, files),
+		})
+	}
+	parent := metadata.currentSnapshot()
+	if parent != nil && is.mode != bulker.ReplaceTable {
+		parentManifests, err := is.download(parent.ManifestList)
+		if err != nil {
+			return err
+		}
+		entries, _, err := readIcebergAvro[icebergManifestFile](parentManifests)
+		if err != nil {
+			return errorj.Decorate(err, "failed to read Iceberg manifest list")
+		}
+		for _, manifest := range entries {
+			if is.mode == bulker.ReplacePartition && manifest.Content == 0 {
+				replaced, files, rows, err := is.replacePartition(metadata, manifest, snapshotId, sequenceNumber)
+				if err != nil {
+					return err
+				}
+				deletedFiles, deletedRows = deletedFiles+files, deletedRows+rows
+				if replaced == nil {
+					continue
+				}
+				manifest = *replaced
+			}
+			manifests = append(manifests, manifest)
+		}
+	}
+	summary := map[string]string{
+		"operation":        "append",
+		"added-data-files": strconv.Itoa(len(files)),
+		"added-records":    strconv.FormatInt(addedRows, 10),
+	}
+	if is.mode != bulker.Batch {
+		summary["operation"] = "overwrite"
+		if is.mode == bulker.ReplaceTable && parent != nil {
+			deletedFiles, _ = strconv.ParseInt(parent.Summary["total-data-files"], 10, 64)
+			deletedRows, _ = strconv.ParseInt(parent.Summary["total-records"], 10, 64)
+		}
+		summary["deleted-data-files"] = strconv.FormatInt(deletedFiles, 10)
+		summary["deleted-records"] = strconv.FormatInt(deletedRows, 10)
+	}
+	if parent == nil || is.mode == bulker.ReplaceTable {
+		summary["total-data-files"] = strconv.Itoa(len(files))
+		summary["total-records"] = strconv.FormatInt(addedRows, 10)
+	} else if totalFiles, err := strconv.ParseInt(parent.Summary["total-data-files"], 10, 64); err == nil {
+		totalRows, _ := strconv.ParseInt(parent.Summary["total-records"], 10, 64)
+		summary["total-data-files"] = strconv.FormatInt(totalFiles+int64(len(files))-deletedFiles, 10)
+		summary["total-records"] = strconv.FormatInt(totalRows+addedRows-deletedRows, 10)
+	}
+
+	manifestListMetadata := map[string]string{
+		"snapshot-id":        strconv.FormatInt(snapshotId, 10),
+		"parent-snapshot-id": "null",
+		"sequence-number":    strconv.FormatInt(sequenceNumber, 10),
+		"format-version":     "2",
+	}
+	var parentId *int64
+	if parent != nil {
+		parentId = &parent.SnapshotID
+		manifestListMetadata["parent-snapshot-id"] = strconv.FormatInt(parent.SnapshotID, 10)
+	}
+	records := make([]any, len(manifests))
+	for i, manifest := range manifests {
+		records[i] = manifest
+	}
+	manifestList, err := writeIcebergAvro(icebergManifestListSchema, manifestListMetadata, records)
+	if err != nil {
+		return errorj.Decorate(err, "failed to write Iceberg manifest list")
+	}
+	snapshot := icebergSnapshot{
+		SnapshotID:       snapshotId,
+		ParentSnapshotID: parentId,
+		SequenceNumber:   sequenceNumber,
+		TimestampMs:      time.Now().UnixMilli(),
+		ManifestList:     fmt.Sprintf("%s/metadata/snap-%d-1-%s.avro", metadata.Location, snapshotId, uuid.New()),
+		Summary:          summary,
+		SchemaID:         &schema.SchemaID,
+	}
+	if err = is.upload(snapshot.ManifestList, manifestList); err != nil {
+		return err
+	}
+
+	request := icebergCommitRequest{
+		Requirements: []map[string]any{
+			{"type": "assert-table-uuid", "uuid": metadata.TableUUID},
+			{"type": "assert-ref-snapshot-id", "ref": "main", "snapshot-id": parentId},
+		},
+	}
+	if schema.SchemaID != currentSchema.SchemaID {
+		request.Requirements = append(request.Requirements,
+			map[string]any{"type": "assert-current-schema-id", "current-schema-id": currentSchema.SchemaID},
+			map[string]any{"type": "assert-last-assigned-field-id", "last-assigned-field-id": metadata.LastColumnID})
+		request.Updates = append(request.Updates,
+			map[string]any{"action": "add-schema", "schema": schema, "last-column-id": lastColumnId},
+			map[string]any{"action": "set-current-schema", "schema-id": -1})
+	}
+	request.Updates = append(request.Updates,
+		map[string]any{"action": "add-snapshot", "snapshot": snapshot},
+		map[string]any{"action": "set-snapshot-ref", "ref-name": "main", "type": "branch", "snapshot-id": snapshotId})
+	if _, err = catalog.commitTable(ctx, is.tableName, request); err != nil {
+		return err
+	}
+	is.state.Representation = map[string]string{
+		"name":       is.bulker.config.Namespace + "." + is.tableName,
+		"snapshotId": strconv.FormatInt(snapshotId, 10),
+	}
+	logging.Infof("[%s] Committed snapshot %d of Iceberg table %s", is.id, snapshotId, is.tableName)
+	return nil
+}
+
+// createTable creates table with batch columns and partition spec from IcebergPartitionSpecOption.
+// Tables created in ReplacePartition mode are also partitioned by __partition_id column
+func (is *IcebergStream) createTable(ctx context.Context, inferred map[string]string) (*icebergLoadTableResult, error) {
+	columns := make([]string, 0, len(inferred))
+	for name := range inferred {
+		columns = append(columns, name)
+	}
+	sort.Strings(columns)
+	schema := icebergSchema{Type: "struct", Fields: make([]icebergField, len(columns))}
+	for i, name := range columns {
+		fieldType, _ := json.Marshal(utils.DefaultString(inferred[name], icebergString))
+		schema.Fields[i] = icebergField{ID: i + 1, Name: name, Type: fieldType}
+	}
+	partitionFields := slices.Clone(is.partitionSpec)
+	if is.mode == bulker.ReplacePartition {
+		partitionFields = append(partitionFields, icebergPartitionIdColumn)
+	}
+	spec := icebergPartitionSpec{Fields: make([]icebergPartitionField, 0, len(partitionFields))}
+	for _, partitionField := range partitionFields {
+		column, transform, err := parseIcebergPartitionField(partitionField)
+		if err != nil {
+			return nil, err
+		}
+		source := schema.field(column)
+		if source == nil {
+			return nil, fmt.Errorf("partition column %s not found in batch", column)
+		}
+		if _, err = transform.resultType(source.primitiveType()); err != nil {
+			return nil, fmt.Errorf("partition field %s: %v", partitionField, err)
+		}
+		spec.Fields = append(spec.Fields, icebergPartitionField{SourceID: source.ID, FieldID: 1000 + len(spec.Fields),
+			Name: transform.fieldName(column), Transform: transform.String()})
+	}
+	table, err := is.bulker.catalog.createTable(ctx, icebergCreateTableRequest{
+		Name:          is.tableName,
+		Location:      is.bulker.tableLocation(is.tableName),
+		Schema:        schema,
+		PartitionSpec: spec,
+		Properties:    map[string]string{"format-version": "2"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	logging.Infof("[%s] Created Iceberg table %s.%s at %s", is.id, is.bulker.config.Namespace, is.tableName, table.Metadata.Location)
+	return table, nil
+}
+
+// evolveSchema returns current schema extended with new columns of the batch and last assigned column id.
+// Types of existing columns are preserved: values of batch are converted to them
+func (is *IcebergStream) evolveSchema(metadata *icebergTableMetadata, current icebergSchema, inferred map[string]string) (icebergSchema, int) {
+	newColumns := make([]string, 0)
+	for name := range inferred {
+		if current.field(name) == nil {
+			newColumns = append(newColumns, name)
+		}
+	}
+	if len(newColumns) == 0 {
+		return current, metadata.LastColumnID
+	}
+	sort.Strings(newColumns)
+	schema := icebergSchema{Type: "struct", IdentifierFieldIDs: current.IdentifierFieldIDs, Fields: slices.Clone(current.Fields)}
+	for _, s := range metadata.Schemas {
+		schema.SchemaID = max(schema.SchemaID, s.SchemaID+1)
+	}
+	lastColumnId := metadata.LastColumnID
+	for _, name := range newColumns {
+		lastColumnId++
+		fieldType, _ := json.Marshal(utils.DefaultString(inferred[name], icebergString))
+		schema.Fields = append(schema.Fields, icebergField{ID: lastColumnId, Name: name, Type: fieldType})
+	}
+	return schema, lastColumnId
+}
+
+// icebergPartitionFile data file of single partition
+type icebergPartitionFile struct {
+	*parquetFile
+	partition []any
+}
+
+// writeDataFiles writes buffered objects to parquet files (one per partition) and uploads them to the data folder of the table
+func (is *IcebergStream) writeDataFiles(location string, schema icebergSchema, spec icebergPartitionSpec, inferred map[string]string) ([]icebergDataFile, error) {
+	if is.eventsInBatch == 0 {
+		return nil, nil
+	}
+	dataFields := make([]deltaField, 0, len(inferred))
+	fieldIds := make([]int, 0, len(inferred))
+	for _, field := range schema.Fields {
+		inferredType, ok := inferred[field.Name]
+		if !ok {
+			continue
+		}
+		deltaType, ok := icebergDeltaTypes[field.primitiveType()]
+		if !ok {
+			if inferredType == "" {
+				// only null values: column is omitted from data file
+				continue
+			}
+			return nil, fmt.Errorf("column %s of Iceberg table %s has type %s that is not supported by writer. Supported types: string, long, double, boolean, timestamptz", field.Name, is.tableName, field.Type)
+		}
+		dataFields = append(dataFields, deltaField{Name: field.Name, Type: deltaType, Nullable: true})
+		fieldIds = append(fieldIds, field.ID)
+	}
+	sources := make([]*icebergField, len(spec.Fields))
+	transforms := make([]icebergPartitionTransform, len(spec.Fields))
+	for i, field := range spec.Fields {
+		sources[i] = schema.fieldById(field.SourceID)
+		transforms[i], _ = parseIcebergTransform(field.Transform)
+	}
+	partitionFiles := map[string]*icebergPartitionFile{}
+	defer func() {
+		for _, file := range partitionFiles {
+			file.release()
+		}
+	}()
+	err := is.forEachObject(func(object map[string]any) error {
+		if is.partitionId != "" {
+			object[icebergPartitionIdColumn] = is.partitionId
+		}
+		partition := make([]any, len(spec.Fields))
+		for i, source := range sources {
+			value, err := icebergValue(source.primitiveType(), object[source.Name])
+			if err != nil {
+				return fmt.Errorf("value '%v' of partition column %s can't be converted to %s: %v", object[source.Name], source.Name, source.Type, err)
+			}
+			partition[i] = transforms[i].apply(value)
+		}
+		key, _ := json.Marshal(partition)
+		file, ok := partitionFiles[string(key)]
+		if !ok {
+			pf, err := newParquetFile(path.Base(is.batchFile.Name()), dataFields, fieldIds)
+			if err != nil {
+				return err
+			}
+			file = &icebergPartitionFile{parquetFile: pf, partition: partition}
+			partitionFiles[string(key)] = file
+		}
+		return file.append(object)
+	})
+	if err != nil {
+		return nil, errorj.Decorate(err, "failed to write parquet file")
+	}
+	dataFiles := make([]icebergDataFile, 0, len(partitionFiles))
+	for _, file := range partitionFiles {
+		if err = file.close(); err != nil {
+			return nil, err
+		}
+		folder := ""
+		for i, field := range spec.Fields {
+			resultType, _ := transforms[i].resultType(sources[i].primitiveType())
+			folder += icebergPartitionPath(field.Name, resultType, file.partition[i]) + "/"
+		}
+		dataFile := icebergDataFile{path: fmt.Sprintf("%s/data/%s%s.parquet", location, folder, uuid.New()), size: file.size, rows: int64(file.rows), partition: file.partition}
+		if err = is.uploadDataFile(dataFile.path, file.parquetFile); err != nil {
+			return nil, err
+		}
+		dataFiles = append(dataFiles, dataFile)
+	}
+	return dataFiles, nil
+}
+
+func (is *IcebergStream) uploadDataFile(location string, file *parquetFile) error {
+	key, err := icebergStorageKey(location, &is.bulker.config.S3Config)
+	if err != nil {
+		return err
+	}
+	parquetFile, err := file.open()
+	if err != nil {
+		return err
+	}
+	defer parquetFile.Close()
+	loadTime := time.Now()
+	if err = is.fileAdapter.Upload(key, parquetFile); err != nil {
+		return errorj.Decorate(err, "failed to upload parquet file")
+	}
+	logging.Infof("[%s] %s loaded to %s in %.2f s.", is.id, file, is.fileAdapter.Type(), time.Since(loadTime).Seconds())
+	return nil
+}
+
+// replacePartition returns manifest without data files of replaced partition along with number of removed files and rows.
+// Returns nil manifest when all files of manifest belong to the partition
+func (is *IcebergStream) replacePartition(metadata *icebergTableMetadata, manifest icebergManifestFile, snapshotId, sequenceNumber int64) (*icebergManifestFile, int64, int64, error) {
+	fieldIndex := -1
+	fieldName := ""
+	for _, spec := range metadata.PartitionSpecs {
+		if spec.SpecID != int(manifest.PartitionSpecID) {
+			continue
+		}
+		schema, _ := metadata.currentSchema()
+		for i, field := range spec.Fields {
+			if source := schema.fieldById(field.SourceID); source != nil && source.Name == icebergPartitionIdColumn && field.Transform == "identity" {
+				fieldIndex, fieldName = i, field.Name
+			}
+		}
+	}
+	if fieldIndex < 0 {
+		// files written with partition spec without __partition_id field don't belong to any partition
+		return &manifest, 0, 0, nil
+	}
+	if manifest.Partitions != nil && fieldIndex < len(*manifest.Partitions) {
+		summary := (*manifest.Partitions)[fieldIndex]
+		if summary.LowerBound == nil || summary.UpperBound == nil ||
+			string(*summary.LowerBound) > is.partitionId || string(*summary.UpperBound) < is.partitionId {
+			return &manifest, 0, 0, nil
+		}
+	}
+	data, err := is.download(manifest.ManifestPath)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	entries, avroMetadata, err := readIcebergAvro[map[string]any](data)
+	if err != nil {
+		return nil, 0, 0, errorj.Decorate(err, "failed to read Iceberg manifest")
+	}
+	kept := make([]any, 0, len(entries))
+	var deletedFiles, deletedRows, existingRows int64
+	minSequenceNumber := int64(math.MaxInt64)
+	for _, entry := range entries {
+		if status, _ := entry["status"].(int); status == icebergEntryDeleted {
+			continue
+		}
+		dataFile, _ := entry["data_file"].(map[string]any)
+		partition, _ := dataFile["partition"].(map[string]any)
+		rows, _ := dataFile["record_count"].(int64)
+		if avroUnionValue(partition[fieldName]) == is.partitionId {
+			deletedFiles++
+			deletedRows += rows
+			continue
+		}
+		// existing entries must have explicit snapshot id and sequence numbers
+		entry["status"] = icebergEntryExisting
+		if entry["snapshot_id"] == nil {
+			entry["snapshot_id"] = map[string]any{"long": manifest.AddedSnapshotID}
+		}
+		for _, key := range []string{"sequence_number", "file_sequence_number"} {
+			if entry[key] == nil {
+				entry[key] = map[string]any{"long": manifest.SequenceNumber}
+			}
+		}
+		entrySequenceNumber, _ := avroUnionValue(entry["sequence_number"]).(int64)
+		minSequenceNumber = min(minSequenceNumber, entrySequenceNumber)
+		existingRows += rows
+		kept = append(kept, entry)
+	}
+	if deletedFiles == 0 {
+		return &manifest, 0, 0, nil
+	}
+	if len(kept) == 0 {
+		return nil, deletedFiles, deletedRows, nil
+	}
+	fileMetadata := map[string]string{}
+	for key, value := range avroMetadata {
+		if !strings.HasPrefix(key, "avro.") {
+			fileMetadata[key] = string(value)
+		}
+	}
+	rewritten, err := writeIcebergAvro(string(avroMetadata["avro.schema"]), fileMetadata, kept)
+	if err != nil {
+		return nil, 0, 0, errorj.Decorate(err, "failed to write Iceberg manifest")
+	}
+	manifestPath := fmt.Sprintf("%s/metadata/%s-m0.avro", metadata.Location, uuid.New())
+	if err = is.upload(manifestPath, rewritten); err != nil {
+		return nil, 0, 0, err
+	}
+	return &icebergManifestFile{
+		ManifestPath:       manifestPath,
+		ManifestLength:     int64(len(rewritten)),
+		PartitionSpecID:    manifest.PartitionSpecID,
+		SequenceNumber:     sequenceNumber,
+		MinSequenceNumber:  minSequenceNumber,
+		AddedSnapshotID:    snapshotId,
+		ExistingFilesCount: int32(len(kept)),
+		ExistingRowsCount:  existingRows,
+		Partitions:         manifest.Partitions,
+	}, deletedFiles, deletedRows, nil
+}
+
+func (is *IcebergStream) upload(location string, data []byte) error {
+	key, err := icebergStorageKey(location, &is.bulker.config.S3Config)
+	if err != nil {
+		return err
+	}
+	if err = is.fileAdapter.UploadBytes(key, data); err != nil {
+		return errorj.Decorate(err, "failed to upload Iceberg metadata file")
+	}
+	return nil
+}
+
+func (is *IcebergStream) download(location string) ([]byte, error) {
+	key, err := icebergStorageKey(location, &is.bulker.config.S3Config)
+	if err != nil {
+		return nil, err
+	}
+	data, err := is.fileAdapter.Download(key)
+	if err != nil {
+		return nil, errorj.Decorate(err, "failed to download Iceberg metadata file")
+	}
+	return data, nil
+}
+
+// icebergValue converts value to Go type of Iceberg column: int64, float64, bool, string or timestamp micros (int64)
+func icebergValue(icebergType string, value any) (any, error) {
+	if value == nil {
+		return nil, nil
+	}
+	str := fmt.Sprint(value)
+	switch icebergType {
+	case icebergLong:
+		return strconv.ParseInt(str, 10, 64)
+	case icebergDouble:
+		return strconv.ParseFloat(str, 64)
+	case icebergBoolean:
+		return strconv.ParseBool(str)
+	case icebergTimestampTz:
+		if t, ok := types2.ReformatTimeValue(value, false); ok {
+			return t.UnixMicro(), nil
+		}
+		return nil, errors.New("not a timestamp")
+	case icebergString:
+		if _, ok := value.(map[string]any); ok {
+			v, err := jsoniter.Marshal(value)
+			return string(v), err
+		}
+		return str, nil
+	default:
+		return nil, fmt.Errorf("unsupported type %s", icebergType)
+	}
+}
+
+// newIcebergSnapshotId returns random positive snapshot id
+func newIcebergSnapshotId() int64 {
+	id, err := rand.Int(rand.Reader, big.NewInt(math.MaxInt64))
+	if err != nil || id.Int64() == 0 {
+		return time.Now().UnixNano()
+	}
+	return id.Int64()
+}
@@ -0,0 +1,211 @@
+package file_storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/implementations"
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/uuid"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testIcebergCatalog in-memory Iceberg REST catalog that supports requests used by IcebergStream
+type testIcebergCatalog struct {
+	sync.Mutex
+	warehouse string
+	tables    map[string]*icebergTableMetadata
+}
+
+func (c *testIcebergCatalog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.Lock()
+	defer c.Unlock()
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	tableName := ""
+	if i := strings.Index(path, "/tables/"); i >= 0 {
+		tableName = path[i+len("/tables/"):]
+	}
+	writeError := func(code int, message string) {
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(map[string]any{"error": icebergError{Code: code, Message: message}})
+	}
+	writeTable := func(metadata *icebergTableMetadata) {
+		_ = json.NewEncoder(w).Encode(icebergLoadTableResult{Metadata: *metadata})
+	}
+	switch {
+	case path == "config":
+		_ = json.NewEncoder(w).Encode(map[string]any{"defaults": map[string]string{}, "overrides": map[string]string{}})
+	case path == "namespaces":
+		writeError(http.StatusConflict, "namespace already exists")
+	case strings.HasSuffix(path, "/tables"):
+		request := icebergCreateTableRequest{}
+		_ = json.NewDecoder(r.Body).Decode(&request)
+		if c.tables[request.Name] != nil {
+			writeError(http.StatusConflict, "table already exists")
+			return
+		}
+		metadata := &icebergTableMetadata{FormatVersion: 2, TableUUID: uuid.New(), Location: c.warehouse + "/" + request.Name,
+			LastColumnID: len(request.Schema.Fields), Schemas: []icebergSchema{request.Schema},
+			PartitionSpecs: []icebergPartitionSpec{request.PartitionSpec}, Properties: request.Properties}
+		c.tables[request.Name] = metadata
+		writeTable(metadata)
+	case r.Method == http.MethodGet:
+		if metadata, ok := c.tables[tableName]; ok {
+			writeTable(metadata)
+		} else {
+			writeError(http.StatusNotFound, "table not found")
+		}
+	default:
+		metadata := c.tables[tableName]
+		request := struct {
+			Requirements []map[string]any `json:"requirements"`
+			Updates      []map[string]any `json:"updates"`
+		}{}
+		decoder := json.NewDecoder(r.Body)
+		decoder.UseNumber()
+		_ = decoder.Decode(&request)
+		for _, requirement := range request.Requirements {
+			if requirement["type"] == "assert-ref-snapshot-id" {
+				expected, _ := requirement["snapshot-id"].(json.Number)
+				expectedId, _ := expected.Int64()
+				if (metadata.CurrentSnapshotID == nil && expected != "") ||
+					(metadata.CurrentSnapshotID != nil && expectedId != *metadata.CurrentSnapshotID) {
+					writeError(http.StatusConflict, "branch main has changed")
+					return
+				}
+			}
+		}
+		for _, update := range request.Updates {
+			raw, _ := json.Marshal(update)
+			switch update["action"] {
+			case "add-schema":
+				schema := struct {
+					Schema       icebergSchema `json:"schema"`
+					LastColumnID int           `json:"last-column-id"`
+				}{}
+				_ = json.Unmarshal(raw, &schema)
+				metadata.Schemas = append(metadata.Schemas, schema.Schema)
+				metadata.LastColumnID = schema.LastColumnID
+			case "set-current-schema":
+				metadata.CurrentSchemaID = metadata.Schemas[len(metadata.Schemas)-1].SchemaID
+			case "add-snapshot":
+				snapshot := struct {
+					Snapshot icebergSnapshot `json:"snapshot"`
+				}{}
+				_ = json.Unmarshal(raw, &snapshot)
+				metadata.Snapshots = append(metadata.Snapshots, snapshot.Snapshot)
+				metadata.LastSequenceNumber = snapshot.Snapshot.SequenceNumber
+			case "set-snapshot-ref":
+				snapshotId, _ := update["snapshot-id"].(json.Number).Int64()
+				metadata.CurrentSnapshotID = &snapshotId
+			}
+		}
+		writeTable(metadata)
+	}
+}
+
+func TestIceberg(t *testing.T) {
+	if minioContainer == nil {
+		t.Skip("Iceberg test requires minio container")
+	}
+	reqr := require.New(t)
+	catalog := &testIcebergCatalog{warehouse: "s3://bulkertests/iceberg", tables: map[string]*icebergTableMetadata{}}
+	catalogServer := httptest.NewServer(catalog)
+	defer catalogServer.Close()
+	blk, err := bulker.CreateBulker(bulker.Config{Id: "iceberg", BulkerType: IcebergBulkerTypeId, LogLevel: bulker.Verbose,
+		DestinationConfig: IcebergConfig{
+			S3Config: implementations.S3Config{
+				Endpoint:  fmt.Sprintf("http://%s:%d", minioContainer.Host, minioContainer.Port),
+				Region:    "us-east-1",
+				Bucket:    "bulkertests",
+				AccessKey: minioContainer.AccessKey,
+				SecretKey: minioContainer.SecretKey,
+			},
+			CatalogURI: catalogServer.URL,
+			Namespace:  "tests",
+		}})
+	reqr.NoError(err)
+	defer func() {
+		_ = blk.Close()
+	}()
+	icebergBulker := blk.(*IcebergBulker)
+
+	write := func(tableName string, mode bulker.BulkMode, objects []types.Object, options ...bulker.StreamOption) {
+		stream, err := blk.CreateStream(tableName, tableName, mode, options...)
+		reqr.NoError(err)
+		for _, object := range objects {
+			_, _, err = stream.Consume(context.Background(), object)
+			reqr.NoError(err)
+		}
+		state, err := stream.Complete(context.Background())
+		reqr.NoError(err)
+		reqr.Equal(bulker.Completed, state.Status)
+	}
+	download := func(location string) []byte {
+		key, err := icebergStorageKey(location, &icebergBulker.config.S3Config)
+		reqr.NoError(err)
+		data, err := icebergBulker.Download(key)
+		reqr.NoError(err)
+		return data
+	}
+	// liveFiles returns data files of current snapshot
+	liveFiles := func(tableName string) []map[string]any {
+		metadata := catalog.tables[tableName]
+		manifests, _, err := readIcebergAvro[icebergManifestFile](download(metadata.currentSnapshot().ManifestList))
+		reqr.NoError(err)
+		files := make([]map[string]any, 0)
+		for _, manifest := range manifests {
+			entries, _, err := readIcebergAvro[map[string]any](download(manifest.ManifestPath))
+			reqr.NoError(err)
+			for _, entry := range entries {
+				if entry["status"] != icebergEntryDeleted {
+					dataFile := entry["data_file"].(map[string]any)
+					download(dataFile["file_path"].(string))
+					files = append(files, dataFile)
+				}
+			}
+		}
+		return files
+	}
+
+	tableName := "iceberg_" + strings.ReplaceAll(uuid.New(), "-", "")
+	write(tableName, bulker.Batch, []types.Object{
+		{"id": 1, "name": "a", "_timestamp": "2024-01-01T10:00:00Z"},
+		{"id": 2, "name": "b", "_timestamp": "2024-01-02T10:00:00Z"},
+	}, WithIcebergPartitionSpec("day(_timestamp)"))
+	write(tableName, bulker.Batch, []types.Object{{"id": 3, "name": "c", "value": 1.5, "_timestamp": "2024-01-02T11:00:00Z"}})
+	metadata := catalog.tables[tableName]
+	schema, err := metadata.currentSchema()
+	reqr.NoError(err)
+	reqr.Equal(1, schema.SchemaID)
+	reqr.Equal(icebergLong, schema.field("id").primitiveType())
+	reqr.Equal(icebergDouble, schema.field("value").primitiveType())
+	reqr.Equal(icebergTimestampTz, schema.field("_timestamp").primitiveType())
+	reqr.Equal("_timestamp_day", metadata.PartitionSpecs[0].Fields[0].Name)
+	reqr.Len(liveFiles(tableName), 3)
+
+	write(tableName, bulker.ReplaceTable, []types.Object{{"id": 4, "name": "d", "_timestamp": "2024-01-03T10:00:00Z"}})
+	files := liveFiles(tableName)
+	reqr.Len(files, 1)
+	reqr.EqualValues(1, files[0]["record_count"])
+	reqr.Len(catalog.tables[tableName].Snapshots, 3)
+
+	partitionedTable := tableName + "_partitioned"
+	partitionId := uuid.New()
+	write(partitionedTable, bulker.ReplacePartition, []types.Object{{"id": 1}, {"id": 2}}, bulker.WithPartition(partitionId))
+	write(partitionedTable, bulker.ReplacePartition, []types.Object{{"id": 3}}, bulker.WithPartition(uuid.New()))
+	write(partitionedTable, bulker.ReplacePartition, []types.Object{{"id": 4}}, bulker.WithPartition(partitionId))
+	files = liveFiles(partitionedTable)
+	reqr.Len(files, 2)
+	rows := int64(0)
+	for _, file := range files {
+		rows += file["record_count"].(int64)
+	}
+	reqr.EqualValues(2, rows)
+}
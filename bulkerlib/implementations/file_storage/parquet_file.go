@@ -0,0 +1,165 @@
+package file_storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+	"github.com/apache/arrow/go/v12/parquet"
+	"github.com/apache/arrow/go/v12/parquet/compress"
+	"github.com/apache/arrow/go/v12/parquet/file"
+	"github.com/apache/arrow/go/v12/parquet/pqarrow"
+	"github.com/jitsucom/bulker/jitsubase/errorj"
+	"os"
+	"strconv"
+	"time"
+)
+
+// parquetRecordBatchSize number of rows in parquet row group
+const parquetRecordBatchSize = 10000
+
+// parquetFile local snappy compressed parquet file of table data. Values are converted to the types of provided fields
+type parquetFile struct {
+	fields  []deltaField
+	file    *os.File
+	writer  *pqarrow.FileWriter
+	builder *array.RecordBuilder
+	rows    int
+	size    int64
+}
+
+// newParquetFile creates local parquet file with columns of provided fields.
+// fieldIds are written as parquet field ids when not empty (required by Iceberg)
+func newParquetFile(namePrefix string, fields []deltaField, fieldIds []int) (*parquetFile, error) {
+	arrowFields := make([]arrow.Field, len(fields))
+	for i, field := range fields {
+		arrowFields[i] = arrow.Field{Name: field.Name, Type: deltaArrowType(field.Type), Nullable: true}
+		if len(fieldIds) > 0 {
+			arrowFields[i].Metadata = arrow.NewMetadata([]string{"PARQUET:field_id"}, []string{strconv.Itoa(fieldIds[i])})
+		}
+	}
+	arrowSchema := arrow.NewSchema(arrowFields, nil)
+	file, err := os.CreateTemp("", namePrefix+"_parquet")
+	if err != nil {
+		return nil, errorj.Decorate(err, "failed to create parquet file")
+	}
+	writer, err := pqarrow.NewFileWriter(arrowSchema, file, parquet.NewWriterProperties(parquet.WithCompression(compress.Codecs.Snappy)), pqarrow.DefaultWriterProps())
+	if err != nil {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+		return nil, errorj.Decorate(err, "failed to create parquet writer")
+	}
+	return &parquetFile{fields: fields, file: file, writer: writer, builder: array.NewRecordBuilder(memory.DefaultAllocator, arrowSchema)}, nil
+}
+
+func (pf *parquetFile) append(object map[string]any) error {
+	for i, field := range pf.fields {
+		if err := appendDeltaValue(pf.builder.Field(i), field, object[field.Name]); err != nil {
+			return err
+		}
+	}
+	pf.rows++
+	if pf.rows%parquetRecordBatchSize == 0 {
+		return pf.writeRecord()
+	}
+	return nil
+}
+
+func (pf *parquetFile) writeRecord() error {
+	record := pf.builder.NewRecord()
+	defer record.Release()
+	if err := pf.writer.Write(record); err != nil {
+		return errorj.Decorate(err, "failed to write parquet file")
+	}
+	return nil
+}
+
+// close writes remaining rows and parquet footer
+func (pf *parquetFile) close() error {
+	if pf.rows%parquetRecordBatchSize != 0 {
+		if err := pf.writeRecord(); err != nil {
+			_ = pf.writer.Close()
+			return err
+		}
+	}
+	if err := pf.writer.Close(); err != nil {
+		return errorj.Decorate(err, "failed to write parquet file")
+	}
+	stat, err := os.Stat(pf.file.Name())
+	if err != nil {
+		return errorj.Decorate(err, "failed to stat parquet file")
+	}
+	pf.size = stat.Size()
+	return nil
+}
+
+// open opens closed parquet file for reading
+func (pf *parquetFile) open() (*os.File, error) {
+	file, err := os.Open(pf.file.Name())
+	if err != nil {
+		return nil, errorj.Decorate(err, "failed to open parquet file")
+	}
+	return file, nil
+}
+
+// release removes local file
+func (pf *parquetFile) release() {
+	pf.builder.Release()
+	_ = pf.file.Close()
+	_ = os.Remove(pf.file.Name())
+}
+
+func (pf *parquetFile) String() string {
+	return fmt.Sprintf("parquet file with %d rows (%.2f mb)", pf.rows, float64(pf.size)/1024/1024)
+}
+
+// readParquetObjects reads rows of parquet file written by parquetFile. Values are converted back to the form of batch file objects:
+// timestamps to RFC3339 strings, nulls to nil
+func readParquetObjects(data []byte, f func(object map[string]any) error) error {
+	parquetReader, err := file.NewParquetReader(bytes.NewReader(data))
+	if err != nil {
+		return errorj.Decorate(err, "failed to open parquet file")
+	}
+	defer parquetReader.Close()
+	reader, err := pqarrow.NewFileReader(parquetReader, pqarrow.ArrowReadProperties{BatchSize: parquetRecordBatchSize}, memory.DefaultAllocator)
+	if err != nil {
+		return errorj.Decorate(err, "failed to read parquet file")
+	}
+	recordReader, err := reader.GetRecordReader(context.Background(), nil, nil)
+	if err != nil {
+		return errorj.Decorate(err, "failed to read parquet file")
+	}
+	defer recordReader.Release()
+	for recordReader.Next() {
+		record := recordReader.Record()
+		for row := 0; row < int(record.NumRows()); row++ {
+			object := make(map[string]any, record.NumCols())
+			for i, column := range record.Columns() {
+				var value any
+				if column.IsValid(row) {
+					switch c := column.(type) {
+					case *array.Int64:
+						value = c.Value(row)
+					case *array.Float64:
+						value = c.Value(row)
+					case *array.Boolean:
+						value = c.Value(row)
+					case *array.Timestamp:
+						value = time.UnixMicro(int64(c.Value(row))).UTC().Format(time.RFC3339Nano)
+					case *array.String:
+						value = c.Value(row)
+					default:
+						return fmt.Errorf("unsupported parquet column type %s of column %s", column.DataType(), record.ColumnName(i))
+					}
+				}
+				object[record.ColumnName(i)] = value
+			}
+			if err = f(object); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package file_storage
+
+import (
+	"encoding/json"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	types2 "github.com/jitsucom/bulker/bulkerlib/types"
+)
+
+// ProtobufDescriptorExtension extension of file with FileDescriptorSet of generated protobuf schema uploaded next to batch file
+const ProtobufDescriptorExtension = ".desc"
+
+var (
+	// ProtobufSchemaOption - message type of files in "protobuf" format. By default, schema is generated from columns of the batch
+	// and FileDescriptorSet of generated schema is uploaded next to every batch file with .desc extension
+	ProtobufSchemaOption = bulker.ImplementationOption[*types2.ProtobufSchema]{
+		Key:       "protobufSchema",
+		ParseFunc: parseProtobufSchema,
+	}
+)
+
+func init() {
+	bulker.RegisterOption(&ProtobufSchemaOption)
+}
+
+// WithProtobufSchema sets message type of files in "protobuf" format
+func WithProtobufSchema(schema *types2.ProtobufSchema) bulker.StreamOption {
+	return bulker.WithOption(&ProtobufSchemaOption, schema)
+}
+
+func parseProtobufSchema(serialized any) (*types2.ProtobufSchema, error) {
+	var raw []byte
+	switch v := serialized.(type) {
+	case *types2.ProtobufSchema:
+		return v, nil
+	case string:
+		raw = []byte(v)
+	default:
+		var err error
+		raw, err = json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value type of protobufSchema option: %T", v)
+		}
+	}
+	schema := &types2.ProtobufSchema{}
+	if err := json.Unmarshal(raw, schema); err != nil {
+		return nil, fmt.Errorf("failed to parse protobufSchema option: %v", err)
+	}
+	if schema.DescriptorSet == "" || schema.Message == "" {
+		return nil, fmt.Errorf("protobufSchema option requires descriptorSet and message")
+	}
+	return schema, nil
+}
+
+// uploadProtobufDescriptor uploads FileDescriptorSet of generated protobuf schema of batch file next to it.
+// Returns path of uploaded file or empty string if schema wasn't generated
+func (ps *AbstractFileStorageStream) uploadProtobufDescriptor(fileName string) (string, error) {
+	protobufMarshaller, ok := ps.targetMarshaller.(*types2.ProtobufMarshaller)
+	if !ok || !protobufMarshaller.GeneratedSchema() || protobufMarshaller.Descriptor() == nil {
+		return "", nil
+	}
+	descriptorSet, err := types2.ProtobufDescriptorSet(protobufMarshaller.Descriptor())
+	if err != nil {
+		return "", err
+	}
+	descriptorFileName := fileName + ProtobufDescriptorExtension
+	if err = ps.fileAdapter.UploadBytes(descriptorFileName, descriptorSet); err != nil {
+		return "", err
+	}
+	return ps.fileAdapter.Path(descriptorFileName), nil
+}
@@ -26,7 +26,7 @@ func NewReplacePartitionStream(id string, p implementations.FileAdapter, tableNa
 	filenameFunc := func(ctx context.Context) string {
 		return fmt.Sprintf("%s/%s", tableName, partitionId)
 	}
-	ps.AbstractFileStorageStream, err = newAbstractFileStorageStream(id, p, filenameFunc, bulker.ReplacePartition, streamOptions...)
+	ps.AbstractFileStorageStream, err = newAbstractFileStorageStream(id, p, tableName, filenameFunc, bulker.ReplacePartition, streamOptions...)
 	if err != nil {
 		return nil, err
 	}
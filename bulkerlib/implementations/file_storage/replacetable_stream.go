@@ -15,7 +15,7 @@ func NewReplaceTableStream(id string, p implementations.FileAdapter, tableName s
 	ps := ReplaceTableStream{}
 
 	var err error
-	ps.AbstractFileStorageStream, err = newAbstractFileStorageStream(id, p, func(ctx context.Context) string {
+	ps.AbstractFileStorageStream, err = newAbstractFileStorageStream(id, p, tableName, func(ctx context.Context) string {
 		return tableName
 	}, bulker.ReplaceTable, streamOptions...)
 	if err != nil {
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	bulker "github.com/jitsucom/bulker/bulkerlib"
 	"github.com/jitsucom/bulker/bulkerlib/implementations"
+	"github.com/jitsucom/bulker/bulkerlib/types"
 	"github.com/jitsucom/bulker/jitsubase/utils"
 )
 
@@ -13,6 +14,7 @@ const S3AutocommitUnsupported = "Stream mode is not supported for GCS. Please us
 
 func init() {
 	bulker.RegisterBulker(S3BulkerTypeId, NewS3Bulker)
+	bulker.RegisterConfigType(S3BulkerTypeId, implementations.S3Config{})
 }
 
 type S3Bulker struct {
@@ -32,6 +34,12 @@ func NewS3Bulker(bulkerConfig bulker.Config) (bulker.Bulker, error) {
 }
 
 func (s3 *S3Bulker) CreateStream(id, tableName string, mode bulker.BulkMode, streamOptions ...bulker.StreamOption) (bulker.BulkerStream, error) {
+	if s3.Format() == types.FileFormatDelta && mode != bulker.Stream {
+		return NewDeltaLakeStream(id, s3, tableName, mode, streamOptions...)
+	}
+	if s3.Format() == types.FileFormatHudi && mode != bulker.Stream {
+		return NewHudiStream(id, s3, tableName, mode, streamOptions...)
+	}
 	switch mode {
 	case bulker.Stream:
 		return nil, errors.New(S3AutocommitUnsupported)
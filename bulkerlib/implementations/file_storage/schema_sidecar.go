@@ -0,0 +1,206 @@
+package file_storage
+
+import (
+	"encoding/json"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	types2 "github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"reflect"
+	"sort"
+)
+
+// SchemaSidecarExtension extension of file with schema of batch file uploaded next to it
+const SchemaSidecarExtension = ".schema.json"
+
+// Formats of schema sidecar file. See SchemaSidecarOption
+const (
+	SchemaSidecarJSONSchema = "jsonSchema"
+	SchemaSidecarColumns    = "columns"
+	SchemaSidecarArrow      = "arrow"
+)
+
+var (
+	// SchemaSidecarOption - upload file with observed fields and inferred types next to every batch file (<file>.schema.json):
+	// "jsonSchema" - JSON Schema (draft 2020-12) of rows, "columns" - simple manifest with list of columns and their types,
+	// "arrow" - Arrow schema in JSON representation used by Arrow integration tests
+	SchemaSidecarOption = bulker.ImplementationOption[string]{
+		Key:       "schemaSidecar",
+		ParseFunc: parseSchemaSidecar,
+	}
+)
+
+func init() {
+	bulker.RegisterOption(&SchemaSidecarOption)
+}
+
+// WithSchemaSidecar enables upload of schema sidecar file in provided format next to every batch file
+func WithSchemaSidecar(format string) bulker.StreamOption {
+	return bulker.WithOption(&SchemaSidecarOption, format)
+}
+
+func parseSchemaSidecar(serialized any) (string, error) {
+	format, err := utils.ParseString(serialized)
+	if err != nil {
+		return "", err
+	}
+	switch format {
+	case "", SchemaSidecarJSONSchema, SchemaSidecarColumns, SchemaSidecarArrow:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unsupported schemaSidecar format: %s. Supported: %s, %s, %s", format, SchemaSidecarJSONSchema, SchemaSidecarColumns, SchemaSidecarArrow)
+	}
+}
+
+// sidecarField type of field observed in rows of batch file
+type sidecarField struct {
+	dataType types2.DataType
+	// jsonKinds "object" and/or "array" for fields of JSON type
+	jsonKinds utils.Set[string]
+}
+
+// collectSidecarFields updates observed fields of batch file with values of object as it is written to the file
+func (ps *AbstractFileStorageStream) collectSidecarFields(object types2.Object) {
+	for k, v := range object {
+		field, ok := ps.sidecarFields[k]
+		if !ok {
+			field = &sidecarField{dataType: types2.UNKNOWN, jsonKinds: utils.NewSet[string]()}
+			ps.sidecarFields[k] = field
+		}
+		dt, err := types2.TypeFromValue(types2.ReformatValue(v))
+		if err != nil {
+			continue
+		}
+		if dt == types2.JSON {
+			if reflect.TypeOf(v).Kind() == reflect.Map {
+				field.jsonKinds.Put("object")
+			} else {
+				field.jsonKinds.Put("array")
+			}
+		}
+		if field.dataType == types2.UNKNOWN {
+			field.dataType = dt
+		} else if field.dataType != dt {
+			field.dataType = types2.GetCommonAncestorType(field.dataType, dt)
+		}
+	}
+}
+
+// columnType returns name of type used in "columns" manifest
+func (f *sidecarField) columnType() string {
+	switch f.dataType {
+	case types2.BOOL:
+		return "boolean"
+	case types2.INT64:
+		return "integer"
+	case types2.FLOAT64:
+		return "double"
+	case types2.TIMESTAMP:
+		return "timestamp"
+	case types2.JSON:
+		return "json"
+	case types2.UNKNOWN:
+		return "unknown"
+	default:
+		return "string"
+	}
+}
+
+// jsonSchema returns JSON Schema of field. All fields are nullable
+func (f *sidecarField) jsonSchema() map[string]any {
+	schema := map[string]any{}
+	switch f.dataType {
+	case types2.BOOL:
+		schema["type"] = []string{"boolean", "null"}
+	case types2.INT64:
+		schema["type"] = []string{"integer", "null"}
+	case types2.FLOAT64:
+		schema["type"] = []string{"number", "null"}
+	case types2.TIMESTAMP:
+		schema["type"] = []string{"string", "null"}
+		schema["format"] = "date-time"
+	case types2.JSON:
+		kinds := f.jsonKinds.ToSlice()
+		sort.Strings(kinds)
+		schema["type"] = append(kinds, "null")
+	case types2.UNKNOWN:
+		// only nulls were observed
+	default:
+		schema["type"] = []string{"string", "null"}
+	}
+	return schema
+}
+
+// arrowType returns Arrow type of field in JSON representation. Types match ones used for arrow file format:
+// JSON values are strings, timestamps have microsecond precision
+func (f *sidecarField) arrowType() map[string]any {
+	switch f.dataType {
+	case types2.BOOL:
+		return map[string]any{"name": "bool"}
+	case types2.INT64:
+		return map[string]any{"name": "int", "bitWidth": 64, "isSigned": true}
+	case types2.FLOAT64:
+		return map[string]any{"name": "floatingpoint", "precision": "DOUBLE"}
+	case types2.TIMESTAMP:
+		return map[string]any{"name": "timestamp", "unit": "MICROSECOND", "timezone": "UTC"}
+	case types2.UNKNOWN:
+		// only nulls were observed
+		return map[string]any{"name": "null"}
+	default:
+		return map[string]any{"name": "utf8"}
+	}
+}
+
+// schemaSidecar returns content of schema sidecar file of batch file with provided number of rows
+func (ps *AbstractFileStorageStream) schemaSidecar(format string, rows int) ([]byte, error) {
+	names := utils.MapToSlice(ps.sidecarFields, func(name string, _ *sidecarField) string { return name })
+	sort.Strings(names)
+	switch format {
+	case SchemaSidecarJSONSchema:
+		properties := make(map[string]any, len(names))
+		for _, name := range names {
+			properties[name] = ps.sidecarFields[name].jsonSchema()
+		}
+		return json.MarshalIndent(map[string]any{
+			"$schema":    "https://json-schema.org/draft/2020-12/schema",
+			"title":      ps.tableName,
+			"type":       "object",
+			"properties": properties,
+		}, "", "  ")
+	case SchemaSidecarArrow:
+		fields := make([]map[string]any, len(names))
+		for i, name := range names {
+			fields[i] = map[string]any{"name": name, "nullable": true, "type": ps.sidecarFields[name].arrowType(), "children": []any{}}
+		}
+		return json.MarshalIndent(map[string]any{"fields": fields}, "", "  ")
+	default:
+		columns := make([]map[string]string, len(names))
+		for i, name := range names {
+			columns[i] = map[string]string{"name": name, "type": ps.sidecarFields[name].columnType()}
+		}
+		return json.MarshalIndent(map[string]any{
+			"table":   ps.tableName,
+			"format":  ps.targetMarshaller.Format(),
+			"rows":    rows,
+			"columns": columns,
+		}, "", "  ")
+	}
+}
+
+// uploadSchemaSidecar uploads schema sidecar file next to batch file when SchemaSidecarOption is set.
+// Returns path of uploaded file or empty string if option isn't set
+func (ps *AbstractFileStorageStream) uploadSchemaSidecar(fileName string, rows int) (string, error) {
+	format := SchemaSidecarOption.Get(&ps.options)
+	if format == "" {
+		return "", nil
+	}
+	content, err := ps.schemaSidecar(format, rows)
+	if err != nil {
+		return "", err
+	}
+	sidecarFileName := fileName + SchemaSidecarExtension
+	if err = ps.fileAdapter.UploadBytes(sidecarFileName, content); err != nil {
+		return "", err
+	}
+	return ps.fileAdapter.Path(sidecarFileName), nil
+}
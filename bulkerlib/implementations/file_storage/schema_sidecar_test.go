@@ -0,0 +1,48 @@
+package file_storage
+
+import (
+	"encoding/json"
+	types2 "github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestSchemaSidecar(t *testing.T) {
+	targetMarshaller, _ := types2.NewMarshaller(types2.FileFormatNDJSON, types2.FileCompressionNONE)
+	ps := &AbstractFileStorageStream{tableName: "events", sidecarFields: map[string]*sidecarField{}, targetMarshaller: targetMarshaller}
+	objects := []types2.Object{
+		{"id": json.Number("1"), "price": json.Number("1"), "flag": true, "context": map[string]any{"ip": "1.1.1.1"}, "empty": nil},
+		{"id": json.Number("2"), "price": json.Number("1.5"), "tags": []any{"a"}, "timestamp": "2024-05-01T12:30:00Z", "empty": nil},
+	}
+	for _, object := range objects {
+		ps.collectSidecarFields(object)
+	}
+
+	content, err := ps.schemaSidecar(SchemaSidecarColumns, 2)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"table": "events", "format": "ndjson", "rows": 2, "columns": [
+		{"name": "context", "type": "json"}, {"name": "empty", "type": "unknown"}, {"name": "flag", "type": "boolean"},
+		{"name": "id", "type": "integer"}, {"name": "price", "type": "double"}, {"name": "tags", "type": "json"},
+		{"name": "timestamp", "type": "timestamp"}]}`, string(content))
+
+	content, err = ps.schemaSidecar(SchemaSidecarJSONSchema, 2)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"$schema": "https://json-schema.org/draft/2020-12/schema", "title": "events", "type": "object", "properties": {
+		"context": {"type": ["object", "null"]}, "empty": {}, "flag": {"type": ["boolean", "null"]},
+		"id": {"type": ["integer", "null"]}, "price": {"type": ["number", "null"]}, "tags": {"type": ["array", "null"]},
+		"timestamp": {"type": ["string", "null"], "format": "date-time"}}}`, string(content))
+
+	content, err = ps.schemaSidecar(SchemaSidecarArrow, 2)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"fields": [
+		{"name": "context", "nullable": true, "type": {"name": "utf8"}, "children": []},
+		{"name": "empty", "nullable": true, "type": {"name": "null"}, "children": []},
+		{"name": "flag", "nullable": true, "type": {"name": "bool"}, "children": []},
+		{"name": "id", "nullable": true, "type": {"name": "int", "bitWidth": 64, "isSigned": true}, "children": []},
+		{"name": "price", "nullable": true, "type": {"name": "floatingpoint", "precision": "DOUBLE"}, "children": []},
+		{"name": "tags", "nullable": true, "type": {"name": "utf8"}, "children": []},
+		{"name": "timestamp", "nullable": true, "type": {"name": "timestamp", "unit": "MICROSECOND", "timezone": "UTC"}, "children": []}]}`, string(content))
+
+	_, err = parseSchemaSidecar("avro")
+	require.Error(t, err)
+}
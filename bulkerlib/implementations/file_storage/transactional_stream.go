@@ -26,7 +26,7 @@ func NewTransactionalStream(id string, p implementations.FileAdapter, tableName
 		}
 		return fmt.Sprintf("%s_%s%s", tableName, streamStartDate.Format(FilenameDate), batchNumStr)
 	}
-	ps.AbstractFileStorageStream, err = newAbstractFileStorageStream(id, p, filenameFunc, bulker.Batch, streamOptions...)
+	ps.AbstractFileStorageStream, err = newAbstractFileStorageStream(id, p, tableName, filenameFunc, bulker.Batch, streamOptions...)
 	if err != nil {
 		return nil, err
 	}
@@ -29,14 +29,61 @@ type GoogleConfig struct {
 	Dataset    string `mapstructure:"bqDataset,omitempty" json:"bqDataset,omitempty" yaml:"bqDataset,omitempty"`
 	KeyFile    any    `mapstructure:"keyFile,omitempty" json:"keyFile,omitempty" yaml:"keyFile,omitempty"`
 
+	GCSObjectConfig `mapstructure:",squash" json:",inline" yaml:",inline"`
+
 	//will be set on validation
 	Credentials option.ClientOption
 }
 
+// GCSObjectConfig settings of objects uploaded to Google Cloud Storage
+type GCSObjectConfig struct {
+	// ChunkSizeMb size of chunks of resumable uploads. Failed chunk is retried without re-uploading the whole file.
+	// Default: 16. 0 - files are uploaded in a single request
+	ChunkSizeMb *int `mapstructure:"chunkSizeMb,omitempty" json:"chunkSizeMb,omitempty" yaml:"chunkSizeMb,omitempty"`
+	// ChunkRetryDeadlineSec max time of retrying upload of a chunk. Default: 32
+	ChunkRetryDeadlineSec int `mapstructure:"chunkRetryDeadlineSec,omitempty" json:"chunkRetryDeadlineSec,omitempty" yaml:"chunkRetryDeadlineSec,omitempty"`
+	// KMSKeyName customer-managed encryption key: projects/<project>/locations/<location>/keyRings/<ring>/cryptoKeys/<key>
+	KMSKeyName string `mapstructure:"kmsKeyName,omitempty" json:"kmsKeyName,omitempty" yaml:"kmsKeyName,omitempty"`
+	// StorageClass storage class of objects, e.g. "NEARLINE". Default: bucket default storage class
+	StorageClass string `mapstructure:"storageClass,omitempty" json:"storageClass,omitempty" yaml:"storageClass,omitempty"`
+	// Metadata custom metadata of objects
+	Metadata map[string]string `mapstructure:"metadata,omitempty" json:"metadata,omitempty" yaml:"metadata,omitempty"`
+}
+
+// Validate returns err if invalid
+func (oc *GCSObjectConfig) Validate() error {
+	if oc.ChunkSizeMb != nil && *oc.ChunkSizeMb < 0 {
+		return fmt.Errorf("GCS chunkSizeMb must be non-negative: %d", *oc.ChunkSizeMb)
+	}
+	if oc.ChunkRetryDeadlineSec < 0 {
+		return fmt.Errorf("GCS chunkRetryDeadlineSec must be non-negative: %d", oc.ChunkRetryDeadlineSec)
+	}
+	if oc.KMSKeyName != "" && !strings.HasPrefix(oc.KMSKeyName, "projects/") {
+		return fmt.Errorf("GCS kmsKeyName must be full resource name: projects/<project>/locations/<location>/keyRings/<ring>/cryptoKeys/<key>")
+	}
+	return nil
+}
+
+// apply sets object settings to writer
+func (oc *GCSObjectConfig) apply(w *storage.Writer) {
+	if oc.ChunkSizeMb != nil {
+		w.ChunkSize = *oc.ChunkSizeMb * 1024 * 1024
+	}
+	if oc.ChunkRetryDeadlineSec > 0 {
+		w.ChunkRetryDeadline = time.Duration(oc.ChunkRetryDeadlineSec) * time.Second
+	}
+	w.KMSKeyName = oc.KMSKeyName
+	w.StorageClass = oc.StorageClass
+	w.Metadata = oc.Metadata
+}
+
 func (gc *GoogleConfig) Validate() error {
 	if gc == nil {
 		return errors.New("Google config is required")
 	}
+	if err := gc.GCSObjectConfig.Validate(); err != nil {
+		return err
+	}
 
 	if gc.Dataset != "" {
 		if len(gc.Dataset) > 1024 {
@@ -92,7 +139,9 @@ type GoogleCloudStorage struct {
 func NewGoogleCloudStorage(config *GoogleConfig) (*GoogleCloudStorage, error) {
 	var client *storage.Client
 	var err error
-	err = config.Validate()
+	if err = config.Validate(); err != nil {
+		return nil, err
+	}
 	if config.Credentials == nil {
 		client, err = storage.NewClient(context.Background())
 	} else {
@@ -106,7 +155,12 @@ func NewGoogleCloudStorage(config *GoogleConfig) (*GoogleCloudStorage, error) {
 		config.Format = types2.FileFormatNDJSON
 	}
 
-	return &GoogleCloudStorage{AbstractFileAdapter: AbstractFileAdapter{config: &config.FileConfig}, client: client, config: config, closed: atomic.NewBool(false)}, nil
+	abstractAdapter, err := newAbstractFileAdapter(&config.FileConfig)
+	if err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	return &GoogleCloudStorage{AbstractFileAdapter: abstractAdapter, client: client, config: config, closed: atomic.NewBool(false)}, nil
 }
 
 func (gcs *GoogleCloudStorage) UploadBytes(fileName string, fileBytes []byte) error {
@@ -130,9 +184,16 @@ func (gcs *GoogleCloudStorage) Upload(fileName string, fileReader io.ReadSeeker)
 
 	bucket := gcs.client.Bucket(gcs.config.Bucket)
 	object := bucket.Object(fileName)
-	w := object.NewWriter(context.Background())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w := object.NewWriter(ctx)
+	w.ContentType, w.ContentEncoding = types2.FileContentType(gcs.config.Format, gcs.config.Compression)
+	gcs.config.GCSObjectConfig.apply(w)
 
 	if _, err := io.Copy(w, fileReader); err != nil {
+		// cancel aborts upload: object isn't created
+		cancel()
+		_ = w.Close()
 		return errorj.SaveOnStageError.Wrap(err, "failed to write file to google cloud storage").
 			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
 				Bucket:    gcs.config.Bucket,
@@ -147,23 +208,6 @@ func (gcs *GoogleCloudStorage) Upload(fileName string, fileReader io.ReadSeeker)
 				Statement: fmt.Sprintf("file: %s", fileName),
 			})
 	}
-	metadata := storage.ObjectAttrsToUpdate{}
-	if gcs.config.Compression == types2.FileCompressionGZIP {
-		metadata.ContentType = "application/gzip"
-	} else {
-		if gcs.config.Format == types2.FileFormatCSV {
-			metadata.ContentType = "text/csv"
-		} else if gcs.config.Format == types2.FileFormatNDJSON || gcs.config.Format == types2.FileFormatNDJSONFLAT {
-			metadata.ContentType = "application/x-ndjson"
-		}
-	}
-	if _, err := object.Update(context.Background(), metadata); err != nil {
-		return errorj.SaveOnStageError.Wrap(err, "failed to set Content-Type metadata").
-			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
-				Bucket:    gcs.config.Bucket,
-				Statement: fmt.Sprintf("file: %s", fileName),
-			})
-	}
 
 	return nil
 }
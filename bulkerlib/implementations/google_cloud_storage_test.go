@@ -0,0 +1,39 @@
+package implementations
+
+import (
+	"cloud.google.com/go/storage"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestGCSObjectConfig(t *testing.T) {
+	zero, chunk, negative := 0, 8, -1
+	tests := []struct {
+		name    string
+		config  GCSObjectConfig
+		want    *storage.Writer
+		wantErr bool
+	}{
+		{"default", GCSObjectConfig{}, &storage.Writer{ChunkSize: 16 * 1024 * 1024}, false},
+		{"single_request", GCSObjectConfig{ChunkSizeMb: &zero}, &storage.Writer{}, false},
+		{"cmek", GCSObjectConfig{ChunkSizeMb: &chunk, ChunkRetryDeadlineSec: 60, KMSKeyName: "projects/p/locations/l/keyRings/r/cryptoKeys/k", StorageClass: "NEARLINE", Metadata: map[string]string{"team": "data"}},
+			&storage.Writer{ChunkSize: 8 * 1024 * 1024, ChunkRetryDeadline: time.Minute, ObjectAttrs: storage.ObjectAttrs{KMSKeyName: "projects/p/locations/l/keyRings/r/cryptoKeys/k", StorageClass: "NEARLINE", Metadata: map[string]string{"team": "data"}}},
+			false},
+		{"invalid_kms_key", GCSObjectConfig{KMSKeyName: "key"}, nil, true},
+		{"negative_chunk_size", GCSObjectConfig{ChunkSizeMb: &negative}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			w := &storage.Writer{ChunkSize: 16 * 1024 * 1024}
+			tt.config.apply(w)
+			require.Equal(t, tt.want, w)
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package implementations
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	types2 "github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/errorj"
+	"go.uber.org/atomic"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const hdfsOperationTimeout = 10 * time.Minute
+
+// HDFSConfig is a dto for config deserialization
+type HDFSConfig struct {
+	FileConfig `mapstructure:",squash" json:",inline" yaml:",inline"`
+	// NameNodeURL WebHDFS endpoint of namenode, e.g. http://namenode:9870
+	NameNodeURL string `mapstructure:"nameNodeUrl,omitempty" json:"nameNodeUrl,omitempty" yaml:"nameNodeUrl,omitempty"`
+	// User name for simple (pseudo) authentication
+	User string `mapstructure:"user,omitempty" json:"user,omitempty" yaml:"user,omitempty"`
+	// DelegationToken is used instead of User on clusters with Kerberos security enabled
+	DelegationToken string `mapstructure:"delegationToken,omitempty" json:"delegationToken,omitempty" yaml:"delegationToken,omitempty"`
+	// Replication of created files. Cluster default is used when 0
+	Replication int `mapstructure:"replication,omitempty" json:"replication,omitempty" yaml:"replication,omitempty"`
+}
+
+// Validate returns err if invalid
+func (hc *HDFSConfig) Validate() error {
+	if hc == nil {
+		return errors.New("HDFS config is required")
+	}
+	if hc.NameNodeURL == "" {
+		return errors.New("HDFS nameNodeUrl is required parameter")
+	}
+	u, err := url.Parse(hc.NameNodeURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("HDFS nameNodeUrl must be http(s) url of WebHDFS endpoint: %s", hc.NameNodeURL)
+	}
+	if hc.User == "" && hc.DelegationToken == "" {
+		return errors.New("HDFS user or delegationToken is required parameter")
+	}
+	return nil
+}
+
+// HDFS is a file adapter that writes files to Hadoop Distributed File System with WebHDFS REST API
+type HDFS struct {
+	AbstractFileAdapter
+	config *HDFSConfig
+	client *http.Client
+
+	closed *atomic.Bool
+}
+
+// NewHDFS returns configured HDFS adapter
+func NewHDFS(config *HDFSConfig) (*HDFS, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if config.Format == "" {
+		config.Format = types2.FileFormatNDJSON
+	}
+	client := &http.Client{
+		Timeout: hdfsOperationTimeout,
+		// namenode redirects writes to datanode. Redirect of CREATE request is followed manually to send payload only once
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if req.Method == http.MethodPut {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		},
+	}
+	abstractAdapter, err := newAbstractFileAdapter(&config.FileConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &HDFS{AbstractFileAdapter: abstractAdapter, config: config, client: client, closed: atomic.NewBool(false)}, nil
+}
+
+func (h *HDFS) UploadBytes(fileName string, fileBytes []byte) error {
+	return h.Upload(fileName, bytes.NewReader(fileBytes))
+}
+
+// Upload creates file with payload. Existing file is overwritten, parent directories are created when necessary
+func (h *HDFS) Upload(fileName string, fileReader io.ReadSeeker) error {
+	fileName = h.Path(fileName)
+
+	if h.closed.Load() {
+		return fmt.Errorf("attempt to use closed HDFS instance")
+	}
+	params := url.Values{"overwrite": []string{"true"}}
+	if h.config.Replication > 0 {
+		params.Set("replication", fmt.Sprint(h.config.Replication))
+	}
+	err := h.upload(fileName, params, fileReader)
+	if err != nil {
+		return errorj.SaveOnStageError.Wrap(err, "failed to write file to hdfs").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Statement: fmt.Sprintf("file: %s", fileName),
+			})
+	}
+	return nil
+}
+
+func (h *HDFS) upload(fileName string, params url.Values, fileReader io.ReadSeeker) error {
+	ctx, cancel := context.WithTimeout(context.Background(), hdfsOperationTimeout)
+	defer cancel()
+	// first step: namenode responds with location of datanode to write to
+	resp, err := h.do(ctx, http.MethodPut, h.operationURL(fileName, "CREATE", params), nil)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	location := resp.Header.Get("Location")
+	if resp.StatusCode != http.StatusTemporaryRedirect || location == "" {
+		return fmt.Errorf("unexpected response of namenode on file create: %s", resp.Status)
+	}
+	size, err := fileReader.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if _, err = fileReader.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	// second step: write payload to datanode
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, location, fileReader)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err = h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return hdfsError(resp)
+	}
+	return nil
+}
+
+// Download downloads file from hdfs
+func (h *HDFS) Download(fileName string) ([]byte, error) {
+	fileName = h.Path(fileName)
+
+	if h.closed.Load() {
+		return nil, fmt.Errorf("attempt to use closed HDFS instance")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), hdfsOperationTimeout)
+	defer cancel()
+	resp, err := h.do(ctx, http.MethodGet, h.operationURL(fileName, "OPEN", nil), nil)
+	if err == nil {
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			err = hdfsError(resp)
+		} else {
+			var data []byte
+			data, err = io.ReadAll(resp.Body)
+			if err == nil {
+				return data, nil
+			}
+		}
+	}
+	return nil, errorj.SaveOnStageError.Wrap(err, "failed to read file from hdfs").
+		WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+			Statement: fmt.Sprintf("file: %s", fileName),
+		})
+}
+
+// DeleteObject deletes file from hdfs. Missing file is not an error
+func (h *HDFS) DeleteObject(key string) error {
+	key = h.Path(key)
+
+	if h.closed.Load() {
+		return fmt.Errorf("attempt to use closed HDFS instance")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), hdfsOperationTimeout)
+	defer cancel()
+	resp, err := h.do(ctx, http.MethodDelete, h.operationURL(key, "DELETE", nil), nil)
+	if err == nil {
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			err = hdfsError(resp)
+		}
+	}
+	if err != nil {
+		return errorj.SaveOnStageError.Wrap(err, "failed to delete from hdfs").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Statement: fmt.Sprintf("file: %s", key),
+			})
+	}
+	return nil
+}
+
+// Close returns nil
+func (h *HDFS) Close() error {
+	h.closed.Store(true)
+	h.client.CloseIdleConnections()
+	return nil
+}
+
+func (h *HDFS) do(ctx context.Context, method, url string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	return h.client.Do(req)
+}
+
+// operationURL returns WebHDFS url of operation on absolute path of the file
+func (h *HDFS) operationURL(fileName, operation string, params url.Values) string {
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("op", operation)
+	if h.config.DelegationToken != "" {
+		params.Set("delegation", h.config.DelegationToken)
+	} else {
+		params.Set("user.name", h.config.User)
+	}
+	path := (&url.URL{Path: "/" + strings.TrimPrefix(fileName, "/")}).EscapedPath()
+	return strings.TrimSuffix(h.config.NameNodeURL, "/") + "/webhdfs/v1" + path + "?" + params.Encode()
+}
+
+// hdfsError returns error from WebHDFS RemoteException response
+func hdfsError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	remoteException := struct {
+		RemoteException struct {
+			Exception string `json:"exception"`
+			Message   string `json:"message"`
+		} `json:"RemoteException"`
+	}{}
+	if err := json.Unmarshal(body, &remoteException); err == nil && remoteException.RemoteException.Exception != "" {
+		return fmt.Errorf("%s: %s: %s", resp.Status, remoteException.RemoteException.Exception, remoteException.RemoteException.Message)
+	}
+	return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+}
@@ -0,0 +1,115 @@
+package implementations
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// hdfsTestServer emulates WebHDFS namenode that redirects writes to datanode served by the same server
+type hdfsTestServer struct {
+	sync.Mutex
+	t      *testing.T
+	url    string
+	files  map[string][]byte
+	params map[string]string
+}
+
+func (s *hdfsTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	if strings.HasPrefix(r.URL.Path, "/datanode/") {
+		require.Equal(s.t, http.MethodPut, r.Method)
+		body, _ := io.ReadAll(r.Body)
+		require.Equal(s.t, r.ContentLength, int64(len(body)))
+		s.files[strings.TrimPrefix(r.URL.Path, "/datanode")] = body
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/webhdfs/v1")
+	query := r.URL.Query()
+	require.Equal(s.t, "hdfs", query.Get("user.name"))
+	switch query.Get("op") {
+	case "CREATE":
+		// namenode never reads payload
+		require.Equal(s.t, int64(0), r.ContentLength)
+		s.params = map[string]string{"overwrite": query.Get("overwrite"), "replication": query.Get("replication")}
+		w.Header().Set("Location", s.url+"/datanode"+path)
+		w.WriteHeader(http.StatusTemporaryRedirect)
+	case "OPEN":
+		content, ok := s.files[path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = fmt.Fprintf(w, `{"RemoteException": {"exception": "FileNotFoundException", "message": "File %s not found."}}`, path)
+			return
+		}
+		_, _ = w.Write(content)
+	case "DELETE":
+		_, ok := s.files[path]
+		delete(s.files, path)
+		_, _ = fmt.Fprintf(w, `{"boolean": %t}`, ok)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestHDFS(t *testing.T) {
+	reqr := require.New(t)
+	server := &hdfsTestServer{t: t, files: map[string][]byte{}}
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+	server.url = httpServer.URL
+
+	adapter, err := NewHDFS(&HDFSConfig{NameNodeURL: httpServer.URL + "/", User: "hdfs", Replication: 2, FileConfig: FileConfig{Folder: "/data/bulker"}})
+	reqr.NoError(err)
+
+	reqr.NoError(adapter.UploadBytes("batch 1.ndjson", []byte("{\"id\": 1}\n")))
+	reqr.Equal(map[string][]byte{"/data/bulker/batch 1.ndjson": []byte("{\"id\": 1}\n")}, server.files)
+	reqr.Equal(map[string]string{"overwrite": "true", "replication": "2"}, server.params)
+	content, err := adapter.Download("batch 1.ndjson")
+	reqr.NoError(err)
+	reqr.Equal("{\"id\": 1}\n", string(content))
+
+	reqr.NoError(adapter.DeleteObject("batch 1.ndjson"))
+	reqr.Empty(server.files)
+	//deleting missing file isn't an error
+	reqr.NoError(adapter.DeleteObject("batch 1.ndjson"))
+	_, err = adapter.Download("batch 1.ndjson")
+	reqr.ErrorContains(err, "404 Not Found: FileNotFoundException: File /data/bulker/batch 1.ndjson not found.")
+
+	reqr.NoError(adapter.Close())
+	reqr.ErrorContains(adapter.UploadBytes("batch 1.ndjson", []byte("{}")), "closed HDFS instance")
+}
+
+func TestHDFSConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *HDFSConfig
+		wantErr string
+	}{
+		{"valid", &HDFSConfig{NameNodeURL: "http://namenode:9870", User: "hdfs"}, ""},
+		{"delegation_token", &HDFSConfig{NameNodeURL: "https://namenode:9871", DelegationToken: "token"}, ""},
+		{"no_url", &HDFSConfig{User: "hdfs"}, "HDFS nameNodeUrl is required parameter"},
+		{"hdfs_scheme", &HDFSConfig{NameNodeURL: "hdfs://namenode:8020", User: "hdfs"}, "HDFS nameNodeUrl must be http(s) url of WebHDFS endpoint: hdfs://namenode:8020"},
+		{"no_user", &HDFSConfig{NameNodeURL: "http://namenode:9870"}, "HDFS user or delegationToken is required parameter"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tt.wantErr)
+			}
+		})
+	}
+
+	adapter, err := NewHDFS(&HDFSConfig{NameNodeURL: "http://namenode:9870", DelegationToken: "token"})
+	require.NoError(t, err)
+	require.Equal(t, "http://namenode:9870/webhdfs/v1/events/a%20b.ndjson?delegation=token&op=OPEN", adapter.operationURL("events/a b.ndjson", "OPEN", nil))
+}
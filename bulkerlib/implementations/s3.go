@@ -5,17 +5,32 @@ import (
 	"errors"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	types2 "github.com/jitsucom/bulker/bulkerlib/types"
 	"github.com/jitsucom/bulker/jitsubase/errorj"
 	"github.com/jitsucom/bulker/jitsubase/logging"
+	"github.com/jitsucom/bulker/jitsubase/utils"
 	"go.uber.org/atomic"
 	"io"
+	"net/http"
+	"net/url"
+	"strings"
 	"time"
 )
 
+// s3CompatibleDefaultRegion region used for S3 compatible storages when it is not configured
+const s3CompatibleDefaultRegion = "us-east-1"
+
+// S3 compatibility profiles. See S3CompatibilityConfig
+const (
+	S3ProfileAWS   = "aws"
+	S3ProfileR2    = "r2"
+	S3ProfileMinIO = "minio"
+)
+
+// r2Region region accepted by Cloudflare R2 for request signing
+const r2Region = "auto"
+
 // S3Config is a dto for config deserialization
 type S3Config struct {
 	FileConfig `mapstructure:",squash" json:",inline" yaml:",inline"`
@@ -23,7 +38,116 @@ type S3Config struct {
 	SecretKey  string `mapstructure:"secretAccessKey,omitempty" json:"secretAccessKey,omitempty" yaml:"secretAccessKey,omitempty"`
 	Bucket     string `mapstructure:"bucket,omitempty" json:"bucket,omitempty" yaml:"bucket,omitempty"`
 	Region     string `mapstructure:"region,omitempty" json:"region,omitempty" yaml:"region,omitempty"`
-	Endpoint   string `mapstructure:"endpoint,omitempty" json:"endpoint,omitempty" yaml:"endpoint,omitempty"`
+	// Endpoint of S3 compatible storage, e.g. MinIO, Cloudflare R2 or Backblaze B2. Region is optional when set
+	Endpoint string `mapstructure:"endpoint,omitempty" json:"endpoint,omitempty" yaml:"endpoint,omitempty"`
+	// ForcePathStyle use path-style addressing (https://endpoint/bucket/key) instead of virtual-hosted-style.
+	// Default: true when Endpoint is set
+	ForcePathStyle *bool `mapstructure:"forcePathStyle,omitempty" json:"forcePathStyle,omitempty" yaml:"forcePathStyle,omitempty"`
+	// CACert CA bundle to verify endpoint certificate, e.g. self-signed MinIO. PEM content or path to PEM file
+	CACert string `mapstructure:"caCert,omitempty" json:"caCert,omitempty" yaml:"caCert,omitempty"`
+	// RoleARN IAM role to assume for S3 access. When access key is not provided, default AWS credentials chain is used
+	RoleARN    string `mapstructure:"roleArn,omitempty" json:"roleArn,omitempty" yaml:"roleArn,omitempty"`
+	ExternalID string `mapstructure:"externalId,omitempty" json:"externalId,omitempty" yaml:"externalId,omitempty"`
+
+	S3ObjectConfig        `mapstructure:",squash" json:",inline" yaml:",inline"`
+	S3CompatibilityConfig `mapstructure:",squash" json:",inline" yaml:",inline"`
+}
+
+// S3CompatibilityConfig presets and checksum toggles for S3 compatible storages
+type S3CompatibilityConfig struct {
+	// Profile of storage: "aws" (default), "r2" or "minio". Sets defaults of endpoint, region and addressing style
+	// and rejects object settings that storage doesn't support
+	Profile string `mapstructure:"profile,omitempty" json:"profile,omitempty" yaml:"profile,omitempty"`
+	// AccountID Cloudflare account id. Endpoint of "r2" profile is derived from it when Endpoint isn't set
+	AccountID string `mapstructure:"accountId,omitempty" json:"accountId,omitempty" yaml:"accountId,omitempty"`
+	// DisableComputeChecksums don't send Content-MD5 checksums with requests that require them by default
+	DisableComputeChecksums bool `mapstructure:"disableComputeChecksums,omitempty" json:"disableComputeChecksums,omitempty" yaml:"disableComputeChecksums,omitempty"`
+	// DisableContentMD5Validation don't validate checksums of downloaded objects, e.g. for storages that return non-MD5 ETags
+	DisableContentMD5Validation bool `mapstructure:"disableContentMD5Validation,omitempty" json:"disableContentMD5Validation,omitempty" yaml:"disableContentMD5Validation,omitempty"`
+}
+
+// validate returns err if profile is unknown or settings are not supported by storage of profile
+func (cc *S3CompatibilityConfig) validate(endpoint string, objectConfig *S3ObjectConfig) error {
+	switch cc.Profile {
+	case "", S3ProfileAWS:
+	case S3ProfileR2:
+		if endpoint == "" && cc.AccountID == "" {
+			return fmt.Errorf("S3 endpoint or accountId is required for %s profile", S3ProfileR2)
+		}
+		if len(objectConfig.Tags) > 0 || objectConfig.ACL != "" || objectConfig.KMSKeyID != "" || objectConfig.ServerSideEncryption == s3.ServerSideEncryptionAwsKms {
+			return fmt.Errorf("S3 tags, acl and SSE-KMS encryption are not supported by %s profile", S3ProfileR2)
+		}
+	case S3ProfileMinIO:
+		if endpoint == "" {
+			return fmt.Errorf("S3 endpoint is required for %s profile", S3ProfileMinIO)
+		}
+	default:
+		return fmt.Errorf("unsupported S3 profile: %s. Supported: %s, %s, %s", cc.Profile, S3ProfileAWS, S3ProfileR2, S3ProfileMinIO)
+	}
+	return nil
+}
+
+// endpoint returns configured endpoint or default endpoint of profile
+func (cc *S3CompatibilityConfig) endpoint(endpoint string) string {
+	if endpoint == "" && cc.Profile == S3ProfileR2 && cc.AccountID != "" {
+		return fmt.Sprintf("https://%s.r2.cloudflarestorage.com", cc.AccountID)
+	}
+	return endpoint
+}
+
+// S3ObjectConfig settings of uploaded objects often required by bucket policies
+type S3ObjectConfig struct {
+	// Tags object tags
+	Tags map[string]string `mapstructure:"tags,omitempty" json:"tags,omitempty" yaml:"tags,omitempty"`
+	// ServerSideEncryption "AES256" or "aws:kms". Default: "aws:kms" when KMSKeyID is set, otherwise bucket default encryption
+	ServerSideEncryption string `mapstructure:"serverSideEncryption,omitempty" json:"serverSideEncryption,omitempty" yaml:"serverSideEncryption,omitempty"`
+	// KMSKeyID ID or ARN of KMS key for SSE-KMS encryption. Default: AWS managed key
+	KMSKeyID string `mapstructure:"kmsKeyId,omitempty" json:"kmsKeyId,omitempty" yaml:"kmsKeyId,omitempty"`
+	// ACL canned ACL of objects, e.g. "bucket-owner-full-control"
+	ACL string `mapstructure:"acl,omitempty" json:"acl,omitempty" yaml:"acl,omitempty"`
+	// StorageClass storage class of objects, e.g. "INTELLIGENT_TIERING". Default: STANDARD
+	StorageClass string `mapstructure:"storageClass,omitempty" json:"storageClass,omitempty" yaml:"storageClass,omitempty"`
+}
+
+// Validate returns err if invalid
+func (oc *S3ObjectConfig) Validate() error {
+	if oc.ServerSideEncryption != "" && !utils.ArrayContains(s3.ServerSideEncryption_Values(), oc.ServerSideEncryption) {
+		return fmt.Errorf("unsupported S3 serverSideEncryption: %s. Supported: %s", oc.ServerSideEncryption, strings.Join(s3.ServerSideEncryption_Values(), ", "))
+	}
+	if oc.KMSKeyID != "" && oc.ServerSideEncryption != "" && oc.ServerSideEncryption != s3.ServerSideEncryptionAwsKms {
+		return fmt.Errorf("S3 kmsKeyId requires %s serverSideEncryption", s3.ServerSideEncryptionAwsKms)
+	}
+	if oc.ACL != "" && !utils.ArrayContains(s3.ObjectCannedACL_Values(), oc.ACL) {
+		return fmt.Errorf("unsupported S3 acl: %s. Supported: %s", oc.ACL, strings.Join(s3.ObjectCannedACL_Values(), ", "))
+	}
+	if oc.StorageClass != "" && !utils.ArrayContains(s3.StorageClass_Values(), oc.StorageClass) {
+		return fmt.Errorf("unsupported S3 storageClass: %s. Supported: %s", oc.StorageClass, strings.Join(s3.StorageClass_Values(), ", "))
+	}
+	return nil
+}
+
+// apply sets object settings to upload request
+func (oc *S3ObjectConfig) apply(params *s3.PutObjectInput) {
+	if len(oc.Tags) > 0 {
+		tags := url.Values{}
+		for k, v := range oc.Tags {
+			tags.Set(k, v)
+		}
+		params.Tagging = aws.String(tags.Encode())
+	}
+	if oc.KMSKeyID != "" {
+		params.ServerSideEncryption = aws.String(s3.ServerSideEncryptionAwsKms)
+		params.SSEKMSKeyId = aws.String(oc.KMSKeyID)
+	}
+	if oc.ServerSideEncryption != "" {
+		params.ServerSideEncryption = aws.String(oc.ServerSideEncryption)
+	}
+	if oc.ACL != "" {
+		params.ACL = aws.String(oc.ACL)
+	}
+	if oc.StorageClass != "" {
+		params.StorageClass = aws.String(oc.StorageClass)
+	}
 }
 
 // Validate returns err if invalid
@@ -31,19 +155,22 @@ func (s3c *S3Config) Validate() error {
 	if s3c == nil {
 		return errors.New("S3 config is required")
 	}
-	if s3c.AccessKey == "" {
-		return errors.New("S3 accessKey is required parameter")
-	}
-	if s3c.SecretKey == "" {
-		return errors.New("S3 secretKey is required parameter")
+	if s3c.AccessKey != "" && s3c.SecretKey == "" {
+		return errors.New("S3 secretKey is required parameter when accessKey is provided")
 	}
 	if s3c.Bucket == "" {
 		return errors.New("S3 bucket is required parameter")
 	}
-	if s3c.Region == "" {
+	if s3c.Region == "" && s3c.S3CompatibilityConfig.endpoint(s3c.Endpoint) == "" {
 		return errors.New("S3 region is required parameter")
 	}
-	return nil
+	if _, err := types2.ParseFileCompression(s3c.Compression); err != nil {
+		return err
+	}
+	if err := s3c.S3CompatibilityConfig.validate(s3c.Endpoint, &s3c.S3ObjectConfig); err != nil {
+		return err
+	}
+	return s3c.S3ObjectConfig.Validate()
 }
 
 // S3 is a S3 adapter for uploading/deleting files
@@ -61,22 +188,51 @@ func NewS3(s3Config *S3Config) (*S3, error) {
 		return nil, err
 	}
 
-	awsConfig := aws.NewConfig().
-		WithCredentials(credentials.NewStaticCredentials(s3Config.AccessKey, s3Config.SecretKey, "")).
-		WithRegion(s3Config.Region)
+	awsConfig := aws.NewConfig()
+	s3Config.Endpoint = s3Config.S3CompatibilityConfig.endpoint(s3Config.Endpoint)
 	if s3Config.Endpoint != "" {
 		awsConfig.WithEndpoint(s3Config.Endpoint)
+		if s3Config.Region == "" {
+			// S3 compatible storages either ignore region or accept default one for request signing
+			s3Config.Region = s3CompatibleDefaultRegion
+			if s3Config.Profile == S3ProfileR2 {
+				s3Config.Region = r2Region
+			}
+		}
+	}
+	if s3Config.DisableComputeChecksums {
+		awsConfig.WithDisableComputeChecksums(true)
+	}
+	if s3Config.DisableContentMD5Validation {
+		awsConfig.WithS3DisableContentMD5Validation(true)
+	}
+	if s3Config.ForcePathStyle != nil {
+		awsConfig.WithS3ForcePathStyle(*s3Config.ForcePathStyle)
+	} else if s3Config.Endpoint != "" {
 		awsConfig.WithS3ForcePathStyle(true)
 	}
+	if s3Config.CACert != "" {
+		tlsConfig, err := (&utils.TLSConfig{CA: s3Config.CACert}).Build()
+		if err != nil {
+			return nil, fmt.Errorf("invalid S3 caCert: %v", err)
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		awsConfig.WithHTTPClient(&http.Client{Transport: transport})
+	}
 	if s3Config.Format == "" {
 		s3Config.Format = types2.FileFormatNDJSON
 	}
-	s3Session, err := session.NewSession()
+	s3Session, err := NewAwsSession(s3Config.Region, s3Config.AccessKey, s3Config.SecretKey, s3Config.RoleARN, s3Config.ExternalID)
 	if err != nil {
 		return nil, errorj.SaveOnStageError.Wrap(err, "failed to create s3 session")
 	}
 
-	return &S3{AbstractFileAdapter: AbstractFileAdapter{config: &s3Config.FileConfig}, client: s3.New(s3Session, awsConfig), config: s3Config, closed: atomic.NewBool(false)}, nil
+	abstractAdapter, err := newAbstractFileAdapter(&s3Config.FileConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &S3{AbstractFileAdapter: abstractAdapter, client: s3.New(s3Session, awsConfig), config: s3Config, closed: atomic.NewBool(false)}, nil
 }
 
 func (a *S3) UploadBytes(fileName string, fileBytes []byte) error {
@@ -94,18 +250,16 @@ func (a *S3) Upload(fileName string, fileReader io.ReadSeeker) error {
 	params := &s3.PutObjectInput{
 		Bucket: aws.String(a.config.Bucket),
 	}
-	if a.config.Compression == types2.FileCompressionGZIP {
-		params.ContentType = aws.String("application/gzip")
-	} else {
-		switch a.config.Format {
-		case types2.FileFormatCSV:
-			params.ContentType = aws.String("text/csv")
-		case types2.FileFormatNDJSON, types2.FileFormatNDJSONFLAT:
-			params.ContentType = aws.String("application/x-ndjson")
-		}
+	contentType, contentEncoding := types2.FileContentType(a.config.Format, a.config.Compression)
+	if contentType != "" {
+		params.ContentType = aws.String(contentType)
+	}
+	if contentEncoding != "" {
+		params.ContentEncoding = aws.String(contentEncoding)
 	}
 	params.Key = aws.String(fileName)
 	params.Body = fileReader
+	a.config.S3ObjectConfig.apply(params)
 	if _, err := a.client.PutObject(params); err != nil {
 		return errorj.SaveOnStageError.Wrap(err, "failed to write file to s3").
 			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
@@ -177,6 +331,32 @@ func (a *S3) DeleteObject(key string) error {
 	return nil
 }
 
+// ListObjects returns keys of objects with provided prefix and time of their last modification.
+// Returned keys are relative to configured folder and may be passed to DeleteObject
+func (a *S3) ListObjects(prefix string) (map[string]time.Time, error) {
+	if a.closed.Load() {
+		return nil, fmt.Errorf("attempt to use closed S3 instance")
+	}
+	folder := a.Path("")
+	fullPrefix := a.Path(prefix)
+	objects := map[string]time.Time{}
+	input := &s3.ListObjectsV2Input{Bucket: &a.config.Bucket, Prefix: &fullPrefix}
+	err := a.client.ListObjectsV2Pages(input, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			objects[strings.TrimPrefix(aws.StringValue(object.Key), folder)] = aws.TimeValue(object.LastModified)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, errorj.SaveOnStageError.Wrap(err, "failed to list objects in s3").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Bucket:    a.config.Bucket,
+				Statement: fmt.Sprintf("prefix: %s", fullPrefix),
+			})
+	}
+	return objects, nil
+}
+
 // ValidateWritePermission tries to create temporary file and remove it.
 // returns nil if file creation was successful.
 func (a *S3) ValidateWritePermission() error {
@@ -0,0 +1,124 @@
+package implementations
+
+import (
+	"encoding/pem"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestS3ObjectConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  S3ObjectConfig
+		want    *s3.PutObjectInput
+		wantErr bool
+	}{
+		{"empty", S3ObjectConfig{}, &s3.PutObjectInput{}, false},
+		{"kms_key",
+			S3ObjectConfig{KMSKeyID: "arn:aws:kms:us-east-1:123:key/abc", StorageClass: "INTELLIGENT_TIERING"},
+			&s3.PutObjectInput{ServerSideEncryption: aws.String("aws:kms"), SSEKMSKeyId: aws.String("arn:aws:kms:us-east-1:123:key/abc"), StorageClass: aws.String("INTELLIGENT_TIERING")},
+			false},
+		{"tags_and_acl",
+			S3ObjectConfig{Tags: map[string]string{"team": "data eng", "env": "prod"}, ACL: "bucket-owner-full-control", ServerSideEncryption: "AES256"},
+			&s3.PutObjectInput{Tagging: aws.String("env=prod&team=data+eng"), ACL: aws.String("bucket-owner-full-control"), ServerSideEncryption: aws.String("AES256")},
+			false},
+		{"kms_key_with_aes", S3ObjectConfig{KMSKeyID: "key", ServerSideEncryption: "AES256"}, nil, true},
+		{"unknown_storage_class", S3ObjectConfig{StorageClass: "COLD"}, nil, true},
+		{"unknown_acl", S3ObjectConfig{ACL: "everyone"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			params := &s3.PutObjectInput{}
+			tt.config.apply(params)
+			require.Equal(t, tt.want, params)
+		})
+	}
+}
+
+func TestS3CompatibilityProfiles(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       S3Config
+		wantEndpoint string
+		wantRegion   string
+		wantErr      bool
+	}{
+		{"aws", S3Config{Bucket: "b", Region: "eu-west-1"}, "", "eu-west-1", false},
+		{"aws_without_region", S3Config{Bucket: "b"}, "", "", true},
+		{"r2_account_id",
+			S3Config{Bucket: "b", AccessKey: "k", SecretKey: "s", S3CompatibilityConfig: S3CompatibilityConfig{Profile: S3ProfileR2, AccountID: "abc"}},
+			"https://abc.r2.cloudflarestorage.com", "auto", false},
+		{"r2_endpoint",
+			S3Config{Bucket: "b", AccessKey: "k", SecretKey: "s", Endpoint: "https://abc.eu.r2.cloudflarestorage.com", S3CompatibilityConfig: S3CompatibilityConfig{Profile: S3ProfileR2}},
+			"https://abc.eu.r2.cloudflarestorage.com", "auto", false},
+		{"r2_without_account", S3Config{Bucket: "b", S3CompatibilityConfig: S3CompatibilityConfig{Profile: S3ProfileR2}}, "", "", true},
+		{"r2_acl",
+			S3Config{Bucket: "b", S3CompatibilityConfig: S3CompatibilityConfig{Profile: S3ProfileR2, AccountID: "abc"}, S3ObjectConfig: S3ObjectConfig{ACL: "private"}},
+			"", "", true},
+		{"minio",
+			S3Config{Bucket: "b", AccessKey: "k", SecretKey: "s", Endpoint: "http://minio:9000", S3CompatibilityConfig: S3CompatibilityConfig{Profile: S3ProfileMinIO, DisableComputeChecksums: true}},
+			"http://minio:9000", "us-east-1", false},
+		{"minio_without_endpoint", S3Config{Bucket: "b", Region: "us-east-1", S3CompatibilityConfig: S3CompatibilityConfig{Profile: S3ProfileMinIO}}, "", "", true},
+		{"unknown_profile", S3Config{Bucket: "b", Region: "us-east-1", S3CompatibilityConfig: S3CompatibilityConfig{Profile: "gcs"}}, "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			adapter, err := NewS3(&config)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantEndpoint, config.Endpoint)
+			require.Equal(t, tt.wantRegion, config.Region)
+			require.Equal(t, tt.wantEndpoint != "", aws.BoolValue(adapter.client.Config.S3ForcePathStyle))
+			require.Equal(t, config.DisableComputeChecksums, aws.BoolValue(adapter.client.Config.DisableComputeChecksums))
+		})
+	}
+}
+
+func TestS3CustomEndpoint(t *testing.T) {
+	reqr := require.New(t)
+	var paths []string
+	var body []byte
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		body, _ = io.ReadAll(r.Body)
+	}))
+	t.Cleanup(server.Close)
+	caCert := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+
+	//self-signed certificate of endpoint is trusted with caCert. Region is optional, path-style addressing is used by default
+	adapter, err := NewS3(&S3Config{Bucket: "bucket", AccessKey: "k", SecretKey: "s", Endpoint: server.URL, CACert: caCert, FileConfig: FileConfig{Folder: "bulker"}})
+	reqr.NoError(err)
+	reqr.Equal(s3CompatibleDefaultRegion, aws.StringValue(adapter.client.Config.Region))
+	reqr.NoError(adapter.UploadBytes("batch.ndjson", []byte("{\"id\": 1}\n")))
+	reqr.Equal([]string{"/bucket/bulker/batch.ndjson"}, paths)
+	reqr.Equal("{\"id\": 1}\n", string(body))
+
+	//without caCert certificate isn't trusted
+	adapter, err = NewS3(&S3Config{Bucket: "bucket", AccessKey: "k", SecretKey: "s", Endpoint: server.URL})
+	reqr.NoError(err)
+	reqr.ErrorContains(adapter.UploadBytes("batch.ndjson", []byte("{}")), "certificate")
+	reqr.Len(paths, 1)
+
+	adapter, err = NewS3(&S3Config{Bucket: "bucket", Region: "eu-central-1", Endpoint: server.URL, ForcePathStyle: aws.Bool(false)})
+	reqr.NoError(err)
+	reqr.False(aws.BoolValue(adapter.client.Config.S3ForcePathStyle))
+	reqr.Equal("eu-central-1", aws.StringValue(adapter.client.Config.Region))
+
+	_, err = NewS3(&S3Config{Bucket: "bucket", Endpoint: server.URL, CACert: "-----BEGIN CERTIFICATE-----\nnot a certificate\n-----END CERTIFICATE-----"})
+	reqr.ErrorContains(err, "invalid S3 caCert")
+}
@@ -7,7 +7,7 @@ import (
 	"github.com/jitsucom/bulker/bulkerlib/types"
 	"github.com/jitsucom/bulker/jitsubase/logging"
 	"github.com/jitsucom/bulker/jitsubase/utils"
-	jsoniter "github.com/json-iterator/go"
+	"strings"
 	"time"
 )
 
@@ -17,15 +17,29 @@ import (
 const unmappedDataColumn = "_unmapped_data"
 
 type AbstractSQLStream struct {
-	id                string
-	sqlAdapter        SQLAdapter
-	mode              bulker.BulkMode
-	options           bulker.StreamOptions
-	tableName         string
-	merge             bool
-	mergeWindow       int
+	id          string
+	sqlAdapter  SQLAdapter
+	mode        bulker.BulkMode
+	options     bulker.StreamOptions
+	tableName   string
+	merge       bool
+	mergeWindow int
+	// tombstones handling of delete events. See TombstonesOption
+	tombstones        *TombstonesConfig
 	omitNils          bool
 	schemaFromOptions *Table
+	// omitFields paths of event fields dropped before processing. See OmitFieldsOption
+	omitFields [][]string
+	// computedColumns columns evaluated per event. See ComputedColumnsOption
+	computedColumns []computedColumn
+	// hasher hashes values of fields of HashedColumnsOption. nil if option is not set
+	hasher *columnsHasher
+	// maskers mask events with MaskingOption rules and custom MaskerOption
+	maskers []Masker
+	// stringNormalization policies for problematic characters in string values. See StringNormalizationOption
+	stringNormalization *StringNormalizationConfig
+	// typeCoercionErrors policies for values that cannot be coerced to existing column types. See TypeCoercionErrorsOption
+	typeCoercionErrors *TypeCoercionErrorsConfig
 
 	state  bulker.State
 	inited bool
@@ -33,6 +47,22 @@ type AbstractSQLStream struct {
 	customTypes     types.SQLTypes
 	pkColumns       []string
 	timestampColumn string
+	// versionColumn adapted name of version column. See bulker.VersionColumnOption
+	versionColumn string
+	// dedupColumn adapted name of column which greatest value wins when rows of a batch are deduplicated. See DeduplicateLatestOption
+	dedupColumn string
+	// indexes and notNullColumns constraints of destination table with adapted column names. See IndexesOption and NotNullOption
+	indexes        []Index
+	notNullColumns Columns
+	// partitionColumns and clusteringColumns of destination table with adapted column names. See PartitionKeyOption and ClusteringKeyOption
+	partitionColumns  []string
+	clusteringColumns []string
+	// tableComment and columnComments with adapted column names. See DescriptionsOption
+	tableComment   string
+	columnComments map[string]string
+	// schemaFreeze policy for fields that are not columns of frozenTable. See SchemaFreezeOption
+	schemaFreeze string
+	frozenTable  *Table
 
 	startTime time.Time
 }
@@ -55,7 +85,85 @@ func newAbstractStream(id string, p SQLAdapter, tableName string, mode bulker.Bu
 	var customFields = ColumnTypesOption.Get(&ps.options)
 	ps.pkColumns = pkColumns.ToSlice()
 	ps.timestampColumn = bulker.TimestampOption.Get(&ps.options)
+	if versionColumn := bulker.VersionColumnOption.Get(&ps.options); versionColumn != "" {
+		if err := validateVersionColumnOption(p, ps.merge); err != nil {
+			return nil, err
+		}
+		ps.versionColumn = p.ColumnName(versionColumn)
+		ps.dedupColumn = ps.versionColumn
+	}
+	if DeduplicateLatestOption.Get(&ps.options) {
+		if err := validateDeduplicateLatestOption(ps.merge, ps.timestampColumn, ps.versionColumn); err != nil {
+			return nil, err
+		}
+		if ps.dedupColumn == "" {
+			ps.dedupColumn = p.ColumnName(ps.timestampColumn)
+		}
+	}
 	ps.omitNils = OmitNilsOption.Get(&ps.options)
+	ps.stringNormalization = StringNormalizationOption.Get(&ps.options)
+	ps.typeCoercionErrors = TypeCoercionErrorsOption.Get(&ps.options).forAdapter(p)
+	for _, path := range OmitFieldsOption.Get(&ps.options) {
+		if path != "" {
+			ps.omitFields = append(ps.omitFields, strings.Split(path, "."))
+		}
+	}
+	computedColumns, err := compileComputedColumns(ComputedColumnsOption.Get(&ps.options))
+	if err != nil {
+		return nil, err
+	}
+	ps.computedColumns = computedColumns
+	ps.hasher, err = newColumnsHasher(HashedColumnsOption.Get(&ps.options))
+	if err != nil {
+		return nil, err
+	}
+	rulesMasker, err := newRulesMasker(MaskingOption.Get(&ps.options))
+	if err != nil {
+		return nil, err
+	}
+	if rulesMasker != nil {
+		ps.maskers = append(ps.maskers, rulesMasker)
+	}
+	if masker := MaskerOption.Get(&ps.options); masker != nil {
+		ps.maskers = append(ps.maskers, masker)
+	}
+
+	ps.tombstones = TombstonesOption.Get(&ps.options)
+	if err := validateTombstonesOption(p, mode, ps.merge, ps.tombstones); err != nil {
+		return nil, err
+	}
+
+	if err := validateConstraintsOptions(p, &ps.options); err != nil {
+		return nil, err
+	}
+	for _, index := range IndexesOption.Get(&ps.options) {
+		index.Columns = utils.ArrayMap(index.Columns, p.ColumnName)
+		ps.indexes = append(ps.indexes, index)
+	}
+	for _, column := range NotNullOption.Get(&ps.options) {
+		if ps.notNullColumns == nil {
+			ps.notNullColumns = Columns{}
+		}
+		ps.notNullColumns[p.ColumnName(column)] = types.SQLColumn{}
+	}
+	if err := validatePartitioningOptions(p, &ps.options); err != nil {
+		return nil, err
+	}
+	ps.partitionColumns = partitioningColumns(p, PartitionKeyOption.Get(&ps.options))
+	ps.clusteringColumns = partitioningColumns(p, ClusteringKeyOption.Get(&ps.options))
+	if err := validateDescriptionsOption(p, &ps.options); err != nil {
+		return nil, err
+	}
+	descriptions := DescriptionsOption.Get(&ps.options)
+	ps.tableComment = descriptions.Table
+	ps.columnComments = columnDescriptions(p, descriptions)
+
+	ps.schemaFreeze = SchemaFreezeOption.Get(&ps.options)
+	if ps.schemaFreeze != "" {
+		if err := validateSchemaFreezeOption(mode, &ps.options); err != nil {
+			return nil, err
+		}
+	}
 
 	schema := bulker.SchemaOption.Get(&ps.options)
 	if !schema.IsEmpty() {
@@ -73,17 +181,49 @@ func (ps *AbstractSQLStream) preprocess(object types.Object) (*Table, types.Obje
 	if ps.state.Status != bulker.Active {
 		return nil, nil, fmt.Errorf("stream is not active. Status: %s", ps.state.Status)
 	}
+	for _, path := range ps.omitFields {
+		object = omitField(object, path)
+	}
+	if len(ps.computedColumns) > 0 {
+		object = ps.computeColumns(object)
+	}
+	if ps.hasher != nil {
+		object = ps.hasher.hashColumns(object)
+	}
+	for _, masker := range ps.maskers {
+		object = masker.Mask(object)
+	}
 	batchHeader, processedObject, err := ProcessEvents(ps.tableName, object, ps.customTypes, ps.omitNils, ps.sqlAdapter.StringifyObjects())
 	if err != nil {
 		return nil, nil, err
 	}
+	if ps.stringNormalization != nil {
+		if err = ps.stringNormalization.normalize(processedObject); err != nil {
+			return nil, nil, err
+		}
+	}
 	table, processedObject := ps.sqlAdapter.TableHelper().MapTableSchema(ps.sqlAdapter, batchHeader, processedObject, ps.pkColumns, ps.timestampColumn)
+	table.Indexes = ps.indexes
+	table.NotNullColumns = ps.notNullColumns
+	table.PartitionColumns = ps.partitionColumns
+	table.ClusteringColumns = ps.clusteringColumns
+	table.Comment = ps.tableComment
+	table.ColumnComments = ps.columnComments
+	table.VersionColumn = ps.versionColumn
+	if ps.frozenTable != nil {
+		ps.freezeSchema(table, processedObject)
+	}
 	ps.state.ProcessedRows++
 	return table, processedObject, nil
 }
 
 func (ps *AbstractSQLStream) postConsume(err error) error {
 	if err != nil {
+		if bulker.IsRejectedObjectError(err) {
+			//rejected object doesn't affect other objects of the batch
+			ps.state.RejectedRows++
+			return err
+		}
 		ps.state.ErrorRowIndex = ps.state.ProcessedRows
 		ps.state.SetError(err)
 		return err
@@ -115,6 +255,11 @@ func (ps *AbstractSQLStream) init(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	if ps.schemaFreeze != "" {
+		if err = ps.loadFrozenTable(ctx); err != nil {
+			return err
+		}
+	}
 	ps.inited = true
 	return nil
 }
@@ -122,11 +267,17 @@ func (ps *AbstractSQLStream) init(ctx context.Context) error {
 // adjustTableColumnTypes modify currentTable with extra new columns from desiredTable if such exists
 // if some column already exists in the database, no problems if its DataType is castable to DataType of existing column
 // if some new column is being added but with different DataTypes - type of this column will be changed to a common ancestor type
-// object values that can't be casted will be added to '_unmaped_data' column of JSON type as an json object
+// object values that can't be casted are handled according to typeCoercionErrors policies.
+// By default, they will be added to '_unmaped_data' column of JSON type as an json object
 // returns true if new column was added to the currentTable as a result of this function call
-func (ps *AbstractSQLStream) adjustTableColumnTypes(currentTable, existingTable, desiredTable *Table, values types.Object) bool {
+// returns error if object was rejected by policy. currentTable is left intact in that case
+func (ps *AbstractSQLStream) adjustTableColumnTypes(currentTable, existingTable, desiredTable *Table, values types.Object) (bool, error) {
 	columnsAdded := false
 	current := currentTable.Columns
+	var originalColumns Columns
+	if ps.typeCoercionErrors.mayReject() {
+		originalColumns = current.Clone()
+	}
 	unmappedObj := map[string]any{}
 	for name, newCol := range desiredTable.Columns {
 		var existingCol types.SQLColumn
@@ -160,23 +311,38 @@ func (ps *AbstractSQLStream) adjustTableColumnTypes(currentTable, existingTable,
 			if ok && v != nil {
 				if types.IsConvertible(newCol.DataType, existingCol.DataType) {
 					newVal, _, err := types.Convert(existingCol.DataType, v)
-					if err != nil {
-						//logging.Warnf("Can't convert '%s' value '%v' from %s to %s: %v", name, values[name], newCol.DataType.String(), existingCol.DataType.String(), err)
-						unmappedObj[name] = v
-						delete(values, name)
-						continue
-					} else {
+					if err == nil {
 						//logging.Infof("Converted '%s' value '%v' from %s to %s: %v", name, values[name], newCol.DataType.String(), existingCol.DataType.String(), newVal)
 						values[name] = newVal
+						continue
 					}
-				} else {
-					//logging.Warnf("Can't convert '%s' value '%v' from %s to %s", name, values[name], newCol.DataType.String(), existingCol.DataType.String())
+					//logging.Warnf("Can't convert '%s' value '%v' from %s to %s: %v", name, values[name], newCol.DataType.String(), existingCol.DataType.String(), err)
+				}
+				policy := ps.typeCoercionErrors.policy(name)
+				switch policy {
+				case CoercionPolicyNull:
+					delete(values, name)
+				case CoercionPolicyDLQ, CoercionPolicyFail:
+					if originalColumns != nil {
+						//restore in place: columns map may be shared with destination table
+						clear(current)
+						for column, sqlColumn := range originalColumns {
+							current[column] = sqlColumn
+						}
+					}
+					err := fmt.Errorf("value '%v' of '%s' field cannot be coerced to %s type of existing column", v, name, existingCol.Type)
+					if policy == CoercionPolicyDLQ {
+						return false, &bulker.RejectedObjectError{Err: err}
+					}
+					return false, err
+				default:
 					unmappedObj[name] = v
 					delete(values, name)
-					continue
 				}
+				continue
 			}
-		} else {
+		} else if !existingCol.Override {
+			//columns pinned to sql type are never widened
 			common := types.GetCommonAncestorType(existingCol.DataType, newCol.DataType)
 			if common != existingCol.DataType {
 				//logging.Warnf("Changed '%s' type from %s to %s because of %s", name, existingCol.DataType.String(), common.String(), newCol.DataType.String())
@@ -192,17 +358,10 @@ func (ps *AbstractSQLStream) adjustTableColumnTypes(currentTable, existingTable,
 		}
 	}
 	if len(unmappedObj) > 0 {
-		jsonSQLType, _ := ps.sqlAdapter.GetSQLType(types.JSON)
-		added := utils.MapPutIfAbsent(current, ps.sqlAdapter.ColumnName(unmappedDataColumn), types.SQLColumn{DataType: types.JSON, Type: jsonSQLType})
+		added := ps.putUnmappedData(current, values, unmappedObj)
 		columnsAdded = columnsAdded || added
-		if ps.sqlAdapter.StringifyObjects() {
-			b, _ := jsoniter.Marshal(unmappedObj)
-			values[ps.sqlAdapter.ColumnName(unmappedDataColumn)] = string(b)
-		} else {
-			values[ps.sqlAdapter.ColumnName(unmappedDataColumn)] = unmappedObj
-		}
 	}
-	return columnsAdded
+	return columnsAdded, nil
 }
 
 func (ps *AbstractSQLStream) updateRepresentationTable(table *Table) {
@@ -226,3 +385,33 @@ type RepresentationTable struct {
 	PrimaryKeyName   string            `json:"primaryKeyName,omitempty"`
 	Temporary        bool              `json:"temporary,omitempty"`
 }
+
+// omitField returns object without field at provided path.
+// Maps on the path are copied so the original object is left intact
+func omitField(object map[string]any, path []string) map[string]any {
+	value, ok := object[path[0]]
+	if !ok {
+		return object
+	}
+	var replacement map[string]any
+	if len(path) > 1 {
+		nested, ok := value.(map[string]any)
+		if !ok {
+			return object
+		}
+		replacement = omitField(nested, path[1:])
+		if len(replacement) == len(nested) {
+			return object
+		}
+	}
+	copied := make(map[string]any, len(object))
+	for k, v := range object {
+		copied[k] = v
+	}
+	if len(path) > 1 {
+		copied[path[0]] = replacement
+	} else {
+		delete(copied, path[0])
+	}
+	return copied
+}
@@ -13,27 +13,64 @@ import (
 	"github.com/jitsucom/bulker/jitsubase/logging"
 	"github.com/jitsucom/bulker/jitsubase/utils"
 	jsoniter "github.com/json-iterator/go"
+	"io"
 	"os"
 	"path"
 	"strings"
 	"time"
 )
 
+const (
+	loadTableSavepoint = "bulker_load_table"
+	// default number of retries of failed LoadTable within the same transaction for adapters that support savepoints
+	loadTableSavepointRetries = 1
+)
+
 type AbstractTransactionalSQLStream struct {
 	*AbstractSQLStream
 	tx            *TxSQLAdapter
 	tmpTable      *Table
 	existingTable *Table
 	//function that generate tmp table schema based on target table schema
-	tmpTableFunc       func(ctx context.Context, tableForObject *Table, object types.Object) (table *Table)
+	tmpTableFunc       func(ctx context.Context, tableForObject *Table, object types.Object) (table *Table, err error)
 	dstTable           *Table
 	batchFile          *os.File
 	marshaller         types.Marshaller
 	targetMarshaller   types.Marshaller
 	eventsInBatch      int
 	s3                 *implementations.S3
+	azureBlob          *implementations.AzureBlob
 	batchFileLinesByPK map[string]int
 	batchFileSkipLines utils.Set[int]
+	// batchFileVersionsByPK versions (values of dedupColumn) of rows of batchFileLinesByPK. See bulker.VersionColumnOption and DeduplicateLatestOption
+	batchFileVersionsByPK map[string]any
+	// idempotencyTable table where idempotency key of the stream is recorded on Complete. See IdempotencyKeyOption
+	idempotencyTable *Table
+	// aggregator rolls up events in memory when 'aggregation' option is set. Rows are written at Complete
+	aggregator *batchAggregator
+	// columnStats collects per-column statistics of written rows when 'collectColumnStats' option is set
+	columnStats *columnStats
+	// qualityChecker evaluates 'qualityRules' over consumed rows before commit
+	qualityChecker *qualityChecker
+	// pendingTombstones primary keys of tombstones that are applied on Complete. See TombstonesOption
+	pendingTombstones map[string]types.Object
+	// dryRun statements are recorded instead of being executed. See DryRunOption
+	dryRun bool
+	// intermediateFlush limits of batch file that trigger its loading to tmp table before Complete. See IntermediateFlushOption
+	intermediateFlush *IntermediateFlushConfig
+	// flushes number of intermediate flushes of batch file to tmp table
+	flushes int
+	// flushedTmpTable schema of tmp table created by the last intermediate flush
+	flushedTmpTable  *Table
+	batchFileStarted time.Time
+	// checkpoints batch file can be made durable with Checkpoint and stream resumed with it after crash. See CheckpointsOption
+	checkpoints bool
+	// chunkedUpload converted batch file is split into chunks uploaded to the stage concurrently. See ChunkedUploadOption
+	chunkedUpload *ChunkedUploadConfig
+	// parallelLoad large batch file is split into parts processed concurrently. See ParallelLoadOption
+	parallelLoad *ParallelLoadConfig
+	// crossBatchDedup events with ids loaded by previous batches are skipped. See CrossBatchDedupOption
+	crossBatchDedup *crossBatchDedup
 }
 
 func newAbstractTransactionalStream(id string, p SQLAdapter, tableName string, mode bulker.BulkMode, streamOptions ...bulker.StreamOption) (*AbstractTransactionalSQLStream, error) {
@@ -47,6 +84,50 @@ func newAbstractTransactionalStream(id string, p SQLAdapter, tableName string, m
 	if ps.merge {
 		ps.batchFileLinesByPK = make(map[string]int)
 		ps.batchFileSkipLines = utils.NewSet[int]()
+		ps.batchFileVersionsByPK = make(map[string]any)
+	}
+	if err = validateMaintenanceOption(p, MaintenanceOption.Get(&ps.options)); err != nil {
+		return nil, err
+	}
+	if ps.tombstones != nil {
+		ps.pendingTombstones = make(map[string]types.Object)
+	}
+	ps.intermediateFlush = IntermediateFlushOption.Get(&ps.options)
+	if err = validateIntermediateFlushOption(ps.merge, ps.intermediateFlush); err != nil {
+		return nil, err
+	}
+	if CheckpointsOption.Get(&ps.options) {
+		if err = validateCheckpointsOption(p, &ps.options); err != nil {
+			return nil, err
+		}
+		ps.checkpoints = true
+	}
+	if err = validateChunkedUploadOption(p, &ps.options); err != nil {
+		return nil, err
+	}
+	ps.chunkedUpload = ChunkedUploadOption.Get(&ps.options)
+	if err = validateParallelLoadOption(p, &ps.options); err != nil {
+		return nil, err
+	}
+	ps.parallelLoad = ParallelLoadOption.Get(&ps.options)
+	if err = validateCrossBatchDedupOption(p, mode, ps.merge, &ps.options); err != nil {
+		return nil, err
+	}
+	if config := CrossBatchDedupOption.Get(&ps.options); config != nil {
+		ps.crossBatchDedup = newCrossBatchDedup(p, config)
+		ps.batchFileSkipLines = utils.NewSet[int]()
+	}
+	if DryRunOption.Get(&ps.options) {
+		if err = validateDryRunOption(p, mode, &ps.options); err != nil {
+			return nil, err
+		}
+		ps.dryRun = true
+	}
+	if bulker.CollectColumnStatsOption.Get(&ps.options) {
+		ps.columnStats = newColumnStats()
+	}
+	if rules := QualityRulesOption.Get(&ps.options); len(rules) > 0 {
+		ps.qualityChecker = newQualityChecker(rules, ps.sqlAdapter)
 	}
 	return &ps, nil
 }
@@ -57,24 +138,27 @@ func (ps *AbstractTransactionalSQLStream) init(ctx context.Context) (err error)
 	}
 	s3 := s3BatchFileOption.Get(&ps.options)
 	if s3 != nil {
-		s3Config := implementations.S3Config{AccessKey: s3.AccessKeyID, SecretKey: s3.SecretKey, Bucket: s3.Bucket, Region: s3.Region, FileConfig: implementations.FileConfig{Format: ps.sqlAdapter.GetBatchFileFormat(), Compression: ps.sqlAdapter.GetBatchFileCompression()}}
-		ps.s3, err = implementations.NewS3(&s3Config)
+		s3Config := s3.toS3Config(implementations.FileConfig{Format: ps.sqlAdapter.GetBatchFileFormat(), Compression: ps.sqlAdapter.GetBatchFileCompression()})
+		ps.s3, err = implementations.NewS3(s3Config)
 		if err != nil {
 			return fmt.Errorf("failed to setup s3 client: %v", err)
 		}
 	}
-	localBatchFile := localBatchFileOption.Get(&ps.options)
-	if localBatchFile != "" && ps.batchFile == nil {
-		ps.marshaller, _ = types.NewMarshaller(types.FileFormatNDJSON, types.FileCompressionNONE)
-		ps.targetMarshaller, err = types.NewMarshaller(ps.sqlAdapter.GetBatchFileFormat(), ps.sqlAdapter.GetBatchFileCompression())
+	azureBlob := azureBlobBatchFileOption.Get(&ps.options)
+	if azureBlob != nil && ps.azureBlob == nil {
+		azureBlobConfig := implementations.AzureBlobConfig{AccountName: azureBlob.AccountName, Container: azureBlob.Container, SASToken: azureBlob.SASToken, ManagedIdentityClientID: azureBlob.ManagedIdentityClientID, Endpoint: azureBlob.Endpoint, FileConfig: implementations.FileConfig{Format: ps.sqlAdapter.GetBatchFileFormat(), Compression: ps.sqlAdapter.GetBatchFileCompression()}}
+		ps.azureBlob, err = implementations.NewAzureBlob(&azureBlobConfig)
 		if err != nil {
-			return err
+			return fmt.Errorf("failed to setup azure blob client: %v", err)
 		}
-		if !ps.merge && ps.sqlAdapter.GetBatchFileFormat() == types.FileFormatNDJSON {
-			//without merge we can write file with compression - no need to convert
-			ps.marshaller, _ = types.NewMarshaller(ps.sqlAdapter.GetBatchFileFormat(), ps.sqlAdapter.GetBatchFileCompression())
+	}
+	localBatchFile := localBatchFileOption.Get(&ps.options)
+	if localBatchFile != "" && ps.batchFile == nil {
+		if token := ResumeTokenOption.Get(&ps.options); token != "" {
+			err = ps.resume(token)
+		} else {
+			err = ps.initBatchFile(localBatchFile)
 		}
-		ps.batchFile, err = os.CreateTemp("", localBatchFile+"_*"+ps.marshaller.FileExtension())
 		if err != nil {
 			return err
 		}
@@ -88,27 +172,82 @@ func (ps *AbstractTransactionalSQLStream) init(ctx context.Context) (err error)
 		if err != nil {
 			return err
 		}
+		if ps.dryRun {
+			ps.tx.tx.WithDryRun()
+		}
+	}
+
+	return nil
+}
+
+// initBatchFile creates local batch file and marshallers for it
+func (ps *AbstractTransactionalSQLStream) initBatchFile(localBatchFile string) (err error) {
+	if err = ps.initMarshallers(); err != nil {
+		return err
+	}
+	ps.batchFile, err = os.CreateTemp("", localBatchFile+"_*"+ps.marshaller.FileExtension())
+	if err != nil {
+		return err
 	}
+	ps.batchFileStarted = time.Now()
+	return nil
+}
 
+// initMarshallers creates marshaller of batch file and marshaller of the file loaded to destination
+func (ps *AbstractTransactionalSQLStream) initMarshallers() (err error) {
+	ps.marshaller, _ = types.NewMarshaller(InternalBatchFileFormatOption.Get(&ps.options), types.FileCompressionNONE)
+	marshallerConfig := batchFileMarshallerConfig(&ps.options, ps.sqlAdapter.GetBatchFileCompression())
+	ps.targetMarshaller, err = ps.newTargetMarshaller()
+	if err != nil {
+		return err
+	}
+	//with checkpoints batch file is kept uncompressed, so it can be flushed and appended after resume.
+	//with chunked upload and parallel load batch file is always converted, so it can be split into parts
+	//with cross-batch deduplication lines of batch file may be skipped, so it must be readable line by line
+	if !ps.merge && !ps.checkpoints && ps.chunkedUpload == nil && ps.parallelLoad == nil && ps.crossBatchDedup == nil && (ps.sqlAdapter.GetBatchFileFormat() == types.FileFormatNDJSON || ps.sqlAdapter.GetBatchFileFormat() == types.FileFormatNDJSONFLAT) {
+		//without merge we can write file with compression - no need to convert.
+		//objects are already flattened by preprocess so they can be written to ndjson_flat file as is
+		ps.marshaller, _ = types.NewMarshaller(ps.sqlAdapter.GetBatchFileFormat(), ps.sqlAdapter.GetBatchFileCompression(), types.WithMarshallerConfig(marshallerConfig))
+	}
 	return nil
 }
 
+// newTargetMarshaller creates marshaller of the file loaded to destination
+func (ps *AbstractTransactionalSQLStream) newTargetMarshaller() (types.Marshaller, error) {
+	marshallerConfig := batchFileMarshallerConfig(&ps.options, ps.sqlAdapter.GetBatchFileCompression())
+	return types.NewMarshaller(ps.sqlAdapter.GetBatchFileFormat(), ps.sqlAdapter.GetBatchFileCompression(), types.WithMarshallerConfig(marshallerConfig))
+}
+
 func (ps *AbstractTransactionalSQLStream) postComplete(ctx context.Context, err error) (bulker.State, error) {
+	if ps.dryRun {
+		return ps.completeDryRun(ctx, err)
+	}
 	if ps.batchFile != nil {
 		_ = ps.batchFile.Close()
 		_ = os.Remove(ps.batchFile.Name())
 	}
+	if err == nil {
+		err = ps.recordIdempotencyKey(ctx)
+	}
 	if err != nil {
 		ps.state.SuccessfulRows = 0
 		if ps.tx != nil {
 			if ps.tmpTable != nil {
 				_ = ps.tx.Drop(ctx, ps.tmpTable, true)
 			}
-			_ = ps.tx.Rollback()
+			if rbErr := ps.tx.Rollback(); rbErr != nil {
+				logging.Errorf("[%s] %v", ps.id, rbErr)
+			}
+		}
+		if ps.completedConcurrently(ctx, err) {
+			err = nil
 		}
 	} else {
 		sec := time.Since(ps.startTime).Seconds()
 		logging.Infof("[%s] Stream completed successfully in %.2f s. Avg Speed: %.2f events/sec.", ps.id, sec, float64(ps.state.SuccessfulRows)/sec)
+		if ps.columnStats != nil {
+			ps.state.ColumnStats = ps.columnStats.result()
+		}
 		if ps.tx != nil {
 			if ps.tmpTable != nil {
 				err = ps.tx.Drop(ctx, ps.tmpTable, true)
@@ -117,15 +256,37 @@ func (ps *AbstractTransactionalSQLStream) postComplete(ctx context.Context, err
 				}
 			}
 			err = ps.tx.Commit()
+			if err == nil {
+				ps.commitTransformRun()
+				ps.maintainAfterCommit()
+			}
 		}
 	}
 
 	return ps.AbstractSQLStream.postComplete(err)
 }
 
+// checkQuality evaluates data quality rules over consumed rows and puts results to the state.
+// Returns error if any of rules with 'fail' action is violated
+func (ps *AbstractTransactionalSQLStream) checkQuality() error {
+	if ps.qualityChecker == nil {
+		return nil
+	}
+	results, err := ps.qualityChecker.evaluate(time.Now())
+	ps.state.QualityChecks = results
+	return err
+}
+
 func (ps *AbstractTransactionalSQLStream) flushBatchFile(ctx context.Context) (state *bulker.WarehouseState, err error) {
 	table := ps.tmpTable
-	err = ps.tx.CreateTable(ctx, table)
+	if ps.flushedTmpTable != nil {
+		//tmp table was created by intermediate flush. Columns of objects written after it are added
+		if diff := ps.flushedTmpTable.Diff(table); diff.Exists() {
+			err = ps.tx.PatchTableSchema(ctx, diff)
+		}
+	} else {
+		err = ps.tx.CreateTable(ctx, table)
+	}
 	if err != nil {
 		return nil, errorj.Decorate(err, "failed to create table")
 	}
@@ -133,11 +294,32 @@ func (ps *AbstractTransactionalSQLStream) flushBatchFile(ctx context.Context) (s
 		if ps.merge {
 			ps.batchFileLinesByPK = make(map[string]int)
 			ps.batchFileSkipLines = utils.NewSet[int]()
+			ps.batchFileVersionsByPK = make(map[string]any)
+		}
+		if ps.crossBatchDedup != nil {
+			ps.crossBatchDedup.linesById = map[string]int{}
+			ps.batchFileSkipLines = utils.NewSet[int]()
 		}
 		_ = ps.batchFile.Close()
 		_ = os.Remove(ps.batchFile.Name())
 	}()
+	if ps.dryRun {
+		//batch file is not uploaded to stage or loaded in dry run
+		ps.tx.tx.recordStatement(fmt.Sprintf("-- load %d rows from batch file into %s", ps.eventsInBatch, table.Name))
+		return nil, nil
+	}
 	if ps.eventsInBatch > 0 {
+		if ps.crossBatchDedup != nil {
+			if err = ps.skipLoadedIds(ctx); err != nil {
+				return nil, err
+			}
+			//ids are recorded in the stream transaction, so they are committed or rolled back together with loaded rows
+			defer func() {
+				if err == nil {
+					err = ps.recordLoadedIds(ctx)
+				}
+			}()
+		}
 		err = ps.marshaller.Flush()
 		if err != nil {
 			return nil, errorj.Decorate(err, "failed to flush marshaller")
@@ -152,11 +334,16 @@ func (ps *AbstractTransactionalSQLStream) flushBatchFile(ctx context.Context) (s
 			batchSizeMb = float64(stat.Size()) / 1024 / 1024
 			sec := time.Since(ps.startTime).Seconds()
 			logging.Infof("[%s] Flushed %d events to batch file. Size: %.2f mb in %.2f s. Speed: %.2f mb/s", ps.id, ps.eventsInBatch, batchSizeMb, sec, batchSizeMb/sec)
+			if ps.parallelLoad != nil && ps.parallelLoad.due(stat.Size()) {
+				return ps.flushBatchFileParallel(ctx, table, stat.Size())
+			}
 		}
 		workingFile := ps.batchFile
+		targetMarshaller := ps.targetMarshaller
+		var chunks *chunkedMarshaller
 		needToConvert := false
 		convertStart := time.Now()
-		if !ps.targetMarshaller.Equal(ps.marshaller) {
+		if !ps.targetMarshaller.Equal(ps.marshaller) || ps.chunkedUpload != nil {
 			needToConvert = true
 		}
 		if len(ps.batchFileSkipLines) > 0 || needToConvert {
@@ -168,8 +355,16 @@ func (ps *AbstractTransactionalSQLStream) flushBatchFile(ctx context.Context) (s
 				_ = workingFile.Close()
 				_ = os.Remove(workingFile.Name())
 			}()
+			if ps.chunkedUpload != nil {
+				chunks, err = newChunkedMarshaller(ps.chunkedUpload.chunkSize(), ps.newTargetMarshaller)
+				if err != nil {
+					return nil, errorj.Decorate(err, "failed to create marshaller for chunks of batch file")
+				}
+				defer chunks.removeFiles()
+				targetMarshaller = chunks
+			}
 			if needToConvert {
-				err = ps.targetMarshaller.InitSchema(workingFile, table.SortedColumnNames(), ps.sqlAdapter.GetAvroSchema(table))
+				err = targetMarshaller.InitSchema(workingFile, table.SortedColumnNames(), ps.sqlAdapter.GetAvroSchema(table))
 				if err != nil {
 					return nil, errorj.Decorate(err, "failed to write header for converted batch file")
 				}
@@ -178,39 +373,48 @@ func (ps *AbstractTransactionalSQLStream) flushBatchFile(ctx context.Context) (s
 			if err != nil {
 				return nil, errorj.Decorate(err, "failed to open tmp file")
 			}
-			scanner := bufio.NewScanner(file)
-			scanner.Buffer(make([]byte, 1024*100), 1024*1024*10)
-			i := 0
-			for scanner.Scan() {
-				if !ps.batchFileSkipLines.Contains(i) {
-					if needToConvert {
-						dec := jsoniter.NewDecoder(bytes.NewReader(scanner.Bytes()))
-						if ps.targetMarshaller.Format() != types.FileFormatAVRO {
-							dec.UseNumber()
-						}
-						obj := make(map[string]any)
-						err = dec.Decode(&obj)
-						if err != nil {
-							return nil, errorj.Decorate(err, "failed to decode json object from batch filer")
-						}
-						err = ps.targetMarshaller.Marshal(obj)
-						if err != nil {
-							return nil, errorj.Decorate(err, "failed to marshal object to converted batch file")
-						}
-					} else {
-						_, err = workingFile.Write(scanner.Bytes())
-						if err != nil {
-							return nil, errorj.Decorate(err, "failed write to deduplication file")
+			defer func() {
+				_ = file.Close()
+			}()
+			if ps.marshaller.Format() == types.FileFormatMsgPack {
+				if err = ps.convertMsgPackBatchFile(file, targetMarshaller); err != nil {
+					return nil, err
+				}
+			} else {
+				scanner := bufio.NewScanner(file)
+				scanner.Buffer(make([]byte, 1024*100), 1024*1024*10)
+				i := 0
+				for scanner.Scan() {
+					if !ps.batchFileSkipLines.Contains(i) {
+						if needToConvert {
+							dec := jsoniter.NewDecoder(bytes.NewReader(scanner.Bytes()))
+							if ps.targetMarshaller.Format() != types.FileFormatAVRO {
+								dec.UseNumber()
+							}
+							obj := make(map[string]any)
+							err = dec.Decode(&obj)
+							if err != nil {
+								return nil, errorj.Decorate(err, "failed to decode json object from batch filer")
+							}
+							err = targetMarshaller.Marshal(obj)
+							if err != nil {
+								return nil, errorj.Decorate(err, "failed to marshal object to converted batch file")
+							}
+						} else {
+							_, err = workingFile.Write(scanner.Bytes())
+							if err != nil {
+								return nil, errorj.Decorate(err, "failed write to deduplication file")
+							}
+							_, _ = workingFile.Write([]byte("\n"))
 						}
-						_, _ = workingFile.Write([]byte("\n"))
 					}
+					i++
+				}
+				if err = scanner.Err(); err != nil {
+					return nil, errorj.Decorate(err, "failed to read batch file")
 				}
-				i++
-			}
-			if err = scanner.Err(); err != nil {
-				return nil, errorj.Decorate(err, "failed to read batch file")
 			}
-			ps.targetMarshaller.Flush()
+			targetMarshaller.Flush()
 			workingFile.Sync()
 		}
 		if needToConvert {
@@ -222,31 +426,58 @@ func (ps *AbstractTransactionalSQLStream) flushBatchFile(ctx context.Context) (s
 			logging.Infof("[%s] Converted batch file from %s (%.2f mb) to %s (%.2f mb) in %.2f s.", ps.id, ps.marshaller.FileExtension(), batchSizeMb, ps.targetMarshaller.FileExtension(), convertedSizeMb, time.Since(convertStart).Seconds())
 		}
 		loadTime := time.Now()
+		retryConfig := StagingRetriesOption.Get(&ps.options)
+		var stage batchFileStage
+		var loadSource *LoadSource
 		if ps.s3 != nil {
 			s3Config := s3BatchFileOption.Get(&ps.options)
-			rFile, err := os.Open(workingFile.Name())
+			stage = ps.s3
+			loadSource = &LoadSource{Type: AmazonS3, Path: stageFileName(s3Config.Folder, workingFile.Name()), Format: ps.sqlAdapter.GetBatchFileFormat(), S3Config: s3Config}
+		} else if ps.azureBlob != nil {
+			azureBlobConfig := azureBlobBatchFileOption.Get(&ps.options)
+			stage = ps.azureBlob
+			loadSource = &LoadSource{Type: AzureBlob, Path: stageFileName(azureBlobConfig.Folder, workingFile.Name()), Format: ps.sqlAdapter.GetBatchFileFormat(), AzureBlobConfig: azureBlobConfig}
+		}
+		if stage != nil && chunks != nil {
+			//chunks are loaded with a single statement over their common prefix
+			loadSource.Path = chunksPrefix(loadSource.Path, ps.targetMarshaller.FileExtension())
+			uploaded, err := ps.uploadChunks(ctx, stage, chunks.files, loadSource.Path, ps.chunkedUpload.concurrency())
+			for _, stageName := range uploaded {
+				defer stage.DeleteObject(stageName)
+			}
 			if err != nil {
-				return nil, errorj.Decorate(err, "failed to open tmp file")
+				return nil, errorj.Decorate(err, fmt.Sprintf("failed to upload chunks of batch file to %s", loadSource.Type))
 			}
-			s3FileName := path.Base(workingFile.Name())
-			if s3Config.Folder != "" {
-				s3FileName = s3Config.Folder + "/" + s3FileName
+			if ok, err := ps.stageManifest(stage, loadSource, uploaded); err != nil {
+				return nil, errorj.Decorate(err, fmt.Sprintf("failed to upload manifest to %s", loadSource.Type))
+			} else if ok {
+				defer stage.DeleteObject(loadSource.Path)
 			}
-			err = ps.s3.Upload(s3FileName, rFile)
+			logging.Infof("[%s] Batch file uploaded to %s in %d chunks in %.2f s.", ps.id, loadSource.Type, len(chunks.files), time.Since(loadTime).Seconds())
+		} else if stage != nil {
+			err = ps.uploadWithRetries(ctx, stage, workingFile.Name(), loadSource.Path)
 			if err != nil {
-				return nil, errorj.Decorate(err, "failed to upload file to s3")
+				return nil, errorj.Decorate(err, fmt.Sprintf("failed to upload file to %s", loadSource.Type))
 			}
-			defer ps.s3.DeleteObject(s3FileName)
-			logging.Infof("[%s] Batch file uploaded to s3 in %.2f s.", ps.id, time.Since(loadTime).Seconds())
+			defer stage.DeleteObject(loadSource.Path)
+			logging.Infof("[%s] Batch file uploaded to %s in %.2f s.", ps.id, loadSource.Type, time.Since(loadTime).Seconds())
+		}
+		if stage != nil {
 			loadTime = time.Now()
-			state, err = ps.tx.LoadTable(ctx, table, &LoadSource{Type: AmazonS3, Path: s3FileName, Format: ps.sqlAdapter.GetBatchFileFormat(), S3Config: s3Config})
+			err = ps.tx.WithSavepoint(ctx, loadTableSavepoint, retryConfig.LoadRetries, retryConfig.backoff, func() (err error) {
+				state, err = ps.tx.LoadTable(ctx, table, loadSource)
+				return err
+			})
 			if err != nil {
 				return state, errorj.Decorate(err, "failed to flush tmp file to the warehouse")
 			} else {
 				logging.Infof("[%s] Batch file loaded to %s in %.2f s.", ps.id, ps.sqlAdapter.Type(), time.Since(loadTime).Seconds())
 			}
 		} else {
-			state, err = ps.tx.LoadTable(ctx, table, &LoadSource{Type: LocalFile, Path: workingFile.Name(), Format: ps.sqlAdapter.GetBatchFileFormat()})
+			err = ps.tx.WithSavepoint(ctx, loadTableSavepoint, retryConfig.LoadRetries, retryConfig.backoff, func() (err error) {
+				state, err = ps.tx.LoadTable(ctx, table, &LoadSource{Type: LocalFile, Path: workingFile.Name(), Format: ps.sqlAdapter.GetBatchFileFormat()})
+				return err
+			})
 			if err != nil {
 				return state, errorj.Decorate(err, "failed to flush tmp file to the warehouse")
 			} else {
@@ -257,6 +488,20 @@ func (ps *AbstractTransactionalSQLStream) flushBatchFile(ctx context.Context) (s
 	return
 }
 
+// batchFileStage is an object storage where batch file is uploaded before loading to the destination table
+type batchFileStage interface {
+	Upload(fileName string, fileReader io.ReadSeeker) error
+	DeleteObject(key string) error
+}
+
+// stageFileName returns name of batch file in the stage with optional folder prefix
+func stageFileName(folder, localFileName string) string {
+	if folder != "" {
+		return folder + "/" + path.Base(localFileName)
+	}
+	return path.Base(localFileName)
+}
+
 //func (ps *AbstractTransactionalSQLStream) ensureSchema(ctx context.Context, targetTable **Table, tableForObject *Table, initTable func(ctx context.Context) (*Table, error)) (err error) {
 //	needRenewTmpTable := false
 //	//first object
@@ -294,8 +539,29 @@ func (ps *AbstractTransactionalSQLStream) flushBatchFile(ctx context.Context) (s
 //	return nil
 //}
 
+// convertMsgPackBatchFile writes objects of batch file in msgpack format with targetMarshaller skipping deduplicated ones
+func (ps *AbstractTransactionalSQLStream) convertMsgPackBatchFile(file io.Reader, targetMarshaller types.Marshaller) error {
+	reader := types.NewMsgPackReader(file)
+	for i := 0; ; i++ {
+		obj, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return errorj.Decorate(err, "failed to decode msgpack object from batch file")
+		}
+		if ps.batchFileSkipLines.Contains(i) {
+			continue
+		}
+		if err = targetMarshaller.Marshal(obj); err != nil {
+			return errorj.Decorate(err, "failed to marshal object to converted batch file")
+		}
+	}
+}
+
 func (ps *AbstractTransactionalSQLStream) writeToBatchFile(ctx context.Context, targetTable *Table, processedObject types.Object) error {
-	ps.adjustTables(ctx, targetTable, processedObject)
+	if err := ps.adjustTables(ctx, targetTable, processedObject); err != nil {
+		return err
+	}
 	ps.updateRepresentationTable(ps.tmpTable)
 	err := ps.marshaller.InitSchema(ps.batchFile, nil, nil)
 	if err != nil {
@@ -306,43 +572,59 @@ func (ps *AbstractTransactionalSQLStream) writeToBatchFile(ctx context.Context,
 		if err != nil {
 			return err
 		}
-		line, ok := ps.batchFileLinesByPK[pk]
-		if ok {
-			ps.batchFileSkipLines.Put(line)
+		lineNumber := ps.eventsInBatch
+		if ps.marshaller.NeedHeader() {
+			lineNumber++
 		}
+		ps.trackBatchFileLine(pk, lineNumber, processedObject)
+	} else if ps.crossBatchDedup != nil {
 		lineNumber := ps.eventsInBatch
 		if ps.marshaller.NeedHeader() {
 			lineNumber++
 		}
-		ps.batchFileLinesByPK[pk] = lineNumber
+		ps.trackDedupId(processedObject, lineNumber)
 	}
 	err = ps.marshaller.Marshal(processedObject)
 	if err != nil {
 		return errorj.Decorate(err, "failed to marshall into csv file")
 	}
 	ps.eventsInBatch++
+	if ps.columnStats != nil {
+		ps.columnStats.add(processedObject)
+	}
 	return nil
 }
 
 func (ps *AbstractTransactionalSQLStream) insert(ctx context.Context, targetTable *Table, processedObject types.Object) (err error) {
-	ps.adjustTables(ctx, targetTable, processedObject)
+	if err = ps.adjustTables(ctx, targetTable, processedObject); err != nil {
+		return err
+	}
 	ps.updateRepresentationTable(ps.tmpTable)
 	ps.tmpTable, err = ps.sqlAdapter.TableHelper().EnsureTableWithoutCaching(ctx, ps.tx, ps.id, ps.tmpTable)
 	if err != nil {
 		return errorj.Decorate(err, "failed to ensure table")
 	}
-	return ps.tx.Insert(ctx, ps.tmpTable, ps.merge, processedObject)
+	err = ps.tx.Insert(ctx, ps.tmpTable, ps.merge, processedObject)
+	if err == nil && ps.columnStats != nil {
+		ps.columnStats.add(processedObject)
+	}
+	return err
 }
 
-func (ps *AbstractTransactionalSQLStream) adjustTables(ctx context.Context, targetTable *Table, processedObject types.Object) {
+func (ps *AbstractTransactionalSQLStream) adjustTables(ctx context.Context, targetTable *Table, processedObject types.Object) error {
 	if ps.tmpTable == nil {
+		tmpTable, err := ps.tmpTableFunc(ctx, targetTable, processedObject)
+		if err != nil {
+			return err
+		}
 		//targetTable contains desired name and primary key setup
 		ps.dstTable = targetTable
-		ps.tmpTable = ps.tmpTableFunc(ctx, targetTable, processedObject)
-	} else {
-		ps.adjustTableColumnTypes(ps.tmpTable, ps.existingTable, targetTable, processedObject)
+		ps.tmpTable = tmpTable
+	} else if _, err := ps.adjustTableColumnTypes(ps.tmpTable, ps.existingTable, targetTable, processedObject); err != nil {
+		return err
 	}
 	ps.dstTable.Columns = ps.tmpTable.Columns
+	return nil
 }
 
 func (ps *AbstractTransactionalSQLStream) Consume(ctx context.Context, object types.Object) (state bulker.State, processedObject types.Object, err error) {
@@ -353,21 +635,109 @@ func (ps *AbstractTransactionalSQLStream) Consume(ctx context.Context, object ty
 	if err = ps.init(ctx); err != nil {
 		return
 	}
+	processedObject, err = ps.consume(ctx, object)
+	return
+}
+
+// ConsumeBatch initializes stream once for the whole batch and consumes objects in order. Stops at the first error
+func (ps *AbstractTransactionalSQLStream) ConsumeBatch(ctx context.Context, objects []types.Object) (state bulker.State, processedObjects []types.Object, err error) {
+	if err = ps.init(ctx); err != nil {
+		return ps.state, nil, ps.postConsume(err)
+	}
+	processedObjects = make([]types.Object, 0, len(objects))
+	for _, object := range objects {
+		processedObject, err := ps.consume(ctx, object)
+		if err = ps.postConsume(err); err != nil {
+			return ps.state, processedObjects, err
+		}
+		processedObjects = append(processedObjects, processedObject)
+	}
+	return ps.state, processedObjects, nil
+}
 
+// consume writes object to the batch file or inserts it to the tmp table. Stream must be initialized
+func (ps *AbstractTransactionalSQLStream) consume(ctx context.Context, object types.Object) (processedObject types.Object, err error) {
+	deleted := false
+	if ps.tombstones != nil {
+		object, deleted = ps.tombstones.tombstone(object)
+	}
 	//type mapping, flattening => table schema
 	tableForObject, processedObject, err := ps.preprocess(object)
 	if err != nil {
 		return
 	}
+	if ps.tombstones != nil {
+		err = ps.trackTombstone(processedObject, deleted)
+		if deleted || err != nil {
+			return
+		}
+	}
+	if ps.qualityChecker != nil {
+		ps.qualityChecker.add(processedObject)
+	}
+	if ps.aggregator != nil {
+		err = ps.aggregator.add(processedObject)
+		return
+	}
 	batchFile := ps.batchFile != nil
 	if batchFile {
 		err = ps.writeToBatchFile(ctx, tableForObject, processedObject)
+		if err == nil {
+			err = ps.flushIfNeeded(ctx)
+		}
 	} else {
 		err = ps.insert(ctx, tableForObject, processedObject)
 	}
 	return
 }
 
+// trackTombstone records primary key of tombstone to be applied on Complete.
+// Row with the same primary key written to batch file earlier is skipped. Regular object cancels earlier tombstone
+func (ps *AbstractTransactionalSQLStream) trackTombstone(processedObject types.Object, deleted bool) error {
+	pk, keyObject, err := ps.tombstoneKey(processedObject)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		delete(ps.pendingTombstones, pk)
+		return nil
+	}
+	if line, ok := ps.batchFileLinesByPK[pk]; ok {
+		ps.batchFileSkipLines.Put(line)
+		delete(ps.batchFileLinesByPK, pk)
+	}
+	ps.pendingTombstones[pk] = keyObject
+	return nil
+}
+
+// applyPendingTombstones deletes rows of tombstones from tmp table (when objects are inserted there directly) and
+// deletes or flags matching rows of destination table
+func (ps *AbstractTransactionalSQLStream) applyPendingTombstones(ctx context.Context) (state *bulker.WarehouseState, err error) {
+	if len(ps.pendingTombstones) == 0 {
+		return nil, nil
+	}
+	tombstones := make([]types.Object, 0, len(ps.pendingTombstones))
+	for _, tombstone := range ps.pendingTombstones {
+		tombstones = append(tombstones, tombstone)
+	}
+	if ps.tmpTable != nil && ps.batchFile == nil {
+		ws, err := ps.deleteTombstoned(ctx, ps.tx, ps.tmpTable, tombstones)
+		state = ws
+		if err != nil {
+			return state, err
+		}
+	}
+	ws, err := ps.applyTombstones(ctx, ps.tx, tombstones)
+	if ws != nil {
+		if state == nil {
+			state = ws
+		} else {
+			state.Merge(ws)
+		}
+	}
+	return state, err
+}
+
 func (ps *AbstractTransactionalSQLStream) Abort(ctx context.Context) (state bulker.State, err error) {
 	if ps.state.Status != bulker.Active {
 		return ps.state, errors.New("stream is not active")
@@ -0,0 +1,277 @@
+package sql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/errorj"
+	"github.com/jitsucom/bulker/jitsubase/timestamp"
+	"strings"
+	"time"
+)
+
+type AggregationFunction string
+
+const (
+	AggregationCount AggregationFunction = "count"
+	AggregationSum   AggregationFunction = "sum"
+	AggregationMin   AggregationFunction = "min"
+	AggregationMax   AggregationFunction = "max"
+)
+
+// AggregationMetric aggregated value computed for each group.
+// Field may be omitted for 'count' - then number of events in group is counted
+type AggregationMetric struct {
+	Field    string              `json:"field,omitempty"`
+	Function AggregationFunction `json:"function"`
+	// As name of result column. Default: <function>_<field> or 'count' for count of events
+	As string `json:"as,omitempty"`
+}
+
+// AggregationConfig rolls up events of a batch into one row per unique combination of GroupBy fields values
+type AggregationConfig struct {
+	GroupBy []string            `json:"groupBy"`
+	Metrics []AggregationMetric `json:"metrics"`
+}
+
+func (ac *AggregationConfig) Validate() error {
+	if len(ac.GroupBy) == 0 {
+		return fmt.Errorf("aggregation requires at least one groupBy field")
+	}
+	if len(ac.Metrics) == 0 {
+		return fmt.Errorf("aggregation requires at least one metric")
+	}
+	for i, m := range ac.Metrics {
+		switch m.Function {
+		case AggregationCount:
+		case AggregationSum, AggregationMin, AggregationMax:
+			if m.Field == "" {
+				return fmt.Errorf("aggregation metric #%d: field is required for '%s' function", i, m.Function)
+			}
+		default:
+			return fmt.Errorf("aggregation metric #%d: unsupported function '%s'. Supported: count, sum, min, max", i, m.Function)
+		}
+	}
+	return nil
+}
+
+func (m AggregationMetric) columnName() string {
+	if m.As != "" {
+		return m.As
+	}
+	if m.Field == "" {
+		return string(m.Function)
+	}
+	return string(m.Function) + "_" + m.Field
+}
+
+// batchAggregator accumulates aggregated rows in memory during the batch
+type batchAggregator struct {
+	groupBy []string
+	metrics []AggregationMetric
+	// metric fields adapted to column names
+	metricFields []string
+	rows         map[string]types.Object
+	// keys in order of appearance to keep output stable
+	keys []string
+}
+
+func newBatchAggregator(config *AggregationConfig, sqlAdapter SQLAdapter) *batchAggregator {
+	groupBy := make([]string, len(config.GroupBy))
+	for i, field := range config.GroupBy {
+		groupBy[i] = sqlAdapter.ColumnName(field)
+	}
+	metricFields := make([]string, len(config.Metrics))
+	for i, m := range config.Metrics {
+		if m.Field != "" {
+			metricFields[i] = sqlAdapter.ColumnName(m.Field)
+		}
+	}
+	return &batchAggregator{
+		groupBy:      groupBy,
+		metrics:      config.Metrics,
+		metricFields: metricFields,
+		rows:         map[string]types.Object{},
+	}
+}
+
+// add merges processed object into aggregated row of its group
+func (ba *batchAggregator) add(object types.Object) error {
+	keyParts := make([]string, len(ba.groupBy))
+	for i, field := range ba.groupBy {
+		keyParts[i] = fmt.Sprint(object[field])
+	}
+	key := strings.Join(keyParts, "_###_")
+	row, ok := ba.rows[key]
+	if !ok {
+		row = types.Object{}
+		for _, field := range ba.groupBy {
+			if value, ok := object[field]; ok {
+				row[field] = value
+			}
+		}
+		ba.rows[key] = row
+		ba.keys = append(ba.keys, key)
+	}
+	for i, m := range ba.metrics {
+		column := m.columnName()
+		field := ba.metricFields[i]
+		value, present := object[field]
+		if field != "" && (!present || value == nil) {
+			continue
+		}
+		current, hasCurrent := row[column]
+		if m.Function == AggregationCount {
+			if !hasCurrent {
+				current = int64(0)
+			}
+			row[column] = current.(int64) + 1
+			continue
+		}
+		if !hasCurrent {
+			if m.Function == AggregationSum {
+				if _, ok := toFloat(value); !ok {
+					return fmt.Errorf("aggregation: can't sum non-numeric value of field '%s': %v", m.Field, value)
+				}
+			}
+			row[column] = value
+			continue
+		}
+		var err error
+		row[column], err = aggregate(m.Function, current, value)
+		if err != nil {
+			return fmt.Errorf("aggregation: failed to compute %s of field '%s': %v", m.Function, m.Field, err)
+		}
+	}
+	return nil
+}
+
+func aggregate(function AggregationFunction, current, value any) (any, error) {
+	if function == AggregationSum {
+		ci, cIsInt := current.(int64)
+		vi, vIsInt := value.(int64)
+		if cIsInt && vIsInt {
+			return ci + vi, nil
+		}
+		cf, ok1 := toFloat(current)
+		vf, ok2 := toFloat(value)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("non-numeric value: %v", value)
+		}
+		return cf + vf, nil
+	}
+	cmp, err := compareValues(current, value)
+	if err != nil {
+		return nil, err
+	}
+	if (function == AggregationMin && cmp > 0) || (function == AggregationMax && cmp < 0) {
+		return value, nil
+	}
+	return current, nil
+}
+
+// compareValues returns -1, 0 or 1 when a is less, equal or greater than b
+func compareValues(a, b any) (int, error) {
+	if at, ok := a.(time.Time); ok {
+		bt, ok := b.(time.Time)
+		if !ok {
+			return 0, fmt.Errorf("can't compare time with %T", b)
+		}
+		return at.Compare(bt), nil
+	}
+	if af, ok := toFloat(a); ok {
+		bf, ok := toFloat(b)
+		if !ok {
+			return 0, fmt.Errorf("can't compare number with %T", b)
+		}
+		switch {
+		case af < bf:
+			return -1, nil
+		case af > bf:
+			return 1, nil
+		}
+		return 0, nil
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b)), nil
+}
+
+func toFloat(value any) (float64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// results returns aggregated rows. Time values are formatted so rows can be processed as regular events
+func (ba *batchAggregator) results() []types.Object {
+	res := make([]types.Object, 0, len(ba.keys))
+	for _, key := range ba.keys {
+		row := ba.rows[key]
+		for k, v := range row {
+			if t, ok := v.(time.Time); ok {
+				row[k] = t.Format(timestamp.JsonISO)
+			}
+		}
+		res = append(res, row)
+	}
+	return res
+}
+
+// flushAggregates writes aggregated rows to the batch file or to tmp table
+func (ps *AbstractTransactionalSQLStream) flushAggregates(ctx context.Context) error {
+	rows := ps.aggregator.results()
+	ps.aggregator = nil
+	for _, row := range rows {
+		batchHeader, processedObject, err := ProcessEvents(ps.tableName, row, ps.customTypes, ps.omitNils, ps.sqlAdapter.StringifyObjects())
+		if err != nil {
+			return errorj.Decorate(err, "failed to process aggregated row")
+		}
+		table, processedObject := ps.sqlAdapter.TableHelper().MapTableSchema(ps.sqlAdapter, batchHeader, processedObject, ps.pkColumns, ps.timestampColumn)
+		if ps.batchFile != nil {
+			err = ps.writeToBatchFile(ctx, table, processedObject)
+		} else {
+			err = ps.insert(ctx, table, processedObject)
+		}
+		if err != nil {
+			return errorj.Decorate(err, "failed to write aggregated row")
+		}
+	}
+	return nil
+}
+
+// parseAggregationConfig parses 'aggregation' option from map or json string
+func parseAggregationConfig(serialized any) (*AggregationConfig, error) {
+	var raw []byte
+	switch v := serialized.(type) {
+	case *AggregationConfig:
+		return v, v.Validate()
+	case string:
+		raw = []byte(v)
+	default:
+		var err error
+		raw, err = json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value type of aggregation option: %T", v)
+		}
+	}
+	config := &AggregationConfig{}
+	if err := json.Unmarshal(raw, config); err != nil {
+		return nil, fmt.Errorf("failed to parse aggregation config: %v", err)
+	}
+	return config, config.Validate()
+}
+
+// WithAggregation enables pre-aggregation of events in batch mode: one row per group is loaded instead of every event
+func WithAggregation(config *AggregationConfig) bulker.StreamOption {
+	return bulker.WithOption(&AggregationOption, config)
+}
@@ -30,17 +30,31 @@ func (ps *AutoCommitStream) Consume(ctx context.Context, object types.Object) (s
 	if err = ps.init(ctx); err != nil {
 		return
 	}
-	table, processedObject, err := ps.preprocess(object)
-	if ps.schemaFromOptions != nil {
-		ps.adjustTableColumnTypes(table, nil, ps.schemaFromOptions, object)
+	deleted := false
+	if ps.tombstones != nil {
+		object, deleted = ps.tombstones.tombstone(object)
 	}
+	table, processedObject, err := ps.preprocess(object)
 	if err != nil {
 		return
 	}
+	if deleted {
+		err = ps.deleteByTombstone(ctx, processedObject)
+		return ps.state, processedObject, err
+	}
+	if ps.schemaFromOptions != nil {
+		if _, err = ps.adjustTableColumnTypes(table, nil, ps.schemaFromOptions, object); err != nil {
+			return
+		}
+	}
 	existingTable, err := ps.sqlAdapter.TableHelper().EnsureTableWithCaching(ctx, ps.sqlAdapter, ps.id, table)
 	if err == nil {
 		// for autocommit mode this method only tries to convert values to existing column types
-		columnsAdded := ps.adjustTableColumnTypes(table, existingTable, table, processedObject)
+		var columnsAdded bool
+		columnsAdded, err = ps.adjustTableColumnTypes(table, existingTable, table, processedObject)
+		if err != nil {
+			return
+		}
 		if columnsAdded {
 			ps.updateRepresentationTable(existingTable)
 			// if new columns were added - update table. (for _unmapped_data column)
@@ -48,6 +62,7 @@ func (ps *AutoCommitStream) Consume(ctx context.Context, object types.Object) (s
 		}
 		if err == nil {
 			existingTable.Columns = table.Columns
+			existingTable.VersionColumn = table.VersionColumn
 			ps.updateRepresentationTable(existingTable)
 			err = ps.sqlAdapter.Insert(ctx, existingTable, ps.merge, processedObject)
 		}
@@ -61,7 +76,11 @@ func (ps *AutoCommitStream) Consume(ctx context.Context, object types.Object) (s
 			return
 		}
 		// for autocommit mode this method only tries to convert values to existing column types
-		columnsAdded := ps.adjustTableColumnTypes(table, existingTable, table, processedObject)
+		var columnsAdded bool
+		columnsAdded, err = ps.adjustTableColumnTypes(table, existingTable, table, processedObject)
+		if err != nil {
+			return
+		}
 		if columnsAdded {
 			ps.updateRepresentationTable(existingTable)
 			// if new columns were added - update table. (for _unmapped_data column)
@@ -72,12 +91,34 @@ func (ps *AutoCommitStream) Consume(ctx context.Context, object types.Object) (s
 			}
 		}
 		existingTable.Columns = table.Columns
+		existingTable.VersionColumn = table.VersionColumn
 		ps.updateRepresentationTable(existingTable)
 		return ps.state, processedObject, ps.sqlAdapter.Insert(ctx, existingTable, ps.merge, processedObject)
 	}
 	return ps.state, processedObject, nil
 }
 
+func (ps *AutoCommitStream) ConsumeBatch(ctx context.Context, objects []types.Object) (state bulker.State, processedObjects []types.Object, err error) {
+	return bulker.ConsumeEach(ctx, ps, objects)
+}
+
+// deleteByTombstone deletes or flags row matching primary key of tombstone in a separate transaction
+func (ps *AutoCommitStream) deleteByTombstone(ctx context.Context, processedObject types.Object) error {
+	_, keyObject, err := ps.tombstoneKey(processedObject)
+	if err != nil {
+		return err
+	}
+	tx, err := ps.sqlAdapter.OpenTx(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err = ps.applyTombstones(ctx, tx, []types.Object{keyObject}); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
 func (ps *AutoCommitStream) Complete(ctx context.Context) (state bulker.State, err error) {
 	ps.state.Status = bulker.Completed
 	return ps.state, nil
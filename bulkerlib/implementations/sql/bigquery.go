@@ -2,6 +2,7 @@ package sql
 
 import (
 	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/bigquery/storage/managedwriter"
 	"cloud.google.com/go/civil"
 	"context"
 	"errors"
@@ -24,11 +25,13 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 func init() {
 	bulker.RegisterBulker(BigqueryBulkerTypeId, NewBigquery)
+	bulker.RegisterConfigType(BigqueryBulkerTypeId, implementations.GoogleConfig{})
 }
 
 const (
@@ -36,12 +39,18 @@ const (
 	BigqueryBulkerTypeId          = "bigquery"
 
 	bigqueryInsertFromSelectTemplate = "INSERT INTO %s(%s) SELECT %s FROM %s"
-	bigqueryMergeTemplate            = "MERGE INTO %s T USING %s S ON %s WHEN MATCHED THEN UPDATE SET %s WHEN NOT MATCHED THEN INSERT (%s) VALUES (%s)"
+	bigqueryMergeTemplate            = "MERGE INTO %s T USING %s S ON %s WHEN MATCHED%s THEN UPDATE SET %s WHEN NOT MATCHED THEN INSERT (%s) VALUES (%s)"
+	bigqueryVersionConditionTemplate = " AND (T.%s IS NULL OR T.%s <= S.%s)"
+	bigqueryUpdateColumnsTemplate    = "MERGE INTO %s T USING %s S ON %s WHEN MATCHED THEN UPDATE SET %s"
+	bigqueryDeleteByKeysTemplate     = "DELETE FROM %s T WHERE EXISTS (SELECT 1 FROM %s S WHERE %s)"
+	bigqueryCloseVersionsTemplate    = "MERGE INTO %s T USING %s S ON %s WHEN MATCHED AND T.%s = TRUE THEN UPDATE SET T.%s = S.%s, T.%s = FALSE"
 	bigqueryDeleteTemplate           = "DELETE FROM %s WHERE %s"
 	bigqueryUpdateTemplate           = "UPDATE %s SET %s WHERE %s"
 
 	bigqueryTruncateTemplate = "TRUNCATE TABLE %s"
 	bigquerySelectTemplate   = "SELECT %s FROM %s%s%s"
+	bigquerySnapshotTemplate = "CREATE SNAPSHOT TABLE %s CLONE %s OPTIONS(expiration_timestamp = TIMESTAMP '%s')"
+	bigqueryReplaceTemplate  = "CREATE OR REPLACE TABLE %s CLONE %s"
 
 	bigqueryPKHashLabel = "jitsu_pk_hash"
 	bigqueryPKNameLabel = "jitsu_pk_name"
@@ -117,6 +126,14 @@ type BigQuery struct {
 	config      *implementations.GoogleConfig
 	queryLogger *logging.QueryLogger
 	tableHelper TableHelper
+	// statementTimeout - timeout for jobs. Timed out jobs are cancelled. 0 - no timeout
+	statementTimeout time.Duration
+
+	storageWriteOnce sync.Once
+	storageWrite     *managedwriter.Client
+	storageWriteErr  error
+	// schemaRouter routes events to per-dataset instances of BigQuery. See SchemaFieldOption
+	schemaRouter *schemaRouter
 }
 
 // NewBigquery return configured BigQuery bulker.Bulker instance
@@ -147,18 +164,50 @@ func NewBigquery(bulkerConfig bulker.Config) (bulker.Bulker, error) {
 	}
 	b := &BigQuery{
 		Service: appbase.NewServiceBase(bulkerConfig.Id),
-		client:  client, config: config, queryLogger: queryLogger}
+		client:  client, config: config, queryLogger: queryLogger,
+		statementTimeout: time.Duration(bulkerConfig.StatementTimeoutSec) * time.Second}
 	b.tableHelper = NewTableHelper(1024, '`')
 	b.tableHelper.columnNameFunc = columnNameFunc
 	b.tableHelper.tableNameFunc = tableNameFunc
+	b.schemaRouter = newSchemaRouter(b, bulkerConfig, "bqDataset")
 	return b, err
 }
 
 func (bq *BigQuery) CreateStream(id, tableName string, mode bulker.BulkMode, streamOptions ...bulker.StreamOption) (bulker.BulkerStream, error) {
-	bq.validateOptions(streamOptions)
+	if routed, err := bq.schemaRouter.routedStream(id, tableName, mode, streamOptions); routed != nil || err != nil {
+		return routed, err
+	}
+	options, err := bq.validateOptions(mode, streamOptions)
+	if err != nil {
+		return nil, err
+	}
 	streamOptions = append(streamOptions, withLocalBatchFile(fmt.Sprintf("bulker_%s", utils.SanitizeString(id))))
+	if BigQueryStorageWriteOption.Get(options) {
+		sw := newBigQueryStorageWrite(bq)
+		switch mode {
+		case bulker.Batch:
+			return newTransactionalStream(id, sw, tableName, streamOptions...)
+		case bulker.ReplaceTable:
+			return newReplaceTableStream(id, sw, tableName, streamOptions...)
+		case bulker.ReplacePartition:
+			return newReplacePartitionStream(id, sw, tableName, streamOptions...)
+		case bulker.UpdateColumns:
+			return newUpdateColumnsStream(id, sw, tableName, streamOptions...)
+		case bulker.SCD2:
+			return newSCD2Stream(id, sw, tableName, streamOptions...)
+		case bulker.CDC:
+			return newCDCStream(id, sw, tableName, streamOptions...)
+		}
+	}
 	switch mode {
 	case bulker.Stream:
+		if BigQueryStreamingInsertsOption.Get(options) {
+			var batchAdapter SQLAdapter = bq
+			if BigQueryStorageWriteOption.Get(options) {
+				batchAdapter = newBigQueryStorageWrite(bq)
+			}
+			return newStreamingFallbackStream(id, newBigQueryStreamingInserts(bq), batchAdapter, tableName, streamOptions...)
+		}
 		return nil, errors.New(BigQueryAutocommitUnsupported)
 		//return newAutoCommitStream(id, bq, tableName, streamOptions...)
 	case bulker.Batch:
@@ -167,6 +216,12 @@ func (bq *BigQuery) CreateStream(id, tableName string, mode bulker.BulkMode, str
 		return newReplaceTableStream(id, bq, tableName, streamOptions...)
 	case bulker.ReplacePartition:
 		return newReplacePartitionStream(id, bq, tableName, streamOptions...)
+	case bulker.UpdateColumns:
+		return newUpdateColumnsStream(id, bq, tableName, streamOptions...)
+	case bulker.SCD2:
+		return newSCD2Stream(id, bq, tableName, streamOptions...)
+	case bulker.CDC:
+		return newCDCStream(id, bq, tableName, streamOptions...)
 	}
 	return nil, fmt.Errorf("unsupported bulk mode: %s", mode)
 }
@@ -183,12 +238,15 @@ func (bq *BigQuery) StringifyObjects() bool {
 	return true
 }
 
-func (bq *BigQuery) validateOptions(streamOptions []bulker.StreamOption) error {
+func (bq *BigQuery) validateOptions(mode bulker.BulkMode, streamOptions []bulker.StreamOption) (*bulker.StreamOptions, error) {
 	options := &bulker.StreamOptions{}
 	for _, option := range streamOptions {
 		options.Add(option)
 	}
-	return nil
+	if BigQueryStorageWriteOption.Get(options) && s3BatchFileOption.Get(options) != nil {
+		return nil, fmt.Errorf("option %s doesn't support loading from s3", BigQueryStorageWriteOption.Key)
+	}
+	return options, nil
 }
 
 func (bq *BigQuery) CopyTables(ctx context.Context, targetTable *Table, sourceTable *Table, mergeWindow int) (state *bulker.WarehouseState, err error) {
@@ -256,8 +314,13 @@ func (bq *BigQuery) CopyTables(ctx context.Context, targetTable *Table, sourceTa
 			monthBefore := timestamp.Now().Add(time.Duration(mergeWindow) * -24 * time.Hour).Format("2006-01-02")
 			joinConditions = append(joinConditions, fmt.Sprintf("T.%s >= '%s'", bq.quotedColumnName(targetTable.TimestampColumn), monthBefore))
 		}
+		var versionCondition string
+		if sourceTable.VersionColumn != "" {
+			quotedVersionColumn := bq.quotedColumnName(sourceTable.VersionColumn)
+			versionCondition = fmt.Sprintf(bigqueryVersionConditionTemplate, quotedVersionColumn, quotedVersionColumn, quotedVersionColumn)
+		}
 		insertFromSelectStatement := fmt.Sprintf(bigqueryMergeTemplate, bq.fullTableName(targetTable.Name), bq.fullTableName(sourceTable.Name),
-			strings.Join(joinConditions, " AND "), strings.Join(updateSet, ", "), columnsString, columnsString)
+			strings.Join(joinConditions, " AND "), versionCondition, strings.Join(updateSet, ", "), columnsString, columnsString)
 
 		query := bq.client.Query(insertFromSelectStatement)
 		_, state, err = bq.RunJob(ctx, query, fmt.Sprintf("copy data from '%s' to '%s'", sourceTable.Name, targetTable.Name))
@@ -265,6 +328,92 @@ func (bq *BigQuery) CopyTables(ctx context.Context, targetTable *Table, sourceTa
 	}
 }
 
+// UpdateColumns updates columns of target table rows matching source table rows by primary key
+func (bq *BigQuery) UpdateColumns(ctx context.Context, targetTable *Table, sourceTable *Table) (state *bulker.WarehouseState, err error) {
+	defer func() {
+		if err != nil {
+			err = errorj.BulkMergeError.Wrap(err, "failed to update columns").
+				WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+					Dataset: bq.config.Dataset,
+					Project: bq.config.Project,
+					Table:   targetTable.Name,
+				})
+		}
+	}()
+	if len(targetTable.PKFields) == 0 {
+		return nil, fmt.Errorf("primary key is required to update columns")
+	}
+	var updateSet, joinConditions []string
+	for _, name := range sourceTable.SortedColumnNames() {
+		if !targetTable.PKFields.Contains(name) {
+			updateSet = append(updateSet, fmt.Sprintf("T.%s = S.%s", bq.quotedColumnName(name), bq.quotedColumnName(name)))
+		}
+	}
+	if len(updateSet) == 0 {
+		return nil, fmt.Errorf("no columns to update besides primary key")
+	}
+	for _, pkField := range targetTable.GetPKFields() {
+		joinConditions = append(joinConditions, fmt.Sprintf("T.%s = S.%s", bq.quotedColumnName(pkField), bq.quotedColumnName(pkField)))
+	}
+	updateStatement := fmt.Sprintf(bigqueryUpdateColumnsTemplate, bq.fullTableName(targetTable.Name), bq.fullTableName(sourceTable.Name),
+		strings.Join(joinConditions, " AND "), strings.Join(updateSet, ", "))
+	query := bq.client.Query(updateStatement)
+	_, state, err = bq.RunJob(ctx, query, fmt.Sprintf("update columns of '%s' from '%s'", targetTable.Name, sourceTable.Name))
+	return state, err
+}
+
+// DeleteByKeys deletes rows of target table matching source table rows by key columns
+func (bq *BigQuery) DeleteByKeys(ctx context.Context, targetTable *Table, sourceTable *Table, keyColumns []string) (state *bulker.WarehouseState, err error) {
+	defer func() {
+		if err != nil {
+			err = errorj.DeleteFromTableError.Wrap(err, "failed to delete rows by keys").
+				WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+					Dataset: bq.config.Dataset,
+					Project: bq.config.Project,
+					Table:   targetTable.Name,
+				})
+		}
+	}()
+	if len(keyColumns) == 0 {
+		return nil, fmt.Errorf("primary key is required to delete rows by keys")
+	}
+	joinConditions := make([]string, len(keyColumns))
+	for i, keyColumn := range keyColumns {
+		joinConditions[i] = fmt.Sprintf("T.%s = S.%s", bq.quotedColumnName(keyColumn), bq.quotedColumnName(keyColumn))
+	}
+	deleteStatement := fmt.Sprintf(bigqueryDeleteByKeysTemplate, bq.fullTableName(targetTable.Name), bq.fullTableName(sourceTable.Name), strings.Join(joinConditions, " AND "))
+	query := bq.client.Query(deleteStatement)
+	_, state, err = bq.RunJob(ctx, query, fmt.Sprintf("delete rows of '%s' by keys from '%s'", targetTable.Name, sourceTable.Name))
+	return state, err
+}
+
+// CloseVersions closes current versions of target table rows matching source table rows by key columns
+func (bq *BigQuery) CloseVersions(ctx context.Context, targetTable *Table, sourceTable *Table, keyColumns []string) (state *bulker.WarehouseState, err error) {
+	defer func() {
+		if err != nil {
+			err = errorj.BulkMergeError.Wrap(err, "failed to close versions of rows").
+				WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+					Dataset: bq.config.Dataset,
+					Project: bq.config.Project,
+					Table:   targetTable.Name,
+				})
+		}
+	}()
+	if len(keyColumns) == 0 {
+		return nil, fmt.Errorf("primary key is required to close versions of rows")
+	}
+	joinConditions := make([]string, 0, len(keyColumns))
+	for _, keyColumn := range keyColumns {
+		joinConditions = append(joinConditions, fmt.Sprintf("T.%s = S.%s", bq.quotedColumnName(keyColumn), bq.quotedColumnName(keyColumn)))
+	}
+	isCurrent, validTo, validFrom := bq.quotedColumnName(SCD2IsCurrentColumn), bq.quotedColumnName(SCD2ValidToColumn), bq.quotedColumnName(SCD2ValidFromColumn)
+	closeStatement := fmt.Sprintf(bigqueryCloseVersionsTemplate, bq.fullTableName(targetTable.Name), bq.fullTableName(sourceTable.Name),
+		strings.Join(joinConditions, " AND "), isCurrent, validTo, validFrom, isCurrent)
+	query := bq.client.Query(closeStatement)
+	_, state, err = bq.RunJob(ctx, query, fmt.Sprintf("close versions of '%s' from '%s'", targetTable.Name, sourceTable.Name))
+	return state, err
+}
+
 func (bq *BigQuery) Ping(ctx context.Context) error {
 	if bq.client == nil {
 		ctx := context.Background()
@@ -363,10 +512,10 @@ func (bq *BigQuery) CreateTable(ctx context.Context, table *Table) (err error) {
 	}
 
 	bqSchema := bigquery.Schema{}
-	for _, columnName := range table.SortedColumnNames() {
+	for _, columnName := range table.CreateColumnNames() {
 		column := table.Columns[columnName]
 		bigQueryType := bigquery.FieldType(strings.ToUpper(column.GetDDLType()))
-		bqSchema = append(bqSchema, &bigquery.FieldSchema{Name: bq.ColumnName(columnName), Type: bigQueryType})
+		bqSchema = append(bqSchema, &bigquery.FieldSchema{Name: bq.ColumnName(columnName), Type: bigQueryType, Description: table.ColumnComments[columnName]})
 	}
 	var tableConstraints *bigquery.TableConstraints
 	var labels map[string]string
@@ -382,12 +531,23 @@ func (bq *BigQuery) CreateTable(ctx context.Context, table *Table) (err error) {
 		}
 	}
 	tableMetaData := bigquery.TableMetadata{Name: tableName, Schema: bqSchema, TableConstraints: tableConstraints, Labels: labels}
-	if table.Partition.Field == "" && table.TimestampColumn != "" {
+	if !table.Temporary {
+		tableMetaData.Description = table.Comment
+	}
+	if table.Partition.Field == "" && len(table.PartitionColumns) > 0 {
+		// partition by column of partitionKey option
+		table = table.Clone()
+		table.Partition.Field = table.PartitionColumns[0]
+		table.Partition.Granularity = DAY
+	} else if table.Partition.Field == "" && table.TimestampColumn != "" {
 		// partition by timestamp column
 		table = table.Clone()
 		table.Partition.Field = table.TimestampColumn
 		table.Partition.Granularity = DAY
 	}
+	if len(table.ClusteringColumns) > 0 && !table.Temporary {
+		tableMetaData.Clustering = &bigquery.Clustering{Fields: table.ClusteringColumns}
+	}
 	if table.Partition.Field != "" && table.Partition.Granularity != ALL {
 		var partitioningType bigquery.TimePartitioningType
 		switch table.Partition.Granularity {
@@ -419,6 +579,11 @@ func (bq *BigQuery) CreateTable(ctx context.Context, table *Table) (err error) {
 	return nil
 }
 
+// SupportsDescriptions BigQuery sets descriptions of tables and columns declared with DescriptionsOption
+func (bq *BigQuery) SupportsDescriptions() bool {
+	return true
+}
+
 // InitDatabase creates google BigQuery Dataset if doesn't exist
 func (bq *BigQuery) InitDatabase(ctx context.Context) error {
 	dataset := bq.config.Dataset
@@ -483,7 +648,7 @@ func (bq *BigQuery) PatchTableSchema(ctx context.Context, patchSchema *Table) er
 	for _, columnName := range patchSchema.SortedColumnNames() {
 		column := patchSchema.Columns[columnName]
 		bigQueryType := bigquery.FieldType(strings.ToUpper(column.GetDDLType()))
-		metadata.Schema = append(metadata.Schema, &bigquery.FieldSchema{Name: bq.ColumnName(columnName), Type: bigQueryType})
+		metadata.Schema = append(metadata.Schema, &bigquery.FieldSchema{Name: bq.ColumnName(columnName), Type: bigQueryType, Description: patchSchema.ColumnComments[columnName]})
 	}
 	updateReq := bigquery.TableMetadataToUpdate{Schema: metadata.Schema}
 	bq.logQuery("PATCH update request: ", updateReq, nil)
@@ -701,11 +866,10 @@ func (bq *BigQuery) ReplaceTable(ctx context.Context, targetTableName string, re
 				})
 		}
 	}()
-	dataset := bq.client.Dataset(bq.config.Dataset)
-	copier := dataset.Table(targetTableName).CopierFrom(dataset.Table(replacementTableName))
-	copier.WriteDisposition = bigquery.WriteTruncate
-	copier.CreateDisposition = bigquery.CreateIfNeeded
-	_, _, err = bq.RunJob(ctx, copier, fmt.Sprintf("replace table '%s' with '%s'", targetTableName, replacementTableName))
+	// zero-copy clone atomically replaces target table, so it is never missing or partially loaded.
+	// Clone keeps data after replacement table is dropped
+	query := fmt.Sprintf(bigqueryReplaceTemplate, bq.fullTableName(targetTableName), bq.fullTableName(replacementTableName))
+	_, _, err = bq.RunJob(ctx, bq.client.Query(query), fmt.Sprintf("replace table '%s' with clone of '%s'", targetTableName, replacementTableName))
 	if err != nil {
 		return err
 	}
@@ -721,7 +885,12 @@ func (bq *BigQuery) TruncateTable(ctx context.Context, tableName string) error {
 	tableName = bq.TableName(tableName)
 	query := fmt.Sprintf(bigqueryTruncateTemplate, bq.fullTableName(tableName))
 	bq.logQuery(query, nil, nil)
-	if _, err := bq.client.Query(query).Read(ctx); err != nil {
+	ctx, cancel := statementContext(ctx, bq.statementTimeout)
+	defer cancel()
+	q := bq.client.Query(query)
+	q.JobTimeout = bq.statementTimeout
+	if _, err := q.Read(ctx); err != nil {
+		err = statementTimeoutError(ctx, bq.statementTimeout, err)
 		extraText := ""
 		if strings.Contains(err.Error(), "Not found") {
 			extraText = ": " + ErrTableNotExist.Error()
@@ -784,6 +953,10 @@ func (bq *BigQuery) logQuery(messageTemplate string, entity any, err error) {
 }
 
 func (bq *BigQuery) Close() error {
+	_ = bq.schemaRouter.Close()
+	if bq.storageWrite != nil {
+		_ = bq.storageWrite.Close()
+	}
 	if bq.client != nil {
 		return bq.client.Close()
 	}
@@ -930,6 +1103,41 @@ func (bq *BigQuery) Count(ctx context.Context, tableName string, whenConditions
 	return strconv.Atoi(fmt.Sprint(res[0]["jitsu_count"]))
 }
 
+func (bq *BigQuery) RunTransform(ctx context.Context, transformSQL string, rawTableName, cleanTableName string) (state *bulker.WarehouseState, err error) {
+	query, err := renderTransformSQL(transformSQL, bq.fullTableName(bq.TableName(rawTableName)), bq.fullTableName(bq.TableName(cleanTableName)))
+	if err != nil {
+		return nil, err
+	}
+	_, state, err = bq.RunJob(ctx, bq.client.Query(query), fmt.Sprintf("transform '%s' to '%s'", rawTableName, cleanTableName))
+	if err != nil {
+		return state, errorj.TransformError.Wrap(err, "failed to run transform").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Dataset:   bq.config.Dataset,
+				Project:   bq.config.Project,
+				Table:     cleanTableName,
+				Statement: query,
+			})
+	}
+	return state, nil
+}
+
+// CloneTable creates BigQuery table snapshot that is automatically deleted at expiration time
+func (bq *BigQuery) CloneTable(ctx context.Context, tableName, cloneName string, expiration time.Time) error {
+	tableName = bq.TableName(tableName)
+	cloneName = bq.TableName(cloneName)
+	query := fmt.Sprintf(bigquerySnapshotTemplate, bq.fullTableName(cloneName), bq.fullTableName(tableName), expiration.UTC().Format("2006-01-02 15:04:05"))
+	if _, _, err := bq.RunJob(ctx, bq.client.Query(query), fmt.Sprintf("create snapshot '%s' of '%s'", cloneName, tableName)); err != nil {
+		return errorj.CopyError.Wrap(err, "failed to create table snapshot").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Dataset:   bq.config.Dataset,
+				Project:   bq.config.Project,
+				Table:     cloneName,
+				Statement: query,
+			})
+	}
+	return nil
+}
+
 func (bq *BigQuery) toWhenConditions(conditions *WhenConditions) (string, []bigquery.QueryParameter) {
 	if conditions == nil {
 		return "", []bigquery.QueryParameter{}
@@ -937,14 +1145,14 @@ func (bq *BigQuery) toWhenConditions(conditions *WhenConditions) (string, []bigq
 	var queryConditions []string
 	var values []bigquery.QueryParameter
 
-	for _, condition := range conditions.Conditions {
+	for i, condition := range conditions.Conditions {
 		switch strings.ToLower(condition.Clause) {
-		case "is null":
-		case "is not null":
+		case "is null", "is not null":
 			queryConditions = append(queryConditions, bq.quotedColumnName(condition.Field)+" "+condition.Clause)
 		default:
-			queryConditions = append(queryConditions, bq.quotedColumnName(condition.Field)+" "+condition.Clause+" @when_"+condition.Field)
-			values = append(values, bigquery.QueryParameter{Name: "when_" + condition.Field, Value: types2.ReformatValue(condition.Value)})
+			paramName := fmt.Sprintf("when_%d", i)
+			queryConditions = append(queryConditions, bq.quotedColumnName(condition.Field)+" "+condition.Clause+" @"+paramName)
+			values = append(values, bigquery.QueryParameter{Name: paramName, Value: types2.ReformatValue(condition.Value)})
 		}
 	}
 
@@ -977,6 +1185,12 @@ func (bq *BigQuery) Delete(ctx context.Context, tableName string, deleteConditio
 	_, _, err = bq.RunJob(ctx, query, fmt.Sprintf("delete from table '%s'", tableName))
 	return err
 }
+
+// SupportsVersionMerge MERGE statement updates only rows with lower version
+func (bq *BigQuery) SupportsVersionMerge() bool {
+	return true
+}
+
 func (bq *BigQuery) Type() string {
 	return BigqueryBulkerTypeId
 }
@@ -1046,6 +1260,17 @@ func (bq *BigQuery) GetAvroType(sqlType string) (any, bool) {
 	return v, ok
 }
 
+// ValidatePartitioning BigQuery tables are partitioned by a single time-unit column and clustered by up to 4 columns
+func (bq *BigQuery) ValidatePartitioning(partitionColumns, clusteringColumns int) error {
+	if partitionColumns > 1 {
+		return fmt.Errorf("%s table may be partitioned by a single column", bq.Type())
+	}
+	if clusteringColumns > 4 {
+		return fmt.Errorf("%s table may be clustered by at most 4 columns", bq.Type())
+	}
+	return nil
+}
+
 func (bq *BigQuery) GetAvroSchema(table *Table) *types2.AvroSchema {
 	schema := types2.AvroSchema{
 		Type: "record",
@@ -1086,6 +1311,11 @@ func (bq *BigQuery) RunJob(ctx context.Context, runner JobRunner, jobDescription
 	}()
 	startTime := time.Now()
 	state = &bulker.WarehouseState{}
+	if q, ok := runner.(*bigquery.Query); ok && q.JobTimeout == 0 {
+		q.JobTimeout = bq.statementTimeout
+	}
+	ctx, cancel := statementContext(ctx, bq.statementTimeout)
+	defer cancel()
 	var status *bigquery.JobStatus
 	var jobID string
 	job, err = runner.Run(ctx)
@@ -1094,6 +1324,9 @@ func (bq *BigQuery) RunJob(ctx context.Context, runner JobRunner, jobDescription
 		status, err = job.Wait(ctx)
 		if err == nil {
 			err = status.Err()
+		} else if errors.Is(ctx.Err(), context.DeadlineExceeded) && bq.statementTimeout > 0 {
+			// context cancellation doesn't stop job on the server side
+			_ = job.Cancel(context.Background())
 		}
 	}
 	bytesProcessed := ""
@@ -1110,7 +1343,7 @@ func (bq *BigQuery) RunJob(ctx context.Context, runner JobRunner, jobDescription
 			}
 			err = errors.New(builder.String())
 		}
-		return job, state, fmt.Errorf("Failed to %s.%s Completed with error: %v%s", jobDescription, jobID, err, bytesProcessed)
+		return job, state, statementTimeoutError(ctx, bq.statementTimeout, fmt.Errorf("Failed to %s.%s Completed with error: %v%s", jobDescription, jobID, err, bytesProcessed))
 	} else {
 		bq.Infof("Successfully %s.%s%s in %.2f s.", jobDescription, jobID, bytesProcessed, time.Since(startTime).Seconds())
 		return job, state, nil
@@ -0,0 +1,331 @@
+package sql
+
+import (
+	"bufio"
+	"bytes"
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/bigquery/storage/apiv1/storagepb"
+	"cloud.google.com/go/bigquery/storage/managedwriter"
+	"cloud.google.com/go/bigquery/storage/managedwriter/adapt"
+	"context"
+	"encoding/json"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	types2 "github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/errorj"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// bqStorageWriteMaxRowsPerAppend and bqStorageWriteMaxBytesPerAppend keep AppendRows requests below 10MB API limit
+	bqStorageWriteMaxRowsPerAppend  = 10000
+	bqStorageWriteMaxBytesPerAppend = 8 * 1024 * 1024
+)
+
+// BigQueryStorageWrite is BigQuery adapter that loads batches with Storage Write API instead of load jobs.
+// Each batch is appended to a separate pending stream that is committed atomically, so batch is written exactly once.
+// Storage Write API isn't subject to daily load jobs quota
+type BigQueryStorageWrite struct {
+	*BigQuery
+}
+
+func newBigQueryStorageWrite(bq *BigQuery) *BigQueryStorageWrite {
+	return &BigQueryStorageWrite{BigQuery: bq}
+}
+
+func (bq *BigQueryStorageWrite) GetBatchFileFormat() types2.FileFormat {
+	return types2.FileFormatNDJSON
+}
+
+func (bq *BigQueryStorageWrite) OpenTx(ctx context.Context) (*TxSQLAdapter, error) {
+	return &TxSQLAdapter{sqlAdapter: bq, tx: NewDummyTxWrapper(bq.Type())}, nil
+}
+
+// LoadTable appends rows of local NDJSON file to a pending write stream and commits it
+func (bq *BigQueryStorageWrite) LoadTable(ctx context.Context, targetTable *Table, loadSource *LoadSource) (state *bulker.WarehouseState, err error) {
+	tableName := bq.TableName(targetTable.Name)
+	defer func() {
+		if err != nil {
+			err = errorj.ExecuteInsertInBatchError.Wrap(err, "failed to write batch with Storage Write API").
+				WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+					Dataset: bq.config.Dataset,
+					Project: bq.config.Project,
+					Table:   tableName,
+				})
+		}
+	}()
+	if loadSource.Type != LocalFile {
+		return state, fmt.Errorf("LoadTable: only local file is supported")
+	}
+	if loadSource.Format != types2.FileFormatNDJSON {
+		return state, fmt.Errorf("LoadTable: only %s format is supported", types2.FileFormatNDJSON)
+	}
+	startTime := time.Now()
+	client, err := bq.storageWriteClient()
+	if err != nil {
+		return state, err
+	}
+	meta, err := bq.client.Dataset(bq.config.Dataset).Table(tableName).Metadata(ctx)
+	if err != nil {
+		return state, fmt.Errorf("failed to get table metadata: %v", err)
+	}
+	messageDescriptor, descriptorProto, err := bqStorageWriteDescriptor(meta.Schema)
+	if err != nil {
+		return state, err
+	}
+	parent := managedwriter.TableParentFromParts(bq.config.Project, bq.config.Dataset, tableName)
+	pendingStream, err := client.CreateWriteStream(ctx, &storagepb.CreateWriteStreamRequest{
+		Parent:      parent,
+		WriteStream: &storagepb.WriteStream{Type: storagepb.WriteStream_PENDING},
+	})
+	if err != nil {
+		return state, fmt.Errorf("failed to create pending stream: %v", err)
+	}
+	managedStream, err := client.NewManagedStream(ctx, managedwriter.WithStreamName(pendingStream.GetName()), managedwriter.WithSchemaDescriptor(descriptorProto))
+	if err != nil {
+		return state, fmt.Errorf("failed to open pending stream: %v", err)
+	}
+	defer func() {
+		_ = managedStream.Close()
+	}()
+
+	file, err := os.Open(loadSource.Path)
+	if err != nil {
+		return state, err
+	}
+	defer file.Close()
+	fieldTypes := make(map[string]bigquery.FieldType, len(meta.Schema))
+	for _, field := range meta.Schema {
+		fieldTypes[field.Name] = field.Type
+	}
+	var offset int64
+	var results []*managedwriter.AppendResult
+	var chunk [][]byte
+	chunkBytes := 0
+	appendChunk := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		result, err := managedStream.AppendRows(ctx, chunk, managedwriter.WithOffset(offset))
+		if err != nil {
+			return fmt.Errorf("failed to append rows: %v", err)
+		}
+		results = append(results, result)
+		offset += int64(len(chunk))
+		chunk = nil
+		chunkBytes = 0
+		return nil
+	}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*100), 1024*1024*10)
+	for scanner.Scan() {
+		row, err := bqStorageWriteRow(messageDescriptor, fieldTypes, scanner.Bytes())
+		if err != nil {
+			return state, err
+		}
+		if len(chunk) >= bqStorageWriteMaxRowsPerAppend || chunkBytes+len(row) > bqStorageWriteMaxBytesPerAppend {
+			if err = appendChunk(); err != nil {
+				return state, err
+			}
+		}
+		chunk = append(chunk, row)
+		chunkBytes += len(row)
+	}
+	if err = scanner.Err(); err != nil {
+		return state, fmt.Errorf("failed to read batch file: %v", err)
+	}
+	if err = appendChunk(); err != nil {
+		return state, err
+	}
+	for _, result := range results {
+		if _, err = result.GetResult(ctx); err != nil {
+			return state, fmt.Errorf("failed to append rows: %v", err)
+		}
+	}
+	if _, err = managedStream.Finalize(ctx); err != nil {
+		return state, fmt.Errorf("failed to finalize pending stream: %v", err)
+	}
+	commitRes, err := client.BatchCommitWriteStreams(ctx, &storagepb.BatchCommitWriteStreamsRequest{
+		Parent:       parent,
+		WriteStreams: []string{managedStream.StreamName()},
+	})
+	if err != nil {
+		return state, fmt.Errorf("failed to commit pending stream: %v", err)
+	}
+	if len(commitRes.GetStreamErrors()) > 0 {
+		return state, fmt.Errorf("failed to commit pending stream: %v", commitRes.GetStreamErrors()[0])
+	}
+	return &bulker.WarehouseState{
+		AdditionalInfo: map[string]any{"storageWriteRows": offset, "loadTimeMs": time.Since(startTime).Milliseconds()},
+	}, nil
+}
+
+// storageWriteClient returns Storage Write API client shared by all streams of destination
+func (bq *BigQuery) storageWriteClient() (*managedwriter.Client, error) {
+	bq.storageWriteOnce.Do(func() {
+		ctx := context.Background()
+		if bq.config.Credentials == nil {
+			bq.storageWrite, bq.storageWriteErr = managedwriter.NewClient(ctx, bq.config.Project)
+		} else {
+			bq.storageWrite, bq.storageWriteErr = managedwriter.NewClient(ctx, bq.config.Project, bq.config.Credentials)
+		}
+		if bq.storageWriteErr != nil {
+			bq.storageWriteErr = fmt.Errorf("error creating BigQuery Storage Write client: %v", bq.storageWriteErr)
+		}
+	})
+	return bq.storageWrite, bq.storageWriteErr
+}
+
+func bqStorageWriteDescriptor(schema bigquery.Schema) (protoreflect.MessageDescriptor, *descriptorpb.DescriptorProto, error) {
+	// JSON columns are written as strings. adapt doesn't support JSON type
+	writeSchema := make(bigquery.Schema, len(schema))
+	for i, field := range schema {
+		writeSchema[i] = field
+		if field.Type == bigquery.JSONFieldType {
+			stringField := *field
+			stringField.Type = bigquery.StringFieldType
+			writeSchema[i] = &stringField
+		}
+	}
+	storageSchema, err := adapt.BQSchemaToStorageTableSchema(writeSchema)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to convert table schema: %v", err)
+	}
+	descriptor, err := adapt.StorageSchemaToProto2Descriptor(storageSchema, "root")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to build proto descriptor: %v", err)
+	}
+	messageDescriptor, ok := descriptor.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, nil, fmt.Errorf("unexpected proto descriptor type: %T", descriptor)
+	}
+	descriptorProto, err := adapt.NormalizeDescriptor(messageDescriptor)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to normalize proto descriptor: %v", err)
+	}
+	return messageDescriptor, descriptorProto, nil
+}
+
+// bqStorageWriteRow converts NDJSON line to serialized proto message
+func bqStorageWriteRow(messageDescriptor protoreflect.MessageDescriptor, fieldTypes map[string]bigquery.FieldType, line []byte) ([]byte, error) {
+	object := map[string]any{}
+	decoder := json.NewDecoder(bytes.NewReader(line))
+	decoder.UseNumber()
+	if err := decoder.Decode(&object); err != nil {
+		return nil, fmt.Errorf("failed to parse batch file line: %v", err)
+	}
+	message := dynamicpb.NewMessage(messageDescriptor)
+	fields := messageDescriptor.Fields()
+	for name, value := range object {
+		if value == nil {
+			continue
+		}
+		field := fields.ByName(protoreflect.Name(name))
+		if field == nil {
+			return nil, fmt.Errorf("field %s is not in table schema", name)
+		}
+		protoValue, err := bqStorageWriteValue(field, fieldTypes[name], value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert value of field %s: %v", name, err)
+		}
+		message.Set(field, protoValue)
+	}
+	return proto.Marshal(message)
+}
+
+func bqStorageWriteValue(field protoreflect.FieldDescriptor, fieldType bigquery.FieldType, value any) (protoreflect.Value, error) {
+	switch field.Kind() {
+	case protoreflect.StringKind:
+		switch v := value.(type) {
+		case string:
+			return protoreflect.ValueOfString(v), nil
+		case json.Number:
+			return protoreflect.ValueOfString(v.String()), nil
+		default:
+			b, err := json.Marshal(v)
+			if err != nil {
+				return protoreflect.Value{}, err
+			}
+			return protoreflect.ValueOfString(string(b)), nil
+		}
+	case protoreflect.Int64Kind:
+		if fieldType == bigquery.TimestampFieldType {
+			t, err := types2.ParseTimestamp(value)
+			if err != nil {
+				return protoreflect.Value{}, err
+			}
+			return protoreflect.ValueOfInt64(t.UnixMicro()), nil
+		}
+		i, err := bqStorageWriteInt(value)
+		return protoreflect.ValueOfInt64(i), err
+	case protoreflect.Int32Kind:
+		if fieldType == bigquery.DateFieldType {
+			s, _ := value.(string)
+			t, err := time.Parse(time.DateOnly, s)
+			if err != nil {
+				return protoreflect.Value{}, err
+			}
+			return protoreflect.ValueOfInt32(int32(t.Unix() / 86400)), nil
+		}
+		i, err := bqStorageWriteInt(value)
+		return protoreflect.ValueOfInt32(int32(i)), err
+	case protoreflect.DoubleKind, protoreflect.FloatKind:
+		var f float64
+		var err error
+		switch v := value.(type) {
+		case json.Number:
+			f, err = v.Float64()
+		case string:
+			f, err = strconv.ParseFloat(v, 64)
+		case float64:
+			f = v
+		default:
+			err = fmt.Errorf("unexpected type %T", value)
+		}
+		if field.Kind() == protoreflect.FloatKind {
+			return protoreflect.ValueOfFloat32(float32(f)), err
+		}
+		return protoreflect.ValueOfFloat64(f), err
+	case protoreflect.BoolKind:
+		switch v := value.(type) {
+		case bool:
+			return protoreflect.ValueOfBool(v), nil
+		case string:
+			b, err := strconv.ParseBool(v)
+			return protoreflect.ValueOfBool(b), err
+		default:
+			return protoreflect.Value{}, fmt.Errorf("unexpected type %T", value)
+		}
+	case protoreflect.BytesKind:
+		s, ok := value.(string)
+		if !ok {
+			return protoreflect.Value{}, fmt.Errorf("unexpected type %T", value)
+		}
+		return protoreflect.ValueOfBytes([]byte(s)), nil
+	default:
+		return protoreflect.Value{}, fmt.Errorf("unsupported field kind %s", field.Kind())
+	}
+}
+
+func bqStorageWriteInt(value any) (int64, error) {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, nil
+		}
+		f, err := v.Float64()
+		return int64(f), err
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	case float64:
+		return int64(v), nil
+	default:
+		return 0, fmt.Errorf("unexpected type %T", value)
+	}
+}
@@ -0,0 +1,62 @@
+package sql
+
+import (
+	"cloud.google.com/go/bigquery"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"testing"
+	"time"
+)
+
+func TestBqStorageWriteRow(t *testing.T) {
+	reqr := require.New(t)
+	schema := bigquery.Schema{
+		{Name: "id", Type: bigquery.IntegerFieldType},
+		{Name: "name", Type: bigquery.StringFieldType},
+		{Name: "price", Type: bigquery.FloatFieldType},
+		{Name: "ok", Type: bigquery.BooleanFieldType},
+		{Name: "ts", Type: bigquery.TimestampFieldType},
+		{Name: "day", Type: bigquery.DateFieldType},
+		{Name: "props", Type: bigquery.JSONFieldType},
+	}
+	fieldTypes := map[string]bigquery.FieldType{}
+	for _, field := range schema {
+		fieldTypes[field.Name] = field.Type
+	}
+	messageDescriptor, descriptorProto, err := bqStorageWriteDescriptor(schema)
+	reqr.NoError(err)
+	reqr.Len(descriptorProto.GetField(), len(schema))
+
+	row, err := bqStorageWriteRow(messageDescriptor, fieldTypes,
+		[]byte(`{"id": 42, "name": "a", "price": 1.5, "ok": true, "ts": "2024-03-01T12:30:15.123Z", "day": "2024-03-02", "props": {"a": 1}}`))
+	reqr.NoError(err)
+	message := dynamicpb.NewMessage(messageDescriptor)
+	reqr.NoError(proto.Unmarshal(row, message))
+	get := func(name string) any {
+		return message.Get(messageDescriptor.Fields().ByName(protoreflect.Name(name))).Interface()
+	}
+	reqr.Equal(int64(42), get("id"))
+	reqr.Equal("a", get("name"))
+	reqr.Equal(1.5, get("price"))
+	reqr.Equal(true, get("ok"))
+	reqr.Equal(time.Date(2024, 3, 1, 12, 30, 15, 123000000, time.UTC).UnixMicro(), get("ts"))
+	reqr.Equal(int32(19784), get("day"))
+	reqr.Equal(`{"a":1}`, get("props"))
+
+	//nulls are skipped
+	row, err = bqStorageWriteRow(messageDescriptor, fieldTypes, []byte(`{"id": "7", "name": null}`))
+	reqr.NoError(err)
+	message = dynamicpb.NewMessage(messageDescriptor)
+	reqr.NoError(proto.Unmarshal(row, message))
+	reqr.Equal(int64(7), get("id"))
+	reqr.False(message.Has(messageDescriptor.Fields().ByName("name")))
+
+	_, err = bqStorageWriteRow(messageDescriptor, fieldTypes, []byte(`{"extra": 1}`))
+	reqr.EqualError(err, "field extra is not in table schema")
+	_, err = bqStorageWriteRow(messageDescriptor, fieldTypes, []byte(`{"ok": 1}`))
+	reqr.ErrorContains(err, "failed to convert value of field ok")
+	_, err = bqStorageWriteRow(messageDescriptor, fieldTypes, []byte(`{"ts": "yesterday"}`))
+	reqr.ErrorContains(err, "failed to convert value of field ts")
+}
@@ -0,0 +1,67 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	types2 "github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/errorj"
+	"google.golang.org/api/googleapi"
+	"net/http"
+	"strings"
+)
+
+// BigQueryStreamingInserts is BigQuery adapter for stream mode that inserts rows with legacy streaming API (insertAll).
+// Streaming inserts are subject to quotas and request size limits. When they are hit stream falls back to batch loading
+type BigQueryStreamingInserts struct {
+	*BigQuery
+}
+
+func newBigQueryStreamingInserts(bq *BigQuery) *BigQueryStreamingInserts {
+	return &BigQueryStreamingInserts{BigQuery: bq}
+}
+
+// Insert inserts objects with streaming API in chunks of bigqueryRowsLimitPerInsertOperation rows. Deduplication is not supported
+func (bq *BigQueryStreamingInserts) Insert(ctx context.Context, table *Table, merge bool, objects ...types2.Object) error {
+	tableName := table.Name
+	inserter := bq.client.Dataset(bq.config.Dataset).Table(tableName).Inserter()
+	bq.logQuery(fmt.Sprintf("Inserting [%d] values to table %s using BigQuery Streaming API: ", len(objects), tableName), objects, nil)
+	for start := 0; start < len(objects); start += bigqueryRowsLimitPerInsertOperation {
+		end := start + bigqueryRowsLimitPerInsertOperation
+		if end > len(objects) {
+			end = len(objects)
+		}
+		items := make([]*BQItem, 0, end-start)
+		for _, object := range objects[start:end] {
+			items = append(items, &BQItem{values: object})
+		}
+		if err := bq.insertItems(ctx, inserter, items); err != nil {
+			return errorj.ExecuteInsertError.Wrap(err, "failed to execute streaming insert").
+				WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+					Dataset: bq.config.Dataset,
+					Project: bq.config.Project,
+					Table:   tableName,
+				})
+		}
+	}
+	return nil
+}
+
+// IsStreamingQuotaError returns true if streaming insert was rejected because of quota, rate limit or request size limit
+func (bq *BigQueryStreamingInserts) IsStreamingQuotaError(err error) bool {
+	cause := errorj.Cause(err)
+	var gerr *googleapi.Error
+	if errors.As(cause, &gerr) {
+		if gerr.Code == http.StatusRequestEntityTooLarge || gerr.Code == http.StatusTooManyRequests {
+			return true
+		}
+		for _, item := range gerr.Errors {
+			if item.Reason == "quotaExceeded" || item.Reason == "rateLimitExceeded" {
+				return true
+			}
+		}
+	}
+	msg := cause.Error()
+	return strings.Contains(msg, "quotaExceeded") || strings.Contains(msg, "rateLimitExceeded") ||
+		strings.Contains(msg, "Request payload size exceeds the limit")
+}
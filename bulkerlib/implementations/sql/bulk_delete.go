@@ -0,0 +1,85 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"strings"
+)
+
+var rowsFilterOperators = utils.NewSet("=", "!=", "<>", "<", "<=", ">", ">=", "is null", "is not null")
+
+// RowsFilter simple column filter of DeleteRows
+type RowsFilter struct {
+	Column string `json:"column"`
+	// Op comparison operator: =, !=, <>, <, <=, >, >=, IS NULL, IS NOT NULL
+	Op    string `json:"op"`
+	Value any    `json:"value,omitempty"`
+}
+
+// UnexpectedRowsCountError number of rows matching filters differs from expected. Nothing was deleted
+type UnexpectedRowsCountError struct {
+	Count    int
+	Expected int
+}
+
+func (e *UnexpectedRowsCountError) Error() string {
+	return fmt.Sprintf("%d rows match filters, expected: %d", e.Count, e.Expected)
+}
+
+// DeleteRows deletes rows of destination table that match all filters. With dryRun matching rows are only counted.
+// If expectedCount is set, rows are deleted only if number of matching rows equals to it. Otherwise, UnexpectedRowsCountError is returned.
+// Rows are counted and deleted in the same transaction. Databases without multi-statement transactions run statements one by one,
+// so rows inserted between count and delete statements aren't detected there.
+// Returns number of matching rows counted before deletion
+func DeleteRows(ctx context.Context, b bulker.Bulker, tableName string, filters []RowsFilter, dryRun bool, expectedCount *int) (count int, err error) {
+	adapter, ok := b.(SQLAdapter)
+	if !ok {
+		return 0, fmt.Errorf("destination doesn't support deleting rows")
+	}
+	if len(filters) == 0 {
+		return 0, errors.New("at least one filter is required")
+	}
+	tableName = adapter.TableName(tableName)
+	conditions := &WhenConditions{JoinCondition: "AND"}
+	for _, filter := range filters {
+		op := strings.ToLower(strings.TrimSpace(filter.Op))
+		if !rowsFilterOperators.Contains(op) {
+			return 0, fmt.Errorf("unsupported filter operator: %s", filter.Op)
+		}
+		if filter.Column == "" {
+			return 0, errors.New("filter column is required")
+		}
+		if filter.Value == nil && op != "is null" && op != "is not null" {
+			return 0, fmt.Errorf("value is required for operator %s of column %s", filter.Op, filter.Column)
+		}
+		conditions.Add(adapter.ColumnName(filter.Column), strings.ToUpper(op), filter.Value)
+	}
+	if dryRun {
+		return adapter.Count(ctx, tableName, conditions)
+	}
+	tx, err := adapter.OpenTx(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+	count, err = tx.Count(ctx, tableName, conditions)
+	if err != nil {
+		return count, err
+	}
+	if expectedCount != nil && count != *expectedCount {
+		return count, &UnexpectedRowsCountError{Count: count, Expected: *expectedCount}
+	}
+	if count == 0 {
+		return count, nil
+	}
+	return count, tx.Delete(ctx, tableName, conditions)
+}
@@ -0,0 +1,96 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// deleteRowsTestAdapter counts and deletes rows in memory. Other methods of SQLAdapter aren't used by DeleteRows
+type deleteRowsTestAdapter struct {
+	bulker.Bulker
+	SQLAdapter
+	count      int
+	conditions *WhenConditions
+	deleted    bool
+}
+
+func (a *deleteRowsTestAdapter) Type() string {
+	return "test"
+}
+
+func (a *deleteRowsTestAdapter) TableName(identifier string) string {
+	return identifier
+}
+
+func (a *deleteRowsTestAdapter) ColumnName(identifier string) string {
+	return identifier
+}
+
+func (a *deleteRowsTestAdapter) OpenTx(ctx context.Context) (*TxSQLAdapter, error) {
+	return &TxSQLAdapter{sqlAdapter: a, tx: NewDummyTxWrapper("test")}, nil
+}
+
+func (a *deleteRowsTestAdapter) Count(ctx context.Context, tableName string, whenConditions *WhenConditions) (int, error) {
+	a.conditions = whenConditions
+	return a.count, nil
+}
+
+func (a *deleteRowsTestAdapter) Delete(ctx context.Context, tableName string, deleteConditions *WhenConditions) error {
+	a.deleted = true
+	return nil
+}
+
+func TestDeleteRows(t *testing.T) {
+	ctx := context.Background()
+	intPtr := func(i int) *int { return &i }
+	tests := []struct {
+		name            string
+		filters         []RowsFilter
+		dryRun          bool
+		expectedCount   *int
+		expectedErr     string
+		expectedDeleted bool
+		expectedClauses []string
+	}{
+		{name: "no filters", expectedErr: "at least one filter is required"},
+		{name: "unsupported operator", filters: []RowsFilter{{Column: "id", Op: "LIKE", Value: "a%"}}, expectedErr: "unsupported filter operator: LIKE"},
+		{name: "injection in operator", filters: []RowsFilter{{Column: "id", Op: "= 1 OR 1 =", Value: 1}}, expectedErr: "unsupported filter operator"},
+		{name: "missing column", filters: []RowsFilter{{Op: "=", Value: 1}}, expectedErr: "filter column is required"},
+		{name: "missing value", filters: []RowsFilter{{Column: "id", Op: ">"}}, expectedErr: "value is required for operator > of column id"},
+		{name: "operators are normalized", filters: []RowsFilter{{Column: "deleted_at", Op: " is null "}, {Column: "id", Op: "<>", Value: 1}},
+			expectedDeleted: true, expectedClauses: []string{"IS NULL", "<>"}},
+		{name: "dry run", filters: []RowsFilter{{Column: "id", Op: "=", Value: 1}}, dryRun: true, expectedClauses: []string{"="}},
+		{name: "expected count matches", filters: []RowsFilter{{Column: "id", Op: ">=", Value: 1}}, expectedCount: intPtr(3),
+			expectedDeleted: true, expectedClauses: []string{">="}},
+		{name: "expected count differs", filters: []RowsFilter{{Column: "id", Op: ">=", Value: 1}}, expectedCount: intPtr(2),
+			expectedErr: "3 rows match filters, expected: 2", expectedClauses: []string{">="}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adapter := &deleteRowsTestAdapter{count: 3}
+			count, err := DeleteRows(ctx, adapter, "events", tt.filters, tt.dryRun, tt.expectedCount)
+			if tt.expectedErr != "" {
+				require.ErrorContains(t, err, tt.expectedErr)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, 3, count)
+			}
+			require.Equal(t, tt.expectedDeleted, adapter.deleted)
+			if tt.expectedClauses != nil {
+				clauses := make([]string, len(adapter.conditions.Conditions))
+				for i, condition := range adapter.conditions.Conditions {
+					clauses[i] = condition.Clause
+				}
+				require.Equal(t, tt.expectedClauses, clauses)
+			}
+		})
+	}
+
+	var unexpected *UnexpectedRowsCountError
+	_, err := DeleteRows(ctx, &deleteRowsTestAdapter{count: 1}, "events", []RowsFilter{{Column: "id", Op: "=", Value: 1}}, false, intPtr(0))
+	require.True(t, errors.As(err, &unexpected))
+	require.Equal(t, UnexpectedRowsCountError{Count: 1, Expected: 0}, *unexpected)
+}
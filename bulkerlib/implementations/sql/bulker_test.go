@@ -27,7 +27,8 @@ var constantTime = timestamp.MustParseTime(time.RFC3339Nano, "2022-08-18T14:17:2
 const forceLeaveResultingTables = false
 
 var allBulkerConfigs = []string{BigqueryBulkerTypeId, RedshiftBulkerTypeId, RedshiftBulkerTypeId + "_serverless", SnowflakeBulkerTypeId, PostgresBulkerTypeId,
-	MySQLBulkerTypeId, ClickHouseBulkerTypeId, ClickHouseBulkerTypeId + "_cluster", ClickHouseBulkerTypeId + "_cluster_noshards"}
+	MySQLBulkerTypeId, ClickHouseBulkerTypeId, ClickHouseBulkerTypeId + "_cluster", ClickHouseBulkerTypeId + "_cluster_noshards",
+	DatabricksBulkerTypeId, TrinoBulkerTypeId, CockroachDBBulkerTypeId, StarRocksBulkerTypeId, DorisBulkerTypeId, GreenplumBulkerTypeId}
 
 var exceptBigquery []string
 
@@ -50,6 +51,8 @@ type ExpectedTable struct {
 
 var postgresContainer *testcontainers2.PostgresContainer
 var mysqlContainer *testcontainers2.MySQLContainer
+var cockroachDBContainer *testcontainers2.CockroachDBContainer
+var starRocksContainer *testcontainers2.StarRocksContainer
 var clickhouseContainer *testcontainers2.ClickHouseContainer
 var clickhouseClusterContainer *clickhouse.ClickHouseClusterContainer
 var clickhouseClusterContainerNoShards *clickhouse_noshards.ClickHouseClusterContainerNoShards
@@ -93,6 +96,54 @@ func init() {
 			allBulkerConfigs = utils.ArrayExcluding(allBulkerConfigs, SnowflakeBulkerTypeId)
 		}
 	}
+	if utils.ArrayContains(allBulkerConfigs, DatabricksBulkerTypeId) {
+		databricksConfig := os.Getenv("BULKER_TEST_DATABRICKS")
+		if databricksConfig != "" {
+			configRegistry[DatabricksBulkerTypeId] = TestConfig{BulkerType: DatabricksBulkerTypeId, Config: databricksConfig}
+		} else {
+			allBulkerConfigs = utils.ArrayExcluding(allBulkerConfigs, DatabricksBulkerTypeId)
+		}
+	}
+
+	// Trino requires catalog with writable connector (e.g. Hive with S3 bucket for staged batches) so it is configured externally
+	if utils.ArrayContains(allBulkerConfigs, TrinoBulkerTypeId) {
+		trinoConfig := os.Getenv("BULKER_TEST_TRINO")
+		if trinoConfig != "" {
+			configRegistry[TrinoBulkerTypeId] = TestConfig{BulkerType: TrinoBulkerTypeId, Config: trinoConfig}
+		} else {
+			allBulkerConfigs = utils.ArrayExcluding(allBulkerConfigs, TrinoBulkerTypeId)
+		}
+	}
+
+	// Doris has no single container image with FE and BE, and BE requires host vm.max_map_count tuning, so it is configured externally
+	if utils.ArrayContains(allBulkerConfigs, DorisBulkerTypeId) {
+		dorisConfig := os.Getenv("BULKER_TEST_DORIS")
+		if dorisConfig != "" {
+			configRegistry[DorisBulkerTypeId] = TestConfig{BulkerType: DorisBulkerTypeId, Config: dorisConfig}
+		} else {
+			allBulkerConfigs = utils.ArrayExcluding(allBulkerConfigs, DorisBulkerTypeId)
+		}
+	}
+
+	// Greenplum segments must reach gpfdist server started by bulker, so cluster with network access to test host is configured externally
+	if utils.ArrayContains(allBulkerConfigs, GreenplumBulkerTypeId) {
+		greenplumConfig := os.Getenv("BULKER_TEST_GREENPLUM")
+		if greenplumConfig != "" {
+			configRegistry[GreenplumBulkerTypeId] = TestConfig{BulkerType: GreenplumBulkerTypeId, Config: greenplumConfig}
+		} else {
+			allBulkerConfigs = utils.ArrayExcluding(allBulkerConfigs, GreenplumBulkerTypeId)
+		}
+	}
+
+	// CockroachDB and StarRocks containers are heavy and slow to start, so they are started only when
+	// BULKER_TEST_COCKROACHDB and BULKER_TEST_STARROCKS environment variables are set, e.g. BULKER_TEST_STARROCKS=1
+	if os.Getenv("BULKER_TEST_COCKROACHDB") == "" {
+		allBulkerConfigs = utils.ArrayExcluding(allBulkerConfigs, CockroachDBBulkerTypeId)
+	}
+	if os.Getenv("BULKER_TEST_STARROCKS") == "" {
+		allBulkerConfigs = utils.ArrayExcluding(allBulkerConfigs, StarRocksBulkerTypeId)
+	}
+
 	var err error
 	if utils.ArrayContains(allBulkerConfigs, PostgresBulkerTypeId) {
 		postgresContainer, err = testcontainers2.NewPostgresContainer(context.Background())
@@ -112,6 +163,23 @@ func init() {
 		}}
 	}
 
+	if utils.ArrayContains(allBulkerConfigs, CockroachDBBulkerTypeId) {
+		cockroachDBContainer, err = testcontainers2.NewCockroachDBContainer(context.Background())
+		if err != nil {
+			panic(err)
+		}
+		configRegistry[CockroachDBBulkerTypeId] = TestConfig{BulkerType: CockroachDBBulkerTypeId, Config: PostgresConfig{
+			DataSourceConfig: DataSourceConfig{
+				Host:       cockroachDBContainer.Host,
+				Port:       cockroachDBContainer.Port,
+				Username:   cockroachDBContainer.Username,
+				Db:         cockroachDBContainer.Database,
+				Schema:     cockroachDBContainer.Schema,
+				Parameters: map[string]string{"sslmode": "disable"},
+			},
+		}}
+	}
+
 	if utils.ArrayContains(allBulkerConfigs, MySQLBulkerTypeId) {
 		mysqlContainer, err = testcontainers2.NewMySQLContainer(context.Background())
 		if err != nil {
@@ -127,6 +195,23 @@ func init() {
 		}}
 	}
 
+	if utils.ArrayContains(allBulkerConfigs, StarRocksBulkerTypeId) {
+		starRocksContainer, err = testcontainers2.NewStarRocksContainer(context.Background())
+		if err != nil {
+			panic(err)
+		}
+		configRegistry[StarRocksBulkerTypeId] = TestConfig{BulkerType: StarRocksBulkerTypeId, Config: StarRocksConfig{
+			DataSourceConfig: DataSourceConfig{
+				Host:     starRocksContainer.Host,
+				Port:     starRocksContainer.Port,
+				Username: starRocksContainer.Username,
+				Db:       starRocksContainer.Database,
+			},
+			HttpPort:       starRocksContainer.HttpPort,
+			ReplicationNum: 1,
+		}}
+	}
+
 	if utils.ArrayContains(allBulkerConfigs, ClickHouseBulkerTypeId) {
 		clickhouseContainer, err = testcontainers2.NewClickhouseContainer(context.Background())
 		if err != nil {
@@ -219,6 +304,10 @@ type bulkerTestConfig struct {
 	ignoreConsumeErrors bool
 	//expected state of stream Complete() call
 	expectedState *bulker.State
+	//expected statistics of columns in state of stream Complete() call. Only listed columns are checked
+	expectedColumnStats map[string]*bulker.ColumnStatistics
+	//expected results of data quality rules in state of stream Complete() call
+	expectedQualityChecks []bulker.QualityCheckResult
 	//schema of the table expected as result of complete test run
 	expectedTable ExpectedTable
 	//control whether to check types of columns fow expectedTable. For test that run against multiple bulker types is required to leave 'false'
@@ -411,6 +500,159 @@ func TestBasics(t *testing.T) {
 				},
 			})},
 		},
+		{
+			name:              "omit_fields",
+			modes:             []bulker.BulkMode{bulker.Batch, bulker.Stream, bulker.ReplaceTable, bulker.ReplacePartition},
+			expectPartitionId: true,
+			dataFile:          "test_data/nested.ndjson",
+			expectedTable: ExpectedTable{
+				Columns: justColumns("_timestamp", "id", "nested_id"),
+			},
+			expectedRowsCount: 2,
+			expectedRows: []map[string]any{
+				{"_timestamp": constantTime, "id": 1, "nested_id": 1},
+				{"_timestamp": constantTime, "id": 1, "nested_id": 1},
+			},
+			expectedErrors: map[string]any{"create_stream_bigquery_stream": BigQueryAutocommitUnsupported},
+			configIds:      allBulkerConfigs,
+			streamOptions:  []bulker.StreamOption{WithOmitFields("nested.name", "nested.extra")},
+		},
+		{
+			name:     "column_stats",
+			modes:    []bulker.BulkMode{bulker.Batch, bulker.ReplaceTable},
+			dataFile: "test_data/simple.ndjson",
+			expectedTable: ExpectedTable{
+				Columns: justColumns("_timestamp", "id", "name", "extra"),
+			},
+			expectedRowsCount: 3,
+			expectedColumnStats: map[string]*bulker.ColumnStatistics{
+				"name":  {Nulls: 0, Min: "test", Max: "test2", DistinctEstimate: 2},
+				"extra": {Nulls: 2, Min: "extra", Max: "extra", DistinctEstimate: 1},
+			},
+			configIds:     utils.ArrayIntersection(allBulkerConfigs, []string{PostgresBulkerTypeId, MySQLBulkerTypeId}),
+			streamOptions: []bulker.StreamOption{bulker.WithCollectColumnStats()},
+		},
+		{
+			name:              "quality_rules_fail",
+			modes:             []bulker.BulkMode{bulker.Batch, bulker.ReplaceTable, bulker.ReplacePartition},
+			expectPartitionId: true,
+			dataFile:          "test_data/simple.ndjson",
+			expectedErrors: map[string]any{
+				"stream_complete": "data quality check failed: nullRate(extra): null rate 0.6667 exceeds 0.5000 (2 of 3 rows)",
+			},
+			configIds:     utils.ArrayIntersection(allBulkerConfigs, []string{PostgresBulkerTypeId, MySQLBulkerTypeId}),
+			streamOptions: []bulker.StreamOption{WithQualityRules(QualityRule{Type: QualityRuleNullRate, Field: "extra", MaxNullRate: 0.5})},
+		},
+		{
+			name:              "quality_rules_warn",
+			modes:             []bulker.BulkMode{bulker.Batch, bulker.ReplaceTable},
+			dataFile:          "test_data/simple.ndjson",
+			expectedRowsCount: 3,
+			expectedQualityChecks: []bulker.QualityCheckResult{
+				{Rule: "acceptedValues", Field: "name", Action: "warn", Message: "1 of 3 rows violate rule. Examples: test2"},
+			},
+			configIds: utils.ArrayIntersection(allBulkerConfigs, []string{PostgresBulkerTypeId, MySQLBulkerTypeId}),
+			streamOptions: []bulker.StreamOption{WithQualityRules(
+				QualityRule{Type: QualityRuleAcceptedValues, Field: "name", Values: []any{"test"}, Action: QualityActionWarn})},
+		},
+		{
+			name:     "transform",
+			modes:    []bulker.BulkMode{bulker.Batch},
+			dataFile: "test_data/simple.ndjson",
+			expectedTable: ExpectedTable{
+				Columns: justColumns("_timestamp", "id", "name", "extra"),
+			},
+			expectedRows: []map[string]any{
+				{"_timestamp": constantTime, "id": 1, "name": "test", "extra": nil},
+				{"_timestamp": constantTime, "id": 2, "name": "test", "extra": nil},
+			},
+			configIds:     utils.ArrayIntersection(allBulkerConfigs, []string{PostgresBulkerTypeId, MySQLBulkerTypeId}),
+			streamOptions: []bulker.StreamOption{WithTransform("DELETE FROM {{.RawTable}} WHERE extra IS NOT NULL", "", 0)},
+		},
+		{
+			name:              "storage_write_api",
+			modes:             []bulker.BulkMode{bulker.Batch, bulker.ReplaceTable, bulker.ReplacePartition},
+			expectPartitionId: true,
+			dataFile:          "test_data/simple.ndjson",
+			expectedTable: ExpectedTable{
+				Columns: justColumns("_timestamp", "id", "name", "extra"),
+			},
+			expectedRows: []map[string]any{
+				{"_timestamp": constantTime, "id": 1, "name": "test", "extra": nil},
+				{"_timestamp": constantTime, "id": 2, "name": "test", "extra": nil},
+				{"_timestamp": constantTime, "id": 3, "name": "test2", "extra": "extra"},
+			},
+			configIds:     utils.ArrayIntersection(allBulkerConfigs, []string{BigqueryBulkerTypeId}),
+			streamOptions: []bulker.StreamOption{bulker.WithOption(&BigQueryStorageWriteOption, true)},
+		},
+		{
+			name:              "string_normalization",
+			modes:             []bulker.BulkMode{bulker.Batch, bulker.Stream, bulker.ReplaceTable, bulker.ReplacePartition},
+			expectPartitionId: true,
+			dataFile:          "test_data/multiline.ndjson",
+			expectedTable: ExpectedTable{
+				Columns: justColumns("_timestamp", "id", "name"),
+			},
+			expectedRows: []map[string]any{
+				{"_timestamp": constantTime, "id": 1, "name": "  test"},
+				{"_timestamp": constantTime, "id": 2, "name": "test  "},
+				{"_timestamp": constantTime, "id": 3, "name": " test2 test3 "},
+			},
+			configIds:     utils.ArrayIntersection(allBulkerConfigs, []string{PostgresBulkerTypeId, MySQLBulkerTypeId}),
+			streamOptions: []bulker.StreamOption{bulker.WithTimestamp("_timestamp"), WithStringNormalization(&StringNormalizationConfig{Newlines: StringPolicyReplace})},
+		},
+	}
+	if utils.ArrayContains(allBulkerConfigs, ClickHouseBulkerTypeId) {
+		//same container with batch files loaded in ndjson_flat format
+		chConfig := configRegistry[ClickHouseBulkerTypeId].(TestConfig).Config.(ClickHouseConfig)
+		chConfig.LoadFormat = types2.FileFormatNDJSONFLAT
+		tests = append(tests, bulkerTestConfig{
+			name:              "ndjson_flat_load",
+			modes:             []bulker.BulkMode{bulker.Batch, bulker.ReplaceTable, bulker.ReplacePartition},
+			expectPartitionId: true,
+			dataFile:          "test_data/nested.ndjson",
+			expectedTable: ExpectedTable{
+				Columns: justColumns("_timestamp", "id", "nested_id", "nested_name", "nested_extra"),
+			},
+			expectedRowsCount: 2,
+			config:            &bulker.Config{Id: ClickHouseBulkerTypeId + "_ndjson_flat", BulkerType: ClickHouseBulkerTypeId, DestinationConfig: chConfig, LogLevel: bulker.Verbose},
+		})
+		//same container with batches sent as native protocol column blocks
+		chNativeConfig := configRegistry[ClickHouseBulkerTypeId].(TestConfig).Config.(ClickHouseConfig)
+		chNativeConfig.NativeInsert = true
+		tests = append(tests, bulkerTestConfig{
+			name:              "native_insert",
+			modes:             []bulker.BulkMode{bulker.Batch, bulker.ReplaceTable, bulker.ReplacePartition},
+			expectPartitionId: true,
+			dataFile:          "test_data/simple.ndjson",
+			expectedTable: ExpectedTable{
+				Columns: justColumns("_timestamp", "id", "name", "extra"),
+			},
+			expectedRows: []map[string]any{
+				{"_timestamp": constantTime, "id": 1, "name": "test", "extra": nil},
+				{"_timestamp": constantTime, "id": 2, "name": "test", "extra": nil},
+				{"_timestamp": constantTime, "id": 3, "name": "test2", "extra": "extra"},
+			},
+			config: &bulker.Config{Id: ClickHouseBulkerTypeId + "_native_insert", BulkerType: ClickHouseBulkerTypeId, DestinationConfig: chNativeConfig, LogLevel: bulker.Verbose},
+		})
+	}
+	if utils.ArrayContains(allBulkerConfigs, PostgresBulkerTypeId) {
+		//pooled connections are reopened every second while events are streamed
+		tests = append(tests, bulkerTestConfig{
+			name:     "conn_max_lifetime",
+			modes:    []bulker.BulkMode{bulker.Stream, bulker.Batch},
+			dataFile: "test_data/simple.ndjson",
+			expectedTable: ExpectedTable{
+				Columns: justColumns("_timestamp", "id", "name", "extra"),
+			},
+			expectedRows: []map[string]any{
+				{"_timestamp": constantTime, "id": 1, "name": "test", "extra": nil},
+				{"_timestamp": constantTime, "id": 2, "name": "test", "extra": nil},
+				{"_timestamp": constantTime, "id": 3, "name": "test2", "extra": "extra"},
+			},
+			config: &bulker.Config{Id: PostgresBulkerTypeId + "_conn_max_lifetime", BulkerType: PostgresBulkerTypeId,
+				DestinationConfig: configRegistry[PostgresBulkerTypeId].(TestConfig).Config, ConnMaxLifetimeSec: 1, LogLevel: bulker.Verbose},
+		})
 	}
 	for _, tt := range tests {
 		tt := tt
@@ -533,6 +775,12 @@ func testStream(t *testing.T, testConfig bulkerTestConfig, mode bulker.BulkMode)
 	if testConfig.expectedState != nil {
 		reqr.Equal(*testConfig.expectedState, state)
 	}
+	for column, expected := range testConfig.expectedColumnStats {
+		reqr.Equal(expected, state.ColumnStats[column], "column stats of %s", column)
+	}
+	if testConfig.expectedQualityChecks != nil {
+		reqr.Equal(testConfig.expectedQualityChecks, state.QualityChecks)
+	}
 	if err != nil {
 		return
 	}
@@ -0,0 +1,183 @@
+package sql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"strings"
+)
+
+const (
+	// DefaultCDCOpField field of event with operation type
+	DefaultCDCOpField = "op"
+
+	// Debezium envelope fields
+	cdcPayloadField = "payload"
+	cdcBeforeField  = "before"
+	cdcAfterField   = "after"
+)
+
+var (
+	// CDCOption - settings of CDC mode: field with operation type and its values.
+	// {"opField": "op", "insertOps": ["c", "r"], "updateOps": ["u"], "deleteOps": ["d"]}
+	// Setting option for destination makes batch consumers of its topics work in CDC mode.
+	CDCOption = bulker.ImplementationOption[*CDCConfig]{
+		Key:       "cdc",
+		ParseFunc: parseCDCConfig,
+	}
+)
+
+// CDCConfig operation types of CDC events. See CDCOption
+type CDCConfig struct {
+	// OpField field of event with operation type. Default: op
+	OpField string `json:"opField,omitempty"`
+	// InsertOps values of OpField for inserts. Default: c, r (Debezium snapshot read), i, insert
+	InsertOps []string `json:"insertOps,omitempty"`
+	// UpdateOps values of OpField for updates. Default: u, update
+	UpdateOps []string `json:"updateOps,omitempty"`
+	// DeleteOps values of OpField for deletes. Default: d, delete
+	DeleteOps []string `json:"deleteOps,omitempty"`
+}
+
+// Validate returns err if invalid
+func (c *CDCConfig) Validate() error {
+	if c.OpField == "" {
+		c.OpField = DefaultCDCOpField
+	}
+	if len(c.InsertOps) == 0 {
+		c.InsertOps = []string{"c", "r", "i", "insert"}
+	}
+	if len(c.UpdateOps) == 0 {
+		c.UpdateOps = []string{"u", "update"}
+	}
+	if len(c.DeleteOps) == 0 {
+		c.DeleteOps = []string{"d", "delete"}
+	}
+	for _, op := range c.DeleteOps {
+		if utils.ArrayContains(c.InsertOps, op) || utils.ArrayContains(c.UpdateOps, op) {
+			return fmt.Errorf("cdc operation %s can't be both delete and insert or update", op)
+		}
+	}
+	return nil
+}
+
+func parseCDCConfig(serialized any) (*CDCConfig, error) {
+	var raw []byte
+	switch v := serialized.(type) {
+	case *CDCConfig:
+		return v, v.Validate()
+	case bool:
+		config := &CDCConfig{}
+		if !v {
+			return nil, nil
+		}
+		return config, config.Validate()
+	case string:
+		raw = []byte(v)
+	default:
+		var err error
+		raw, err = json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value type of cdc option: %T", v)
+		}
+	}
+	config := &CDCConfig{}
+	if err := json.Unmarshal(raw, config); err != nil {
+		return nil, fmt.Errorf("failed to parse cdc config: %v", err)
+	}
+	return config, config.Validate()
+}
+
+// WithCDC sets operation types of events consumed in CDC mode
+func WithCDC(config CDCConfig) bulker.StreamOption {
+	return bulker.WithOption(&CDCOption, &config)
+}
+
+// row returns row of CDC event and true if event is a delete.
+// Debezium envelope (optionally wrapped in 'payload' with 'schema') is unwrapped: row is taken from 'after' or from 'before' for deletes.
+// Plain events are used as rows without operation field
+func (c *CDCConfig) row(object types.Object) (types.Object, bool, error) {
+	event := object
+	if payload, ok := object[cdcPayloadField].(map[string]any); ok {
+		if _, ok = payload[c.OpField]; ok {
+			event = payload
+		}
+	}
+	opValue, ok := event[c.OpField]
+	if !ok {
+		return nil, false, fmt.Errorf("cdc event doesn't contain operation field: %s", c.OpField)
+	}
+	op := strings.ToLower(fmt.Sprint(opValue))
+	deleted := utils.ArrayContains(c.DeleteOps, op)
+	if !deleted && !utils.ArrayContains(c.InsertOps, op) && !utils.ArrayContains(c.UpdateOps, op) {
+		return nil, false, fmt.Errorf("unsupported cdc operation: %s", op)
+	}
+	_, hasBefore := event[cdcBeforeField]
+	_, hasAfter := event[cdcAfterField]
+	if !hasBefore && !hasAfter {
+		row := utils.MapCopy(event)
+		delete(row, c.OpField)
+		return row, deleted, nil
+	}
+	imageField := cdcAfterField
+	if deleted {
+		imageField = cdcBeforeField
+	}
+	image, ok := event[imageField].(map[string]any)
+	if !ok {
+		return nil, false, fmt.Errorf("cdc event with operation %s doesn't contain '%s' row image", op, imageField)
+	}
+	return utils.MapCopy(image), deleted, nil
+}
+
+// CDCStream applies change data capture events: each event carries operation type.
+// Inserts and updates are upserted by primary key, deletes are applied as tombstones (see TombstonesOption),
+// so the latest operation of primary key within batch wins. All operations of batch are applied in a single transaction
+type CDCStream struct {
+	*TransactionalStream
+	cdc *CDCConfig
+}
+
+func newCDCStream(id string, p SQLAdapter, tableName string, streamOptions ...bulker.StreamOption) (bulker.BulkerStream, error) {
+	options := bulker.StreamOptions{}
+	for _, option := range streamOptions {
+		options.Add(option)
+	}
+	if len(bulker.PrimaryKeyOption.Get(&options)) == 0 {
+		return nil, errors.New("WithPrimaryKey is required option for CDCStream")
+	}
+	cdc := CDCOption.Get(&options)
+	if cdc == nil {
+		cdc = &CDCConfig{}
+		_ = cdc.Validate()
+	}
+	streamOptions = append(streamOptions, bulker.WithDeduplicate())
+	if TombstonesOption.Get(&options) == nil {
+		//deletes remove rows unless soft deletes are configured with tombstones option
+		streamOptions = append(streamOptions, WithHardDeletes())
+	}
+	ts, err := newTransactionalStreamOfMode(id, p, tableName, bulker.CDC, streamOptions...)
+	if err != nil {
+		return nil, err
+	}
+	return &CDCStream{TransactionalStream: ts, cdc: cdc}, nil
+}
+
+func (ps *CDCStream) Consume(ctx context.Context, object types.Object) (state bulker.State, processedObject types.Object, err error) {
+	row, deleted, err := ps.cdc.row(object)
+	if err != nil {
+		return ps.state, nil, ps.postConsume(&bulker.RejectedObjectError{Err: err})
+	}
+	if deleted {
+		row[ps.tombstones.Field] = true
+	}
+	return ps.TransactionalStream.Consume(ctx, row)
+}
+
+func (ps *CDCStream) ConsumeBatch(ctx context.Context, objects []types.Object) (state bulker.State, processedObjects []types.Object, err error) {
+	return bulker.ConsumeEach(ctx, ps, objects)
+}
@@ -0,0 +1,95 @@
+package sql
+
+import (
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+)
+
+// TestCDCStream applies Debezium change events on top of loaded table
+func TestCDCStream(t *testing.T) {
+	t.Parallel()
+	configIds := utils.ArrayIntersection(allBulkerConfigs, []string{BigqueryBulkerTypeId, RedshiftBulkerTypeId, SnowflakeBulkerTypeId, PostgresBulkerTypeId, MySQLBulkerTypeId})
+	tests := []bulkerTestConfig{
+		{
+			//delete any table leftovers from previous tests
+			name:      "dummy_test_table_cleanup",
+			tableName: "cdc_test",
+			modes:     []bulker.BulkMode{bulker.Batch},
+			dataFile:  "test_data/empty.ndjson",
+			configIds: configIds,
+		},
+		{
+			name:                "snapshot",
+			tableName:           "cdc_test",
+			modes:               []bulker.BulkMode{bulker.Batch},
+			leaveResultingTable: true,
+			dataFile:            "test_data/partition1.ndjson",
+			expectedRowsCount:   5,
+			streamOptions:       []bulker.StreamOption{bulker.WithPrimaryKey("id"), bulker.WithDeduplicate()},
+			configIds:           configIds,
+		},
+		{
+			name:                "changes",
+			tableName:           "cdc_test",
+			modes:               []bulker.BulkMode{bulker.CDC},
+			leaveResultingTable: true,
+			dataFile:            "test_data/cdc.ndjson",
+			expectedRows: []map[string]any{
+				{"_timestamp": constantTime, "id": 1, "name": "test"},
+				{"_timestamp": constantTime, "id": 3, "name": "test3B"},
+				{"_timestamp": constantTime, "id": 4, "name": "test4"},
+				{"_timestamp": constantTime, "id": 5, "name": "test5"},
+				{"_timestamp": constantTime, "id": 7, "name": "test7"},
+			},
+			streamOptions: []bulker.StreamOption{bulker.WithPrimaryKey("id")},
+			configIds:     configIds,
+		},
+		{
+			name:      "dummy_test_table_cleanup",
+			tableName: "cdc_test",
+			modes:     []bulker.BulkMode{bulker.Batch},
+			dataFile:  "test_data/empty.ndjson",
+			configIds: configIds,
+		},
+	}
+	sequentialGroup := sync.WaitGroup{}
+	sequentialGroup.Add(1)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runTestConfig(t, tt, testStream)
+			sequentialGroup.Done()
+		})
+		sequentialGroup.Wait()
+		sequentialGroup.Add(1)
+	}
+}
+
+func TestCDCRow(t *testing.T) {
+	config, err := parseCDCConfig(true)
+	require.NoError(t, err)
+
+	row, deleted, err := config.row(types.Object{"op": "u", "before": map[string]any{"id": 1, "name": "a"}, "after": map[string]any{"id": 1, "name": "b"}})
+	require.NoError(t, err)
+	require.False(t, deleted)
+	require.Equal(t, types.Object{"id": 1, "name": "b"}, row)
+
+	row, deleted, err = config.row(types.Object{"schema": map[string]any{}, "payload": map[string]any{"op": "d", "before": map[string]any{"id": 1}, "after": nil}})
+	require.NoError(t, err)
+	require.True(t, deleted)
+	require.Equal(t, types.Object{"id": 1}, row)
+
+	//plain event without envelope
+	row, deleted, err = config.row(types.Object{"op": "insert", "id": 2})
+	require.NoError(t, err)
+	require.False(t, deleted)
+	require.Equal(t, types.Object{"id": 2}, row)
+
+	_, _, err = config.row(types.Object{"op": "t"})
+	require.Error(t, err)
+	_, _, err = config.row(types.Object{"id": 2})
+	require.Error(t, err)
+}
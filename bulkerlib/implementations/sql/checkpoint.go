@@ -0,0 +1,232 @@
+package sql
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/errorj"
+	"github.com/jitsucom/bulker/jitsubase/logging"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	jsoniter "github.com/json-iterator/go"
+	"io"
+	"os"
+	"time"
+)
+
+var (
+	// CheckpointsOption - enables Checkpoint method of the stream (see bulker.Checkpointer).
+	// Checkpoint syncs local batch file to disk and returns resume token. Stream re-opened with WithResumeToken after process crash
+	// continues writing the same batch file from the checkpoint. Batch file is kept in uncompressed ndjson format
+	CheckpointsOption = bulker.ImplementationOption[bool]{
+		Key:          "checkpoints",
+		DefaultValue: false,
+		ParseFunc:    utils.ParseBool,
+	}
+
+	// ResumeTokenOption - token returned by Checkpoint of interrupted stream. Set with WithResumeToken
+	ResumeTokenOption = bulker.ImplementationOption[string]{
+		Key: "resumeToken",
+	}
+)
+
+// WithCheckpoints enables Checkpoint method of the stream. See CheckpointsOption
+func WithCheckpoints() bulker.StreamOption {
+	return bulker.WithOption(&CheckpointsOption, true)
+}
+
+// WithResumeToken re-opens stream interrupted after Checkpoint that returned provided token. Enables checkpoints of resumed stream
+func WithResumeToken(token string) bulker.StreamOption {
+	return func(options *bulker.StreamOptions) {
+		ResumeTokenOption.Set(options, token)
+		CheckpointsOption.Set(options, true)
+	}
+}
+
+// resumeToken progress of batch stream at checkpoint
+type resumeToken struct {
+	TableName      string `json:"tableName"`
+	BatchFile      string `json:"batchFile"`
+	Offset         int64  `json:"offset"`
+	EventsInBatch  int    `json:"eventsInBatch"`
+	ProcessedRows  int    `json:"processedRows"`
+	SuccessfulRows int    `json:"successfulRows"`
+	RejectedRows   int    `json:"rejectedRows,omitempty"`
+	// TmpTable and DstTable schemas computed from objects written before checkpoint. Name of tmp table is kept
+	TmpTable *Table `json:"tmpTable,omitempty"`
+	DstTable *Table `json:"dstTable,omitempty"`
+	// Tombstones primary keys of tombstones that are applied on Complete. See TombstonesOption
+	Tombstones map[string]types.Object `json:"tombstones,omitempty"`
+}
+
+func (t *resumeToken) encode() (string, error) {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeResumeToken(encoded string) (*resumeToken, error) {
+	b, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid resume token: %v", err)
+	}
+	token := &resumeToken{}
+	if err = json.Unmarshal(b, token); err != nil {
+		return nil, fmt.Errorf("invalid resume token: %v", err)
+	}
+	return token, nil
+}
+
+// validateCheckpointsOption checks that stream can make its progress durable
+func validateCheckpointsOption(p SQLAdapter, options *bulker.StreamOptions) error {
+	if localBatchFileOption.Get(options) == "" {
+		return fmt.Errorf("%s supports checkpoints only with batch file loading", p.Type())
+	}
+	if InternalBatchFileFormatOption.Get(options) != types.FileFormatNDJSON {
+		return fmt.Errorf("checkpoints require %s internalBatchFileFormat", types.FileFormatNDJSON)
+	}
+	if AggregationOption.Get(options) != nil {
+		return fmt.Errorf("checkpoints are not supported with aggregation: aggregates are kept in memory")
+	}
+	if IntermediateFlushOption.Get(options) != nil {
+		return fmt.Errorf("checkpoints are not supported with intermediateFlush: tmp table isn't durable until commit")
+	}
+	return nil
+}
+
+// Checkpoint syncs batch file to disk and returns token for WithResumeToken option.
+// Objects consumed after checkpoint are discarded when stream is resumed with the token
+func (ps *AbstractTransactionalSQLStream) Checkpoint(ctx context.Context) (string, error) {
+	if !ps.checkpoints {
+		return "", errors.New("checkpoints are not enabled for stream. Use WithCheckpoints option")
+	}
+	if ps.state.Status != bulker.Active {
+		return "", errors.New("stream is not active")
+	}
+	if err := ps.init(ctx); err != nil {
+		return "", err
+	}
+	if err := ps.marshaller.InitSchema(ps.batchFile, nil, nil); err != nil {
+		return "", err
+	}
+	if err := ps.marshaller.Flush(); err != nil {
+		return "", errorj.Decorate(err, "failed to flush marshaller")
+	}
+	if err := ps.batchFile.Sync(); err != nil {
+		return "", errorj.Decorate(err, "failed to sync batch file")
+	}
+	stat, err := ps.batchFile.Stat()
+	if err != nil {
+		return "", errorj.Decorate(err, "failed to get batch file size")
+	}
+	token := &resumeToken{
+		TableName:      ps.tableName,
+		BatchFile:      ps.batchFile.Name(),
+		Offset:         stat.Size(),
+		EventsInBatch:  ps.eventsInBatch,
+		ProcessedRows:  ps.state.ProcessedRows,
+		SuccessfulRows: ps.state.SuccessfulRows,
+		RejectedRows:   ps.state.RejectedRows,
+		TmpTable:       ps.tmpTable,
+		DstTable:       ps.dstTable,
+		Tombstones:     ps.pendingTombstones,
+	}
+	return token.encode()
+}
+
+// resume restores progress of interrupted stream from resume token: batch file is truncated to the checkpoint and appended further
+func (ps *AbstractTransactionalSQLStream) resume(encoded string) error {
+	token, err := decodeResumeToken(encoded)
+	if err != nil {
+		return err
+	}
+	if token.TableName != ps.tableName {
+		return fmt.Errorf("resume token belongs to stream of table %s", token.TableName)
+	}
+	file, err := os.OpenFile(token.BatchFile, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open batch file of resume token: %v", err)
+	}
+	if err = file.Truncate(token.Offset); err == nil {
+		_, err = file.Seek(token.Offset, io.SeekStart)
+	}
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to restore batch file of resume token: %v", err)
+	}
+	if err = ps.initMarshallers(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	ps.batchFile = file
+	ps.batchFileStarted = time.Now()
+	if err = ps.marshaller.InitSchema(ps.batchFile, nil, nil); err != nil {
+		return err
+	}
+	ps.eventsInBatch = token.EventsInBatch
+	ps.state.ProcessedRows = token.ProcessedRows
+	ps.state.SuccessfulRows = token.SuccessfulRows
+	ps.state.RejectedRows = token.RejectedRows
+	ps.tmpTable = token.TmpTable
+	ps.dstTable = token.DstTable
+	if ps.tmpTable != nil && ps.dstTable != nil {
+		//destination table shares columns with tmp table. See adjustTables
+		ps.dstTable.Columns = ps.tmpTable.Columns
+	}
+	if ps.tombstones != nil && token.Tombstones != nil {
+		ps.pendingTombstones = token.Tombstones
+	}
+	if ps.merge {
+		if err = ps.indexBatchFile(); err != nil {
+			return err
+		}
+	}
+	logging.Infof("[%s] Stream resumed from checkpoint with %d events in batch file", ps.id, ps.eventsInBatch)
+	return nil
+}
+
+// indexBatchFile restores line numbers of primary keys of resumed batch file used for deduplication
+func (ps *AbstractTransactionalSQLStream) indexBatchFile() error {
+	file, err := os.Open(ps.batchFile.Name())
+	if err != nil {
+		return fmt.Errorf("failed to open batch file of resume token: %v", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*100), 1024*1024*10)
+	line := 0
+	for scanner.Scan() {
+		obj := types.Object{}
+		dec := jsoniter.NewDecoder(bytes.NewReader(scanner.Bytes()))
+		dec.UseNumber()
+		if err = dec.Decode(&obj); err != nil {
+			return errorj.Decorate(err, "failed to decode json object from batch file")
+		}
+		pk, err := ps.getPKValue(obj)
+		if err != nil {
+			return err
+		}
+		ps.trackBatchFileLine(pk, line, obj)
+		line++
+	}
+	if err = scanner.Err(); err != nil {
+		return errorj.Decorate(err, "failed to read batch file")
+	}
+	//rows consumed before pending tombstones of the same primary key are skipped. See trackTombstone
+	for pk := range ps.pendingTombstones {
+		if line, ok := ps.batchFileLinesByPK[pk]; ok {
+			ps.batchFileSkipLines.Put(line)
+			delete(ps.batchFileLinesByPK, pk)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package sql
+
+import (
+	"context"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// TestCheckpointResume checks that stream re-opened with resume token continues from checkpoint of interrupted stream
+func TestCheckpointResume(t *testing.T) {
+	t.Parallel()
+	tests := []bulkerTestConfig{
+		{
+			name:      "checkpoint_resume",
+			tableName: "checkpoint_resume_test",
+			modes:     []bulker.BulkMode{bulker.Batch},
+			configIds: utils.ArrayIntersection(allBulkerConfigs, []string{PostgresBulkerTypeId, MySQLBulkerTypeId}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runTestConfig(t, tt, testCheckpointResume)
+		})
+	}
+}
+
+func testCheckpointResume(t *testing.T, testConfig bulkerTestConfig, mode bulker.BulkMode) {
+	reqr := require.New(t)
+	blk, err := bulker.CreateBulker(*testConfig.config)
+	reqr.NoError(err)
+	defer func() {
+		_ = blk.Close()
+	}()
+	sqlAdapter, ok := blk.(SQLAdapter)
+	reqr.True(ok)
+	ctx := context.Background()
+	id, tableName := testConfig.getIdAndTableName(mode)
+	reqr.NoError(sqlAdapter.InitDatabase(ctx))
+	_ = sqlAdapter.DropTable(ctx, tableName, true)
+	defer func() {
+		_ = sqlAdapter.DropTable(ctx, tableName, true)
+	}()
+	options := []bulker.StreamOption{bulker.WithPrimaryKey("id"), bulker.WithDeduplicate()}
+
+	stream, err := blk.CreateStream(id, tableName, mode, append(options, WithCheckpoints())...)
+	reqr.NoError(err)
+	for i := 1; i <= 3; i++ {
+		_, _, err = stream.Consume(ctx, types.Object{"id": i, "name": "before_checkpoint"})
+		reqr.NoError(err)
+	}
+	token, err := stream.(bulker.Checkpointer).Checkpoint(ctx)
+	reqr.NoError(err)
+	//objects consumed after checkpoint are lost with interrupted stream
+	_, _, err = stream.Consume(ctx, types.Object{"id": 10, "name": "lost"})
+	reqr.NoError(err)
+
+	resumed, err := blk.CreateStream(id, tableName, mode, append(options, WithResumeToken(token))...)
+	reqr.NoError(err)
+	for i := 3; i <= 5; i++ {
+		_, _, err = resumed.Consume(ctx, types.Object{"id": i, "name": "after_checkpoint"})
+		reqr.NoError(err)
+	}
+	state, err := resumed.Complete(ctx)
+	reqr.NoError(err)
+	reqr.Equal(6, state.SuccessfulRows)
+
+	count, err := sqlAdapter.Count(ctx, tableName, nil)
+	reqr.NoError(err)
+	reqr.Equal(5, count)
+}
+
+func TestResumeToken(t *testing.T) {
+	reqr := require.New(t)
+	token := &resumeToken{
+		TableName:     "events",
+		BatchFile:     "/tmp/bulker_events_1.ndjson",
+		Offset:        100,
+		EventsInBatch: 2,
+		TmpTable:      &Table{Name: "events_tmp", Temporary: true, Columns: Columns{"id": types.SQLColumn{Type: "bigint", DataType: types.INT64}}, PKFields: utils.NewSet("id")},
+		Tombstones:    map[string]types.Object{"1": {"id": "1"}},
+	}
+	encoded, err := token.encode()
+	reqr.NoError(err)
+	decoded, err := decodeResumeToken(encoded)
+	reqr.NoError(err)
+	reqr.Equal(token, decoded)
+
+	_, err = decodeResumeToken("not a token")
+	reqr.Error(err)
+}
@@ -0,0 +1,242 @@
+package sql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultUploadChunkSizeMb  = 256
+	defaultUploadConcurrency  = 4
+	chunkedUploadPrefixSuffix = "_chunks/"
+)
+
+// ChunkedUploadOption - converted batch file is split into chunks of limited size that are uploaded to the stage (S3 or Azure Blob) concurrently
+// and loaded to tmp table with a single COPY over their common prefix or manifest (see ManifestLoadSupport). Cuts flush time of very large batches.
+// Requires adapter that loads all files under prefix: Redshift from S3, Snowflake from S3 or Azure Blob.
+// {"chunkSizeMb": 256, "concurrency": 4}
+var ChunkedUploadOption = bulker.ImplementationOption[*ChunkedUploadConfig]{
+	Key:       "chunkedUpload",
+	ParseFunc: parseChunkedUploadConfig,
+}
+
+// ChunkedUploadConfig size of chunks and number of simultaneous uploads. See ChunkedUploadOption
+type ChunkedUploadConfig struct {
+	// ChunkSizeMb approximate size of chunk file in megabytes (after compression). Default: 256
+	ChunkSizeMb int `json:"chunkSizeMb,omitempty"`
+	// Concurrency number of chunks uploaded simultaneously. Default: 4
+	Concurrency int `json:"concurrency,omitempty"`
+}
+
+// Validate returns err if invalid
+func (c *ChunkedUploadConfig) Validate() error {
+	if c.ChunkSizeMb < 0 || c.Concurrency < 0 {
+		return fmt.Errorf("chunkedUpload parameters must not be negative")
+	}
+	return nil
+}
+
+func (c *ChunkedUploadConfig) chunkSize() int64 {
+	if c.ChunkSizeMb == 0 {
+		return defaultUploadChunkSizeMb * 1024 * 1024
+	}
+	return int64(c.ChunkSizeMb) * 1024 * 1024
+}
+
+func (c *ChunkedUploadConfig) concurrency() int {
+	if c.Concurrency == 0 {
+		return defaultUploadConcurrency
+	}
+	return c.Concurrency
+}
+
+func parseChunkedUploadConfig(serialized any) (*ChunkedUploadConfig, error) {
+	var raw []byte
+	switch v := serialized.(type) {
+	case *ChunkedUploadConfig:
+		return v, v.Validate()
+	case string:
+		raw = []byte(v)
+	default:
+		var err error
+		raw, err = json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value type of chunkedUpload option: %T", v)
+		}
+	}
+	config := &ChunkedUploadConfig{}
+	if err := json.Unmarshal(raw, config); err != nil {
+		return nil, fmt.Errorf("failed to parse chunkedUpload config: %v", err)
+	}
+	return config, config.Validate()
+}
+
+// WithChunkedUpload splits converted batch file into chunks uploaded to the stage concurrently. See ChunkedUploadOption
+func WithChunkedUpload(config ChunkedUploadConfig) bulker.StreamOption {
+	return bulker.WithOption(&ChunkedUploadOption, &config)
+}
+
+// PrefixLoadSupport optional interface for SQLAdapter which LoadTable loads all files of the stage under LoadSource.Path prefix with a single statement
+type PrefixLoadSupport interface {
+	SupportsPrefixLoad(sourceType LoadSourceType) bool
+}
+
+// validateChunkedUploadOption checks that batches of stream are uploaded to the stage that adapter can load by prefix
+func validateChunkedUploadOption(p SQLAdapter, options *bulker.StreamOptions) error {
+	if ChunkedUploadOption.Get(options) == nil {
+		return nil
+	}
+	var sourceType LoadSourceType
+	if s3BatchFileOption.Get(options) != nil {
+		sourceType = AmazonS3
+	} else if azureBlobBatchFileOption.Get(options) != nil {
+		sourceType = AzureBlob
+	} else {
+		return fmt.Errorf("chunkedUpload option requires batch files to be staged in S3 or Azure Blob")
+	}
+	if pl, ok := p.(PrefixLoadSupport); !ok || !pl.SupportsPrefixLoad(sourceType) {
+		return fmt.Errorf("%s doesn't support chunkedUpload from %s", p.Type(), sourceType)
+	}
+	return nil
+}
+
+// chunksPrefix returns stage prefix shared by chunks of converted batch file with provided stage file name
+func chunksPrefix(stageFileName, extension string) string {
+	return strings.TrimSuffix(stageFileName, extension) + chunkedUploadPrefixSuffix
+}
+
+// uploadChunks uploads chunk files under provided prefix of the stage with limited concurrency.
+// Returns names of uploaded objects even if some uploads failed, so they can be deleted
+func (ps *AbstractTransactionalSQLStream) uploadChunks(ctx context.Context, stage batchFileStage, files []*os.File, prefix string, concurrency int) (uploaded []string, err error) {
+	var mx sync.Mutex
+	wg := sync.WaitGroup{}
+	semaphore := make(chan struct{}, concurrency)
+	for _, file := range files {
+		stageName := prefix + path.Base(file.Name())
+		semaphore <- struct{}{}
+		wg.Add(1)
+		go func(localName string) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+			uploadErr := ps.uploadWithRetries(ctx, stage, localName, stageName)
+			mx.Lock()
+			defer mx.Unlock()
+			if uploadErr != nil {
+				if err == nil {
+					err = uploadErr
+				}
+				return
+			}
+			uploaded = append(uploaded, stageName)
+		}(file.Name())
+	}
+	wg.Wait()
+	return uploaded, err
+}
+
+// chunkedMarshaller writes objects as a sequence of chunk files of target format. Next chunk is started when current one reaches chunk size.
+// Every chunk is a complete file with its own header and compression stream, so chunks are loaded independently
+type chunkedMarshaller struct {
+	types.Marshaller
+	newMarshaller func() (types.Marshaller, error)
+	chunkSize     int64
+	// files chunk files. The first one is provided with InitSchema
+	files      []*os.File
+	written    *countingWriter
+	columns    []string
+	avroSchema *types.AvroSchema
+}
+
+func newChunkedMarshaller(chunkSize int64, newMarshaller func() (types.Marshaller, error)) (*chunkedMarshaller, error) {
+	m, err := newMarshaller()
+	if err != nil {
+		return nil, err
+	}
+	return &chunkedMarshaller{Marshaller: m, newMarshaller: newMarshaller, chunkSize: chunkSize}, nil
+}
+
+// InitSchema starts the first chunk. writer must be *os.File
+func (cm *chunkedMarshaller) InitSchema(writer io.Writer, columns []string, avroSchema *types.AvroSchema) error {
+	file, ok := writer.(*os.File)
+	if !ok {
+		return fmt.Errorf("chunks can be written only to files")
+	}
+	cm.columns = columns
+	cm.avroSchema = avroSchema
+	cm.files = []*os.File{file}
+	cm.written = &countingWriter{writer: file}
+	return cm.Marshaller.InitSchema(cm.written, columns, avroSchema)
+}
+
+// Marshal writes objects to the current chunk and starts the next one when chunk size is reached
+func (cm *chunkedMarshaller) Marshal(objects ...types.Object) error {
+	if err := cm.Marshaller.Marshal(objects...); err != nil {
+		return err
+	}
+	if cm.written.n < cm.chunkSize {
+		return nil
+	}
+	if err := cm.Marshaller.Flush(); err != nil {
+		return err
+	}
+	current := cm.files[len(cm.files)-1]
+	next, err := os.CreateTemp(path.Dir(current.Name()), chunkFilePattern(path.Base(cm.files[0].Name()), cm.FileExtension()))
+	if err != nil {
+		return err
+	}
+	cm.files = append(cm.files, next)
+	cm.Marshaller, err = cm.newMarshaller()
+	if err != nil {
+		return err
+	}
+	cm.written = &countingWriter{writer: next}
+	return cm.Marshaller.InitSchema(cm.written, cm.columns, cm.avroSchema)
+}
+
+// Flush finishes the current chunk and syncs all chunk files
+func (cm *chunkedMarshaller) Flush() error {
+	if err := cm.Marshaller.Flush(); err != nil {
+		return err
+	}
+	for _, file := range cm.files {
+		if err := file.Sync(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeFiles removes chunk files except the first one
+func (cm *chunkedMarshaller) removeFiles() {
+	for i := 1; i < len(cm.files); i++ {
+		_ = cm.files[i].Close()
+		_ = os.Remove(cm.files[i].Name())
+	}
+}
+
+// chunkFilePattern returns pattern for os.CreateTemp of next chunk of the first chunk file
+func chunkFilePattern(firstChunkName, extension string) string {
+	return firstChunkName[:len(firstChunkName)-len(extension)] + "_*" + extension
+}
+
+// countingWriter counts bytes written to underlying writer
+type countingWriter struct {
+	writer io.Writer
+	n      int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.writer.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,91 @@
+package sql
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/stretchr/testify/require"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type memoryStage struct {
+	sync.Mutex
+	objects map[string][]byte
+}
+
+func (s *memoryStage) Upload(fileName string, fileReader io.ReadSeeker) error {
+	content, err := io.ReadAll(fileReader)
+	if err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.objects[fileName] = content
+	return nil
+}
+
+func (s *memoryStage) DeleteObject(key string) error {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.objects, key)
+	return nil
+}
+
+func TestChunkedUpload(t *testing.T) {
+	reqr := require.New(t)
+	newMarshaller := func() (types.Marshaller, error) {
+		return types.NewMarshaller(types.FileFormatCSV, types.FileCompressionNONE, types.WithBufferSize(4096))
+	}
+	chunks, err := newChunkedMarshaller(4096, newMarshaller)
+	reqr.NoError(err)
+	first, err := os.CreateTemp("", "chunked_upload_test_*.csv")
+	reqr.NoError(err)
+	defer func() {
+		_ = first.Close()
+		_ = os.Remove(first.Name())
+		chunks.removeFiles()
+	}()
+	reqr.NoError(chunks.InitSchema(first, []string{"id", "name"}, nil))
+	for i := 0; i < 1000; i++ {
+		reqr.NoError(chunks.Marshal(types.Object{"id": i, "name": fmt.Sprintf("name_%d", i)}))
+	}
+	reqr.NoError(chunks.Flush())
+	reqr.Greater(len(chunks.files), 1)
+
+	options := bulker.StreamOptions{}
+	ps := &AbstractTransactionalSQLStream{AbstractSQLStream: &AbstractSQLStream{id: "chunked_upload_test", options: options}}
+	stage := &memoryStage{objects: map[string][]byte{}}
+	prefix := chunksPrefix("folder/"+path.Base(first.Name()), ".csv")
+	reqr.True(strings.HasPrefix(prefix, "folder/chunked_upload_test_"))
+	reqr.True(strings.HasSuffix(prefix, chunkedUploadPrefixSuffix))
+	uploaded, err := ps.uploadChunks(context.Background(), stage, chunks.files, prefix, 3)
+	reqr.NoError(err)
+	reqr.Len(uploaded, len(chunks.files))
+
+	rows := 0
+	for key, content := range stage.objects {
+		reqr.True(strings.HasPrefix(key, prefix))
+		scanner := bufio.NewScanner(strings.NewReader(string(content)))
+		reqr.True(scanner.Scan())
+		//every chunk has its own header
+		reqr.Equal("id,name", scanner.Text())
+		for scanner.Scan() {
+			rows++
+		}
+	}
+	reqr.Equal(1000, rows)
+
+	_, err = parseChunkedUploadConfig(`{"chunkSizeMb": -1}`)
+	reqr.Error(err)
+	config, err := parseChunkedUploadConfig(map[string]any{"concurrency": 8})
+	reqr.NoError(err)
+	reqr.Equal(int64(defaultUploadChunkSizeMb*1024*1024), config.chunkSize())
+	reqr.Equal(8, config.concurrency())
+}
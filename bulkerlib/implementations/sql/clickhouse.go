@@ -4,10 +4,11 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/tls"
 	"database/sql"
 	"errors"
 	"fmt"
-	_ "github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2"
 	"github.com/jitsucom/bulker/bulkerlib"
 	"github.com/jitsucom/bulker/bulkerlib/types"
 	"github.com/jitsucom/bulker/jitsubase/errorj"
@@ -28,6 +29,7 @@ import (
 // TODO: add flag &mutations_sync=2
 func init() {
 	bulkerlib.RegisterBulker(ClickHouseBulkerTypeId, NewClickHouse)
+	bulkerlib.RegisterConfigType(ClickHouseBulkerTypeId, ClickHouseConfig{})
 }
 
 const (
@@ -57,8 +59,9 @@ const (
 	chExchangeTableTemplate = `EXCHANGE TABLES %s AND %s %s`
 	chRenameTableTemplate   = `RENAME TABLE %s TO %s %s`
 
-	chSelectFinalStatement = `SELECT %s FROM %s FINAL %s%s`
-	chLoadStatement        = `INSERT INTO %s (%s) VALUES %s`
+	chSelectFinalStatement  = `SELECT %s FROM %s FINAL %s%s`
+	chLoadStatement         = `INSERT INTO %s (%s) VALUES %s`
+	chNativeInsertStatement = `INSERT INTO %s (%s)`
 
 	chDateFormat = `2006-01-02 15:04:05.000000`
 )
@@ -114,6 +117,9 @@ var (
 		"uuid":                          "00000000-0000-0000-0000-000000000000",
 	}
 	nonLettersCharacters = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+	// chLoadFormats batch file formats supported by LoadTable
+	chLoadFormats = utils.NewSet(types.FileFormatNDJSON, types.FileFormatNDJSONFLAT, types.FileFormatArrow)
 )
 
 type ClickHouseProtocol string
@@ -134,8 +140,16 @@ type ClickHouseConfig struct {
 	Password   string             `mapstructure:"password,omitempty" json:"password,omitempty" yaml:"password,omitempty"`
 	Database   string             `mapstructure:"database,omitempty" json:"database,omitempty" yaml:"database,omitempty"`
 	Cluster    string             `mapstructure:"cluster,omitempty" json:"cluster,omitempty" yaml:"cluster,omitempty"`
-	TLS        map[string]string  `mapstructure:"tls,omitempty" json:"tls,omitempty" yaml:"tls,omitempty"`
 	Engine     *EngineConfig      `mapstructure:"engine,omitempty" json:"engine,omitempty" yaml:"engine,omitempty"`
+	// TLS configuration for secure protocols: CA bundle, client certificate for mutual TLS, SNI
+	TLS *utils.TLSConfig `mapstructure:"tls,omitempty" json:"tls,omitempty" yaml:"tls,omitempty"`
+	// LoadFormat format of batch files loaded to ClickHouse: "ndjson" (default), "ndjson_flat" or "arrow".
+	// "ndjson_flat" rows contain only flattened top level fields and are loaded as JSONEachRow.
+	// Arrow files are typed according to table schema and don't require parsing JSON on load
+	LoadFormat types.FileFormat `mapstructure:"loadFormat,omitempty" json:"loadFormat,omitempty" yaml:"loadFormat,omitempty"`
+	// NativeInsert loads batches with native protocol: rows are sent as typed column blocks instead of single INSERT statement with values.
+	// Faster and preserves values of types like DateTime64 and Decimal exactly. Requires "clickhouse" or "clickhouse-secure" protocol
+	NativeInsert bool `mapstructure:"nativeInsert,omitempty" json:"nativeInsert,omitempty" yaml:"nativeInsert,omitempty"`
 }
 
 // EngineConfig dto for deserialized clickhouse engine config
@@ -178,9 +192,17 @@ func NewClickHouse(bulkerConfig bulkerlib.Config) (bulkerlib.Bulker, error) {
 	if config.Parameters == nil {
 		config.Parameters = map[string]string{}
 	}
+	var tlsConfig *tls.Config
 	if config.Protocol == ClickHouseProtocolSecure || config.Protocol == ClickHouseProtocolHTTPS {
 		config.Parameters["secure"] = "true"
-		utils.MapPutIfAbsent(config.Parameters, "skip_verify", "true")
+		if config.TLS != nil {
+			tlsConfig, err = config.TLS.Build()
+			if err != nil {
+				return nil, fmt.Errorf("invalid tls config: %v", err)
+			}
+		} else {
+			utils.MapPutIfAbsent(config.Parameters, "skip_verify", "true")
+		}
 	}
 	utils.MapPutIfAbsent(config.Parameters, "connection_open_strategy", "round_robin")
 	utils.MapPutIfAbsent(config.Parameters, "mutations_sync", "2")
@@ -189,9 +211,22 @@ func NewClickHouse(bulkerConfig bulkerlib.Config) (bulkerlib.Bulker, error) {
 
 	dbConnectFunction := func(config *ClickHouseConfig) (*sql.DB, error) {
 		dsn := clickhouseDriverConnectionString(config)
-		dataSource, err := sql.Open("clickhouse", dsn)
-		if err != nil {
-			return nil, err
+		var dataSource *sql.DB
+		var err error
+		if tlsConfig != nil {
+			// custom tls.Config can't be passed with DSN
+			var opts *clickhouse.Options
+			opts, err = clickhouse.ParseDSN(dsn)
+			if err != nil {
+				return nil, err
+			}
+			opts.TLS = tlsConfig
+			dataSource = clickhouse.OpenDB(opts)
+		} else {
+			dataSource, err = sql.Open("clickhouse", dsn)
+			if err != nil {
+				return nil, err
+			}
 		}
 
 		if err := chPing(dataSource, httpMode); err != nil {
@@ -216,7 +251,9 @@ func NewClickHouse(bulkerConfig bulkerlib.Config) (bulkerlib.Bulker, error) {
 		queryLogger = logging.NewQueryLogger(bulkerConfig.Id, os.Stderr, os.Stderr)
 	}
 	sqlAdapterBase, err := newSQLAdapterBase(bulkerConfig.Id, ClickHouseBulkerTypeId, config, dbConnectFunction, clickhouseTypes, queryLogger, chTypecastFunc, QuestionMarkParameterPlaceholder, columnDDlFunc, chReformatValue, checkErr)
-	sqlAdapterBase.batchFileFormat = types.FileFormatNDJSON
+	sqlAdapterBase.batchFileFormat = utils.Nvl(config.LoadFormat, types.FileFormatNDJSON)
+	sqlAdapterBase.statementTimeout = time.Duration(bulkerConfig.StatementTimeoutSec) * time.Second
+	sqlAdapterBase.setConnMaxLifetime(time.Duration(bulkerConfig.ConnMaxLifetimeSec) * time.Second)
 
 	c := &ClickHouse{
 		SQLAdapterBase: sqlAdapterBase,
@@ -287,6 +324,11 @@ func (ch *ClickHouse) CreateStream(id, tableName string, mode bulkerlib.BulkMode
 	return nil, fmt.Errorf("unsupported bulk mode: %s", mode)
 }
 
+// ValidatePartitioning ClickHouse tables are partitioned with PARTITION BY and sorted with ORDER BY
+func (ch *ClickHouse) ValidatePartitioning(partitionColumns, clusteringColumns int) error {
+	return nil
+}
+
 func (ch *ClickHouse) Type() string {
 	return ClickHouseBulkerTypeId
 }
@@ -317,7 +359,7 @@ func (ch *ClickHouse) OpenTx(ctx context.Context) (*TxSQLAdapter, error) {
 			return nil, fmt.Errorf("failed to open connection: %v", err)
 		}
 	}
-	return &TxSQLAdapter{sqlAdapter: ch, tx: NewDbWrapper(ch.Type(), db, ch.queryLogger, ch.checkErrFunc, true)}, nil
+	return &TxSQLAdapter{sqlAdapter: ch, tx: NewDbWrapper(ch.Type(), db, ch.queryLogger, ch.checkErrFunc, true).WithStatementTimeout(ch.statementTimeout)}, nil
 }
 
 // InitDatabase create database instance if doesn't exist
@@ -364,7 +406,7 @@ func (ch *ClickHouse) CreateTable(ctx context.Context, table *Table) error {
 	if table.Temporary {
 		table := table.Clone()
 		table.PKFields = utils.NewSet[string]()
-		columns := table.SortedColumnNames()
+		columns := table.CreateColumnNames()
 		columnsDDL := make([]string, len(columns))
 		for i, columnName := range columns {
 			columnsDDL[i] = ch.columnDDL(columnName, table)
@@ -381,9 +423,9 @@ func (ch *ClickHouse) CreateTable(ctx context.Context, table *Table) error {
 		}
 		return nil
 	}
-	columns := table.SortedColumnNames()
+	columns := table.CreateColumnNames()
 	columnsDDL := make([]string, len(columns))
-	for i, columnName := range table.SortedColumnNames() {
+	for i, columnName := range columns {
 		columnsDDL[i] = ch.columnDDL(columnName, table)
 	}
 
@@ -552,8 +594,8 @@ func (ch *ClickHouse) LoadTable(ctx context.Context, targetTable *Table, loadSou
 	if loadSource.Type != LocalFile {
 		return state, fmt.Errorf("LoadTable: only local file is supported")
 	}
-	if loadSource.Format != ch.batchFileFormat {
-		return state, fmt.Errorf("LoadTable: only %s format is supported", ch.batchFileFormat)
+	if !chLoadFormats.Contains(loadSource.Format) {
+		return state, fmt.Errorf("LoadTable: only %s, %s and %s formats are supported", types.FileFormatNDJSON, types.FileFormatNDJSONFLAT, types.FileFormatArrow)
 	}
 	tableName := ch.quotedTableName(targetTable.Name)
 
@@ -582,22 +624,33 @@ func (ch *ClickHouse) LoadTable(ctx context.Context, targetTable *Table, loadSou
 	if err != nil {
 		return state, err
 	}
-	scanner := bufio.NewScanner(file)
-	scanner.Buffer(make([]byte, 1024*100), 1024*1024*10)
-	for scanner.Scan() {
-		object := map[string]any{}
-		decoder := jsoniter.NewDecoder(bytes.NewReader(scanner.Bytes()))
-		decoder.UseNumber()
-		err = decoder.Decode(&object)
-		if err != nil {
+	defer file.Close()
+	var batch *chNativeBatch
+	if ch.config.NativeInsert {
+		copyStatement = fmt.Sprintf(chNativeInsertStatement, tableName, strings.Join(columnNames, ", "))
+		if batch, err = ch.prepareNativeBatch(ctx, copyStatement); err != nil {
 			return state, err
 		}
+		defer batch.abort()
+	}
+	appendRow := func(object types.Object) error {
+		if batch != nil {
+			values := make([]any, len(columns))
+			for i, v := range columns {
+				l, err := convertType(object[v], targetTable.Columns[v])
+				if err != nil {
+					return err
+				}
+				values[i] = l
+			}
+			return batch.append(ctx, values)
+		}
 		placeholdersBuilder.WriteString(",(")
 		for i, v := range columns {
 			column := targetTable.Columns[v]
 			l, err := convertType(object[v], column)
 			if err != nil {
-				return state, err
+				return err
 			}
 			//ch.Infof("%s: %v (%T) was %v", v, l, l, object[v])
 			if i > 0 {
@@ -607,9 +660,36 @@ func (ch *ClickHouse) LoadTable(ctx context.Context, targetTable *Table, loadSou
 			args = append(args, l)
 		}
 		placeholdersBuilder.WriteString(")")
+		return nil
 	}
-	if err = scanner.Err(); err != nil {
-		return state, fmt.Errorf("LoadTable: failed to read file: %v", err)
+	if loadSource.Format == types.FileFormatArrow {
+		if err = types.ReadArrowFile(file, appendRow); err != nil {
+			return state, err
+		}
+	} else {
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 1024*100), 1024*1024*10)
+		for scanner.Scan() {
+			object := map[string]any{}
+			decoder := jsoniter.NewDecoder(bytes.NewReader(scanner.Bytes()))
+			decoder.UseNumber()
+			err = decoder.Decode(&object)
+			if err != nil {
+				return state, err
+			}
+			if err = appendRow(object); err != nil {
+				return state, err
+			}
+		}
+		if err = scanner.Err(); err != nil {
+			return state, fmt.Errorf("LoadTable: failed to read file: %v", err)
+		}
+	}
+	if batch != nil {
+		if err = batch.send(); err != nil {
+			return state, checkErr(err)
+		}
+		return state, nil
 	}
 	if len(args) > 0 {
 		copyStatement = fmt.Sprintf(chLoadStatement, tableName, strings.Join(columnNames, ", "), placeholdersBuilder.String()[1:])
@@ -620,6 +700,53 @@ func (ch *ClickHouse) LoadTable(ctx context.Context, targetTable *Table, loadSou
 	return state, nil
 }
 
+// chNativeBatch rows appended to prepared INSERT statement. With native protocol clickhouse-go driver
+// collects them into typed column blocks and sends them on transaction commit
+type chNativeBatch struct {
+	tx   *sql.Tx
+	stmt *sql.Stmt
+}
+
+// prepareNativeBatch prepares INSERT statement in driver transaction on the connection of current stream transaction
+// so temporary tables of session are visible
+func (ch *ClickHouse) prepareNativeBatch(ctx context.Context, statement string) (*chNativeBatch, error) {
+	txWrapper, ok := ch.txOrDb(ctx).(*TxWrapper)
+	if !ok {
+		return nil, fmt.Errorf("native insert requires connection to ClickHouse")
+	}
+	tx, err := txWrapper.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stmt, err := tx.PrepareContext(ctx, statement)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, checkErr(err)
+	}
+	return &chNativeBatch{tx: tx, stmt: stmt}, nil
+}
+
+func (b *chNativeBatch) append(ctx context.Context, values []any) error {
+	_, err := b.stmt.ExecContext(ctx, values...)
+	return err
+}
+
+// send sends collected column blocks to ClickHouse
+func (b *chNativeBatch) send() error {
+	_ = b.stmt.Close()
+	err := b.tx.Commit()
+	b.tx = nil
+	return err
+}
+
+// abort discards collected rows if batch wasn't sent
+func (b *chNativeBatch) abort() {
+	if b.tx != nil {
+		_ = b.stmt.Close()
+		_ = b.tx.Rollback()
+	}
+}
+
 func (ch *ClickHouse) CopyTables(ctx context.Context, targetTable *Table, sourceTable *Table, mergeWindow int) (state *bulkerlib.WarehouseState, err error) {
 	return state, ch.copy(ctx, targetTable, sourceTable)
 }
@@ -740,6 +867,20 @@ func (ch *ClickHouse) ReplaceTable(ctx context.Context, targetTableName string,
 
 }
 
+// MaintainTable runs OPTIMIZE TABLE ... FINAL on table: merges all parts of table, so ReplacingMergeTree tables get deduplicated
+func (ch *ClickHouse) MaintainTable(ctx context.Context, tableName string, config *MaintenanceConfig) error {
+	tableName = ch.TableName(tableName)
+	quotedTableName := ch.quotedLocalTableName(tableName)
+	var statements []string
+	for _, task := range config.tasksOrDefault(MaintenanceOptimize) {
+		if task != MaintenanceOptimize {
+			return unsupportedMaintenanceTask(ch.Type(), task)
+		}
+		statements = append(statements, fmt.Sprintf("OPTIMIZE TABLE %s%s FINAL", quotedTableName, ch.getOnClusterClause()))
+	}
+	return ch.runMaintenance(ctx, quotedTableName, statements)
+}
+
 // return ON CLUSTER name clause or "" if config.cluster is empty
 func (ch *ClickHouse) getOnClusterClause() string {
 	if ch.config.Cluster == "" {
@@ -951,6 +1092,14 @@ func (chc *ClickHouseConfig) Validate() error {
 		return errors.New("database is required parameter")
 	}
 
+	if chc.LoadFormat != "" && !chLoadFormats.Contains(chc.LoadFormat) {
+		return fmt.Errorf("unsupported loadFormat: %s. Supported values: %s, %s, %s", chc.LoadFormat, types.FileFormatNDJSON, types.FileFormatNDJSONFLAT, types.FileFormatArrow)
+	}
+
+	if chc.NativeInsert && (chc.Protocol == ClickHouseProtocolHTTP || chc.Protocol == ClickHouseProtocolHTTPS) {
+		return fmt.Errorf("nativeInsert is not supported with %s protocol", chc.Protocol)
+	}
+
 	return nil
 }
 
@@ -991,6 +1140,18 @@ func (tsf TableStatementFactory) CreateTableStatement(quotedTableName, tableName
 	pkFields := table.PKFields
 	if config.Engine != nil && len(config.Engine.OrderFields) > 0 {
 		orderByClause = "ORDER BY (" + extractStatement(config.Engine.OrderFields) + ")"
+	} else if len(table.ClusteringColumns) > 0 {
+		// primary key must be a prefix of sorting key
+		orderBy := pkFields.ToSlice()
+		for _, column := range table.ClusteringColumns {
+			if !pkFields.Contains(column) {
+				orderBy = append(orderBy, tsf.ch.quotedColumnName(column))
+			}
+		}
+		orderByClause = "ORDER BY (" + strings.Join(orderBy, ", ") + ")"
+		if len(pkFields) == 0 {
+			baseEngine = "MergeTree"
+		}
 	} else if len(pkFields) > 0 {
 		orderByClause = "ORDER BY (" + strings.Join(pkFields.ToSlice(), ", ") + ")"
 	} else {
@@ -1002,6 +1163,8 @@ func (tsf TableStatementFactory) CreateTableStatement(quotedTableName, tableName
 	}
 	if config.Engine != nil && len(config.Engine.PartitionFields) > 0 {
 		partitionClause = "PARTITION BY (" + extractStatement(config.Engine.PartitionFields) + ")"
+	} else if len(table.PartitionColumns) > 0 {
+		partitionClause = "PARTITION BY (" + strings.Join(utils.ArrayMap(table.PartitionColumns, tsf.ch.quotedColumnName), ", ") + ")"
 	} else if table.TimestampColumn != "" {
 		partitionClause = "PARTITION BY toYYYYMM(`" + table.TimestampColumn + "`)"
 	}
@@ -0,0 +1,39 @@
+package sql
+
+import (
+	"context"
+	"github.com/jitsucom/bulker/jitsubase/appbase"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestClickHouseNativeInsert(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  ClickHouseConfig
+		wantErr string
+	}{
+		{"native", ClickHouseConfig{Hosts: []string{"localhost:9000"}, Database: "db", NativeInsert: true}, ""},
+		{"native_secure", ClickHouseConfig{Hosts: []string{"localhost:9440"}, Database: "db", Protocol: ClickHouseProtocolSecure, NativeInsert: true}, ""},
+		{"http", ClickHouseConfig{Hosts: []string{"localhost:8123"}, Database: "db", Protocol: ClickHouseProtocolHTTP, NativeInsert: true}, "nativeInsert is not supported with http protocol"},
+		{"https", ClickHouseConfig{Hosts: []string{"localhost:8443"}, Database: "db", Protocol: ClickHouseProtocolHTTPS, NativeInsert: true}, "nativeInsert is not supported with https protocol"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tt.wantErr)
+			}
+		})
+	}
+
+	//native batch is prepared on connection of stream transaction only
+	ch := &ClickHouse{SQLAdapterBase: &SQLAdapterBase[ClickHouseConfig]{Service: appbase.NewServiceBase("clickhouse_test"), config: &ClickHouseConfig{NativeInsert: true}}}
+	ctx := context.WithValue(context.Background(), ContextTransactionKey, &statementsRecorder{})
+	_, err := ch.prepareNativeBatch(ctx, "INSERT INTO events (id)")
+	require.EqualError(t, err, "native insert requires connection to ClickHouse")
+	_, err = NewDbWrapper(ClickHouseBulkerTypeId, nil, nil, nil, false).BeginTx(context.Background())
+	require.EqualError(t, err, "clickhouse connection doesn't support transactions")
+}
@@ -0,0 +1,353 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	types2 "github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/errorj"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"github.com/lib/pq"
+	"strings"
+	"text/template"
+)
+
+func init() {
+	bulker.RegisterBulker(CockroachDBBulkerTypeId, NewCockroachDB)
+	bulker.RegisterConfigType(CockroachDBBulkerTypeId, PostgresConfig{})
+}
+
+const (
+	CockroachDBBulkerTypeId = "cockroachdb"
+
+	// hidden 'rowid' column that CockroachDB adds to tables without primary key is excluded
+	crdbTableSchemaQuery      = `SELECT column_name, data_type FROM information_schema.columns WHERE table_schema = $1 AND table_name = $2 AND is_hidden = 'NO'`
+	crdbPrimaryKeyFieldsQuery = `SELECT tco.constraint_name, kcu.column_name
+FROM information_schema.table_constraints tco
+         JOIN information_schema.key_column_usage kcu
+              ON kcu.constraint_name = tco.constraint_name
+                  AND kcu.constraint_schema = tco.constraint_schema
+                  AND kcu.table_name = tco.table_name
+         JOIN information_schema.columns c
+              ON c.table_schema = kcu.table_schema
+                  AND c.table_name = kcu.table_name
+                  AND c.column_name = kcu.column_name
+WHERE tco.constraint_type = 'PRIMARY KEY' AND
+      kcu.table_schema = $1 AND
+      kcu.table_name = $2 AND
+      c.is_hidden = 'NO'
+ORDER BY kcu.ordinal_position`
+	crdbCreateTableTemplate      = `CREATE TABLE %s (%s, CONSTRAINT %s PRIMARY KEY (%s))`
+	crdbChangePrimaryKeyTemplate = `ALTER TABLE %s DROP CONSTRAINT %s, ADD CONSTRAINT %s PRIMARY KEY (%s)`
+
+	// UPSERT uses primary key of the table to resolve conflicts
+	crdbMergeQuery     = `UPSERT INTO {{.TableName}}({{.Columns}}) VALUES ({{.Placeholders}})`
+	crdbBulkMergeQuery = `UPSERT INTO {{.TableTo}}({{.Columns}}) SELECT {{.Columns}} FROM {{.TableFrom}}`
+
+	// crdbRetryableErrorCode serialization failure. CockroachDB returns it when transaction must be retried
+	crdbRetryableErrorCode = "40001"
+	crdbStatementRetries   = 5
+)
+
+var (
+	crdbMergeQueryTemplate, _     = template.New("cockroachdbMergeQuery").Parse(crdbMergeQuery)
+	crdbBulkMergeQueryTemplate, _ = template.New("cockroachdbBulkMergeQuery").Parse(crdbBulkMergeQuery)
+)
+
+// CockroachDB is adapter for CockroachDB. It uses Postgres wire protocol with following differences:
+//
+// - primary key is defined in CREATE TABLE statement and changed with single ALTER TABLE statement,
+// because CockroachDB tables always have primary key (hidden 'rowid' column if not specified);
+//
+// - merge is done with UPSERT statement;
+//
+// - statements executed outside of transaction are retried on serialization failures (SQLSTATE 40001).
+// Transactions failed with serialization failure are rolled back and the whole batch is retried by the caller;
+//
+// - batches are loaded with COPY. IMPORT INTO can't run inside transaction and takes table offline, so it isn't used.
+type CockroachDB struct {
+	*Postgres
+}
+
+// NewCockroachDB returns configured CockroachDB bulker.Bulker instance
+func NewCockroachDB(bulkerConfig bulker.Config) (bulker.Bulker, error) {
+	config := &PostgresConfig{}
+	if err := utils.ParseObject(bulkerConfig.DestinationConfig, config); err != nil {
+		return nil, fmt.Errorf("failed to parse destination config: %v", err)
+	}
+	if config.Port == 0 {
+		config.Port = 26257
+	}
+	bulkerConfig.DestinationConfig = *config
+	postgres, err := NewPostgres(bulkerConfig)
+	if err != nil {
+		return nil, err
+	}
+	c := &CockroachDB{Postgres: postgres.(*Postgres)}
+	c.retryableErrorFunc = crdbRetryableError
+	c.statementRetries = crdbStatementRetries
+	return c, nil
+}
+
+func (c *CockroachDB) CreateStream(id, tableName string, mode bulker.BulkMode, streamOptions ...bulker.StreamOption) (bulker.BulkerStream, error) {
+	streamOptions = append(streamOptions, withLocalBatchFile(fmt.Sprintf("bulker_%s", utils.SanitizeString(id))))
+
+	if err := c.validateOptions(streamOptions); err != nil {
+		return nil, err
+	}
+	switch mode {
+	case bulker.Stream:
+		return newAutoCommitStream(id, c, tableName, streamOptions...)
+	case bulker.Batch:
+		return newTransactionalStream(id, c, tableName, streamOptions...)
+	case bulker.ReplaceTable:
+		return newReplaceTableStream(id, c, tableName, streamOptions...)
+	case bulker.ReplacePartition:
+		return newReplacePartitionStream(id, c, tableName, streamOptions...)
+	case bulker.UpdateColumns:
+		return newUpdateColumnsStream(id, c, tableName, streamOptions...)
+	case bulker.SCD2:
+		return newSCD2Stream(id, c, tableName, streamOptions...)
+	case bulker.CDC:
+		return newCDCStream(id, c, tableName, streamOptions...)
+	}
+	return nil, fmt.Errorf("unsupported bulk mode: %s", mode)
+}
+
+// Type returns CockroachDB type
+func (c *CockroachDB) Type() string {
+	return CockroachDBBulkerTypeId
+}
+
+// SupportsVersionMerge UPSERT statement can't be conditional
+func (c *CockroachDB) SupportsVersionMerge() bool {
+	return false
+}
+
+// SupportsSavepoints CockroachDB supports nested SAVEPOINT statements
+func (c *CockroachDB) SupportsSavepoints() bool {
+	return true
+}
+
+// OpenTx opens underline sql transaction and return wrapped instance
+func (c *CockroachDB) OpenTx(ctx context.Context) (*TxSQLAdapter, error) {
+	return c.openTx(ctx, c)
+}
+
+// GetTableSchema returns table (name,columns with name and types) representation wrapped in Table struct
+func (c *CockroachDB) GetTableSchema(ctx context.Context, tableName string) (*Table, error) {
+	tableName = c.TableName(tableName)
+	table := &Table{Name: tableName, Columns: map[string]types2.SQLColumn{}, PKFields: utils.Set[string]{}}
+	rows, err := c.readTxOrDb(ctx).QueryContext(ctx, crdbTableSchemaQuery, c.config.Schema, tableName)
+	if err != nil {
+		return nil, errorj.GetTableError.Wrap(err, "failed to get table columns").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Schema:    c.config.Schema,
+				Table:     tableName,
+				Statement: crdbTableSchemaQuery,
+				Values:    []any{c.config.Schema, tableName},
+			})
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var columnName, columnType string
+		if err := rows.Scan(&columnName, &columnType); err != nil {
+			return nil, errorj.GetTableError.Wrap(err, "failed to scan result").
+				WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+					Schema:    c.config.Schema,
+					Table:     tableName,
+					Statement: crdbTableSchemaQuery,
+					Values:    []any{c.config.Schema, tableName},
+				})
+		}
+		dt, _ := c.GetDataType(columnType)
+		table.Columns[columnName] = types2.SQLColumn{Type: columnType, DataType: dt}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errorj.GetTableError.Wrap(err, "failed read last row").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Schema:    c.config.Schema,
+				Table:     tableName,
+				Statement: crdbTableSchemaQuery,
+				Values:    []any{c.config.Schema, tableName},
+			})
+	}
+
+	//don't select primary keys of non-existent table
+	if len(table.Columns) == 0 {
+		return table, nil
+	}
+
+	primaryKeyName, pkFields, err := c.getPrimaryKey(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+	table.PKFields = pkFields
+	table.PrimaryKeyName = primaryKeyName
+	return table, nil
+}
+
+// getPrimaryKey returns primary key name and fields. Implicit primary key on hidden 'rowid' column is ignored
+func (c *CockroachDB) getPrimaryKey(ctx context.Context, tableName string) (string, utils.Set[string], error) {
+	primaryKeys := utils.Set[string]{}
+	rows, err := c.readTxOrDb(ctx).QueryContext(ctx, crdbPrimaryKeyFieldsQuery, c.config.Schema, tableName)
+	if err != nil {
+		return "", nil, errorj.GetPrimaryKeysError.Wrap(err, "failed to get primary key").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Schema:    c.config.Schema,
+				Table:     tableName,
+				Statement: crdbPrimaryKeyFieldsQuery,
+				Values:    []any{c.config.Schema, tableName},
+			})
+	}
+	defer rows.Close()
+	var primaryKeyName string
+	for rows.Next() {
+		var constraintName, keyColumn string
+		if err := rows.Scan(&constraintName, &keyColumn); err != nil {
+			return "", nil, errorj.GetPrimaryKeysError.Wrap(err, "failed to scan result").
+				WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+					Schema:    c.config.Schema,
+					Table:     tableName,
+					Statement: crdbPrimaryKeyFieldsQuery,
+					Values:    []any{c.config.Schema, tableName},
+				})
+		}
+		if primaryKeyName == "" {
+			primaryKeyName = constraintName
+		}
+		primaryKeys.Put(keyColumn)
+	}
+	if err := rows.Err(); err != nil {
+		return "", nil, errorj.GetPrimaryKeysError.Wrap(err, "failed read last row").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Schema:    c.config.Schema,
+				Table:     tableName,
+				Statement: crdbPrimaryKeyFieldsQuery,
+				Values:    []any{c.config.Schema, tableName},
+			})
+	}
+	return primaryKeyName, primaryKeys, nil
+}
+
+// CreateTable creates table with primary key defined inline
+func (c *CockroachDB) CreateTable(ctx context.Context, schemaToCreate *Table) error {
+	if len(schemaToCreate.PKFields) == 0 {
+		return c.Postgres.CreateTable(ctx, schemaToCreate)
+	}
+	quotedTableName := c.quotedTable(schemaToCreate)
+	columns := schemaToCreate.CreateColumnNames()
+	columnsDDL := make([]string, len(columns))
+	for i, columnName := range columns {
+		columnsDDL[i] = c.columnDDL(columnName, schemaToCreate)
+	}
+	query := fmt.Sprintf(crdbCreateTableTemplate, quotedTableName, strings.Join(columnsDDL, ", "),
+		schemaToCreate.PrimaryKeyName, strings.Join(c.quotedPKColumns(schemaToCreate), ","))
+
+	if _, err := c.txOrDb(ctx).ExecContext(ctx, query); err != nil {
+		return errorj.CreateTableError.Wrap(err, "failed to create table").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Table:       quotedTableName,
+				PrimaryKeys: schemaToCreate.GetPKFields(),
+				Statement:   query,
+			})
+	}
+	if !schemaToCreate.Temporary && schemaToCreate.TimestampColumn != "" {
+		if err := c.createIndex(ctx, schemaToCreate); err != nil {
+			_ = c.DropTable(ctx, schemaToCreate.Name, true)
+			return fmt.Errorf("failed to create sort key: %v", err)
+		}
+	}
+	return c.createComments(ctx, schemaToCreate)
+}
+
+// PatchTableSchema adds columns and changes primary key.
+// CockroachDB doesn't allow to drop primary key constraint without adding new one in the same statement
+func (c *CockroachDB) PatchTableSchema(ctx context.Context, patchTable *Table) error {
+	if !patchTable.DeletePkFields {
+		// adding primary key to a table with implicit 'rowid' primary key is supported by base implementation
+		return c.Postgres.PatchTableSchema(ctx, patchTable)
+	}
+	quotedTableName := c.quotedTable(patchTable)
+	if len(patchTable.PKFields) == 0 {
+		return errorj.DeletePrimaryKeysError.Wrap(errors.New("CockroachDB doesn't support removing primary key from table"), "failed to delete primary key").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Table: quotedTableName,
+			})
+	}
+	pkTable := patchTable.Clone()
+	pkTable.PKFields = utils.Set[string]{}
+	pkTable.DeletePkFields = false
+	if err := c.Postgres.PatchTableSchema(ctx, pkTable); err != nil {
+		return err
+	}
+	currentPrimaryKeyName, _, err := c.getPrimaryKey(ctx, c.TableName(patchTable.Name))
+	if err != nil {
+		return err
+	}
+	statement := fmt.Sprintf(crdbChangePrimaryKeyTemplate, quotedTableName, currentPrimaryKeyName,
+		patchTable.PrimaryKeyName, strings.Join(c.quotedPKColumns(patchTable), ","))
+	if _, err := c.txOrDb(ctx).ExecContext(ctx, statement); err != nil {
+		return errorj.CreatePrimaryKeysError.Wrap(err, "failed to change primary key").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Table:       quotedTableName,
+				PrimaryKeys: patchTable.GetPKFields(),
+				Statement:   statement,
+			})
+	}
+	return nil
+}
+
+func (c *CockroachDB) Insert(ctx context.Context, table *Table, merge bool, objects ...types2.Object) error {
+	if !merge || len(table.PKFields) == 0 {
+		return c.insert(ctx, table, objects)
+	}
+	return c.insertOrMerge(ctx, table, objects, crdbMergeQueryTemplate)
+}
+
+func (c *CockroachDB) CopyTables(ctx context.Context, targetTable *Table, sourceTable *Table, mergeWindow int) (*bulker.WarehouseState, error) {
+	if mergeWindow <= 0 || len(targetTable.PKFields) == 0 {
+		return nil, c.copy(ctx, targetTable, sourceTable)
+	}
+	return nil, c.copyOrMerge(ctx, targetTable, sourceTable, crdbBulkMergeQueryTemplate, "")
+}
+
+func (c *CockroachDB) ReplaceTable(ctx context.Context, targetTableName string, replacementTable *Table, dropOldTable bool) (err error) {
+	targetTable := replacementTable.Clone()
+	targetTable.Name = targetTableName
+	if targetTable.PrimaryKeyName != "" {
+		targetTable.PrimaryKeyName = BuildConstraintName(targetTableName)
+	}
+	if _, err = c.tableHelper.EnsureTableWithoutCaching(ctx, c, c.ID, targetTable); err != nil {
+		return err
+	}
+	if err = c.TruncateTable(ctx, targetTableName); err != nil {
+		return err
+	}
+	if _, err = c.CopyTables(ctx, targetTable, replacementTable, 0); err != nil {
+		return err
+	}
+	if dropOldTable {
+		return c.DropTable(ctx, replacementTable.Name, true)
+	}
+	return nil
+}
+
+func (c *CockroachDB) quotedPKColumns(table *Table) []string {
+	pkFields := table.GetPKFields()
+	columnNames := make([]string, len(pkFields))
+	for i, column := range pkFields {
+		columnNames[i] = c.quotedColumnName(column)
+	}
+	return columnNames
+}
+
+// crdbRetryableError returns true for serialization failures that CockroachDB asks client to retry
+func crdbRetryableError(err error) bool {
+	var pgErr *pq.Error
+	if errors.As(err, &pgErr) {
+		return string(pgErr.Code) == crdbRetryableErrorCode
+	}
+	return strings.Contains(err.Error(), "restart transaction")
+}
@@ -0,0 +1,148 @@
+package sql
+
+import (
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"time"
+)
+
+// hllPrecision number of bits used for register index: 2^12 registers give ~1.6% standard error
+const hllPrecision = 12
+
+// hyperLogLog approximate distinct values counter
+type hyperLogLog struct {
+	registers []uint8
+}
+
+func newHyperLogLog() *hyperLogLog {
+	return &hyperLogLog{registers: make([]uint8, 1<<hllPrecision)}
+}
+
+func (h *hyperLogLog) add(value any) {
+	hasher := fnv.New64a()
+	_, _ = hasher.Write([]byte(fmt.Sprint(value)))
+	x := mix64(hasher.Sum64())
+	index := x >> (64 - hllPrecision)
+	rank := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1)) + 1)
+	if rank > h.registers[index] {
+		h.registers[index] = rank
+	}
+}
+
+func (h *hyperLogLog) estimate() uint64 {
+	m := float64(len(h.registers))
+	sum := 0.0
+	zeros := 0
+	for _, r := range h.registers {
+		sum += 1 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		// small range correction: linear counting
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(math.Round(estimate))
+}
+
+// mix64 improves distribution of fnv hash bits (splitmix64 finalizer)
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+type columnStatsCollector struct {
+	nonNulls int
+	min      any
+	max      any
+	// incomparable true when column has values of different kinds, e.g. numbers and strings
+	incomparable bool
+	hll          *hyperLogLog
+}
+
+// columnStats collects per-column statistics of rows written to the batch
+type columnStats struct {
+	rows    int
+	columns map[string]*columnStatsCollector
+}
+
+func newColumnStats() *columnStats {
+	return &columnStats{columns: map[string]*columnStatsCollector{}}
+}
+
+func (cs *columnStats) add(object types.Object) {
+	cs.rows++
+	for name, value := range object {
+		if value == nil {
+			continue
+		}
+		c, ok := cs.columns[name]
+		if !ok {
+			c = &columnStatsCollector{hll: newHyperLogLog()}
+			cs.columns[name] = c
+		}
+		c.nonNulls++
+		c.hll.add(value)
+		if c.incomparable {
+			continue
+		}
+		kind := statsKind(value)
+		if kind == "" {
+			continue
+		}
+		if c.min != nil && kind != statsKind(c.min) {
+			c.incomparable = true
+			c.min, c.max = nil, nil
+			continue
+		}
+		if c.min == nil {
+			c.min, c.max = value, value
+			continue
+		}
+		if cmp, _ := compareValues(value, c.min); cmp < 0 {
+			c.min = value
+		}
+		if cmp, _ := compareValues(value, c.max); cmp > 0 {
+			c.max = value
+		}
+	}
+}
+
+func (cs *columnStats) result() map[string]*bulker.ColumnStatistics {
+	res := make(map[string]*bulker.ColumnStatistics, len(cs.columns))
+	for name, c := range cs.columns {
+		res[name] = &bulker.ColumnStatistics{
+			Nulls:            cs.rows - c.nonNulls,
+			Min:              c.min,
+			Max:              c.max,
+			DistinctEstimate: c.hll.estimate(),
+		}
+	}
+	return res
+}
+
+// statsKind returns kind of value for min/max statistics: values of different kinds aren't compared.
+// Returns empty string for values without order, e.g. arrays and objects
+func statsKind(value any) string {
+	switch value.(type) {
+	case string:
+		return "string"
+	case time.Time:
+		return "time"
+	}
+	if _, ok := toFloat(value); ok {
+		return "number"
+	}
+	return ""
+}
@@ -0,0 +1,44 @@
+package sql
+
+import (
+	"encoding/json"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestColumnStats(t *testing.T) {
+	t1 := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	cs := newColumnStats()
+	cs.add(types.Object{"id": int64(2), "price": json.Number("1.5"), "name": "b", "ts": t2, "tags": []any{"a"}, "mixed": "a"})
+	cs.add(types.Object{"id": int64(1), "price": nil, "name": "c", "ts": t1, "mixed": int64(1)})
+	cs.add(types.Object{"id": int64(3), "price": 0.5, "name": "a", "mixed": "b"})
+	cs.add(types.Object{"id": int64(3), "name": "b", "mixed2": int64(1)})
+	cs.add(types.Object{"id": int64(2), "mixed2": "a"})
+
+	require.Equal(t, map[string]*bulker.ColumnStatistics{
+		"id":     {Nulls: 0, Min: int64(1), Max: int64(3), DistinctEstimate: 3},
+		"price":  {Nulls: 3, Min: 0.5, Max: json.Number("1.5"), DistinctEstimate: 2},
+		"name":   {Nulls: 1, Min: "a", Max: "c", DistinctEstimate: 3},
+		"ts":     {Nulls: 3, Min: t1, Max: t2, DistinctEstimate: 2},
+		"tags":   {Nulls: 4, DistinctEstimate: 1},
+		"mixed":  {Nulls: 2, DistinctEstimate: 3},
+		"mixed2": {Nulls: 3, DistinctEstimate: 2},
+	}, cs.result())
+}
+
+func TestHyperLogLog(t *testing.T) {
+	for _, n := range []int{1000, 100_000} {
+		hll := newHyperLogLog()
+		for i := 0; i < n; i++ {
+			hll.add(fmt.Sprintf("user_%d", i))
+			//duplicates don't affect estimate
+			hll.add(fmt.Sprintf("user_%d", i))
+		}
+		require.InEpsilon(t, n, hll.estimate(), 0.05, "distinct values: %d", n)
+	}
+}
@@ -0,0 +1,190 @@
+package sql
+
+import (
+	"encoding/json"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ComputedColumnsOption - columns which values are evaluated per event: {"column": "expression"}.
+// Expression is either a path to nested field: "context.campaign.source" ("$." prefix is optional, array elements are addressed by index: "items.0.id")
+// or a template with paths in double curly braces: "{{context.page.host}}{{context.page.path}}" that is evaluated to string
+var ComputedColumnsOption = bulker.ImplementationOption[map[string]string]{
+	Key:       "computedColumns",
+	ParseFunc: parseComputedColumns,
+}
+
+// WithComputedColumn adds column which value is evaluated per event with expression. See ComputedColumnsOption
+func WithComputedColumn(name, expression string) bulker.StreamOption {
+	return func(options *bulker.StreamOptions) {
+		computed := utils.MapCopy(ComputedColumnsOption.Get(options))
+		if computed == nil {
+			computed = map[string]string{}
+		}
+		computed[name] = expression
+		ComputedColumnsOption.Set(options, computed)
+	}
+}
+
+func parseComputedColumns(serialized any) (map[string]string, error) {
+	switch v := serialized.(type) {
+	case map[string]string:
+		return v, nil
+	case map[string]any:
+		computed := make(map[string]string, len(v))
+		for name, expression := range v {
+			s, ok := expression.(string)
+			if !ok {
+				return nil, fmt.Errorf("failed to parse 'computedColumns' option: expression of column '%s' must be string got: %T", name, expression)
+			}
+			computed[name] = s
+		}
+		return computed, nil
+	case string:
+		computed := map[string]string{}
+		if err := json.Unmarshal([]byte(v), &computed); err != nil {
+			return nil, fmt.Errorf("failed to parse 'computedColumns' option: %v", err)
+		}
+		return computed, nil
+	default:
+		return nil, fmt.Errorf("failed to parse 'computedColumns' option: %v incorrect type: %T expected object", v, v)
+	}
+}
+
+// computedColumn column with compiled expression
+type computedColumn struct {
+	name string
+	// path to field for path expressions
+	path []string
+	// template expressions: literals[i] precedes value of paths[i], the last literal trails the template
+	literals []string
+	paths    [][]string
+}
+
+// compileComputedColumns compiles expressions of ComputedColumnsOption. Columns are sorted by name so evaluation order is stable
+func compileComputedColumns(computed map[string]string) ([]computedColumn, error) {
+	names := make([]string, 0, len(computed))
+	for name := range computed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	columns := make([]computedColumn, 0, len(computed))
+	for _, name := range names {
+		column, err := compileComputedColumn(name, computed[name])
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+func compileComputedColumn(name, expression string) (computedColumn, error) {
+	column := computedColumn{name: name}
+	if name == "" {
+		return column, fmt.Errorf("computed column name is required")
+	}
+	if !strings.Contains(expression, "{{") {
+		path, err := parseFieldPath(expression)
+		if err != nil {
+			return column, fmt.Errorf("computed column '%s': %v", name, err)
+		}
+		column.path = path
+		return column, nil
+	}
+	rest := expression
+	for {
+		start := strings.Index(rest, "{{")
+		if start < 0 {
+			column.literals = append(column.literals, rest)
+			return column, nil
+		}
+		end := strings.Index(rest[start:], "}}")
+		if end < 0 {
+			return column, fmt.Errorf("computed column '%s': unclosed '{{' in expression: %s", name, expression)
+		}
+		path, err := parseFieldPath(rest[start+2 : start+end])
+		if err != nil {
+			return column, fmt.Errorf("computed column '%s': %v", name, err)
+		}
+		column.literals = append(column.literals, rest[:start])
+		column.paths = append(column.paths, path)
+		rest = rest[start+end+2:]
+	}
+}
+
+// parseFieldPath parses dot separated path to nested field with optional "$." prefix
+func parseFieldPath(expression string) ([]string, error) {
+	expression = strings.TrimPrefix(strings.TrimSpace(expression), "$.")
+	if expression == "" {
+		return nil, fmt.Errorf("empty field path")
+	}
+	path := strings.Split(expression, ".")
+	for _, part := range path {
+		if part == "" {
+			return nil, fmt.Errorf("invalid field path: %s", expression)
+		}
+	}
+	return path, nil
+}
+
+// evaluate returns value of computed column for object. nil if path expression points to missing field
+func (cc *computedColumn) evaluate(object types.Object) any {
+	if cc.path != nil {
+		return valueByPath(object, cc.path)
+	}
+	var sb strings.Builder
+	for i, literal := range cc.literals {
+		sb.WriteString(literal)
+		if i < len(cc.paths) {
+			if value := valueByPath(object, cc.paths[i]); value != nil {
+				sb.WriteString(fmt.Sprint(value))
+			}
+		}
+	}
+	return sb.String()
+}
+
+// valueByPath returns value of nested field of object. Elements of arrays are addressed by index
+func valueByPath(object types.Object, path []string) any {
+	var value any = map[string]any(object)
+	for _, part := range path {
+		switch v := value.(type) {
+		case map[string]any:
+			value = v[part]
+		case types.Object:
+			value = v[part]
+		case []any:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil
+			}
+			value = v[i]
+		default:
+			return nil
+		}
+		if value == nil {
+			return nil
+		}
+	}
+	return value
+}
+
+// computeColumns returns copy of object with values of computed columns. Computed values replace fields of object with the same name
+func (ps *AbstractSQLStream) computeColumns(object types.Object) types.Object {
+	copied := utils.MapCopy(object)
+	for i := range ps.computedColumns {
+		column := &ps.computedColumns[i]
+		if value := column.evaluate(object); value != nil {
+			copied[column.name] = value
+		} else {
+			delete(copied, column.name)
+		}
+	}
+	return copied
+}
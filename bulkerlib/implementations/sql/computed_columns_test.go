@@ -0,0 +1,37 @@
+package sql
+
+import (
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestComputedColumns(t *testing.T) {
+	computed, err := parseComputedColumns(`{"utm_source": "$.context.campaign.source", "first_item": "items.0.id", "url": "{{context.page.host}}{{context.page.path}}?ref={{context.referrer}}", "missing": "context.nothing"}`)
+	require.NoError(t, err)
+	columns, err := compileComputedColumns(computed)
+	require.NoError(t, err)
+	ps := &AbstractSQLStream{computedColumns: columns}
+	object := types.Object{
+		"id":      1,
+		"missing": "overridden",
+		"context": map[string]any{
+			"campaign": map[string]any{"source": "google"},
+			"page":     map[string]any{"host": "example.com", "path": "/index"},
+		},
+		"items": []any{map[string]any{"id": "a1"}},
+	}
+	result := ps.computeColumns(object)
+	require.Equal(t, "google", result["utm_source"])
+	require.Equal(t, "a1", result["first_item"])
+	require.Equal(t, "example.com/index?ref=", result["url"])
+	require.NotContains(t, result, "missing")
+	//source object isn't modified
+	require.Equal(t, "overridden", object["missing"])
+	require.NotContains(t, object, "utm_source")
+
+	_, err = compileComputedColumns(map[string]string{"broken": "{{context.page"})
+	require.ErrorContains(t, err, "unclosed")
+	_, err = compileComputedColumns(map[string]string{"empty": "context..page"})
+	require.ErrorContains(t, err, "invalid field path")
+}
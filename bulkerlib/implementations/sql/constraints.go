@@ -0,0 +1,190 @@
+package sql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/errorj"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"hash/fnv"
+	"sort"
+	"strings"
+)
+
+const BulkerManagedIndexPrefix = "bulker_idx_"
+
+// Index secondary index or uniqueness constraint declared with IndexesOption
+type Index struct {
+	// Name of index. Default: bulker_idx_<hash of table name and columns>
+	Name    string   `json:"name,omitempty"`
+	Columns []string `json:"columns"`
+	Unique  bool     `json:"unique,omitempty"`
+}
+
+// IndexName returns configured name of index or name generated from table name and index columns
+func (i Index) IndexName(tableName string) string {
+	if i.Name != "" {
+		return i.Name
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(tableName + "\x00" + strings.Join(i.Columns, "\x00") + fmt.Sprintf("\x00%t", i.Unique)))
+	return fmt.Sprintf("%s%x", BulkerManagedIndexPrefix, h.Sum64())
+}
+
+// constraintsDialect statements used by SQLAdapterBase to create indexes and NOT NULL constraints declared in stream options
+type constraintsDialect struct {
+	// indexStatement returns statement that creates index
+	indexStatement func(quotedTableName, indexName string, unique bool, quotedColumns []string) string
+	// notNullStatement returns statement that adds NOT NULL constraint to existing column
+	notNullStatement func(quotedTableName, quotedColumnName string, column types.SQLColumn) string
+	// alreadyExists returns true if statement failed because constraint already exists. Optional
+	alreadyExists func(err error) bool
+}
+
+// ConstraintsSupport optional interface for SQLAdapter that can create secondary indexes, uniqueness and NOT NULL constraints
+// declared with IndexesOption and NotNullOption
+type ConstraintsSupport interface {
+	SupportsConstraints() bool
+}
+
+// SupportsConstraints returns true if adapter can create indexes and NOT NULL constraints
+func (b *SQLAdapterBase[T]) SupportsConstraints() bool {
+	return b.constraints != nil
+}
+
+// createConstraints creates indexes and NOT NULL constraints of table
+func (b *SQLAdapterBase[T]) createConstraints(ctx context.Context, table *Table) error {
+	if b.constraints == nil || table.Temporary || (len(table.Indexes) == 0 && len(table.NotNullColumns) == 0) {
+		return nil
+	}
+	quotedTableName := b.quotedTableName(table.Name)
+	statements := make([]string, 0, len(table.NotNullColumns)+len(table.Indexes))
+	notNullColumns := utils.MapToSlice(table.NotNullColumns, func(name string, _ types.SQLColumn) string { return name })
+	sort.Strings(notNullColumns)
+	for _, columnName := range notNullColumns {
+		statements = append(statements, b.constraints.notNullStatement(quotedTableName, b.quotedColumnName(columnName), table.NotNullColumns[columnName]))
+	}
+	for _, index := range table.Indexes {
+		quotedColumns := utils.ArrayMap(index.Columns, b.quotedColumnName)
+		quotedIndexName, _ := b.tableHelper.adaptColumnName(index.IndexName(table.Name))
+		statements = append(statements, b.constraints.indexStatement(quotedTableName, quotedIndexName, index.Unique, quotedColumns))
+	}
+	for _, statement := range statements {
+		if _, err := b.txOrDb(ctx).ExecContext(ctx, statement); err != nil {
+			if b.constraints.alreadyExists != nil && b.constraints.alreadyExists(err) {
+				continue
+			}
+			return errorj.AlterTableError.Wrap(err, "failed to create constraint").
+				WithProperty(errorj.DBInfo, &types.ErrorPayload{
+					Table:     quotedTableName,
+					Statement: statement,
+				})
+		}
+	}
+	return nil
+}
+
+// constraintsDiff adds to diff indexes and NOT NULL columns of another table that are missing in current table.
+// Constraints on columns that don't exist in any of tables are skipped
+func (t *Table) constraintsDiff(another *Table, diff *Table) {
+	hasColumn := func(name string) bool {
+		_, ok := t.Columns[name]
+		if !ok {
+			_, ok = another.Columns[name]
+		}
+		return ok
+	}
+	existingIndexes := utils.NewSet[string]()
+	for _, index := range t.Indexes {
+		existingIndexes.Put(index.IndexName(t.Name))
+	}
+	for _, index := range another.Indexes {
+		if existingIndexes.Contains(index.IndexName(t.Name)) {
+			continue
+		}
+		allColumns := true
+		for _, column := range index.Columns {
+			allColumns = allColumns && hasColumn(column)
+		}
+		if allColumns {
+			diff.Indexes = append(diff.Indexes, index)
+		}
+	}
+	for name := range another.NotNullColumns {
+		if _, ok := t.NotNullColumns[name]; ok {
+			continue
+		}
+		column, ok := t.Columns[name]
+		if !ok {
+			column, ok = another.Columns[name]
+		}
+		if ok {
+			if diff.NotNullColumns == nil {
+				diff.NotNullColumns = Columns{}
+			}
+			diff.NotNullColumns[name] = column
+		}
+	}
+}
+
+// WithIndexes creates and maintains secondary indexes and uniqueness constraints on destination table.
+// Supported only by adapters implementing ConstraintsSupport
+func WithIndexes(indexes ...Index) bulker.StreamOption {
+	return bulker.WithOption(&IndexesOption, indexes)
+}
+
+// WithNotNull adds NOT NULL constraint to provided columns of destination table.
+// Supported only by adapters implementing ConstraintsSupport
+func WithNotNull(columns ...string) bulker.StreamOption {
+	return bulker.WithOption(&NotNullOption, columns)
+}
+
+func parseIndexes(serialized any) ([]Index, error) {
+	var raw []byte
+	switch v := serialized.(type) {
+	case []Index:
+		return v, validateIndexes(v)
+	case string:
+		raw = []byte(v)
+	default:
+		var err error
+		raw, err = json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value type of indexes option: %T", v)
+		}
+	}
+	var indexes []Index
+	if err := json.Unmarshal(raw, &indexes); err != nil {
+		return nil, fmt.Errorf("failed to parse indexes option: %v", err)
+	}
+	return indexes, validateIndexes(indexes)
+}
+
+func validateIndexes(indexes []Index) error {
+	names := utils.NewSet[string]()
+	for i, index := range indexes {
+		if len(index.Columns) == 0 {
+			return fmt.Errorf("index #%d: columns are required", i)
+		}
+		if index.Name != "" {
+			if names.Contains(index.Name) {
+				return fmt.Errorf("index #%d: duplicate index name: %s", i, index.Name)
+			}
+			names.Put(index.Name)
+		}
+	}
+	return nil
+}
+
+// validateConstraintsOptions returns error if constraints options are set but adapter doesn't support them
+func validateConstraintsOptions(p SQLAdapter, options *bulker.StreamOptions) error {
+	if len(IndexesOption.Get(options)) == 0 && len(NotNullOption.Get(options)) == 0 {
+		return nil
+	}
+	if cs, ok := p.(ConstraintsSupport); ok && cs.SupportsConstraints() {
+		return nil
+	}
+	return fmt.Errorf("'%s' and '%s' options are not supported by %s", IndexesOption.Key, NotNullOption.Key, p.Type())
+}
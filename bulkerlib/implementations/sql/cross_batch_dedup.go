@@ -0,0 +1,250 @@
+package sql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/errorj"
+	"github.com/jitsucom/bulker/jitsubase/logging"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"sort"
+	"time"
+)
+
+const (
+	// DedupIdsTable destination metadata table where ids of events loaded by streams with CrossBatchDedupOption are recorded
+	DedupIdsTable = "_bulker_dedup_ids"
+
+	dedupIdColumn        = "id"
+	dedupTableNameColumn = "table_name"
+	dedupLoadedAtColumn  = "loaded_at"
+
+	// dedupIdsChunkSize number of ids looked up or recorded with a single statement
+	dedupIdsChunkSize = 500
+
+	defaultCrossBatchDedupColumn      = "message_id"
+	defaultCrossBatchDedupWindowHours = 24
+)
+
+// CrossBatchDedupOption - events which ids were already loaded to the destination table within the window are skipped,
+// so redelivered messages don't produce duplicates in append (non-merge) streams without paying for MERGE.
+// Ids of loaded events are recorded in compact DedupIdsTable in the same transaction as loaded data.
+// {"column": "message_id", "windowHours": 24}
+var CrossBatchDedupOption = bulker.ImplementationOption[*CrossBatchDedupConfig]{
+	Key:       "crossBatchDedup",
+	ParseFunc: parseCrossBatchDedupConfig,
+}
+
+// CrossBatchDedupConfig see CrossBatchDedupOption
+type CrossBatchDedupConfig struct {
+	// Column event field with unique id of event. Default: message_id
+	Column string `json:"column,omitempty"`
+	// WindowHours ids are remembered for N hours after they were loaded. Default: 24
+	WindowHours int `json:"windowHours,omitempty"`
+}
+
+// Validate returns err if invalid
+func (c *CrossBatchDedupConfig) Validate() error {
+	if c.WindowHours < 0 {
+		return fmt.Errorf("crossBatchDedup windowHours must not be negative")
+	}
+	return nil
+}
+
+func (c *CrossBatchDedupConfig) window() time.Duration {
+	if c.WindowHours == 0 {
+		return defaultCrossBatchDedupWindowHours * time.Hour
+	}
+	return time.Duration(c.WindowHours) * time.Hour
+}
+
+func parseCrossBatchDedupConfig(serialized any) (*CrossBatchDedupConfig, error) {
+	var raw []byte
+	switch v := serialized.(type) {
+	case *CrossBatchDedupConfig:
+		return v, v.Validate()
+	case bool:
+		if !v {
+			return nil, nil
+		}
+		return &CrossBatchDedupConfig{}, nil
+	case string:
+		raw = []byte(v)
+	default:
+		var err error
+		raw, err = json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value type of crossBatchDedup option: %T", v)
+		}
+	}
+	config := &CrossBatchDedupConfig{}
+	if err := json.Unmarshal(raw, config); err != nil {
+		return nil, fmt.Errorf("failed to parse crossBatchDedup config: %v", err)
+	}
+	return config, config.Validate()
+}
+
+// WithCrossBatchDedup skips events which ids in provided column were loaded within window. See CrossBatchDedupOption
+func WithCrossBatchDedup(column string, windowHours int) bulker.StreamOption {
+	return bulker.WithOption(&CrossBatchDedupOption, &CrossBatchDedupConfig{Column: column, WindowHours: windowHours})
+}
+
+// validateCrossBatchDedupOption checks that stream can skip events loaded by previous batches
+func validateCrossBatchDedupOption(p SQLAdapter, mode bulker.BulkMode, merge bool, options *bulker.StreamOptions) error {
+	if CrossBatchDedupOption.Get(options) == nil {
+		return nil
+	}
+	if mode != bulker.Batch {
+		return fmt.Errorf("crossBatchDedup option is supported only in %s mode", bulker.Batch)
+	}
+	if merge {
+		return fmt.Errorf("crossBatchDedup option is not supported with deduplication: rows are already merged by primary key")
+	}
+	if localBatchFileOption.Get(options) == "" {
+		return fmt.Errorf("%s supports crossBatchDedup only with batch file loading", p.Type())
+	}
+	if AggregationOption.Get(options) != nil {
+		return fmt.Errorf("crossBatchDedup option is not supported with aggregation")
+	}
+	if CheckpointsOption.Get(options) {
+		return fmt.Errorf("crossBatchDedup option is not supported with checkpoints")
+	}
+	return nil
+}
+
+// crossBatchDedup ids of events written to the current batch file. See CrossBatchDedupOption
+type crossBatchDedup struct {
+	// column adapted name of id column
+	column string
+	window time.Duration
+	// linesById batch file line of the first event with id
+	linesById map[string]int
+	// idsTable schema of DedupIdsTable. Ensured on the first flush of batch file
+	idsTable *Table
+}
+
+func newCrossBatchDedup(p SQLAdapter, config *CrossBatchDedupConfig) *crossBatchDedup {
+	return &crossBatchDedup{
+		column:    p.ColumnName(utils.DefaultString(config.Column, defaultCrossBatchDedupColumn)),
+		window:    config.window(),
+		linesById: map[string]int{},
+	}
+}
+
+// trackDedupId remembers batch file line of event id. Line of event with id already written to the batch file is skipped
+func (ps *AbstractTransactionalSQLStream) trackDedupId(processedObject types.Object, lineNumber int) {
+	value, ok := processedObject[ps.crossBatchDedup.column]
+	if !ok || value == nil {
+		return
+	}
+	id := fmt.Sprint(value)
+	if _, ok = ps.crossBatchDedup.linesById[id]; ok {
+		ps.skipDuplicateLine(lineNumber)
+		return
+	}
+	ps.crossBatchDedup.linesById[id] = lineNumber
+}
+
+func (ps *AbstractTransactionalSQLStream) skipDuplicateLine(lineNumber int) {
+	ps.batchFileSkipLines.Put(lineNumber)
+	ps.state.SkippedDuplicates++
+	ps.state.SuccessfulRows--
+}
+
+// skipLoadedIds removes expired ids of the table from DedupIdsTable and skips lines of batch file with ids that are still there
+func (ps *AbstractTransactionalSQLStream) skipLoadedIds(ctx context.Context) error {
+	dedup := ps.crossBatchDedup
+	if len(dedup.linesById) == 0 {
+		return nil
+	}
+	th := ps.sqlAdapter.TableHelper()
+	if dedup.idsTable == nil {
+		table := th.MapSchema(ps.sqlAdapter, types.Schema{Name: DedupIdsTable, Fields: []types.SchemaField{
+			{Name: dedupIdColumn, Type: types.STRING},
+			{Name: dedupTableNameColumn, Type: types.STRING},
+			{Name: dedupLoadedAtColumn, Type: types.TIMESTAMP},
+		}})
+		table.PKFields = utils.NewSet(th.ColumnName(dedupIdColumn), th.ColumnName(dedupTableNameColumn))
+		table.PrimaryKeyName = BuildConstraintName(table.Name)
+		table, err := th.EnsureTableWithoutCaching(ctx, ps.tx, ps.id, table)
+		if err != nil {
+			return errorj.Decorate(err, "failed to ensure dedup ids table")
+		}
+		dedup.idsTable = table
+	}
+	tableNameColumn := ps.sqlAdapter.ColumnName(dedupTableNameColumn)
+	expired := NewWhenConditions(tableNameColumn, "=", ps.tableName).
+		Add(ps.sqlAdapter.ColumnName(dedupLoadedAtColumn), "<", time.Now().UTC().Add(-dedup.window))
+	if err := ps.tx.Delete(ctx, dedup.idsTable.Name, expired); err != nil {
+		return errorj.Decorate(err, "failed to delete expired dedup ids")
+	}
+	idColumn := ps.sqlAdapter.ColumnName(dedupIdColumn)
+	skipped := 0
+	for _, chunk := range dedupIdsChunks(dedup.linesById) {
+		conditions := &WhenConditions{JoinCondition: "OR"}
+		for _, id := range chunk {
+			conditions.Conditions = append(conditions.Conditions, WhenCondition{Field: idColumn, Clause: "=", Value: id})
+		}
+		rows, err := ps.tx.Select(ctx, dedup.idsTable.Name, conditions, nil)
+		if err != nil {
+			return errorj.Decorate(err, "failed to look up loaded ids")
+		}
+		for _, row := range rows {
+			// ids of other tables are filtered here: conditions of lookup are joined with OR
+			if fmt.Sprint(row[tableNameColumn]) != ps.tableName {
+				continue
+			}
+			id := fmt.Sprint(row[idColumn])
+			if line, ok := dedup.linesById[id]; ok {
+				ps.skipDuplicateLine(line)
+				delete(dedup.linesById, id)
+				skipped++
+			}
+		}
+	}
+	if skipped > 0 {
+		logging.Infof("[%s] Skipped %d events already loaded to table %s", ps.id, skipped, ps.tableName)
+	}
+	return nil
+}
+
+// recordLoadedIds saves ids of events loaded from batch file in the stream transaction
+func (ps *AbstractTransactionalSQLStream) recordLoadedIds(ctx context.Context) error {
+	dedup := ps.crossBatchDedup
+	if dedup.idsTable == nil {
+		return nil
+	}
+	loadedAt := time.Now().UTC()
+	for _, chunk := range dedupIdsChunks(dedup.linesById) {
+		objects := make([]types.Object, len(chunk))
+		for i, id := range chunk {
+			objects[i] = types.Object{
+				ps.sqlAdapter.ColumnName(dedupIdColumn):        id,
+				ps.sqlAdapter.ColumnName(dedupTableNameColumn): ps.tableName,
+				ps.sqlAdapter.ColumnName(dedupLoadedAtColumn):  loadedAt,
+			}
+		}
+		if err := ps.tx.Insert(ctx, dedup.idsTable, false, objects...); err != nil {
+			return errorj.Decorate(err, "failed to record loaded ids")
+		}
+	}
+	return nil
+}
+
+// dedupIdsChunks returns sorted ids split into chunks of dedupIdsChunkSize
+func dedupIdsChunks(linesById map[string]int) [][]string {
+	ids := make([]string, 0, len(linesById))
+	for id := range linesById {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	var chunks [][]string
+	for len(ids) > 0 {
+		n := min(len(ids), dedupIdsChunkSize)
+		chunks = append(chunks, ids[:n])
+		ids = ids[n:]
+	}
+	return chunks
+}
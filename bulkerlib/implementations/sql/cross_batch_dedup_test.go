@@ -0,0 +1,38 @@
+package sql
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestCrossBatchDedupConfig(t *testing.T) {
+	reqr := require.New(t)
+	config, err := parseCrossBatchDedupConfig(true)
+	reqr.NoError(err)
+	reqr.Equal(defaultCrossBatchDedupWindowHours*time.Hour, config.window())
+
+	config, err = parseCrossBatchDedupConfig(false)
+	reqr.NoError(err)
+	reqr.Nil(config)
+
+	config, err = parseCrossBatchDedupConfig(map[string]any{"column": "event_id", "windowHours": 2})
+	reqr.NoError(err)
+	reqr.Equal("event_id", config.Column)
+	reqr.Equal(2*time.Hour, config.window())
+
+	_, err = parseCrossBatchDedupConfig(`{"windowHours": -1}`)
+	reqr.Error(err)
+
+	linesById := map[string]int{}
+	for i := 0; i < dedupIdsChunkSize*2+1; i++ {
+		linesById[fmt.Sprintf("id%04d", i)] = i
+	}
+	chunks := dedupIdsChunks(linesById)
+	reqr.Len(chunks, 3)
+	reqr.Len(chunks[0], dedupIdsChunkSize)
+	reqr.Len(chunks[2], 1)
+	reqr.Equal("id0000", chunks[0][0])
+	reqr.Empty(dedupIdsChunks(map[string]int{}))
+}
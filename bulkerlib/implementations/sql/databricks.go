@@ -0,0 +1,575 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/hashicorp/go-multierror"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	types2 "github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/errorj"
+	"github.com/jitsucom/bulker/jitsubase/logging"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+)
+
+func init() {
+	bulker.RegisterBulker(DatabricksBulkerTypeId, NewDatabricks)
+	bulker.RegisterConfigType(DatabricksBulkerTypeId, DatabricksConfig{})
+}
+
+const (
+	DatabricksBulkerTypeId = "databricks"
+
+	dbxCreateSchemaIfNotExistsTemplate = `CREATE SCHEMA IF NOT EXISTS %s`
+	dbxDescTableQuery                  = `DESCRIBE TABLE %s`
+	dbxShowTablePropertiesQuery        = `SHOW TBLPROPERTIES %s`
+	dbxCreateTableTemplate             = `CREATE TABLE %s (%s)%s`
+	dbxSetPrimaryKeyTemplate           = `ALTER TABLE %s SET TBLPROPERTIES ('%s' = '%s', '%s' = '%s')`
+	dbxUnsetPrimaryKeyTemplate         = `ALTER TABLE %s UNSET TBLPROPERTIES IF EXISTS ('%s', '%s')`
+	dbxReplaceTableTemplate            = `CREATE OR REPLACE TABLE %s DEEP CLONE %s`
+
+	dbxCopyTemplate      = `COPY INTO %s FROM (SELECT %s FROM '%s'%s) FILEFORMAT = JSON COPY_OPTIONS ('force' = 'true')`
+	dbxCopyCredentials   = ` WITH (CREDENTIAL (AWS_ACCESS_KEY = '%s', AWS_SECRET_KEY = '%s'))`
+	dbxCopyAzureSAS      = ` WITH (CREDENTIAL (AZURE_SAS_TOKEN = '%s'))`
+	dbxMergeStatement    = `MERGE INTO {{.TableTo}} T USING (SELECT {{.Columns}} FROM {{.TableFrom}} ) S ON {{.JoinConditions}} WHEN MATCHED{{if .VersionColumn}} AND (T.{{.VersionColumn}} IS NULL OR T.{{.VersionColumn}} <= S.{{.VersionColumn}}){{end}} THEN UPDATE SET {{.UpdateSet}} WHEN NOT MATCHED THEN INSERT ({{.Columns}}) VALUES ({{.SourceColumns}})`
+	dbxTableNotFoundCode = "TABLE_OR_VIEW_NOT_FOUND"
+
+	// Databricks doesn't enforce primary keys. Bulker keeps primary key in table properties
+	dbxPrimaryKeyProperty     = "bulker.primary_key"
+	dbxPrimaryKeyNameProperty = "bulker.primary_key_name"
+)
+
+var (
+	dbxMergeQueryTemplate, _ = template.New("databricksMergeQuery").Parse(dbxMergeStatement)
+
+	databricksTypes = map[types2.DataType][]string{
+		types2.STRING:    {"string"},
+		types2.INT64:     {"bigint", "int", "smallint", "tinyint"},
+		types2.FLOAT64:   {"double", "float", "decimal%"},
+		types2.TIMESTAMP: {"timestamp", "timestamp_ntz"},
+		types2.BOOL:      {"boolean"},
+		types2.JSON:      {"string"},
+		types2.UNKNOWN:   {"string"},
+	}
+)
+
+// DatabricksConfig dto for deserialized datasource config for Databricks SQL Warehouse
+type DatabricksConfig struct {
+	Host        string `mapstructure:"host,omitempty" json:"host,omitempty" yaml:"host,omitempty"`
+	Token       string `mapstructure:"token,omitempty" json:"token,omitempty" yaml:"token,omitempty"`
+	WarehouseId string `mapstructure:"warehouseId,omitempty" json:"warehouseId,omitempty" yaml:"warehouseId,omitempty"`
+	// Catalog Unity Catalog name. Workspace default catalog is used when empty
+	Catalog string `mapstructure:"catalog,omitempty" json:"catalog,omitempty" yaml:"catalog,omitempty"`
+	Schema  string `mapstructure:"defaultSchema,omitempty" json:"defaultSchema,omitempty" yaml:"defaultSchema,omitempty"`
+	// StagingPath Unity Catalog volume path for batch files, e.g. /Volumes/main/default/bulker.
+	// Used when neither S3 bucket nor Azure Blob container is configured
+	StagingPath    string `mapstructure:"stagingPath,omitempty" json:"stagingPath,omitempty" yaml:"stagingPath,omitempty"`
+	S3OptionConfig `mapstructure:",squash" yaml:"-,inline"`
+	// AzureBlob Azure Blob Storage container for batch files. Used when S3 bucket is not configured.
+	// Without sasToken, access to the container must be granted to Databricks via Unity Catalog external location
+	AzureBlob *AzureBlobOptionConfig `mapstructure:"azureBlob,omitempty" json:"azureBlob,omitempty" yaml:"azureBlob,omitempty"`
+}
+
+// Validate required fields in DatabricksConfig
+func (dc *DatabricksConfig) Validate() error {
+	if dc == nil {
+		return errors.New("Databricks config is required")
+	}
+	if dc.Host == "" {
+		return errors.New("Databricks host is required parameter")
+	}
+	if dc.Token == "" {
+		return errors.New("Databricks token is required parameter")
+	}
+	if dc.WarehouseId == "" {
+		return errors.New("Databricks warehouseId is required parameter")
+	}
+	if dc.Bucket == "" && dc.AzureBlob == nil && dc.StagingPath == "" {
+		return errors.New("Databricks requires either S3 bucket, azureBlob or stagingPath for batch files")
+	}
+	if dc.AzureBlob != nil && (dc.AzureBlob.AccountName == "" || dc.AzureBlob.Container == "") {
+		return errors.New("Databricks azureBlob requires accountName and container")
+	}
+	if dc.StagingPath != "" && !strings.HasPrefix(dc.StagingPath, "/Volumes/") {
+		return fmt.Errorf("Databricks stagingPath must be a Unity Catalog volume path starting with /Volumes/: %s", dc.StagingPath)
+	}
+	if dc.Schema == "" {
+		dc.Schema = "default"
+	}
+	return nil
+}
+
+// Databricks is adapter for creating, patching (schema or table), inserting and copying data to Databricks SQL Warehouse
+type Databricks struct {
+	*SQLAdapterBase[DatabricksConfig]
+	client *databricksClient
+}
+
+// NewDatabricks returns configured Databricks adapter instance
+func NewDatabricks(bulkerConfig bulker.Config) (bulker.Bulker, error) {
+	config := &DatabricksConfig{}
+	if err := utils.ParseObject(bulkerConfig.DestinationConfig, config); err != nil {
+		return nil, fmt.Errorf("failed to parse destination config: %v", err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	client := newDatabricksClient(config)
+
+	dbConnectFunction := func(config *DatabricksConfig) (*sql.DB, error) {
+		dataSource := sql.OpenDB(&databricksConnector{client: client})
+		if err := dataSource.Ping(); err != nil {
+			dataSource.Close()
+			return nil, err
+		}
+		dataSource.SetConnMaxIdleTime(3 * time.Minute)
+		dataSource.SetMaxIdleConns(10)
+		return dataSource, nil
+	}
+	typecastFunc := func(placeholder string, column types2.SQLColumn) string {
+		if column.Override {
+			return fmt.Sprintf("CAST(%s AS %s)", placeholder, column.Type)
+		}
+		return placeholder
+	}
+	var queryLogger *logging.QueryLogger
+	if bulkerConfig.LogLevel == bulker.Verbose {
+		queryLogger = logging.NewQueryLogger(bulkerConfig.Id, os.Stderr, os.Stderr)
+	}
+	sqlAdapter, err := newSQLAdapterBase(bulkerConfig.Id, DatabricksBulkerTypeId, config, dbConnectFunction, databricksTypes, queryLogger, typecastFunc, DatabricksParameterPlaceholder, dbxColumnDDL, unmappedValue, checkErr)
+	d := &Databricks{SQLAdapterBase: sqlAdapter, client: client}
+	// Databricks doesn't support temporary tables
+	d.temporaryTables = false
+	d.batchFileFormat = types2.FileFormatNDJSON
+	d.statementTimeout = time.Duration(bulkerConfig.StatementTimeoutSec) * time.Second
+	d.setConnMaxLifetime(time.Duration(bulkerConfig.ConnMaxLifetimeSec) * time.Second)
+	d.tableHelper = NewTableHelper(255, '`')
+	d.tableHelper.tableNameFunc = dbxIdentifierFunction
+	d.tableHelper.columnNameFunc = dbxIdentifierFunction
+	return d, err
+}
+
+func (d *Databricks) CreateStream(id, tableName string, mode bulker.BulkMode, streamOptions ...bulker.StreamOption) (bulker.BulkerStream, error) {
+	streamOptions = append(streamOptions, withLocalBatchFile(fmt.Sprintf("bulker_%s", utils.SanitizeString(id))))
+	if d.config.Bucket != "" {
+		streamOptions = append(streamOptions, withS3BatchFile(&d.config.S3OptionConfig))
+	} else if d.config.AzureBlob != nil {
+		streamOptions = append(streamOptions, withAzureBlobBatchFile(d.config.AzureBlob))
+	}
+	if err := d.validateOptions(streamOptions); err != nil {
+		return nil, err
+	}
+	switch mode {
+	case bulker.Stream:
+		return newAutoCommitStream(id, d, tableName, streamOptions...)
+	case bulker.Batch:
+		return newTransactionalStream(id, d, tableName, streamOptions...)
+	case bulker.ReplaceTable:
+		return newReplaceTableStream(id, d, tableName, streamOptions...)
+	case bulker.ReplacePartition:
+		return newReplacePartitionStream(id, d, tableName, streamOptions...)
+	}
+	return nil, fmt.Errorf("unsupported bulk mode: %s", mode)
+}
+
+func (d *Databricks) validateOptions(streamOptions []bulker.StreamOption) error {
+	options := &bulker.StreamOptions{}
+	for _, option := range streamOptions {
+		options.Add(option)
+	}
+	return nil
+}
+
+// SupportsVersionMerge MERGE statement updates only rows with lower version
+func (d *Databricks) SupportsVersionMerge() bool {
+	return true
+}
+
+// SupportsSavepoints Databricks has no transactions that span multiple statements
+func (d *Databricks) SupportsSavepoints() bool {
+	return false
+}
+
+// OpenTx returns TxSQLAdapter that executes statements without transaction: every statement is committed on its own
+func (d *Databricks) OpenTx(ctx context.Context) (*TxSQLAdapter, error) {
+	return &TxSQLAdapter{sqlAdapter: d, tx: NewDbWrapper(d.Type(), d.dataSource, d.queryLogger, d.checkErrFunc, false).WithStatementTimeout(d.statementTimeout)}, nil
+}
+
+// InitDatabase create database schema instance if doesn't exist
+func (d *Databricks) InitDatabase(ctx context.Context) error {
+	query := fmt.Sprintf(dbxCreateSchemaIfNotExistsTemplate, d.quotedSchemaName())
+
+	if _, err := d.txOrDb(ctx).ExecContext(context.WithValue(ctx, dbxWithoutSchemaKey{}, true), query); err != nil {
+		return errorj.CreateSchemaError.Wrap(err, "failed to create db schema").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Schema:    d.config.Schema,
+				Statement: query,
+			})
+	}
+
+	return nil
+}
+
+// GetTableSchema returns table (name,columns with name and types) representation wrapped in Table struct
+func (d *Databricks) GetTableSchema(ctx context.Context, tableName string) (*Table, error) {
+	quotedTableName, tableName := d.tableHelper.adaptTableName(tableName)
+	table := &Table{Name: tableName, Columns: Columns{}, PKFields: utils.NewSet[string]()}
+
+	query := fmt.Sprintf(dbxDescTableQuery, quotedTableName)
+	rows, err := d.txOrDb(ctx).QueryContext(ctx, query)
+	if err != nil {
+		if strings.Contains(err.Error(), dbxTableNotFoundCode) {
+			return table, nil
+		}
+		return nil, errorj.GetTableError.Wrap(err, "failed to get table columns").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Schema:    d.config.Schema,
+				Table:     quotedTableName,
+				Statement: query,
+			})
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row map[string]any
+		row, err = rowToMap(rows)
+		if err != nil {
+			return nil, errorj.GetTableError.Wrap(err, "failed to scan result").
+				WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+					Schema:    d.config.Schema,
+					Table:     quotedTableName,
+					Statement: query,
+				})
+		}
+		columnName := fmt.Sprint(row["col_name"])
+		if columnName == "" || strings.HasPrefix(columnName, "#") {
+			// partitioning and detailed table information sections follow columns list
+			break
+		}
+		columnType := fmt.Sprint(row["data_type"])
+		dt, _ := d.GetDataType(columnType)
+		table.Columns[columnName] = types2.SQLColumn{Type: columnType, DataType: dt}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errorj.GetTableError.Wrap(err, "failed read last row").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Schema:    d.config.Schema,
+				Table:     quotedTableName,
+				Statement: query,
+			})
+	}
+
+	primaryKeyName, pkFields, err := d.getPrimaryKey(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+	table.PKFields = pkFields
+	table.PrimaryKeyName = primaryKeyName
+
+	return table, nil
+}
+
+// getPrimaryKey returns primary key name and fields stored in table properties
+func (d *Databricks) getPrimaryKey(ctx context.Context, tableName string) (string, utils.Set[string], error) {
+	quotedTableName := d.quotedTableName(tableName)
+
+	primaryKeys := utils.NewSet[string]()
+	statement := fmt.Sprintf(dbxShowTablePropertiesQuery, quotedTableName)
+	rows, err := d.txOrDb(ctx).QueryContext(ctx, statement)
+	if err != nil {
+		return "", nil, errorj.GetPrimaryKeysError.Wrap(err, "failed to get primary key").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Schema:    d.config.Schema,
+				Table:     quotedTableName,
+				Statement: statement,
+			})
+	}
+	defer rows.Close()
+
+	var primaryKeyName string
+	for rows.Next() {
+		var row map[string]any
+		row, err = rowToMap(rows)
+		if err != nil {
+			return "", nil, errorj.GetPrimaryKeysError.Wrap(err, "failed to get primary key").
+				WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+					Schema:    d.config.Schema,
+					Table:     quotedTableName,
+					Statement: statement,
+				})
+		}
+		value := fmt.Sprint(row["value"])
+		switch fmt.Sprint(row["key"]) {
+		case dbxPrimaryKeyNameProperty:
+			primaryKeyName = value
+		case dbxPrimaryKeyProperty:
+			for _, field := range strings.Split(value, ",") {
+				if field != "" {
+					primaryKeys.Put(field)
+				}
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", nil, errorj.GetPrimaryKeysError.Wrap(err, "failed read last row").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Schema:    d.config.Schema,
+				Table:     quotedTableName,
+				Statement: statement,
+			})
+	}
+	if len(primaryKeys) == 0 {
+		primaryKeyName = ""
+	}
+	return primaryKeyName, primaryKeys, nil
+}
+
+// CreateTable creates Delta table. Primary key is stored in table properties
+func (d *Databricks) CreateTable(ctx context.Context, schemaToCreate *Table) error {
+	quotedTableName := d.quotedTableName(schemaToCreate.Name)
+
+	columns := schemaToCreate.CreateColumnNames()
+	columnsDDL := make([]string, len(columns))
+	for i, columnName := range columns {
+		columnsDDL[i] = d.columnDDL(columnName, schemaToCreate)
+	}
+	properties := ""
+	if len(schemaToCreate.PKFields) > 0 && schemaToCreate.PrimaryKeyName != "" {
+		properties = fmt.Sprintf(" TBLPROPERTIES ('%s' = '%s', '%s' = '%s')", dbxPrimaryKeyProperty, strings.Join(schemaToCreate.GetPKFields(), ","), dbxPrimaryKeyNameProperty, schemaToCreate.PrimaryKeyName)
+	}
+	query := fmt.Sprintf(dbxCreateTableTemplate, quotedTableName, strings.Join(columnsDDL, ", "), properties)
+
+	if _, err := d.txOrDb(ctx).ExecContext(ctx, query); err != nil {
+		return errorj.CreateTableError.Wrap(err, "failed to create table").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Schema:      d.config.Schema,
+				Table:       quotedTableName,
+				PrimaryKeys: schemaToCreate.GetPKFields(),
+				Statement:   query,
+			})
+	}
+	return nil
+}
+
+// PatchTableSchema adds columns to table and updates primary key in table properties
+func (d *Databricks) PatchTableSchema(ctx context.Context, patchTable *Table) error {
+	quotedTableName := d.quotedTableName(patchTable.Name)
+
+	for _, columnName := range patchTable.SortedColumnNames() {
+		query := fmt.Sprintf(addColumnTemplate, quotedTableName, d.columnDDL(columnName, patchTable))
+		if _, err := d.txOrDb(ctx).ExecContext(ctx, query); err != nil {
+			return errorj.PatchTableError.Wrap(err, "failed to patch table").
+				WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+					Schema:      d.config.Schema,
+					Table:       quotedTableName,
+					PrimaryKeys: patchTable.GetPKFields(),
+					Statement:   query,
+				})
+		}
+	}
+
+	if patchTable.DeletePkFields {
+		query := fmt.Sprintf(dbxUnsetPrimaryKeyTemplate, quotedTableName, dbxPrimaryKeyProperty, dbxPrimaryKeyNameProperty)
+		if _, err := d.txOrDb(ctx).ExecContext(ctx, query); err != nil {
+			return errorj.DeletePrimaryKeysError.Wrap(err, "failed to delete primary key").
+				WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+					Schema:      d.config.Schema,
+					Table:       quotedTableName,
+					PrimaryKeys: patchTable.GetPKFields(),
+					Statement:   query,
+				})
+		}
+	}
+
+	if len(patchTable.PKFields) > 0 {
+		query := fmt.Sprintf(dbxSetPrimaryKeyTemplate, quotedTableName, dbxPrimaryKeyProperty, strings.Join(patchTable.GetPKFields(), ","), dbxPrimaryKeyNameProperty, patchTable.PrimaryKeyName)
+		if _, err := d.txOrDb(ctx).ExecContext(ctx, query); err != nil {
+			return errorj.CreatePrimaryKeysError.Wrap(err, "failed to set primary key").
+				WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+					Schema:      d.config.Schema,
+					Table:       quotedTableName,
+					PrimaryKeys: patchTable.GetPKFields(),
+					Statement:   query,
+				})
+		}
+	}
+	return nil
+}
+
+// LoadTable transfers data from staged file to Databricks table using COPY INTO.
+// File is staged either in S3 bucket, Azure Blob container or in Unity Catalog volume
+func (d *Databricks) LoadTable(ctx context.Context, targetTable *Table, loadSource *LoadSource) (state *bulker.WarehouseState, err error) {
+	quotedTableName := d.quotedTableName(targetTable.Name)
+	if loadSource.Format != d.batchFileFormat {
+		return state, fmt.Errorf("LoadTable: only %s format is supported", d.batchFileFormat)
+	}
+	var location, credentials, maskedCredentials string
+	switch loadSource.Type {
+	case AmazonS3:
+		s3Config := loadSource.S3Config
+		location = fmt.Sprintf("s3://%s/%s", s3Config.Bucket, loadSource.Path)
+		if s3Config.AccessKeyID != "" {
+			credentials = fmt.Sprintf(dbxCopyCredentials, s3Config.AccessKeyID, s3Config.SecretKey)
+			maskedCredentials = fmt.Sprintf(dbxCopyCredentials, credentialsMask, credentialsMask)
+		}
+	case AzureBlob:
+		azureConfig := loadSource.AzureBlobConfig
+		location = fmt.Sprintf("abfss://%s@%s.dfs.core.windows.net/%s", azureConfig.Container, azureConfig.AccountName, loadSource.Path)
+		if azureConfig.SASToken != "" {
+			credentials = fmt.Sprintf(dbxCopyAzureSAS, strings.TrimPrefix(azureConfig.SASToken, "?"))
+			maskedCredentials = fmt.Sprintf(dbxCopyAzureSAS, credentialsMask)
+		}
+	case LocalFile:
+		if d.config.StagingPath == "" {
+			return state, fmt.Errorf("LoadTable: stagingPath is required to load local file")
+		}
+		location = strings.TrimSuffix(d.config.StagingPath, "/") + "/" + path.Base(loadSource.Path)
+		file, err := os.Open(loadSource.Path)
+		if err != nil {
+			return state, errorj.LoadError.Wrap(err, "failed to open batch file")
+		}
+		err = d.client.uploadFile(ctx, location, file)
+		_ = file.Close()
+		if err != nil {
+			return state, errorj.LoadError.Wrap(err, "failed to upload file to volume").
+				WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+					Schema: d.config.Schema,
+					Table:  quotedTableName,
+				})
+		}
+		defer func() {
+			if err2 := d.client.deleteFile(context.Background(), location); err2 != nil {
+				err = multierror.Append(err, errorj.LoadError.Wrap(err2, "failed to remove file from volume")).ErrorOrNil()
+			}
+		}()
+	default:
+		return state, fmt.Errorf("LoadTable: unsupported load source type: %s", loadSource.Type)
+	}
+
+	columns := targetTable.SortedColumnNames()
+	selectColumns := make([]string, len(columns))
+	for i, name := range columns {
+		quotedName := d.quotedColumnName(name)
+		selectColumns[i] = fmt.Sprintf("CAST(%s AS %s) AS %s", quotedName, targetTable.Columns[name].GetDDLType(), quotedName)
+	}
+	selectExpression := strings.Join(selectColumns, ", ")
+	statement := fmt.Sprintf(dbxCopyTemplate, quotedTableName, selectExpression, location, credentials)
+	if _, err := d.txOrDb(ctx).ExecContext(ctx, statement); err != nil {
+		return state, errorj.CopyError.Wrap(err, "failed to copy data from stage").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Schema:    d.config.Schema,
+				Table:     quotedTableName,
+				Statement: fmt.Sprintf(dbxCopyTemplate, quotedTableName, selectExpression, location, maskedCredentials),
+			})
+	}
+	return state, nil
+}
+
+// Insert inserts data with InsertContext as a single object or a batch into Databricks
+func (d *Databricks) Insert(ctx context.Context, table *Table, merge bool, objects ...types2.Object) error {
+	if !merge || len(table.GetPKFields()) == 0 {
+		return d.insert(ctx, table, objects)
+	}
+	for _, object := range objects {
+		pkMatchConditions := &WhenConditions{}
+		for _, pkColumn := range table.GetPKFields() {
+			value := object[pkColumn]
+			if value == nil {
+				pkMatchConditions = pkMatchConditions.Add(pkColumn, "IS NULL", nil)
+			} else {
+				pkMatchConditions = pkMatchConditions.Add(pkColumn, "=", value)
+			}
+		}
+		res, err := d.Select(ctx, table.Name, pkMatchConditions, nil)
+		if err != nil {
+			return errorj.ExecuteInsertError.Wrap(err, "failed check primary key collision").
+				WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+					Schema:      d.config.Schema,
+					Table:       d.quotedTableName(table.Name),
+					PrimaryKeys: table.GetPKFields(),
+				})
+		}
+		if len(res) > 0 {
+			if supersededVersion(table, object, res[0]) {
+				continue
+			}
+			err = d.Update(ctx, table, object, pkMatchConditions)
+		} else {
+			err = d.insert(ctx, table, []types2.Object{object})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Databricks) CopyTables(ctx context.Context, targetTable *Table, sourceTable *Table, mergeWindow int) (*bulker.WarehouseState, error) {
+	if mergeWindow <= 0 || len(targetTable.PKFields) == 0 {
+		return nil, d.copy(ctx, targetTable, sourceTable)
+	} else {
+		return nil, d.copyOrMerge(ctx, targetTable, sourceTable, dbxMergeQueryTemplate, "S")
+	}
+}
+
+// ReplaceTable atomically replaces target table with the copy of replacement table including its properties
+func (d *Databricks) ReplaceTable(ctx context.Context, targetTableName string, replacementTable *Table, dropOldTable bool) error {
+	quotedTargetTableName := d.quotedTableName(targetTableName)
+	quotedReplacementTableName := d.quotedTableName(replacementTable.Name)
+	statement := fmt.Sprintf(dbxReplaceTableTemplate, quotedTargetTableName, quotedReplacementTableName)
+	if _, err := d.txOrDb(ctx).ExecContext(ctx, statement); err != nil {
+		return errorj.RenameError.Wrap(err, "failed to replace table").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Schema:    d.config.Schema,
+				Table:     quotedTargetTableName,
+				Statement: statement,
+			})
+	}
+	return d.DropTable(ctx, replacementTable.Name, true)
+}
+
+// MaintainTable runs OPTIMIZE (default) with optional ZORDER BY, VACUUM or ANALYZE TABLE on Delta table
+func (d *Databricks) MaintainTable(ctx context.Context, tableName string, config *MaintenanceConfig) error {
+	quotedTableName := d.quotedTableName(tableName)
+	var statements []string
+	for _, task := range config.tasksOrDefault(MaintenanceOptimize) {
+		switch task {
+		case MaintenanceOptimize:
+			statement := "OPTIMIZE " + quotedTableName
+			if len(config.ZOrderBy) > 0 {
+				statement += " ZORDER BY (" + strings.Join(utils.ArrayMap(config.ZOrderBy, d.quotedColumnName), ", ") + ")"
+			}
+			statements = append(statements, statement)
+		case MaintenanceVacuum:
+			statements = append(statements, "VACUUM "+quotedTableName)
+		case MaintenanceAnalyze:
+			statements = append(statements, "ANALYZE TABLE "+quotedTableName+" COMPUTE STATISTICS")
+		}
+	}
+	return d.runMaintenance(ctx, quotedTableName, statements)
+}
+
+func (d *Databricks) quotedSchemaName() string {
+	schema := "`" + d.config.Schema + "`"
+	if d.config.Catalog != "" {
+		return "`" + d.config.Catalog + "`." + schema
+	}
+	return schema
+}
+
+// dbxColumnDDL returns column DDL (column name, mapped sql type)
+func dbxColumnDDL(quotedName, name string, table *Table) string {
+	column := table.Columns[name]
+	return fmt.Sprintf(`%s %s`, quotedName, column.GetDDLType())
+}
+
+// dbxIdentifierFunction Databricks identifiers are case-insensitive and stored in lower case
+func dbxIdentifierFunction(value string, alphanumeric bool) (adapted string, needQuotes bool) {
+	return strings.ToLower(value), true
+}
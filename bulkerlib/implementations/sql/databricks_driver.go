@@ -0,0 +1,430 @@
+package sql
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Minimal database/sql driver on top of Databricks SQL Statement Execution API:
+// https://docs.databricks.com/api/workspace/statementexecution
+// Databricks SQL Warehouses don't support multi-statement transactions - each statement is committed on its own.
+
+const (
+	dbxStatementsPath  = "/api/2.0/sql/statements"
+	dbxFilesPath       = "/api/2.0/fs/files"
+	dbxWaitTimeout     = "30s"
+	dbxPollInterval    = time.Second
+	dbxStatePending    = "PENDING"
+	dbxStateRunning    = "RUNNING"
+	dbxStateSucceeded  = "SUCCEEDED"
+	dbxParameterPrefix = "p"
+)
+
+var DatabricksParameterPlaceholder = func(i int, name string) string {
+	return ":" + dbxParameterPrefix + strconv.Itoa(i)
+}
+
+// dbxWithoutSchemaKey context key to execute statement without default schema set, e.g. to create that schema
+type dbxWithoutSchemaKey struct{}
+
+type dbxParameter struct {
+	Name  string  `json:"name"`
+	Value *string `json:"value"`
+	Type  string  `json:"type,omitempty"`
+}
+
+type dbxStatementRequest struct {
+	WarehouseId   string         `json:"warehouse_id"`
+	Statement     string         `json:"statement"`
+	Catalog       string         `json:"catalog,omitempty"`
+	Schema        string         `json:"schema,omitempty"`
+	Parameters    []dbxParameter `json:"parameters,omitempty"`
+	WaitTimeout   string         `json:"wait_timeout"`
+	OnWaitTimeout string         `json:"on_wait_timeout"`
+	Disposition   string         `json:"disposition"`
+	Format        string         `json:"format"`
+}
+
+type dbxResultData struct {
+	DataArray             [][]*string `json:"data_array"`
+	NextChunkInternalLink string      `json:"next_chunk_internal_link"`
+}
+
+type dbxStatementResponse struct {
+	StatementId string `json:"statement_id"`
+	Status      struct {
+		State string `json:"state"`
+		Error *struct {
+			ErrorCode string `json:"error_code"`
+			Message   string `json:"message"`
+		} `json:"error"`
+	} `json:"status"`
+	Manifest *struct {
+		Schema struct {
+			Columns []struct {
+				Name     string `json:"name"`
+				TypeName string `json:"type_name"`
+			} `json:"columns"`
+		} `json:"schema"`
+	} `json:"manifest"`
+	Result *dbxResultData `json:"result"`
+}
+
+// databricksClient executes statements and manages staged files using Databricks REST API
+type databricksClient struct {
+	config     *DatabricksConfig
+	httpClient *http.Client
+}
+
+func newDatabricksClient(config *DatabricksConfig) *databricksClient {
+	return &databricksClient{config: config, httpClient: &http.Client{Timeout: 5 * time.Minute}}
+}
+
+func (c *databricksClient) url(path string) string {
+	host := strings.TrimSuffix(c.config.Host, "/")
+	if !strings.HasPrefix(host, "http://") && !strings.HasPrefix(host, "https://") {
+		host = "https://" + host
+	}
+	return host + path
+}
+
+func (c *databricksClient) do(ctx context.Context, method, path string, body io.Reader, result any) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.url(path), body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.config.Token)
+	if body != nil && method != http.MethodPut {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	respBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("databricks %s %s: http status %d: %s", method, path, res.StatusCode, string(respBody))
+	}
+	if result != nil && len(respBody) > 0 {
+		return json.Unmarshal(respBody, result)
+	}
+	return nil
+}
+
+// execute runs statement and waits for its completion
+func (c *databricksClient) execute(ctx context.Context, query string, args []driver.NamedValue) (*dbxStatementResponse, error) {
+	query, err := dbxNamedMarkers(query, args)
+	if err != nil {
+		return nil, err
+	}
+	params, err := dbxParameters(args)
+	if err != nil {
+		return nil, err
+	}
+	schema := c.config.Schema
+	if ctx.Value(dbxWithoutSchemaKey{}) != nil {
+		schema = ""
+	}
+	payload, err := json.Marshal(dbxStatementRequest{
+		WarehouseId:   c.config.WarehouseId,
+		Statement:     query,
+		Catalog:       c.config.Catalog,
+		Schema:        schema,
+		Parameters:    params,
+		WaitTimeout:   dbxWaitTimeout,
+		OnWaitTimeout: "CONTINUE",
+		Disposition:   "INLINE",
+		Format:        "JSON_ARRAY",
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp := &dbxStatementResponse{}
+	if err = c.do(ctx, http.MethodPost, dbxStatementsPath, bytes.NewReader(payload), resp); err != nil {
+		return nil, err
+	}
+	for resp.Status.State == dbxStatePending || resp.Status.State == dbxStateRunning {
+		select {
+		case <-ctx.Done():
+			// context is already cancelled - use background context to deliver cancel request
+			_ = c.do(context.Background(), http.MethodPost, dbxStatementsPath+"/"+resp.StatementId+"/cancel", nil, nil)
+			return nil, ctx.Err()
+		case <-time.After(dbxPollInterval):
+		}
+		statementId := resp.StatementId
+		resp = &dbxStatementResponse{}
+		if err = c.do(ctx, http.MethodGet, dbxStatementsPath+"/"+statementId, nil, resp); err != nil {
+			return nil, err
+		}
+	}
+	if resp.Status.State != dbxStateSucceeded {
+		if resp.Status.Error != nil {
+			return nil, fmt.Errorf("databricks: %s: %s", resp.Status.Error.ErrorCode, resp.Status.Error.Message)
+		}
+		return nil, fmt.Errorf("databricks: statement %s finished with state: %s", resp.StatementId, resp.Status.State)
+	}
+	return resp, nil
+}
+
+// uploadFile uploads local file to Unity Catalog volume using Files API
+func (c *databricksClient) uploadFile(ctx context.Context, targetPath string, reader io.Reader) error {
+	return c.do(ctx, http.MethodPut, dbxFilesPath+targetPath+"?overwrite=true", reader, nil)
+}
+
+func (c *databricksClient) deleteFile(ctx context.Context, targetPath string) error {
+	return c.do(ctx, http.MethodDelete, dbxFilesPath+targetPath, nil, nil)
+}
+
+// dbxNamedMarkers replaces '?' placeholders outside of quoted strings, identifiers and comments with named parameter markers
+// because Statement Execution API supports only named parameters. Queries with named markers are returned as is
+func dbxNamedMarkers(query string, args []driver.NamedValue) (string, error) {
+	if len(args) == 0 {
+		return query, nil
+	}
+	named, placeholders, err := interpolateParams(query, args, func(arg driver.NamedValue) (string, error) {
+		return ":" + dbxParameterName(arg), nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("databricks: %v", err)
+	}
+	if placeholders == 0 {
+		return query, nil
+	}
+	if placeholders != len(args) {
+		return "", fmt.Errorf("databricks: query has %d placeholders but %d arguments provided", placeholders, len(args))
+	}
+	return named, nil
+}
+
+func dbxParameterName(arg driver.NamedValue) string {
+	if arg.Name != "" {
+		return arg.Name
+	}
+	return dbxParameterPrefix + strconv.Itoa(arg.Ordinal)
+}
+
+func dbxParameters(args []driver.NamedValue) ([]dbxParameter, error) {
+	params := make([]dbxParameter, len(args))
+	for i, arg := range args {
+		p := dbxParameter{Name: dbxParameterName(arg)}
+		var str string
+		switch v := arg.Value.(type) {
+		case nil:
+		case string:
+			str = v
+			p.Type = "STRING"
+		case []byte:
+			str = string(v)
+			p.Type = "STRING"
+		case int64:
+			str = strconv.FormatInt(v, 10)
+			p.Type = "BIGINT"
+		case float64:
+			str = strconv.FormatFloat(v, 'f', -1, 64)
+			p.Type = "DOUBLE"
+		case bool:
+			str = strconv.FormatBool(v)
+			p.Type = "BOOLEAN"
+		case time.Time:
+			str = v.UTC().Format(time.RFC3339Nano)
+			p.Type = "TIMESTAMP"
+		default:
+			return nil, fmt.Errorf("databricks: unsupported parameter type %T", v)
+		}
+		if arg.Value != nil {
+			p.Value = &str
+		}
+		params[i] = p
+	}
+	return params, nil
+}
+
+// databricksConnector implements driver.Connector. Use with sql.OpenDB
+type databricksConnector struct {
+	client *databricksClient
+}
+
+func (c *databricksConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return &databricksConn{client: c.client}, nil
+}
+
+func (c *databricksConnector) Driver() driver.Driver {
+	return databricksDriver{}
+}
+
+type databricksDriver struct{}
+
+func (d databricksDriver) Open(name string) (driver.Conn, error) {
+	return nil, errors.New("databricks: DSN connections are not supported. Use sql.OpenDB with connector")
+}
+
+type databricksConn struct {
+	client *databricksClient
+}
+
+func (c *databricksConn) Prepare(query string) (driver.Stmt, error) {
+	return &databricksStmt{conn: c, query: query}, nil
+}
+
+func (c *databricksConn) Close() error {
+	return nil
+}
+
+// Begin fails: Databricks commits each statement on its own.
+// Databricks adapter executes statements without transaction
+func (c *databricksConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("databricks: transactions are not supported")
+}
+
+func (c *databricksConn) Ping(ctx context.Context) error {
+	_, err := c.client.execute(ctx, "SELECT 1", nil)
+	return err
+}
+
+func (c *databricksConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if _, err := c.client.execute(ctx, query, args); err != nil {
+		return nil, err
+	}
+	return driver.ResultNoRows, nil
+}
+
+func (c *databricksConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	resp, err := c.client.execute(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	rows := &databricksRows{ctx: ctx, client: c.client}
+	if resp.Manifest != nil {
+		for _, col := range resp.Manifest.Schema.Columns {
+			rows.columns = append(rows.columns, col.Name)
+			rows.types = append(rows.types, strings.ToUpper(col.TypeName))
+		}
+	}
+	if resp.Result != nil {
+		rows.data = resp.Result.DataArray
+		rows.nextLink = resp.Result.NextChunkInternalLink
+	}
+	return rows, nil
+}
+
+type databricksStmt struct {
+	conn  *databricksConn
+	query string
+}
+
+func (s *databricksStmt) Close() error {
+	return nil
+}
+
+func (s *databricksStmt) NumInput() int {
+	return -1
+}
+
+func (s *databricksStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.conn.ExecContext(context.Background(), s.query, toNamedValues(args))
+}
+
+func (s *databricksStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.conn.QueryContext(context.Background(), s.query, toNamedValues(args))
+}
+
+func (s *databricksStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.conn.ExecContext(ctx, s.query, args)
+}
+
+func (s *databricksStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.conn.QueryContext(ctx, s.query, args)
+}
+
+func toNamedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return named
+}
+
+type databricksRows struct {
+	ctx      context.Context
+	client   *databricksClient
+	columns  []string
+	types    []string
+	data     [][]*string
+	nextLink string
+	index    int
+}
+
+func (r *databricksRows) Columns() []string {
+	return r.columns
+}
+
+func (r *databricksRows) ColumnTypeDatabaseTypeName(index int) string {
+	return r.types[index]
+}
+
+func (r *databricksRows) Close() error {
+	return nil
+}
+
+func (r *databricksRows) Next(dest []driver.Value) error {
+	for r.index >= len(r.data) {
+		if r.nextLink == "" {
+			return io.EOF
+		}
+		chunk := &dbxResultData{}
+		if err := r.client.do(r.ctx, http.MethodGet, r.nextLink, nil, chunk); err != nil {
+			return err
+		}
+		r.data = chunk.DataArray
+		r.nextLink = chunk.NextChunkInternalLink
+		r.index = 0
+	}
+	row := r.data[r.index]
+	r.index++
+	for i := range dest {
+		if i >= len(row) || row[i] == nil {
+			dest[i] = nil
+			continue
+		}
+		dest[i] = dbxConvertValue(*row[i], r.types[i])
+	}
+	return nil
+}
+
+// dbxConvertValue converts string representation from JSON_ARRAY result to go type
+func dbxConvertValue(value string, typeName string) driver.Value {
+	switch typeName {
+	case "BYTE", "SHORT", "INT", "LONG", "TINYINT", "SMALLINT", "BIGINT":
+		if v, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return v
+		}
+	case "FLOAT", "DOUBLE", "DECIMAL":
+		if v, err := strconv.ParseFloat(value, 64); err == nil {
+			return v
+		}
+	case "BOOLEAN":
+		if v, err := strconv.ParseBool(value); err == nil {
+			return v
+		}
+	case "TIMESTAMP", "TIMESTAMP_NTZ", "DATE":
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999", time.DateOnly} {
+			if v, err := time.Parse(layout, value); err == nil {
+				return v
+			}
+		}
+	}
+	return value
+}
@@ -0,0 +1,196 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// dbxTestServer emulates Statement Execution API: each statement is returned with the configured states one by one on polling
+type dbxTestServer struct {
+	sync.Mutex
+	t      *testing.T
+	states []string
+	// statusError error of failed statement
+	statusError string
+	// result manifest and result of succeeded statement
+	result   string
+	chunks   map[string]string
+	requests []dbxStatementRequest
+	polls    int
+	canceled bool
+	// httpStatus error status of all requests
+	httpStatus int
+}
+
+func (s *dbxTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	require.Equal(s.t, "Bearer token", r.Header.Get("Authorization"))
+	if s.httpStatus != 0 {
+		w.WriteHeader(s.httpStatus)
+		_, _ = w.Write([]byte(`{"error_code": "PERMISSION_DENIED"}`))
+		return
+	}
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == dbxStatementsPath:
+		req := dbxStatementRequest{}
+		require.NoError(s.t, json.NewDecoder(r.Body).Decode(&req))
+		s.requests = append(s.requests, req)
+		s.writeState(w)
+	case r.Method == http.MethodGet && r.URL.Path == dbxStatementsPath+"/st1":
+		s.polls++
+		s.writeState(w)
+	case r.Method == http.MethodPost && r.URL.Path == dbxStatementsPath+"/st1/cancel":
+		s.canceled = true
+	case s.chunks[r.URL.Path] != "":
+		_, _ = w.Write([]byte(s.chunks[r.URL.Path]))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error_code": "NOT_FOUND"}`))
+	}
+}
+
+func (s *dbxTestServer) writeState(w http.ResponseWriter) {
+	state := s.states[0]
+	if len(s.states) > 1 {
+		s.states = s.states[1:]
+	}
+	switch state {
+	case dbxStatePending, dbxStateRunning:
+		_, _ = fmt.Fprintf(w, `{"statement_id": "st1", "status": {"state": "%s"}}`, state)
+	case dbxStateSucceeded:
+		_, _ = fmt.Fprintf(w, `{"statement_id": "st1", "status": {"state": "%s"}, %s}`, state, utils.DefaultString(s.result, `"manifest": null`))
+	default:
+		_, _ = fmt.Fprintf(w, `{"statement_id": "st1", "status": {"state": "%s", "error": %s}}`, state, utils.DefaultString(s.statusError, "null"))
+	}
+}
+
+func newDbxTestDB(t *testing.T, server *dbxTestServer) *sql.DB {
+	server.t = t
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+	client := newDatabricksClient(&DatabricksConfig{Host: httpServer.URL, Token: "token", WarehouseId: "wh1", Catalog: "main", Schema: "bulker"})
+	db := sql.OpenDB(&databricksConnector{client: client})
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func TestDatabricksDriverQuery(t *testing.T) {
+	reqr := require.New(t)
+	server := &dbxTestServer{
+		states: []string{dbxStatePending, dbxStateRunning, dbxStateSucceeded},
+		result: `"manifest": {"schema": {"columns": [
+{"name": "id", "type_name": "LONG"}, {"name": "price", "type_name": "DECIMAL"}, {"name": "ok", "type_name": "BOOLEAN"},
+{"name": "ts", "type_name": "TIMESTAMP"}, {"name": "day", "type_name": "DATE"}, {"name": "name", "type_name": "STRING"}]}},
+"result": {"data_array": [["1", "1.5", "true", "2024-03-01T12:30:15.123Z", "2024-03-01", "a"]], "next_chunk_internal_link": "/api/2.0/sql/statements/st1/result/chunks/1"}`,
+		chunks: map[string]string{
+			"/api/2.0/sql/statements/st1/result/chunks/1": `{"data_array": [["2", null, "false", "2024-03-02 10:00:00", null, null]]}`,
+		},
+	}
+	db := newDbxTestDB(t, server)
+
+	rows, err := db.QueryContext(context.Background(), "SELECT * FROM events WHERE name = ? AND id > ?", "a", int64(0))
+	reqr.NoError(err)
+	defer rows.Close()
+	columnTypes, err := rows.ColumnTypes()
+	reqr.NoError(err)
+	reqr.Equal("DECIMAL", columnTypes[1].DatabaseTypeName())
+
+	var results [][]any
+	for rows.Next() {
+		row := make([]any, 6)
+		pointers := make([]any, 6)
+		for i := range row {
+			pointers[i] = &row[i]
+		}
+		reqr.NoError(rows.Scan(pointers...))
+		results = append(results, row)
+	}
+	reqr.NoError(rows.Err())
+	reqr.Equal([][]any{
+		{int64(1), 1.5, true, time.Date(2024, 3, 1, 12, 30, 15, 123000000, time.UTC), time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), "a"},
+		{int64(2), nil, false, time.Date(2024, 3, 2, 10, 0, 0, 0, time.UTC), nil, nil},
+	}, results)
+
+	reqr.Equal(2, server.polls)
+	reqr.Len(server.requests, 1)
+	req := server.requests[0]
+	reqr.Equal("SELECT * FROM events WHERE name = :p1 AND id > :p2", req.Statement)
+	reqr.Equal("wh1", req.WarehouseId)
+	reqr.Equal("main", req.Catalog)
+	reqr.Equal("bulker", req.Schema)
+	a, zero := "a", "0"
+	reqr.Equal([]dbxParameter{{Name: "p1", Value: &a, Type: "STRING"}, {Name: "p2", Value: &zero, Type: "BIGINT"}}, req.Parameters)
+}
+
+func TestDatabricksDriverFailures(t *testing.T) {
+	tests := []struct {
+		name        string
+		states      []string
+		statusError string
+		wantErr     string
+	}{
+		{"failed", []string{dbxStateRunning, "FAILED"}, `{"error_code": "BAD_REQUEST", "message": "[TABLE_OR_VIEW_NOT_FOUND] events"}`,
+			"databricks: BAD_REQUEST: [TABLE_OR_VIEW_NOT_FOUND] events"},
+		{"canceled", []string{"CANCELED"}, "", "databricks: statement st1 finished with state: CANCELED"},
+		{"closed", []string{dbxStatePending, "CLOSED"}, "", "databricks: statement st1 finished with state: CLOSED"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newDbxTestDB(t, &dbxTestServer{states: tt.states, statusError: tt.statusError})
+			_, err := db.ExecContext(context.Background(), "DELETE FROM events")
+			require.EqualError(t, err, tt.wantErr)
+		})
+	}
+
+	//http errors
+	db := newDbxTestDB(t, &dbxTestServer{states: []string{dbxStateSucceeded}, httpStatus: http.StatusForbidden})
+	_, err := db.ExecContext(context.Background(), "SELECT 1")
+	require.ErrorContains(t, err, "http status 403")
+
+	//statement is canceled when context is done while polling
+	server := &dbxTestServer{states: []string{dbxStateRunning}}
+	db = newDbxTestDB(t, server)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = db.ExecContext(ctx, "OPTIMIZE events")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	server.Lock()
+	require.True(t, server.canceled)
+	server.Unlock()
+}
+
+func TestDbxConvertValue(t *testing.T) {
+	tests := []struct {
+		value    string
+		typeName string
+		want     any
+	}{
+		{"42", "INT", int64(42)},
+		{"-7", "BIGINT", int64(-7)},
+		{"2.5", "DOUBLE", 2.5},
+		{"10.10", "DECIMAL", 10.1},
+		{"true", "BOOLEAN", true},
+		{"2024-03-01T12:30:15Z", "TIMESTAMP", time.Date(2024, 3, 1, 12, 30, 15, 0, time.UTC)},
+		{"2024-03-01 12:30:15.5", "TIMESTAMP_NTZ", time.Date(2024, 3, 1, 12, 30, 15, 500000000, time.UTC)},
+		{"2024-03-01", "DATE", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"abc", "STRING", "abc"},
+		{`{"a":1}`, "STRUCT", `{"a":1}`},
+		// unparseable values are returned as is
+		{"abc", "INT", "abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.typeName+"_"+tt.value, func(t *testing.T) {
+			require.Equal(t, tt.want, dbxConvertValue(tt.value, tt.typeName))
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package sql
 
-import "errors"
+import (
+	"errors"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+)
 
 // DataSourceConfig dto for deserialized datasource config (e.g. in Postgres or AwsRedshift destination)
 type DataSourceConfig struct {
@@ -11,6 +14,12 @@ type DataSourceConfig struct {
 	Username   string            `mapstructure:"username,omitempty" json:"username,omitempty" yaml:"username,omitempty"`
 	Password   string            `mapstructure:"password,omitempty" json:"password,omitempty" yaml:"password,omitempty"`
 	Parameters map[string]string `mapstructure:"parameters,omitempty" json:"parameters,omitempty" yaml:"parameters,omitempty"`
+	// ReadReplicaHost optional read replica used for schema introspection queries
+	ReadReplicaHost string `mapstructure:"readReplicaHost,omitempty" json:"readReplicaHost,omitempty" yaml:"readReplicaHost,omitempty"`
+	// ReadReplicaPort port of read replica. Port of primary is used when empty
+	ReadReplicaPort int `mapstructure:"readReplicaPort,omitempty" json:"readReplicaPort,omitempty" yaml:"readReplicaPort,omitempty"`
+	// TLS configuration: CA bundle, client certificate for mutual TLS, SNI. Supported by MySQL, StarRocks, Doris and Postgres
+	TLS *utils.TLSConfig `mapstructure:"tls,omitempty" json:"tls,omitempty" yaml:"tls,omitempty"`
 }
 
 // Validate required fields in DataSourceConfig
@@ -34,3 +43,18 @@ func (dsc *DataSourceConfig) Validate() error {
 
 	return nil
 }
+
+// ReadReplica returns copy of config pointing to read replica or nil if read replica isn't configured
+func (dsc *DataSourceConfig) ReadReplica() *DataSourceConfig {
+	if dsc.ReadReplicaHost == "" {
+		return nil
+	}
+	replica := *dsc
+	replica.Host = dsc.ReadReplicaHost
+	if dsc.ReadReplicaPort != 0 {
+		replica.Port = dsc.ReadReplicaPort
+	}
+	replica.ReadReplicaHost = ""
+	replica.ReadReplicaPort = 0
+	return &replica
+}
@@ -0,0 +1,134 @@
+package sql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/errorj"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"sort"
+	"strings"
+)
+
+// Descriptions table comment and column descriptions declared with DescriptionsOption
+type Descriptions struct {
+	Table string `json:"table,omitempty"`
+	// Columns descriptions by column (event field) name
+	Columns map[string]string `json:"columns,omitempty"`
+}
+
+// DescriptionsOption - table comment and per-column descriptions that are set when table is created or columns are added to it.
+// Supported only by adapters implementing DescriptionsSupport
+var DescriptionsOption = bulker.ImplementationOption[Descriptions]{
+	Key:       "descriptions",
+	ParseFunc: parseDescriptions,
+}
+
+// commentsDialect statements used by SQLAdapterBase to set comments of tables and columns declared with DescriptionsOption
+type commentsDialect struct {
+	// tableCommentStatement returns statement that sets comment of table
+	tableCommentStatement func(quotedTableName, comment string) string
+	// columnCommentStatement returns statement that sets comment of column
+	columnCommentStatement func(quotedTableName, quotedColumnName, comment string) string
+}
+
+// DescriptionsSupport optional interface for SQLAdapter that can set table and column descriptions declared with DescriptionsOption
+type DescriptionsSupport interface {
+	SupportsDescriptions() bool
+}
+
+// SupportsDescriptions returns true if adapter can set comments of tables and columns
+func (b *SQLAdapterBase[T]) SupportsDescriptions() bool {
+	return b.comments != nil
+}
+
+// WithDescriptions sets table comment and column descriptions of destination table.
+// Supported only by adapters implementing DescriptionsSupport
+func WithDescriptions(table string, columns map[string]string) bulker.StreamOption {
+	return bulker.WithOption(&DescriptionsOption, Descriptions{Table: table, Columns: columns})
+}
+
+func parseDescriptions(serialized any) (Descriptions, error) {
+	descriptions := Descriptions{}
+	var raw []byte
+	switch v := serialized.(type) {
+	case Descriptions:
+		return v, nil
+	case string:
+		raw = []byte(v)
+	default:
+		var err error
+		raw, err = json.Marshal(v)
+		if err != nil {
+			return descriptions, fmt.Errorf("invalid value type of descriptions option: %T", v)
+		}
+	}
+	if err := json.Unmarshal(raw, &descriptions); err != nil {
+		return descriptions, fmt.Errorf("failed to parse descriptions option: %v", err)
+	}
+	return descriptions, nil
+}
+
+// validateDescriptionsOption returns error if descriptions option is set but adapter doesn't support it
+func validateDescriptionsOption(p SQLAdapter, options *bulker.StreamOptions) error {
+	descriptions := DescriptionsOption.Get(options)
+	if descriptions.Table == "" && len(descriptions.Columns) == 0 {
+		return nil
+	}
+	if ds, ok := p.(DescriptionsSupport); ok && ds.SupportsDescriptions() {
+		return nil
+	}
+	return fmt.Errorf("'%s' option is not supported by %s", DescriptionsOption.Key, p.Type())
+}
+
+// columnDescriptions returns column descriptions with column names adapted to column names of adapter
+func columnDescriptions(p SQLAdapter, descriptions Descriptions) map[string]string {
+	if len(descriptions.Columns) == 0 {
+		return nil
+	}
+	columns := make(map[string]string, len(descriptions.Columns))
+	for name, description := range descriptions.Columns {
+		columns[p.ColumnName(name)] = description
+	}
+	return columns
+}
+
+// createComments sets comment of table and comments of its columns that have descriptions
+func (b *SQLAdapterBase[T]) createComments(ctx context.Context, table *Table) error {
+	if b.comments == nil || table.Temporary || (table.Comment == "" && len(table.ColumnComments) == 0) {
+		return nil
+	}
+	quotedTableName := b.quotedTable(table)
+	var statements []string
+	if table.Comment != "" {
+		statements = append(statements, b.comments.tableCommentStatement(quotedTableName, table.Comment))
+	}
+	columns := utils.MapToSlice(table.ColumnComments, func(name string, _ string) string { return name })
+	sort.Strings(columns)
+	for _, columnName := range columns {
+		if _, ok := table.Columns[columnName]; !ok {
+			continue
+		}
+		statements = append(statements, b.comments.columnCommentStatement(quotedTableName, b.quotedColumnName(columnName), table.ColumnComments[columnName]))
+	}
+	for _, statement := range statements {
+		if _, err := b.txOrDb(ctx).ExecContext(ctx, statement); err != nil {
+			return errorj.AlterTableError.Wrap(err, "failed to set comment").
+				WithProperty(errorj.DBInfo, &types.ErrorPayload{
+					Table:     quotedTableName,
+					Statement: statement,
+				})
+		}
+	}
+	return nil
+}
+
+// quotedComment returns comment as SQL string literal. escapeBackslash - database treats backslash in string literals as escape character
+func quotedComment(comment string, escapeBackslash bool) string {
+	if escapeBackslash {
+		comment = strings.ReplaceAll(comment, `\`, `\\`)
+	}
+	return "'" + strings.ReplaceAll(comment, "'", "''") + "'"
+}
@@ -0,0 +1,419 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	types2 "github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/errorj"
+	"github.com/jitsucom/bulker/jitsubase/logging"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"os"
+	"strings"
+	"time"
+)
+
+func init() {
+	bulker.RegisterBulker(DorisBulkerTypeId, NewDoris)
+	bulker.RegisterConfigType(DorisBulkerTypeId, DorisConfig{})
+}
+
+const (
+	DorisBulkerTypeId = "doris"
+
+	dorisDefaultPort     = 9030
+	dorisDefaultHttpPort = 8030
+
+	dorisUniqueKeyFieldsQuery = `SELECT
+									column_name AS name
+								FROM information_schema.columns
+								WHERE table_schema = ? AND table_name = ? AND column_key = 'UNI'`
+	dorisCreateTableTemplate  = `CREATE TABLE %s (%s)%s`
+	dorisReplaceTableTemplate = `ALTER TABLE %s REPLACE WITH TABLE %s PROPERTIES('swap' = '%t')`
+	dorisRenameTableTemplate  = `ALTER TABLE %s RENAME %s`
+)
+
+var (
+	dorisTypes = map[types2.DataType][]string{
+		types2.STRING:    {"string", "text", "varchar"},
+		types2.INT64:     {"bigint", "bigint(20)"},
+		types2.FLOAT64:   {"double"},
+		types2.TIMESTAMP: {"datetime(6)", "datetime"},
+		types2.BOOL:      {"boolean", "tinyint(1)"},
+		types2.JSON:      {"json", "jsonb"},
+		types2.UNKNOWN:   {"string"},
+	}
+
+	// dorisKeyTypesMapping key columns can't be of STRING type
+	dorisKeyTypesMapping = map[string]string{
+		"string": "varchar(255)",
+	}
+
+	dorisPartitionGranularities = utils.NewSet("hour", "day", "week", "month", "quarter", "year")
+)
+
+// DorisConfig dto for deserialized Apache Doris config
+type DorisConfig struct {
+	DataSourceConfig `mapstructure:",squash"`
+	// HttpPort FE HTTP port used for Stream Load. Default: 8030
+	HttpPort int `mapstructure:"httpPort,omitempty" json:"httpPort,omitempty" yaml:"httpPort,omitempty"`
+	// HttpsEnabled use https for Stream Load requests
+	HttpsEnabled bool `mapstructure:"httpsEnabled,omitempty" json:"httpsEnabled,omitempty" yaml:"httpsEnabled,omitempty"`
+	// PartitionGranularity auto partitions tables by timestamp column: hour, day, week, month, quarter or year. Empty - no partitioning.
+	// Partition column must be a key column, so tables with unique key not including timestamp column aren't partitioned
+	PartitionGranularity string `mapstructure:"partitionGranularity,omitempty" json:"partitionGranularity,omitempty" yaml:"partitionGranularity,omitempty"`
+	// Buckets number of buckets of table. 0 - AUTO
+	Buckets int `mapstructure:"buckets,omitempty" json:"buckets,omitempty" yaml:"buckets,omitempty"`
+	// ReplicationNum number of tablet replicas. 0 - Doris default
+	ReplicationNum int `mapstructure:"replicationNum,omitempty" json:"replicationNum,omitempty" yaml:"replicationNum,omitempty"`
+}
+
+// Validate required fields in DorisConfig
+func (dc *DorisConfig) Validate() error {
+	if err := dc.DataSourceConfig.Validate(); err != nil {
+		return err
+	}
+	if dc.PartitionGranularity != "" && !dorisPartitionGranularities.Contains(dc.PartitionGranularity) {
+		return fmt.Errorf("unsupported partitionGranularity '%s'. Supported: hour, day, week, month, quarter, year", dc.PartitionGranularity)
+	}
+	if dc.Buckets < 0 || dc.ReplicationNum < 0 {
+		return errors.New("buckets and replicationNum must not be negative")
+	}
+	return nil
+}
+
+// partitioned returns true if table is auto partitioned by timestamp column
+func (dc *DorisConfig) partitioned(table *Table) bool {
+	return dc.PartitionGranularity != "" && !table.Temporary && table.TimestampColumn != "" &&
+		(len(table.PKFields) == 0 || table.PKFields.Contains(table.TimestampColumn))
+}
+
+// Doris is adapter for Apache Doris. It uses MySQL protocol for queries with following differences:
+//
+// - batches are loaded with Stream Load: batch file is sent with chunked HTTP request to FE;
+//
+// - tables with primary key are created with Unique Key model with merge-on-write enabled.
+// Inserts to such tables replace rows with the same key, so merge doesn't require special statements.
+// Key of existing table can't be changed;
+//
+// - Doris doesn't support transactions spanning DDL and loads: statements of stream are executed one by one
+// and tmp tables are regular tables dropped after use;
+//
+// - partitioning requires Doris 2.1+ (AUTO PARTITION).
+type Doris struct {
+	*MySQL
+	dorisConfig  *DorisConfig
+	streamLoader *streamLoader
+}
+
+// NewDoris returns configured Doris bulker.Bulker instance
+func NewDoris(bulkerConfig bulker.Config) (bulker.Bulker, error) {
+	config := &DorisConfig{}
+	if err := utils.ParseObject(bulkerConfig.DestinationConfig, config); err != nil {
+		return nil, fmt.Errorf("failed to parse destination config: %v", err)
+	}
+	if config.Port == 0 {
+		config.Port = dorisDefaultPort
+	}
+	if config.HttpPort == 0 {
+		config.HttpPort = dorisDefaultHttpPort
+	}
+	config.PartitionGranularity = strings.ToLower(config.PartitionGranularity)
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if config.Parameters == nil {
+		config.Parameters = map[string]string{}
+	}
+	utils.MapPutIfAbsent(config.Parameters, "timeout", "60s")
+	utils.MapPutIfAbsent(config.Parameters, "writeTimeout", "60s")
+	utils.MapPutIfAbsent(config.Parameters, "readTimeout", "60s")
+	utils.MapPutIfAbsent(config.Parameters, "interpolateParams", "true")
+	tlsConfig, err := mySQLTLSConfig(bulkerConfig.Id, &config.DataSourceConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	dbConnectFunction := func(cfg *DataSourceConfig) (*sql.DB, error) {
+		dataSource, err := sql.Open("mysql", mySQLDriverConnectionString(cfg))
+		if err != nil {
+			return nil, err
+		}
+		if err := dataSource.Ping(); err != nil {
+			_ = dataSource.Close()
+			return nil, err
+		}
+		dataSource.SetConnMaxLifetime(3 * time.Minute)
+		dataSource.SetMaxIdleConns(10)
+		return dataSource, nil
+	}
+	typecastFunc := func(placeholder string, column types2.SQLColumn) string {
+		return placeholder
+	}
+	var queryLogger *logging.QueryLogger
+	if bulkerConfig.LogLevel == bulker.Verbose {
+		queryLogger = logging.NewQueryLogger(bulkerConfig.Id, os.Stderr, os.Stderr)
+	}
+	sqlAdapterBase, err := newSQLAdapterBase(bulkerConfig.Id, DorisBulkerTypeId, &config.DataSourceConfig, dbConnectFunction, dorisTypes, queryLogger, typecastFunc, QuestionMarkParameterPlaceholder, dorisColumnDDL(config), mySQLMapColumnValue, checkErr)
+	d := &Doris{
+		MySQL:        &MySQL{SQLAdapterBase: sqlAdapterBase},
+		dorisConfig:  config,
+		streamLoader: newStreamLoader(config.Host, config.HttpPort, config.HttpsEnabled, tlsConfig, config.Username, config.Password),
+	}
+	d.batchFileFormat = types2.FileFormatNDJSON
+	d.temporaryTables = false
+	d.statementTimeout = time.Duration(bulkerConfig.StatementTimeoutSec) * time.Second
+	d.setConnMaxLifetime(time.Duration(bulkerConfig.ConnMaxLifetimeSec) * time.Second)
+	d.tableHelper = NewTableHelper(63, '`')
+	return d, err
+}
+
+func (d *Doris) CreateStream(id, tableName string, mode bulker.BulkMode, streamOptions ...bulker.StreamOption) (bulker.BulkerStream, error) {
+	streamOptions = append(streamOptions, withLocalBatchFile(fmt.Sprintf("bulker_%s", utils.SanitizeString(id))))
+	if err := d.validateOptions(streamOptions); err != nil {
+		return nil, err
+	}
+	switch mode {
+	case bulker.Stream:
+		return newAutoCommitStream(id, d, tableName, streamOptions...)
+	case bulker.Batch:
+		return newTransactionalStream(id, d, tableName, streamOptions...)
+	case bulker.ReplaceTable:
+		return newReplaceTableStream(id, d, tableName, streamOptions...)
+	case bulker.ReplacePartition:
+		return newReplacePartitionStream(id, d, tableName, streamOptions...)
+	}
+	return nil, fmt.Errorf("unsupported bulk mode: %s", mode)
+}
+
+// SupportsSavepoints Doris has no transactions that span multiple statements
+func (d *Doris) SupportsSavepoints() bool {
+	return false
+}
+
+// OpenTx returns TxSQLAdapter that executes statements without transaction
+func (d *Doris) OpenTx(ctx context.Context) (*TxSQLAdapter, error) {
+	return &TxSQLAdapter{sqlAdapter: d, tx: NewDbWrapper(d.Type(), d.dataSource, d.queryLogger, d.checkErrFunc, false).WithStatementTimeout(d.statementTimeout)}, nil
+}
+
+// Insert inserts objects. Unique Key model tables replace rows with the same key, so merge is the same as insert
+func (d *Doris) Insert(ctx context.Context, table *Table, merge bool, objects ...types2.Object) error {
+	return d.insert(ctx, table, objects)
+}
+
+// CopyTables copies data from sourceTable. Unique Key model tables replace rows with the same key, so merge is the same as copy
+func (d *Doris) CopyTables(ctx context.Context, targetTable *Table, sourceTable *Table, mergeWindow int) (*bulker.WarehouseState, error) {
+	return nil, d.copy(ctx, targetTable, sourceTable)
+}
+
+// LoadTable loads batch file to the table with Stream Load
+func (d *Doris) LoadTable(ctx context.Context, targetTable *Table, loadSource *LoadSource) (state *bulker.WarehouseState, err error) {
+	if loadSource.Type != LocalFile {
+		return nil, fmt.Errorf("LoadTable: only local file is supported")
+	}
+	tableName := d.TableName(targetTable.Name)
+	var headers map[string]string
+	switch loadSource.Format {
+	case types2.FileFormatNDJSON, types2.FileFormatNDJSONFLAT:
+		headers = map[string]string{"format": "json", "read_json_by_line": "true"}
+	case types2.FileFormatCSV:
+		headers = map[string]string{"format": "csv_with_names", "column_separator": ",", "enclose": `"`,
+			"columns": strings.Join(targetTable.SortedColumnNames(), ",")}
+	default:
+		return nil, fmt.Errorf("LoadTable: %s format is not supported", loadSource.Format)
+	}
+	ctx, cancel := statementContext(ctx, d.statementTimeout)
+	defer cancel()
+	loadResponse, err := d.streamLoader.load(ctx, d.config.Db, tableName, loadSource.Path, headers)
+	if err != nil {
+		loadError := errorj.LoadError
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && d.statementTimeout > 0 {
+			loadError = errorj.StatementTimeoutError
+		}
+		return nil, loadError.Wrap(err, "failed to load table with Stream Load").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Database:  d.config.Db,
+				Table:     tableName,
+				Statement: d.streamLoader.URL(d.config.Db, tableName),
+			})
+	}
+	return &bulker.WarehouseState{
+		BytesProcessed: loadResponse.LoadBytes,
+		AdditionalInfo: map[string]any{"streamLoadLabel": loadResponse.Label, "loadTimeMs": loadResponse.LoadTimeMs},
+	}, nil
+}
+
+// GetTableSchema returns table (name,columns with name and types) representation wrapped in Table struct.
+// Unique key columns are reported as primary key
+func (d *Doris) GetTableSchema(ctx context.Context, tableName string) (*Table, error) {
+	table, err := d.getTable(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+	//don't select primary keys of non-existent table
+	if len(table.Columns) == 0 {
+		return table, nil
+	}
+	pkFields, err := d.getUniqueKeys(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+	table.PKFields = pkFields
+	if len(pkFields) > 0 {
+		table.PrimaryKeyName = BuildConstraintName(table.Name)
+	}
+	return table, nil
+}
+
+func (d *Doris) getUniqueKeys(ctx context.Context, tableName string) (utils.Set[string], error) {
+	tableName = d.TableName(tableName)
+	rows, err := d.readDb().QueryContext(ctx, dorisUniqueKeyFieldsQuery, d.config.Db, tableName)
+	if err != nil {
+		return nil, errorj.GetPrimaryKeysError.Wrap(err, "failed to get unique key").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Database:  d.config.Db,
+				Table:     tableName,
+				Statement: dorisUniqueKeyFieldsQuery,
+				Values:    []any{d.config.Db, tableName},
+			})
+	}
+	defer rows.Close()
+	pkFields := utils.NewSet[string]()
+	for rows.Next() {
+		var fieldName string
+		if err := rows.Scan(&fieldName); err != nil {
+			return nil, errorj.GetPrimaryKeysError.Wrap(err, "failed to scan result").
+				WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+					Database:  d.config.Db,
+					Table:     tableName,
+					Statement: dorisUniqueKeyFieldsQuery,
+					Values:    []any{d.config.Db, tableName},
+				})
+		}
+		pkFields.Put(fieldName)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errorj.GetPrimaryKeysError.Wrap(err, "failed read last row").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Database:  d.config.Db,
+				Table:     tableName,
+				Statement: dorisUniqueKeyFieldsQuery,
+				Values:    []any{d.config.Db, tableName},
+			})
+	}
+	return pkFields, nil
+}
+
+// CreateTable creates table. Unique Key model is used for tables with primary key, Duplicate Key model otherwise
+func (d *Doris) CreateTable(ctx context.Context, schemaToCreate *Table) error {
+	quotedTableName := d.quotedTableName(schemaToCreate.Name)
+	// key columns must be the first columns of table in the same order as in key definition
+	columns := schemaToCreate.CreateColumnNames()
+	columnsDDL := make([]string, len(columns))
+	for i, columnName := range columns {
+		columnsDDL[i] = d.columnDDL(columnName, schemaToCreate)
+	}
+	query := fmt.Sprintf(dorisCreateTableTemplate, quotedTableName, strings.Join(columnsDDL, ", "), d.tableProperties(schemaToCreate))
+
+	if _, err := d.txOrDb(ctx).ExecContext(ctx, query); err != nil {
+		return errorj.CreateTableError.Wrap(err, "failed to create table").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Database:    d.config.Db,
+				Table:       quotedTableName,
+				PrimaryKeys: schemaToCreate.GetPKFields(),
+				Statement:   query,
+			})
+	}
+	return nil
+}
+
+// tableProperties returns key model, partitioning, distribution and properties clauses of CREATE TABLE statement
+func (d *Doris) tableProperties(table *Table) string {
+	var builder strings.Builder
+	pkFields := sortedPKFields(table)
+	keyColumns := make([]string, len(pkFields))
+	for i, column := range pkFields {
+		keyColumns[i] = d.quotedColumnName(column)
+	}
+	if len(keyColumns) > 0 {
+		builder.WriteString(" UNIQUE KEY (" + strings.Join(keyColumns, ", ") + ")")
+	}
+	if d.dorisConfig.partitioned(table) {
+		builder.WriteString(fmt.Sprintf(" AUTO PARTITION BY RANGE (date_trunc(%s, '%s')) ()", d.quotedColumnName(table.TimestampColumn), d.dorisConfig.PartitionGranularity))
+	}
+	buckets := "AUTO"
+	if d.dorisConfig.Buckets > 0 {
+		buckets = fmt.Sprintf("%d", d.dorisConfig.Buckets)
+	}
+	if len(keyColumns) > 0 {
+		builder.WriteString(" DISTRIBUTED BY HASH(" + strings.Join(keyColumns, ", ") + ") BUCKETS " + buckets)
+	} else {
+		builder.WriteString(" DISTRIBUTED BY RANDOM BUCKETS " + buckets)
+	}
+	properties := make([]string, 0, 2)
+	if len(keyColumns) > 0 {
+		properties = append(properties, `"enable_unique_key_merge_on_write" = "true"`)
+	}
+	if d.dorisConfig.ReplicationNum > 0 {
+		properties = append(properties, fmt.Sprintf(`"replication_num" = "%d"`, d.dorisConfig.ReplicationNum))
+	}
+	if len(properties) > 0 {
+		builder.WriteString(" PROPERTIES (" + strings.Join(properties, ", ") + ")")
+	}
+	return builder.String()
+}
+
+// PatchTableSchema adds new columns. Key of Doris table can't be changed, so primary key changes are ignored
+func (d *Doris) PatchTableSchema(ctx context.Context, patchTable *Table) error {
+	if patchTable.DeletePkFields || len(patchTable.PKFields) > 0 {
+		d.Warnf("Unique key of Doris table %s can't be changed. Requested primary key: %v", patchTable.Name, patchTable.GetPKFields())
+	}
+	if len(patchTable.Columns) == 0 {
+		return nil
+	}
+	return d.SQLAdapterBase.PatchTableSchema(ctx, &Table{Name: patchTable.Name, Columns: patchTable.Columns, PKFields: utils.NewSet[string]()})
+}
+
+// ReplaceTable atomically replaces target table with replacement table.
+// When old table must be kept, tables are swapped
+func (d *Doris) ReplaceTable(ctx context.Context, targetTableName string, replacementTable *Table, dropOldTable bool) (err error) {
+	targetTable, err := d.GetTableSchema(ctx, targetTableName)
+	if err != nil {
+		return err
+	}
+	quotedTargetTableName := d.quotedTableName(targetTableName)
+	quotedReplacementTableName := d.quotedTableName(replacementTable.Name)
+	query := fmt.Sprintf(dorisRenameTableTemplate, quotedReplacementTableName, quotedTargetTableName)
+	if targetTable.Exists() {
+		query = fmt.Sprintf(dorisReplaceTableTemplate, quotedTargetTableName, quotedReplacementTableName, !dropOldTable)
+	}
+	if _, err = d.txOrDb(ctx).ExecContext(ctx, query); err != nil {
+		return errorj.RenameError.Wrap(err, "failed to replace table").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Database:  d.config.Db,
+				Table:     quotedTargetTableName,
+				Statement: query,
+			})
+	}
+	return nil
+}
+
+// dorisColumnDDL returns column DDL (quoted column name, mapped sql type and 'not null' for key and partition columns)
+func dorisColumnDDL(config *DorisConfig) ColumnDDLFunction {
+	return func(quotedName, name string, table *Table) string {
+		column := table.Columns[name]
+		sqlType := column.GetDDLType()
+		if _, ok := table.PKFields[name]; ok {
+			if typeForPKField, ok := dorisKeyTypesMapping[sqlType]; ok {
+				sqlType = typeForPKField
+			}
+			return fmt.Sprintf("%s %s NOT NULL", quotedName, sqlType)
+		}
+		if name == table.TimestampColumn && config.partitioned(table) {
+			return fmt.Sprintf("%s %s NOT NULL", quotedName, sqlType)
+		}
+		return fmt.Sprintf("%s %s", quotedName, sqlType)
+	}
+}
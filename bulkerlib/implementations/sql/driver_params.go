@@ -0,0 +1,59 @@
+package sql
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+)
+
+// interpolateParams replaces '?' placeholders in query with results of replace function called for corresponding argument.
+// Placeholders inside quoted strings, quoted identifiers, line (--) and block (/* */) comments are left as is.
+// Returns query and number of replaced placeholders. Fails if query has more placeholders than provided arguments
+func interpolateParams(query string, args []driver.NamedValue, replace func(arg driver.NamedValue) (string, error)) (string, int, error) {
+	var buf strings.Builder
+	buf.Grow(len(query))
+	argIndex := 0
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			// doubled quote is an escaped quote, so it is enough to find the next quote char
+			end := strings.IndexByte(query[i+1:], c)
+			if end < 0 {
+				buf.WriteString(query[i:])
+				return buf.String(), argIndex, nil
+			}
+			buf.WriteString(query[i : i+end+2])
+			i += end + 1
+		case c == '-' && i+1 < len(query) && query[i+1] == '-':
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				buf.WriteString(query[i:])
+				return buf.String(), argIndex, nil
+			}
+			buf.WriteString(query[i : i+end+1])
+			i += end
+		case c == '/' && i+1 < len(query) && query[i+1] == '*':
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				buf.WriteString(query[i:])
+				return buf.String(), argIndex, nil
+			}
+			buf.WriteString(query[i : i+end+4])
+			i += end + 3
+		case c == '?':
+			if argIndex >= len(args) {
+				return "", argIndex, fmt.Errorf("not enough arguments for query placeholders: %d provided", len(args))
+			}
+			replacement, err := replace(args[argIndex])
+			if err != nil {
+				return "", argIndex, err
+			}
+			buf.WriteString(replacement)
+			argIndex++
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String(), argIndex, nil
+}
@@ -0,0 +1,78 @@
+package sql
+
+import (
+	"database/sql/driver"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestTrinoInterpolate(t *testing.T) {
+	ts := time.Date(2024, 3, 1, 12, 30, 15, 123456000, time.FixedZone("CET", 3600))
+	tests := []struct {
+		name    string
+		query   string
+		args    []any
+		want    string
+		wantErr bool
+	}{
+		{"no_args", "SELECT '?'", nil, "SELECT '?'", false},
+		{"values", "INSERT INTO t VALUES (?, ?, ?, ?)", []any{int64(1), "a", 1.5, true},
+			"INSERT INTO t VALUES (1, 'a', DOUBLE '1.5', true)", false},
+		{"nil", "UPDATE t SET a = ? WHERE b = ?", []any{nil, int64(2)}, "UPDATE t SET a = NULL WHERE b = 2", false},
+		{"time", "SELECT ?", []any{ts}, "SELECT TIMESTAMP '2024-03-01 11:30:15.123456 UTC'", false},
+		{"escaped_string_value", "SELECT ?", []any{"it's"}, "SELECT 'it''s'", false},
+		{"quoted_string", "SELECT 'what?', ? FROM t", []any{int64(1)}, "SELECT 'what?', 1 FROM t", false},
+		{"doubled_quote", "SELECT 'it''s ?', ?", []any{int64(1)}, "SELECT 'it''s ?', 1", false},
+		{"quoted_identifier", `SELECT "col?" FROM t WHERE a = ?`, []any{int64(1)}, `SELECT "col?" FROM t WHERE a = 1`, false},
+		{"line_comment", "SELECT ? -- where is it?\nFROM t", []any{int64(1)}, "SELECT 1 -- where is it?\nFROM t", false},
+		{"line_comment_at_end", "SELECT ? -- why?", []any{int64(1)}, "SELECT 1 -- why?", false},
+		{"block_comment", "SELECT /* a ? b */ ? FROM t", []any{int64(1)}, "SELECT /* a ? b */ 1 FROM t", false},
+		{"minus", "SELECT 2-? FROM t", []any{int64(1)}, "SELECT 2-1 FROM t", false},
+		{"not_enough_args", "SELECT ?, ?", []any{int64(1)}, "", true},
+		{"too_many_args", "SELECT ? -- ?", []any{int64(1), int64(2)}, "", true},
+		{"unsupported_type", "SELECT ?", []any{struct{}{}}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var args []driver.NamedValue
+			for i, a := range tt.args {
+				args = append(args, driver.NamedValue{Ordinal: i + 1, Value: a})
+			}
+			got, err := trinoInterpolate(tt.query, args)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestDbxNamedMarkers(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		args    []driver.NamedValue
+		want    string
+		wantErr bool
+	}{
+		{"named_markers", "SELECT :p1, :p2", []driver.NamedValue{{Ordinal: 1, Value: int64(1)}, {Ordinal: 2, Value: nil}}, "SELECT :p1, :p2", false},
+		{"question_marks", "SELECT ? /* ? */, '?', ? -- ?", []driver.NamedValue{{Ordinal: 1, Value: int64(1)}, {Ordinal: 2, Value: nil}},
+			"SELECT :p1 /* ? */, '?', :p2 -- ?", false},
+		{"named_args", "SELECT ?", []driver.NamedValue{{Name: "id", Ordinal: 1, Value: time.Now()}}, "SELECT :id", false},
+		{"placeholders_mismatch", "SELECT ?", []driver.NamedValue{{Ordinal: 1, Value: int64(1)}, {Ordinal: 2, Value: int64(2)}}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := dbxNamedMarkers(tt.query, tt.args)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
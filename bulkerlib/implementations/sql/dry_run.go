@@ -0,0 +1,76 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/jitsubase/logging"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"os"
+)
+
+// DryRunOption - when enabled, Complete doesn't change destination: DDL (CREATE/ALTER) and load/merge statements
+// that would have been executed are returned in bulker.State.DryRunStatements and transaction is rolled back.
+// Schema of existing tables is still read from destination
+var DryRunOption = bulker.ImplementationOption[bool]{
+	Key:          "dryRun",
+	DefaultValue: false,
+	ParseFunc:    utils.ParseBool,
+}
+
+// WithDryRun makes stream return planned statements on Complete instead of executing them. See DryRunOption
+func WithDryRun() bulker.StreamOption {
+	return bulker.WithOption(&DryRunOption, true)
+}
+
+// DryRunSupport optional interface for SQLAdapter that executes all statements of transaction with TxWrapper, so they can be recorded instead
+type DryRunSupport interface {
+	SupportsDryRun() bool
+}
+
+// SupportsDryRun adapters built on SQLAdapterBase run all statements through TxWrapper
+func (b *SQLAdapterBase[T]) SupportsDryRun() bool {
+	return true
+}
+
+// validateDryRunOption checks that stream and adapter support dry run
+func validateDryRunOption(p SQLAdapter, mode bulker.BulkMode, options *bulker.StreamOptions) error {
+	if mode != bulker.Batch && mode != bulker.CDC {
+		return fmt.Errorf("dryRun option is supported only in %s and %s modes", bulker.Batch, bulker.CDC)
+	}
+	if dr, ok := p.(DryRunSupport); !ok || !dr.SupportsDryRun() {
+		return fmt.Errorf("%s doesn't support dryRun option", p.Type())
+	}
+	if localBatchFileOption.Get(options) == "" {
+		return fmt.Errorf("%s supports dryRun option only with batch file loading", p.Type())
+	}
+	return nil
+}
+
+// completeDryRun puts statements recorded during dry run to the state and rolls back transaction instead of committing it
+func (ps *AbstractTransactionalSQLStream) completeDryRun(ctx context.Context, err error) (bulker.State, error) {
+	if ps.batchFile != nil {
+		_ = ps.batchFile.Close()
+		_ = os.Remove(ps.batchFile.Name())
+	}
+	if ps.tx != nil {
+		if err == nil && ps.tmpTable != nil {
+			_ = ps.tx.Drop(ctx, ps.tmpTable, true)
+		}
+		ps.state.DryRunStatements = ps.tx.tx.DryRunStatements()
+		_ = ps.tx.Rollback()
+	}
+	//cached schemas were patched with changes that were not executed
+	if ps.tmpTable != nil {
+		ps.sqlAdapter.TableHelper().clearCache(ps.tmpTable.Name)
+	}
+	if ps.dstTable != nil {
+		ps.sqlAdapter.TableHelper().clearCache(ps.dstTable.Name)
+	}
+	if err != nil {
+		ps.state.SuccessfulRows = 0
+	} else {
+		logging.Infof("[%s] Dry run completed with %d planned statements", ps.id, len(ps.state.DryRunStatements))
+	}
+	return ps.AbstractSQLStream.postComplete(err)
+}
@@ -0,0 +1,74 @@
+package sql
+
+import (
+	"context"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+)
+
+// TestDryRun checks that stream in dry run mode doesn't change destination table
+func TestDryRun(t *testing.T) {
+	t.Parallel()
+	tests := []bulkerTestConfig{
+		{
+			//delete any table leftovers from previous tests
+			name:      "dummy_test_table_cleanup",
+			tableName: "dry_run_test",
+			modes:     []bulker.BulkMode{bulker.Batch},
+			dataFile:  "test_data/empty.ndjson",
+			configIds: utils.ArrayIntersection(allBulkerConfigs, exceptBigquery),
+		},
+		{
+			name:                "first_load",
+			tableName:           "dry_run_test",
+			modes:               []bulker.BulkMode{bulker.Batch},
+			leaveResultingTable: true,
+			dataFile:            "test_data/partition1.ndjson",
+			expectedRowsCount:   5,
+			configIds:           utils.ArrayIntersection(allBulkerConfigs, exceptBigquery),
+		},
+		{
+			name:                "dry_run_load",
+			tableName:           "dry_run_test",
+			modes:               []bulker.BulkMode{bulker.Batch},
+			leaveResultingTable: true,
+			dataFile:            "test_data/partition2.ndjson",
+			// rows of dry run are not loaded
+			expectedRowsCount: 5,
+			streamOptions:     []bulker.StreamOption{WithDryRun()},
+			configIds:         utils.ArrayIntersection(allBulkerConfigs, exceptBigquery),
+		},
+		{
+			name:      "dummy_test_table_cleanup",
+			tableName: "dry_run_test",
+			modes:     []bulker.BulkMode{bulker.Batch},
+			dataFile:  "test_data/empty.ndjson",
+			configIds: utils.ArrayIntersection(allBulkerConfigs, exceptBigquery),
+		},
+	}
+	sequentialGroup := sync.WaitGroup{}
+	sequentialGroup.Add(1)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runTestConfig(t, tt, testStream)
+			sequentialGroup.Done()
+		})
+		sequentialGroup.Wait()
+		sequentialGroup.Add(1)
+	}
+}
+
+func TestTxWrapperDryRun(t *testing.T) {
+	reqr := require.New(t)
+	tx := NewDummyTxWrapper("test").WithDryRun()
+	res, err := tx.ExecContext(context.Background(), "CREATE TABLE t (id int)")
+	reqr.NoError(err)
+	affected, _ := res.RowsAffected()
+	reqr.Equal(int64(0), affected)
+	_, err = tx.ExecContext(context.Background(), "INSERT INTO t VALUES ($1)", 1)
+	reqr.NoError(err)
+	reqr.Equal([]string{"CREATE TABLE t (id int)", "INSERT INTO t VALUES ($1)"}, tx.DryRunStatements())
+}
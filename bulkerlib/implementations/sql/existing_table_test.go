@@ -154,3 +154,81 @@ func TestExistingTable2(t *testing.T) {
 		sequentialGroup.Add(1)
 	}
 }
+
+func TestExistingTableTypeCoercionErrors(t *testing.T) {
+	t.Parallel()
+	configIds := utils.ArrayIntersection(allBulkerConfigs, []string{PostgresBulkerTypeId, MySQLBulkerTypeId, RedshiftBulkerTypeId, SnowflakeBulkerTypeId, BigqueryBulkerTypeId})
+	tests := []bulkerTestConfig{
+		{
+			//delete any table leftovers from previous tests
+			name:           "existing_table3_cleanup",
+			tableName:      "existing_table3_test",
+			modes:          []bulker.BulkMode{bulker.Batch, bulker.Stream},
+			dataFile:       "test_data/empty.ndjson",
+			expectedErrors: map[string]any{"create_stream_bigquery_stream": BigQueryAutocommitUnsupported},
+			configIds:      configIds,
+		},
+		{
+			name:                "existing_table3_create_table",
+			tableName:           "existing_table3_test",
+			modes:               []bulker.BulkMode{bulker.Batch, bulker.Stream},
+			dataFile:            "test_data/existing_table_num.ndjson",
+			leaveResultingTable: true,
+			expectedErrors:      map[string]any{"create_stream_bigquery_stream": BigQueryAutocommitUnsupported},
+			configIds:           configIds,
+		},
+		{
+			name:                "existing_table3_null_policy",
+			tableName:           "existing_table3_test",
+			modes:               []bulker.BulkMode{bulker.Batch, bulker.Stream},
+			leaveResultingTable: true,
+			dataFile:            "test_data/existing_table2.ndjson",
+			expectedRows: []map[string]any{
+				{"id": 1, "data": 1},
+				{"id": 1, "data": 1},
+				{"id": 2, "data": nil},
+			},
+			expectedErrors: map[string]any{"create_stream_bigquery_stream": BigQueryAutocommitUnsupported},
+			configIds:      configIds,
+			streamOptions:  []bulker.StreamOption{WithTypeCoercionErrors(&TypeCoercionErrorsConfig{Fields: map[string]CoercionPolicy{"data": CoercionPolicyNull}})},
+		},
+		{
+			name:                "existing_table3_dlq_policy",
+			tableName:           "existing_table3_test",
+			modes:               []bulker.BulkMode{bulker.Batch, bulker.Stream},
+			leaveResultingTable: true,
+			dataFile:            "test_data/existing_table2.ndjson",
+			ignoreConsumeErrors: true,
+			expectedRows: []map[string]any{
+				{"id": 1, "data": 1},
+				{"id": 1, "data": 1},
+				{"id": 1, "data": 1},
+				{"id": 2, "data": nil},
+			},
+			expectedErrors: map[string]any{
+				"create_stream_bigquery_stream": BigQueryAutocommitUnsupported,
+				"consume_object_1":              "cannot be coerced",
+			},
+			configIds:     configIds,
+			streamOptions: []bulker.StreamOption{WithTypeCoercionErrors(&TypeCoercionErrorsConfig{Default: CoercionPolicyDLQ})},
+		},
+		{
+			name:           "existing_table3_cleanup",
+			tableName:      "existing_table3_test",
+			modes:          []bulker.BulkMode{bulker.Batch, bulker.Stream},
+			dataFile:       "test_data/empty.ndjson",
+			expectedErrors: map[string]any{"create_stream_bigquery_stream": BigQueryAutocommitUnsupported},
+			configIds:      configIds,
+		},
+	}
+	sequentialGroup := sync.WaitGroup{}
+	sequentialGroup.Add(1)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runTestConfig(t, tt, testStream)
+			sequentialGroup.Done()
+		})
+		sequentialGroup.Wait()
+		sequentialGroup.Add(1)
+	}
+}
@@ -0,0 +1,330 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	types2 "github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/errorj"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"github.com/jitsucom/bulker/jitsubase/uuid"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func init() {
+	bulker.RegisterBulker(GreenplumBulkerTypeId, NewGreenplum)
+	bulker.RegisterConfigType(GreenplumBulkerTypeId, GreenplumConfig{})
+}
+
+const (
+	GreenplumBulkerTypeId = "greenplum"
+
+	// GreenplumLoadMethodCopy batch files are loaded with COPY FROM STDIN through coordinator like in Postgres
+	GreenplumLoadMethodCopy = "copy"
+	// GreenplumLoadMethodGpfdist batch files are placed to directory served by gpfdist and loaded by segments in parallel via external table
+	GreenplumLoadMethodGpfdist = "gpfdist"
+	// GreenplumLoadMethodProgram batch files are placed to directory shared with coordinator host and loaded with COPY FROM PROGRAM
+	GreenplumLoadMethodProgram = "program"
+
+	gpCreateTableTemplate         = `CREATE TABLE %s (%s) %s`
+	gpSetDistributionTemplate     = `ALTER TABLE %s SET DISTRIBUTED BY (%s)`
+	gpCreateExternalTableTemplate = `CREATE READABLE EXTERNAL TABLE %s (%s) LOCATION ('%s') FORMAT 'CSV' (HEADER NULL '\N') ENCODING 'UTF8'`
+	gpDropExternalTableTemplate   = `DROP EXTERNAL TABLE IF EXISTS %s`
+	gpInsertFromExternalTemplate  = `INSERT INTO %s (%s) SELECT %s FROM %s`
+	gpCopyFromProgramTemplate     = `COPY %s (%s) FROM PROGRAM '%s' CSV HEADER NULL '\N'`
+)
+
+// GreenplumConfig dto for deserialized Greenplum config
+type GreenplumConfig struct {
+	PostgresConfig `mapstructure:",squash"`
+	// LoadMethod how batch files are loaded: 'copy' (default), 'gpfdist' or 'program'
+	LoadMethod string `mapstructure:"loadMethod,omitempty" json:"loadMethod,omitempty" yaml:"loadMethod,omitempty"`
+	// StagingDir local directory where batch files are placed for loading.
+	// For 'gpfdist' it must be served by gpfdist, for 'program' it must be accessible from coordinator host
+	StagingDir string `mapstructure:"stagingDir,omitempty" json:"stagingDir,omitempty" yaml:"stagingDir,omitempty"`
+	// GpfdistURL url of gpfdist serving StagingDir e.g. gpfdist://etl-host:8081
+	GpfdistURL string `mapstructure:"gpfdistUrl,omitempty" json:"gpfdistUrl,omitempty" yaml:"gpfdistUrl,omitempty"`
+	// ProgramCommand command executed on coordinator host to read batch file. %s is replaced with batch file name
+	// e.g. 'cat /data/staging/%s'. Requires superuser or pg_execute_server_program role
+	ProgramCommand string `mapstructure:"programCommand,omitempty" json:"programCommand,omitempty" yaml:"programCommand,omitempty"`
+}
+
+func (gc *GreenplumConfig) Validate() error {
+	if err := gc.PostgresConfig.Validate(); err != nil {
+		return err
+	}
+	switch gc.LoadMethod {
+	case GreenplumLoadMethodCopy:
+	case GreenplumLoadMethodGpfdist:
+		if gc.StagingDir == "" || gc.GpfdistURL == "" {
+			return errors.New("'stagingDir' and 'gpfdistUrl' are required for 'gpfdist' load method")
+		}
+	case GreenplumLoadMethodProgram:
+		if gc.StagingDir == "" || !strings.Contains(gc.ProgramCommand, "%s") {
+			return errors.New("'stagingDir' and 'programCommand' with %s placeholder for file name are required for 'program' load method")
+		}
+	default:
+		return fmt.Errorf("unsupported load method: %s", gc.LoadMethod)
+	}
+	return nil
+}
+
+// Greenplum is adapter for Greenplum. It uses Postgres wire protocol with following differences:
+//
+// - tables are distributed by primary key columns or randomly if table has no primary key;
+//
+// - batch files may be loaded in parallel by segments through gpfdist external tables or with COPY FROM PROGRAM,
+// which is much faster than COPY FROM STDIN for large backfills.
+type Greenplum struct {
+	*Postgres
+	gpConfig *GreenplumConfig
+}
+
+// NewGreenplum returns configured Greenplum bulker.Bulker instance
+func NewGreenplum(bulkerConfig bulker.Config) (bulker.Bulker, error) {
+	config := &GreenplumConfig{}
+	if err := utils.ParseObject(bulkerConfig.DestinationConfig, config); err != nil {
+		return nil, fmt.Errorf("failed to parse destination config: %v", err)
+	}
+	if config.Port == 0 {
+		config.Port = 5432
+	}
+	config.LoadMethod = utils.DefaultString(strings.ToLower(config.LoadMethod), GreenplumLoadMethodCopy)
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	bulkerConfig.DestinationConfig = config.PostgresConfig
+	postgres, err := NewPostgres(bulkerConfig)
+	if err != nil {
+		return nil, err
+	}
+	g := &Greenplum{Postgres: postgres.(*Postgres), gpConfig: config}
+	if config.LoadMethod != GreenplumLoadMethodCopy {
+		g.batchFileFormat = types2.FileFormatCSV
+	}
+	return g, nil
+}
+
+func (g *Greenplum) CreateStream(id, tableName string, mode bulker.BulkMode, streamOptions ...bulker.StreamOption) (bulker.BulkerStream, error) {
+	streamOptions = append(streamOptions, withLocalBatchFile(fmt.Sprintf("bulker_%s", utils.SanitizeString(id))))
+
+	if err := g.validateOptions(streamOptions); err != nil {
+		return nil, err
+	}
+	switch mode {
+	case bulker.Stream:
+		return newAutoCommitStream(id, g, tableName, streamOptions...)
+	case bulker.Batch:
+		return newTransactionalStream(id, g, tableName, streamOptions...)
+	case bulker.ReplaceTable:
+		return newReplaceTableStream(id, g, tableName, streamOptions...)
+	case bulker.ReplacePartition:
+		return newReplacePartitionStream(id, g, tableName, streamOptions...)
+	case bulker.UpdateColumns:
+		return newUpdateColumnsStream(id, g, tableName, streamOptions...)
+	case bulker.SCD2:
+		return newSCD2Stream(id, g, tableName, streamOptions...)
+	case bulker.CDC:
+		return newCDCStream(id, g, tableName, streamOptions...)
+	}
+	return nil, fmt.Errorf("unsupported bulk mode: %s", mode)
+}
+
+// Type returns Greenplum type
+func (g *Greenplum) Type() string {
+	return GreenplumBulkerTypeId
+}
+
+// OpenTx opens underline sql transaction and return wrapped instance
+func (g *Greenplum) OpenTx(ctx context.Context) (*TxSQLAdapter, error) {
+	return g.openTx(ctx, g)
+}
+
+// CreateTable creates table distributed by primary key columns. Tables without primary key are distributed randomly
+func (g *Greenplum) CreateTable(ctx context.Context, schemaToCreate *Table) error {
+	quotedTableName := g.quotedTable(schemaToCreate)
+	columns := schemaToCreate.CreateColumnNames()
+	columnsDDL := make([]string, len(columns))
+	for i, columnName := range columns {
+		columnsDDL[i] = g.columnDDL(columnName, schemaToCreate)
+	}
+	distribution := "DISTRIBUTED RANDOMLY"
+	if len(schemaToCreate.PKFields) > 0 {
+		distribution = fmt.Sprintf("DISTRIBUTED BY (%s)", strings.Join(g.quotedPKColumns(schemaToCreate), ","))
+	}
+	query := fmt.Sprintf(gpCreateTableTemplate, quotedTableName, strings.Join(columnsDDL, ", "), distribution)
+
+	if _, err := g.txOrDb(ctx).ExecContext(ctx, query); err != nil {
+		return errorj.CreateTableError.Wrap(err, "failed to create table").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Table:       quotedTableName,
+				PrimaryKeys: schemaToCreate.GetPKFields(),
+				Statement:   query,
+			})
+	}
+	if err := g.createPrimaryKey(ctx, schemaToCreate); err != nil {
+		_ = g.DropTable(ctx, schemaToCreate.Name, true)
+		return err
+	}
+	if !schemaToCreate.Temporary && schemaToCreate.TimestampColumn != "" {
+		if err := g.createIndex(ctx, schemaToCreate); err != nil {
+			_ = g.DropTable(ctx, schemaToCreate.Name, true)
+			return fmt.Errorf("failed to create sort key: %v", err)
+		}
+	}
+	return g.createComments(ctx, schemaToCreate)
+}
+
+// PatchTableSchema changes distribution key before adding primary key: primary key must include all distribution key columns
+func (g *Greenplum) PatchTableSchema(ctx context.Context, patchTable *Table) error {
+	if len(patchTable.PKFields) > 0 {
+		quotedTableName := g.quotedTable(patchTable)
+		statement := fmt.Sprintf(gpSetDistributionTemplate, quotedTableName, strings.Join(g.quotedPKColumns(patchTable), ","))
+		if _, err := g.txOrDb(ctx).ExecContext(ctx, statement); err != nil {
+			return errorj.AlterTableError.Wrap(err, "failed to change distribution key").
+				WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+					Table:       quotedTableName,
+					PrimaryKeys: patchTable.GetPKFields(),
+					Statement:   statement,
+				})
+		}
+	}
+	return g.Postgres.PatchTableSchema(ctx, patchTable)
+}
+
+func (g *Greenplum) ReplaceTable(ctx context.Context, targetTableName string, replacementTable *Table, dropOldTable bool) (err error) {
+	targetTable := replacementTable.Clone()
+	targetTable.Name = targetTableName
+	if targetTable.PrimaryKeyName != "" {
+		targetTable.PrimaryKeyName = BuildConstraintName(targetTableName)
+	}
+	if _, err = g.tableHelper.EnsureTableWithoutCaching(ctx, g, g.ID, targetTable); err != nil {
+		return err
+	}
+	if err = g.TruncateTable(ctx, targetTableName); err != nil {
+		return err
+	}
+	if _, err = g.CopyTables(ctx, targetTable, replacementTable, 0); err != nil {
+		return err
+	}
+	if dropOldTable {
+		return g.DropTable(ctx, replacementTable.Name, true)
+	}
+	return nil
+}
+
+func (g *Greenplum) LoadTable(ctx context.Context, targetTable *Table, loadSource *LoadSource) (state *bulker.WarehouseState, err error) {
+	if g.gpConfig.LoadMethod == GreenplumLoadMethodCopy {
+		return g.Postgres.LoadTable(ctx, targetTable, loadSource)
+	}
+	if loadSource.Type != LocalFile {
+		return state, fmt.Errorf("LoadTable: only local file is supported")
+	}
+	if loadSource.Format != g.batchFileFormat {
+		return state, fmt.Errorf("LoadTable: only %s format is supported", g.batchFileFormat)
+	}
+	fileName, err := g.stageFile(loadSource.Path)
+	if err != nil {
+		return state, errorj.LoadError.Wrap(err, "failed to place batch file to staging dir")
+	}
+	defer func() {
+		_ = os.Remove(filepath.Join(g.gpConfig.StagingDir, fileName))
+	}()
+	if g.gpConfig.LoadMethod == GreenplumLoadMethodGpfdist {
+		return state, g.loadWithGpfdist(ctx, targetTable, fileName)
+	}
+	return state, g.loadWithProgram(ctx, targetTable, fileName)
+}
+
+// loadWithGpfdist loads file through temporary external table. Segments read file from gpfdist in parallel
+func (g *Greenplum) loadWithGpfdist(ctx context.Context, targetTable *Table, fileName string) error {
+	quotedTableName := g.quotedTable(targetTable)
+	quotedExtTableName := g.quotedTableName(fmt.Sprintf("bulker_ext_%s", uuid.NewLettersNumbers()))
+	columns := targetTable.SortedColumnNames()
+	columnNames := make([]string, len(columns))
+	columnsDDL := make([]string, len(columns))
+	for i, name := range columns {
+		columnNames[i] = g.quotedColumnName(name)
+		columnsDDL[i] = columnNames[i] + " " + targetTable.Columns[name].GetDDLType()
+	}
+	location := strings.TrimSuffix(g.gpConfig.GpfdistURL, "/") + "/" + fileName
+	statements := []string{
+		fmt.Sprintf(gpCreateExternalTableTemplate, quotedExtTableName, strings.Join(columnsDDL, ", "), escapeSQLString(location)),
+		fmt.Sprintf(gpInsertFromExternalTemplate, quotedTableName, strings.Join(columnNames, ", "), strings.Join(columnNames, ", "), quotedExtTableName),
+	}
+	defer func() {
+		_, _ = g.txOrDb(ctx).ExecContext(ctx, fmt.Sprintf(gpDropExternalTableTemplate, quotedExtTableName))
+	}()
+	for _, statement := range statements {
+		if _, err := g.txOrDb(ctx).ExecContext(ctx, statement); err != nil {
+			return errorj.LoadError.Wrap(err, "failed to load table with gpfdist").
+				WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+					Schema:      g.config.Schema,
+					Table:       quotedTableName,
+					PrimaryKeys: targetTable.GetPKFields(),
+					Statement:   statement,
+				})
+		}
+	}
+	return nil
+}
+
+// loadWithProgram loads file with COPY FROM PROGRAM executed on coordinator host
+func (g *Greenplum) loadWithProgram(ctx context.Context, targetTable *Table, fileName string) error {
+	quotedTableName := g.quotedTable(targetTable)
+	columns := targetTable.SortedColumnNames()
+	columnNames := make([]string, len(columns))
+	for i, name := range columns {
+		columnNames[i] = g.quotedColumnName(name)
+	}
+	command := fmt.Sprintf(g.gpConfig.ProgramCommand, fileName)
+	statement := fmt.Sprintf(gpCopyFromProgramTemplate, quotedTableName, strings.Join(columnNames, ", "), escapeSQLString(command))
+	if _, err := g.txOrDb(ctx).ExecContext(ctx, statement); err != nil {
+		return errorj.LoadError.Wrap(err, "failed to load table with COPY FROM PROGRAM").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Schema:      g.config.Schema,
+				Table:       quotedTableName,
+				PrimaryKeys: targetTable.GetPKFields(),
+				Statement:   statement,
+			})
+	}
+	return nil
+}
+
+// stageFile copies batch file to staging dir under unique name. Returns name of staged file
+func (g *Greenplum) stageFile(path string) (string, error) {
+	fileName := fmt.Sprintf("bulker_%s%s", uuid.NewLettersNumbers(), filepath.Ext(path))
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(filepath.Join(g.gpConfig.StagingDir, fileName), os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+	if err != nil {
+		return "", err
+	}
+	if _, err = io.Copy(dst, src); err != nil {
+		_ = dst.Close()
+		_ = os.Remove(dst.Name())
+		return "", err
+	}
+	return fileName, dst.Close()
+}
+
+func (g *Greenplum) quotedPKColumns(table *Table) []string {
+	pkFields := table.GetPKFields()
+	columnNames := make([]string, len(pkFields))
+	for i, column := range pkFields {
+		columnNames[i] = g.quotedColumnName(column)
+	}
+	return columnNames
+}
+
+// escapeSQLString escapes single quotes for using value in SQL string literal
+func escapeSQLString(value string) string {
+	return strings.ReplaceAll(value, "'", "''")
+}
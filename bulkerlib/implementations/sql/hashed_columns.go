@@ -0,0 +1,130 @@
+package sql
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	jsoniter "github.com/json-iterator/go"
+	"hash"
+)
+
+const (
+	HashSHA256     = "sha256"
+	HashSHA512     = "sha512"
+	HashMD5        = "md5"
+	HashHMACSHA256 = "hmac-sha256"
+)
+
+// HashedColumns fields which values are replaced with hex encoded hashes. Salt is prepended to values before hashing,
+// for 'hmac-sha256' algorithm it is used as a key
+type HashedColumns struct {
+	Columns   []string `json:"columns"`
+	Algorithm string   `json:"algorithm,omitempty"`
+	Salt      string   `json:"salt,omitempty"`
+}
+
+// HashedColumnsOption - event fields (e.g. email, IP) which values are hashed during preprocessing,
+// so they never land to batch files or destination tables in cleartext.
+// Nested fields are addressed with dot separated paths, e.g. "context.ip". Supported algorithms: sha256 (default), sha512, md5, hmac-sha256
+var HashedColumnsOption = bulker.ImplementationOption[HashedColumns]{
+	Key:       "hashedColumns",
+	ParseFunc: parseHashedColumns,
+}
+
+// WithHashedColumns hashes values of provided fields with algorithm and salt. See HashedColumnsOption
+func WithHashedColumns(columns []string, algorithm, salt string) bulker.StreamOption {
+	return bulker.WithOption(&HashedColumnsOption, HashedColumns{Columns: columns, Algorithm: algorithm, Salt: salt})
+}
+
+func parseHashedColumns(serialized any) (HashedColumns, error) {
+	hashed := HashedColumns{}
+	switch v := serialized.(type) {
+	case HashedColumns:
+		hashed = v
+	case string:
+		if err := json.Unmarshal([]byte(v), &hashed); err != nil {
+			return hashed, fmt.Errorf("failed to parse 'hashedColumns' option: %v", err)
+		}
+	case map[string]any:
+		b, _ := jsoniter.Marshal(v)
+		if err := jsoniter.Unmarshal(b, &hashed); err != nil {
+			return hashed, fmt.Errorf("failed to parse 'hashedColumns' option: %v", err)
+		}
+	default:
+		return hashed, fmt.Errorf("failed to parse 'hashedColumns' option: %v incorrect type: %T expected object", v, v)
+	}
+	if _, err := newHashFunc(hashed.Algorithm, hashed.Salt); err != nil {
+		return hashed, fmt.Errorf("failed to parse 'hashedColumns' option: %v", err)
+	}
+	return hashed, nil
+}
+
+// columnsHasher replaces values of fields with their hashes. See HashedColumnsOption
+type columnsHasher struct {
+	paths [][]string
+	hash  func(value string) string
+}
+
+// newColumnsHasher returns nil if there are no columns to hash
+func newColumnsHasher(hashed HashedColumns) (*columnsHasher, error) {
+	if len(hashed.Columns) == 0 {
+		return nil, nil
+	}
+	hashFunc, err := newHashFunc(hashed.Algorithm, hashed.Salt)
+	if err != nil {
+		return nil, err
+	}
+	ch := &columnsHasher{hash: hashFunc}
+	for _, column := range hashed.Columns {
+		path, err := parseFieldPath(column)
+		if err != nil {
+			return nil, fmt.Errorf("hashed column '%s': %v", column, err)
+		}
+		ch.paths = append(ch.paths, path)
+	}
+	return ch, nil
+}
+
+func newHashFunc(algorithm, salt string) (func(value string) string, error) {
+	var newHash func() hash.Hash
+	switch utils.DefaultString(algorithm, HashSHA256) {
+	case HashSHA256:
+		newHash = sha256.New
+	case HashSHA512:
+		newHash = sha512.New
+	case HashMD5:
+		newHash = md5.New
+	case HashHMACSHA256:
+		key := []byte(salt)
+		return func(value string) string {
+			h := hmac.New(sha256.New, key)
+			h.Write([]byte(value))
+			return hex.EncodeToString(h.Sum(nil))
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown hash algorithm '%s'. Supported algorithms: %s, %s, %s, %s", algorithm, HashSHA256, HashSHA512, HashMD5, HashHMACSHA256)
+	}
+	return func(value string) string {
+		h := newHash()
+		h.Write([]byte(salt))
+		h.Write([]byte(value))
+		return hex.EncodeToString(h.Sum(nil))
+	}, nil
+}
+
+// hashColumns returns object with values of hashed fields replaced with hashes. Source object isn't modified
+func (ch *columnsHasher) hashColumns(object types.Object) types.Object {
+	for _, path := range ch.paths {
+		object = updateField(object, path, func(value any) any {
+			return ch.hash(stringValue(value))
+		})
+	}
+	return object
+}
@@ -0,0 +1,37 @@
+package sql
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestHashedColumns(t *testing.T) {
+	hashed, err := parseHashedColumns(`{"columns": ["email", "context.ip", "missing"], "salt": "pepper"}`)
+	require.NoError(t, err)
+	hasher, err := newColumnsHasher(hashed)
+	require.NoError(t, err)
+	object := types.Object{
+		"id":      1,
+		"email":   "john@example.com",
+		"context": map[string]any{"ip": "10.0.0.1", "page": "/index"},
+	}
+	result := hasher.hashColumns(object)
+	sum := sha256.Sum256([]byte("pepperjohn@example.com"))
+	require.Equal(t, hex.EncodeToString(sum[:]), result["email"])
+	require.Len(t, result["context"].(map[string]any)["ip"], 64)
+	require.Equal(t, "/index", result["context"].(map[string]any)["page"])
+	require.NotContains(t, result, "missing")
+	//source object isn't modified
+	require.Equal(t, "john@example.com", object["email"])
+	require.Equal(t, "10.0.0.1", object["context"].(map[string]any)["ip"])
+
+	hmacHasher, err := newColumnsHasher(HashedColumns{Columns: []string{"email"}, Algorithm: HashHMACSHA256, Salt: "pepper"})
+	require.NoError(t, err)
+	require.NotEqual(t, result["email"], hmacHasher.hashColumns(object)["email"])
+
+	_, err = parseHashedColumns(map[string]any{"columns": []any{"email"}, "algorithm": "crc32"})
+	require.ErrorContains(t, err, "unknown hash algorithm")
+}
@@ -0,0 +1,112 @@
+package sql
+
+import (
+	"context"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/errorj"
+	"github.com/jitsucom/bulker/jitsubase/logging"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"time"
+)
+
+const (
+	// IdempotencyKeysTable destination metadata table where idempotency keys of completed streams are recorded
+	IdempotencyKeysTable = "_bulker_idempotency_keys"
+
+	idempotencyKeyColumn         = "idempotency_key"
+	idempotencyTableNameColumn   = "table_name"
+	idempotencyCompletedAtColumn = "completed_at"
+)
+
+// skipDuplicate checks whether stream with the same idempotency key was already completed for the destination table.
+// When so, marks state as duplicate: Complete must not load anything.
+// Key is recorded in postComplete in the same transaction as loaded data. Primary key on (key, table) makes
+// concurrent Complete of the same key fail on insert and roll back its data, see completedConcurrently.
+// Databases that don't enforce primary keys (Snowflake, Redshift, ClickHouse) rely on the check only.
+// Only transactional streams support idempotency key: Stream mode writes events one by one and ignores it.
+func (ps *AbstractTransactionalSQLStream) skipDuplicate(ctx context.Context) (bool, error) {
+	key := bulker.IdempotencyKeyOption.Get(&ps.options)
+	if key == "" {
+		return false, nil
+	}
+	adapter := ps.idempotencyAdapter()
+	th := ps.sqlAdapter.TableHelper()
+	table := th.MapSchema(ps.sqlAdapter, types.Schema{Name: IdempotencyKeysTable, Fields: []types.SchemaField{
+		{Name: idempotencyKeyColumn, Type: types.STRING},
+		{Name: idempotencyTableNameColumn, Type: types.STRING},
+		{Name: idempotencyCompletedAtColumn, Type: types.TIMESTAMP},
+	}})
+	table.PKFields = utils.NewSet(th.ColumnName(idempotencyKeyColumn), th.ColumnName(idempotencyTableNameColumn))
+	table.PrimaryKeyName = BuildConstraintName(table.Name)
+	table, err := th.EnsureTableWithoutCaching(ctx, adapter, ps.id, table)
+	if err != nil {
+		return false, errorj.Decorate(err, "failed to ensure idempotency keys table")
+	}
+	ps.idempotencyTable = table
+	completed, err := ps.idempotencyKeyExists(ctx, adapter)
+	if err != nil {
+		return false, errorj.Decorate(err, "failed to check idempotency key")
+	}
+	if completed {
+		logging.Infof("[%s] Stream with idempotency key %s was already completed for table %s. Skipping.", ps.id, key, ps.tableName)
+		ps.markDuplicate()
+	}
+	return completed, nil
+}
+
+// completedConcurrently is called after transaction of the stream was rolled back because of loadErr.
+// Returns true if stream with the same idempotency key was completed concurrently:
+// in that case insert of the key conflicted with primary key and the stream is a duplicate, not a failure.
+func (ps *AbstractTransactionalSQLStream) completedConcurrently(ctx context.Context, loadErr error) bool {
+	if ps.idempotencyTable == nil || ps.state.Duplicate {
+		return false
+	}
+	completed, err := ps.idempotencyKeyExists(ctx, ps.sqlAdapter)
+	if err != nil || !completed {
+		return false
+	}
+	logging.Infof("[%s] Stream with idempotency key %s was completed concurrently for table %s. Rolled back: %v", ps.id, bulker.IdempotencyKeyOption.Get(&ps.options), ps.tableName, loadErr)
+	ps.markDuplicate()
+	return true
+}
+
+func (ps *AbstractTransactionalSQLStream) idempotencyKeyExists(ctx context.Context, adapter SQLAdapter) (bool, error) {
+	conditions := NewWhenConditions(ps.sqlAdapter.ColumnName(idempotencyKeyColumn), "=", bulker.IdempotencyKeyOption.Get(&ps.options)).
+		Add(ps.sqlAdapter.ColumnName(idempotencyTableNameColumn), "=", ps.tableName)
+	count, err := adapter.Count(ctx, ps.idempotencyTable.Name, conditions)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (ps *AbstractTransactionalSQLStream) markDuplicate() {
+	ps.state.Duplicate = true
+	ps.state.SuccessfulRows = 0
+}
+
+// recordIdempotencyKey saves idempotency key of successfully completed stream in the stream transaction.
+// Plain insert (not merge) fails on primary key conflict if the same key was recorded concurrently
+func (ps *AbstractTransactionalSQLStream) recordIdempotencyKey(ctx context.Context) error {
+	if ps.idempotencyTable == nil || ps.state.Duplicate {
+		return nil
+	}
+	err := ps.idempotencyAdapter().Insert(ctx, ps.idempotencyTable, false, types.Object{
+		ps.sqlAdapter.ColumnName(idempotencyKeyColumn):         bulker.IdempotencyKeyOption.Get(&ps.options),
+		ps.sqlAdapter.ColumnName(idempotencyTableNameColumn):   ps.tableName,
+		ps.sqlAdapter.ColumnName(idempotencyCompletedAtColumn): time.Now().UTC(),
+	})
+	if err != nil {
+		return errorj.Decorate(err, "failed to record idempotency key")
+	}
+	return nil
+}
+
+// idempotencyAdapter returns stream transaction if it is opened. Otherwise, adapter itself
+func (ps *AbstractTransactionalSQLStream) idempotencyAdapter() SQLAdapter {
+	if ps.tx != nil {
+		return ps.tx
+	}
+	return ps.sqlAdapter
+}
@@ -0,0 +1,136 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestIdempotencyKey checks that Complete of a stream with already completed idempotency key doesn't load anything
+func TestIdempotencyKey(t *testing.T) {
+	t.Parallel()
+	// keys are kept in destination between test runs
+	key := fmt.Sprintf("key_%d", time.Now().UnixNano())
+	tests := []bulkerTestConfig{
+		{
+			//delete any table leftovers from previous tests
+			name:      "dummy_test_table_cleanup",
+			tableName: "idempotency_key_test",
+			modes:     []bulker.BulkMode{bulker.Batch},
+			dataFile:  "test_data/empty.ndjson",
+			configIds: utils.ArrayIntersection(allBulkerConfigs, exceptBigquery),
+		},
+		{
+			name:                "first_load",
+			tableName:           "idempotency_key_test",
+			modes:               []bulker.BulkMode{bulker.Batch},
+			leaveResultingTable: true,
+			dataFile:            "test_data/partition1.ndjson",
+			expectedRowsCount:   5,
+			streamOptions:       []bulker.StreamOption{bulker.WithIdempotencyKey(key)},
+			configIds:           utils.ArrayIntersection(allBulkerConfigs, exceptBigquery),
+		},
+		{
+			name:                "replayed_load",
+			tableName:           "idempotency_key_test",
+			modes:               []bulker.BulkMode{bulker.Batch},
+			leaveResultingTable: true,
+			dataFile:            "test_data/partition2.ndjson",
+			// rows of replayed load are skipped
+			expectedRowsCount: 5,
+			streamOptions:     []bulker.StreamOption{bulker.WithIdempotencyKey(key)},
+			configIds:         utils.ArrayIntersection(allBulkerConfigs, exceptBigquery),
+		},
+		{
+			name:                "new_key_load",
+			tableName:           "idempotency_key_test",
+			modes:               []bulker.BulkMode{bulker.Batch},
+			leaveResultingTable: true,
+			dataFile:            "test_data/partition2.ndjson",
+			expectedRowsCount:   14,
+			streamOptions:       []bulker.StreamOption{bulker.WithIdempotencyKey(key + "_2")},
+			configIds:           utils.ArrayIntersection(allBulkerConfigs, exceptBigquery),
+		},
+		{
+			name:      "dummy_test_table_cleanup",
+			tableName: "idempotency_key_test",
+			modes:     []bulker.BulkMode{bulker.Batch},
+			dataFile:  "test_data/empty.ndjson",
+			configIds: utils.ArrayIntersection(allBulkerConfigs, exceptBigquery),
+		},
+	}
+	sequentialGroup := sync.WaitGroup{}
+	sequentialGroup.Add(1)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runTestConfig(t, tt, testStream)
+			sequentialGroup.Done()
+		})
+		sequentialGroup.Wait()
+		sequentialGroup.Add(1)
+	}
+}
+
+// TestIdempotencyKeyDuplicateComplete completes two streams with the same idempotency key: the second one loads nothing
+func TestIdempotencyKeyDuplicateComplete(t *testing.T) {
+	t.Parallel()
+	tests := []bulkerTestConfig{
+		{
+			name:      "duplicate_complete",
+			tableName: "idempotency_key_duplicate_test",
+			modes:     []bulker.BulkMode{bulker.Batch, bulker.ReplaceTable},
+			configIds: utils.ArrayIntersection(allBulkerConfigs, exceptBigquery),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runTestConfig(t, tt, testDuplicateComplete)
+		})
+	}
+}
+
+func testDuplicateComplete(t *testing.T, testConfig bulkerTestConfig, mode bulker.BulkMode) {
+	reqr := require.New(t)
+	blk, err := bulker.CreateBulker(*testConfig.config)
+	reqr.NoError(err)
+	defer func() {
+		_ = blk.Close()
+	}()
+	sqlAdapter, ok := blk.(SQLAdapter)
+	reqr.True(ok)
+	ctx := context.Background()
+	id, tableName := testConfig.getIdAndTableName(mode)
+	reqr.NoError(sqlAdapter.InitDatabase(ctx))
+	_ = sqlAdapter.DropTable(ctx, tableName, true)
+	defer func() {
+		_ = sqlAdapter.DropTable(ctx, tableName, true)
+	}()
+	key := fmt.Sprintf("key_%s_%d", mode, time.Now().UnixNano())
+
+	for i, duplicate := range []bool{false, true} {
+		stream, err := blk.CreateStream(id, tableName, mode, bulker.WithIdempotencyKey(key))
+		reqr.NoError(err)
+		for j := 1; j <= 3; j++ {
+			_, _, err = stream.Consume(ctx, types.Object{"id": i*10 + j, "name": "test"})
+			reqr.NoError(err)
+		}
+		state, err := stream.Complete(ctx)
+		reqr.NoError(err)
+		reqr.Equal(duplicate, state.Duplicate)
+		if duplicate {
+			reqr.Equal(0, state.SuccessfulRows)
+		} else {
+			reqr.Equal(3, state.SuccessfulRows)
+		}
+	}
+
+	count, err := sqlAdapter.Count(ctx, tableName, nil)
+	reqr.NoError(err)
+	reqr.Equal(3, count)
+}
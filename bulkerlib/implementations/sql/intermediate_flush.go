@@ -0,0 +1,115 @@
+package sql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/jitsubase/logging"
+	"time"
+)
+
+// intermediateFlushSizeCheckRows size of batch file is checked every N written rows
+const intermediateFlushSizeCheckRows = 1000
+
+// IntermediateFlushOption - batch file is loaded to tmp table of the stream when it reaches any of the limits,
+// so long-running streams (e.g. backfills) don't need to keep the whole batch on local disk.
+// Data is still committed to destination table atomically on Complete.
+// {"maxRows": 1000000, "maxSizeMb": 1024, "maxMinutes": 30}
+var IntermediateFlushOption = bulker.ImplementationOption[*IntermediateFlushConfig]{
+	Key:       "intermediateFlush",
+	ParseFunc: parseIntermediateFlushConfig,
+}
+
+// IntermediateFlushConfig limits of batch file that trigger intermediate flush. See IntermediateFlushOption
+type IntermediateFlushConfig struct {
+	// MaxRows flush when batch file contains at least N rows
+	MaxRows int `json:"maxRows,omitempty"`
+	// MaxSizeMb flush when batch file size is at least N megabytes. Size is checked every 1000 rows
+	MaxSizeMb int `json:"maxSizeMb,omitempty"`
+	// MaxMinutes flush when batch file was started at least N minutes ago. Checked when row is written
+	MaxMinutes int `json:"maxMinutes,omitempty"`
+}
+
+// Validate returns err if invalid
+func (c *IntermediateFlushConfig) Validate() error {
+	if c.MaxRows < 0 || c.MaxSizeMb < 0 || c.MaxMinutes < 0 {
+		return fmt.Errorf("intermediateFlush limits must not be negative")
+	}
+	if c.MaxRows == 0 && c.MaxSizeMb == 0 && c.MaxMinutes == 0 {
+		return fmt.Errorf("intermediateFlush requires maxRows, maxSizeMb or maxMinutes")
+	}
+	return nil
+}
+
+// due returns true if batch file with provided number of rows, size (negative - unknown) and age should be flushed
+func (c *IntermediateFlushConfig) due(rows int, sizeBytes int64, age time.Duration) bool {
+	return (c.MaxRows > 0 && rows >= c.MaxRows) ||
+		(c.MaxSizeMb > 0 && sizeBytes >= int64(c.MaxSizeMb)*1024*1024) ||
+		(c.MaxMinutes > 0 && age >= time.Duration(c.MaxMinutes)*time.Minute)
+}
+
+func parseIntermediateFlushConfig(serialized any) (*IntermediateFlushConfig, error) {
+	var raw []byte
+	switch v := serialized.(type) {
+	case *IntermediateFlushConfig:
+		return v, v.Validate()
+	case string:
+		raw = []byte(v)
+	default:
+		var err error
+		raw, err = json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value type of intermediateFlush option: %T", v)
+		}
+	}
+	config := &IntermediateFlushConfig{}
+	if err := json.Unmarshal(raw, config); err != nil {
+		return nil, fmt.Errorf("failed to parse intermediateFlush config: %v", err)
+	}
+	return config, config.Validate()
+}
+
+// WithIntermediateFlush loads batch file to tmp table when it reaches any of provided limits
+func WithIntermediateFlush(config IntermediateFlushConfig) bulker.StreamOption {
+	return bulker.WithOption(&IntermediateFlushOption, &config)
+}
+
+// validateIntermediateFlushOption checks that stream supports intermediate flush
+func validateIntermediateFlushOption(merge bool, config *IntermediateFlushConfig) error {
+	if config == nil {
+		return nil
+	}
+	if merge {
+		//rows of different flushes can't be deduplicated within tmp table
+		return fmt.Errorf("intermediateFlush option is not supported with deduplication")
+	}
+	return nil
+}
+
+// flushIfNeeded loads batch file to tmp table and starts a new batch file when batch file reaches limits of IntermediateFlushOption
+func (ps *AbstractTransactionalSQLStream) flushIfNeeded(ctx context.Context) error {
+	if ps.intermediateFlush == nil {
+		return nil
+	}
+	var sizeBytes int64 = -1
+	if ps.intermediateFlush.MaxSizeMb > 0 && ps.eventsInBatch%intermediateFlushSizeCheckRows == 0 {
+		if stat, err := ps.batchFile.Stat(); err == nil {
+			sizeBytes = stat.Size()
+		}
+	}
+	if !ps.intermediateFlush.due(ps.eventsInBatch, sizeBytes, time.Since(ps.batchFileStarted)) {
+		return nil
+	}
+	rows := ps.eventsInBatch
+	ws, err := ps.flushBatchFile(ctx)
+	ps.state.AddWarehouseState(ws)
+	if err != nil {
+		return err
+	}
+	ps.flushes++
+	ps.flushedTmpTable = ps.tmpTable.Clone()
+	ps.eventsInBatch = 0
+	logging.Infof("[%s] Intermediate flush #%d: %d rows loaded to %s", ps.id, ps.flushes, rows, ps.tmpTable.Name)
+	return ps.initBatchFile(localBatchFileOption.Get(&ps.options))
+}
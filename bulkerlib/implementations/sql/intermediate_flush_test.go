@@ -0,0 +1,54 @@
+package sql
+
+import (
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestIntermediateFlush checks that batch file flushed to tmp table several times is committed as a whole
+func TestIntermediateFlush(t *testing.T) {
+	t.Parallel()
+	tests := []bulkerTestConfig{
+		{
+			name:              "intermediate_flush",
+			tableName:         "intermediate_flush_test",
+			modes:             []bulker.BulkMode{bulker.Batch, bulker.ReplaceTable},
+			dataFile:          "test_data/partition1.ndjson",
+			expectedRowsCount: 5,
+			streamOptions:     []bulker.StreamOption{WithIntermediateFlush(IntermediateFlushConfig{MaxRows: 2})},
+			configIds:         allBulkerConfigs,
+		},
+	}
+	sequentialGroup := sync.WaitGroup{}
+	sequentialGroup.Add(1)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runTestConfig(t, tt, testStream)
+			sequentialGroup.Done()
+		})
+		sequentialGroup.Wait()
+		sequentialGroup.Add(1)
+	}
+}
+
+func TestIntermediateFlushConfig(t *testing.T) {
+	reqr := require.New(t)
+	_, err := parseIntermediateFlushConfig(map[string]any{})
+	reqr.Error(err)
+	_, err = parseIntermediateFlushConfig(`{"maxRows": -1}`)
+	reqr.Error(err)
+
+	config, err := parseIntermediateFlushConfig(`{"maxRows": 100, "maxSizeMb": 1, "maxMinutes": 10}`)
+	reqr.NoError(err)
+	reqr.False(config.due(99, -1, time.Minute))
+	reqr.True(config.due(100, -1, time.Minute))
+	reqr.False(config.due(1, 1024*1024-1, time.Minute))
+	reqr.True(config.due(1, 1024*1024, time.Minute))
+	reqr.True(config.due(1, -1, 10*time.Minute))
+
+	reqr.NoError(validateIntermediateFlushOption(false, config))
+	reqr.Error(validateIntermediateFlushOption(true, config))
+}
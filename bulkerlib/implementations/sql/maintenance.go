@@ -0,0 +1,227 @@
+package sql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	types2 "github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/errorj"
+	"github.com/jitsucom/bulker/jitsubase/logging"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Maintenance tasks. See MaintenanceOption
+const (
+	// MaintenanceAnalyze refreshes table statistics used by query planner
+	MaintenanceAnalyze = "analyze"
+	// MaintenanceVacuum reclaims space of deleted and updated rows
+	MaintenanceVacuum = "vacuum"
+	// MaintenanceOptimize merges table parts or data files
+	MaintenanceOptimize = "optimize"
+
+	// maintenanceTimeout limits time of all maintenance tasks of a single run
+	maintenanceTimeout = time.Hour
+)
+
+// MaintenanceOption - maintenance tasks that run on destination table after successfully committed batches:
+// {"tasks": ["vacuum", "analyze"], "everyBatches": 10, "intervalSec": 3600, "zorderBy": ["user_id"]}
+var MaintenanceOption = bulker.ImplementationOption[*MaintenanceConfig]{
+	Key:       "maintenance",
+	ParseFunc: parseMaintenanceConfig,
+}
+
+// MaintenanceConfig post-load maintenance of destination tables. See MaintenanceOption
+type MaintenanceConfig struct {
+	// Tasks to run in provided order: analyze, vacuum, optimize. Empty - default tasks of destination type
+	Tasks []string `json:"tasks,omitempty"`
+	// EveryBatches run maintenance every N committed batches of the table
+	EveryBatches int `json:"everyBatches,omitempty"`
+	// IntervalSec run maintenance with the first batch committed when at least IntervalSec seconds passed since the last run
+	IntervalSec int `json:"intervalSec,omitempty"`
+	// ZOrderBy columns of ZORDER BY clause of optimize task (Databricks)
+	ZOrderBy []string `json:"zorderBy,omitempty"`
+}
+
+// Validate returns err if invalid
+func (c *MaintenanceConfig) Validate() error {
+	for _, task := range c.Tasks {
+		switch task {
+		case MaintenanceAnalyze, MaintenanceVacuum, MaintenanceOptimize:
+		default:
+			return fmt.Errorf("unknown maintenance task: %s. Supported: %s, %s, %s", task, MaintenanceAnalyze, MaintenanceVacuum, MaintenanceOptimize)
+		}
+	}
+	if c.EveryBatches < 0 || c.IntervalSec < 0 {
+		return fmt.Errorf("maintenance everyBatches and intervalSec must not be negative")
+	}
+	if c.EveryBatches == 0 && c.IntervalSec == 0 {
+		return fmt.Errorf("maintenance requires everyBatches or intervalSec")
+	}
+	return nil
+}
+
+// tasksOrDefault returns configured tasks or provided default tasks of destination type
+func (c *MaintenanceConfig) tasksOrDefault(defaultTasks ...string) []string {
+	if len(c.Tasks) > 0 {
+		return c.Tasks
+	}
+	return defaultTasks
+}
+
+func parseMaintenanceConfig(serialized any) (*MaintenanceConfig, error) {
+	var raw []byte
+	switch v := serialized.(type) {
+	case *MaintenanceConfig:
+		return v, v.Validate()
+	case string:
+		raw = []byte(v)
+	default:
+		var err error
+		raw, err = json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value type of maintenance option: %T", v)
+		}
+	}
+	config := &MaintenanceConfig{}
+	if err := json.Unmarshal(raw, config); err != nil {
+		return nil, fmt.Errorf("failed to parse maintenance config: %v", err)
+	}
+	return config, config.Validate()
+}
+
+// WithMaintenance runs maintenance tasks on destination table after committed batches
+func WithMaintenance(config MaintenanceConfig) bulker.StreamOption {
+	return bulker.WithOption(&MaintenanceOption, &config)
+}
+
+// TableMaintainer optional interface for SQLAdapter that can run maintenance tasks on table. See MaintenanceOption
+type TableMaintainer interface {
+	MaintainTable(ctx context.Context, tableName string, config *MaintenanceConfig) error
+	// maintenanceDue registers committed batch of the table and returns true if maintenance should be started
+	maintenanceDue(tableName string, config *MaintenanceConfig) bool
+	// maintenanceDone marks that maintenance of the table is finished
+	maintenanceDone(tableName string)
+}
+
+// maintenanceState schedule state of a single table
+type maintenanceState struct {
+	batches int
+	lastRun time.Time
+	running bool
+}
+
+// maintenanceSchedule counts committed batches of tables of SQLAdapter between maintenance runs
+type maintenanceSchedule struct {
+	sync.Mutex
+	tables map[string]*maintenanceState
+}
+
+func newMaintenanceSchedule() *maintenanceSchedule {
+	return &maintenanceSchedule{tables: map[string]*maintenanceState{}}
+}
+
+// due registers committed batch of the table and returns true if maintenance should be started.
+// Maintenance doesn't start while previous run of the same table is in progress
+func (s *maintenanceSchedule) due(tableName string, config *MaintenanceConfig, now time.Time) bool {
+	s.Lock()
+	defer s.Unlock()
+	state, ok := s.tables[tableName]
+	if !ok {
+		//interval is counted from the first batch
+		state = &maintenanceState{lastRun: now}
+		s.tables[tableName] = state
+	}
+	state.batches++
+	if state.running {
+		return false
+	}
+	if (config.EveryBatches > 0 && state.batches >= config.EveryBatches) ||
+		(config.IntervalSec > 0 && now.Sub(state.lastRun) >= time.Duration(config.IntervalSec)*time.Second) {
+		state.batches = 0
+		state.lastRun = now
+		state.running = true
+		return true
+	}
+	return false
+}
+
+func (s *maintenanceSchedule) done(tableName string) {
+	s.Lock()
+	defer s.Unlock()
+	if state, ok := s.tables[tableName]; ok {
+		state.running = false
+	}
+}
+
+func (b *SQLAdapterBase[T]) maintenanceDue(tableName string, config *MaintenanceConfig) bool {
+	return b.maintenance.due(tableName, config, time.Now())
+}
+
+func (b *SQLAdapterBase[T]) maintenanceDone(tableName string) {
+	b.maintenance.done(tableName)
+}
+
+// runMaintenance executes maintenance statements outside of transaction: VACUUM can't run inside transaction block
+func (b *SQLAdapterBase[T]) runMaintenance(ctx context.Context, tableName string, statements []string) error {
+	for _, statement := range statements {
+		if _, err := b.txOrDb(ctx).ExecContext(ctx, statement); err != nil {
+			return errorj.MaintenanceError.Wrap(err, "failed to run maintenance").
+				WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+					Table:     tableName,
+					Statement: statement,
+				})
+		}
+	}
+	return nil
+}
+
+// validateMaintenanceOption checks that adapter supports maintenance tasks
+func validateMaintenanceOption(p SQLAdapter, config *MaintenanceConfig) error {
+	if config == nil {
+		return nil
+	}
+	if _, ok := p.(TableMaintainer); !ok {
+		return fmt.Errorf("%s doesn't support maintenance option", p.Type())
+	}
+	return nil
+}
+
+// unsupportedMaintenanceTask returns error for task that destination type doesn't support
+func unsupportedMaintenanceTask(typeId, task string) error {
+	return fmt.Errorf("%s doesn't support %s maintenance task", typeId, task)
+}
+
+// maintainAfterCommit starts maintenance of destination table in background when it is due.
+// Maintenance errors are logged and don't affect committed batch
+func (ps *AbstractSQLStream) maintainAfterCommit() {
+	config := MaintenanceOption.Get(&ps.options)
+	if config == nil {
+		return
+	}
+	maintainer, ok := ps.sqlAdapter.(TableMaintainer)
+	if !ok {
+		return
+	}
+	tableName := ps.tableName
+	if !maintainer.maintenanceDue(tableName, config) {
+		return
+	}
+	go func() {
+		defer maintainer.maintenanceDone(tableName)
+		ctx, cancel := context.WithTimeout(context.Background(), maintenanceTimeout)
+		defer cancel()
+		start := time.Now()
+		tasks := "default tasks"
+		if len(config.Tasks) > 0 {
+			tasks = strings.Join(config.Tasks, ", ")
+		}
+		if err := maintainer.MaintainTable(ctx, tableName, config); err != nil {
+			logging.Errorf("[%s] Maintenance (%s) of table %s failed: %v", ps.id, tasks, tableName, err)
+			return
+		}
+		logging.Infof("[%s] Maintenance (%s) of table %s completed in %.2f s", ps.id, tasks, tableName, time.Since(start).Seconds())
+	}()
+}
@@ -0,0 +1,48 @@
+package sql
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceScheduleEveryBatches(t *testing.T) {
+	schedule := newMaintenanceSchedule()
+	config := &MaintenanceConfig{EveryBatches: 3}
+	now := time.Now()
+	require.False(t, schedule.due("events", config, now))
+	require.False(t, schedule.due("events", config, now))
+	require.True(t, schedule.due("events", config, now))
+	//counted per table
+	require.False(t, schedule.due("users", config, now))
+
+	//previous run is still in progress
+	require.False(t, schedule.due("events", config, now))
+	require.False(t, schedule.due("events", config, now))
+	require.False(t, schedule.due("events", config, now))
+	schedule.done("events")
+	require.True(t, schedule.due("events", config, now))
+}
+
+func TestMaintenanceScheduleInterval(t *testing.T) {
+	schedule := newMaintenanceSchedule()
+	config := &MaintenanceConfig{IntervalSec: 60}
+	now := time.Now()
+	require.False(t, schedule.due("events", config, now))
+	require.False(t, schedule.due("events", config, now.Add(59*time.Second)))
+	require.True(t, schedule.due("events", config, now.Add(60*time.Second)))
+	schedule.done("events")
+	require.False(t, schedule.due("events", config, now.Add(90*time.Second)))
+	require.True(t, schedule.due("events", config, now.Add(120*time.Second)))
+}
+
+func TestParseMaintenanceConfig(t *testing.T) {
+	config, err := parseMaintenanceConfig(map[string]any{"tasks": []string{"vacuum", "analyze"}, "everyBatches": 10})
+	require.NoError(t, err)
+	require.Equal(t, &MaintenanceConfig{Tasks: []string{MaintenanceVacuum, MaintenanceAnalyze}, EveryBatches: 10}, config)
+
+	_, err = parseMaintenanceConfig(`{"tasks": ["reindex"], "everyBatches": 10}`)
+	require.Error(t, err)
+	_, err = parseMaintenanceConfig(`{"tasks": ["analyze"]}`)
+	require.Error(t, err)
+}
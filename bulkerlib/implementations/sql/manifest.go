@@ -0,0 +1,50 @@
+package sql
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// manifestSuffix suffix of manifest file staged next to the prefix of files it lists
+const manifestSuffix = ".manifest"
+
+// ManifestLoadSupport optional interface for SQLAdapter which LoadTable loads files listed in manifest staged at LoadSource.Path
+// when LoadSource.Manifest is set. Manifest is preferred over loading by prefix: it loads exactly staged files and fails if any of them is missing
+type ManifestLoadSupport interface {
+	SupportsManifestLoad(sourceType LoadSourceType) bool
+}
+
+// copyManifest manifest of COPY command listing staged files
+type copyManifest struct {
+	Entries []copyManifestEntry `json:"entries"`
+}
+
+type copyManifestEntry struct {
+	URL       string `json:"url"`
+	Mandatory bool   `json:"mandatory"`
+}
+
+// stageManifest uploads manifest listing staged files if adapter supports it. loadSource.Path is prefix of staged files.
+// Returns true if loadSource was switched to the manifest
+func (ps *AbstractTransactionalSQLStream) stageManifest(stage batchFileStage, loadSource *LoadSource, stagedFiles []string) (bool, error) {
+	if ml, ok := ps.sqlAdapter.(ManifestLoadSupport); !ok || !ml.SupportsManifestLoad(loadSource.Type) || loadSource.Type != AmazonS3 {
+		return false, nil
+	}
+	manifest := copyManifest{Entries: make([]copyManifestEntry, len(stagedFiles))}
+	for i, stagedFile := range stagedFiles {
+		manifest.Entries[i] = copyManifestEntry{URL: fmt.Sprintf("s3://%s/%s", loadSource.S3Config.Bucket, stagedFile), Mandatory: true}
+	}
+	payload, err := json.Marshal(manifest)
+	if err != nil {
+		return false, err
+	}
+	manifestPath := strings.TrimSuffix(loadSource.Path, "/") + manifestSuffix
+	if err = stage.Upload(manifestPath, bytes.NewReader(payload)); err != nil {
+		return false, err
+	}
+	loadSource.Path = manifestPath
+	loadSource.Manifest = true
+	return true, nil
+}
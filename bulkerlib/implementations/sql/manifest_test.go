@@ -0,0 +1,34 @@
+package sql
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestStageManifest(t *testing.T) {
+	reqr := require.New(t)
+	stage := &memoryStage{objects: map[string][]byte{}}
+	ps := &AbstractTransactionalSQLStream{AbstractSQLStream: &AbstractSQLStream{id: "manifest_test", sqlAdapter: &Redshift{}}}
+	loadSource := &LoadSource{Type: AmazonS3, Path: "folder/batch_chunks/", S3Config: &S3OptionConfig{Bucket: "bucket"}}
+	ok, err := ps.stageManifest(stage, loadSource, []string{"folder/batch_chunks/1.csv", "folder/batch_chunks/2.csv"})
+	reqr.NoError(err)
+	reqr.True(ok)
+	reqr.True(loadSource.Manifest)
+	reqr.Equal("folder/batch_chunks.manifest", loadSource.Path)
+
+	manifest := copyManifest{}
+	reqr.NoError(json.Unmarshal(stage.objects[loadSource.Path], &manifest))
+	reqr.Equal([]copyManifestEntry{
+		{URL: "s3://bucket/folder/batch_chunks/1.csv", Mandatory: true},
+		{URL: "s3://bucket/folder/batch_chunks/2.csv", Mandatory: true},
+	}, manifest.Entries)
+
+	//adapters without manifest support load files by prefix
+	ps.sqlAdapter = &Snowflake{}
+	loadSource = &LoadSource{Type: AmazonS3, Path: "folder/batch_chunks/", S3Config: &S3OptionConfig{Bucket: "bucket"}}
+	ok, err = ps.stageManifest(stage, loadSource, []string{"folder/batch_chunks/1.csv"})
+	reqr.NoError(err)
+	reqr.False(ok)
+	reqr.Equal("folder/batch_chunks/", loadSource.Path)
+}
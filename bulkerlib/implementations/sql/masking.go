@@ -0,0 +1,255 @@
+package sql
+
+import (
+	"encoding/json"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	jsoniter "github.com/json-iterator/go"
+	"regexp"
+)
+
+const (
+	// MaskRedact replaces value (or matched part of string for pattern rules) with MaskRedactedValue
+	MaskRedact = "redact"
+	// MaskTruncate keeps first 'length' characters of value (or of matched part of string for pattern rules)
+	MaskTruncate = "truncate"
+	// MaskTokenize replaces value (or matched part of string for pattern rules) with deterministic token: the same values get the same tokens
+	MaskTokenize = "tokenize"
+
+	MaskRedactedValue = "***"
+	// maskTokenLength number of hex characters of hmac-sha256 hash used in tokens
+	maskTokenLength = 16
+)
+
+// MaskingRule masks values of listed fields or parts of any string values that match the pattern
+type MaskingRule struct {
+	// Fields paths to masked fields. Nested fields are addressed with dot separated paths
+	Fields []string `json:"fields,omitempty"`
+	// Pattern regular expression. Matching parts of all string values of event are masked
+	Pattern string `json:"pattern,omitempty"`
+	// Action redact, truncate or tokenize
+	Action string `json:"action"`
+	// Length number of characters kept by truncate action
+	Length int `json:"length,omitempty"`
+	// Salt key of tokens of tokenize action
+	Salt string `json:"salt,omitempty"`
+}
+
+// Masker masks values of event during preprocessing, so they are masked in batch files, staging copies and destination tables.
+// Implementations must not modify source object
+type Masker interface {
+	Mask(object types.Object) types.Object
+}
+
+// MaskingOption - masking rules applied to events during preprocessing. See MaskingRule
+var MaskingOption = bulker.ImplementationOption[[]MaskingRule]{
+	Key:       "masking",
+	ParseFunc: parseMaskingRules,
+}
+
+// MaskerOption - custom Masker applied to events after MaskingOption rules
+var MaskerOption = bulker.ImplementationOption[Masker]{
+	Key: "masker",
+	ParseFunc: func(serialized any) (Masker, error) {
+		return nil, fmt.Errorf("'masker' option can be set only programmatically")
+	},
+}
+
+// WithMasking masks events with provided rules. See MaskingOption
+func WithMasking(rules ...MaskingRule) bulker.StreamOption {
+	return func(options *bulker.StreamOptions) {
+		existing := MaskingOption.Get(options)
+		MaskingOption.Set(options, append(existing[:len(existing):len(existing)], rules...))
+	}
+}
+
+// WithMasker masks events with custom Masker. See MaskerOption
+func WithMasker(masker Masker) bulker.StreamOption {
+	return bulker.WithOption(&MaskerOption, masker)
+}
+
+func parseMaskingRules(serialized any) ([]MaskingRule, error) {
+	var rules []MaskingRule
+	switch v := serialized.(type) {
+	case []MaskingRule:
+		rules = v
+	case string:
+		if err := json.Unmarshal([]byte(v), &rules); err != nil {
+			return nil, fmt.Errorf("failed to parse 'masking' option: %v", err)
+		}
+	case []any:
+		b, _ := jsoniter.Marshal(v)
+		if err := jsoniter.Unmarshal(b, &rules); err != nil {
+			return nil, fmt.Errorf("failed to parse 'masking' option: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("failed to parse 'masking' option: %v incorrect type: %T expected array", v, v)
+	}
+	if _, err := newRulesMasker(rules); err != nil {
+		return nil, fmt.Errorf("failed to parse 'masking' option: %v", err)
+	}
+	return rules, nil
+}
+
+// rulesMasker Masker of MaskingOption rules
+type rulesMasker struct {
+	fields   []maskedField
+	patterns []maskedPattern
+}
+
+type maskedField struct {
+	path []string
+	mask func(value string) string
+}
+
+type maskedPattern struct {
+	pattern *regexp.Regexp
+	mask    func(value string) string
+}
+
+// newRulesMasker compiles masking rules. Returns nil if there are no rules
+func newRulesMasker(rules []MaskingRule) (*rulesMasker, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	rm := &rulesMasker{}
+	for i, rule := range rules {
+		mask, err := maskFunc(rule)
+		if err != nil {
+			return nil, fmt.Errorf("masking rule #%d: %v", i, err)
+		}
+		if len(rule.Fields) == 0 && rule.Pattern == "" {
+			return nil, fmt.Errorf("masking rule #%d: either 'fields' or 'pattern' is required", i)
+		}
+		for _, field := range rule.Fields {
+			path, err := parseFieldPath(field)
+			if err != nil {
+				return nil, fmt.Errorf("masking rule #%d: %v", i, err)
+			}
+			rm.fields = append(rm.fields, maskedField{path: path, mask: mask})
+		}
+		if rule.Pattern != "" {
+			pattern, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("masking rule #%d: invalid pattern: %v", i, err)
+			}
+			rm.patterns = append(rm.patterns, maskedPattern{pattern: pattern, mask: mask})
+		}
+	}
+	return rm, nil
+}
+
+func maskFunc(rule MaskingRule) (func(value string) string, error) {
+	switch rule.Action {
+	case MaskRedact:
+		return func(value string) string {
+			return MaskRedactedValue
+		}, nil
+	case MaskTruncate:
+		if rule.Length < 0 {
+			return nil, fmt.Errorf("'length' must not be negative")
+		}
+		return func(value string) string {
+			runes := []rune(value)
+			if len(runes) <= rule.Length {
+				return value
+			}
+			return string(runes[:rule.Length])
+		}, nil
+	case MaskTokenize:
+		hash, _ := newHashFunc(HashHMACSHA256, rule.Salt)
+		return func(value string) string {
+			return "tok_" + hash(value)[:maskTokenLength]
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown action '%s'. Supported actions: %s, %s, %s", rule.Action, MaskRedact, MaskTruncate, MaskTokenize)
+	}
+}
+
+// Mask returns object with masked values. Source object isn't modified
+func (rm *rulesMasker) Mask(object types.Object) types.Object {
+	for _, field := range rm.fields {
+		mask := field.mask
+		object = updateField(object, field.path, func(value any) any {
+			return mask(stringValue(value))
+		})
+	}
+	if len(rm.patterns) > 0 {
+		if masked, changed := rm.maskPatterns(map[string]any(object)); changed {
+			object = masked.(map[string]any)
+		}
+	}
+	return object
+}
+
+// maskPatterns masks matching parts of string values of nested maps and arrays. Changed maps and arrays are copied
+func (rm *rulesMasker) maskPatterns(value any) (any, bool) {
+	switch v := value.(type) {
+	case string:
+		masked := v
+		for _, p := range rm.patterns {
+			masked = p.pattern.ReplaceAllStringFunc(masked, p.mask)
+		}
+		return masked, masked != v
+	case types.Object:
+		return rm.maskPatterns(map[string]any(v))
+	case map[string]any:
+		var copied map[string]any
+		for key, nested := range v {
+			if masked, changed := rm.maskPatterns(nested); changed {
+				if copied == nil {
+					copied = utils.MapCopy(v)
+				}
+				copied[key] = masked
+			}
+		}
+		return copied, copied != nil
+	case []any:
+		var copied []any
+		for i, nested := range v {
+			if masked, changed := rm.maskPatterns(nested); changed {
+				if copied == nil {
+					copied = append([]any(nil), v...)
+				}
+				copied[i] = masked
+			}
+		}
+		return copied, copied != nil
+	}
+	return value, false
+}
+
+// updateField replaces non-nil value of nested field with result of update function. Maps on the path are copied, source object isn't modified
+func updateField(object map[string]any, path []string, update func(value any) any) map[string]any {
+	value, ok := object[path[0]]
+	if !ok || value == nil {
+		return object
+	}
+	if len(path) > 1 {
+		nested, ok := value.(map[string]any)
+		if !ok {
+			return object
+		}
+		copied := utils.MapCopy(object)
+		copied[path[0]] = updateField(nested, path[1:], update)
+		return copied
+	}
+	copied := utils.MapCopy(object)
+	copied[path[0]] = update(value)
+	return copied
+}
+
+// stringValue returns string representation of value. Maps and arrays are serialized to JSON
+func stringValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case map[string]any, []any:
+		b, _ := jsoniter.Marshal(v)
+		return string(b)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,44 @@
+package sql
+
+import (
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestMasking(t *testing.T) {
+	rules, err := parseMaskingRules(`[
+		{"fields": ["password"], "action": "redact"},
+		{"fields": ["context.name"], "action": "truncate", "length": 1},
+		{"fields": ["phone"], "action": "tokenize", "salt": "pepper"},
+		{"pattern": "\\d{4}-\\d{4}-\\d{4}-\\d{4}", "action": "redact"}
+	]`)
+	require.NoError(t, err)
+	masker, err := newRulesMasker(rules)
+	require.NoError(t, err)
+	object := types.Object{
+		"password": "secret",
+		"phone":    "+1 555 0100",
+		"context":  map[string]any{"name": "John", "note": "card 1234-5678-9012-3456"},
+		"items":    []any{"ok", "paid with 1111-2222-3333-4444"},
+	}
+	result := masker.Mask(object)
+	require.Equal(t, MaskRedactedValue, result["password"])
+	require.Equal(t, "J", result["context"].(map[string]any)["name"])
+	require.Equal(t, "card ***", result["context"].(map[string]any)["note"])
+	require.Equal(t, []any{"ok", "paid with ***"}, result["items"])
+	token := result["phone"].(string)
+	require.True(t, strings.HasPrefix(token, "tok_"))
+	//tokens are deterministic
+	require.Equal(t, token, masker.Mask(types.Object{"phone": "+1 555 0100"})["phone"])
+	//source object isn't modified
+	require.Equal(t, "secret", object["password"])
+	require.Equal(t, "John", object["context"].(map[string]any)["name"])
+	require.Equal(t, "paid with 1111-2222-3333-4444", object["items"].([]any)[1])
+
+	_, err = parseMaskingRules([]any{map[string]any{"fields": []any{"email"}, "action": "encrypt"}})
+	require.ErrorContains(t, err, "unknown action")
+	_, err = parseMaskingRules([]any{map[string]any{"action": "redact"}})
+	require.ErrorContains(t, err, "either 'fields' or 'pattern' is required")
+}
@@ -4,7 +4,9 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/tls"
 	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/go-sql-driver/mysql"
 	_ "github.com/go-sql-driver/mysql"
@@ -22,6 +24,7 @@ import (
 
 func init() {
 	bulker.RegisterBulker(MySQLBulkerTypeId, NewMySQL)
+	bulker.RegisterConfigType(MySQLBulkerTypeId, DataSourceConfig{})
 }
 
 const (
@@ -39,14 +42,20 @@ const (
 	mySQLCreateDBIfNotExistsTemplate = "CREATE DATABASE IF NOT EXISTS %s"
 	mySQLAllowLocalFile              = "SET GLOBAL local_infile = 1"
 	mySQLIndexTemplate               = `CREATE INDEX %s ON %s (%s);`
-	mySQLLoadTemplate                = `LOAD DATA LOCAL INFILE '%s' INTO TABLE %s FIELDS TERMINATED BY ',' ENCLOSED BY '"' LINES TERMINATED BY '\n' IGNORE 1 LINES (%s)`
-	mySQLMergeQuery                  = `INSERT INTO {{.TableName}}({{.Columns}}) VALUES ({{.Placeholders}}) ON DUPLICATE KEY UPDATE {{.UpdateSet}}`
-	mySQLBulkMergeQuery              = "INSERT INTO {{.TableTo}}({{.Columns}}) SELECT * FROM (SELECT {{.Columns}} FROM {{.TableFrom}}) AS S ON DUPLICATE KEY UPDATE {{.UpdateSet}}"
+	mySQLNamedIndexTemplate          = `CREATE %sINDEX %s ON %s (%s);`
+	mySQLSetNotNullTemplate          = `ALTER TABLE %s MODIFY COLUMN %s %s NOT NULL;`
+	// mySQLDuplicateKeyName error number of 'Duplicate key name' error
+	mySQLDuplicateKeyName = 1061
+	mySQLLoadTemplate     = `LOAD DATA LOCAL INFILE '%s' INTO TABLE %s FIELDS TERMINATED BY ',' ENCLOSED BY '"' LINES TERMINATED BY '\n' IGNORE 1 LINES (%s)`
+	mySQLMergeQuery       = `INSERT INTO {{.TableName}}({{.Columns}}) VALUES ({{.Placeholders}}) ON DUPLICATE KEY UPDATE {{.UpdateSet}}`
+	mySQLBulkMergeQuery   = "INSERT INTO {{.TableTo}}({{.Columns}}) SELECT * FROM (SELECT {{.Columns}} FROM {{.TableFrom}}) AS S ON DUPLICATE KEY UPDATE {{.UpdateSet}}"
+	mySQLUpdateFromQuery  = "UPDATE {{.TableTo}} AS T JOIN {{.TableFrom}} AS S ON {{.JoinConditions}} SET {{.UpdateSet}}"
 )
 
 var (
-	mySQLMergeQueryTemplate, _     = template.New("mysqlMergeQuery").Parse(mySQLMergeQuery)
-	mySQLBulkMergeQueryTemplate, _ = template.New("mysqlBulkMergeQuery").Parse(mySQLBulkMergeQuery)
+	mySQLMergeQueryTemplate, _      = template.New("mysqlMergeQuery").Parse(mySQLMergeQuery)
+	mySQLBulkMergeQueryTemplate, _  = template.New("mysqlBulkMergeQuery").Parse(mySQLBulkMergeQuery)
+	mySQLUpdateFromQueryTemplate, _ = template.New("mysqlUpdateFromQuery").Parse(mySQLUpdateFromQuery)
 
 	mysqlTypes = map[types2.DataType][]string{
 		types2.STRING:    {"text", "varchar(255)", "varchar"},
@@ -80,6 +89,9 @@ func NewMySQL(bulkerConfig bulker.Config) (bulker.Bulker, error) {
 	if config.Parameters == nil {
 		config.Parameters = map[string]string{}
 	}
+	if _, err := mySQLTLSConfig(bulkerConfig.Id, config); err != nil {
+		return nil, err
+	}
 	utils.MapPutIfAbsent(config.Parameters, "tls", "preferred")
 
 	utils.MapPutIfAbsent(config.Parameters, "timeout", "60s")
@@ -87,7 +99,7 @@ func NewMySQL(bulkerConfig bulker.Config) (bulker.Bulker, error) {
 	utils.MapPutIfAbsent(config.Parameters, "readTimeout", "60s")
 
 	dbConnectFunction := func(cfg *DataSourceConfig) (*sql.DB, error) {
-		connectionString := mySQLDriverConnectionString(config)
+		connectionString := mySQLDriverConnectionString(cfg)
 		dataSource, err := sql.Open("mysql", connectionString)
 		if err != nil {
 			return nil, err
@@ -136,7 +148,29 @@ func NewMySQL(bulkerConfig bulker.Config) (bulker.Bulker, error) {
 	} else {
 		m.batchFileFormat = types2.FileFormatNDJSON
 	}
+	m.statementTimeout = time.Duration(bulkerConfig.StatementTimeoutSec) * time.Second
+	m.setConnMaxLifetime(time.Duration(bulkerConfig.ConnMaxLifetimeSec) * time.Second)
 	m.tableHelper = NewTableHelper(63, '`')
+	m.constraints = &constraintsDialect{
+		indexStatement: func(quotedTableName, indexName string, unique bool, quotedColumns []string) string {
+			indexType := ""
+			if unique {
+				indexType = "UNIQUE "
+			}
+			return fmt.Sprintf(mySQLNamedIndexTemplate, indexType, indexName, quotedTableName, strings.Join(quotedColumns, ", "))
+		},
+		notNullStatement: func(quotedTableName, quotedColumnName string, column types2.SQLColumn) string {
+			return fmt.Sprintf(mySQLSetNotNullTemplate, quotedTableName, quotedColumnName, column.GetDDLType())
+		},
+		// MySQL doesn't support CREATE INDEX IF NOT EXISTS
+		alreadyExists: func(err error) bool {
+			var mysqlErr *mysql.MySQLError
+			return errors.As(err, &mysqlErr) && mysqlErr.Number == mySQLDuplicateKeyName
+		},
+	}
+	if replica := config.ReadReplica(); replica != nil && err == nil {
+		err = m.connectReadReplica(replica)
+	}
 	return m, err
 }
 
@@ -154,6 +188,12 @@ func (m *MySQL) CreateStream(id, tableName string, mode bulker.BulkMode, streamO
 		return newReplaceTableStream(id, m, tableName, streamOptions...)
 	case bulker.ReplacePartition:
 		return newReplacePartitionStream(id, m, tableName, streamOptions...)
+	case bulker.UpdateColumns:
+		return newUpdateColumnsStream(id, m, tableName, streamOptions...)
+	case bulker.SCD2:
+		return newSCD2Stream(id, m, tableName, streamOptions...)
+	case bulker.CDC:
+		return newCDCStream(id, m, tableName, streamOptions...)
 	}
 	return nil, fmt.Errorf("unsupported bulk mode: %s", mode)
 }
@@ -180,6 +220,16 @@ func (m *MySQL) InitDatabase(ctx context.Context) error {
 	return nil
 }
 
+// SupportsSavepoints MySQL (InnoDB) supports SAVEPOINT inside transactions
+func (m *MySQL) SupportsSavepoints() bool {
+	return true
+}
+
+// SupportsStagingSchema tmp tables may be created in other database of the same connection
+func (m *MySQL) SupportsStagingSchema() bool {
+	return true
+}
+
 // OpenTx opens underline sql transaction and return wrapped instance
 func (m *MySQL) OpenTx(ctx context.Context) (*TxSQLAdapter, error) {
 	return m.openTx(ctx, m)
@@ -194,6 +244,21 @@ func (m *MySQL) Insert(ctx context.Context, table *Table, merge bool, objects ..
 	}
 }
 
+// UpdateColumns updates columns of target table rows matching source table rows by primary key
+func (m *MySQL) UpdateColumns(ctx context.Context, targetTable *Table, sourceTable *Table) (*bulker.WarehouseState, error) {
+	return nil, m.updateColumnsFrom(ctx, targetTable, sourceTable, mySQLUpdateFromQueryTemplate, true)
+}
+
+// CloseVersions closes current versions of target table rows matching source table rows by key columns
+func (m *MySQL) CloseVersions(ctx context.Context, targetTable *Table, sourceTable *Table, keyColumns []string) (*bulker.WarehouseState, error) {
+	return nil, m.closeVersionsFrom(ctx, targetTable, sourceTable, keyColumns, mySQLUpdateFromQueryTemplate, true)
+}
+
+// DeleteByKeys deletes rows of target table matching source table rows by key columns
+func (m *MySQL) DeleteByKeys(ctx context.Context, targetTable *Table, sourceTable *Table, keyColumns []string) (*bulker.WarehouseState, error) {
+	return nil, m.deleteByKeysFrom(ctx, targetTable, sourceTable, keyColumns)
+}
+
 func (m *MySQL) CopyTables(ctx context.Context, targetTable *Table, sourceTable *Table, mergeWindow int) (*bulker.WarehouseState, error) {
 	if mergeWindow <= 0 {
 		return nil, m.copy(ctx, targetTable, sourceTable)
@@ -203,7 +268,7 @@ func (m *MySQL) CopyTables(ctx context.Context, targetTable *Table, sourceTable
 }
 
 func (m *MySQL) LoadTable(ctx context.Context, targetTable *Table, loadSource *LoadSource) (state *bulker.WarehouseState, err error) {
-	quotedTableName := m.quotedTableName(targetTable.Name)
+	quotedTableName := m.quotedTable(targetTable)
 
 	if loadSource.Type != LocalFile {
 		return state, fmt.Errorf("LoadTable: only local file is supported")
@@ -335,7 +400,7 @@ func (m *MySQL) getTable(ctx context.Context, tableName string) (*Table, error)
 	table := &Table{Name: tableName, Columns: Columns{}, PKFields: utils.NewSet[string]()}
 	ctx, cancel := context.WithTimeout(ctx, 1*time.Minute)
 	defer cancel()
-	rows, err := m.dataSource.QueryContext(ctx, mySQLTableSchemaQuery, m.config.Db, tableName)
+	rows, err := m.readDb().QueryContext(ctx, mySQLTableSchemaQuery, m.config.Db, tableName)
 	if err != nil {
 		return nil, errorj.GetTableError.Wrap(err, "failed to get table columns").
 			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
@@ -384,7 +449,7 @@ func (m *MySQL) getTable(ctx context.Context, tableName string) (*Table, error)
 
 func (m *MySQL) getPrimaryKeys(ctx context.Context, tableName string) (utils.Set[string], error) {
 	tableName = m.TableName(tableName)
-	pkFieldsRows, err := m.dataSource.QueryContext(ctx, mySQLPrimaryKeyFieldsQuery, m.config.Db, tableName)
+	pkFieldsRows, err := m.readDb().QueryContext(ctx, mySQLPrimaryKeyFieldsQuery, m.config.Db, tableName)
 	if err != nil {
 		return nil, errorj.GetPrimaryKeysError.Wrap(err, "failed to get primary key").
 			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
@@ -450,6 +515,24 @@ func (m *MySQL) renameTable(ctx context.Context, ifExists bool, tableName, newTa
 	return m.SQLAdapterBase.renameTable(ctx, false, tableName, newTableName)
 }
 
+// mySQLTLSConfig registers custom TLS config in driver and points 'tls' parameter to it.
+// Returns nil if TLS isn't configured
+func mySQLTLSConfig(id string, config *DataSourceConfig) (*tls.Config, error) {
+	if config.TLS == nil {
+		return nil, nil
+	}
+	tlsConfig, err := config.TLS.Build()
+	if err != nil {
+		return nil, fmt.Errorf("invalid tls config: %v", err)
+	}
+	name := "bulker_" + utils.SanitizeString(id)
+	if err = mysql.RegisterTLSConfig(name, tlsConfig); err != nil {
+		return nil, fmt.Errorf("failed to register tls config: %v", err)
+	}
+	config.Parameters["tls"] = name
+	return tlsConfig, nil
+}
+
 func mySQLDriverConnectionString(config *DataSourceConfig) string {
 	// [user[:password]@][net[(addr)]]/dbname[?param1=value1&paramN=valueN]
 	connectionString := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s",
@@ -511,7 +594,7 @@ func (m *MySQL) createIndex(ctx context.Context, table *Table) error {
 	if table.TimestampColumn == "" {
 		return nil
 	}
-	quotedTableName := m.quotedTableName(table.Name)
+	quotedTableName := m.quotedTable(table)
 
 	statement := fmt.Sprintf(mySQLIndexTemplate, "bulker_timestamp_index",
 		quotedTableName, m.quotedColumnName(table.TimestampColumn))
@@ -1,10 +1,13 @@
 package sql
 
 import (
+	"encoding/json"
 	"fmt"
 	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/implementations"
 	"github.com/jitsucom/bulker/bulkerlib/types"
 	"github.com/jitsucom/bulker/jitsubase/utils"
+	"strings"
 )
 
 var (
@@ -13,20 +16,30 @@ var (
 		DefaultValue: types.SQLTypes{},
 		AdvancedParseFunc: func(o *bulker.ImplementationOption[types.SQLTypes], serializedValue any) (bulker.StreamOption, error) {
 			switch v := serializedValue.(type) {
+			case types.SQLTypes:
+				return withColumnTypes(o, v), nil
+			case map[string]string:
+				return withColumnTypes(o, sqlTypesOf(v)), nil
 			case map[string]any:
 				sqlTypes := types.SQLTypes{}
 				for key, value := range v {
 					switch t := value.(type) {
 					case string:
 						sqlTypes.With(key, t)
-					case []string:
-						if len(t) == 1 {
-							sqlTypes.With(key, t[0])
-						} else if len(t) == 2 {
-							sqlTypes.WithDDL(key, t[0], t[1])
+					case []string, []any:
+						typeAndDDL, err := parseStringList("columnTypes", t)
+						if err != nil {
+							return nil, err
+						}
+						if len(typeAndDDL) == 1 {
+							sqlTypes.With(key, typeAndDDL[0])
+						} else if len(typeAndDDL) == 2 {
+							sqlTypes.WithDDL(key, typeAndDDL[0], typeAndDDL[1])
 						} else {
 							return nil, fmt.Errorf("failed to parse 'columnTypes' option: %v incorrect number of elements. expected 1 or 2", v)
 						}
+					default:
+						return nil, fmt.Errorf("failed to parse 'columnTypes' option: type of '%s' column must be string or [type, ddlType] array. got: %T", key, t)
 					}
 				}
 				return withColumnTypes(o, sqlTypes), nil
@@ -42,21 +55,247 @@ var (
 		ParseFunc:    utils.ParseInt,
 	}
 
+	// DeduplicateLatestOption - when rows of a batch with the same primary key are deduplicated keep the row with the greatest value of
+	// version column (or timestamp column if version column isn't set) instead of the last one in order of consumption
+	DeduplicateLatestOption = bulker.ImplementationOption[bool]{
+		Key:       "deduplicateLatest",
+		ParseFunc: utils.ParseBool,
+	}
+
 	OmitNilsOption = bulker.ImplementationOption[bool]{
 		Key:          "omitNils",
 		DefaultValue: true,
 		ParseFunc:    utils.ParseBool,
 	}
 
+	// OmitFieldsOption - event fields dropped before schema inference and loading.
+	// Nested fields are addressed with dot separated paths, e.g. "context.rawPayload"
+	OmitFieldsOption = bulker.ImplementationOption[[]string]{
+		Key:       "omitFields",
+		ParseFunc: parseOmitFields,
+	}
+
+	// IndexesOption - secondary indexes and uniqueness constraints created and maintained on destination table.
+	// Supported only by adapters implementing ConstraintsSupport
+	IndexesOption = bulker.ImplementationOption[[]Index]{
+		Key:       "indexes",
+		ParseFunc: parseIndexes,
+	}
+
+	// NotNullOption - columns of destination table with NOT NULL constraint.
+	// Supported only by adapters implementing ConstraintsSupport
+	NotNullOption = bulker.ImplementationOption[[]string]{
+		Key: "notNull",
+		ParseFunc: func(serialized any) ([]string, error) {
+			return parseStringList("notNull", serialized)
+		},
+	}
+
+	// AggregationOption - pre-aggregate events of a batch: group by configured fields and compute count/sum/min/max.
+	// Supported only in batch mode
+	AggregationOption = bulker.ImplementationOption[*AggregationConfig]{
+		Key:       "aggregation",
+		ParseFunc: parseAggregationConfig,
+	}
+
+	// QualityRulesOption - data quality rules (null rate, accepted values, regex, freshness) evaluated over the batch before commit.
+	// Results are reported in stream state. Violation of rule with 'fail' action fails the batch
+	QualityRulesOption = bulker.ImplementationOption[[]QualityRule]{
+		Key:       "qualityRules",
+		ParseFunc: parseQualityRules,
+	}
+
+	// TransformSQLOption - SQL run after batch is landed to the stream (raw) table to populate clean table.
+	// Supports {{.RawTable}} and {{.CleanTable}} placeholders. Supported only in batch mode
+	TransformSQLOption = bulker.ImplementationOption[string]{
+		Key: "transformSql",
+		ParseFunc: func(serialized any) (string, error) {
+			transformSQL, err := utils.ParseString(serialized)
+			if err != nil {
+				return "", err
+			}
+			return transformSQL, validateTransformSQL(transformSQL)
+		},
+	}
+
+	// TransformTableOption - name of clean table for transform. Default: <table>_clean
+	TransformTableOption = bulker.ImplementationOption[string]{
+		Key:       "transformTable",
+		ParseFunc: utils.ParseString,
+	}
+
+	// TransformIntervalOption - minimal interval between transform runs in seconds. 0 - run after each batch
+	TransformIntervalOption = bulker.ImplementationOption[int]{
+		Key:       "transformIntervalSec",
+		ParseFunc: utils.ParseInt,
+	}
+
+	// SnapshotOption - save data to S3 or warehouse-side snapshot before replacing table or deleting partition
+	SnapshotOption = bulker.ImplementationOption[*SnapshotConfig]{
+		Key:       "snapshot",
+		ParseFunc: parseSnapshotConfig,
+	}
+
+	// SnowpipeStreamingOption - ingest rows of Snowflake stream mode via Snowpipe Streaming API instead of INSERT statements.
+	// Requires key pair authentication
+	SnowpipeStreamingOption = bulker.ImplementationOption[bool]{
+		Key:       "snowpipeStreaming",
+		ParseFunc: utils.ParseBool,
+	}
+
+	// BigQueryStorageWriteOption - load batches to BigQuery with Storage Write API pending streams instead of load jobs.
+	BigQueryStorageWriteOption = bulker.ImplementationOption[bool]{
+		Key:       "storageWriteApi",
+		ParseFunc: utils.ParseBool,
+	}
+
+	// BigQueryStreamingInsertsOption - enables BigQuery stream mode with streaming API (insertAll).
+	// When streaming quota or request size limit is hit, the stream falls back to batch loading
+	BigQueryStreamingInsertsOption = bulker.ImplementationOption[bool]{
+		Key:       "streamingInserts",
+		ParseFunc: utils.ParseBool,
+	}
+
+	// StringNormalizationOption - policies (keep, strip, replace, error) for string values containing newlines, NUL bytes
+	// and invalid UTF-8. Either single policy for all or object: {"newlines": "replace", "nul": "strip", "invalidUtf8": "replace"}
+	StringNormalizationOption = bulker.ImplementationOption[*StringNormalizationConfig]{
+		Key:       "stringNormalization",
+		ParseFunc: parseStringNormalizationConfig,
+	}
+
+	// TypeCoercionErrorsOption - policies (overflow, null, dlq, fail) for values that cannot be coerced to the type of existing column.
+	// Either single policy for all columns or object: {"default": "overflow", "fields": {"age": "null"}}
+	TypeCoercionErrorsOption = bulker.ImplementationOption[*TypeCoercionErrorsConfig]{
+		Key:       "typeCoercionErrors",
+		ParseFunc: parseTypeCoercionErrorsConfig,
+	}
+
+	// InternalBatchFileFormatOption - format of local batch file where events are buffered before conversion to the format
+	// of destination: ndjson (default) or msgpack. msgpack files are smaller and faster to decode
+	InternalBatchFileFormatOption = bulker.ImplementationOption[types.FileFormat]{
+		Key:          "internalBatchFileFormat",
+		DefaultValue: types.FileFormatNDJSON,
+		ParseFunc:    parseInternalBatchFileFormat,
+	}
+
+	// BatchFileMarshallingOption - compression level, write buffer size and flush cadence of batch files staged for loading:
+	// {"compressionLevel": 1, "bufferSize": 1048576, "flushEvery": 0}. Staged files are deleted right after load,
+	// so by default they are compressed with the fastest level of gzip and zstd
+	BatchFileMarshallingOption = bulker.ImplementationOption[*types.MarshallerConfig]{
+		Key:       "batchFileMarshalling",
+		ParseFunc: parseBatchFileMarshallingConfig,
+	}
+
+	// TombstonesOption - handling of delete events by streams with deduplication. Object with marker field set to true (default: "__deleted")
+	// is a tombstone: it isn't loaded as a row. "hard" - rows matching primary key of tombstone are deleted,
+	// "soft" - flag column (default: "_deleted") of matching rows is set to true: {"mode": "soft", "field": "__deleted", "column": "_deleted"}
+	TombstonesOption = bulker.ImplementationOption[*TombstonesConfig]{
+		Key:       "tombstones",
+		ParseFunc: parseTombstonesConfig,
+	}
+
 	localBatchFileOption = bulker.ImplementationOption[string]{Key: "BULKER_OPTION_LOCAL_BATCH_FILE"}
 
 	s3BatchFileOption = bulker.ImplementationOption[*S3OptionConfig]{Key: "BULKER_OPTION_S3_BATCH_FILE"}
+
+	azureBlobBatchFileOption = bulker.ImplementationOption[*AzureBlobOptionConfig]{Key: "BULKER_OPTION_AZURE_BLOB_BATCH_FILE"}
 )
 
 func init() {
 	bulker.RegisterOption(&DeduplicateWindow)
+	bulker.RegisterOption(&DeduplicateLatestOption)
 	bulker.RegisterOption(&ColumnTypesOption)
 	bulker.RegisterOption(&OmitNilsOption)
+	bulker.RegisterOption(&OmitFieldsOption)
+	bulker.RegisterOption(&ComputedColumnsOption)
+	bulker.RegisterOption(&SchemaFieldOption)
+	bulker.RegisterOption(&HashedColumnsOption)
+	bulker.RegisterOption(&MaskingOption)
+	bulker.RegisterOption(&IndexesOption)
+	bulker.RegisterOption(&NotNullOption)
+	bulker.RegisterOption(&PartitionKeyOption)
+	bulker.RegisterOption(&ClusteringKeyOption)
+	bulker.RegisterOption(&DescriptionsOption)
+	bulker.RegisterOption(&AggregationOption)
+	bulker.RegisterOption(&QualityRulesOption)
+	bulker.RegisterOption(&TransformSQLOption)
+	bulker.RegisterOption(&TransformTableOption)
+	bulker.RegisterOption(&TransformIntervalOption)
+	bulker.RegisterOption(&SnapshotOption)
+	bulker.RegisterOption(&SnowpipeStreamingOption)
+	bulker.RegisterOption(&BigQueryStorageWriteOption)
+	bulker.RegisterOption(&BigQueryStreamingInsertsOption)
+	bulker.RegisterOption(&StringNormalizationOption)
+	bulker.RegisterOption(&TypeCoercionErrorsOption)
+	bulker.RegisterOption(&InternalBatchFileFormatOption)
+	bulker.RegisterOption(&BatchFileMarshallingOption)
+	bulker.RegisterOption(&StagingRetriesOption)
+	bulker.RegisterOption(&TombstonesOption)
+	bulker.RegisterOption(&MaintenanceOption)
+	bulker.RegisterOption(&CDCOption)
+	bulker.RegisterOption(&DryRunOption)
+	bulker.RegisterOption(&IntermediateFlushOption)
+	bulker.RegisterOption(&CheckpointsOption)
+	bulker.RegisterOption(&StagingSchemaOption)
+	bulker.RegisterOption(&ChunkedUploadOption)
+	bulker.RegisterOption(&ParallelLoadOption)
+	bulker.RegisterOption(&CrossBatchDedupOption)
+	bulker.RegisterOption(&SchemaFreezeOption)
+}
+
+func parseInternalBatchFileFormat(serialized any) (types.FileFormat, error) {
+	format, err := utils.ParseString(serialized)
+	if err != nil {
+		return "", err
+	}
+	switch types.FileFormat(format) {
+	case types.FileFormatNDJSON, types.FileFormatMsgPack:
+		return types.FileFormat(format), nil
+	default:
+		return "", fmt.Errorf("unsupported internalBatchFileFormat: %s. Supported formats: %s, %s", format, types.FileFormatNDJSON, types.FileFormatMsgPack)
+	}
+}
+
+// batchFileMarshallerConfig returns marshaller config for staged batch files with provided compression.
+// Fastest compression level is used when level is not configured
+func batchFileMarshallerConfig(options *bulker.StreamOptions, compression types.FileCompression) types.MarshallerConfig {
+	config := types.MarshallerConfig{}
+	if c := BatchFileMarshallingOption.Get(options); c != nil {
+		config = *c
+	}
+	if config.CompressionLevel == 0 && (compression == types.FileCompressionGZIP || compression == types.FileCompressionZSTD) {
+		config.CompressionLevel = 1
+	}
+	return config
+}
+
+func parseBatchFileMarshallingConfig(serialized any) (*types.MarshallerConfig, error) {
+	var raw []byte
+	switch v := serialized.(type) {
+	case *types.MarshallerConfig:
+		return v, nil
+	case string:
+		raw = []byte(v)
+	default:
+		var err error
+		raw, err = json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value type of batchFileMarshalling option: %T", v)
+		}
+	}
+	config := &types.MarshallerConfig{}
+	if err := json.Unmarshal(raw, config); err != nil {
+		return nil, fmt.Errorf("failed to parse batchFileMarshalling config: %v", err)
+	}
+	if config.BufferSize < 0 || config.FlushEvery < 0 || config.CompressionLevel < 0 || config.CompressionLevel > 22 {
+		return nil, fmt.Errorf("invalid batchFileMarshalling config: compressionLevel must be in 1-22 range, bufferSize and flushEvery must not be negative")
+	}
+	return config, nil
+}
+
+// WithBatchFileMarshalling sets compression level, write buffer size and flush cadence of staged batch files
+func WithBatchFileMarshalling(config types.MarshallerConfig) bulker.StreamOption {
+	return bulker.WithOption(&BatchFileMarshallingOption, &config)
 }
 
 type S3OptionConfig struct {
@@ -65,6 +304,47 @@ type S3OptionConfig struct {
 	Bucket      string `mapstructure:"bucket,omitempty" json:"bucket,omitempty" yaml:"bucket,omitempty"`
 	Region      string `mapstructure:"region,omitempty" json:"region,omitempty" yaml:"region,omitempty"`
 	Folder      string `mapstructure:"folder,omitempty" json:"folder,omitempty" yaml:"folder,omitempty"`
+	// RoleARN IAM role to assume for S3 access. When access key is not provided, default AWS credentials chain is used
+	RoleARN    string `mapstructure:"roleArn,omitempty" json:"roleArn,omitempty" yaml:"roleArn,omitempty"`
+	ExternalID string `mapstructure:"externalId,omitempty" json:"externalId,omitempty" yaml:"externalId,omitempty"`
+	// Endpoint of S3 compatible storage, e.g. MinIO, Cloudflare R2 or Backblaze B2.
+	// Warehouse must be able to read staged files from that storage too
+	Endpoint       string `mapstructure:"endpoint,omitempty" json:"endpoint,omitempty" yaml:"endpoint,omitempty"`
+	ForcePathStyle *bool  `mapstructure:"forcePathStyle,omitempty" json:"forcePathStyle,omitempty" yaml:"forcePathStyle,omitempty"`
+	CACert         string `mapstructure:"caCert,omitempty" json:"caCert,omitempty" yaml:"caCert,omitempty"`
+	// S3ObjectConfig tags, encryption, ACL and storage class of staged files
+	implementations.S3ObjectConfig `mapstructure:",squash" yaml:",inline"`
+	// S3CompatibilityConfig profile of S3 compatible storage and checksum toggles
+	implementations.S3CompatibilityConfig `mapstructure:",squash" yaml:",inline"`
+}
+
+// toS3Config returns config of S3 file adapter
+func (s3c *S3OptionConfig) toS3Config(fileConfig implementations.FileConfig) *implementations.S3Config {
+	return &implementations.S3Config{
+		AccessKey:             s3c.AccessKeyID,
+		SecretKey:             s3c.SecretKey,
+		Bucket:                s3c.Bucket,
+		Region:                s3c.Region,
+		Endpoint:              s3c.Endpoint,
+		ForcePathStyle:        s3c.ForcePathStyle,
+		CACert:                s3c.CACert,
+		RoleARN:               s3c.RoleARN,
+		ExternalID:            s3c.ExternalID,
+		S3ObjectConfig:        s3c.S3ObjectConfig,
+		FileConfig:            fileConfig,
+		S3CompatibilityConfig: s3c.S3CompatibilityConfig,
+	}
+}
+
+// AzureBlobOptionConfig Azure Blob Storage container used as a stage for batch files
+type AzureBlobOptionConfig struct {
+	AccountName string `mapstructure:"accountName,omitempty" json:"accountName,omitempty" yaml:"accountName,omitempty"`
+	Container   string `mapstructure:"container,omitempty" json:"container,omitempty" yaml:"container,omitempty"`
+	// SASToken shared access signature token. When empty, managed identity of the host is used
+	SASToken                string `mapstructure:"sasToken,omitempty" json:"sasToken,omitempty" yaml:"sasToken,omitempty"`
+	ManagedIdentityClientID string `mapstructure:"managedIdentityClientId,omitempty" json:"managedIdentityClientId,omitempty" yaml:"managedIdentityClientId,omitempty"`
+	Endpoint                string `mapstructure:"endpoint,omitempty" json:"endpoint,omitempty" yaml:"endpoint,omitempty"`
+	Folder                  string `mapstructure:"folder,omitempty" json:"folder,omitempty" yaml:"folder,omitempty"`
 }
 
 func WithOmitNils() bulker.StreamOption {
@@ -75,10 +355,54 @@ func WithoutOmitNils() bulker.StreamOption {
 	return bulker.WithOption(&OmitNilsOption, false)
 }
 
+// WithOmitFields drops specified event fields before schema inference and loading.
+// Nested fields are addressed with dot separated paths, e.g. "context.rawPayload"
+func WithOmitFields(paths ...string) bulker.StreamOption {
+	return bulker.WithOption(&OmitFieldsOption, paths)
+}
+
+func parseOmitFields(serialized any) ([]string, error) {
+	return parseStringList("omitFields", serialized)
+}
+
+// parseStringList parses list of strings provided as array or comma separated string
+func parseStringList(option string, serialized any) ([]string, error) {
+	switch v := serialized.(type) {
+	case []string:
+		return v, nil
+	case string:
+		if v == "" {
+			return nil, nil
+		}
+		paths := strings.Split(v, ",")
+		for i, path := range paths {
+			paths[i] = strings.TrimSpace(path)
+		}
+		return paths, nil
+	case []any:
+		paths := make([]string, 0, len(v))
+		for _, path := range v {
+			str, ok := path.(string)
+			if !ok {
+				return nil, fmt.Errorf("failed to parse '%s' option: %v incorrect type: %T expected string", option, path, path)
+			}
+			paths = append(paths, str)
+		}
+		return paths, nil
+	default:
+		return nil, fmt.Errorf("failed to parse '%s' option: %v incorrect type: %T expected string or []string", option, v, v)
+	}
+}
+
 func WithDeduplicateWindow(deduplicateWindow int) bulker.StreamOption {
 	return bulker.WithOption(&DeduplicateWindow, deduplicateWindow)
 }
 
+// WithDeduplicateLatest keeps the row with the latest version or timestamp among rows of a batch with the same primary key. See DeduplicateLatestOption
+func WithDeduplicateLatest() bulker.StreamOption {
+	return bulker.WithOption(&DeduplicateLatestOption, true)
+}
+
 func withColumnTypes(o *bulker.ImplementationOption[types.SQLTypes], fields types.SQLTypes) bulker.StreamOption {
 	return func(options *bulker.StreamOptions) {
 		sqlTypes := o.Get(options)
@@ -95,6 +419,21 @@ func WithColumnTypes(fields types.SQLTypes) bulker.StreamOption {
 	return withColumnTypes(&ColumnTypesOption, fields)
 }
 
+// WithColumnTypesMap pins columns to explicit SQL types: column name -> SQL type, e.g. {"amount": "NUMERIC(38,9)"}.
+// Pinned types take precedence over types inferred from values
+func WithColumnTypesMap(columnTypes map[string]string) bulker.StreamOption {
+	return withColumnTypes(&ColumnTypesOption, sqlTypesOf(columnTypes))
+}
+
+// sqlTypesOf returns overrides of column types: column name -> SQL type
+func sqlTypesOf(columnTypes map[string]string) types.SQLTypes {
+	sqlTypes := types.SQLTypes{}
+	for column, sqlType := range columnTypes {
+		sqlTypes.With(column, sqlType)
+	}
+	return sqlTypes
+}
+
 // WithColumnType provides overrides for column type of single column for current BulkerStream object fields
 func WithColumnType(columnName, sqlType string) bulker.StreamOption {
 	return withColumnTypes(&ColumnTypesOption, types.SQLTypes{}.With(columnName, sqlType))
@@ -114,6 +453,12 @@ func withLocalBatchFile(fileName string) bulker.StreamOption {
 	}
 }
 
+func withAzureBlobBatchFile(azureBlobOptionConfig *AzureBlobOptionConfig) bulker.StreamOption {
+	return func(options *bulker.StreamOptions) {
+		azureBlobBatchFileOption.Set(options, azureBlobOptionConfig)
+	}
+}
+
 func withS3BatchFile(s3OptionConfig *S3OptionConfig) bulker.StreamOption {
 	return func(options *bulker.StreamOptions) {
 		s3BatchFileOption.Set(options, s3OptionConfig)
@@ -0,0 +1,351 @@
+package sql
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/errorj"
+	"github.com/jitsucom/bulker/jitsubase/logging"
+	jsoniter "github.com/json-iterator/go"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+const (
+	defaultParallelLoadThresholdMb = 1024
+	defaultParallelLoadFiles       = 4
+)
+
+// ParallelLoadOption - batch file that exceeds threshold is split into N parts that are converted to the destination format
+// and uploaded to the stage concurrently. Parts are loaded with a single COPY over manifest or their common prefix when adapter supports it
+// (warehouses parallelize multi-file COPY) or one after another in the stream transaction otherwise.
+// Requires ndjson internalBatchFileFormat.
+// {"thresholdMb": 1024, "files": 4}
+var ParallelLoadOption = bulker.ImplementationOption[*ParallelLoadConfig]{
+	Key:       "parallelLoad",
+	ParseFunc: parseParallelLoadConfig,
+}
+
+// ParallelLoadConfig size of batch file that is loaded in parallel and number of its parts. See ParallelLoadOption
+type ParallelLoadConfig struct {
+	// ThresholdMb batch files of at least N megabytes are split into parts. Default: 1024
+	ThresholdMb int `json:"thresholdMb,omitempty"`
+	// Files number of parts processed concurrently. Default: 4
+	Files int `json:"files,omitempty"`
+}
+
+// Validate returns err if invalid
+func (c *ParallelLoadConfig) Validate() error {
+	if c.ThresholdMb < 0 || c.Files < 0 {
+		return fmt.Errorf("parallelLoad parameters must not be negative")
+	}
+	if c.Files == 1 {
+		return fmt.Errorf("parallelLoad requires at least 2 files")
+	}
+	return nil
+}
+
+// due returns true if batch file of provided size should be loaded in parallel
+func (c *ParallelLoadConfig) due(sizeBytes int64) bool {
+	threshold := c.ThresholdMb
+	if threshold == 0 {
+		threshold = defaultParallelLoadThresholdMb
+	}
+	return sizeBytes >= int64(threshold)*1024*1024
+}
+
+func (c *ParallelLoadConfig) files() int {
+	if c.Files == 0 {
+		return defaultParallelLoadFiles
+	}
+	return c.Files
+}
+
+func parseParallelLoadConfig(serialized any) (*ParallelLoadConfig, error) {
+	var raw []byte
+	switch v := serialized.(type) {
+	case *ParallelLoadConfig:
+		return v, v.Validate()
+	case string:
+		raw = []byte(v)
+	default:
+		var err error
+		raw, err = json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value type of parallelLoad option: %T", v)
+		}
+	}
+	config := &ParallelLoadConfig{}
+	if err := json.Unmarshal(raw, config); err != nil {
+		return nil, fmt.Errorf("failed to parse parallelLoad config: %v", err)
+	}
+	return config, config.Validate()
+}
+
+// WithParallelLoad splits large batch files into parts processed concurrently. See ParallelLoadOption
+func WithParallelLoad(config ParallelLoadConfig) bulker.StreamOption {
+	return bulker.WithOption(&ParallelLoadOption, &config)
+}
+
+// validateParallelLoadOption checks that batch file of stream can be split into parts
+func validateParallelLoadOption(p SQLAdapter, options *bulker.StreamOptions) error {
+	if ParallelLoadOption.Get(options) == nil {
+		return nil
+	}
+	if localBatchFileOption.Get(options) == "" {
+		return fmt.Errorf("%s supports parallelLoad only with batch file loading", p.Type())
+	}
+	if InternalBatchFileFormatOption.Get(options) != types.FileFormatNDJSON {
+		return fmt.Errorf("parallelLoad requires %s internalBatchFileFormat", types.FileFormatNDJSON)
+	}
+	return nil
+}
+
+// batchFileRange part of batch file of whole lines processed by one worker of parallel load
+type batchFileRange struct {
+	offset int64
+	length int64
+	// firstLine number of the first line of the range in batch file. Counted only when some lines are skipped by deduplication
+	firstLine int
+}
+
+// splitBatchFile splits batch file of provided size into at most n ranges of whole lines
+func splitBatchFile(file io.ReaderAt, size int64, n int) ([]batchFileRange, error) {
+	boundaries := []int64{0}
+	for i := 1; i < n; i++ {
+		offset := size * int64(i) / int64(n)
+		if offset <= boundaries[len(boundaries)-1] {
+			continue
+		}
+		rest, err := bufio.NewReader(io.NewSectionReader(file, offset, size-offset)).ReadBytes('\n')
+		if err == io.EOF {
+			//the last line: remaining part belongs to the previous range
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		boundary := offset + int64(len(rest))
+		if boundary >= size {
+			break
+		}
+		if boundary > boundaries[len(boundaries)-1] {
+			boundaries = append(boundaries, boundary)
+		}
+	}
+	boundaries = append(boundaries, size)
+	ranges := make([]batchFileRange, len(boundaries)-1)
+	for i := range ranges {
+		ranges[i] = batchFileRange{offset: boundaries[i], length: boundaries[i+1] - boundaries[i]}
+	}
+	return ranges, nil
+}
+
+// countBatchFileLines sets numbers of the first lines of ranges. Lines of ranges are counted concurrently
+func countBatchFileLines(file io.ReaderAt, ranges []batchFileRange) error {
+	counts := make([]int, len(ranges))
+	errs := make([]error, len(ranges))
+	wg := sync.WaitGroup{}
+	for i, r := range ranges {
+		wg.Add(1)
+		go func(i int, r batchFileRange) {
+			defer wg.Done()
+			buf := make([]byte, 1024*1024)
+			reader := io.NewSectionReader(file, r.offset, r.length)
+			for {
+				n, err := reader.Read(buf)
+				counts[i] += bytes.Count(buf[:n], []byte{'\n'})
+				if err == io.EOF {
+					return
+				} else if err != nil {
+					errs[i] = err
+					return
+				}
+			}
+		}(i, r)
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	for i := 1; i < len(ranges); i++ {
+		ranges[i].firstLine = ranges[i-1].firstLine + counts[i-1]
+	}
+	return nil
+}
+
+// flushBatchFileParallel converts parts of batch file to the destination format concurrently, stages and loads them to the table
+func (ps *AbstractTransactionalSQLStream) flushBatchFileParallel(ctx context.Context, table *Table, size int64) (state *bulker.WarehouseState, err error) {
+	convertStart := time.Now()
+	ranges, err := splitBatchFile(ps.batchFile, size, ps.parallelLoad.files())
+	if err != nil {
+		return nil, errorj.Decorate(err, "failed to split batch file")
+	}
+	if len(ps.batchFileSkipLines) > 0 {
+		if err = countBatchFileLines(ps.batchFile, ranges); err != nil {
+			return nil, errorj.Decorate(err, "failed to count lines of batch file")
+		}
+	}
+	columns := table.SortedColumnNames()
+	avroSchema := ps.sqlAdapter.GetAvroSchema(table)
+	parts := make([][]*os.File, len(ranges))
+	errs := make([]error, len(ranges))
+	wg := sync.WaitGroup{}
+	for i, r := range ranges {
+		wg.Add(1)
+		go func(i int, r batchFileRange) {
+			defer wg.Done()
+			parts[i], errs[i] = ps.convertBatchFileRange(r, columns, avroSchema)
+		}(i, r)
+	}
+	wg.Wait()
+	var files []*os.File
+	for _, part := range parts {
+		files = append(files, part...)
+	}
+	defer func() {
+		for _, file := range files {
+			_ = file.Close()
+			_ = os.Remove(file.Name())
+		}
+	}()
+	if err = errors.Join(errs...); err != nil {
+		return nil, errorj.Decorate(err, "failed to convert batch file")
+	}
+	logging.Infof("[%s] Converted batch file (%.2f mb) to %d %s files in %.2f s.", ps.id, float64(size)/1024/1024, len(files), ps.targetMarshaller.FileExtension(), time.Since(convertStart).Seconds())
+	return ps.loadFiles(ctx, table, files)
+}
+
+// convertBatchFileRange converts lines of range of batch file to the destination format skipping deduplicated ones.
+// Returns created files even on error, so they can be removed
+func (ps *AbstractTransactionalSQLStream) convertBatchFileRange(r batchFileRange, columns []string, avroSchema *types.AvroSchema) (files []*os.File, err error) {
+	file, err := os.CreateTemp("", path.Base(ps.batchFile.Name())+"_part*"+ps.targetMarshaller.FileExtension())
+	if err != nil {
+		return nil, err
+	}
+	files = []*os.File{file}
+	marshaller, err := ps.newTargetMarshaller()
+	if err != nil {
+		return files, err
+	}
+	if ps.chunkedUpload != nil {
+		chunks, err := newChunkedMarshaller(ps.chunkedUpload.chunkSize(), ps.newTargetMarshaller)
+		if err != nil {
+			return files, err
+		}
+		defer func() {
+			if len(chunks.files) > 0 {
+				files = chunks.files
+			}
+		}()
+		marshaller = chunks
+	}
+	if err = marshaller.InitSchema(file, columns, avroSchema); err != nil {
+		return files, err
+	}
+	scanner := bufio.NewScanner(io.NewSectionReader(ps.batchFile, r.offset, r.length))
+	scanner.Buffer(make([]byte, 1024*100), 1024*1024*10)
+	for i := r.firstLine; scanner.Scan(); i++ {
+		if ps.batchFileSkipLines.Contains(i) {
+			continue
+		}
+		dec := jsoniter.NewDecoder(bytes.NewReader(scanner.Bytes()))
+		if ps.targetMarshaller.Format() != types.FileFormatAVRO {
+			dec.UseNumber()
+		}
+		obj := make(map[string]any)
+		if err = dec.Decode(&obj); err != nil {
+			return files, errorj.Decorate(err, "failed to decode json object from batch file")
+		}
+		if err = marshaller.Marshal(obj); err != nil {
+			return files, errorj.Decorate(err, "failed to marshal object to converted batch file")
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return files, errorj.Decorate(err, "failed to read batch file")
+	}
+	if err = marshaller.Flush(); err != nil {
+		return files, err
+	}
+	return files, file.Sync()
+}
+
+// loadFiles stages converted files and loads them to the table. Files are loaded with a single statement over manifest listing them
+// or over their common prefix when adapter supports it. Otherwise, they are loaded one after another in the stream transaction
+func (ps *AbstractTransactionalSQLStream) loadFiles(ctx context.Context, table *Table, files []*os.File) (state *bulker.WarehouseState, err error) {
+	loadTime := time.Now()
+	retryConfig := StagingRetriesOption.Get(&ps.options)
+	var stage batchFileStage
+	var loadSource LoadSource
+	var folder string
+	if ps.s3 != nil {
+		s3Config := s3BatchFileOption.Get(&ps.options)
+		stage, folder = ps.s3, s3Config.Folder
+		loadSource = LoadSource{Type: AmazonS3, Format: ps.sqlAdapter.GetBatchFileFormat(), S3Config: s3Config}
+	} else if ps.azureBlob != nil {
+		azureBlobConfig := azureBlobBatchFileOption.Get(&ps.options)
+		stage, folder = ps.azureBlob, azureBlobConfig.Folder
+		loadSource = LoadSource{Type: AzureBlob, Format: ps.sqlAdapter.GetBatchFileFormat(), AzureBlobConfig: azureBlobConfig}
+	} else {
+		loadSource = LoadSource{Type: LocalFile, Format: ps.sqlAdapter.GetBatchFileFormat()}
+	}
+	var paths []string
+	if stage != nil {
+		prefix := chunksPrefix(stageFileName(folder, ps.batchFile.Name()), ps.marshaller.FileExtension())
+		concurrency := len(files)
+		if ps.chunkedUpload != nil {
+			concurrency = ps.chunkedUpload.concurrency()
+		}
+		uploaded, err := ps.uploadChunks(ctx, stage, files, prefix, concurrency)
+		for _, stageName := range uploaded {
+			defer stage.DeleteObject(stageName)
+		}
+		if err != nil {
+			return nil, errorj.Decorate(err, fmt.Sprintf("failed to upload files to %s", loadSource.Type))
+		}
+		logging.Infof("[%s] Batch file uploaded to %s in %d files in %.2f s.", ps.id, loadSource.Type, len(files), time.Since(loadTime).Seconds())
+		loadTime = time.Now()
+		loadSource.Path = prefix
+		if ok, err := ps.stageManifest(stage, &loadSource, uploaded); err != nil {
+			return nil, errorj.Decorate(err, fmt.Sprintf("failed to upload manifest to %s", loadSource.Type))
+		} else if ok {
+			defer stage.DeleteObject(loadSource.Path)
+			paths = []string{loadSource.Path}
+		} else if pl, ok := ps.sqlAdapter.(PrefixLoadSupport); ok && pl.SupportsPrefixLoad(loadSource.Type) {
+			paths = []string{prefix}
+		} else {
+			paths = uploaded
+		}
+	} else {
+		for _, file := range files {
+			paths = append(paths, file.Name())
+		}
+	}
+	for _, p := range paths {
+		source := loadSource
+		source.Path = p
+		err = ps.tx.WithSavepoint(ctx, loadTableSavepoint, retryConfig.LoadRetries, retryConfig.backoff, func() (err error) {
+			fileState, err := ps.tx.LoadTable(ctx, table, &source)
+			if err == nil {
+				if state == nil {
+					state = fileState
+				} else {
+					state.Merge(fileState)
+				}
+			}
+			return err
+		})
+		if err != nil {
+			return state, errorj.Decorate(err, "failed to flush tmp file to the warehouse")
+		}
+	}
+	logging.Infof("[%s] Batch file loaded to %s in %d statements in %.2f s.", ps.id, ps.sqlAdapter.Type(), len(paths), time.Since(loadTime).Seconds())
+	return state, nil
+}
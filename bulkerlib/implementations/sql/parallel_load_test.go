@@ -0,0 +1,46 @@
+package sql
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestSplitBatchFile(t *testing.T) {
+	reqr := require.New(t)
+	lines := make([]string, 0, 100)
+	for i := 0; i < 100; i++ {
+		lines = append(lines, fmt.Sprintf(`{"id":%d,"name":"%s"}`, i, strings.Repeat("a", i%7)))
+	}
+	content := strings.Join(lines, "\n") + "\n"
+	file := strings.NewReader(content)
+
+	ranges, err := splitBatchFile(file, int64(len(content)), 4)
+	reqr.NoError(err)
+	reqr.Len(ranges, 4)
+	reqr.NoError(countBatchFileLines(file, ranges))
+	var offset int64
+	for _, r := range ranges {
+		reqr.Equal(offset, r.offset)
+		part := content[r.offset : r.offset+r.length]
+		//ranges consist of whole lines
+		reqr.True(strings.HasSuffix(part, "\n"))
+		reqr.Equal(lines[r.firstLine]+"\n", part[:strings.Index(part, "\n")+1])
+		offset += r.length
+	}
+	reqr.Equal(int64(len(content)), offset)
+
+	//file of a single line can't be split
+	ranges, err = splitBatchFile(strings.NewReader(lines[0]), int64(len(lines[0])), 4)
+	reqr.NoError(err)
+	reqr.Len(ranges, 1)
+
+	_, err = parseParallelLoadConfig(`{"files": 1}`)
+	reqr.Error(err)
+	config, err := parseParallelLoadConfig(map[string]any{"thresholdMb": 10})
+	reqr.NoError(err)
+	reqr.False(config.due(9 * 1024 * 1024))
+	reqr.True(config.due(10 * 1024 * 1024))
+	reqr.Equal(defaultParallelLoadFiles, config.files())
+}
@@ -0,0 +1,66 @@
+package sql
+
+import (
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+)
+
+var (
+	// PartitionKeyOption - columns the destination table is partitioned by when it is created:
+	// BigQuery - daily time partitioning by a single column, ClickHouse - PARTITION BY.
+	// Supported only by adapters implementing PartitioningSupport
+	PartitionKeyOption = bulker.ImplementationOption[[]string]{
+		Key: "partitionKey",
+		ParseFunc: func(serialized any) ([]string, error) {
+			return parseStringList("partitionKey", serialized)
+		},
+	}
+
+	// ClusteringKeyOption - columns the destination table is clustered (sorted) by when it is created:
+	// BigQuery - clustering, ClickHouse - ORDER BY (after primary key columns), Snowflake - clustering key, Redshift - sort key.
+	// Supported only by adapters implementing PartitioningSupport
+	ClusteringKeyOption = bulker.ImplementationOption[[]string]{
+		Key: "clusteringKey",
+		ParseFunc: func(serialized any) ([]string, error) {
+			return parseStringList("clusteringKey", serialized)
+		},
+	}
+)
+
+// WithPartitionKey partitions created destination table by provided columns. See PartitionKeyOption
+func WithPartitionKey(columns ...string) bulker.StreamOption {
+	return bulker.WithOption(&PartitionKeyOption, columns)
+}
+
+// WithClusteringKey clusters created destination table by provided columns. See ClusteringKeyOption
+func WithClusteringKey(columns ...string) bulker.StreamOption {
+	return bulker.WithOption(&ClusteringKeyOption, columns)
+}
+
+// PartitioningSupport optional interface for SQLAdapter that translates PartitionKeyOption and ClusteringKeyOption to native constructs
+type PartitioningSupport interface {
+	// ValidatePartitioning returns error if table can't be partitioned or clustered by provided number of columns
+	ValidatePartitioning(partitionColumns, clusteringColumns int) error
+}
+
+// validatePartitioningOptions returns error if partitioning options are set but adapter doesn't support them
+func validatePartitioningOptions(p SQLAdapter, options *bulker.StreamOptions) error {
+	partitionColumns := len(PartitionKeyOption.Get(options))
+	clusteringColumns := len(ClusteringKeyOption.Get(options))
+	if partitionColumns == 0 && clusteringColumns == 0 {
+		return nil
+	}
+	if ps, ok := p.(PartitioningSupport); ok {
+		return ps.ValidatePartitioning(partitionColumns, clusteringColumns)
+	}
+	return fmt.Errorf("'%s' and '%s' options are not supported by %s", PartitionKeyOption.Key, ClusteringKeyOption.Key, p.Type())
+}
+
+// partitioningColumns returns columns of partitioning options adapted to column names of adapter
+func partitioningColumns(p SQLAdapter, columns []string) []string {
+	if len(columns) == 0 {
+		return nil
+	}
+	return utils.ArrayMap(columns, p.ColumnName)
+}
@@ -0,0 +1,61 @@
+package sql
+
+import (
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"sync"
+	"testing"
+)
+
+// TestPartitioning checks that destination table is created with partitioning and clustering keys where supported
+func TestPartitioning(t *testing.T) {
+	t.Parallel()
+	supported := []string{BigqueryBulkerTypeId, RedshiftBulkerTypeId, SnowflakeBulkerTypeId, ClickHouseBulkerTypeId, ClickHouseBulkerTypeId + "_cluster"}
+	tests := []bulkerTestConfig{
+		{
+			//delete any table leftovers from previous tests
+			name:      "dummy_test_table_cleanup",
+			tableName: "partitioning_test",
+			modes:     []bulker.BulkMode{bulker.Batch},
+			dataFile:  "test_data/empty.ndjson",
+			configIds: allBulkerConfigs,
+		},
+		{
+			name:              "clustering_key",
+			tableName:         "partitioning_test",
+			modes:             []bulker.BulkMode{bulker.Batch},
+			dataFile:          "test_data/partition1.ndjson",
+			streamOptions:     []bulker.StreamOption{bulker.WithPrimaryKey("id"), bulker.WithDeduplicate(), WithClusteringKey("name")},
+			expectedRowsCount: 5,
+			configIds:         utils.ArrayIntersection(allBulkerConfigs, supported),
+		},
+		{
+			name:              "partition_key",
+			tableName:         "partitioning_test_partitioned",
+			modes:             []bulker.BulkMode{bulker.Batch},
+			dataFile:          "test_data/partition1.ndjson",
+			streamOptions:     []bulker.StreamOption{WithPartitionKey("_timestamp"), WithClusteringKey("id", "name")},
+			expectedRowsCount: 5,
+			configIds:         utils.ArrayIntersection(allBulkerConfigs, []string{BigqueryBulkerTypeId, ClickHouseBulkerTypeId, ClickHouseBulkerTypeId + "_cluster"}),
+		},
+		{
+			name:           "unsupported",
+			tableName:      "partitioning_test",
+			modes:          []bulker.BulkMode{bulker.Batch},
+			dataFile:       "test_data/partition1.ndjson",
+			streamOptions:  []bulker.StreamOption{WithPartitionKey("_timestamp")},
+			expectedErrors: map[string]any{"create_stream": "not supported"},
+			configIds:      utils.ArrayIntersection(allBulkerConfigs, []string{PostgresBulkerTypeId, MySQLBulkerTypeId}),
+		},
+	}
+	sequentialGroup := sync.WaitGroup{}
+	sequentialGroup.Add(1)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runTestConfig(t, tt, testStream)
+			sequentialGroup.Done()
+		})
+		sequentialGroup.Wait()
+		sequentialGroup.Add(1)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"bytes"
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
 	bulker "github.com/jitsucom/bulker/bulkerlib"
 	types2 "github.com/jitsucom/bulker/bulkerlib/types"
@@ -23,6 +25,7 @@ import (
 
 func init() {
 	bulker.RegisterBulker(PostgresBulkerTypeId, NewPostgres)
+	bulker.RegisterConfigType(PostgresBulkerTypeId, PostgresConfig{})
 }
 
 const (
@@ -53,12 +56,16 @@ WHERE tco.constraint_type = 'PRIMARY KEY' AND
 	pgSetSearchPath                     = `SET search_path TO "%s";`
 	pgCreateDbSchemaIfNotExistsTemplate = `CREATE SCHEMA IF NOT EXISTS "%s"; SET search_path TO "%s";`
 	pgCreateIndexTemplate               = `CREATE INDEX ON %s (%s);`
+	pgCreateNamedIndexTemplate          = `CREATE %sINDEX IF NOT EXISTS %s ON %s (%s);`
+	pgSetNotNullTemplate                = `ALTER TABLE %s ALTER COLUMN %s SET NOT NULL;`
+	pgTableCommentTemplate              = `COMMENT ON TABLE %s IS %s;`
+	pgColumnCommentTemplate             = `COMMENT ON COLUMN %s.%s IS %s;`
 
-	pgMergeQuery = `INSERT INTO {{.TableName}}({{.Columns}}) VALUES ({{.Placeholders}}) ON CONFLICT ON CONSTRAINT {{.PrimaryKeyName}} DO UPDATE set {{.UpdateSet}}`
+	pgMergeQuery = `INSERT INTO {{.TableName}}{{if .VersionColumn}} AS T{{end}}({{.Columns}}) VALUES ({{.Placeholders}}) ON CONFLICT ON CONSTRAINT {{.PrimaryKeyName}} DO UPDATE set {{.UpdateSet}}{{if .VersionColumn}} WHERE T.{{.VersionColumn}} IS NULL OR T.{{.VersionColumn}} <= excluded.{{.VersionColumn}}{{end}}`
 
 	pgCopyTemplate = `COPY %s(%s) FROM STDIN`
 
-	pgBulkMergeQuery       = `INSERT INTO {{.TableTo}}({{.Columns}}) SELECT {{.Columns}} FROM {{.TableFrom}} ON CONFLICT ON CONSTRAINT {{.PrimaryKeyName}} DO UPDATE SET {{.UpdateSet}}`
+	pgBulkMergeQuery       = `INSERT INTO {{.TableTo}}{{if .VersionColumn}} AS T{{end}}({{.Columns}}) SELECT {{.Columns}} FROM {{.TableFrom}} ON CONFLICT ON CONSTRAINT {{.PrimaryKeyName}} DO UPDATE SET {{.UpdateSet}}{{if .VersionColumn}} WHERE T.{{.VersionColumn}} IS NULL OR T.{{.VersionColumn}} <= excluded.{{.VersionColumn}}{{end}}`
 	pgBulkMergeSourceAlias = `excluded`
 )
 
@@ -80,6 +87,11 @@ var (
 type PostgresConfig struct {
 	DataSourceConfig `mapstructure:",squash"`
 	SSLConfig        `mapstructure:",squash"`
+	// Timescale TimescaleDB hypertables settings
+	Timescale *TimescaleConfig `mapstructure:"timescale,omitempty" json:"timescale,omitempty" yaml:"timescale,omitempty"`
+	// credentialsProvider if set, provides username and password for every new connection instead of static ones.
+	// Used for short-lived credentials, e.g. Redshift IAM authentication
+	credentialsProvider func(ctx context.Context) (username, password string, err error)
 }
 
 // Postgres is adapter for creating,patching (schema or table), inserting data to postgres
@@ -99,7 +111,7 @@ func NewPostgres(bulkerConfig bulker.Config) (bulker.Bulker, error) {
 	}
 	//create tmp dir for ssl certs if any
 	tmpDir, err := os.MkdirTemp("", "postgres_"+bulkerConfig.Id)
-	if err != nil && (config.SSLMode == "verify-ca" || config.SSLMode == "verify-full") {
+	if err != nil && (config.SSLMode == "verify-ca" || config.SSLMode == "verify-full" || config.TLS.HasCertificates()) {
 		return nil, fmt.Errorf("failed to create tmp dir for postgres ssl certs: %v", err)
 	}
 	if err = ProcessSSL(tmpDir, config); err != nil {
@@ -136,9 +148,9 @@ func NewPostgres(bulkerConfig bulker.Config) (bulker.Bulker, error) {
 
 	dbConnectFunction := func(cfg *PostgresConfig) (*sql.DB, error) {
 		connectionString := fmt.Sprintf("host=%s port=%d dbname=%s user=%s password=%s search_path=%s",
-			config.Host, config.Port, config.Db, config.Username, config.Password, config.Schema)
+			cfg.Host, cfg.Port, cfg.Db, cfg.Username, cfg.Password, cfg.Schema)
 		//concat provided connection parameters
-		for k, v := range config.Parameters {
+		for k, v := range cfg.Parameters {
 			connectionString += " " + k + "=" + v + " "
 		}
 		logging.Infof("[%s] connecting: %s", bulkerConfig.Id, connectionString)
@@ -147,6 +159,11 @@ func NewPostgres(bulkerConfig bulker.Config) (bulker.Bulker, error) {
 		if err != nil {
 			return nil, err
 		}
+		if cfg.credentialsProvider != nil {
+			pqDriver := dataSource.Driver()
+			_ = dataSource.Close()
+			dataSource = sql.OpenDB(&credentialsConnector{driver: pqDriver, config: cfg})
+		}
 		if err := dataSource.Ping(); err != nil {
 			_ = dataSource.Close()
 			return nil, err
@@ -158,11 +175,61 @@ func NewPostgres(bulkerConfig bulker.Config) (bulker.Bulker, error) {
 	sqlAdapterBase, err := newSQLAdapterBase(bulkerConfig.Id, PostgresBulkerTypeId, config, dbConnectFunction, postgresDataTypes, queryLogger, typecastFunc, IndexParameterPlaceholder, pgColumnDDL, valueMappingFunc, checkErr)
 	p := &Postgres{sqlAdapterBase, tmpDir}
 	p.temporaryTables = false
+	p.constraints = &constraintsDialect{
+		indexStatement: func(quotedTableName, indexName string, unique bool, quotedColumns []string) string {
+			indexType := ""
+			if unique {
+				indexType = "UNIQUE "
+			}
+			return fmt.Sprintf(pgCreateNamedIndexTemplate, indexType, indexName, quotedTableName, strings.Join(quotedColumns, ", "))
+		},
+		notNullStatement: func(quotedTableName, quotedColumnName string, column types2.SQLColumn) string {
+			return fmt.Sprintf(pgSetNotNullTemplate, quotedTableName, quotedColumnName)
+		},
+	}
+	p.comments = pgCommentsDialect(false)
+	p.statementTimeout = time.Duration(bulkerConfig.StatementTimeoutSec) * time.Second
+	p.setConnMaxLifetime(time.Duration(bulkerConfig.ConnMaxLifetimeSec) * time.Second)
 	p.tableHelper = NewTableHelper(63, '"')
+	p.schemaRouter = newSchemaRouter(p, bulkerConfig, "defaultSchema")
+	if replica := config.ReadReplica(); replica != nil && err == nil {
+		err = p.connectReadReplica(&PostgresConfig{DataSourceConfig: *replica, SSLConfig: config.SSLConfig})
+	}
 	return p, err
 }
 
+// credentialsConnector opens connections with credentials requested from config's credentialsProvider
+type credentialsConnector struct {
+	driver driver.Driver
+	config *PostgresConfig
+}
+
+func (c *credentialsConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	username, password, err := c.config.credentialsProvider(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain credentials: %v", err)
+	}
+	connectionString := fmt.Sprintf("host=%s port=%d dbname=%s user=%s password=%s search_path=%s",
+		c.config.Host, c.config.Port, c.config.Db, postgresConnParam(username), postgresConnParam(password), c.config.Schema)
+	for k, v := range c.config.Parameters {
+		connectionString += " " + k + "=" + v + " "
+	}
+	return c.driver.Open(connectionString)
+}
+
+func (c *credentialsConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// postgresConnParam quotes connection string parameter value. Temporary credentials may contain special characters
+func postgresConnParam(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
 func (p *Postgres) CreateStream(id, tableName string, mode bulker.BulkMode, streamOptions ...bulker.StreamOption) (bulker.BulkerStream, error) {
+	if routed, err := p.schemaRouter.routedStream(id, tableName, mode, streamOptions); routed != nil || err != nil {
+		return routed, err
+	}
 	streamOptions = append(streamOptions, withLocalBatchFile(fmt.Sprintf("bulker_%s", utils.SanitizeString(id))))
 
 	if err := p.validateOptions(streamOptions); err != nil {
@@ -177,6 +244,12 @@ func (p *Postgres) CreateStream(id, tableName string, mode bulker.BulkMode, stre
 		return newReplaceTableStream(id, p, tableName, streamOptions...)
 	case bulker.ReplacePartition:
 		return newReplacePartitionStream(id, p, tableName, streamOptions...)
+	case bulker.UpdateColumns:
+		return newUpdateColumnsStream(id, p, tableName, streamOptions...)
+	case bulker.SCD2:
+		return newSCD2Stream(id, p, tableName, streamOptions...)
+	case bulker.CDC:
+		return newCDCStream(id, p, tableName, streamOptions...)
 	}
 	return nil, fmt.Errorf("unsupported bulk mode: %s", mode)
 }
@@ -194,6 +267,21 @@ func (p *Postgres) OpenTx(ctx context.Context) (*TxSQLAdapter, error) {
 	return p.openTx(ctx, p)
 }
 
+// SupportsVersionMerge ON CONFLICT DO UPDATE skips rows with higher version
+func (p *Postgres) SupportsVersionMerge() bool {
+	return true
+}
+
+// SupportsSavepoints Postgres supports SAVEPOINT inside transactions
+func (p *Postgres) SupportsSavepoints() bool {
+	return true
+}
+
+// SupportsStagingSchema tmp tables may be created in other schema of the same connection
+func (p *Postgres) SupportsStagingSchema() bool {
+	return true
+}
+
 // InitDatabase creates database schema instance if doesn't exist
 func (p *Postgres) InitDatabase(ctx context.Context) error {
 	query := fmt.Sprintf(pgCreateDbSchemaIfNotExistsTemplate, p.config.Schema, p.config.Schema)
@@ -238,7 +326,7 @@ func (p *Postgres) GetTableSchema(ctx context.Context, tableName string) (*Table
 func (p *Postgres) getTable(ctx context.Context, tableName string) (*Table, error) {
 	tableName = p.TableName(tableName)
 	table := &Table{Name: tableName, Columns: map[string]types2.SQLColumn{}, PKFields: utils.Set[string]{}}
-	rows, err := p.txOrDb(ctx).QueryContext(ctx, pgTableSchemaQuery, p.config.Schema, tableName)
+	rows, err := p.readTxOrDb(ctx).QueryContext(ctx, pgTableSchemaQuery, p.config.Schema, tableName)
 	if err != nil {
 		return nil, errorj.GetTableError.Wrap(err, "failed to get table columns").
 			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
@@ -293,6 +381,38 @@ func (p *Postgres) Insert(ctx context.Context, table *Table, merge bool, objects
 	}
 }
 
+// UpdateColumns updates columns of target table rows matching source table rows by primary key
+func (p *Postgres) UpdateColumns(ctx context.Context, targetTable *Table, sourceTable *Table) (*bulker.WarehouseState, error) {
+	return nil, p.updateColumnsFrom(ctx, targetTable, sourceTable, updateFromQueryTemplate, false)
+}
+
+// CloseVersions closes current versions of target table rows matching source table rows by key columns
+func (p *Postgres) CloseVersions(ctx context.Context, targetTable *Table, sourceTable *Table, keyColumns []string) (*bulker.WarehouseState, error) {
+	return nil, p.closeVersionsFrom(ctx, targetTable, sourceTable, keyColumns, updateFromQueryTemplate, false)
+}
+
+// MaintainTable runs ANALYZE (default) or VACUUM on table
+func (p *Postgres) MaintainTable(ctx context.Context, tableName string, config *MaintenanceConfig) error {
+	quotedTableName := p.quotedTableName(tableName)
+	var statements []string
+	for _, task := range config.tasksOrDefault(MaintenanceAnalyze) {
+		switch task {
+		case MaintenanceAnalyze:
+			statements = append(statements, "ANALYZE "+quotedTableName)
+		case MaintenanceVacuum:
+			statements = append(statements, "VACUUM "+quotedTableName)
+		default:
+			return unsupportedMaintenanceTask(p.Type(), task)
+		}
+	}
+	return p.runMaintenance(ctx, quotedTableName, statements)
+}
+
+// DeleteByKeys deletes rows of target table matching source table rows by key columns
+func (p *Postgres) DeleteByKeys(ctx context.Context, targetTable *Table, sourceTable *Table, keyColumns []string) (*bulker.WarehouseState, error) {
+	return nil, p.deleteByKeysFrom(ctx, targetTable, sourceTable, keyColumns)
+}
+
 func (p *Postgres) CopyTables(ctx context.Context, targetTable *Table, sourceTable *Table, mergeWindow int) (*bulker.WarehouseState, error) {
 	if mergeWindow <= 0 {
 		return nil, p.copy(ctx, targetTable, sourceTable)
@@ -302,7 +422,7 @@ func (p *Postgres) CopyTables(ctx context.Context, targetTable *Table, sourceTab
 }
 
 func (p *Postgres) LoadTable(ctx context.Context, targetTable *Table, loadSource *LoadSource) (state *bulker.WarehouseState, err error) {
-	quotedTableName := p.quotedTableName(targetTable.Name)
+	quotedTableName := p.quotedTable(targetTable)
 	if loadSource.Type != LocalFile {
 		return state, fmt.Errorf("LoadTable: only local file is supported")
 	}
@@ -315,9 +435,16 @@ func (p *Postgres) LoadTable(ctx context.Context, targetTable *Table, loadSource
 		columnNames[i] = p.quotedColumnName(name)
 	}
 	copyStatement := fmt.Sprintf(pgCopyTemplate, quotedTableName, strings.Join(columnNames, ", "))
+	// COPY is a single statement fed row by row, so statement timeout limits the whole load
+	ctx, cancel := statementContext(ctx, p.statementTimeout)
+	defer cancel()
 	defer func() {
 		if err != nil {
-			err = errorj.LoadError.Wrap(err, "failed to load table").
+			loadError := errorj.LoadError
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) && p.statementTimeout > 0 {
+				loadError = errorj.StatementTimeoutError
+			}
+			err = loadError.Wrap(err, "failed to load table").
 				WithProperty(errorj.DBInfo, &types2.ErrorPayload{
 					Schema:      p.config.Schema,
 					Table:       quotedTableName,
@@ -405,7 +532,7 @@ func getDefaultValueStatement(sqlType string) string {
 func (p *Postgres) getPrimaryKey(ctx context.Context, tableName string) (string, utils.Set[string], error) {
 	tableName = p.TableName(tableName)
 	primaryKeys := utils.Set[string]{}
-	pkFieldsRows, err := p.txOrDb(ctx).QueryContext(ctx, pgPrimaryKeyFieldsQuery, p.config.Schema, tableName)
+	pkFieldsRows, err := p.readTxOrDb(ctx).QueryContext(ctx, pgPrimaryKeyFieldsQuery, p.config.Schema, tableName)
 	if err != nil {
 		return "", nil, errorj.GetPrimaryKeysError.Wrap(err, "failed to get primary key").
 			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
@@ -454,12 +581,31 @@ func (p *Postgres) getPrimaryKey(ctx context.Context, tableName string) (string,
 	return primaryKeyName, primaryKeys, nil
 }
 
+// pgCommentsDialect COMMENT ON statements of Postgres-like databases. escapeBackslash - database treats backslash in string literals as escape character
+func pgCommentsDialect(escapeBackslash bool) *commentsDialect {
+	return &commentsDialect{
+		tableCommentStatement: func(quotedTableName, comment string) string {
+			return fmt.Sprintf(pgTableCommentTemplate, quotedTableName, quotedComment(comment, escapeBackslash))
+		},
+		columnCommentStatement: func(quotedTableName, quotedColumnName, comment string) string {
+			return fmt.Sprintf(pgColumnCommentTemplate, quotedTableName, quotedColumnName, quotedComment(comment, escapeBackslash))
+		},
+	}
+}
+
 func (p *Postgres) CreateTable(ctx context.Context, schemaToCreate *Table) error {
 	err := p.SQLAdapterBase.CreateTable(ctx, schemaToCreate)
 	if err != nil {
 		return err
 	}
-	if !schemaToCreate.Temporary && schemaToCreate.TimestampColumn != "" {
+	if p.hypertable(schemaToCreate) {
+		// hypertable has index on partitioning column by default
+		err = p.createHypertable(ctx, schemaToCreate)
+		if err != nil {
+			p.DropTable(ctx, schemaToCreate.Name, true)
+			return err
+		}
+	} else if !schemaToCreate.Temporary && schemaToCreate.TimestampColumn != "" {
 		err = p.createIndex(ctx, schemaToCreate)
 		if err != nil {
 			p.DropTable(ctx, schemaToCreate.Name, true)
@@ -500,7 +646,7 @@ func (p *Postgres) createIndex(ctx context.Context, table *Table) error {
 	if table.TimestampColumn == "" {
 		return nil
 	}
-	quotedTableName := p.quotedTableName(table.Name)
+	quotedTableName := p.quotedTable(table)
 
 	statement := fmt.Sprintf(pgCreateIndexTemplate,
 		quotedTableName, p.quotedColumnName(table.TimestampColumn))
@@ -581,6 +727,9 @@ func (sc *SSLConfig) ValidateSSL() error {
 // enriches input DataSourceConfig parameters with SSL config
 // ssl configuration might be file path as well as string content
 func ProcessSSL(dir string, dsc *PostgresConfig) error {
+	if dsc.SSLMode == SSLModeNotProvided && dsc.TLS != nil {
+		return processTLS(dir, dsc)
+	}
 	dsc.ValidateSSL()
 
 	if dsc.SSLMode == SSLModeNotProvided {
@@ -618,6 +767,35 @@ func ProcessSSL(dir string, dsc *PostgresConfig) error {
 	return nil
 }
 
+// processTLS maps uniform TLS config to driver ssl parameters.
+// Driver doesn't support overriding of server name so TLS.ServerName is ignored
+func processTLS(dir string, dsc *PostgresConfig) error {
+	if dsc.TLS.InsecureSkipVerify {
+		dsc.Parameters["sslmode"] = SSLModeRequire
+	} else {
+		dsc.Parameters["sslmode"] = SSLModeVerifyFull
+	}
+	for _, f := range []struct{ name, param, value string }{
+		{"server_ca", "sslrootcert", dsc.TLS.CA},
+		{"client_cert", "sslcert", dsc.TLS.ClientCert},
+		{"client_key", "sslkey", dsc.TLS.ClientKey},
+	} {
+		if f.value == "" {
+			continue
+		}
+		if !utils.IsPEM(f.value) {
+			dsc.Parameters[f.param] = f.value
+			continue
+		}
+		filePath, err := getSSLFilePath(f.name, dir, f.value)
+		if err != nil {
+			return fmt.Errorf("error saving %s: %v", f.name, err)
+		}
+		dsc.Parameters[f.param] = filePath
+	}
+	return nil
+}
+
 // getSSLFilePath checks if input payload is filepath - returns it
 // otherwise write payload as a file and returns abs file path
 func getSSLFilePath(name, dir, payload string) (string, error) {
@@ -0,0 +1,63 @@
+package sql
+
+import (
+	"context"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/jitsubase/errorj"
+)
+
+// PreCommitHookOption - callback invoked after batch is loaded to tmp table but before it is copied to destination table and committed.
+// Error returned by the hook vetoes the commit: transaction is rolled back and Complete returns the error.
+// Supported in batch, cdc, replace_table and replace_partition modes. Can be set only programmatically with WithPreCommitHook
+var PreCommitHookOption = bulker.ImplementationOption[PreCommitHook]{
+	Key: "preCommitHook",
+}
+
+// PreCommitHook validates loaded batch before commit. See PreCommitHookOption
+type PreCommitHook func(ctx context.Context, preview *BatchPreview) error
+
+// BatchPreview loaded but not yet committed batch passed to PreCommitHook
+type BatchPreview struct {
+	// TableName destination table
+	TableName string
+	// TmpTableName table where rows of the batch are loaded. Empty when batch consists of tombstones only
+	TmpTableName string
+	// SuccessfulRows number of consumed objects including tombstones
+	SuccessfulRows int
+	// RejectedRows number of objects rejected by Consume
+	RejectedRows int
+	// Tombstones number of primary keys to be deleted (or flagged) in destination table. See TombstonesOption
+	Tombstones int
+	// Tx transaction of the stream for read-only queries: tmp table may be visible only within it.
+	// nil for destinations that don't run statements in SQL transactions (BigQuery)
+	Tx TxOrDB
+}
+
+// WithPreCommitHook sets callback that can veto commit of loaded batch. See PreCommitHookOption
+func WithPreCommitHook(hook PreCommitHook) bulker.StreamOption {
+	return bulker.WithOption(&PreCommitHookOption, hook)
+}
+
+// runPreCommitHook passes loaded batch to PreCommitHook and returns error if hook vetoed the commit
+func (ps *AbstractTransactionalSQLStream) runPreCommitHook(ctx context.Context) error {
+	hook := PreCommitHookOption.Get(&ps.options)
+	if hook == nil {
+		return nil
+	}
+	preview := &BatchPreview{
+		TableName:      ps.tableName,
+		SuccessfulRows: ps.state.SuccessfulRows,
+		RejectedRows:   ps.state.RejectedRows,
+		Tombstones:     len(ps.pendingTombstones),
+	}
+	if ps.tmpTable != nil {
+		preview.TmpTableName = ps.tmpTable.Name
+	}
+	if ps.tx.tx.connected() {
+		preview.Tx = ps.tx.tx
+	}
+	if err := hook(ctx, preview); err != nil {
+		return errorj.PreCommitHookError.Wrap(err, "commit was vetoed by pre-commit hook")
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"sync"
+	"testing"
+)
+
+// TestPreCommitHook checks that pre-commit hook receives loaded batch and can veto its commit
+func TestPreCommitHook(t *testing.T) {
+	t.Parallel()
+	veto := func(ctx context.Context, preview *BatchPreview) error {
+		return fmt.Errorf("batch of %d rows is vetoed", preview.SuccessfulRows)
+	}
+	accept := func(ctx context.Context, preview *BatchPreview) error {
+		if preview.TmpTableName == "" || preview.SuccessfulRows != 5 {
+			return fmt.Errorf("unexpected preview: %+v", *preview)
+		}
+		return nil
+	}
+	tests := []bulkerTestConfig{
+		{
+			//delete any table leftovers from previous tests
+			name:      "dummy_test_table_cleanup",
+			tableName: "pre_commit_hook_test",
+			modes:     []bulker.BulkMode{bulker.Batch},
+			dataFile:  "test_data/empty.ndjson",
+			configIds: allBulkerConfigs,
+		},
+		{
+			name:           "vetoed_batch",
+			tableName:      "pre_commit_hook_test",
+			modes:          []bulker.BulkMode{bulker.Batch, bulker.ReplaceTable},
+			dataFile:       "test_data/partition1.ndjson",
+			streamOptions:  []bulker.StreamOption{WithPreCommitHook(veto)},
+			expectedErrors: map[string]any{"stream_complete": "batch of 5 rows is vetoed"},
+			configIds:      allBulkerConfigs,
+		},
+		{
+			name:           "vetoed_partition",
+			tableName:      "pre_commit_hook_test",
+			modes:          []bulker.BulkMode{bulker.ReplacePartition},
+			dataFile:       "test_data/partition1.ndjson",
+			streamOptions:  []bulker.StreamOption{bulker.WithPartition("1"), WithPreCommitHook(veto)},
+			expectedErrors: map[string]any{"stream_complete": "batch of 5 rows is vetoed"},
+			configIds:      allBulkerConfigs,
+		},
+		{
+			name:              "accepted_batch",
+			tableName:         "pre_commit_hook_test",
+			modes:             []bulker.BulkMode{bulker.Batch, bulker.ReplaceTable},
+			dataFile:          "test_data/partition1.ndjson",
+			streamOptions:     []bulker.StreamOption{WithPreCommitHook(accept)},
+			expectedRowsCount: 5,
+			configIds:         allBulkerConfigs,
+		},
+	}
+	sequentialGroup := sync.WaitGroup{}
+	sequentialGroup.Add(1)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runTestConfig(t, tt, testStream)
+			sequentialGroup.Done()
+		})
+		sequentialGroup.Wait()
+		sequentialGroup.Add(1)
+	}
+}
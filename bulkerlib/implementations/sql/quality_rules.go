@@ -0,0 +1,256 @@
+package sql
+
+import (
+	"encoding/json"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/logging"
+	"github.com/jitsucom/bulker/jitsubase/timestamp"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type QualityRuleType string
+
+const (
+	// QualityRuleNullRate share of rows with null or missing field must not exceed MaxNullRate
+	QualityRuleNullRate QualityRuleType = "nullRate"
+	// QualityRuleAcceptedValues non-null field values must be one of Values
+	QualityRuleAcceptedValues QualityRuleType = "acceptedValues"
+	// QualityRuleRegex non-null field values must match Pattern
+	QualityRuleRegex QualityRuleType = "regex"
+	// QualityRuleFreshness the latest timestamp of the field in batch must not be older than MaxAgeSec
+	QualityRuleFreshness QualityRuleType = "freshness"
+)
+
+type QualityRuleAction string
+
+const (
+	// QualityActionFail fails the batch: nothing is committed to destination table
+	QualityActionFail QualityRuleAction = "fail"
+	// QualityActionWarn only reports violation in stream state
+	QualityActionWarn QualityRuleAction = "warn"
+)
+
+// maxQualityViolationExamples number of offending values included in check result message
+const maxQualityViolationExamples = 3
+
+// QualityRule data quality rule evaluated over all rows of the batch before commit
+type QualityRule struct {
+	Type  QualityRuleType `json:"type"`
+	Field string          `json:"field"`
+	// Action on violation: 'fail' or 'warn'. Default: fail
+	Action QualityRuleAction `json:"action,omitempty"`
+	// MaxNullRate for 'nullRate' rule: 0..1
+	MaxNullRate float64 `json:"maxNullRate,omitempty"`
+	// Values for 'acceptedValues' rule
+	Values []any `json:"values,omitempty"`
+	// Pattern for 'regex' rule
+	Pattern string `json:"pattern,omitempty"`
+	// MaxAgeSec for 'freshness' rule
+	MaxAgeSec int `json:"maxAgeSec,omitempty"`
+}
+
+func (qr *QualityRule) Validate() error {
+	if qr.Field == "" {
+		return fmt.Errorf("quality rule '%s': field is required", qr.Type)
+	}
+	switch qr.Action {
+	case "":
+		qr.Action = QualityActionFail
+	case QualityActionFail, QualityActionWarn:
+	default:
+		return fmt.Errorf("quality rule '%s': unsupported action '%s'. Supported: fail, warn", qr.Type, qr.Action)
+	}
+	switch qr.Type {
+	case QualityRuleNullRate:
+		if qr.MaxNullRate < 0 || qr.MaxNullRate > 1 {
+			return fmt.Errorf("quality rule 'nullRate': maxNullRate must be between 0 and 1")
+		}
+	case QualityRuleAcceptedValues:
+		if len(qr.Values) == 0 {
+			return fmt.Errorf("quality rule 'acceptedValues': values are required")
+		}
+	case QualityRuleRegex:
+		if _, err := regexp.Compile(qr.Pattern); err != nil {
+			return fmt.Errorf("quality rule 'regex': invalid pattern: %v", err)
+		}
+	case QualityRuleFreshness:
+		if qr.MaxAgeSec <= 0 {
+			return fmt.Errorf("quality rule 'freshness': maxAgeSec must be positive")
+		}
+	default:
+		return fmt.Errorf("unsupported quality rule type '%s'. Supported: nullRate, acceptedValues, regex, freshness", qr.Type)
+	}
+	return nil
+}
+
+// qualityRuleState accumulated values of a rule during the batch
+type qualityRuleState struct {
+	rule   QualityRule
+	column string
+	regex  *regexp.Regexp
+	// accepted values formatted with fmt.Sprint
+	accepted   utils.Set[string]
+	nulls      int
+	violations int
+	examples   []string
+	latest     time.Time
+}
+
+// qualityChecker evaluates data quality rules over rows consumed by the stream
+type qualityChecker struct {
+	rows  int
+	rules []*qualityRuleState
+}
+
+func newQualityChecker(rules []QualityRule, sqlAdapter SQLAdapter) *qualityChecker {
+	qc := &qualityChecker{}
+	for _, rule := range rules {
+		rs := &qualityRuleState{rule: rule, column: sqlAdapter.ColumnName(rule.Field)}
+		switch rule.Type {
+		case QualityRuleRegex:
+			rs.regex = regexp.MustCompile(rule.Pattern)
+		case QualityRuleAcceptedValues:
+			rs.accepted = utils.NewSet[string]()
+			for _, v := range rule.Values {
+				rs.accepted.Put(fmt.Sprint(v))
+			}
+		}
+		qc.rules = append(qc.rules, rs)
+	}
+	return qc
+}
+
+func (qc *qualityChecker) add(object types.Object) {
+	qc.rows++
+	for _, rs := range qc.rules {
+		value := object[rs.column]
+		if value == nil {
+			rs.nulls++
+			continue
+		}
+		switch rs.rule.Type {
+		case QualityRuleAcceptedValues:
+			if s := fmt.Sprint(value); !rs.accepted.Contains(s) {
+				rs.violation(s)
+			}
+		case QualityRuleRegex:
+			if s := fmt.Sprint(value); !rs.regex.MatchString(s) {
+				rs.violation(s)
+			}
+		case QualityRuleFreshness:
+			t, ok := value.(time.Time)
+			if !ok {
+				var err error
+				if t, err = timestamp.ParseISOFormat(fmt.Sprint(value)); err != nil {
+					rs.violation(fmt.Sprint(value))
+					continue
+				}
+			}
+			if t.After(rs.latest) {
+				rs.latest = t
+			}
+		}
+	}
+}
+
+func (rs *qualityRuleState) violation(value string) {
+	rs.violations++
+	if len(rs.examples) < maxQualityViolationExamples {
+		rs.examples = append(rs.examples, utils.ShortenString(value, 64))
+	}
+}
+
+// evaluate returns results of all rules and error if any of rules with 'fail' action is violated
+func (qc *qualityChecker) evaluate(now time.Time) ([]bulker.QualityCheckResult, error) {
+	results := make([]bulker.QualityCheckResult, 0, len(qc.rules))
+	var failed []string
+	for _, rs := range qc.rules {
+		message := rs.check(qc.rows, now)
+		results = append(results, bulker.QualityCheckResult{
+			Rule:    string(rs.rule.Type),
+			Field:   rs.rule.Field,
+			Action:  string(rs.rule.Action),
+			Passed:  message == "",
+			Message: message,
+		})
+		if message != "" {
+			if rs.rule.Action == QualityActionFail {
+				failed = append(failed, fmt.Sprintf("%s(%s): %s", rs.rule.Type, rs.rule.Field, message))
+			} else {
+				logging.Warnf("data quality rule %s(%s) violated: %s", rs.rule.Type, rs.rule.Field, message)
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return results, fmt.Errorf("data quality check failed: %s", strings.Join(failed, "; "))
+	}
+	return results, nil
+}
+
+// check returns violation message or empty string when rule passed
+func (rs *qualityRuleState) check(rows int, now time.Time) string {
+	if rows == 0 {
+		return ""
+	}
+	switch rs.rule.Type {
+	case QualityRuleNullRate:
+		rate := float64(rs.nulls) / float64(rows)
+		if rate > rs.rule.MaxNullRate {
+			return fmt.Sprintf("null rate %.4f exceeds %.4f (%d of %d rows)", rate, rs.rule.MaxNullRate, rs.nulls, rows)
+		}
+	case QualityRuleFreshness:
+		maxAge := time.Duration(rs.rule.MaxAgeSec) * time.Second
+		if rs.latest.IsZero() {
+			return "no valid timestamps in batch"
+		}
+		if age := now.Sub(rs.latest); age > maxAge {
+			return fmt.Sprintf("latest timestamp %s is older than %s", rs.latest.Format(time.RFC3339), maxAge)
+		}
+	}
+	if rs.violations > 0 {
+		return fmt.Sprintf("%d of %d rows violate rule. Examples: %s", rs.violations, rows, strings.Join(rs.examples, ", "))
+	}
+	return ""
+}
+
+// parseQualityRules parses 'qualityRules' option from list of maps or json string
+func parseQualityRules(serialized any) ([]QualityRule, error) {
+	var raw []byte
+	switch v := serialized.(type) {
+	case []QualityRule:
+		for i := range v {
+			if err := v[i].Validate(); err != nil {
+				return nil, err
+			}
+		}
+		return v, nil
+	case string:
+		raw = []byte(v)
+	default:
+		var err error
+		raw, err = json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value type of qualityRules option: %T", v)
+		}
+	}
+	var rules []QualityRule
+	if err := json.Unmarshal(raw, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse qualityRules: %v", err)
+	}
+	for i := range rules {
+		if err := rules[i].Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+// WithQualityRules sets data quality rules evaluated over the batch before commit
+func WithQualityRules(rules ...QualityRule) bulker.StreamOption {
+	return bulker.WithOption(&QualityRulesOption, rules)
+}
@@ -0,0 +1,79 @@
+package sql
+
+import (
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestParseQualityRules(t *testing.T) {
+	rules, err := parseQualityRules(`[{"type": "nullRate", "field": "email", "maxNullRate": 0.1}, {"type": "regex", "field": "id", "pattern": "^\\d+$", "action": "warn"}]`)
+	require.NoError(t, err)
+	require.Equal(t, []QualityRule{
+		{Type: QualityRuleNullRate, Field: "email", MaxNullRate: 0.1, Action: QualityActionFail},
+		{Type: QualityRuleRegex, Field: "id", Pattern: `^\d+$`, Action: QualityActionWarn},
+	}, rules)
+	rules, err = parseQualityRules([]any{map[string]any{"type": "acceptedValues", "field": "status", "values": []any{"ok"}}})
+	require.NoError(t, err)
+	require.Equal(t, []any{"ok"}, rules[0].Values)
+
+	tests := []struct {
+		rules   string
+		wantErr string
+	}{
+		{`[{"type": "nullRate", "maxNullRate": 0.1}]`, "field is required"},
+		{`[{"type": "nullRate", "field": "a", "maxNullRate": 2}]`, "maxNullRate must be between 0 and 1"},
+		{`[{"type": "acceptedValues", "field": "a"}]`, "values are required"},
+		{`[{"type": "regex", "field": "a", "pattern": "("}]`, "invalid pattern"},
+		{`[{"type": "freshness", "field": "a"}]`, "maxAgeSec must be positive"},
+		{`[{"type": "unique", "field": "a"}]`, "unsupported quality rule type 'unique'"},
+		{`[{"type": "nullRate", "field": "a", "action": "drop"}]`, "unsupported action 'drop'"},
+		{`{"type": "nullRate"}`, "failed to parse qualityRules"},
+	}
+	for _, tt := range tests {
+		_, err := parseQualityRules(tt.rules)
+		require.ErrorContains(t, err, tt.wantErr, tt.rules)
+	}
+}
+
+func TestQualityChecker(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	rules, err := parseQualityRules(`[
+		{"type": "nullRate", "field": "email", "maxNullRate": 0.5},
+		{"type": "acceptedValues", "field": "status", "values": ["ok", "pending"], "action": "warn"},
+		{"type": "regex", "field": "id", "pattern": "^\\d+$"},
+		{"type": "freshness", "field": "ts", "maxAgeSec": 3600}
+	]`)
+	require.NoError(t, err)
+	qc := newQualityChecker(rules, &deleteRowsTestAdapter{})
+	qc.add(types.Object{"id": int64(1), "email": "a@b.c", "status": "ok", "ts": now.Add(-2 * time.Hour)})
+	qc.add(types.Object{"id": "x2", "status": "failed", "ts": now.Add(-30 * time.Minute).Format(time.RFC3339)})
+	qc.add(types.Object{"id": int64(3), "status": "unknown"})
+	qc.add(types.Object{"id": int64(4), "email": "d@b.c"})
+
+	results, err := qc.evaluate(now)
+	require.EqualError(t, err, "data quality check failed: regex(id): 1 of 4 rows violate rule. Examples: x2")
+	require.Equal(t, []bulker.QualityCheckResult{
+		{Rule: "nullRate", Field: "email", Action: "fail", Passed: true},
+		{Rule: "acceptedValues", Field: "status", Action: "warn", Message: "2 of 4 rows violate rule. Examples: failed, unknown"},
+		{Rule: "regex", Field: "id", Action: "fail", Message: "1 of 4 rows violate rule. Examples: x2"},
+		{Rule: "freshness", Field: "ts", Action: "fail", Passed: true},
+	}, results)
+
+	//stale and missing timestamps
+	results, err = qc.evaluate(now.Add(time.Hour))
+	require.Error(t, err)
+	require.Equal(t, "latest timestamp 2024-03-01T11:30:00Z is older than 1h0m0s", results[3].Message)
+	qc = newQualityChecker(rules[3:], &deleteRowsTestAdapter{})
+	qc.add(types.Object{"ts": "yesterday"})
+	results, err = qc.evaluate(now)
+	require.EqualError(t, err, "data quality check failed: freshness(ts): no valid timestamps in batch")
+	require.False(t, results[0].Passed)
+
+	//empty batch passes
+	results, err = newQualityChecker(rules, &deleteRowsTestAdapter{}).evaluate(now)
+	require.NoError(t, err)
+	require.Len(t, results, 4)
+}
@@ -14,6 +14,7 @@ import (
 
 func init() {
 	bulker.RegisterBulker(RedshiftBulkerTypeId, NewRedshift)
+	bulker.RegisterConfigType(RedshiftBulkerTypeId, RedshiftConfig{})
 }
 
 const (
@@ -21,11 +22,10 @@ const (
 
 	redshiftCopyTemplate = `copy %s (%s)
 					from 's3://%s/%s'
-    				ACCESS_KEY_ID '%s'
-    				SECRET_ACCESS_KEY '%s'
+    				%s
     				region '%s'
     				csv
-					gzip
+					%s
 					IGNOREHEADER 1
                     dateformat 'auto'
                     timeformat 'auto'`
@@ -60,13 +60,28 @@ var (
 type RedshiftConfig struct {
 	DataSourceConfig `mapstructure:",squash"`
 	S3OptionConfig   `mapstructure:",squash" yaml:"-,inline"`
+	// AuthenticationMethod password (default) or iam - temporary database credentials are requested with AWS credentials:
+	// access keys and roleArn of config or default AWS credentials chain (env variables, instance or task role)
+	AuthenticationMethod string `mapstructure:"authenticationMethod,omitempty" json:"authenticationMethod,omitempty" yaml:"authenticationMethod,omitempty"`
+	// ClusterIdentifier of provisioned cluster for iam authentication. Derived from host by default
+	ClusterIdentifier string `mapstructure:"clusterIdentifier,omitempty" json:"clusterIdentifier,omitempty" yaml:"clusterIdentifier,omitempty"`
+	// WorkgroupName of Redshift Serverless workgroup for iam authentication. Derived from host by default
+	WorkgroupName string `mapstructure:"workgroupName,omitempty" json:"workgroupName,omitempty" yaml:"workgroupName,omitempty"`
+	// AwsRegion region of cluster or workgroup. Derived from host by default
+	AwsRegion string `mapstructure:"awsRegion,omitempty" json:"awsRegion,omitempty" yaml:"awsRegion,omitempty"`
+	// IamRole ARN of IAM role associated with cluster or workgroup that COPY uses to read files from S3 instead of access keys.
+	// 'default' uses default IAM role of cluster or workgroup
+	IamRole string `mapstructure:"iamRole,omitempty" json:"iamRole,omitempty" yaml:"iamRole,omitempty"`
+	// Compression of batch files staged in S3: "gzip" (default), "zstd" or "none"
+	Compression types2.FileCompression `mapstructure:"compression,omitempty" json:"compression,omitempty" yaml:"compression,omitempty"`
 }
 
 // Redshift adapter for creating,patching (schema or table), inserting and copying data from s3 to redshift
 type Redshift struct {
 	//Aws Redshift uses Postgres fork under the hood
 	*Postgres
-	s3Config *S3OptionConfig
+	s3Config       *S3OptionConfig
+	redshiftConfig *RedshiftConfig
 }
 
 // NewRedshift returns configured Redshift adapter instance
@@ -78,19 +93,50 @@ func NewRedshift(bulkerConfig bulker.Config) (bulker.Bulker, error) {
 	if config.Port == 0 {
 		config.Port = 5439
 	}
+	compression, err := types2.ParseFileCompression(utils.Nvl(config.Compression, types2.FileCompressionGZIP))
+	if err != nil {
+		return nil, err
+	}
+	if compression == types2.FileCompressionLZ4 {
+		return nil, fmt.Errorf("Redshift doesn't support %s compression of batch files", compression)
+	}
+	pgConfig := PostgresConfig{DataSourceConfig: config.DataSourceConfig}
+	switch config.AuthenticationMethod {
+	case "", RedshiftAuthPassword:
+	case RedshiftAuthIAM:
+		clusterIdentifier, workgroupName, region := parseRedshiftHost(config.Host)
+		if config.ClusterIdentifier == "" && config.WorkgroupName == "" {
+			config.ClusterIdentifier, config.WorkgroupName = clusterIdentifier, workgroupName
+		}
+		config.AwsRegion = utils.NvlString(config.AwsRegion, region, config.Region)
+		iamCredentials, err := newRedshiftIamCredentials(config)
+		if err != nil {
+			return nil, err
+		}
+		pgConfig.credentialsProvider = iamCredentials.Get
+		if pgConfig.Username == "" {
+			// Serverless derives database user from IAM identity
+			if pgConfig.Username, _, err = iamCredentials.Get(context.Background()); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported authentication method: %s", config.AuthenticationMethod)
+	}
 
-	bulkerConfig.DestinationConfig = PostgresConfig{DataSourceConfig: config.DataSourceConfig}
+	bulkerConfig.DestinationConfig = pgConfig
 	postgres, err := NewPostgres(bulkerConfig)
 	if err != nil {
 		return nil, err
 	}
-	r := &Redshift{Postgres: postgres.(*Postgres), s3Config: &config.S3OptionConfig}
+	r := &Redshift{Postgres: postgres.(*Postgres), s3Config: &config.S3OptionConfig, redshiftConfig: config}
 	r.batchFileFormat = types2.FileFormatCSV
-	r.batchFileCompression = types2.FileCompressionGZIP
+	r.batchFileCompression = compression
 	r._columnDDLFunc = redshiftColumnDDL
 	r.initTypes(redshiftTypes)
 	r.tableHelper = NewTableHelper(127, '"')
 	r.temporaryTables = true
+	r.comments = pgCommentsDialect(true)
 	//// Redshift is case insensitive by default
 	//r._columnNameFunc = strings.ToLower
 	//r._tableNameFunc = func(config *DataSourceConfig, tableName string) string { return tableName }
@@ -114,6 +160,12 @@ func (p *Redshift) CreateStream(id, tableName string, mode bulker.BulkMode, stre
 		return newReplaceTableStream(id, p, tableName, streamOptions...)
 	case bulker.ReplacePartition:
 		return newReplacePartitionStream(id, p, tableName, streamOptions...)
+	case bulker.UpdateColumns:
+		return newUpdateColumnsStream(id, p, tableName, streamOptions...)
+	case bulker.SCD2:
+		return newSCD2Stream(id, p, tableName, streamOptions...)
+	case bulker.CDC:
+		return newCDCStream(id, p, tableName, streamOptions...)
 	}
 	return nil, fmt.Errorf("unsupported bulk mode: %s", mode)
 }
@@ -127,10 +179,37 @@ func (p *Redshift) validateOptions(streamOptions []bulker.StreamOption) error {
 }
 
 // Type returns Postgres type
+// MaintainTable runs VACUUM and ANALYZE (default) on table
+func (p *Redshift) MaintainTable(ctx context.Context, tableName string, config *MaintenanceConfig) error {
+	quotedTableName := p.quotedTableName(tableName)
+	var statements []string
+	for _, task := range config.tasksOrDefault(MaintenanceVacuum, MaintenanceAnalyze) {
+		switch task {
+		case MaintenanceAnalyze:
+			statements = append(statements, "ANALYZE "+quotedTableName)
+		case MaintenanceVacuum:
+			statements = append(statements, "VACUUM "+quotedTableName)
+		default:
+			return unsupportedMaintenanceTask(p.Type(), task)
+		}
+	}
+	return p.runMaintenance(ctx, quotedTableName, statements)
+}
+
 func (p *Redshift) Type() string {
 	return RedshiftBulkerTypeId
 }
 
+// SupportsVersionMerge Redshift merges by deleting matching rows before insert and can't keep rows with higher version
+func (p *Redshift) SupportsVersionMerge() bool {
+	return false
+}
+
+// SupportsSavepoints Redshift doesn't support SAVEPOINT statements
+func (p *Redshift) SupportsSavepoints() bool {
+	return false
+}
+
 // OpenTx opens underline sql transaction and return wrapped instance
 func (p *Redshift) OpenTx(ctx context.Context) (*TxSQLAdapter, error) {
 	return p.openTx(ctx, p)
@@ -155,7 +234,7 @@ func (p *Redshift) Insert(ctx context.Context, table *Table, merge bool, objects
 			return errorj.ExecuteInsertError.Wrap(err, "failed check primary key collision").
 				WithProperty(errorj.DBInfo, &types2.ErrorPayload{
 					Schema:      p.config.Schema,
-					Table:       p.quotedTableName(table.Name),
+					Table:       p.quotedTable(table),
 					PrimaryKeys: table.GetPKFields(),
 				})
 		}
@@ -170,7 +249,7 @@ func (p *Redshift) Insert(ctx context.Context, table *Table, merge bool, objects
 
 // LoadTable copy transfer data from s3 to redshift by passing COPY request to redshift
 func (p *Redshift) LoadTable(ctx context.Context, targetTable *Table, loadSource *LoadSource) (state *bulker.WarehouseState, err error) {
-	quotedTableName := p.quotedTableName(targetTable.Name)
+	quotedTableName := p.quotedTable(targetTable)
 	if loadSource.Type != AmazonS3 {
 		return state, fmt.Errorf("LoadTable: only Amazon S3 file is supported")
 	}
@@ -188,22 +267,54 @@ func (p *Redshift) LoadTable(ctx context.Context, targetTable *Table, loadSource
 	if s3Config.Folder != "" {
 		fileKey = s3Config.Folder + "/" + fileKey
 	}
-	statement := fmt.Sprintf(redshiftCopyTemplate, quotedTableName, strings.Join(columnNames, ","), s3Config.Bucket, fileKey, s3Config.AccessKeyID, s3Config.SecretKey, s3Config.Region)
+	credentials, maskedCredentials, err := p.copyCredentials(s3Config)
+	if err != nil {
+		return state, errorj.CopyError.Wrap(err, "failed to get credentials for copy from s3").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Schema: p.config.Schema,
+				Table:  quotedTableName,
+			})
+	}
+	compression := redshiftCopyCompression(p.batchFileCompression)
+	if loadSource.Manifest {
+		compression += " manifest"
+	}
+	statement := fmt.Sprintf(redshiftCopyTemplate, quotedTableName, strings.Join(columnNames, ","), s3Config.Bucket, fileKey, credentials, s3Config.Region, compression)
 	if _, err := p.txOrDb(ctx).ExecContext(ctx, statement); err != nil {
 		return state, errorj.CopyError.Wrap(err, "failed to copy data from s3").
 			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
 				Schema:    p.config.Schema,
 				Table:     quotedTableName,
-				Statement: fmt.Sprintf(redshiftCopyTemplate, quotedTableName, strings.Join(columnNames, ","), s3Config.Bucket, fileKey, credentialsMask, credentialsMask, s3Config.Region),
+				Statement: fmt.Sprintf(redshiftCopyTemplate, quotedTableName, strings.Join(columnNames, ","), s3Config.Bucket, fileKey, maskedCredentials, s3Config.Region, compression),
 			})
 	}
 
 	return state, nil
 }
 
+// SupportsManifestLoad COPY from S3 loads objects listed in manifest with MANIFEST parameter
+func (p *Redshift) SupportsManifestLoad(sourceType LoadSourceType) bool {
+	return sourceType == AmazonS3
+}
+
+// SupportsPrefixLoad COPY from S3 loads all objects which keys start with provided prefix
+func (p *Redshift) SupportsPrefixLoad(sourceType LoadSourceType) bool {
+	return sourceType == AmazonS3
+}
+
+// redshiftCopyCompression returns COPY parameter for compression of batch files
+func redshiftCopyCompression(compression types2.FileCompression) string {
+	switch compression {
+	case types2.FileCompressionGZIP, types2.FileCompressionZSTD:
+		return string(compression)
+	default:
+		return ""
+	}
+}
+
 func (p *Redshift) CopyTables(ctx context.Context, targetTable *Table, sourceTable *Table, mergeWindow int) (state *bulker.WarehouseState, err error) {
-	quotedTargetTableName := p.quotedTableName(targetTable.Name)
-	quotedSourceTableName := p.quotedTableName(sourceTable.Name)
+	quotedTargetTableName := p.quotedTable(targetTable)
+	quotedSourceTableName := p.quotedTable(sourceTable)
 
 	if mergeWindow > 0 && len(targetTable.PKFields) > 0 {
 		//delete duplicates from table
@@ -284,7 +395,7 @@ func (p *Redshift) GetTableSchema(ctx context.Context, tableName string) (*Table
 func (p *Redshift) getPrimaryKeys(ctx context.Context, tableName string) (string, utils.Set[string], error) {
 	tableName = p.TableName(tableName)
 	primaryKeys := utils.NewSet[string]()
-	pkFieldsRows, err := p.txOrDb(ctx).QueryContext(ctx, redshiftPrimaryKeyFieldsQuery, p.config.Schema, tableName)
+	pkFieldsRows, err := p.readTxOrDb(ctx).QueryContext(ctx, redshiftPrimaryKeyFieldsQuery, p.config.Schema, tableName)
 	if err != nil {
 		return "", nil, errorj.GetPrimaryKeysError.Wrap(err, "failed to get primary key").
 			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
@@ -330,12 +441,23 @@ func (p *Redshift) getPrimaryKeys(ctx context.Context, tableName string) (string
 	return primaryKeyName, primaryKeys, nil
 }
 
+// ValidatePartitioning Redshift tables are sorted by sort key. Partitioning isn't supported
+func (p *Redshift) ValidatePartitioning(partitionColumns, clusteringColumns int) error {
+	if partitionColumns > 0 {
+		return fmt.Errorf("%s doesn't support partitionKey option. Use clusteringKey", p.Type())
+	}
+	if clusteringColumns > 400 {
+		return fmt.Errorf("%s sort key may contain at most 400 columns", p.Type())
+	}
+	return nil
+}
+
 func (p *Redshift) CreateTable(ctx context.Context, schemaToCreate *Table) error {
 	err := p.SQLAdapterBase.CreateTable(ctx, schemaToCreate)
 	if err != nil {
 		return err
 	}
-	if !schemaToCreate.Temporary && schemaToCreate.TimestampColumn != "" {
+	if !schemaToCreate.Temporary && (schemaToCreate.TimestampColumn != "" || len(schemaToCreate.ClusteringColumns) > 0) {
 		err = p.createSortKey(ctx, schemaToCreate)
 		if err != nil {
 			p.DropTable(ctx, schemaToCreate.Name, true)
@@ -345,14 +467,19 @@ func (p *Redshift) CreateTable(ctx context.Context, schemaToCreate *Table) error
 	return nil
 }
 
+// createSortKey sets sort key of table to columns of ClusteringKeyOption or to timestamp column
 func (p *Redshift) createSortKey(ctx context.Context, table *Table) error {
-	if table.TimestampColumn == "" {
+	if table.TimestampColumn == "" && len(table.ClusteringColumns) == 0 {
 		return nil
 	}
-	quotedTableName := p.quotedTableName(table.Name)
+	quotedTableName := p.quotedTable(table)
 
+	sortKey := []string{table.TimestampColumn}
+	if len(table.ClusteringColumns) > 0 {
+		sortKey = table.ClusteringColumns
+	}
 	statement := fmt.Sprintf(redshiftAlterSortKeyTemplate,
-		quotedTableName, p.quotedColumnName(table.TimestampColumn))
+		quotedTableName, strings.Join(utils.ArrayMap(sortKey, p.quotedColumnName), ","))
 
 	if _, err := p.txOrDb(ctx).ExecContext(ctx, statement); err != nil {
 		return errorj.AlterTableError.Wrap(err, "failed to set sort key").
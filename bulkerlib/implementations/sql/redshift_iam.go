@@ -0,0 +1,135 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/redshift"
+	"github.com/aws/aws-sdk-go/service/redshiftserverless"
+	"github.com/jitsucom/bulker/bulkerlib/implementations"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	RedshiftAuthPassword = "password"
+	RedshiftAuthIAM      = "iam"
+
+	redshiftIamCredentialsDuration = time.Hour
+	// refresh temporary credentials a bit earlier than they expire
+	redshiftIamCredentialsRefreshGap = 5 * time.Minute
+)
+
+// redshiftIamCredentials requests temporary database credentials for provisioned cluster (GetClusterCredentials)
+// or Serverless workgroup (GetCredentials) using AWS credentials and caches them until expiration
+type redshiftIamCredentials struct {
+	sync.Mutex
+	config     *RedshiftConfig
+	awsSession *session.Session
+
+	username   string
+	password   string
+	expiration time.Time
+}
+
+func newRedshiftIamCredentials(config *RedshiftConfig) (*redshiftIamCredentials, error) {
+	if config.WorkgroupName == "" && config.ClusterIdentifier == "" {
+		return nil, fmt.Errorf("clusterIdentifier or workgroupName is required for iam authentication. Failed to derive it from host: %s", config.Host)
+	}
+	if config.AwsRegion == "" {
+		return nil, fmt.Errorf("awsRegion is required for iam authentication. Failed to derive it from host: %s", config.Host)
+	}
+	sess, err := implementations.NewAwsSession(config.AwsRegion, config.AccessKeyID, config.SecretKey, config.RoleARN, config.ExternalID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create aws session: %v", err)
+	}
+	return &redshiftIamCredentials{config: config, awsSession: sess}, nil
+}
+
+// Get returns cached temporary credentials or requests new ones if they are about to expire
+func (c *redshiftIamCredentials) Get(ctx context.Context) (username, password string, err error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.password != "" && time.Now().Add(redshiftIamCredentialsRefreshGap).Before(c.expiration) {
+		return c.username, c.password, nil
+	}
+	var dbUser, dbPassword *string
+	var expiration *time.Time
+	if c.config.WorkgroupName != "" {
+		res, err := redshiftserverless.New(c.awsSession).GetCredentialsWithContext(ctx, &redshiftserverless.GetCredentialsInput{
+			WorkgroupName:   aws.String(c.config.WorkgroupName),
+			DbName:          aws.String(c.config.Db),
+			DurationSeconds: aws.Int64(int64(redshiftIamCredentialsDuration.Seconds())),
+		})
+		if err != nil {
+			return "", "", fmt.Errorf("failed to get credentials for serverless workgroup %s: %v", c.config.WorkgroupName, err)
+		}
+		dbUser, dbPassword, expiration = res.DbUser, res.DbPassword, res.Expiration
+	} else {
+		res, err := redshift.New(c.awsSession).GetClusterCredentialsWithContext(ctx, &redshift.GetClusterCredentialsInput{
+			ClusterIdentifier: aws.String(c.config.ClusterIdentifier),
+			DbName:            aws.String(c.config.Db),
+			DbUser:            aws.String(c.config.Username),
+			DurationSeconds:   aws.Int64(int64(redshiftIamCredentialsDuration.Seconds())),
+		})
+		if err != nil {
+			return "", "", fmt.Errorf("failed to get credentials for cluster %s: %v", c.config.ClusterIdentifier, err)
+		}
+		dbUser, dbPassword, expiration = res.DbUser, res.DbPassword, res.Expiration
+	}
+	c.username, c.password = aws.StringValue(dbUser), aws.StringValue(dbPassword)
+	c.expiration = aws.TimeValue(expiration)
+	if c.expiration.IsZero() {
+		c.expiration = time.Now().Add(redshiftIamCredentialsDuration)
+	}
+	return c.username, c.password, nil
+}
+
+// parseRedshiftHost derives cluster identifier or serverless workgroup name and AWS region from default Redshift endpoints:
+// <cluster>.<id>.<region>.redshift.amazonaws.com and <workgroup>.<account>.<region>.redshift-serverless.amazonaws.com
+func parseRedshiftHost(host string) (clusterIdentifier, workgroupName, region string) {
+	parts := strings.Split(strings.ToLower(host), ".")
+	if len(parts) != 6 || parts[4] != "amazonaws" {
+		return "", "", ""
+	}
+	switch parts[3] {
+	case "redshift":
+		return parts[0], "", parts[2]
+	case "redshift-serverless":
+		return "", parts[0], parts[2]
+	}
+	return "", "", ""
+}
+
+// copyCredentials returns credentials clause of COPY command. IAM role associated with cluster or workgroup takes precedence.
+// Without static access keys, temporary credentials of AWS session are passed with session token
+func (p *Redshift) copyCredentials(s3Config *S3OptionConfig) (credentials, masked string, err error) {
+	if p.redshiftConfig.IamRole != "" {
+		if strings.ToLower(p.redshiftConfig.IamRole) == "default" {
+			return "IAM_ROLE default", "IAM_ROLE default", nil
+		}
+		credentials = fmt.Sprintf("IAM_ROLE '%s'", p.redshiftConfig.IamRole)
+		return credentials, credentials, nil
+	}
+	if s3Config.AccessKeyID != "" && s3Config.RoleARN == "" {
+		return fmt.Sprintf("ACCESS_KEY_ID '%s' SECRET_ACCESS_KEY '%s'", s3Config.AccessKeyID, s3Config.SecretKey),
+			fmt.Sprintf("ACCESS_KEY_ID '%s' SECRET_ACCESS_KEY '%s'", credentialsMask, credentialsMask), nil
+	}
+	sess, err := implementations.NewAwsSession(s3Config.Region, s3Config.AccessKeyID, s3Config.SecretKey, s3Config.RoleARN, s3Config.ExternalID)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create aws session: %v", err)
+	}
+	value, err := sess.Config.Credentials.Get()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get aws credentials: %v", err)
+	}
+	credentials = fmt.Sprintf("ACCESS_KEY_ID '%s' SECRET_ACCESS_KEY '%s'", value.AccessKeyID, value.SecretAccessKey)
+	masked = fmt.Sprintf("ACCESS_KEY_ID '%s' SECRET_ACCESS_KEY '%s'", credentialsMask, credentialsMask)
+	if value.SessionToken != "" {
+		credentials += fmt.Sprintf(" SESSION_TOKEN '%s'", value.SessionToken)
+		masked += fmt.Sprintf(" SESSION_TOKEN '%s'", credentialsMask)
+	}
+	return credentials, masked, nil
+}
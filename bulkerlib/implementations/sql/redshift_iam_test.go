@@ -0,0 +1,138 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseRedshiftHost(t *testing.T) {
+	tests := []struct {
+		host                                     string
+		clusterIdentifier, workgroupName, region string
+	}{
+		{"examplecluster.abc123xyz789.us-west-2.redshift.amazonaws.com", "examplecluster", "", "us-west-2"},
+		{"default-wg.123456789012.eu-central-1.redshift-serverless.amazonaws.com", "", "default-wg", "eu-central-1"},
+		{"Cluster.ABC.US-EAST-1.Redshift.AmazonAWS.com", "cluster", "", "us-east-1"},
+		{"redshift.example.com", "", "", ""},
+		{"vpce.abc.us-east-1.vpce.amazonaws.com", "", "", ""},
+	}
+	for _, tt := range tests {
+		clusterIdentifier, workgroupName, region := parseRedshiftHost(tt.host)
+		require.Equal(t, []string{tt.clusterIdentifier, tt.workgroupName, tt.region}, []string{clusterIdentifier, workgroupName, region}, tt.host)
+	}
+}
+
+// redshiftIamTestServer emulates GetClusterCredentials of Redshift API and GetCredentials of Redshift Serverless API
+type redshiftIamTestServer struct {
+	sync.Mutex
+	requests   []string
+	expiration time.Time
+}
+
+func (s *redshiftIamTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	body, _ := io.ReadAll(r.Body)
+	if target := r.Header.Get("X-Amz-Target"); target != "" {
+		//json protocol of Redshift Serverless
+		s.requests = append(s.requests, target+" "+string(body))
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		_, _ = fmt.Fprintf(w, `{"dbUser": "IAMR:bulker", "dbPassword": "serverless'pw", "expiration": %d}`, s.expiration.Unix())
+		return
+	}
+	//query protocol of Redshift
+	form, _ := url.ParseQuery(string(body))
+	s.requests = append(s.requests, form.Get("Action")+" "+form.Get("ClusterIdentifier")+" "+form.Get("DbUser")+" "+form.Get("DbName"))
+	w.Header().Set("Content-Type", "text/xml")
+	_, _ = fmt.Fprintf(w, `<GetClusterCredentialsResponse><GetClusterCredentialsResult><DbUser>IAM:bulker</DbUser><DbPassword>cluster_pw</DbPassword><Expiration>%s</Expiration></GetClusterCredentialsResult></GetClusterCredentialsResponse>`,
+		s.expiration.Format(time.RFC3339))
+}
+
+func newRedshiftIamTestCredentials(t *testing.T, server *redshiftIamTestServer, config *RedshiftConfig) *redshiftIamCredentials {
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+	sess, err := session.NewSession(aws.NewConfig().WithRegion("us-east-1").WithEndpoint(httpServer.URL).
+		WithCredentials(credentials.NewStaticCredentials("key", "secret", "")))
+	require.NoError(t, err)
+	return &redshiftIamCredentials{config: config, awsSession: sess}
+}
+
+func TestRedshiftIamCredentials(t *testing.T) {
+	reqr := require.New(t)
+	ctx := context.Background()
+	server := &redshiftIamTestServer{expiration: time.Now().Add(time.Hour).Truncate(time.Second)}
+	config := &RedshiftConfig{DataSourceConfig: DataSourceConfig{Db: "dev", Username: "bulker"}, ClusterIdentifier: "cluster1"}
+	creds := newRedshiftIamTestCredentials(t, server, config)
+	username, password, err := creds.Get(ctx)
+	reqr.NoError(err)
+	reqr.Equal("IAM:bulker", username)
+	reqr.Equal("cluster_pw", password)
+	//credentials are cached until they are about to expire
+	_, _, err = creds.Get(ctx)
+	reqr.NoError(err)
+	reqr.Equal([]string{"GetClusterCredentials cluster1 bulker dev"}, server.requests)
+	server.expiration = time.Now().Add(time.Minute)
+	creds.expiration = time.Now().Add(redshiftIamCredentialsRefreshGap - time.Second)
+	_, _, err = creds.Get(ctx)
+	reqr.NoError(err)
+	reqr.Len(server.requests, 2)
+
+	server = &redshiftIamTestServer{expiration: time.Now().Add(time.Hour)}
+	creds = newRedshiftIamTestCredentials(t, server, &RedshiftConfig{DataSourceConfig: DataSourceConfig{Db: "dev"}, WorkgroupName: "wg1"})
+	username, password, err = creds.Get(ctx)
+	reqr.NoError(err)
+	reqr.Equal("IAMR:bulker", username)
+	reqr.Equal("serverless'pw", password)
+	reqr.Len(server.requests, 1)
+	reqr.True(strings.HasPrefix(server.requests[0], "RedshiftServerless.GetCredentials "))
+	reqr.Contains(server.requests[0], `"workgroupName":"wg1"`)
+
+	_, err = newRedshiftIamCredentials(&RedshiftConfig{DataSourceConfig: DataSourceConfig{Host: "redshift.example.com"}, AwsRegion: "us-east-1"})
+	reqr.ErrorContains(err, "clusterIdentifier or workgroupName is required")
+	_, err = newRedshiftIamCredentials(&RedshiftConfig{DataSourceConfig: DataSourceConfig{Host: "redshift.example.com"}, WorkgroupName: "wg1"})
+	reqr.ErrorContains(err, "awsRegion is required")
+
+	reqr.Equal(`'serverless\'pw'`, postgresConnParam("serverless'pw"))
+	reqr.Equal(`'a\\b c'`, postgresConnParam(`a\b c`))
+}
+
+func TestRedshiftCopyCredentials(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "env_key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "env_secret")
+	t.Setenv("AWS_SESSION_TOKEN", "env_token")
+	tests := []struct {
+		name            string
+		iamRole         string
+		s3Config        S3OptionConfig
+		wantCredentials string
+		wantMasked      string
+	}{
+		{"default_role", "DEFAULT", S3OptionConfig{AccessKeyID: "key", SecretKey: "secret"}, "IAM_ROLE default", "IAM_ROLE default"},
+		{"role", "arn:aws:iam::123456789012:role/copy", S3OptionConfig{}, "IAM_ROLE 'arn:aws:iam::123456789012:role/copy'", "IAM_ROLE 'arn:aws:iam::123456789012:role/copy'"},
+		{"static_keys", "", S3OptionConfig{AccessKeyID: "key", SecretKey: "secret", Region: "us-east-1"},
+			"ACCESS_KEY_ID 'key' SECRET_ACCESS_KEY 'secret'", "ACCESS_KEY_ID '*****' SECRET_ACCESS_KEY '*****'"},
+		{"credentials_chain", "", S3OptionConfig{Region: "us-east-1"},
+			"ACCESS_KEY_ID 'env_key' SECRET_ACCESS_KEY 'env_secret' SESSION_TOKEN 'env_token'", "ACCESS_KEY_ID '*****' SECRET_ACCESS_KEY '*****' SESSION_TOKEN '*****'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Redshift{redshiftConfig: &RedshiftConfig{IamRole: tt.iamRole}}
+			credentials, masked, err := r.copyCredentials(&tt.s3Config)
+			require.NoError(t, err)
+			require.Equal(t, tt.wantCredentials, credentials)
+			require.Equal(t, tt.wantMasked, masked)
+		})
+	}
+}
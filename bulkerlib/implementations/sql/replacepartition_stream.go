@@ -32,11 +32,15 @@ func newReplacePartitionStream(id string, p SQLAdapter, tableName string, stream
 	}
 	ps.partitionId = partitionId
 	ps.existingTable, _ = ps.sqlAdapter.GetTableSchema(context.Background(), ps.tableName)
-	ps.tmpTableFunc = func(ctx context.Context, tableForObject *Table, object types.Object) (table *Table) {
+	ps.tmpTableFunc = func(ctx context.Context, tableForObject *Table, object types.Object) (table *Table, err error) {
 		dstTable := tableForObject
-		ps.adjustTableColumnTypes(dstTable, ps.existingTable, tableForObject, object)
+		if _, err = ps.adjustTableColumnTypes(dstTable, ps.existingTable, tableForObject, object); err != nil {
+			return nil, err
+		}
 		if ps.schemaFromOptions != nil {
-			ps.adjustTableColumnTypes(dstTable, ps.existingTable, ps.schemaFromOptions, object)
+			if _, err = ps.adjustTableColumnTypes(dstTable, ps.existingTable, ps.schemaFromOptions, object); err != nil {
+				return nil, err
+			}
 		}
 		tmpTableName := fmt.Sprintf("%s_tmp%s", utils.ShortenString(tableName, 47), time.Now().Format("060102150405"))
 		return &Table{
@@ -44,7 +48,7 @@ func newReplacePartitionStream(id string, p SQLAdapter, tableName string, stream
 			Columns:         dstTable.Columns,
 			Temporary:       true,
 			TimestampColumn: tableForObject.TimestampColumn,
-		}
+		}, nil
 	}
 	return &ps, nil
 }
@@ -55,15 +59,15 @@ func (ps *ReplacePartitionStream) Consume(ctx context.Context, object types.Obje
 	return ps.AbstractTransactionalSQLStream.Consume(ctx, objCopy)
 }
 
+func (ps *ReplacePartitionStream) ConsumeBatch(ctx context.Context, objects []types.Object) (state bulker.State, processedObjects []types.Object, err error) {
+	return bulker.ConsumeEach(ctx, ps, objects)
+}
+
 func (ps *ReplacePartitionStream) Complete(ctx context.Context) (state bulker.State, err error) {
 	if ps.state.Status != bulker.Active {
 		return ps.state, errors.New("stream is not active")
 	}
 	defer func() {
-		if err != nil {
-			ps.state.SuccessfulRows = 0
-			_ = ps.tx.Rollback()
-		}
 		state, err = ps.postComplete(ctx, err)
 	}()
 	//if no error happened during inserts. empty stream is valid - means no data for sync period
@@ -73,8 +77,15 @@ func (ps *ReplacePartitionStream) Complete(ctx context.Context) (state bulker.St
 		if err = ps.init(ctx); err != nil {
 			return
 		}
+		var duplicate bool
+		if duplicate, err = ps.skipDuplicate(ctx); duplicate || err != nil {
+			return ps.state, err
+		}
 		err = ps.clearPartition(ctx, ps.tx)
 		if err == nil && ps.state.SuccessfulRows > 0 {
+			if err = ps.checkQuality(); err != nil {
+				return ps.state, err
+			}
 			if ps.batchFile != nil {
 				ws, err := ps.flushBatchFile(ctx)
 				ps.state.AddWarehouseState(ws)
@@ -90,6 +101,9 @@ func (ps *ReplacePartitionStream) Complete(ctx context.Context) (state bulker.St
 			}
 			ps.dstTable = dstTable
 			ps.updateRepresentationTable(ps.dstTable)
+			if err = ps.runPreCommitHook(ctx); err != nil {
+				return ps.state, err
+			}
 			//copy data from tmp table to destination table
 			ws, err := ps.tx.CopyTables(ctx, ps.dstTable, ps.tmpTable, ps.mergeWindow)
 			ps.state.AddWarehouseState(ws)
@@ -118,6 +132,9 @@ func (ps *ReplacePartitionStream) clearPartition(ctx context.Context, tx *TxSQLA
 		if !ok {
 			return fmt.Errorf("couldn't start ReplacePartitionStream: destination table [%s] exist but it is not managed by ReplacePartitionStream: %s column is missing", ps.tableName, tx.ColumnName(PartitonIdKeyword))
 		}
+		if err = ps.snapshot(ctx, ByPartitionId(ps.partitionId)); err != nil {
+			return fmt.Errorf("couldn't start ReplacePartitionStream: failed to snapshot partition: %s error: %s", ps.partitionId, err)
+		}
 		//delete previous data by provided partition id
 		err = tx.Delete(ctx, ps.tableName, ByPartitionId(ps.partitionId))
 		if err != nil {
@@ -26,7 +26,7 @@ func newReplaceTableStream(id string, p SQLAdapter, tableName string, streamOpti
 	if err != nil {
 		return nil, err
 	}
-	ps.tmpTableFunc = func(ctx context.Context, tableForObject *Table, object types.Object) (table *Table) {
+	ps.tmpTableFunc = func(ctx context.Context, tableForObject *Table, object types.Object) (table *Table, err error) {
 		tmpTable := &Table{
 			Name:           fmt.Sprintf("%s_tmp%s", utils.ShortenString(ps.tableName, 47), time.Now().Format("060102150405")),
 			PrimaryKeyName: tableForObject.PrimaryKeyName,
@@ -36,9 +36,11 @@ func newReplaceTableStream(id string, p SQLAdapter, tableName string, streamOpti
 			TimestampColumn: tableForObject.TimestampColumn,
 		}
 		if ps.schemaFromOptions != nil {
-			ps.adjustTableColumnTypes(tmpTable, nil, ps.schemaFromOptions, object)
+			if _, err = ps.adjustTableColumnTypes(tmpTable, nil, ps.schemaFromOptions, object); err != nil {
+				return nil, err
+			}
 		}
-		return tmpTable
+		return tmpTable, nil
 	}
 	return &ps, nil
 }
@@ -51,8 +53,15 @@ func (ps *ReplaceTableStream) Complete(ctx context.Context) (state bulker.State,
 		state, err = ps.postComplete(ctx, err)
 	}()
 	if ps.state.LastError == nil {
+		var duplicate bool
+		if duplicate, err = ps.skipDuplicate(ctx); duplicate || err != nil {
+			return ps.state, err
+		}
 		//if at least one object was inserted
 		if ps.state.SuccessfulRows > 0 {
+			if err = ps.checkQuality(); err != nil {
+				return ps.state, err
+			}
 			if ps.batchFile != nil {
 				ws, err := ps.flushBatchFile(ctx)
 				ps.state.AddWarehouseState(ws)
@@ -60,6 +69,12 @@ func (ps *ReplaceTableStream) Complete(ctx context.Context) (state bulker.State,
 					return ps.state, err
 				}
 			}
+			if err = ps.runPreCommitHook(ctx); err != nil {
+				return ps.state, err
+			}
+			if err = ps.snapshot(ctx, nil); err != nil {
+				return ps.state, err
+			}
 			r, ok := ps.state.Representation.(RepresentationTable)
 			if ok {
 				r.Name = ps.tableName
@@ -86,6 +101,9 @@ func (ps *ReplaceTableStream) Complete(ctx context.Context) (state bulker.State,
 			var table *Table
 			table, err = ps.sqlAdapter.GetTableSchema(ctx, ps.tableName)
 			if table.Exists() {
+				if err = ps.snapshot(ctx, nil); err != nil {
+					return
+				}
 				err = ps.sqlAdapter.TruncateTable(ctx, ps.tableName)
 			}
 		}
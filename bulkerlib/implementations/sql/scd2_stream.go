@@ -0,0 +1,149 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/errorj"
+	"github.com/jitsucom/bulker/jitsubase/timestamp"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"time"
+)
+
+// Columns of table managed by SCD2 bulk mode
+const (
+	// SCD2ValidFromColumn time when version of row was loaded. Part of primary key of destination table
+	SCD2ValidFromColumn = "valid_from"
+	// SCD2ValidToColumn time when version of row was replaced with newer one. NULL for current version
+	SCD2ValidToColumn = "valid_to"
+	// SCD2IsCurrentColumn true for the latest version of row
+	SCD2IsCurrentColumn = "is_current"
+)
+
+// SCD2Stream loads consumed objects as new versions of rows (slowly changing dimension type 2).
+// Current versions of rows matched by primary key are closed: valid_to is set to valid_from of new version and is_current to false.
+// Destination table keeps all versions, so its primary key consists of primary key columns and valid_from
+type SCD2Stream struct {
+	*AbstractTransactionalSQLStream
+	// validFrom start of validity of all row versions of the batch
+	validFrom time.Time
+}
+
+func newSCD2Stream(id string, p SQLAdapter, tableName string, streamOptions ...bulker.StreamOption) (bulker.BulkerStream, error) {
+	if _, ok := p.(VersionsCloser); !ok {
+		return nil, fmt.Errorf("%s doesn't support %s mode", p.Type(), bulker.SCD2)
+	}
+	ps := SCD2Stream{validFrom: timestamp.Now().UTC()}
+	var err error
+	//only the latest object of the batch with the same primary key becomes a new version
+	streamOptions = append(streamOptions, bulker.WithDeduplicate())
+	ps.AbstractTransactionalSQLStream, err = newAbstractTransactionalStream(id, p, tableName, bulker.SCD2, streamOptions...)
+	if err != nil {
+		return nil, err
+	}
+	if len(ps.pkColumns) == 0 {
+		return nil, errors.New("WithPrimaryKey is required option for SCD2Stream")
+	}
+	ps.existingTable, _ = ps.sqlAdapter.GetTableSchema(context.Background(), ps.tableName)
+	ps.tmpTableFunc = func(ctx context.Context, tableForObject *Table, object types.Object) (table *Table, err error) {
+		dstTable := tableForObject
+		if _, err = ps.adjustTableColumnTypes(dstTable, ps.existingTable, tableForObject, object); err != nil {
+			return nil, err
+		}
+		if ps.schemaFromOptions != nil {
+			if _, err = ps.adjustTableColumnTypes(dstTable, ps.existingTable, ps.schemaFromOptions, object); err != nil {
+				return nil, err
+			}
+		}
+		//valid_to is always NULL in consumed objects so its type can't be inferred from values
+		timestampType, _ := ps.sqlAdapter.GetSQLType(types.TIMESTAMP)
+		utils.MapPutIfAbsent(dstTable.Columns, ps.sqlAdapter.ColumnName(SCD2ValidToColumn), types.SQLColumn{DataType: types.TIMESTAMP, Type: timestampType, New: true})
+		tmpTableName := fmt.Sprintf("%s_tmp%s", utils.ShortenString(tableName, 47), time.Now().Format("060102150405"))
+		return &Table{
+			Name:            tmpTableName,
+			Columns:         dstTable.Columns,
+			Temporary:       true,
+			TimestampColumn: tableForObject.TimestampColumn,
+		}, nil
+	}
+	return &ps, nil
+}
+
+func (ps *SCD2Stream) Consume(ctx context.Context, object types.Object) (state bulker.State, processedObjects types.Object, err error) {
+	objCopy := utils.MapCopy(object)
+	objCopy[SCD2ValidFromColumn] = ps.validFrom
+	objCopy[SCD2IsCurrentColumn] = true
+	delete(objCopy, SCD2ValidToColumn)
+	return ps.AbstractTransactionalSQLStream.Consume(ctx, objCopy)
+}
+
+func (ps *SCD2Stream) ConsumeBatch(ctx context.Context, objects []types.Object) (state bulker.State, processedObjects []types.Object, err error) {
+	return bulker.ConsumeEach(ctx, ps, objects)
+}
+
+func (ps *SCD2Stream) Complete(ctx context.Context) (state bulker.State, err error) {
+	if ps.state.Status != bulker.Active {
+		return ps.state, errors.New("stream is not active")
+	}
+	defer func() {
+		state, err = ps.postComplete(ctx, err)
+	}()
+	//if at least one object was inserted
+	if ps.state.SuccessfulRows > 0 {
+		var duplicate bool
+		if duplicate, err = ps.skipDuplicate(ctx); duplicate || err != nil {
+			return ps.state, err
+		}
+		if err = ps.checkQuality(); err != nil {
+			return ps.state, err
+		}
+		var existingTable *Table
+		existingTable, err = ps.tx.GetTableSchema(ctx, ps.tableName)
+		if err != nil {
+			return ps.state, errorj.Decorate(err, "failed to check existence of destination table")
+		}
+		if existingTable.Exists() {
+			if _, ok := existingTable.Columns[ps.tx.ColumnName(SCD2ValidFromColumn)]; !ok {
+				return ps.state, fmt.Errorf("destination table [%s] exist but it is not managed by %s mode: %s column is missing", ps.tableName, bulker.SCD2, ps.tx.ColumnName(SCD2ValidFromColumn))
+			}
+		}
+		if ps.batchFile != nil {
+			ws, err := ps.flushBatchFile(ctx)
+			ps.state.AddWarehouseState(ws)
+			if err != nil {
+				return ps.state, err
+			}
+		}
+		keyColumns := ps.dstTable.GetPKFields()
+		//destination table keeps all versions of rows
+		ps.dstTable.PKFields = utils.NewSet(keyColumns...)
+		ps.dstTable.PKFields.Put(ps.tx.ColumnName(SCD2ValidFromColumn))
+		var dstTable *Table
+		dstTable, err = ps.sqlAdapter.TableHelper().EnsureTableWithoutCaching(ctx, ps.tx, ps.id, ps.dstTable)
+		if err != nil {
+			ps.updateRepresentationTable(ps.dstTable)
+			return ps.state, errorj.Decorate(err, "failed to ensure destination table")
+		}
+		ps.dstTable = dstTable
+		ps.updateRepresentationTable(ps.dstTable)
+		//close current versions of rows that have new versions in tmp table
+		ws, err := ps.tx.CloseVersions(ctx, ps.dstTable, ps.tmpTable, keyColumns)
+		ps.state.AddWarehouseState(ws)
+		if err != nil {
+			return ps.state, err
+		}
+		//insert new versions
+		ws, err = ps.tx.CopyTables(ctx, ps.dstTable, ps.tmpTable, 0)
+		ps.state.AddWarehouseState(ws)
+		if err != nil {
+			return ps.state, err
+		}
+		return ps.state, nil
+	} else {
+		//if was any error - it will trigger transaction rollback in defer func
+		err = ps.state.LastError
+		return
+	}
+}
@@ -0,0 +1,80 @@
+package sql
+
+import (
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/jitsubase/timestamp"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	scd2FirstLoadTime  = timestamp.MustParseTime(time.RFC3339Nano, "2023-03-01T00:00:00.000Z")
+	scd2SecondLoadTime = timestamp.MustParseTime(time.RFC3339Nano, "2023-03-02T00:00:00.000Z")
+)
+
+// TestSCD2Stream loads the same table twice in SCD2 mode and checks that changed rows got new versions
+func TestSCD2Stream(t *testing.T) {
+	t.Parallel()
+	configIds := utils.ArrayIntersection(allBulkerConfigs, []string{BigqueryBulkerTypeId, RedshiftBulkerTypeId, SnowflakeBulkerTypeId, PostgresBulkerTypeId, MySQLBulkerTypeId})
+	tests := []bulkerTestConfig{
+		{
+			//delete any table leftovers from previous tests
+			name:      "dummy_test_table_cleanup",
+			tableName: "scd2_test",
+			modes:     []bulker.BulkMode{bulker.SCD2},
+			dataFile:  "test_data/empty.ndjson",
+			configIds: configIds,
+		},
+		{
+			name:                "first_load",
+			tableName:           "scd2_test",
+			modes:               []bulker.BulkMode{bulker.SCD2},
+			leaveResultingTable: true,
+			dataFile:            "test_data/partition1.ndjson",
+			expectedRowsCount:   5,
+			frozenTime:          scd2FirstLoadTime,
+			streamOptions:       []bulker.StreamOption{bulker.WithPrimaryKey("id")},
+			configIds:           configIds,
+		},
+		{
+			name:                "second_load",
+			tableName:           "scd2_test",
+			modes:               []bulker.BulkMode{bulker.SCD2},
+			leaveResultingTable: true,
+			dataFile:            "test_data/scd2.ndjson",
+			frozenTime:          scd2SecondLoadTime,
+			orderBy:             []string{"id", "valid_from"},
+			expectedRows: []map[string]any{
+				{"_timestamp": constantTime, "id": 1, "name": "test", "valid_from": scd2FirstLoadTime, "valid_to": nil, "is_current": true},
+				{"_timestamp": constantTime, "id": 2, "name": "test2", "valid_from": scd2FirstLoadTime, "valid_to": scd2SecondLoadTime, "is_current": false},
+				{"_timestamp": constantTime, "id": 2, "name": "test2B", "valid_from": scd2SecondLoadTime, "valid_to": nil, "is_current": true},
+				{"_timestamp": constantTime, "id": 3, "name": "test3", "valid_from": scd2FirstLoadTime, "valid_to": nil, "is_current": true},
+				{"_timestamp": constantTime, "id": 4, "name": "test4", "valid_from": scd2FirstLoadTime, "valid_to": scd2SecondLoadTime, "is_current": false},
+				{"_timestamp": constantTime, "id": 4, "name": "test4B", "valid_from": scd2SecondLoadTime, "valid_to": nil, "is_current": true},
+				{"_timestamp": constantTime, "id": 5, "name": "test5", "valid_from": scd2FirstLoadTime, "valid_to": nil, "is_current": true},
+				{"_timestamp": constantTime, "id": 6, "name": "test6", "valid_from": scd2SecondLoadTime, "valid_to": nil, "is_current": true},
+			},
+			streamOptions: []bulker.StreamOption{bulker.WithPrimaryKey("id")},
+			configIds:     configIds,
+		},
+		{
+			name:      "dummy_test_table_cleanup",
+			tableName: "scd2_test",
+			modes:     []bulker.BulkMode{bulker.SCD2},
+			dataFile:  "test_data/empty.ndjson",
+			configIds: configIds,
+		},
+	}
+	sequentialGroup := sync.WaitGroup{}
+	sequentialGroup.Add(1)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runTestConfig(t, tt, testStream)
+			sequentialGroup.Done()
+		})
+		sequentialGroup.Wait()
+		sequentialGroup.Add(1)
+	}
+}
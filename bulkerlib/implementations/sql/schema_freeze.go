@@ -0,0 +1,124 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	jsoniter "github.com/json-iterator/go"
+)
+
+const (
+	// SchemaFreezeDrop fields of events that are not columns of destination table are dropped
+	SchemaFreezeDrop = "drop"
+	// SchemaFreezeUnmapped fields of events that are not columns of destination table are put to '_unmapped_data' column.
+	// Destination table must have that column
+	SchemaFreezeUnmapped = "unmapped"
+)
+
+// SchemaFreezeOption - treats schema of existing destination table as fixed: bulker never creates or alters it.
+// Unknown fields of events are handled according to the option value: "drop" or "unmapped"
+var SchemaFreezeOption = bulker.ImplementationOption[string]{
+	Key: "schemaFreeze",
+	ParseFunc: func(serialized any) (string, error) {
+		policy, err := utils.ParseString(serialized)
+		if err != nil {
+			return "", err
+		}
+		if policy != "" && policy != SchemaFreezeDrop && policy != SchemaFreezeUnmapped {
+			return "", fmt.Errorf("failed to parse 'schemaFreeze' option: unknown value '%s'. Supported values: %s, %s", policy, SchemaFreezeDrop, SchemaFreezeUnmapped)
+		}
+		return policy, nil
+	},
+}
+
+// WithSchemaFreeze treats schema of existing destination table as fixed. See SchemaFreezeOption
+func WithSchemaFreeze(policy string) bulker.StreamOption {
+	return bulker.WithOption(&SchemaFreezeOption, policy)
+}
+
+// validateSchemaFreezeOption returns error if SchemaFreezeOption is set for mode that creates destination table
+// or together with options that add columns
+func validateSchemaFreezeOption(mode bulker.BulkMode, options *bulker.StreamOptions) error {
+	if mode != bulker.Batch && mode != bulker.Stream {
+		return fmt.Errorf("'%s' option is supported only in %s and %s modes", SchemaFreezeOption.Key, bulker.Batch, bulker.Stream)
+	}
+	if !bulker.SchemaOption.Get(options).IsEmpty() {
+		return fmt.Errorf("'%s' option can't be used together with '%s' option", SchemaFreezeOption.Key, bulker.SchemaOption.Key)
+	}
+	return nil
+}
+
+// loadFrozenTable loads schema of destination table. Destination table must exist
+func (ps *AbstractSQLStream) loadFrozenTable(ctx context.Context) error {
+	table, err := ps.sqlAdapter.GetTableSchema(ctx, ps.tableName)
+	if err != nil {
+		return err
+	}
+	if !table.Exists() {
+		return fmt.Errorf("'%s' option requires existing destination table: %s", SchemaFreezeOption.Key, ps.tableName)
+	}
+	if ps.schemaFreeze == SchemaFreezeUnmapped {
+		if _, ok := table.Columns[ps.sqlAdapter.ColumnName(unmappedDataColumn)]; !ok {
+			return fmt.Errorf("'%s' option with '%s' value requires '%s' column in destination table: %s", SchemaFreezeOption.Key, SchemaFreezeUnmapped, unmappedDataColumn, ps.tableName)
+		}
+	}
+	ps.frozenTable = table
+	return nil
+}
+
+// freezeSchema fits table of object to the schema of destination table: fields that are not columns of destination table
+// are dropped or put to '_unmapped_data' column, constraints of destination table are kept as is
+func (ps *AbstractSQLStream) freezeSchema(table *Table, object types.Object) {
+	unmappedObj := map[string]any{}
+	for name := range table.Columns {
+		if _, ok := ps.frozenTable.Columns[name]; ok {
+			continue
+		}
+		delete(table.Columns, name)
+		if v, ok := object[name]; ok {
+			unmappedObj[name] = v
+			delete(object, name)
+		}
+	}
+	table.PKFields = ps.frozenTable.PKFields.Clone()
+	table.PrimaryKeyName = ps.frozenTable.PrimaryKeyName
+	table.Indexes = nil
+	table.NotNullColumns = nil
+	table.PartitionColumns = nil
+	table.ClusteringColumns = nil
+	table.ColumnComments = nil
+	if len(unmappedObj) > 0 && ps.schemaFreeze == SchemaFreezeUnmapped {
+		ps.putUnmappedData(table.Columns, object, unmappedObj)
+	}
+}
+
+// putUnmappedData puts values that can't be stored in columns to '_unmapped_data' column.
+// With SchemaFreezeOption column is added only if destination table has it, otherwise values are dropped
+func (ps *AbstractSQLStream) putUnmappedData(columns Columns, object types.Object, unmappedObj map[string]any) bool {
+	columnName := ps.sqlAdapter.ColumnName(unmappedDataColumn)
+	var added bool
+	if ps.frozenTable != nil {
+		frozenColumn, ok := ps.frozenTable.Columns[columnName]
+		if !ok || ps.schemaFreeze != SchemaFreezeUnmapped {
+			return false
+		}
+		added = utils.MapPutIfAbsent(columns, columnName, frozenColumn)
+	} else {
+		jsonSQLType, _ := ps.sqlAdapter.GetSQLType(types.JSON)
+		added = utils.MapPutIfAbsent(columns, columnName, types.SQLColumn{DataType: types.JSON, Type: jsonSQLType})
+	}
+	if existing, ok := object[columnName].(map[string]any); ok {
+		//keep unmapped data that event already has
+		unmappedObj = utils.MapCopy(unmappedObj)
+		utils.MapPutAll(unmappedObj, existing)
+	}
+	if ps.sqlAdapter.StringifyObjects() {
+		b, _ := jsoniter.Marshal(unmappedObj)
+		object[columnName] = string(b)
+	} else {
+		object[columnName] = unmappedObj
+	}
+	return added
+}
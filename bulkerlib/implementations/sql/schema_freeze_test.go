@@ -0,0 +1,80 @@
+package sql
+
+import (
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"sync"
+	"testing"
+)
+
+// TestSchemaFreeze checks that unknown fields are dropped and destination table isn't altered when schema is frozen
+func TestSchemaFreeze(t *testing.T) {
+	t.Parallel()
+	tests := []bulkerTestConfig{
+		{
+			//delete any table leftovers from previous tests
+			name:      "dummy_test_table_cleanup",
+			tableName: "schema_freeze_test",
+			modes:     []bulker.BulkMode{bulker.Batch, bulker.Stream},
+			dataFile:  "test_data/empty.ndjson",
+			configIds: allBulkerConfigs,
+		},
+		{
+			name:           "table_missing",
+			tableName:      "schema_freeze_test",
+			modes:          []bulker.BulkMode{bulker.Batch, bulker.Stream},
+			dataFile:       "test_data/partition1.ndjson",
+			streamOptions:  []bulker.StreamOption{WithSchemaFreeze(SchemaFreezeDrop)},
+			expectedErrors: map[string]any{"consume_object_0": "requires existing destination table", "create_stream_bigquery_stream": BigQueryAutocommitUnsupported},
+			configIds:      allBulkerConfigs,
+		},
+		{
+			name:                "create_table",
+			tableName:           "schema_freeze_test",
+			modes:               []bulker.BulkMode{bulker.Batch},
+			leaveResultingTable: true,
+			dataFile:            "test_data/partition1.ndjson",
+			expectedRowsCount:   5,
+			configIds:           allBulkerConfigs,
+		},
+		{
+			name:      "drop_unknown_fields",
+			tableName: "schema_freeze_test",
+			modes:     []bulker.BulkMode{bulker.Batch},
+			dataFile:  "test_data/schema_freeze.ndjson",
+			expectedTable: ExpectedTable{
+				Columns: justColumns("_timestamp", "id", "name"),
+			},
+			expectedRowsCount: 6,
+			streamOptions:     []bulker.StreamOption{WithSchemaFreeze(SchemaFreezeDrop)},
+			configIds:         allBulkerConfigs,
+		},
+		{
+			name:           "unmapped_column_missing",
+			tableName:      "schema_freeze_test",
+			modes:          []bulker.BulkMode{bulker.Batch},
+			dataFile:       "test_data/schema_freeze.ndjson",
+			streamOptions:  []bulker.StreamOption{WithSchemaFreeze(SchemaFreezeUnmapped)},
+			expectedErrors: map[string]any{"consume_object_0": "requires '_unmapped_data' column"},
+			configIds:      allBulkerConfigs,
+		},
+		{
+			name:           "replace_table",
+			tableName:      "schema_freeze_test",
+			modes:          []bulker.BulkMode{bulker.ReplaceTable},
+			dataFile:       "test_data/schema_freeze.ndjson",
+			streamOptions:  []bulker.StreamOption{WithSchemaFreeze(SchemaFreezeDrop)},
+			expectedErrors: map[string]any{"create_stream": "supported only"},
+			configIds:      allBulkerConfigs,
+		},
+	}
+	sequentialGroup := sync.WaitGroup{}
+	sequentialGroup.Add(1)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runTestConfig(t, tt, testStream)
+			sequentialGroup.Done()
+		})
+		sequentialGroup.Wait()
+		sequentialGroup.Add(1)
+	}
+}
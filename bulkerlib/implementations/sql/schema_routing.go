@@ -0,0 +1,229 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/logging"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	jsoniter "github.com/json-iterator/go"
+	"sync"
+)
+
+// SchemaFieldOption - path to event field which value is used as destination schema (dataset for BigQuery),
+// e.g. "workspaceId" or "context.tenant". Path syntax is the same as in ComputedColumnsOption.
+// Events are routed to the table with the same name in per-value schemas. Schemas are created on demand.
+// Events without the field are stored to the schema of destination config. Supported by Postgres, Snowflake and BigQuery.
+// Batches are completed schema by schema: failure of one schema aborts the rest, but schemas completed before it stay loaded
+var SchemaFieldOption = bulker.ImplementationOption[string]{
+	Key:       "schemaField",
+	ParseFunc: utils.ParseString,
+}
+
+// WithSchemaField routes events to schemas derived from provided field. See SchemaFieldOption
+func WithSchemaField(field string) bulker.StreamOption {
+	return bulker.WithOption(&SchemaFieldOption, field)
+}
+
+// schemaRouter creates and caches instances of bulker that work with schemas derived from events. See SchemaFieldOption
+type schemaRouter struct {
+	sync.Mutex
+	// parent bulker working with schema of destination config
+	parent bulker.Bulker
+	config bulker.Config
+	// configKey key of destination config with schema name
+	configKey string
+	bulkers   map[string]bulker.Bulker
+}
+
+func newSchemaRouter(parent bulker.Bulker, config bulker.Config, configKey string) *schemaRouter {
+	return &schemaRouter{parent: parent, config: config, configKey: configKey, bulkers: map[string]bulker.Bulker{}}
+}
+
+// routedStream returns stream that routes events to schemas if SchemaFieldOption is set. nil otherwise
+func (sr *schemaRouter) routedStream(id, tableName string, mode bulker.BulkMode, streamOptions []bulker.StreamOption) (bulker.BulkerStream, error) {
+	if sr == nil {
+		return nil, nil
+	}
+	options := &bulker.StreamOptions{}
+	for _, option := range streamOptions {
+		options.Add(option)
+	}
+	field := SchemaFieldOption.Get(options)
+	if field == "" {
+		return nil, nil
+	}
+	path, err := parseFieldPath(field)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse '%s' option: %v", SchemaFieldOption.Key, err)
+	}
+	return &schemaRoutingStream{
+		id:        id,
+		tableName: tableName,
+		mode:      mode,
+		//routed streams must not route again
+		options: append(streamOptions[:len(streamOptions):len(streamOptions)], WithSchemaField("")),
+		router:  sr,
+		path:    path,
+		streams: map[string]bulker.BulkerStream{},
+	}, nil
+}
+
+// bulker returns instance of bulker working with provided schema. Empty schema - schema of destination config
+func (sr *schemaRouter) bulker(schema string) (bulker.Bulker, error) {
+	if schema == "" {
+		return sr.parent, nil
+	}
+	sr.Lock()
+	defer sr.Unlock()
+	if b, ok := sr.bulkers[schema]; ok {
+		return b, nil
+	}
+	destinationConfig := map[string]any{}
+	if m, ok := sr.config.DestinationConfig.(map[string]any); ok {
+		destinationConfig = utils.MapCopy(m)
+	} else {
+		b, err := jsoniter.Marshal(sr.config.DestinationConfig)
+		if err == nil {
+			err = jsoniter.Unmarshal(b, &destinationConfig)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to copy destination config: %v", err)
+		}
+	}
+	destinationConfig[sr.configKey] = schema
+	config := sr.config
+	config.Id = sr.config.Id + "_" + schema
+	config.DestinationConfig = destinationConfig
+	b, err := bulker.CreateBulker(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bulker for schema '%s': %v", schema, err)
+	}
+	sr.bulkers[schema] = b
+	return b, nil
+}
+
+// Close closes instances of bulker created for schemas
+func (sr *schemaRouter) Close() error {
+	if sr == nil {
+		return nil
+	}
+	sr.Lock()
+	defer sr.Unlock()
+	for schema, b := range sr.bulkers {
+		if err := b.Close(); err != nil {
+			logging.Errorf("[%s] failed to close bulker for schema '%s': %v", sr.config.Id, schema, err)
+		}
+	}
+	sr.bulkers = map[string]bulker.Bulker{}
+	return nil
+}
+
+// schemaRoutingStream routes events to streams of schemas derived from SchemaFieldOption field
+type schemaRoutingStream struct {
+	id        string
+	tableName string
+	mode      bulker.BulkMode
+	options   []bulker.StreamOption
+	router    *schemaRouter
+	path      []string
+	streams   map[string]bulker.BulkerStream
+	// schemas in order of the first event, so streams are completed in stable order
+	schemas []string
+}
+
+// schema returns schema of object. Value of the field is sanitized to be valid sql identifier
+func (s *schemaRoutingStream) schema(object types.Object) string {
+	value := valueByPath(object, s.path)
+	if value == nil {
+		return ""
+	}
+	return utils.SanitizeString(fmt.Sprint(value))
+}
+
+func (s *schemaRoutingStream) stream(schema string) (bulker.BulkerStream, error) {
+	if stream, ok := s.streams[schema]; ok {
+		return stream, nil
+	}
+	b, err := s.router.bulker(schema)
+	if err != nil {
+		return nil, err
+	}
+	id := s.id
+	if schema != "" {
+		id = s.id + "_" + schema
+	}
+	stream, err := b.CreateStream(id, s.tableName, s.mode, s.options...)
+	if err != nil {
+		return nil, err
+	}
+	s.streams[schema] = stream
+	s.schemas = append(s.schemas, schema)
+	return stream, nil
+}
+
+// Consume puts object to the stream of its schema and returns state of that stream
+func (s *schemaRoutingStream) Consume(ctx context.Context, object types.Object) (state bulker.State, processedObject types.Object, err error) {
+	stream, err := s.stream(s.schema(object))
+	if err != nil {
+		return bulker.State{}, nil, err
+	}
+	return stream.Consume(ctx, object)
+}
+
+func (s *schemaRoutingStream) ConsumeBatch(ctx context.Context, objects []types.Object) (state bulker.State, processedObjects []types.Object, err error) {
+	return bulker.ConsumeEach(ctx, s, objects)
+}
+
+// Complete completes streams of all schemas. On failure streams of remaining schemas are aborted
+func (s *schemaRoutingStream) Complete(ctx context.Context) (bulker.State, error) {
+	states := make(map[string]bulker.State, len(s.schemas))
+	for i, schema := range s.schemas {
+		state, err := s.streams[schema].Complete(ctx)
+		states[schema] = state
+		if err != nil {
+			for _, rest := range s.schemas[i+1:] {
+				states[rest], _ = s.streams[rest].Abort(ctx)
+			}
+			merged := mergeSchemaStates(states)
+			merged.Status = bulker.Failed
+			merged.SetError(err)
+			return merged, err
+		}
+	}
+	merged := mergeSchemaStates(states)
+	merged.Status = bulker.Completed
+	return merged, nil
+}
+
+// Abort aborts streams of all schemas
+func (s *schemaRoutingStream) Abort(ctx context.Context) (bulker.State, error) {
+	states := make(map[string]bulker.State, len(s.schemas))
+	var firstErr error
+	for _, schema := range s.schemas {
+		state, err := s.streams[schema].Abort(ctx)
+		states[schema] = state
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	merged := mergeSchemaStates(states)
+	merged.Status = bulker.Aborted
+	return merged, firstErr
+}
+
+// mergeSchemaStates sums counters of streams states. Representation is map of representations by schema
+func mergeSchemaStates(states map[string]bulker.State) bulker.State {
+	merged := bulker.State{}
+	representations := make(map[string]any, len(states))
+	for schema, state := range states {
+		representations[schema] = state.Representation
+		merged.ProcessedRows += state.ProcessedRows
+		merged.SuccessfulRows += state.SuccessfulRows
+		merged.RejectedRows += state.RejectedRows
+		merged.ProcessingTimeSec += state.ProcessingTimeSec
+	}
+	merged.Representation = representations
+	return merged
+}
@@ -0,0 +1,119 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+const schemaRoutingTestBulkerType = "schema_routing_test"
+
+// schemaRoutingTestBulker records objects consumed by its streams
+type schemaRoutingTestBulker struct {
+	schema    string
+	consumed  []types.Object
+	completed bool
+	aborted   bool
+	closed    bool
+	router    *schemaRouter
+}
+
+var schemaRoutingTestBulkers = map[string]*schemaRoutingTestBulker{}
+
+func init() {
+	bulker.RegisterBulker(schemaRoutingTestBulkerType, func(config bulker.Config) (bulker.Bulker, error) {
+		schema := config.DestinationConfig.(map[string]any)["defaultSchema"].(string)
+		b := &schemaRoutingTestBulker{schema: schema}
+		b.router = newSchemaRouter(b, config, "defaultSchema")
+		schemaRoutingTestBulkers[schema] = b
+		return b, nil
+	})
+}
+
+func (b *schemaRoutingTestBulker) CreateStream(id, tableName string, mode bulker.BulkMode, streamOptions ...bulker.StreamOption) (bulker.BulkerStream, error) {
+	if routed, err := b.router.routedStream(id, tableName, mode, streamOptions); routed != nil || err != nil {
+		return routed, err
+	}
+	return &schemaRoutingTestStream{b}, nil
+}
+
+func (b *schemaRoutingTestBulker) Close() error {
+	b.closed = true
+	return b.router.Close()
+}
+
+type schemaRoutingTestStream struct {
+	b *schemaRoutingTestBulker
+}
+
+func (s *schemaRoutingTestStream) Consume(ctx context.Context, object types.Object) (bulker.State, types.Object, error) {
+	s.b.consumed = append(s.b.consumed, object)
+	return bulker.State{ProcessedRows: len(s.b.consumed), SuccessfulRows: len(s.b.consumed)}, object, nil
+}
+
+func (s *schemaRoutingTestStream) ConsumeBatch(ctx context.Context, objects []types.Object) (state bulker.State, processedObjects []types.Object, err error) {
+	return bulker.ConsumeEach(ctx, s, objects)
+}
+
+func (s *schemaRoutingTestStream) Complete(ctx context.Context) (bulker.State, error) {
+	if s.b.schema == "broken" {
+		return bulker.State{}, fmt.Errorf("failed to complete")
+	}
+	s.b.completed = true
+	return bulker.State{ProcessedRows: len(s.b.consumed), SuccessfulRows: len(s.b.consumed)}, nil
+}
+
+func (s *schemaRoutingTestStream) Abort(ctx context.Context) (bulker.State, error) {
+	s.b.aborted = true
+	return bulker.State{ProcessedRows: len(s.b.consumed)}, nil
+}
+
+func TestSchemaRouting(t *testing.T) {
+	reqr := require.New(t)
+	ctx := context.Background()
+	blk, err := bulker.CreateBulker(bulker.Config{Id: "routing", BulkerType: schemaRoutingTestBulkerType, DestinationConfig: map[string]any{"defaultSchema": "public"}})
+	reqr.NoError(err)
+	stream, err := blk.CreateStream("routing", "events", bulker.Batch, WithSchemaField("context.tenant"))
+	reqr.NoError(err)
+
+	_, processedObjects, err := stream.ConsumeBatch(ctx, []types.Object{
+		{"id": 1, "context": map[string]any{"tenant": "acme"}},
+		{"id": 2, "context": map[string]any{"tenant": "globex-inc"}},
+		{"id": 3, "context": map[string]any{"tenant": "acme"}},
+		{"id": 4},
+	})
+	reqr.NoError(err)
+	reqr.Len(processedObjects, 4)
+	state, err := stream.Complete(ctx)
+	reqr.NoError(err)
+	reqr.Equal(bulker.Completed, state.Status)
+	reqr.Equal(4, state.SuccessfulRows)
+
+	reqr.Len(schemaRoutingTestBulkers["acme"].consumed, 2)
+	//value of the field is sanitized
+	reqr.Len(schemaRoutingTestBulkers["globex_inc"].consumed, 1)
+	//events without the field go to schema of destination config
+	reqr.Len(schemaRoutingTestBulkers["public"].consumed, 1)
+	reqr.True(schemaRoutingTestBulkers["public"].completed)
+
+	//failure of one schema aborts the rest
+	stream, err = blk.CreateStream("routing", "events", bulker.Batch, WithSchemaField("tenant"))
+	reqr.NoError(err)
+	for _, tenant := range []string{"broken", "initech"} {
+		_, _, err = stream.Consume(ctx, types.Object{"tenant": tenant})
+		reqr.NoError(err)
+	}
+	state, err = stream.Complete(ctx)
+	reqr.Error(err)
+	reqr.Equal(bulker.Failed, state.Status)
+	reqr.True(schemaRoutingTestBulkers["initech"].aborted)
+	reqr.False(schemaRoutingTestBulkers["initech"].completed)
+
+	//instances created for schemas are closed together with bulker
+	reqr.NoError(blk.Close())
+	reqr.True(schemaRoutingTestBulkers["acme"].closed)
+	reqr.True(schemaRoutingTestBulkers["initech"].closed)
+}
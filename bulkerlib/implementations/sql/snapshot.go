@@ -0,0 +1,194 @@
+package sql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/implementations"
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/errorj"
+	"github.com/jitsucom/bulker/jitsubase/logging"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"os"
+	"strings"
+	"time"
+)
+
+type SnapshotType string
+
+const (
+	// SnapshotS3 exports affected rows to S3 as gzipped NDJSON file
+	SnapshotS3 SnapshotType = "s3"
+	// SnapshotClone creates warehouse-side snapshot of the table. Supported only for whole table (ReplaceTable mode)
+	SnapshotClone SnapshotType = "clone"
+
+	snapshotTimeFormat = "20060102150405"
+)
+
+// SnapshotConfig snapshot of data made before destructive operations: replacing table or deleting partition
+type SnapshotConfig struct {
+	Type SnapshotType `json:"type"`
+	// RetentionDays snapshots older than this are deleted. Default: 7
+	RetentionDays int `json:"retentionDays,omitempty"`
+	// MinRows snapshot is made only if operation affects at least this number of rows. 0 - always
+	MinRows int `json:"minRows,omitempty"`
+	// S3 configuration for 's3' snapshot type. Snapshots are stored under <folder>/<table>/ path
+	S3OptionConfig
+}
+
+func (sc *SnapshotConfig) Validate() error {
+	if sc.RetentionDays == 0 {
+		sc.RetentionDays = 7
+	}
+	if sc.RetentionDays < 0 {
+		return fmt.Errorf("snapshot retentionDays must be positive")
+	}
+	switch sc.Type {
+	case SnapshotClone:
+	case SnapshotS3:
+		if sc.Bucket == "" || (sc.Region == "" && sc.Endpoint == "") || sc.AccessKeyID == "" || sc.SecretKey == "" {
+			return fmt.Errorf("snapshot of type 's3' requires bucket, region (or endpoint), accessKeyId and secretAccessKey")
+		}
+	default:
+		return fmt.Errorf("unsupported snapshot type '%s'. Supported: s3, clone", sc.Type)
+	}
+	return nil
+}
+
+// snapshot saves data of the stream table matching whenConditions before it is deleted or replaced.
+// whenConditions nil means whole table. Location of snapshot is put to the stream state
+func (ps *AbstractTransactionalSQLStream) snapshot(ctx context.Context, whenConditions *WhenConditions) error {
+	config := SnapshotOption.Get(&ps.options)
+	if config == nil {
+		return nil
+	}
+	table, err := ps.sqlAdapter.GetTableSchema(ctx, ps.tableName)
+	if err != nil {
+		return errorj.Decorate(err, "failed to check table existence before snapshot")
+	}
+	if !table.Exists() {
+		return nil
+	}
+	if config.MinRows > 0 {
+		count, err := ps.sqlAdapter.Count(ctx, ps.tableName, whenConditions)
+		if err != nil {
+			return errorj.Decorate(err, "failed to count rows for snapshot")
+		}
+		if count < config.MinRows {
+			return nil
+		}
+	}
+	now := time.Now().UTC()
+	switch config.Type {
+	case SnapshotClone:
+		cloner, ok := ps.sqlAdapter.(TableCloner)
+		if !ok {
+			return fmt.Errorf("snapshot of type 'clone' is not supported by %s", ps.sqlAdapter.Type())
+		}
+		if whenConditions != nil {
+			return fmt.Errorf("snapshot of type 'clone' is supported only for replacing whole table")
+		}
+		cloneName := fmt.Sprintf("%s_snapshot_%s", utils.ShortenString(ps.tableName, 40), now.Format(snapshotTimeFormat))
+		if err = cloner.CloneTable(ctx, ps.tableName, cloneName, now.AddDate(0, 0, config.RetentionDays)); err != nil {
+			return err
+		}
+		ps.state.Snapshot = cloneName
+	case SnapshotS3:
+		location, err := ps.exportSnapshot(ctx, config, whenConditions, now)
+		if err != nil {
+			return err
+		}
+		ps.state.Snapshot = location
+	}
+	logging.Infof("[%s] Snapshot of table %s saved to %s", ps.id, ps.tableName, ps.state.Snapshot)
+	return nil
+}
+
+// exportSnapshot uploads rows to S3 and deletes snapshots of the table older than retention period
+func (ps *AbstractTransactionalSQLStream) exportSnapshot(ctx context.Context, config *SnapshotConfig, whenConditions *WhenConditions, now time.Time) (string, error) {
+	exporter, ok := ps.sqlAdapter.(TableExporter)
+	if !ok {
+		return "", fmt.Errorf("snapshot of type 's3' is not supported by %s", ps.sqlAdapter.Type())
+	}
+	s3, err := implementations.NewS3(config.toS3Config(implementations.FileConfig{Folder: config.Folder, Format: types.FileFormatNDJSON, Compression: types.FileCompressionGZIP}))
+	if err != nil {
+		return "", fmt.Errorf("failed to setup s3 client for snapshot: %v", err)
+	}
+	defer s3.Close()
+	marshaller, _ := types.NewMarshaller(types.FileFormatNDJSON, types.FileCompressionGZIP)
+	file, err := os.CreateTemp("", "bulker_snapshot_*"+marshaller.FileExtension())
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+	}()
+	if err = marshaller.Init(file, nil); err != nil {
+		return "", err
+	}
+	err = exporter.ExportRows(ctx, ps.tableName, whenConditions, func(row map[string]any) error {
+		return marshaller.Marshal(row)
+	})
+	if err != nil {
+		return "", errorj.Decorate(err, "failed to export rows for snapshot")
+	}
+	if err = marshaller.Flush(); err != nil {
+		return "", err
+	}
+	if _, err = file.Seek(0, 0); err != nil {
+		return "", err
+	}
+	prefix := utils.SanitizeString(ps.tableName) + "/"
+	key := prefix + now.Format(snapshotTimeFormat) + marshaller.FileExtension()
+	if err = s3.Upload(key, file); err != nil {
+		return "", err
+	}
+	ps.deleteExpiredSnapshots(s3, prefix, now.AddDate(0, 0, -config.RetentionDays))
+	return fmt.Sprintf("s3://%s/%s", config.Bucket, s3.Path(key)), nil
+}
+
+// deleteExpiredSnapshots failures are only logged: expired snapshots will be deleted next time
+func (ps *AbstractTransactionalSQLStream) deleteExpiredSnapshots(s3 *implementations.S3, prefix string, expiration time.Time) {
+	objects, err := s3.ListObjects(prefix)
+	if err != nil {
+		logging.Errorf("[%s] Failed to list snapshots: %v", ps.id, err)
+		return
+	}
+	for key, modified := range objects {
+		if modified.Before(expiration) {
+			if err = s3.DeleteObject(key); err != nil {
+				logging.Errorf("[%s] Failed to delete expired snapshot %s: %v", ps.id, key, err)
+			}
+		}
+	}
+}
+
+// parseSnapshotConfig parses 'snapshot' option from map or json string
+func parseSnapshotConfig(serialized any) (*SnapshotConfig, error) {
+	var raw []byte
+	switch v := serialized.(type) {
+	case *SnapshotConfig:
+		return v, v.Validate()
+	case string:
+		raw = []byte(v)
+	default:
+		var err error
+		raw, err = json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value type of snapshot option: %T", v)
+		}
+	}
+	config := &SnapshotConfig{}
+	if err := json.Unmarshal(raw, config); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot config: %v", err)
+	}
+	config.Type = SnapshotType(strings.ToLower(string(config.Type)))
+	return config, config.Validate()
+}
+
+// WithSnapshot enables snapshot of data before replacing table or deleting partition
+func WithSnapshot(config *SnapshotConfig) bulker.StreamOption {
+	return bulker.WithOption(&SnapshotOption, config)
+}
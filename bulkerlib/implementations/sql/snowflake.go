@@ -15,6 +15,7 @@ import (
 	"path"
 	"regexp"
 	"strings"
+	"sync"
 	"text/template"
 	"time"
 
@@ -23,6 +24,7 @@ import (
 
 func init() {
 	bulker.RegisterBulker(SnowflakeBulkerTypeId, NewSnowflake)
+	bulker.RegisterConfigType(SnowflakeBulkerTypeId, SnowflakeConfig{})
 }
 
 const (
@@ -31,10 +33,16 @@ const (
 	sfTableExistenceQuery        = `SELECT count(*) from INFORMATION_SCHEMA.COLUMNS where TABLE_SCHEMA = ? and TABLE_NAME = ?`
 	sfDescTableQuery             = `desc table %s`
 	sfAlterClusteringKeyTemplate = `ALTER TABLE %s CLUSTER BY (DATE_TRUNC('MONTH', %s))`
+	sfClusterByTemplate          = `ALTER TABLE %s CLUSTER BY (%s)`
+	sfTableCommentTemplate       = `COMMENT ON TABLE %s IS %s`
+	sfColumnCommentTemplate      = `COMMENT ON COLUMN %s.%s IS %s`
+	sfSwapTableTemplate          = `ALTER TABLE %s SWAP WITH %s`
 
-	sfCopyStatement = `COPY INTO %s (%s) from @~/%s FILE_FORMAT=(TYPE= 'CSV', FIELD_OPTIONALLY_ENCLOSED_BY = '"' ESCAPE_UNENCLOSED_FIELD = NONE SKIP_HEADER = 1) `
+	sfCopyStatement      = `COPY INTO %s (%s) from %s/%s FILE_FORMAT=(TYPE= 'CSV', FIELD_OPTIONALLY_ENCLOSED_BY = '"' ESCAPE_UNENCLOSED_FIELD = NONE SKIP_HEADER = 1 COMPRESSION = %s) `
+	sfAzureCopyStatement = `COPY INTO %s (%s) from 'azure://%s.blob.core.windows.net/%s/%s' CREDENTIALS=(AZURE_SAS_TOKEN='%s') FILE_FORMAT=(TYPE= 'CSV', FIELD_OPTIONALLY_ENCLOSED_BY = '"' ESCAPE_UNENCLOSED_FIELD = NONE SKIP_HEADER = 1 COMPRESSION = %s) `
+	sfS3CopyStatement    = `COPY INTO %s (%s) from 's3://%s/%s' CREDENTIALS=(AWS_KEY_ID='%s' AWS_SECRET_KEY='%s') FILE_FORMAT=(TYPE= 'CSV', FIELD_OPTIONALLY_ENCLOSED_BY = '"' ESCAPE_UNENCLOSED_FIELD = NONE SKIP_HEADER = 1 COMPRESSION = %s) `
 
-	sfMergeStatement = `MERGE INTO {{.TableTo}} T USING (SELECT {{.Columns}} FROM {{.TableFrom}} ) S ON {{.JoinConditions}} WHEN MATCHED THEN UPDATE SET {{.UpdateSet}} WHEN NOT MATCHED THEN INSERT ({{.Columns}}) VALUES ({{.SourceColumns}})`
+	sfMergeStatement = `MERGE INTO {{.TableTo}} T USING (SELECT {{.Columns}} FROM {{.TableFrom}} ) S ON {{.JoinConditions}} WHEN MATCHED{{if .VersionColumn}} AND (T.{{.VersionColumn}} IS NULL OR T.{{.VersionColumn}} <= S.{{.VersionColumn}}){{end}} THEN UPDATE SET {{.UpdateSet}} WHEN NOT MATCHED THEN INSERT ({{.Columns}}) VALUES ({{.SourceColumns}})`
 
 	sfCreateSchemaIfNotExistsTemplate = `CREATE SCHEMA IF NOT EXISTS %s`
 
@@ -45,6 +53,7 @@ var (
 	sfReservedWords             = []string{"all", "alter", "and", "any", "as", "between", "by", "case", "cast", "check", "column", "connect", "constraint", "create", "cross", "current", "current_date", "current_time", "current_timestamp", "current_user", "delete", "distinct", "drop", "else", "exists", "false", "following", "for", "from", "full", "grant", "group", "having", "ilike", "in", "increment", "inner", "insert", "intersect", "into", "is", "join", "lateral", "left", "like", "localtime", "localtimestamp", "minus", "natural", "not", "null", "of", "on", "or", "order", "qualify", "regexp", "revoke", "right", "rlike", "row", "rows", "sample", "select", "set", "some", "start", "table", "tablesample", "then", "to", "trigger", "true", "try_cast", "union", "unique", "update", "using", "values", "when", "whenever", "where", "with"}
 	sfReservedWordsSet          = utils.NewSet(sfReservedWords...)
 	sfUnquotedIdentifierPattern = regexp.MustCompile(`^[a-z_][0-9a-z_]*$|^[A-Z_][0-9A-Z_]*$`)
+	sfStagePattern              = regexp.MustCompile(`^~$|^[A-Za-z0-9_$."]+$`)
 
 	sfMergeQueryTemplate, _ = template.New("snowflakeMergeQuery").Parse(sfMergeStatement)
 
@@ -61,14 +70,32 @@ var (
 
 // SnowflakeConfig dto for deserialized datasource config for Snowflake
 type SnowflakeConfig struct {
-	Account    string             `mapstructure:"account,omitempty" json:"account,omitempty" yaml:"account,omitempty"`
-	Port       int                `mapstructure:"port,omitempty" json:"port,omitempty" yaml:"port,omitempty"`
-	Db         string             `mapstructure:"database,omitempty" json:"database,omitempty" yaml:"database,omitempty"`
-	Schema     string             `mapstructure:"defaultSchema,omitempty" json:"defaultSchema,omitempty" yaml:"defaultSchema,omitempty"`
-	Username   string             `mapstructure:"username,omitempty" json:"username,omitempty" yaml:"username,omitempty"`
-	Password   string             `mapstructure:"password,omitempty" json:"password,omitempty" yaml:"password,omitempty"`
+	Account  string `mapstructure:"account,omitempty" json:"account,omitempty" yaml:"account,omitempty"`
+	Port     int    `mapstructure:"port,omitempty" json:"port,omitempty" yaml:"port,omitempty"`
+	Db       string `mapstructure:"database,omitempty" json:"database,omitempty" yaml:"database,omitempty"`
+	Schema   string `mapstructure:"defaultSchema,omitempty" json:"defaultSchema,omitempty" yaml:"defaultSchema,omitempty"`
+	Username string `mapstructure:"username,omitempty" json:"username,omitempty" yaml:"username,omitempty"`
+	Password string `mapstructure:"password,omitempty" json:"password,omitempty" yaml:"password,omitempty"`
+	// PrivateKey PEM encoded RSA private key (or path to it) for key pair authentication. Required for Snowpipe Streaming
+	PrivateKey string             `mapstructure:"privateKey,omitempty" json:"privateKey,omitempty" yaml:"privateKey,omitempty"`
 	Warehouse  string             `mapstructure:"warehouse,omitempty" json:"warehouse,omitempty" yaml:"warehouse,omitempty"`
 	Parameters map[string]*string `mapstructure:"parameters,omitempty" json:"parameters,omitempty" yaml:"parameters,omitempty"`
+	// AzureBlob Azure Blob Storage container used as external stage for batch files instead of user stage
+	AzureBlob *AzureBlobOptionConfig `mapstructure:"azureBlob,omitempty" json:"azureBlob,omitempty" yaml:"azureBlob,omitempty"`
+	// Compression of batch files: "none" (default, PUT compresses files with gzip), "gzip" or "zstd"
+	Compression types2.FileCompression `mapstructure:"compression,omitempty" json:"compression,omitempty" yaml:"compression,omitempty"`
+	// Stage internal stage where batch files are PUT before COPY when no external stage is configured:
+	// user stage "~" (default) or existing named stage, e.g. BULKER_STAGE or DB.SCHEMA.BULKER_STAGE
+	Stage string `mapstructure:"stage,omitempty" json:"stage,omitempty" yaml:"stage,omitempty"`
+}
+
+// stageRef returns reference to internal stage for PUT and COPY statements
+func (sc *SnowflakeConfig) stageRef() string {
+	stage := strings.TrimPrefix(sc.Stage, "@")
+	if stage == "" {
+		stage = "~"
+	}
+	return "@" + stage
 }
 
 func init() {
@@ -98,6 +125,12 @@ func (sc *SnowflakeConfig) Validate() error {
 	if sc.Parameters == nil {
 		sc.Parameters = map[string]*string{}
 	}
+	if sc.AzureBlob != nil && (sc.AzureBlob.AccountName == "" || sc.AzureBlob.Container == "" || sc.AzureBlob.SASToken == "") {
+		return errors.New("Snowflake azureBlob requires accountName, container and sasToken")
+	}
+	if sc.Stage != "" && !sfStagePattern.MatchString(strings.TrimPrefix(sc.Stage, "@")) {
+		return fmt.Errorf("Snowflake stage must be ~ or name of internal stage: %s", sc.Stage)
+	}
 
 	return nil
 }
@@ -105,6 +138,9 @@ func (sc *SnowflakeConfig) Validate() error {
 // Snowflake is adapter for creating,patching (schema or table), inserting data to snowflake
 type Snowflake struct {
 	*SQLAdapterBase[SnowflakeConfig]
+	streamingOnce   sync.Once
+	streamingClient *snowpipeStreamingClient
+	streamingErr    error
 }
 
 // NewSnowflake returns configured Snowflake adapter instance
@@ -117,6 +153,13 @@ func NewSnowflake(bulkerConfig bulker.Config) (bulker.Bulker, error) {
 	if config.Parameters == nil {
 		config.Parameters = map[string]*string{}
 	}
+	compression, err := types2.ParseFileCompression(config.Compression)
+	if err != nil {
+		return nil, err
+	}
+	if compression == types2.FileCompressionLZ4 {
+		return nil, fmt.Errorf("Snowflake doesn't support %s compression of batch files", compression)
+	}
 	minute := "60"
 	utils.MapPutIfAbsent(config.Parameters, "loginTimeout", &minute)
 	utils.MapPutIfAbsent(config.Parameters, "requestTimeout", &minute)
@@ -133,6 +176,14 @@ func NewSnowflake(bulkerConfig bulker.Config) (bulker.Bulker, error) {
 			Warehouse: config.Warehouse,
 			Params:    config.Parameters,
 		}
+		if config.PrivateKey != "" {
+			privateKey, err := parseSnowflakePrivateKey(config.PrivateKey)
+			if err != nil {
+				return nil, err
+			}
+			cfg.Authenticator = sf.AuthTypeJwt
+			cfg.PrivateKey = privateKey
+		}
 
 		connectionString, err := sf.DSN(cfg)
 		if err != nil {
@@ -163,8 +214,19 @@ func NewSnowflake(bulkerConfig bulker.Config) (bulker.Bulker, error) {
 		queryLogger = logging.NewQueryLogger(bulkerConfig.Id, os.Stderr, os.Stderr)
 	}
 	sqlAdapter, err := newSQLAdapterBase(bulkerConfig.Id, SnowflakeBulkerTypeId, config, dbConnectFunction, snowflakeTypes, queryLogger, typecastFunc, QuestionMarkParameterPlaceholder, sfColumnDDL, unmappedValue, checkErr)
-	s := &Snowflake{sqlAdapter}
+	s := &Snowflake{SQLAdapterBase: sqlAdapter}
 	s.batchFileFormat = types2.FileFormatCSV
+	s.batchFileCompression = compression
+	s.statementTimeout = time.Duration(bulkerConfig.StatementTimeoutSec) * time.Second
+	s.setConnMaxLifetime(time.Duration(bulkerConfig.ConnMaxLifetimeSec) * time.Second)
+	s.comments = &commentsDialect{
+		tableCommentStatement: func(quotedTableName, comment string) string {
+			return fmt.Sprintf(sfTableCommentTemplate, quotedTableName, quotedComment(comment, true))
+		},
+		columnCommentStatement: func(quotedTableName, quotedColumnName, comment string) string {
+			return fmt.Sprintf(sfColumnCommentTemplate, quotedTableName, quotedColumnName, quotedComment(comment, true))
+		},
+	}
 	s.valueMappingFunction = func(value any, valuePresent bool, column types2.SQLColumn) any {
 		if !valuePresent {
 			return nil
@@ -179,16 +241,31 @@ func NewSnowflake(bulkerConfig bulker.Config) (bulker.Bulker, error) {
 	s.tableHelper = NewTableHelper(255, '"')
 	s.tableHelper.tableNameFunc = sfIdentifierFunction
 	s.tableHelper.columnNameFunc = sfIdentifierFunction
+	s.schemaRouter = newSchemaRouter(s, bulkerConfig, "defaultSchema")
 	return s, err
 }
 func (s *Snowflake) CreateStream(id, tableName string, mode bulker.BulkMode, streamOptions ...bulker.StreamOption) (bulker.BulkerStream, error) {
+	if routed, err := s.schemaRouter.routedStream(id, tableName, mode, streamOptions); routed != nil || err != nil {
+		return routed, err
+	}
 	streamOptions = append(streamOptions, withLocalBatchFile(fmt.Sprintf("bulker_%s", utils.SanitizeString(id))))
+	if s.config.AzureBlob != nil {
+		streamOptions = append(streamOptions, withAzureBlobBatchFile(s.config.AzureBlob))
+	}
 
-	if err := s.validateOptions(streamOptions); err != nil {
+	options, err := s.validateOptions(mode, streamOptions)
+	if err != nil {
 		return nil, err
 	}
 	switch mode {
 	case bulker.Stream:
+		if SnowpipeStreamingOption.Get(options) {
+			streaming, err := newSnowpipeStreaming(s, id)
+			if err != nil {
+				return nil, err
+			}
+			return newStreamingFallbackStream(id, streaming, s, tableName, streamOptions...)
+		}
 		return newAutoCommitStream(id, s, tableName, streamOptions...)
 	case bulker.Batch:
 		return newTransactionalStream(id, s, tableName, streamOptions...)
@@ -196,16 +273,38 @@ func (s *Snowflake) CreateStream(id, tableName string, mode bulker.BulkMode, str
 		return newReplaceTableStream(id, s, tableName, streamOptions...)
 	case bulker.ReplacePartition:
 		return newReplacePartitionStream(id, s, tableName, streamOptions...)
+	case bulker.UpdateColumns:
+		return newUpdateColumnsStream(id, s, tableName, streamOptions...)
+	case bulker.SCD2:
+		return newSCD2Stream(id, s, tableName, streamOptions...)
+	case bulker.CDC:
+		return newCDCStream(id, s, tableName, streamOptions...)
 	}
 	return nil, fmt.Errorf("unsupported bulk mode: %s", mode)
 }
 
-func (s *Snowflake) validateOptions(streamOptions []bulker.StreamOption) error {
+func (s *Snowflake) validateOptions(mode bulker.BulkMode, streamOptions []bulker.StreamOption) (*bulker.StreamOptions, error) {
 	options := &bulker.StreamOptions{}
 	for _, option := range streamOptions {
 		options.Add(option)
 	}
-	return nil
+	if SnowpipeStreamingOption.Get(options) {
+		if mode != bulker.Stream {
+			return nil, fmt.Errorf("option %s is supported only in %s mode", SnowpipeStreamingOption.Key, bulker.Stream)
+		}
+		if bulker.DeduplicateOption.Get(options) && len(bulker.PrimaryKeyOption.Get(options)) > 0 {
+			return nil, fmt.Errorf("option %s doesn't support deduplication", SnowpipeStreamingOption.Key)
+		}
+	}
+	return options, nil
+}
+
+// snowpipeStreamingClient returns Snowpipe Streaming client shared by all streams of destination
+func (s *Snowflake) snowpipeStreamingClient() (*snowpipeStreamingClient, error) {
+	s.streamingOnce.Do(func() {
+		s.streamingClient, s.streamingErr = newSnowpipeStreamingClient(s.config)
+	})
+	return s.streamingClient, s.streamingErr
 }
 
 // OpenTx opens underline sql transaction and return wrapped instance
@@ -348,17 +447,67 @@ func (s *Snowflake) getPrimaryKey(ctx context.Context, tableName string) (string
 	return primaryKeyName, primaryKeys, nil
 }
 
-// LoadTable transfer data from local file to Snowflake by passing COPY request to Snowflake
+// SupportsVersionMerge MERGE statement updates only rows with lower version
+func (s *Snowflake) SupportsVersionMerge() bool {
+	return true
+}
+
+// SupportsPrefixLoad COPY from external location loads all files under provided path
+func (s *Snowflake) SupportsPrefixLoad(sourceType LoadSourceType) bool {
+	return sourceType == AmazonS3 || sourceType == AzureBlob
+}
+
+// LoadTable transfer data from local file, S3 bucket or Azure Blob container to Snowflake by passing COPY request to Snowflake
 func (s *Snowflake) LoadTable(ctx context.Context, targetTable *Table, loadSource *LoadSource) (state *bulker.WarehouseState, err error) {
-	quotedTableName := s.quotedTableName(targetTable.Name)
+	quotedTableName := s.quotedTable(targetTable)
 
-	if loadSource.Type != LocalFile {
-		return state, fmt.Errorf("LoadTable: only local file is supported")
-	}
 	if loadSource.Format != s.batchFileFormat {
 		return state, fmt.Errorf("LoadTable: only %s format is supported", s.batchFileFormat)
 	}
-	putStatement := fmt.Sprintf("PUT file://%s @~", loadSource.Path)
+	columns := targetTable.SortedColumnNames()
+	columnNames := make([]string, len(columns))
+	for i, name := range columns {
+		columnNames[i] = s.quotedColumnName(name)
+	}
+	switch loadSource.Type {
+	case LocalFile:
+	case AzureBlob:
+		azureConfig := loadSource.AzureBlobConfig
+		sasToken := strings.TrimPrefix(azureConfig.SASToken, "?")
+		statement := fmt.Sprintf(sfAzureCopyStatement, quotedTableName, strings.Join(columnNames, ","), azureConfig.AccountName, azureConfig.Container, loadSource.Path, sasToken, sfCopyCompression(s.batchFileCompression))
+		if _, err := s.txOrDb(ctx).ExecContext(ctx, statement); err != nil {
+			return state, errorj.CopyError.Wrap(err, "failed to copy data from azure blob stage").
+				WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+					Schema:    s.config.Schema,
+					Table:     quotedTableName,
+					Statement: fmt.Sprintf(sfAzureCopyStatement, quotedTableName, strings.Join(columnNames, ","), azureConfig.AccountName, azureConfig.Container, loadSource.Path, credentialsMask, sfCopyCompression(s.batchFileCompression)),
+				})
+		}
+		return state, nil
+	case AmazonS3:
+		s3Config := loadSource.S3Config
+		if s3Config.AccessKeyID == "" {
+			return state, fmt.Errorf("LoadTable: accessKeyId and secretKey of s3 are required to load from s3")
+		}
+		statement := fmt.Sprintf(sfS3CopyStatement, quotedTableName, strings.Join(columnNames, ","), s3Config.Bucket, loadSource.Path, s3Config.AccessKeyID, s3Config.SecretKey, sfCopyCompression(s.batchFileCompression))
+		if _, err := s.txOrDb(ctx).ExecContext(ctx, statement); err != nil {
+			return state, errorj.CopyError.Wrap(err, "failed to copy data from s3").
+				WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+					Schema:    s.config.Schema,
+					Table:     quotedTableName,
+					Statement: fmt.Sprintf(sfS3CopyStatement, quotedTableName, strings.Join(columnNames, ","), s3Config.Bucket, loadSource.Path, credentialsMask, credentialsMask, sfCopyCompression(s.batchFileCompression)),
+				})
+		}
+		return state, nil
+	default:
+		return state, fmt.Errorf("LoadTable: unsupported load source type: %s", loadSource.Type)
+	}
+	stage := s.config.stageRef()
+	putStatement := fmt.Sprintf("PUT file://%s %s", loadSource.Path, stage)
+	if s.batchFileCompression != types2.FileCompressionNONE {
+		// file is already compressed by marshaller
+		putStatement += fmt.Sprintf(" SOURCE_COMPRESSION = %s AUTO_COMPRESS = FALSE", sfCopyCompression(s.batchFileCompression))
+	}
 	if _, err = s.txOrDb(ctx).ExecContext(ctx, putStatement); err != nil {
 		return state, errorj.LoadError.Wrap(err, "failed to put file to stage").
 			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
@@ -368,24 +517,19 @@ func (s *Snowflake) LoadTable(ctx context.Context, targetTable *Table, loadSourc
 			})
 	}
 	defer func() {
-		removeStatement := fmt.Sprintf("REMOVE @~/%s", path.Base(loadSource.Path))
+		removeStatement := fmt.Sprintf("REMOVE %s/%s", stage, path.Base(loadSource.Path))
 		if _, err2 := s.txOrDb(ctx).ExecContext(ctx, removeStatement); err2 != nil {
-			err2 = errorj.LoadError.Wrap(err, "failed to remove file from stage").
+			err2 = errorj.LoadError.Wrap(err2, "failed to remove file from stage").
 				WithProperty(errorj.DBInfo, &types2.ErrorPayload{
 					Schema:    s.config.Schema,
 					Table:     quotedTableName,
-					Statement: putStatement,
+					Statement: removeStatement,
 				})
 			err = multierror.Append(err, err2)
 		}
 	}()
-	columns := targetTable.SortedColumnNames()
-	columnNames := make([]string, len(columns))
-	for i, name := range columns {
-		columnNames[i] = s.quotedColumnName(name)
-	}
 
-	statement := fmt.Sprintf(sfCopyStatement, quotedTableName, strings.Join(columnNames, ","), path.Base(loadSource.Path))
+	statement := fmt.Sprintf(sfCopyStatement, quotedTableName, strings.Join(columnNames, ","), stage, path.Base(loadSource.Path), sfCopyCompression(s.batchFileCompression))
 
 	if _, err := s.txOrDb(ctx).ExecContext(ctx, statement); err != nil {
 		return state, errorj.CopyError.Wrap(err, "failed to copy data from stage").
@@ -399,6 +543,17 @@ func (s *Snowflake) LoadTable(ctx context.Context, targetTable *Table, loadSourc
 	return state, nil
 }
 
+// sfCopyCompression returns value of COMPRESSION file format option for compression of batch files.
+// Uncompressed files are compressed with gzip by PUT so compression is detected automatically
+func sfCopyCompression(compression types2.FileCompression) string {
+	switch compression {
+	case types2.FileCompressionGZIP, types2.FileCompressionZSTD:
+		return strings.ToUpper(string(compression))
+	default:
+		return "AUTO"
+	}
+}
+
 // Insert inserts data with InsertContext as a single object or a batch into Snowflake
 func (s *Snowflake) Insert(ctx context.Context, table *Table, merge bool, objects ...types2.Object) error {
 	if !merge || len(table.GetPKFields()) == 0 {
@@ -424,6 +579,9 @@ func (s *Snowflake) Insert(ctx context.Context, table *Table, merge bool, object
 				})
 		}
 		if len(res) > 0 {
+			if supersededVersion(table, object, res[0]) {
+				return nil
+			}
 			return s.Update(ctx, table, object, pkMatchConditions)
 		} else {
 			return s.insert(ctx, table, []types2.Object{object})
@@ -432,6 +590,21 @@ func (s *Snowflake) Insert(ctx context.Context, table *Table, merge bool, object
 	return nil
 }
 
+// UpdateColumns updates columns of target table rows matching source table rows by primary key
+func (s *Snowflake) UpdateColumns(ctx context.Context, targetTable *Table, sourceTable *Table) (*bulker.WarehouseState, error) {
+	return nil, s.updateColumnsFrom(ctx, targetTable, sourceTable, updateFromQueryTemplate, false)
+}
+
+// CloseVersions closes current versions of target table rows matching source table rows by key columns
+func (s *Snowflake) CloseVersions(ctx context.Context, targetTable *Table, sourceTable *Table, keyColumns []string) (*bulker.WarehouseState, error) {
+	return nil, s.closeVersionsFrom(ctx, targetTable, sourceTable, keyColumns, updateFromQueryTemplate, false)
+}
+
+// DeleteByKeys deletes rows of target table matching source table rows by key columns
+func (s *Snowflake) DeleteByKeys(ctx context.Context, targetTable *Table, sourceTable *Table, keyColumns []string) (*bulker.WarehouseState, error) {
+	return nil, s.deleteByKeysFrom(ctx, targetTable, sourceTable, keyColumns)
+}
+
 func (s *Snowflake) CopyTables(ctx context.Context, targetTable *Table, sourceTable *Table, mergeWindow int) (*bulker.WarehouseState, error) {
 	if mergeWindow <= 0 {
 		return nil, s.copy(ctx, targetTable, sourceTable)
@@ -440,12 +613,32 @@ func (s *Snowflake) CopyTables(ctx context.Context, targetTable *Table, sourceTa
 	}
 }
 
+// ReplaceTable atomically swaps target table with replacement table, so target table is never missing or partially loaded.
+// After swap replacement table contains old data. Falls back to rename when target table doesn't exist yet
 func (s *Snowflake) ReplaceTable(ctx context.Context, targetTableName string, replacementTable *Table, dropOldTable bool) error {
-	tmpTable := "deprecated_" + targetTableName + time.Now().Format("_20060102_150405")
-	err1 := s.renameTable(ctx, true, targetTableName, tmpTable)
-	err := s.renameTable(ctx, false, replacementTable.Name, targetTableName)
-	if dropOldTable && err1 == nil && err == nil {
-		return s.DropTable(ctx, tmpTable, true)
+	targetTable, err := s.GetTableSchema(ctx, targetTableName)
+	if err != nil {
+		return err
+	}
+	if !targetTable.Exists() {
+		return s.renameTable(ctx, false, replacementTable.Name, targetTableName)
+	}
+	quotedTargetTableName := s.quotedTableName(targetTableName)
+	statement := fmt.Sprintf(sfSwapTableTemplate, quotedTargetTableName, s.quotedTable(replacementTable))
+	if _, err = s.txOrDb(ctx).ExecContext(ctx, statement); err != nil {
+		return errorj.RenameError.Wrap(err, "failed to swap tables").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Schema:    s.config.Schema,
+				Table:     quotedTargetTableName,
+				Statement: statement,
+			})
+	}
+	if !dropOldTable {
+		return s.renameTable(ctx, false, replacementTable.Name, "deprecated_"+targetTableName+time.Now().Format("_20060102_150405"))
+	}
+	// data is already replaced. Leftover table with old data must not fail the stream
+	if err = s.DropTable(ctx, replacementTable.Name, true); err != nil {
+		s.Errorf("Failed to drop old data table %s after swap: %v", replacementTable.Name, err)
 	}
 	return nil
 }
@@ -472,12 +665,25 @@ func sfIdentifierFunction(value string, alphanumeric bool) (adapted string, need
 	}
 }
 
+// SupportsStagingSchema tmp tables may be created in other schema or database (DB.SCHEMA)
+func (s *Snowflake) SupportsStagingSchema() bool {
+	return true
+}
+
+// ValidatePartitioning Snowflake tables are clustered with clustering key. Partitioning is managed by Snowflake
+func (s *Snowflake) ValidatePartitioning(partitionColumns, clusteringColumns int) error {
+	if partitionColumns > 0 {
+		return fmt.Errorf("%s doesn't support partitionKey option. Use clusteringKey", s.Type())
+	}
+	return nil
+}
+
 func (s *Snowflake) CreateTable(ctx context.Context, schemaToCreate *Table) error {
 	err := s.SQLAdapterBase.CreateTable(ctx, schemaToCreate)
 	if err != nil {
 		return err
 	}
-	if !schemaToCreate.Temporary && schemaToCreate.TimestampColumn != "" {
+	if !schemaToCreate.Temporary && (schemaToCreate.TimestampColumn != "" || len(schemaToCreate.ClusteringColumns) > 0) {
 		err = s.createClusteringKey(ctx, schemaToCreate)
 		if err != nil {
 			s.DropTable(ctx, schemaToCreate.Name, true)
@@ -487,14 +693,21 @@ func (s *Snowflake) CreateTable(ctx context.Context, schemaToCreate *Table) erro
 	return nil
 }
 
+// createClusteringKey clusters table by columns of ClusteringKeyOption or by month of timestamp column
 func (s *Snowflake) createClusteringKey(ctx context.Context, table *Table) error {
-	if table.TimestampColumn == "" {
+	if table.TimestampColumn == "" && len(table.ClusteringColumns) == 0 {
 		return nil
 	}
-	quotedTableName := s.quotedTableName(table.Name)
+	quotedTableName := s.quotedTable(table)
 
-	statement := fmt.Sprintf(sfAlterClusteringKeyTemplate,
-		quotedTableName, s.quotedColumnName(table.TimestampColumn))
+	var statement string
+	if len(table.ClusteringColumns) > 0 {
+		statement = fmt.Sprintf(sfClusterByTemplate,
+			quotedTableName, strings.Join(utils.ArrayMap(table.ClusteringColumns, s.quotedColumnName), ", "))
+	} else {
+		statement = fmt.Sprintf(sfAlterClusteringKeyTemplate,
+			quotedTableName, s.quotedColumnName(table.TimestampColumn))
+	}
 
 	if _, err := s.txOrDb(ctx).ExecContext(ctx, statement); err != nil {
 		return errorj.AlterTableError.Wrap(err, "failed to set clustering key").
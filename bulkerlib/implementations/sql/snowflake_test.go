@@ -0,0 +1,157 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	types2 "github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/appbase"
+	"github.com/stretchr/testify/require"
+	"io"
+	"strings"
+	"testing"
+)
+
+// descTableTestConnector connector of database that answers 'desc table' queries with single row of 'id' column. Other queries return no rows
+type descTableTestConnector struct{}
+
+func (c descTableTestConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return descTableTestConn{}, nil
+}
+
+func (c descTableTestConnector) Driver() driver.Driver {
+	return nil
+}
+
+type descTableTestConn struct {
+	driver.Conn
+}
+
+func (c descTableTestConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if strings.HasPrefix(query, "desc table") {
+		return &descTableTestRows{rows: [][]driver.Value{{"ID", "NUMBER(38,0)"}}}, nil
+	}
+	return &descTableTestRows{}, nil
+}
+
+func (c descTableTestConn) Close() error {
+	return nil
+}
+
+type descTableTestRows struct {
+	rows [][]driver.Value
+}
+
+func (r *descTableTestRows) Columns() []string {
+	return []string{"name", "type"}
+}
+
+func (r *descTableTestRows) Close() error {
+	return nil
+}
+
+func (r *descTableTestRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// sfReplaceTableRecorder records executed statements. Tables listed in existingTables are described by descTableTestConnector
+type sfReplaceTableRecorder struct {
+	statementsRecorder
+	db             *sql.DB
+	existingTables []string
+}
+
+func (r *sfReplaceTableRecorder) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	for _, table := range r.existingTables {
+		if query == "desc table "+table || query == "show primary keys in "+table {
+			return r.db.QueryContext(ctx, query)
+		}
+	}
+	return nil, errors.New("SQL compilation error: Table does not exist or not authorized")
+}
+
+func newSnowflakeTestAdapter() *Snowflake {
+	s := &Snowflake{SQLAdapterBase: &SQLAdapterBase[SnowflakeConfig]{Service: appbase.NewServiceBase("snowflake_test"), config: &SnowflakeConfig{Schema: "bulker"}}}
+	s.tableHelper = NewTableHelper(255, '"')
+	s.tableHelper.tableNameFunc = sfIdentifierFunction
+	s.tableHelper.columnNameFunc = sfIdentifierFunction
+	return s
+}
+
+func TestSnowflakeReplaceTable(t *testing.T) {
+	db := sql.OpenDB(descTableTestConnector{})
+	t.Cleanup(func() { _ = db.Close() })
+	tests := []struct {
+		name           string
+		existingTables []string
+		dropOldTable   bool
+		want           []string
+	}{
+		{"swap_and_drop", []string{"EVENTS"}, true, []string{
+			"ALTER TABLE EVENTS SWAP WITH EVENTS_TMP",
+			"DROP TABLE IF EXISTS EVENTS_TMP"}},
+		{"swap_and_keep", []string{"EVENTS"}, false, []string{
+			"ALTER TABLE EVENTS SWAP WITH EVENTS_TMP",
+			"ALTER TABLE EVENTS_TMP RENAME TO DEPRECATED_EVENTS_"}},
+		{"rename_new_table", nil, true, []string{
+			"ALTER TABLE EVENTS_TMP RENAME TO EVENTS"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &sfReplaceTableRecorder{db: db, existingTables: tt.existingTables}
+			ctx := context.WithValue(context.Background(), ContextTransactionKey, recorder)
+			require.NoError(t, newSnowflakeTestAdapter().ReplaceTable(ctx, "events", &Table{Name: "events_tmp"}, tt.dropOldTable))
+			require.Len(t, recorder.statements, len(tt.want))
+			for i, statement := range recorder.statements {
+				require.True(t, strings.HasPrefix(statement, tt.want[i]), "expected statement %q to start with %q", statement, tt.want[i])
+			}
+		})
+	}
+}
+
+func TestSnowflakeLoadTableStage(t *testing.T) {
+	table := &Table{Name: "events", Columns: Columns{"id": types2.SQLColumn{Type: "NUMBER"}, "name": types2.SQLColumn{Type: "TEXT"}}}
+	tests := []struct {
+		name        string
+		stage       string
+		compression types2.FileCompression
+		want        []string
+	}{
+		{"user_stage", "", types2.FileCompressionNONE, []string{
+			"PUT file:///tmp/batch.csv @~",
+			"COPY INTO EVENTS (ID,NAME) from @~/batch.csv FILE_FORMAT=(TYPE= 'CSV', FIELD_OPTIONALLY_ENCLOSED_BY = '\"' ESCAPE_UNENCLOSED_FIELD = NONE SKIP_HEADER = 1 COMPRESSION = AUTO) ",
+			"REMOVE @~/batch.csv"}},
+		{"named_stage", "@DB.BULKER.BULKER_STAGE", types2.FileCompressionGZIP, []string{
+			"PUT file:///tmp/batch.csv @DB.BULKER.BULKER_STAGE SOURCE_COMPRESSION = GZIP AUTO_COMPRESS = FALSE",
+			"COPY INTO EVENTS (ID,NAME) from @DB.BULKER.BULKER_STAGE/batch.csv FILE_FORMAT=(TYPE= 'CSV', FIELD_OPTIONALLY_ENCLOSED_BY = '\"' ESCAPE_UNENCLOSED_FIELD = NONE SKIP_HEADER = 1 COMPRESSION = GZIP) ",
+			"REMOVE @DB.BULKER.BULKER_STAGE/batch.csv"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSnowflakeTestAdapter()
+			s.config.Stage = tt.stage
+			s.batchFileFormat = types2.FileFormatCSV
+			s.batchFileCompression = tt.compression
+			recorder := &statementsRecorder{}
+			ctx := context.WithValue(context.Background(), ContextTransactionKey, recorder)
+			_, err := s.LoadTable(ctx, table, &LoadSource{Type: LocalFile, Format: types2.FileFormatCSV, Path: "/tmp/batch.csv"})
+			require.NoError(t, err)
+			require.Equal(t, tt.want, recorder.statements)
+		})
+	}
+
+	for stage, valid := range map[string]bool{"~": true, "@~": true, "BULKER_STAGE": true, `DB."bulker".STAGE`: true, "@stage; DROP TABLE events": false, "s3://bucket": false} {
+		err := (&SnowflakeConfig{Account: "a", Db: "db", Username: "u", Warehouse: "wh", Stage: stage}).Validate()
+		if valid {
+			require.NoError(t, err, stage)
+		} else {
+			require.ErrorContains(t, err, "Snowflake stage must be ~ or name of internal stage", stage)
+		}
+	}
+}
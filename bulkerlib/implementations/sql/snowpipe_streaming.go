@@ -0,0 +1,311 @@
+package sql
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	types2 "github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/errorj"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"github.com/jitsucom/bulker/jitsubase/uuid"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Snowpipe Streaming REST API. See https://docs.snowflake.com/en/user-guide/data-load-snowpipe-streaming-overview
+const (
+	sfStreamingHostnamePath    = "/v2/streaming/hostname"
+	sfStreamingOAuthPath       = "/oauth/token"
+	sfStreamingChannelPath     = "/v2/streaming/databases/%s/schemas/%s/pipes/%s/channels/%s"
+	sfStreamingAppendRowsPath  = "/v2/streaming/data/databases/%s/schemas/%s/pipes/%s/channels/%s/rows"
+	sfStreamingDefaultPipeName = "%s-STREAMING"
+
+	sfStreamingJwtTTL   = 59 * time.Minute
+	sfStreamingTokenTTL = 50 * time.Minute
+)
+
+var (
+	errSfStaleContinuationToken = errors.New("stale continuation token")
+	// errSfStreamingLimitExceeded throttling or request size limit of Snowpipe Streaming API
+	errSfStreamingLimitExceeded = errors.New("snowpipe streaming limit exceeded")
+)
+
+// snowpipeStreamingClient client of Snowpipe Streaming REST API. Uses key pair authentication
+type snowpipeStreamingClient struct {
+	sync.Mutex
+	config     *SnowflakeConfig
+	privateKey *rsa.PrivateKey
+	httpClient *http.Client
+
+	ingestHost   string
+	scopedToken  string
+	tokenExpires time.Time
+}
+
+// snowpipeStreamingChannel channel opened for the table's default pipe
+type snowpipeStreamingChannel struct {
+	pipe              string
+	name              string
+	continuationToken string
+	offset            int64
+}
+
+func newSnowpipeStreamingClient(config *SnowflakeConfig) (*snowpipeStreamingClient, error) {
+	if config.PrivateKey == "" {
+		return nil, errors.New("Snowpipe Streaming requires key pair authentication: 'privateKey' parameter is required")
+	}
+	privateKey, err := parseSnowflakePrivateKey(config.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return &snowpipeStreamingClient{config: config, privateKey: privateKey, httpClient: &http.Client{Timeout: time.Minute}}, nil
+}
+
+// parseSnowflakePrivateKey parses PEM encoded PKCS8 or PKCS1 RSA private key
+func parseSnowflakePrivateKey(value string) (*rsa.PrivateKey, error) {
+	pemBytes, err := utils.ReadPEM(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %v", err)
+	}
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("failed to decode private key: PEM block not found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %v", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key must be RSA key. Got: %T", key)
+	}
+	return rsaKey, nil
+}
+
+func (c *snowpipeStreamingClient) accountUrl() string {
+	return fmt.Sprintf("https://%s.snowflakecomputing.com", c.config.Account)
+}
+
+// jwt returns key pair JWT token signed with private key
+func (c *snowpipeStreamingClient) jwt() (string, error) {
+	publicKey, err := x509.MarshalPKIXPublicKey(&c.privateKey.PublicKey)
+	if err != nil {
+		return "", err
+	}
+	fingerprint := sha256.Sum256(publicKey)
+	account := strings.ToUpper(strings.Split(c.config.Account, ".")[0])
+	subject := account + "." + strings.ToUpper(c.config.Username)
+	now := time.Now()
+	header, _ := json.Marshal(map[string]any{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]any{
+		"iss": subject + ".SHA256:" + base64.StdEncoding.EncodeToString(fingerprint[:]),
+		"sub": subject,
+		"iat": now.Unix(),
+		"exp": now.Add(sfStreamingJwtTTL).Unix(),
+	})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	hashed := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, c.privateKey, crypto.SHA256, hashed[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign JWT: %v", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// token returns ingest host and scoped OAuth token for it. Token is refreshed when it is about to expire
+func (c *snowpipeStreamingClient) token(ctx context.Context) (string, string, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.scopedToken != "" && time.Now().Before(c.tokenExpires) {
+		return c.ingestHost, c.scopedToken, nil
+	}
+	jwt, err := c.jwt()
+	if err != nil {
+		return "", "", err
+	}
+	jwtHeaders := map[string]string{"Authorization": "Bearer " + jwt, "X-Snowflake-Authorization-Token-Type": "KEYPAIR_JWT"}
+	hostname, err := c.do(ctx, http.MethodGet, c.accountUrl()+sfStreamingHostnamePath, jwtHeaders, nil)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get ingest host: %v", err)
+	}
+	ingestHost := strings.TrimSpace(string(hostname))
+	form := url.Values{"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"}, "scope": {ingestHost}}
+	jwtHeaders["Content-Type"] = "application/x-www-form-urlencoded"
+	token, err := c.do(ctx, http.MethodPost, c.accountUrl()+sfStreamingOAuthPath, jwtHeaders, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get scoped token: %v", err)
+	}
+	c.ingestHost = ingestHost
+	c.scopedToken = strings.TrimSpace(string(token))
+	c.tokenExpires = time.Now().Add(sfStreamingTokenTTL)
+	return c.ingestHost, c.scopedToken, nil
+}
+
+func (c *snowpipeStreamingClient) ingestRequest(ctx context.Context, method, path string, query url.Values, contentType string, body io.Reader) ([]byte, error) {
+	host, token, err := c.token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	u := "https://" + host + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return c.do(ctx, method, u, map[string]string{
+		"Authorization":                        "Bearer " + token,
+		"X-Snowflake-Authorization-Token-Type": "OAUTH",
+		"Content-Type":                         contentType,
+	}, body)
+}
+
+func (c *snowpipeStreamingClient) do(ctx context.Context, method, u string, headers map[string]string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	resBody, _ := io.ReadAll(res.Body)
+	if res.StatusCode >= 300 {
+		if strings.Contains(string(resBody), "STALE_CONTINUATION_TOKEN") {
+			return nil, errSfStaleContinuationToken
+		}
+		if res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusRequestEntityTooLarge {
+			return nil, fmt.Errorf("%w: http %d: %s", errSfStreamingLimitExceeded, res.StatusCode, string(resBody))
+		}
+		return nil, fmt.Errorf("http %d: %s", res.StatusCode, string(resBody))
+	}
+	return resBody, nil
+}
+
+// openChannel opens (or reopens) channel for the default pipe of the table
+func (c *snowpipeStreamingClient) openChannel(ctx context.Context, tableName, channelName string) (*snowpipeStreamingChannel, error) {
+	pipe := fmt.Sprintf(sfStreamingDefaultPipeName, tableName)
+	path := fmt.Sprintf(sfStreamingChannelPath, url.PathEscape(c.config.Db), url.PathEscape(c.config.Schema), url.PathEscape(pipe), url.PathEscape(channelName))
+	resBody, err := c.ingestRequest(ctx, http.MethodPut, path, nil, "application/json", strings.NewReader("{}"))
+	if err != nil {
+		return nil, err
+	}
+	res := struct {
+		NextContinuationToken string `json:"next_continuation_token"`
+		ChannelStatus         struct {
+			LastCommittedOffsetToken string `json:"last_committed_offset_token"`
+		} `json:"channel_status"`
+	}{}
+	if err = json.Unmarshal(resBody, &res); err != nil {
+		return nil, fmt.Errorf("failed to parse open channel response: %v", err)
+	}
+	offset, _ := strconv.ParseInt(res.ChannelStatus.LastCommittedOffsetToken, 10, 64)
+	return &snowpipeStreamingChannel{pipe: pipe, name: channelName, continuationToken: res.NextContinuationToken, offset: offset}, nil
+}
+
+// appendRows sends rows as NDJSON to the channel and advances channel's continuation token
+func (c *snowpipeStreamingClient) appendRows(ctx context.Context, channel *snowpipeStreamingChannel, rows []byte) error {
+	path := fmt.Sprintf(sfStreamingAppendRowsPath, url.PathEscape(c.config.Db), url.PathEscape(c.config.Schema), url.PathEscape(channel.pipe), url.PathEscape(channel.name))
+	offset := channel.offset + 1
+	query := url.Values{"continuationToken": {channel.continuationToken}, "offsetToken": {strconv.FormatInt(offset, 10)}}
+	resBody, err := c.ingestRequest(ctx, http.MethodPost, path, query, "application/x-ndjson", bytes.NewReader(rows))
+	if err != nil {
+		return err
+	}
+	res := struct {
+		NextContinuationToken string `json:"next_continuation_token"`
+	}{}
+	if err = json.Unmarshal(resBody, &res); err != nil {
+		return fmt.Errorf("failed to parse append rows response: %v", err)
+	}
+	channel.continuationToken = res.NextContinuationToken
+	channel.offset = offset
+	return nil
+}
+
+// SnowpipeStreaming is Snowflake adapter for stream mode that ingests rows via Snowpipe Streaming API
+// instead of INSERT statements. Tables are still created and patched with regular SQL connection.
+// Rows are ingested through the default pipe of the table
+type SnowpipeStreaming struct {
+	*Snowflake
+	client      *snowpipeStreamingClient
+	channelName string
+	channels    map[string]*snowpipeStreamingChannel
+}
+
+func newSnowpipeStreaming(s *Snowflake, streamId string) (*SnowpipeStreaming, error) {
+	client, err := s.snowpipeStreamingClient()
+	if err != nil {
+		return nil, err
+	}
+	hostname, _ := os.Hostname()
+	channelName := "bulker_" + utils.SanitizeString(streamId) + "_" + utils.SanitizeString(utils.NvlString(hostname, uuid.New()))
+	return &SnowpipeStreaming{Snowflake: s, client: client, channelName: channelName, channels: map[string]*snowpipeStreamingChannel{}}, nil
+}
+
+// Insert appends objects to the table's channel. Deduplication is not supported by Snowpipe Streaming
+func (s *SnowpipeStreaming) Insert(ctx context.Context, table *Table, merge bool, objects ...types2.Object) error {
+	buf := bytes.Buffer{}
+	encoder := json.NewEncoder(&buf)
+	for _, object := range objects {
+		row := make(map[string]any, len(table.Columns))
+		for name, column := range table.Columns {
+			value, ok := object[name]
+			row[name] = s.valueMappingFunction(value, ok, column)
+		}
+		if err := encoder.Encode(row); err != nil {
+			return errorj.ExecuteInsertError.Wrap(err, "failed to encode row")
+		}
+	}
+	err := s.appendRows(ctx, table.Name, buf.Bytes())
+	if errors.Is(err, errSfStaleContinuationToken) {
+		// channel was reopened by another client or expired. Reopen it and try again
+		delete(s.channels, table.Name)
+		err = s.appendRows(ctx, table.Name, buf.Bytes())
+	}
+	if err != nil {
+		return errorj.ExecuteInsertError.Wrap(err, "failed to append rows via Snowpipe Streaming").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Schema: s.config.Schema,
+				Table:  s.quotedTableName(table.Name),
+			})
+	}
+	return nil
+}
+
+// IsStreamingQuotaError returns true if Snowpipe Streaming API throttled request or rejected it as too large
+func (s *SnowpipeStreaming) IsStreamingQuotaError(err error) bool {
+	return errors.Is(errorj.Cause(err), errSfStreamingLimitExceeded)
+}
+
+func (s *SnowpipeStreaming) appendRows(ctx context.Context, tableName string, rows []byte) error {
+	channel, ok := s.channels[tableName]
+	if !ok {
+		var err error
+		channel, err = s.client.openChannel(ctx, tableName, s.channelName)
+		if err != nil {
+			return fmt.Errorf("failed to open channel: %w", err)
+		}
+		s.channels[tableName] = channel
+	}
+	return s.client.appendRows(ctx, channel, rows)
+}
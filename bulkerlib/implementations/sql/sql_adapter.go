@@ -4,9 +4,16 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/go-sql-driver/mysql"
 	bulker "github.com/jitsucom/bulker/bulkerlib"
 	types2 "github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/errorj"
+	"github.com/jitsucom/bulker/jitsubase/logging"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"github.com/lib/pq"
 	"regexp"
+	"strings"
+	"time"
 )
 
 const ContextTransactionKey = "transaction"
@@ -51,6 +58,8 @@ type SQLAdapter interface {
 
 	Select(ctx context.Context, tableName string, whenConditions *WhenConditions, orderBy []string) ([]map[string]any, error)
 	Count(ctx context.Context, tableName string, whenConditions *WhenConditions) (int, error)
+	// RunTransform runs user provided transform SQL. {{.RawTable}} and {{.CleanTable}} placeholders are replaced with quoted table names
+	RunTransform(ctx context.Context, transformSQL string, rawTableName, cleanTableName string) (*bulker.WarehouseState, error)
 
 	// ColumnName adapts column name to sql identifier rules of database
 	ColumnName(rawColumn string) string
@@ -58,24 +67,70 @@ type SQLAdapter interface {
 	TableName(rawTableName string) string
 }
 
+// SavepointsSupport optional interface for SQLAdapter that can use SAVEPOINT statements inside transactions
+type SavepointsSupport interface {
+	SupportsSavepoints() bool
+}
+
+// TableExporter optional interface for SQLAdapter that can read table rows without loading all of them to memory
+type TableExporter interface {
+	ExportRows(ctx context.Context, tableName string, whenConditions *WhenConditions, consumer func(row map[string]any) error) error
+}
+
+// TableCloner optional interface for SQLAdapter that can create warehouse-side snapshot of table expiring at provided time
+type TableCloner interface {
+	CloneTable(ctx context.Context, tableName, cloneName string, expiration time.Time) error
+}
+
+// ColumnsUpdater optional interface for SQLAdapter that can update columns of existing target table rows
+// with values of source table rows matched by primary key. Used by UpdateColumns bulk mode
+type ColumnsUpdater interface {
+	UpdateColumns(ctx context.Context, targetTable *Table, sourceTable *Table) (state *bulker.WarehouseState, err error)
+}
+
+// StreamingQuotaChecker optional interface for SQLAdapter that inserts rows with streaming API.
+// Stream mode falls back to batch loading when streaming quota or request size limit is hit
+type StreamingQuotaChecker interface {
+	IsStreamingQuotaError(err error) bool
+}
+
+// VersionsCloser optional interface for SQLAdapter that can close current versions of target table rows
+// matched by key columns with rows of source table. Used by SCD2 bulk mode
+type VersionsCloser interface {
+	CloseVersions(ctx context.Context, targetTable *Table, sourceTable *Table, keyColumns []string) (state *bulker.WarehouseState, err error)
+}
+
+// KeysDeleter optional interface for SQLAdapter that can delete rows of target table matching rows of source table by key columns.
+// Used to apply tombstones. See TombstonesOption
+type KeysDeleter interface {
+	DeleteByKeys(ctx context.Context, targetTable *Table, sourceTable *Table, keyColumns []string) (state *bulker.WarehouseState, err error)
+}
+
 type LoadSourceType string
 
 const (
 	LocalFile        LoadSourceType = "local_file"
 	GoogleCloudStore LoadSourceType = "google_cloud_store"
 	AmazonS3         LoadSourceType = "amazon_s3"
+	AzureBlob        LoadSourceType = "azure_blob"
 )
 
 type LoadSource struct {
-	Type     LoadSourceType
-	Format   types2.FileFormat
-	Path     string
-	S3Config *S3OptionConfig
+	Type            LoadSourceType
+	Format          types2.FileFormat
+	Path            string
+	S3Config        *S3OptionConfig
+	AzureBlobConfig *AzureBlobOptionConfig
+	// Manifest Path is manifest listing staged files. See ManifestLoadSupport
+	Manifest bool
 }
 
 type TxSQLAdapter struct {
 	sqlAdapter SQLAdapter
 	tx         *TxWrapper
+	// createdTables and modifiedTables tables created and modified by emulated transaction. See TxSemanticsEmulated
+	createdTables  utils.Set[string]
+	modifiedTables utils.Set[string]
 }
 
 func (tx *TxSQLAdapter) Type() string {
@@ -115,7 +170,11 @@ func (tx *TxSQLAdapter) OpenTx(ctx context.Context) (*TxSQLAdapter, error) {
 }
 func (tx *TxSQLAdapter) Insert(ctx context.Context, table *Table, merge bool, objects ...types2.Object) error {
 	ctx = context.WithValue(ctx, ContextTransactionKey, tx.tx)
-	return tx.sqlAdapter.Insert(ctx, table, merge, objects...)
+	err := tx.sqlAdapter.Insert(ctx, table, merge, objects...)
+	if !table.Temporary {
+		tx.trackModified(table.Name, err)
+	}
+	return err
 }
 func (tx *TxSQLAdapter) Ping(ctx context.Context) error {
 	ctx = context.WithValue(ctx, ContextTransactionKey, tx.tx)
@@ -136,15 +195,53 @@ func (tx *TxSQLAdapter) GetTableSchema(ctx context.Context, tableName string) (*
 }
 func (tx *TxSQLAdapter) CreateTable(ctx context.Context, schemaToCreate *Table) error {
 	ctx = context.WithValue(ctx, ContextTransactionKey, tx.tx)
-	return tx.sqlAdapter.CreateTable(ctx, schemaToCreate)
+	err := tx.sqlAdapter.CreateTable(ctx, schemaToCreate)
+	tx.trackCreated(schemaToCreate.Name, err)
+	return err
 }
 func (tx *TxSQLAdapter) CopyTables(ctx context.Context, targetTable *Table, sourceTable *Table, mergeWindow int) (*bulker.WarehouseState, error) {
 	ctx = context.WithValue(ctx, ContextTransactionKey, tx.tx)
-	return tx.sqlAdapter.CopyTables(ctx, targetTable, sourceTable, mergeWindow)
+	state, err := tx.sqlAdapter.CopyTables(ctx, targetTable, sourceTable, mergeWindow)
+	tx.trackModified(targetTable.Name, err)
+	return state, err
+}
+func (tx *TxSQLAdapter) UpdateColumns(ctx context.Context, targetTable *Table, sourceTable *Table) (*bulker.WarehouseState, error) {
+	updater, ok := tx.sqlAdapter.(ColumnsUpdater)
+	if !ok {
+		return nil, fmt.Errorf("%s doesn't support updating columns", tx.sqlAdapter.Type())
+	}
+	ctx = context.WithValue(ctx, ContextTransactionKey, tx.tx)
+	state, err := updater.UpdateColumns(ctx, targetTable, sourceTable)
+	tx.trackModified(targetTable.Name, err)
+	return state, err
+}
+func (tx *TxSQLAdapter) CloseVersions(ctx context.Context, targetTable *Table, sourceTable *Table, keyColumns []string) (*bulker.WarehouseState, error) {
+	closer, ok := tx.sqlAdapter.(VersionsCloser)
+	if !ok {
+		return nil, fmt.Errorf("%s doesn't support closing versions of rows", tx.sqlAdapter.Type())
+	}
+	ctx = context.WithValue(ctx, ContextTransactionKey, tx.tx)
+	state, err := closer.CloseVersions(ctx, targetTable, sourceTable, keyColumns)
+	tx.trackModified(targetTable.Name, err)
+	return state, err
+}
+func (tx *TxSQLAdapter) DeleteByKeys(ctx context.Context, targetTable *Table, sourceTable *Table, keyColumns []string) (*bulker.WarehouseState, error) {
+	deleter, ok := tx.sqlAdapter.(KeysDeleter)
+	if !ok {
+		return nil, fmt.Errorf("%s doesn't support deleting rows by keys", tx.sqlAdapter.Type())
+	}
+	ctx = context.WithValue(ctx, ContextTransactionKey, tx.tx)
+	state, err := deleter.DeleteByKeys(ctx, targetTable, sourceTable, keyColumns)
+	tx.trackModified(targetTable.Name, err)
+	return state, err
 }
 func (tx *TxSQLAdapter) LoadTable(ctx context.Context, targetTable *Table, loadSource *LoadSource) (*bulker.WarehouseState, error) {
 	ctx = context.WithValue(ctx, ContextTransactionKey, tx.tx)
-	return tx.sqlAdapter.LoadTable(ctx, targetTable, loadSource)
+	state, err := tx.sqlAdapter.LoadTable(ctx, targetTable, loadSource)
+	if !targetTable.Temporary {
+		tx.trackModified(targetTable.Name, err)
+	}
+	return state, err
 }
 func (tx *TxSQLAdapter) PatchTableSchema(ctx context.Context, patchTable *Table) error {
 	ctx = context.WithValue(ctx, ContextTransactionKey, tx.tx)
@@ -152,7 +249,9 @@ func (tx *TxSQLAdapter) PatchTableSchema(ctx context.Context, patchTable *Table)
 }
 func (tx *TxSQLAdapter) TruncateTable(ctx context.Context, tableName string) error {
 	ctx = context.WithValue(ctx, ContextTransactionKey, tx.tx)
-	return tx.sqlAdapter.TruncateTable(ctx, tableName)
+	err := tx.sqlAdapter.TruncateTable(ctx, tableName)
+	tx.trackModified(tableName, err)
+	return err
 }
 
 //	func (tx *TxSQLAdapter) Update(ctx context.Context, tableName string, object types.Object, whenConditions *WhenConditions) error {
@@ -161,19 +260,29 @@ func (tx *TxSQLAdapter) TruncateTable(ctx context.Context, tableName string) err
 //	}
 func (tx *TxSQLAdapter) Delete(ctx context.Context, tableName string, deleteConditions *WhenConditions) error {
 	ctx = context.WithValue(ctx, ContextTransactionKey, tx.tx)
-	return tx.sqlAdapter.Delete(ctx, tableName, deleteConditions)
+	err := tx.sqlAdapter.Delete(ctx, tableName, deleteConditions)
+	tx.trackModified(tableName, err)
+	return err
 }
 func (tx *TxSQLAdapter) DropTable(ctx context.Context, tableName string, ifExists bool) error {
 	ctx = context.WithValue(ctx, ContextTransactionKey, tx.tx)
-	return tx.sqlAdapter.DropTable(ctx, tableName, ifExists)
+	err := tx.sqlAdapter.DropTable(ctx, tableName, ifExists)
+	tx.trackModified(tableName, err)
+	return err
 }
 func (tx *TxSQLAdapter) Drop(ctx context.Context, table *Table, ifExists bool) error {
 	ctx = context.WithValue(ctx, ContextTransactionKey, tx.tx)
-	return tx.sqlAdapter.Drop(ctx, table, ifExists)
+	err := tx.sqlAdapter.Drop(ctx, table, ifExists)
+	if !table.Temporary {
+		tx.trackModified(table.Name, err)
+	}
+	return err
 }
 func (tx *TxSQLAdapter) ReplaceTable(ctx context.Context, targetTableName string, replacementTable *Table, dropOldTable bool) error {
 	ctx = context.WithValue(ctx, ContextTransactionKey, tx.tx)
-	return tx.sqlAdapter.ReplaceTable(ctx, targetTableName, replacementTable, dropOldTable)
+	err := tx.sqlAdapter.ReplaceTable(ctx, targetTableName, replacementTable, dropOldTable)
+	tx.trackModified(targetTableName, err)
+	return err
 }
 
 func (tx *TxSQLAdapter) Select(ctx context.Context, tableName string, whenConditions *WhenConditions, orderBy []string) ([]map[string]any, error) {
@@ -185,12 +294,105 @@ func (tx *TxSQLAdapter) Count(ctx context.Context, tableName string, whenConditi
 	return tx.sqlAdapter.Count(ctx, tableName, whenConditions)
 }
 
+func (tx *TxSQLAdapter) RunTransform(ctx context.Context, transformSQL string, rawTableName, cleanTableName string) (*bulker.WarehouseState, error) {
+	ctx = context.WithValue(ctx, ContextTransactionKey, tx.tx)
+	state, err := tx.sqlAdapter.RunTransform(ctx, transformSQL, rawTableName, cleanTableName)
+	tx.trackModified(cleanTableName, err)
+	return state, err
+}
+
 func (tx *TxSQLAdapter) Commit() error {
 	return tx.tx.Commit()
 }
 
+// Rollback discards statements of transaction. Returns error if emulated transaction has already modified destination tables
 func (tx *TxSQLAdapter) Rollback() error {
-	return tx.tx.Rollback()
+	if err := tx.tx.Rollback(); err != nil {
+		return err
+	}
+	return tx.partialRollbackError()
+}
+
+// SupportsSavepoints returns true if underlying adapter supports savepoints inside transaction
+func (tx *TxSQLAdapter) SupportsSavepoints() bool {
+	sp, ok := tx.sqlAdapter.(SavepointsSupport)
+	return ok && sp.SupportsSavepoints()
+}
+
+func (tx *TxSQLAdapter) Savepoint(ctx context.Context, name string) error {
+	return tx.tx.Savepoint(ctx, name)
+}
+
+func (tx *TxSQLAdapter) RollbackToSavepoint(ctx context.Context, name string) error {
+	return tx.tx.RollbackToSavepoint(ctx, name)
+}
+
+func (tx *TxSQLAdapter) ReleaseSavepoint(ctx context.Context, name string) error {
+	return tx.tx.ReleaseSavepoint(ctx, name)
+}
+
+// WithSavepoint runs f protected by savepoint. If f fails, transaction is rolled back to savepoint
+// and f is retried up to 'retries' times within the same transaction if error is transient (see isRetryableLoadError).
+// backoff returns delay before the next attempt. It may be nil. If adapter doesn't support savepoints f is run once.
+func (tx *TxSQLAdapter) WithSavepoint(ctx context.Context, name string, retries int, backoff func(attempt int) time.Duration, f func() error) error {
+	if !tx.SupportsSavepoints() {
+		return f()
+	}
+	var err error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if err = tx.Savepoint(ctx, name); err != nil {
+			return err
+		}
+		err = f()
+		if err == nil {
+			return tx.ReleaseSavepoint(ctx, name)
+		}
+		if rbErr := tx.RollbackToSavepoint(ctx, name); rbErr != nil {
+			return errorj.Group(err, rbErr)
+		}
+		if !isRetryableLoadError(err) || attempt == retries {
+			return err
+		}
+		logging.Warnf("[%s] attempt #%d failed and was rolled back to savepoint %s: %v", tx.sqlAdapter.Type(), attempt+1, name, err)
+		if backoff != nil {
+			if sleepErr := sleepBackoff(ctx, backoff(attempt)); sleepErr != nil {
+				return err
+			}
+		}
+	}
+	return err
+}
+
+// retryableSQLStates SQLSTATE codes of transient failures: serialization failure, deadlock, lock not available, insufficient resources
+var retryableSQLStates = utils.NewSet("40001", "40P01", "55P03", "53000", "53100", "53200", "53300")
+
+const (
+	mysqlLockWaitTimeout = 1205
+	mysqlDeadlock        = 1213
+)
+
+// isRetryableLoadError returns true for transient errors that may not happen again when statement is retried.
+// Errors caused by data, e.g. type mismatch or constraint violation, are not retryable
+func isRetryableLoadError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var pgErr *pq.Error
+	if errors.As(err, &pgErr) {
+		return retryableSQLStates.Contains(string(pgErr.Code))
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == mysqlLockWaitTimeout || mysqlErr.Number == mysqlDeadlock
+	}
+	// checkErr replaces pq.Error with plain error: "pq: <code> <message>"
+	msg := err.Error()
+	for code := range retryableSQLStates {
+		if strings.Contains(msg, "pq: "+code) {
+			return true
+		}
+	}
+	return strings.Contains(msg, "deadlock detected") || strings.Contains(msg, "Deadlock found") || strings.Contains(msg, "Lock wait timeout exceeded")
 }
 
 func (tx *TxSQLAdapter) ColumnName(identifier string) string {
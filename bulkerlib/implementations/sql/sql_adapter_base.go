@@ -5,16 +5,25 @@ import (
 	"database/sql"
 	"fmt"
 	"github.com/hashicorp/go-multierror"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
 	types2 "github.com/jitsucom/bulker/bulkerlib/types"
 	"github.com/jitsucom/bulker/jitsubase/appbase"
 	"github.com/jitsucom/bulker/jitsubase/errorj"
 	"github.com/jitsucom/bulker/jitsubase/logging"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"text/template"
 	"time"
 )
 
+const (
+	// staleConnectionTimeout idle connections of adapter unused for longer time are dropped before reuse
+	staleConnectionTimeout = 10 * time.Minute
+	// defaultMaxIdleConns max number of idle connections in pool
+	defaultMaxIdleConns = 10
+)
+
 const (
 	createTableTemplate     = `CREATE %s TABLE %s (%s)`
 	addColumnTemplate       = `ALTER TABLE %s ADD COLUMN %s`
@@ -25,6 +34,8 @@ const (
 	selectQueryTemplate   = `SELECT %s FROM %s%s%s`
 	insertQuery           = `INSERT INTO {{.TableName}}({{.Columns}}) VALUES ({{.Placeholders}})`
 	insertFromSelectQuery = `INSERT INTO {{.TableTo}}({{.Columns}}) SELECT {{.Columns}} FROM {{.TableFrom}}`
+	updateFromQuery       = `UPDATE {{.TableTo}} AS T SET {{.UpdateSet}} FROM {{.TableFrom}} AS S WHERE {{.JoinConditions}}`
+	deleteByKeysQuery     = `DELETE FROM {{.TableTo}} WHERE EXISTS (SELECT 1 FROM {{.TableFrom}} AS S WHERE {{.JoinConditions}})`
 	renameTableTemplate   = `ALTER TABLE %s%s RENAME TO %s`
 
 	updateStatementTemplate = `UPDATE %s SET %s WHERE %s`
@@ -35,6 +46,8 @@ const (
 var (
 	insertQueryTemplate, _           = template.New("insertQuery").Parse(insertQuery)
 	insertFromSelectQueryTemplate, _ = template.New("insertFromSelectQuery").Parse(insertFromSelectQuery)
+	updateFromQueryTemplate, _       = template.New("updateFromQuery").Parse(updateFromQuery)
+	deleteByKeysQueryTemplate, _     = template.New("deleteByKeysQuery").Parse(deleteByKeysQuery)
 
 	unmappedValue ValueMappingFunction = func(val any, valPresent bool, column types2.SQLColumn) any {
 		return val
@@ -58,15 +71,26 @@ type ErrorAdapter func(error) error
 
 type SQLAdapterBase[T any] struct {
 	appbase.Service
-	typeId               string
-	config               *T
-	dataSource           *sql.DB
+	typeId     string
+	config     *T
+	dataSource *sql.DB
+	// readDataSource optional connection to read replica for schema introspection queries
+	readDataSource       *sql.DB
 	queryLogger          *logging.QueryLogger
 	batchFileFormat      types2.FileFormat
 	batchFileCompression types2.FileCompression
 	temporaryTables      bool
 	// stringifyObjects objects types like JSON, array will be stringified before sent to warehouse (warehouse will parse them back)
 	stringifyObjects bool
+	// statementTimeout - timeout for executed statements. Timed out statements are cancelled. 0 - no timeout
+	statementTimeout time.Duration
+	// retryableErrorFunc if set, statements executed outside of transaction are retried up to statementRetries times on errors it returns true for
+	retryableErrorFunc func(err error) bool
+	statementRetries   int
+	// connMaxLifetime max lifetime of pooled connections. 0 - default of adapter
+	connMaxLifetime time.Duration
+	// lastPing unix time in nanoseconds of the latest Ping. Idle connections of pool unused for longer than staleConnectionTimeout are dropped before reuse
+	lastPing atomic.Int64
 
 	typesMapping        map[types2.DataType]string
 	reverseTypesMapping map[string]types2.DataType
@@ -76,8 +100,16 @@ type SQLAdapterBase[T any] struct {
 	typecastFunc         TypeCastFunction
 	valueMappingFunction ValueMappingFunction
 	_columnDDLFunc       ColumnDDLFunction
-	tableHelper          TableHelper
-	checkErrFunc         ErrorAdapter
+	// constraints statements creating indexes and NOT NULL constraints. nil - constraints options are not supported
+	constraints *constraintsDialect
+	// comments statements setting comments of tables and columns. nil - descriptions option is not supported
+	comments     *commentsDialect
+	tableHelper  TableHelper
+	checkErrFunc ErrorAdapter
+	// maintenance schedule of tables maintenance tasks. See MaintenanceOption
+	maintenance *maintenanceSchedule
+	// schemaRouter routes events to per-schema instances of adapter. nil - SchemaFieldOption is not supported
+	schemaRouter *schemaRouter
 }
 
 func newSQLAdapterBase[T any](id string, typeId string, config *T, dbConnectFunction DbConnectFunction[T], dataTypes map[types2.DataType][]string, queryLogger *logging.QueryLogger, typecastFunc TypeCastFunction, parameterPlaceholder ParameterPlaceholder, columnDDLFunc ColumnDDLFunction, valueMappingFunction ValueMappingFunction, checkErrFunc ErrorAdapter) (*SQLAdapterBase[T], error) {
@@ -93,12 +125,13 @@ func newSQLAdapterBase[T any](id string, typeId string, config *T, dbConnectFunc
 		_columnDDLFunc:       columnDDLFunc,
 		checkErrFunc:         checkErrFunc,
 		stringifyObjects:     true,
+		maintenance:          newMaintenanceSchedule(),
 	}
 	s.temporaryTables = true
 	s.batchFileFormat = types2.FileFormatNDJSON
 	s.batchFileCompression = types2.FileCompressionNONE
 	var err error
-	s.dataSource, err = dbConnectFunction(config)
+	s.dataSource, err = s.connect(config)
 	s.initTypes(dataTypes)
 	return &s, err
 }
@@ -139,9 +172,10 @@ func (b *SQLAdapterBase[T]) StringifyObjects() bool {
 
 func (b *SQLAdapterBase[T]) Ping(ctx context.Context) error {
 	if b.dataSource != nil {
+		b.reapStaleConnections()
 		err := b.dataSource.PingContext(ctx)
 		if err != nil {
-			dataSource, err := b.dbConnectFunction(b.config)
+			dataSource, err := b.connect(b.config)
 			if err == nil {
 				_ = b.dataSource.Close()
 				b.dataSource = dataSource
@@ -152,7 +186,7 @@ func (b *SQLAdapterBase[T]) Ping(ctx context.Context) error {
 		}
 	} else {
 		var err error
-		b.dataSource, err = b.dbConnectFunction(b.config)
+		b.dataSource, err = b.connect(b.config)
 		if err != nil {
 			return fmt.Errorf("failed to connect to %s. error: %v", b.typeId, err)
 		}
@@ -160,14 +194,87 @@ func (b *SQLAdapterBase[T]) Ping(ctx context.Context) error {
 	return nil
 }
 
+// connect opens connection pool and applies connMaxLifetime to it
+func (b *SQLAdapterBase[T]) connect(config *T) (*sql.DB, error) {
+	dataSource, err := b.dbConnectFunction(config)
+	if err != nil {
+		return nil, err
+	}
+	if b.connMaxLifetime > 0 {
+		dataSource.SetConnMaxLifetime(b.connMaxLifetime)
+	}
+	b.lastPing.Store(time.Now().UnixNano())
+	return dataSource, nil
+}
+
+// setConnMaxLifetime sets max lifetime of pooled connections of opened pools and pools opened on reconnect. 0 - default of adapter
+func (b *SQLAdapterBase[T]) setConnMaxLifetime(lifetime time.Duration) {
+	b.connMaxLifetime = lifetime
+	if lifetime <= 0 {
+		return
+	}
+	for _, dataSource := range []*sql.DB{b.dataSource, b.readDataSource} {
+		if dataSource != nil {
+			dataSource.SetConnMaxLifetime(lifetime)
+		}
+	}
+}
+
+// reapStaleConnections drops idle connections of pools if adapter wasn't used for longer than staleConnectionTimeout,
+// so connections silently closed by database or network (e.g. overnight) are not reused and new ones are opened instead
+func (b *SQLAdapterBase[T]) reapStaleConnections() {
+	now := time.Now()
+	lastPing := time.Unix(0, b.lastPing.Swap(now.UnixNano()))
+	if now.Sub(lastPing) < staleConnectionTimeout {
+		return
+	}
+	for _, dataSource := range []*sql.DB{b.dataSource, b.readDataSource} {
+		if dataSource != nil {
+			dataSource.SetMaxIdleConns(0)
+			dataSource.SetMaxIdleConns(defaultMaxIdleConns)
+		}
+	}
+}
+
 // Close underlying sql.DB
 func (b *SQLAdapterBase[T]) Close() error {
+	_ = b.schemaRouter.Close()
+	if b.readDataSource != nil {
+		_ = b.readDataSource.Close()
+	}
 	if b.dataSource != nil {
 		return b.dataSource.Close()
 	}
 	return nil
 }
 
+// connectReadReplica opens connection to read replica described by provided config
+func (b *SQLAdapterBase[T]) connectReadReplica(replicaConfig *T) error {
+	readDataSource, err := b.connect(replicaConfig)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s read replica. error: %v", b.typeId, err)
+	}
+	b.readDataSource = readDataSource
+	return nil
+}
+
+// readDb returns read replica connection if configured or primary connection otherwise
+func (b *SQLAdapterBase[T]) readDb() *sql.DB {
+	if b.readDataSource != nil {
+		return b.readDataSource
+	}
+	return b.dataSource
+}
+
+// readTxOrDb same as txOrDb but uses read replica when there is no transaction in context.
+// Schema introspection within transaction must see uncommitted changes so it is always done on primary.
+func (b *SQLAdapterBase[T]) readTxOrDb(ctx context.Context) TxOrDB {
+	if _, ok := ctx.Value(ContextTransactionKey).(TxOrDB); ok || b.readDataSource == nil {
+		return b.txOrDb(ctx)
+	}
+	return NewDbWrapper(b.typeId, b.readDataSource, b.queryLogger, b.checkErrFunc, false).WithStatementTimeout(b.statementTimeout).WithRetries(b.statementRetries, b.retryableErrorFunc)
+}
+
 // OpenTx opens underline sql transaction and return wrapped instance
 func (b *SQLAdapterBase[T]) openTx(ctx context.Context, sqlAdapter SQLAdapter) (*TxSQLAdapter, error) {
 	tx, err := b.dataSource.BeginTx(ctx, nil)
@@ -175,16 +282,16 @@ func (b *SQLAdapterBase[T]) openTx(ctx context.Context, sqlAdapter SQLAdapter) (
 		return nil, errorj.BeginTransactionError.Wrap(err, "failed to begin transaction")
 	}
 
-	return &TxSQLAdapter{sqlAdapter: sqlAdapter, tx: NewTxWrapper(b.Type(), tx, b.queryLogger, b.checkErrFunc)}, nil
+	return &TxSQLAdapter{sqlAdapter: sqlAdapter, tx: NewTxWrapper(b.Type(), tx, b.queryLogger, b.checkErrFunc).WithStatementTimeout(b.statementTimeout)}, nil
 }
 
 func (b *SQLAdapterBase[T]) txOrDb(ctx context.Context) TxOrDB {
 	txOrDb, ok := ctx.Value(ContextTransactionKey).(TxOrDB)
 	if !ok {
 		if b.dataSource == nil {
-			return NewDbWrapper(b.typeId, nil, b.queryLogger, b.checkErrFunc, false)
+			return NewDbWrapper(b.typeId, nil, b.queryLogger, b.checkErrFunc, false).WithStatementTimeout(b.statementTimeout).WithRetries(b.statementRetries, b.retryableErrorFunc)
 		} else {
-			return NewDbWrapper(b.typeId, b.dataSource, b.queryLogger, b.checkErrFunc, false)
+			return NewDbWrapper(b.typeId, b.dataSource, b.queryLogger, b.checkErrFunc, false).WithStatementTimeout(b.statementTimeout).WithRetries(b.statementRetries, b.retryableErrorFunc)
 		}
 	}
 	return txOrDb
@@ -194,6 +301,23 @@ func (b *SQLAdapterBase[T]) Select(ctx context.Context, tableName string, whenCo
 	return b.selectFrom(ctx, selectQueryTemplate, tableName, "*", whenConditions, orderBy)
 }
 func (b *SQLAdapterBase[T]) selectFrom(ctx context.Context, statement string, tableName string, selectExpression string, whenConditions *WhenConditions, orderBy []string) ([]map[string]any, error) {
+	var result []map[string]any
+	err := b.selectRows(ctx, statement, tableName, selectExpression, whenConditions, orderBy, func(row map[string]any) error {
+		result = append(result, row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ExportRows passes rows of the table matching whenConditions to consumer one by one without loading all of them to memory
+func (b *SQLAdapterBase[T]) ExportRows(ctx context.Context, tableName string, whenConditions *WhenConditions, consumer func(row map[string]any) error) error {
+	return b.selectRows(ctx, selectQueryTemplate, tableName, "*", whenConditions, nil, consumer)
+}
+
+func (b *SQLAdapterBase[T]) selectRows(ctx context.Context, statement string, tableName string, selectExpression string, whenConditions *WhenConditions, orderBy []string, consumer func(row map[string]any) error) error {
 	quotedTableName := b.tableHelper.quotedTableName(tableName)
 	whenCondition, values := b.ToWhenConditions(whenConditions, b.parameterPlaceholder, 0)
 	if whenCondition != "" {
@@ -224,7 +348,7 @@ func (b *SQLAdapterBase[T]) selectFrom(ctx context.Context, statement string, ta
 		rows, err = b.txOrDb(ctx).QueryContext(ctx, query, values...)
 	}
 	if err != nil {
-		return nil, errorj.SelectFromTableError.Wrap(err, "failed execute select").
+		return errorj.SelectFromTableError.Wrap(err, "failed execute select").
 			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
 				Table:     quotedTableName,
 				Statement: query,
@@ -233,21 +357,22 @@ func (b *SQLAdapterBase[T]) selectFrom(ctx context.Context, statement string, ta
 	}
 
 	defer rows.Close()
-	var result []map[string]any
 	for rows.Next() {
 		var row map[string]any
 		row, err = rowToMap(rows)
 		if err != nil {
 			break
 		}
-		result = append(result, row)
+		if err = consumer(row); err != nil {
+			break
+		}
 	}
 
 	if err == nil {
 		err = rows.Err()
 	}
 	if err != nil {
-		return nil, errorj.SelectFromTableError.Wrap(err, "failed read selected rows").
+		return errorj.SelectFromTableError.Wrap(err, "failed read selected rows").
 			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
 				Table:     quotedTableName,
 				Statement: query,
@@ -255,7 +380,7 @@ func (b *SQLAdapterBase[T]) selectFrom(ctx context.Context, statement string, ta
 			})
 	}
 
-	return result, nil
+	return nil
 }
 
 func (b *SQLAdapterBase[T]) Count(ctx context.Context, tableName string, whenConditions *WhenConditions) (int, error) {
@@ -270,6 +395,21 @@ func (b *SQLAdapterBase[T]) Count(ctx context.Context, tableName string, whenCon
 	return strconv.Atoi(fmt.Sprint(scnt))
 }
 
+func (b *SQLAdapterBase[T]) RunTransform(ctx context.Context, transformSQL string, rawTableName, cleanTableName string) (*bulker.WarehouseState, error) {
+	query, err := renderTransformSQL(transformSQL, b.quotedTableName(rawTableName), b.quotedTableName(cleanTableName))
+	if err != nil {
+		return nil, err
+	}
+	if _, err = b.txOrDb(ctx).ExecContext(ctx, query); err != nil {
+		return nil, errorj.TransformError.Wrap(err, "failed to run transform").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Table:     b.quotedTableName(cleanTableName),
+				Statement: query,
+			})
+	}
+	return nil, nil
+}
+
 func (b *SQLAdapterBase[T]) Delete(ctx context.Context, tableName string, deleteConditions *WhenConditions) error {
 	quotedTableName := b.quotedTableName(tableName)
 
@@ -289,7 +429,7 @@ func (b *SQLAdapterBase[T]) Delete(ctx context.Context, tableName string, delete
 }
 
 func (b *SQLAdapterBase[T]) Update(ctx context.Context, table *Table, object types2.Object, whenConditions *WhenConditions) error {
-	quotedTableName := b.quotedTableName(table.Name)
+	quotedTableName := b.quotedTable(table)
 
 	updateCondition, updateValues := b.ToWhenConditions(whenConditions, b.parameterPlaceholder, len(object))
 
@@ -373,6 +513,8 @@ type QueryPayload struct {
 	TableFrom      string
 	JoinConditions string
 	SourceColumns  string
+	// VersionColumn quoted version column. Merge templates update only rows with lower or equal version. See Table.VersionColumn
+	VersionColumn string
 }
 
 func (b *SQLAdapterBase[T]) insert(ctx context.Context, table *Table, objects []types2.Object) error {
@@ -381,7 +523,7 @@ func (b *SQLAdapterBase[T]) insert(ctx context.Context, table *Table, objects []
 
 // plainInsert inserts provided object into Snowflake
 func (b *SQLAdapterBase[T]) insertOrMerge(ctx context.Context, table *Table, objects []types2.Object, mergeQuery *template.Template) error {
-	quotedTableName := b.quotedTableName(table.Name)
+	quotedTableName := b.quotedTable(table)
 
 	columns := table.SortedColumnNames()
 	columnNames := make([]string, len(columns))
@@ -404,6 +546,9 @@ func (b *SQLAdapterBase[T]) insertOrMerge(ctx context.Context, table *Table, obj
 		PrimaryKeyName: table.PrimaryKeyName,
 		UpdateSet:      strings.Join(updateColumns, ","),
 	}
+	if mergeQuery != nil && table.VersionColumn != "" {
+		insertPayload.VersionColumn = b.quotedColumnName(table.VersionColumn)
+	}
 	buf := strings.Builder{}
 	template := insertQueryTemplate
 	if mergeQuery != nil {
@@ -444,8 +589,8 @@ func (b *SQLAdapterBase[T]) copy(ctx context.Context, targetTable *Table, source
 }
 
 func (b *SQLAdapterBase[T]) copyOrMerge(ctx context.Context, targetTable *Table, sourceTable *Table, mergeQuery *template.Template, sourceAlias string) error {
-	quotedTargetTableName := b.quotedTableName(targetTable.Name)
-	quotedSourceTableName := b.quotedTableName(sourceTable.Name)
+	quotedTargetTableName := b.quotedTable(targetTable)
+	quotedSourceTableName := b.quotedTable(sourceTable)
 
 	//insert from select
 	columns := sourceTable.SortedColumnNames()
@@ -474,6 +619,9 @@ func (b *SQLAdapterBase[T]) copyOrMerge(ctx context.Context, targetTable *Table,
 		SourceColumns:  strings.Join(insertColumns, ", "),
 		UpdateSet:      strings.Join(updateColumns, ","),
 	}
+	if mergeQuery != nil && sourceTable.VersionColumn != "" {
+		insertPayload.VersionColumn = b.quotedColumnName(sourceTable.VersionColumn)
+	}
 	buf := strings.Builder{}
 	queryTemplate := insertFromSelectQueryTemplate
 	if mergeQuery != nil {
@@ -497,19 +645,144 @@ func (b *SQLAdapterBase[T]) copyOrMerge(ctx context.Context, targetTable *Table,
 	return nil
 }
 
+// updateColumnsFrom updates columns of source table in target table rows matching source table rows by primary key.
+// qualifySet - whether updated columns must be qualified with target table alias (required by UPDATE ... JOIN syntax)
+func (b *SQLAdapterBase[T]) updateColumnsFrom(ctx context.Context, targetTable *Table, sourceTable *Table, updateQuery *template.Template, qualifySet bool) error {
+	quotedTargetTableName := b.quotedTable(targetTable)
+	if len(targetTable.PKFields) == 0 {
+		return errorj.BulkMergeError.New("primary key is required to update columns").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{Table: quotedTargetTableName})
+	}
+	var updateColumns, joinConditions []string
+	for _, name := range sourceTable.SortedColumnNames() {
+		if targetTable.PKFields.Contains(name) {
+			continue
+		}
+		if qualifySet {
+			updateColumns = append(updateColumns, fmt.Sprintf(`T.%s=S.%s`, b.quotedColumnName(name), b.quotedColumnName(name)))
+		} else {
+			updateColumns = append(updateColumns, fmt.Sprintf(`%s=S.%s`, b.quotedColumnName(name), b.quotedColumnName(name)))
+		}
+	}
+	if len(updateColumns) == 0 {
+		return errorj.BulkMergeError.New("no columns to update besides primary key").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{Table: quotedTargetTableName, PrimaryKeys: targetTable.GetPKFields()})
+	}
+	for _, pkField := range targetTable.GetPKFields() {
+		joinConditions = append(joinConditions, fmt.Sprintf("T.%s = S.%s", b.quotedColumnName(pkField), b.quotedColumnName(pkField)))
+	}
+	buf := strings.Builder{}
+	err := updateQuery.Execute(&buf, QueryPayload{
+		TableTo:        quotedTargetTableName,
+		TableFrom:      b.quotedTable(sourceTable),
+		JoinConditions: strings.Join(joinConditions, " AND "),
+		UpdateSet:      strings.Join(updateColumns, ","),
+	})
+	if err != nil {
+		return errorj.BulkMergeError.Wrap(err, "failed to build query from template")
+	}
+	statement := buf.String()
+	if _, err := b.txOrDb(ctx).ExecContext(ctx, statement); err != nil {
+		return errorj.BulkMergeError.Wrap(err, "failed to update columns").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Table:       quotedTargetTableName,
+				PrimaryKeys: targetTable.GetPKFields(),
+				Statement:   statement,
+			})
+	}
+	return nil
+}
+
+// deleteByKeysFrom deletes rows of target table matching rows of source table by key columns
+func (b *SQLAdapterBase[T]) deleteByKeysFrom(ctx context.Context, targetTable *Table, sourceTable *Table, keyColumns []string) error {
+	quotedTargetTableName := b.quotedTable(targetTable)
+	if len(keyColumns) == 0 {
+		return errorj.DeleteFromTableError.New("primary key is required to delete rows by keys").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{Table: quotedTargetTableName})
+	}
+	//target table has no alias: not all databases support aliases in DELETE statement
+	joinConditions := make([]string, len(keyColumns))
+	for i, keyColumn := range keyColumns {
+		joinConditions[i] = fmt.Sprintf("%s.%s = S.%s", quotedTargetTableName, b.quotedColumnName(keyColumn), b.quotedColumnName(keyColumn))
+	}
+	buf := strings.Builder{}
+	err := deleteByKeysQueryTemplate.Execute(&buf, QueryPayload{
+		TableTo:        quotedTargetTableName,
+		TableFrom:      b.quotedTable(sourceTable),
+		JoinConditions: strings.Join(joinConditions, " AND "),
+	})
+	if err != nil {
+		return errorj.DeleteFromTableError.Wrap(err, "failed to build query from template")
+	}
+	statement := buf.String()
+	if _, err := b.txOrDb(ctx).ExecContext(ctx, statement); err != nil {
+		return errorj.DeleteFromTableError.Wrap(err, "failed to delete rows by keys").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Table:       quotedTargetTableName,
+				PrimaryKeys: keyColumns,
+				Statement:   statement,
+			})
+	}
+	return nil
+}
+
+// closeVersionsFrom closes current versions of target table rows matching source table rows by key columns:
+// sets valid_to to valid_from of source row and is_current to false. See SCD2Stream.
+// qualifySet - whether updated columns must be qualified with target table alias (required by UPDATE ... JOIN syntax)
+func (b *SQLAdapterBase[T]) closeVersionsFrom(ctx context.Context, targetTable *Table, sourceTable *Table, keyColumns []string, updateQuery *template.Template, qualifySet bool) error {
+	quotedTargetTableName := b.quotedTable(targetTable)
+	if len(keyColumns) == 0 {
+		return errorj.BulkMergeError.New("primary key is required to close versions of rows").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{Table: quotedTargetTableName})
+	}
+	validFrom := b.quotedColumnName(SCD2ValidFromColumn)
+	validTo := b.quotedColumnName(SCD2ValidToColumn)
+	isCurrent := b.quotedColumnName(SCD2IsCurrentColumn)
+	updateSet := fmt.Sprintf(`%s=S.%s,%s=false`, validTo, validFrom, isCurrent)
+	if qualifySet {
+		updateSet = fmt.Sprintf(`T.%s=S.%s,T.%s=false`, validTo, validFrom, isCurrent)
+	}
+	joinConditions := make([]string, 0, len(keyColumns)+1)
+	for _, keyColumn := range keyColumns {
+		joinConditions = append(joinConditions, fmt.Sprintf("T.%s = S.%s", b.quotedColumnName(keyColumn), b.quotedColumnName(keyColumn)))
+	}
+	joinConditions = append(joinConditions, fmt.Sprintf("T.%s = true", isCurrent))
+	buf := strings.Builder{}
+	err := updateQuery.Execute(&buf, QueryPayload{
+		TableTo:        quotedTargetTableName,
+		TableFrom:      b.quotedTable(sourceTable),
+		JoinConditions: strings.Join(joinConditions, " AND "),
+		UpdateSet:      updateSet,
+	})
+	if err != nil {
+		return errorj.BulkMergeError.Wrap(err, "failed to build query from template")
+	}
+	statement := buf.String()
+	if _, err := b.txOrDb(ctx).ExecContext(ctx, statement); err != nil {
+		return errorj.BulkMergeError.Wrap(err, "failed to close versions of rows").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Table:       quotedTargetTableName,
+				PrimaryKeys: keyColumns,
+				Statement:   statement,
+			})
+	}
+	return nil
+}
+
 // CreateTable create table columns and pk key
 // override input table sql type with configured cast type
 // make fields from Table PkFields - 'not null'
 func (b *SQLAdapterBase[T]) CreateTable(ctx context.Context, schemaToCreate *Table) error {
-	quotedTableName := b.quotedTableName(schemaToCreate.Name)
+	quotedTableName := b.quotedTable(schemaToCreate)
 
-	columns := schemaToCreate.SortedColumnNames()
+	columns := schemaToCreate.CreateColumnNames()
 	columnsDDL := make([]string, len(columns))
 	for i, columnName := range columns {
 		columnsDDL[i] = b.columnDDL(columnName, schemaToCreate)
 	}
 	temporary := ""
-	if b.temporaryTables && schemaToCreate.Temporary {
+	//postgres-like databases don't allow temporary tables in other schema, so staging tables are regular ones
+	if b.temporaryTables && schemaToCreate.Temporary && schemaToCreate.Namespace == "" {
 		temporary = "TEMPORARY"
 	}
 
@@ -528,13 +801,17 @@ func (b *SQLAdapterBase[T]) CreateTable(ctx context.Context, schemaToCreate *Tab
 		return err
 	}
 
-	return nil
+	if err := b.createConstraints(ctx, schemaToCreate); err != nil {
+		return err
+	}
+
+	return b.createComments(ctx, schemaToCreate)
 }
 
 // PatchTableSchema alter table with columns (if not empty)
 // recreate primary key (if not empty) or delete primary key if Table.DeletePkFields is true
 func (b *SQLAdapterBase[T]) PatchTableSchema(ctx context.Context, patchTable *Table) error {
-	quotedTableName := b.quotedTableName(patchTable.Name)
+	quotedTableName := b.quotedTable(patchTable)
 
 	columns := patchTable.SortedColumnNames()
 
@@ -569,7 +846,13 @@ func (b *SQLAdapterBase[T]) PatchTableSchema(ctx context.Context, patchTable *Ta
 		}
 	}
 
-	return nil
+	//patch indexes and not null constraints
+	if err := b.createConstraints(ctx, patchTable); err != nil {
+		return err
+	}
+
+	//descriptions of added columns
+	return b.createComments(ctx, patchTable)
 }
 
 // createPrimaryKey create primary key constraint
@@ -578,7 +861,7 @@ func (b *SQLAdapterBase[T]) createPrimaryKey(ctx context.Context, table *Table)
 		return nil
 	}
 
-	quotedTableName := b.quotedTableName(table.Name)
+	quotedTableName := b.quotedTable(table)
 
 	columnNames := make([]string, len(table.PKFields))
 	for i, column := range table.GetPKFields() {
@@ -602,7 +885,7 @@ func (b *SQLAdapterBase[T]) createPrimaryKey(ctx context.Context, table *Table)
 
 // delete primary key
 func (b *SQLAdapterBase[T]) deletePrimaryKey(ctx context.Context, table *Table) error {
-	quotedTableName := b.quotedTableName(table.Name)
+	quotedTableName := b.quotedTable(table)
 
 	query := fmt.Sprintf(dropPrimaryKeyTemplate, quotedTableName, table.PrimaryKeyName)
 
@@ -665,6 +948,11 @@ func (b *SQLAdapterBase[T]) quotedTableName(tableName string) string {
 	return b.tableHelper.quotedTableName(tableName)
 }
 
+// quotedTable returns quoted name of the table qualified with its namespace if it is set. See StagingSchemaOption
+func (b *SQLAdapterBase[T]) quotedTable(table *Table) string {
+	return b.tableHelper.quotedTable(table)
+}
+
 // quotedColumnName adapts column name to sql identifier rules of database and quotes accordingly (if needed)
 func (b *SQLAdapterBase[T]) quotedColumnName(columnName string) string {
 	return b.tableHelper.quotedColumnName(columnName)
@@ -692,13 +980,12 @@ func (b *SQLAdapterBase[T]) ToWhenConditions(conditions *WhenConditions, paramEx
 	var queryConditions []string
 	var values []any
 
-	for i, condition := range conditions.Conditions {
+	for _, condition := range conditions.Conditions {
 		switch strings.ToLower(condition.Clause) {
-		case "is null":
-		case "is not null":
+		case "is null", "is not null":
 			queryConditions = append(queryConditions, b.quotedColumnName(condition.Field)+" "+condition.Clause)
 		default:
-			queryConditions = append(queryConditions, b.quotedColumnName(condition.Field)+" "+condition.Clause+" "+paramExpression(i+valuesShift+1, condition.Field))
+			queryConditions = append(queryConditions, b.quotedColumnName(condition.Field)+" "+condition.Clause+" "+paramExpression(len(values)+valuesShift+1, condition.Field))
 			values = append(values, types2.ReformatValue(condition.Value))
 		}
 	}
@@ -728,8 +1015,12 @@ func (b *SQLAdapterBase[T]) GetAvroType(sqlType string) (any, bool) {
 }
 
 func (b *SQLAdapterBase[T]) GetAvroSchema(table *Table) *types2.AvroSchema {
-	// not really an avro schema in a base driver
-	return nil
+	// not really an avro schema in a base driver: only data types of columns are provided for marshallers that need them (e.g. Arrow)
+	dataTypes := make(map[string]types2.DataType, len(table.Columns))
+	for name, column := range table.Columns {
+		dataTypes[name] = column.DataType
+	}
+	return &types2.AvroSchema{DataTypes: dataTypes}
 }
 
 func match(target, pattern string) bool {
@@ -0,0 +1,144 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jitsucom/bulker/jitsubase/appbase"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIsRetryableLoadError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"context_canceled", context.Canceled, false},
+		{"pq_serialization_failure", &pq.Error{Code: "40001"}, true},
+		{"pq_deadlock", fmt.Errorf("failed to load: %w", &pq.Error{Code: "40P01"}), true},
+		{"pq_invalid_input_syntax", &pq.Error{Code: "22P02"}, false},
+		{"pq_unique_violation", &pq.Error{Code: "23505"}, false},
+		{"checked_pq_deadlock", checkErr(&pq.Error{Code: "40P01", Message: "deadlock detected"}), true},
+		{"checked_pq_not_null_violation", checkErr(&pq.Error{Code: "23502", Message: "null value in column"}), false},
+		{"mysql_deadlock", &mysql.MySQLError{Number: 1213}, true},
+		{"mysql_lock_wait_timeout", &mysql.MySQLError{Number: 1205}, true},
+		{"mysql_data_too_long", &mysql.MySQLError{Number: 1406}, false},
+		{"plain_error", errors.New("column \"a\" is of type integer but expression is of type text"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, isRetryableLoadError(tt.err))
+		})
+	}
+}
+
+func TestTxCapabilities(t *testing.T) {
+	atomic := &TxSQLAdapter{sqlAdapter: &Postgres{}, tx: &TxWrapper{tx: &sql.Tx{}}}
+	require.Equal(t, TxCapabilities{Semantics: TxSemanticsAtomic, Savepoints: true}, atomic.Capabilities())
+	atomic.trackModified("events", nil)
+	require.Zero(t, atomic.modifiedTables.Size())
+
+	emulated := &TxSQLAdapter{sqlAdapter: &BigQuery{}, tx: NewDummyTxWrapper(BigqueryBulkerTypeId)}
+	require.Equal(t, TxCapabilities{Semantics: TxSemanticsEmulated}, emulated.Capabilities())
+	emulated.trackCreated("events_tmp", nil)
+	emulated.trackModified("events_tmp", nil)
+	emulated.trackModified("users", errors.New("failed"))
+	require.NoError(t, emulated.Rollback())
+
+	emulated.trackModified("events", nil)
+	err := emulated.Rollback()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "changes of tables events were already applied")
+}
+
+func TestToWhenConditions(t *testing.T) {
+	pg := &SQLAdapterBase[PostgresConfig]{tableHelper: NewTableHelper(63, '"')}
+	tests := []struct {
+		name           string
+		conditions     *WhenConditions
+		valuesShift    int
+		expectedQuery  string
+		expectedValues []any
+	}{
+		{"nil", nil, 0, "", []any{}},
+		{"values", NewWhenConditions("id", "=", 1).Add("name", "!=", "a"), 0, `"id" = $1 AND "name" != $2`, []any{1, "a"}},
+		{"null first", NewWhenConditions("deleted_at", "IS NULL", nil).Add("id", "=", 1), 0, `"deleted_at" IS NULL AND "id" = $1`, []any{1}},
+		{"null between values", NewWhenConditions("id", ">", 1).Add("deleted_at", "IS NOT NULL", nil).Add("name", "=", "a"), 0,
+			`"id" > $1 AND "deleted_at" IS NOT NULL AND "name" = $2`, []any{1, "a"}},
+		{"shift", NewWhenConditions("deleted_at", "is null", nil).Add("id", "=", 1), 2, `"deleted_at" is null AND "id" = $3`, []any{1}},
+		{"or", &WhenConditions{JoinCondition: "OR", Conditions: []WhenCondition{{Field: "id", Clause: "=", Value: 1}, {Field: "id", Clause: "=", Value: 2}}}, 0,
+			`"id" = $1 OR "id" = $2`, []any{1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, values := pg.ToWhenConditions(tt.conditions, IndexParameterPlaceholder, tt.valuesShift)
+			require.Equal(t, tt.expectedQuery, query)
+			require.Equal(t, tt.expectedValues, values)
+		})
+	}
+}
+
+// poolTestConnector counts opened connections
+type poolTestConnector struct {
+	opened atomic.Int32
+}
+
+func (c *poolTestConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	c.opened.Add(1)
+	return poolTestConn{}, nil
+}
+
+func (c *poolTestConnector) Driver() driver.Driver {
+	return nil
+}
+
+type poolTestConn struct {
+	driver.Conn
+}
+
+func (c poolTestConn) Close() error {
+	return nil
+}
+
+func TestConnectionPool(t *testing.T) {
+	reqr := require.New(t)
+	ctx := context.Background()
+	connector := &poolTestConnector{}
+	adapter := &SQLAdapterBase[PostgresConfig]{Service: appbase.NewServiceBase("pool_test"), config: &PostgresConfig{},
+		dbConnectFunction: func(config *PostgresConfig) (*sql.DB, error) {
+			return sql.OpenDB(connector), nil
+		}}
+	adapter.setConnMaxLifetime(100 * time.Millisecond)
+	//pool is opened lazily on the first ping
+	reqr.NoError(adapter.Ping(ctx))
+	t.Cleanup(func() { _ = adapter.dataSource.Close() })
+	reqr.Equal(int32(0), connector.opened.Load())
+	reqr.NoError(adapter.Ping(ctx))
+	reqr.Equal(int32(1), connector.opened.Load())
+
+	//idle connection is reused while adapter is in use
+	reqr.NoError(adapter.Ping(ctx))
+	reqr.Equal(int32(1), connector.opened.Load())
+
+	//connection older than connMaxLifetime is reopened
+	time.Sleep(200 * time.Millisecond)
+	reqr.NoError(adapter.Ping(ctx))
+	reqr.Equal(int32(2), connector.opened.Load())
+
+	//idle connections of adapter unused for longer than staleConnectionTimeout are dropped
+	adapter.setConnMaxLifetime(time.Hour)
+	reqr.NoError(adapter.Ping(ctx))
+	reqr.Equal(int32(2), connector.opened.Load())
+	adapter.lastPing.Store(time.Now().Add(-staleConnectionTimeout - time.Second).UnixNano())
+	reqr.NoError(adapter.Ping(ctx))
+	reqr.Equal(int32(3), connector.opened.Load())
+}
@@ -0,0 +1,39 @@
+package sql
+
+import (
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+)
+
+// StagingSchemaOption - schema (or database) where tmp tables of batches are created instead of destination schema,
+// e.g. staging schema with relaxed permissions. Rows are copied to destination table with cross-schema statements.
+// Snowflake schema may be qualified with database: STAGING_DB.PUBLIC. Schema must exist
+var StagingSchemaOption = bulker.ImplementationOption[string]{
+	Key:       "stagingSchema",
+	ParseFunc: utils.ParseString,
+}
+
+// WithStagingSchema creates tmp tables of stream in provided schema. See StagingSchemaOption
+func WithStagingSchema(schema string) bulker.StreamOption {
+	return bulker.WithOption(&StagingSchemaOption, schema)
+}
+
+// StagingSchemaSupport optional interface for SQLAdapter that can load tmp tables in other schema and copy them to destination table
+type StagingSchemaSupport interface {
+	SupportsStagingSchema() bool
+}
+
+// validateStagingSchemaOption checks that stream and adapter support staging schema
+func validateStagingSchemaOption(p SQLAdapter, mode bulker.BulkMode, stagingSchema string) error {
+	if stagingSchema == "" {
+		return nil
+	}
+	if mode != bulker.Batch && mode != bulker.CDC {
+		return fmt.Errorf("stagingSchema option is supported only in %s and %s modes", bulker.Batch, bulker.CDC)
+	}
+	if ss, ok := p.(StagingSchemaSupport); !ok || !ss.SupportsStagingSchema() {
+		return fmt.Errorf("%s doesn't support stagingSchema option", p.Type())
+	}
+	return nil
+}
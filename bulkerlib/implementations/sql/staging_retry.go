@@ -0,0 +1,127 @@
+package sql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/jitsubase/logging"
+	"os"
+	"time"
+)
+
+var (
+	defaultStagingRetryConfig = StagingRetryConfig{UploadRetries: 2, LoadRetries: loadTableSavepointRetries, BackoffMs: 1000, MaxBackoffMs: 30000}
+
+	// StagingRetriesOption - retries of upload of built batch file to the stage (S3, Azure Blob) and of loading it to the destination table.
+	// Only these phases are retried while batch file is still on disk, so transient failures don't fail the whole batch:
+	// {"uploadRetries": 2, "loadRetries": 1, "backoffMs": 1000, "maxBackoffMs": 30000}
+	StagingRetriesOption = bulker.ImplementationOption[*StagingRetryConfig]{
+		Key:          "stagingRetries",
+		DefaultValue: &defaultStagingRetryConfig,
+		ParseFunc:    parseStagingRetryConfig,
+	}
+)
+
+// StagingRetryConfig retries of upload and load phases of batch file. See StagingRetriesOption
+type StagingRetryConfig struct {
+	// UploadRetries number of retries of failed upload of batch file to the stage
+	UploadRetries int `mapstructure:"uploadRetries" json:"uploadRetries" yaml:"uploadRetries"`
+	// LoadRetries number of retries of LoadTable failed with transient error (see isRetryableLoadError).
+	// Applies only to destinations that support savepoints: failed statement aborts transaction of others
+	LoadRetries int `mapstructure:"loadRetries" json:"loadRetries" yaml:"loadRetries"`
+	// BackoffMs delay before the first retry. Delay is doubled with every next attempt
+	BackoffMs int `mapstructure:"backoffMs" json:"backoffMs" yaml:"backoffMs"`
+	// MaxBackoffMs maximum delay between attempts
+	MaxBackoffMs int `mapstructure:"maxBackoffMs" json:"maxBackoffMs" yaml:"maxBackoffMs"`
+}
+
+// Validate returns err if invalid
+func (c *StagingRetryConfig) Validate() error {
+	if c.UploadRetries < 0 || c.LoadRetries < 0 || c.BackoffMs < 0 || c.MaxBackoffMs < 0 {
+		return fmt.Errorf("stagingRetries parameters must not be negative")
+	}
+	return nil
+}
+
+// backoff returns delay before retry after failed attempt (0-based)
+func (c *StagingRetryConfig) backoff(attempt int) time.Duration {
+	delay := time.Duration(c.BackoffMs) * time.Millisecond
+	maxDelay := time.Duration(c.MaxBackoffMs) * time.Millisecond
+	for i := 0; i < attempt && (maxDelay == 0 || delay < maxDelay); i++ {
+		delay *= 2
+	}
+	if maxDelay > 0 && delay > maxDelay {
+		return maxDelay
+	}
+	return delay
+}
+
+func parseStagingRetryConfig(serialized any) (*StagingRetryConfig, error) {
+	var raw []byte
+	switch v := serialized.(type) {
+	case *StagingRetryConfig:
+		return v, v.Validate()
+	case string:
+		raw = []byte(v)
+	default:
+		var err error
+		raw, err = json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value type of stagingRetries option: %T", v)
+		}
+	}
+	// parameters that are not provided keep default values
+	config := defaultStagingRetryConfig
+	if err := json.Unmarshal(raw, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse stagingRetries config: %v", err)
+	}
+	return &config, config.Validate()
+}
+
+// WithStagingRetries sets retries of upload and load phases of batch file
+func WithStagingRetries(config StagingRetryConfig) bulker.StreamOption {
+	return bulker.WithOption(&StagingRetriesOption, &config)
+}
+
+// sleepBackoff waits for delay or until context is done
+func sleepBackoff(ctx context.Context, delay time.Duration) error {
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// uploadWithRetries uploads local file to the stage. Failed upload is retried with backoff
+func (ps *AbstractTransactionalSQLStream) uploadWithRetries(ctx context.Context, stage batchFileStage, localFileName, stageFileName string) error {
+	retryConfig := StagingRetriesOption.Get(&ps.options)
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = uploadFile(stage, localFileName, stageFileName)
+		if err == nil || attempt >= retryConfig.UploadRetries || errors.Is(err, context.Canceled) {
+			return err
+		}
+		delay := retryConfig.backoff(attempt)
+		logging.Warnf("[%s] upload attempt #%d failed, retrying in %s: %v", ps.id, attempt+1, delay, err)
+		if sleepErr := sleepBackoff(ctx, delay); sleepErr != nil {
+			return err
+		}
+	}
+}
+
+func uploadFile(stage batchFileStage, localFileName, stageFileName string) error {
+	rFile, err := os.Open(localFileName)
+	if err != nil {
+		return err
+	}
+	defer rFile.Close()
+	return stage.Upload(stageFileName, rFile)
+}
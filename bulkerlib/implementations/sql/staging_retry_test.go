@@ -0,0 +1,81 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/stretchr/testify/require"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+type flakyStage struct {
+	failures int
+	uploads  int
+	content  []byte
+}
+
+func (s *flakyStage) Upload(_ string, fileReader io.ReadSeeker) error {
+	s.uploads++
+	if s.uploads <= s.failures {
+		return errors.New("connection reset by peer")
+	}
+	var err error
+	s.content, err = io.ReadAll(fileReader)
+	return err
+}
+
+func (s *flakyStage) DeleteObject(string) error {
+	return nil
+}
+
+func TestStagingRetryConfig(t *testing.T) {
+	config, err := parseStagingRetryConfig(`{"uploadRetries": 5, "backoffMs": 100, "maxBackoffMs": 500}`)
+	require.NoError(t, err)
+	require.Equal(t, StagingRetryConfig{UploadRetries: 5, LoadRetries: loadTableSavepointRetries, BackoffMs: 100, MaxBackoffMs: 500}, *config)
+	require.Equal(t, 100*time.Millisecond, config.backoff(0))
+	require.Equal(t, 400*time.Millisecond, config.backoff(2))
+	require.Equal(t, 500*time.Millisecond, config.backoff(10))
+
+	_, err = parseStagingRetryConfig(map[string]any{"uploadRetries": -1})
+	require.Error(t, err)
+}
+
+func TestUploadWithRetries(t *testing.T) {
+	file, err := os.CreateTemp("", "staging_retry_test")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	_, err = file.WriteString(`{"id":1}`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	tests := []struct {
+		name     string
+		failures int
+		retries  int
+		wantErr  bool
+	}{
+		{"no_failures", 0, 2, false},
+		{"recovered", 2, 2, false},
+		{"exhausted", 3, 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := bulker.StreamOptions{}
+			options.Add(WithStagingRetries(StagingRetryConfig{UploadRetries: tt.retries, BackoffMs: 1}))
+			ps := &AbstractTransactionalSQLStream{AbstractSQLStream: &AbstractSQLStream{id: tt.name, options: options}}
+			stage := &flakyStage{failures: tt.failures}
+			err := ps.uploadWithRetries(context.Background(), stage, file.Name(), "batch.ndjson")
+			if tt.wantErr {
+				require.Error(t, err)
+				require.Equal(t, tt.retries+1, stage.uploads)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.failures+1, stage.uploads)
+			require.Equal(t, `{"id":1}`, string(stage.content))
+		})
+	}
+}
@@ -0,0 +1,346 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	types2 "github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/errorj"
+	"github.com/jitsucom/bulker/jitsubase/logging"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+func init() {
+	bulker.RegisterBulker(StarRocksBulkerTypeId, NewStarRocks)
+	bulker.RegisterConfigType(StarRocksBulkerTypeId, StarRocksConfig{})
+}
+
+const (
+	StarRocksBulkerTypeId = "starrocks"
+
+	starRocksDefaultPort     = 9030
+	starRocksDefaultHttpPort = 8030
+
+	starRocksCreateTableTemplate = `CREATE TABLE %s (%s)%s`
+	starRocksSwapTableTemplate   = `ALTER TABLE %s SWAP WITH %s`
+	starRocksRenameTableTemplate = `ALTER TABLE %s RENAME %s`
+)
+
+var (
+	starRocksTypes = map[types2.DataType][]string{
+		types2.STRING:    {"string", "varchar(65533)", "varchar"},
+		types2.INT64:     {"bigint", "bigint(20)"},
+		types2.FLOAT64:   {"double"},
+		types2.TIMESTAMP: {"datetime"},
+		types2.BOOL:      {"boolean", "tinyint(1)"},
+		types2.JSON:      {"json"},
+		types2.UNKNOWN:   {"string"},
+	}
+
+	// starRocksPrimaryKeyTypesMapping primary key columns can't be of STRING type
+	starRocksPrimaryKeyTypesMapping = map[string]string{
+		"string": "varchar(128)",
+	}
+
+	starRocksPartitionGranularities = utils.NewSet("hour", "day", "week", "month", "year")
+)
+
+// StarRocksConfig dto for deserialized StarRocks config
+type StarRocksConfig struct {
+	DataSourceConfig `mapstructure:",squash"`
+	// HttpPort FE HTTP port used for Stream Load. Default: 8030
+	HttpPort int `mapstructure:"httpPort,omitempty" json:"httpPort,omitempty" yaml:"httpPort,omitempty"`
+	// HttpsEnabled use https for Stream Load requests
+	HttpsEnabled bool `mapstructure:"httpsEnabled,omitempty" json:"httpsEnabled,omitempty" yaml:"httpsEnabled,omitempty"`
+	// PartitionGranularity partitions tables by timestamp column: hour, day, week, month or year. Empty - no partitioning.
+	// Partition column must be part of the primary key, so tables with primary key not including timestamp column aren't partitioned
+	PartitionGranularity string `mapstructure:"partitionGranularity,omitempty" json:"partitionGranularity,omitempty" yaml:"partitionGranularity,omitempty"`
+	// Buckets number of buckets of table. 0 - determined by StarRocks
+	Buckets int `mapstructure:"buckets,omitempty" json:"buckets,omitempty" yaml:"buckets,omitempty"`
+	// ReplicationNum number of tablet replicas. 0 - StarRocks default
+	ReplicationNum int `mapstructure:"replicationNum,omitempty" json:"replicationNum,omitempty" yaml:"replicationNum,omitempty"`
+}
+
+// Validate required fields in StarRocksConfig
+func (sc *StarRocksConfig) Validate() error {
+	if err := sc.DataSourceConfig.Validate(); err != nil {
+		return err
+	}
+	if sc.PartitionGranularity != "" && !starRocksPartitionGranularities.Contains(sc.PartitionGranularity) {
+		return fmt.Errorf("unsupported partitionGranularity '%s'. Supported: hour, day, week, month, year", sc.PartitionGranularity)
+	}
+	if sc.Buckets < 0 || sc.ReplicationNum < 0 {
+		return errors.New("buckets and replicationNum must not be negative")
+	}
+	return nil
+}
+
+// StarRocks is adapter for StarRocks. It uses MySQL protocol for queries with following differences:
+//
+// - batches are loaded with Stream Load: batch file is sent with chunked HTTP request to FE;
+//
+// - tables with primary key are created with Primary Key model. Inserts to such tables replace rows with the same key,
+// so merge doesn't require special statements. Primary key of existing table can't be changed;
+//
+// - StarRocks doesn't support transactions spanning DDL and loads: statements of stream are executed one by one
+// and tmp tables are regular tables dropped after use.
+type StarRocks struct {
+	*MySQL
+	starRocksConfig *StarRocksConfig
+	streamLoader    *streamLoader
+}
+
+// NewStarRocks returns configured StarRocks bulker.Bulker instance
+func NewStarRocks(bulkerConfig bulker.Config) (bulker.Bulker, error) {
+	config := &StarRocksConfig{}
+	if err := utils.ParseObject(bulkerConfig.DestinationConfig, config); err != nil {
+		return nil, fmt.Errorf("failed to parse destination config: %v", err)
+	}
+	if config.Port == 0 {
+		config.Port = starRocksDefaultPort
+	}
+	if config.HttpPort == 0 {
+		config.HttpPort = starRocksDefaultHttpPort
+	}
+	config.PartitionGranularity = strings.ToLower(config.PartitionGranularity)
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if config.Parameters == nil {
+		config.Parameters = map[string]string{}
+	}
+	utils.MapPutIfAbsent(config.Parameters, "timeout", "60s")
+	utils.MapPutIfAbsent(config.Parameters, "writeTimeout", "60s")
+	utils.MapPutIfAbsent(config.Parameters, "readTimeout", "60s")
+	// older StarRocks versions don't support server side prepared statements
+	utils.MapPutIfAbsent(config.Parameters, "interpolateParams", "true")
+	tlsConfig, err := mySQLTLSConfig(bulkerConfig.Id, &config.DataSourceConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	dbConnectFunction := func(cfg *DataSourceConfig) (*sql.DB, error) {
+		dataSource, err := sql.Open("mysql", mySQLDriverConnectionString(cfg))
+		if err != nil {
+			return nil, err
+		}
+		if err := dataSource.Ping(); err != nil {
+			_ = dataSource.Close()
+			return nil, err
+		}
+		dataSource.SetConnMaxLifetime(3 * time.Minute)
+		dataSource.SetMaxIdleConns(10)
+		return dataSource, nil
+	}
+	typecastFunc := func(placeholder string, column types2.SQLColumn) string {
+		return placeholder
+	}
+	var queryLogger *logging.QueryLogger
+	if bulkerConfig.LogLevel == bulker.Verbose {
+		queryLogger = logging.NewQueryLogger(bulkerConfig.Id, os.Stderr, os.Stderr)
+	}
+	sqlAdapterBase, err := newSQLAdapterBase(bulkerConfig.Id, StarRocksBulkerTypeId, &config.DataSourceConfig, dbConnectFunction, starRocksTypes, queryLogger, typecastFunc, QuestionMarkParameterPlaceholder, starRocksColumnDDL, mySQLMapColumnValue, checkErr)
+	s := &StarRocks{
+		MySQL:           &MySQL{SQLAdapterBase: sqlAdapterBase},
+		starRocksConfig: config,
+		streamLoader:    newStreamLoader(config.Host, config.HttpPort, config.HttpsEnabled, tlsConfig, config.Username, config.Password),
+	}
+	s.batchFileFormat = types2.FileFormatNDJSON
+	s.temporaryTables = false
+	s.statementTimeout = time.Duration(bulkerConfig.StatementTimeoutSec) * time.Second
+	s.setConnMaxLifetime(time.Duration(bulkerConfig.ConnMaxLifetimeSec) * time.Second)
+	s.tableHelper = NewTableHelper(63, '`')
+	return s, err
+}
+
+func (s *StarRocks) CreateStream(id, tableName string, mode bulker.BulkMode, streamOptions ...bulker.StreamOption) (bulker.BulkerStream, error) {
+	streamOptions = append(streamOptions, withLocalBatchFile(fmt.Sprintf("bulker_%s", utils.SanitizeString(id))))
+	if err := s.validateOptions(streamOptions); err != nil {
+		return nil, err
+	}
+	switch mode {
+	case bulker.Stream:
+		return newAutoCommitStream(id, s, tableName, streamOptions...)
+	case bulker.Batch:
+		return newTransactionalStream(id, s, tableName, streamOptions...)
+	case bulker.ReplaceTable:
+		return newReplaceTableStream(id, s, tableName, streamOptions...)
+	case bulker.ReplacePartition:
+		return newReplacePartitionStream(id, s, tableName, streamOptions...)
+	}
+	return nil, fmt.Errorf("unsupported bulk mode: %s", mode)
+}
+
+// SupportsSavepoints StarRocks has no transactions that span multiple statements
+func (s *StarRocks) SupportsSavepoints() bool {
+	return false
+}
+
+// OpenTx returns TxSQLAdapter that executes statements without transaction
+func (s *StarRocks) OpenTx(ctx context.Context) (*TxSQLAdapter, error) {
+	return &TxSQLAdapter{sqlAdapter: s, tx: NewDbWrapper(s.Type(), s.dataSource, s.queryLogger, s.checkErrFunc, false).WithStatementTimeout(s.statementTimeout)}, nil
+}
+
+// Insert inserts objects. Primary Key model tables replace rows with the same key, so merge is the same as insert
+func (s *StarRocks) Insert(ctx context.Context, table *Table, merge bool, objects ...types2.Object) error {
+	return s.insert(ctx, table, objects)
+}
+
+// CopyTables copies data from sourceTable. Primary Key model tables replace rows with the same key, so merge is the same as copy
+func (s *StarRocks) CopyTables(ctx context.Context, targetTable *Table, sourceTable *Table, mergeWindow int) (*bulker.WarehouseState, error) {
+	return nil, s.copy(ctx, targetTable, sourceTable)
+}
+
+// LoadTable loads batch file to the table with Stream Load
+func (s *StarRocks) LoadTable(ctx context.Context, targetTable *Table, loadSource *LoadSource) (state *bulker.WarehouseState, err error) {
+	if loadSource.Type != LocalFile {
+		return nil, fmt.Errorf("LoadTable: only local file is supported")
+	}
+	tableName := s.TableName(targetTable.Name)
+	var headers map[string]string
+	switch loadSource.Format {
+	case types2.FileFormatNDJSON, types2.FileFormatNDJSONFLAT:
+		headers = map[string]string{"format": "json", "ignore_json_size": "true"}
+	case types2.FileFormatCSV:
+		headers = map[string]string{"format": "csv", "column_separator": ",", "enclose": `"`, "skip_header": "1",
+			"columns": strings.Join(targetTable.SortedColumnNames(), ",")}
+	default:
+		return nil, fmt.Errorf("LoadTable: %s format is not supported", loadSource.Format)
+	}
+	ctx, cancel := statementContext(ctx, s.statementTimeout)
+	defer cancel()
+	loadResponse, err := s.streamLoader.load(ctx, s.config.Db, tableName, loadSource.Path, headers)
+	if err != nil {
+		loadError := errorj.LoadError
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && s.statementTimeout > 0 {
+			loadError = errorj.StatementTimeoutError
+		}
+		return nil, loadError.Wrap(err, "failed to load table with Stream Load").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Database:  s.config.Db,
+				Table:     tableName,
+				Statement: s.streamLoader.URL(s.config.Db, tableName),
+			})
+	}
+	return &bulker.WarehouseState{
+		BytesProcessed: loadResponse.LoadBytes,
+		AdditionalInfo: map[string]any{"streamLoadLabel": loadResponse.Label, "loadTimeMs": loadResponse.LoadTimeMs},
+	}, nil
+}
+
+// CreateTable creates table. Primary Key model is used for tables with primary key, Duplicate Key model otherwise
+func (s *StarRocks) CreateTable(ctx context.Context, schemaToCreate *Table) error {
+	quotedTableName := s.quotedTableName(schemaToCreate.Name)
+	// key columns must be the first columns of table in the same order as in key definition
+	columns := schemaToCreate.CreateColumnNames()
+	columnsDDL := make([]string, len(columns))
+	for i, columnName := range columns {
+		columnsDDL[i] = s.columnDDL(columnName, schemaToCreate)
+	}
+	query := fmt.Sprintf(starRocksCreateTableTemplate, quotedTableName, strings.Join(columnsDDL, ", "), s.tableProperties(schemaToCreate))
+
+	if _, err := s.txOrDb(ctx).ExecContext(ctx, query); err != nil {
+		return errorj.CreateTableError.Wrap(err, "failed to create table").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Database:    s.config.Db,
+				Table:       quotedTableName,
+				PrimaryKeys: schemaToCreate.GetPKFields(),
+				Statement:   query,
+			})
+	}
+	return nil
+}
+
+// tableProperties returns key model, partitioning, distribution and properties clauses of CREATE TABLE statement
+func (s *StarRocks) tableProperties(table *Table) string {
+	var builder strings.Builder
+	pkFields := sortedPKFields(table)
+	pkColumns := make([]string, len(pkFields))
+	for i, column := range pkFields {
+		pkColumns[i] = s.quotedColumnName(column)
+	}
+	if len(pkColumns) > 0 {
+		builder.WriteString(" PRIMARY KEY (" + strings.Join(pkColumns, ", ") + ")")
+	}
+	granularity := s.starRocksConfig.PartitionGranularity
+	if !table.Temporary && granularity != "" && table.TimestampColumn != "" &&
+		(len(pkColumns) == 0 || table.PKFields.Contains(table.TimestampColumn)) {
+		builder.WriteString(fmt.Sprintf(" PARTITION BY date_trunc('%s', %s)", granularity, s.quotedColumnName(table.TimestampColumn)))
+	}
+	buckets := ""
+	if s.starRocksConfig.Buckets > 0 {
+		buckets = fmt.Sprintf(" BUCKETS %d", s.starRocksConfig.Buckets)
+	}
+	if len(pkColumns) > 0 {
+		builder.WriteString(" DISTRIBUTED BY HASH(" + strings.Join(pkColumns, ", ") + ")" + buckets)
+	} else if buckets != "" {
+		builder.WriteString(" DISTRIBUTED BY RANDOM" + buckets)
+	}
+	if s.starRocksConfig.ReplicationNum > 0 {
+		builder.WriteString(fmt.Sprintf(` PROPERTIES ("replication_num" = "%d")`, s.starRocksConfig.ReplicationNum))
+	}
+	return builder.String()
+}
+
+// PatchTableSchema adds new columns. Key of StarRocks table can't be changed, so primary key changes are ignored
+func (s *StarRocks) PatchTableSchema(ctx context.Context, patchTable *Table) error {
+	if patchTable.DeletePkFields || len(patchTable.PKFields) > 0 {
+		s.Warnf("Primary key of StarRocks table %s can't be changed. Requested primary key: %v", patchTable.Name, patchTable.GetPKFields())
+	}
+	if len(patchTable.Columns) == 0 {
+		return nil
+	}
+	return s.SQLAdapterBase.PatchTableSchema(ctx, &Table{Name: patchTable.Name, Columns: patchTable.Columns, PKFields: utils.NewSet[string]()})
+}
+
+// ReplaceTable atomically swaps target table with replacement table
+func (s *StarRocks) ReplaceTable(ctx context.Context, targetTableName string, replacementTable *Table, dropOldTable bool) (err error) {
+	targetTable, err := s.GetTableSchema(ctx, targetTableName)
+	if err != nil {
+		return err
+	}
+	quotedTargetTableName := s.quotedTableName(targetTableName)
+	quotedReplacementTableName := s.quotedTableName(replacementTable.Name)
+	query := fmt.Sprintf(starRocksRenameTableTemplate, quotedReplacementTableName, quotedTargetTableName)
+	if targetTable.Exists() {
+		query = fmt.Sprintf(starRocksSwapTableTemplate, quotedTargetTableName, quotedReplacementTableName)
+	}
+	if _, err = s.txOrDb(ctx).ExecContext(ctx, query); err != nil {
+		return errorj.RenameError.Wrap(err, "failed to replace table").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Database:  s.config.Db,
+				Table:     quotedTargetTableName,
+				Statement: query,
+			})
+	}
+	if targetTable.Exists() && dropOldTable {
+		// after swap replacement table contains data of old table
+		return s.DropTable(ctx, replacementTable.Name, true)
+	}
+	return nil
+}
+
+func sortedPKFields(table *Table) []string {
+	pkFields := table.GetPKFields()
+	sort.Strings(pkFields)
+	return pkFields
+}
+
+// starRocksColumnDDL returns column DDL (quoted column name, mapped sql type and 'not null' if pk field)
+func starRocksColumnDDL(quotedName, name string, table *Table) string {
+	column := table.Columns[name]
+	sqlType := column.GetDDLType()
+	if _, ok := table.PKFields[name]; ok {
+		if typeForPKField, ok := starRocksPrimaryKeyTypesMapping[sqlType]; ok {
+			sqlType = typeForPKField
+		}
+		return fmt.Sprintf("%s %s NOT NULL", quotedName, sqlType)
+	}
+	return fmt.Sprintf("%s %s", quotedName, sqlType)
+}
@@ -0,0 +1,126 @@
+package sql
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"github.com/jitsucom/bulker/jitsubase/uuid"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+const (
+	streamLoadURLTemplate = `%s://%s:%d/api/%s/%s/_stream_load`
+
+	streamLoadSuccess = "Success"
+	// streamLoadPublishTimeout data is committed but not yet visible
+	streamLoadPublishTimeout = "Publish Timeout"
+)
+
+// streamLoadResponse result of Stream Load request. Format is the same for StarRocks and Doris
+type streamLoadResponse struct {
+	TxnId              int64  `json:"TxnId"`
+	Label              string `json:"Label"`
+	Status             string `json:"Status"`
+	Message            string `json:"Message"`
+	NumberLoadedRows   int64  `json:"NumberLoadedRows"`
+	NumberFilteredRows int64  `json:"NumberFilteredRows"`
+	LoadBytes          int    `json:"LoadBytes"`
+	LoadTimeMs         int64  `json:"LoadTimeMs"`
+	ErrorURL           string `json:"ErrorURL"`
+}
+
+// streamLoader sends files to FE node with Stream Load HTTP API
+type streamLoader struct {
+	httpClient *http.Client
+	scheme     string
+	host       string
+	port       int
+	username   string
+	password   string
+}
+
+func newStreamLoader(host string, port int, https bool, tlsConfig *tls.Config, username, password string) *streamLoader {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if https && tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+	// wait for FE redirect to BE before sending file
+	transport.ExpectContinueTimeout = 5 * time.Second
+	scheme := "http"
+	if https {
+		scheme = "https"
+	}
+	return &streamLoader{
+		httpClient: &http.Client{
+			Transport: transport,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= 10 {
+					return errors.New("stopped after 10 redirects")
+				}
+				// FE redirects Stream Load to BE node. Authorization header is dropped on redirect to different host
+				req.SetBasicAuth(username, password)
+				return nil
+			},
+		},
+		scheme:   scheme,
+		host:     host,
+		port:     port,
+		username: username,
+		password: password,
+	}
+}
+
+// URL of Stream Load endpoint for the table
+func (sl *streamLoader) URL(db, tableName string) string {
+	return fmt.Sprintf(streamLoadURLTemplate, sl.scheme, sl.host, sl.port, url.PathEscape(db), url.PathEscape(tableName))
+}
+
+// load sends file with chunked request. headers contain format specific Stream Load parameters
+func (sl *streamLoader) load(ctx context.Context, db, tableName, filePath string, headers map[string]string) (*streamLoadResponse, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, sl.URL(db, tableName), file)
+	if err != nil {
+		return nil, err
+	}
+	// body is read again after redirect to BE node
+	req.GetBody = func() (io.ReadCloser, error) {
+		return os.Open(filePath)
+	}
+	req.SetBasicAuth(sl.username, sl.password)
+	req.Header.Set("Expect", "100-continue")
+	req.Header.Set("label", fmt.Sprintf("bulker_%s_%s", utils.ShortenString(utils.SanitizeString(tableName), 64), uuid.NewLettersNumbers()))
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	res, err := sl.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("http status: %d body: %s", res.StatusCode, string(body))
+	}
+	loadResponse := &streamLoadResponse{}
+	if err = json.Unmarshal(body, loadResponse); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %v body: %s", err, string(body))
+	}
+	if loadResponse.Status != streamLoadSuccess && loadResponse.Status != streamLoadPublishTimeout {
+		return nil, fmt.Errorf("status: %s message: %s error details: %s", loadResponse.Status, loadResponse.Message, loadResponse.ErrorURL)
+	}
+	return loadResponse, nil
+}
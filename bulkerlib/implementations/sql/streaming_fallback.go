@@ -0,0 +1,149 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/logging"
+	"time"
+)
+
+const (
+	// streamingFallbackBatchRows and streamingFallbackBatchAge thresholds for committing rows buffered after fallback to batch loading
+	streamingFallbackBatchRows = 10000
+	streamingFallbackBatchAge  = time.Minute
+	// streamingFallbackMaxPendingRows limit of buffered rows when batches keep failing. New rows are rejected after that
+	streamingFallbackMaxPendingRows = 10 * streamingFallbackBatchRows
+)
+
+// StreamingFallbackStream is a stream mode stream that inserts rows with streaming API of the adapter.
+// When streaming quota or request size limit is hit, it switches to batch loading for the remainder of the stream:
+// rows are buffered and committed in batches when buffer reaches streamingFallbackBatchRows rows,
+// gets older than streamingFallbackBatchAge or on Complete.
+// Rows of failed batch stay in buffer and retried with the next batch.
+type StreamingFallbackStream struct {
+	id        string
+	tableName string
+	streaming bulker.BulkerStream
+	// newBatchStream creates stream that commits buffered rows
+	newBatchStream func() (bulker.BulkerStream, error)
+	isQuotaError   func(err error) bool
+
+	pending      []types.Object
+	pendingSince time.Time
+	state        bulker.State
+}
+
+func newStreamingFallbackStream(id string, p SQLAdapter, batchAdapter SQLAdapter, tableName string, streamOptions ...bulker.StreamOption) (bulker.BulkerStream, error) {
+	checker, ok := p.(StreamingQuotaChecker)
+	if !ok {
+		return nil, fmt.Errorf("%s doesn't support fallback from streaming", p.Type())
+	}
+	streaming, err := newAutoCommitStream(id, p, tableName, streamOptions...)
+	if err != nil {
+		return nil, err
+	}
+	newBatchStream := func() (bulker.BulkerStream, error) {
+		return newTransactionalStream(id, batchAdapter, tableName, streamOptions...)
+	}
+	return &StreamingFallbackStream{id: id, tableName: tableName, streaming: streaming, newBatchStream: newBatchStream,
+		isQuotaError: checker.IsStreamingQuotaError, state: bulker.State{Status: bulker.Active}}, nil
+}
+
+func (sf *StreamingFallbackStream) Consume(ctx context.Context, object types.Object) (state bulker.State, processedObject types.Object, err error) {
+	sf.state.ProcessedRows++
+	defer func() {
+		if bulker.IsRejectedObjectError(err) {
+			sf.state.RejectedRows++
+		} else if err != nil {
+			sf.state.ErrorRowIndex = sf.state.ProcessedRows
+			sf.state.SetError(err)
+		} else {
+			sf.state.SuccessfulRows++
+		}
+		state = sf.state
+	}()
+	if sf.state.StreamingFallback == nil {
+		var streamingState bulker.State
+		streamingState, processedObject, err = sf.streaming.Consume(ctx, object)
+		sf.state.Representation = streamingState.Representation
+		if err == nil || !sf.isQuotaError(err) {
+			return
+		}
+		logging.Warnf("[%s] Streaming quota or size limit was hit. Falling back to batch loading for the remainder of the stream: %v", sf.id, err)
+		sf.state.StreamingFallback = &bulker.StreamingFallbackState{Reason: err.Error(), RowIndex: sf.state.ProcessedRows}
+		// the row is loaded with batch path below
+		err = nil
+	}
+	if len(sf.pending) >= streamingFallbackMaxPendingRows {
+		return sf.state, nil, fmt.Errorf("batch loading buffer is full: %d rows are waiting for commit. Last error: %s", len(sf.pending), sf.state.LastErrorText)
+	}
+	if len(sf.pending) == 0 {
+		sf.pendingSince = time.Now()
+	}
+	sf.pending = append(sf.pending, object)
+	if len(sf.pending) >= streamingFallbackBatchRows || time.Since(sf.pendingSince) >= streamingFallbackBatchAge {
+		if err = sf.flush(ctx); err != nil {
+			// current object will be retried by caller, previous objects stay in buffer for the next batch
+			sf.pending = sf.pending[:len(sf.pending)-1]
+		}
+	}
+	sf.state.StreamingFallback.PendingRows = len(sf.pending)
+	return sf.state, object, err
+}
+
+func (sf *StreamingFallbackStream) ConsumeBatch(ctx context.Context, objects []types.Object) (state bulker.State, processedObjects []types.Object, err error) {
+	return bulker.ConsumeEach(ctx, sf, objects)
+}
+
+// flush commits buffered rows with a new batch stream
+func (sf *StreamingFallbackStream) flush(ctx context.Context) (err error) {
+	if len(sf.pending) == 0 {
+		return nil
+	}
+	batchStream, err := sf.newBatchStream()
+	if err != nil {
+		return fmt.Errorf("failed to create batch stream: %v", err)
+	}
+	for _, object := range sf.pending {
+		if _, _, err = batchStream.Consume(ctx, object); err != nil {
+			_, _ = batchStream.Abort(ctx)
+			return err
+		}
+	}
+	batchState, err := batchStream.Complete(ctx)
+	if err != nil {
+		return err
+	}
+	logging.Infof("[%s] Batch of %d rows loaded after fallback from streaming", sf.id, len(sf.pending))
+	sf.state.Representation = batchState.Representation
+	sf.state.AddWarehouseState(batchState.WarehouseState)
+	sf.state.StreamingFallback.BatchesLoaded++
+	sf.pending = nil
+	return nil
+}
+
+func (sf *StreamingFallbackStream) Complete(ctx context.Context) (state bulker.State, err error) {
+	if sf.state.StreamingFallback == nil {
+		_, err = sf.streaming.Complete(ctx)
+		sf.state.Status = bulker.Completed
+		return sf.state, err
+	}
+	_, _ = sf.streaming.Complete(ctx)
+	if err = sf.flush(ctx); err != nil {
+		sf.state.SetError(err)
+		sf.state.Status = bulker.Failed
+	} else {
+		sf.state.Status = bulker.Completed
+	}
+	sf.state.StreamingFallback.PendingRows = len(sf.pending)
+	return sf.state, err
+}
+
+func (sf *StreamingFallbackStream) Abort(ctx context.Context) (state bulker.State, err error) {
+	_, _ = sf.streaming.Abort(ctx)
+	sf.pending = nil
+	sf.state.Status = bulker.Aborted
+	return sf.state, nil
+}
@@ -0,0 +1,147 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/errorj"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/googleapi"
+	"net/http"
+	"testing"
+	"time"
+)
+
+var errTestStreamingQuota = errors.New("quota exceeded")
+
+// fallbackTestStream records consumed objects. Fails Consume and Complete with configured errors
+type fallbackTestStream struct {
+	consumed    []types.Object
+	consumeErr  error
+	completeErr error
+	completed   bool
+}
+
+func (s *fallbackTestStream) Consume(ctx context.Context, object types.Object) (bulker.State, types.Object, error) {
+	if s.consumeErr != nil {
+		return bulker.State{}, nil, s.consumeErr
+	}
+	s.consumed = append(s.consumed, object)
+	return bulker.State{}, object, nil
+}
+
+func (s *fallbackTestStream) ConsumeBatch(ctx context.Context, objects []types.Object) (bulker.State, []types.Object, error) {
+	return bulker.ConsumeEach(ctx, s, objects)
+}
+
+func (s *fallbackTestStream) Abort(ctx context.Context) (bulker.State, error) {
+	return bulker.State{Status: bulker.Aborted}, nil
+}
+
+func (s *fallbackTestStream) Complete(ctx context.Context) (bulker.State, error) {
+	if s.completeErr != nil {
+		return bulker.State{}, s.completeErr
+	}
+	s.completed = true
+	return bulker.State{Status: bulker.Completed}, nil
+}
+
+// newFallbackTestStream creates StreamingFallbackStream that commits batches to batches with completeErr error of the next batch
+func newFallbackTestStream(streaming *fallbackTestStream, batches *[]*fallbackTestStream, completeErr *error) *StreamingFallbackStream {
+	return &StreamingFallbackStream{id: "test", tableName: "events", streaming: streaming,
+		newBatchStream: func() (bulker.BulkerStream, error) {
+			batch := &fallbackTestStream{completeErr: *completeErr}
+			*batches = append(*batches, batch)
+			return batch, nil
+		},
+		isQuotaError: func(err error) bool { return errors.Is(err, errTestStreamingQuota) },
+		state:        bulker.State{Status: bulker.Active}}
+}
+
+func TestStreamingFallbackStream(t *testing.T) {
+	reqr := require.New(t)
+	ctx := context.Background()
+	row := func(id int) types.Object { return types.Object{"id": id} }
+	streaming := &fallbackTestStream{}
+	var batches []*fallbackTestStream
+	var completeErr error
+	stream := newFallbackTestStream(streaming, &batches, &completeErr)
+
+	state, _, err := stream.Consume(ctx, row(1))
+	reqr.NoError(err)
+	reqr.Nil(state.StreamingFallback)
+
+	//quota error switches stream to batch loading without failing the row
+	streaming.consumeErr = fmt.Errorf("failed to insert: %w", errTestStreamingQuota)
+	state, _, err = stream.Consume(ctx, row(2))
+	reqr.NoError(err)
+	reqr.Equal(&bulker.StreamingFallbackState{Reason: "failed to insert: quota exceeded", RowIndex: 2, PendingRows: 1}, state.StreamingFallback)
+	state, _, err = stream.Consume(ctx, row(3))
+	reqr.NoError(err)
+	reqr.Equal(2, state.StreamingFallback.PendingRows)
+	reqr.Empty(batches)
+	reqr.Equal([]types.Object{row(1)}, streaming.consumed)
+
+	//buffer older than streamingFallbackBatchAge is committed. Rows of failed batch are kept, failed row is left to caller
+	stream.pendingSince = time.Now().Add(-streamingFallbackBatchAge)
+	completeErr = errors.New("load job failed")
+	state, _, err = stream.Consume(ctx, row(4))
+	reqr.EqualError(err, "load job failed")
+	reqr.Equal(4, state.ErrorRowIndex)
+	reqr.Equal(2, state.StreamingFallback.PendingRows)
+	reqr.Equal(0, state.StreamingFallback.BatchesLoaded)
+	reqr.Len(batches, 1)
+
+	completeErr = nil
+	state, err = stream.Complete(ctx)
+	reqr.NoError(err)
+	reqr.Equal(bulker.Completed, state.Status)
+	reqr.Equal(3, state.SuccessfulRows)
+	reqr.Equal(1, state.StreamingFallback.BatchesLoaded)
+	reqr.Equal(0, state.StreamingFallback.PendingRows)
+	reqr.Len(batches, 2)
+	reqr.True(batches[1].completed)
+	reqr.Equal([]types.Object{row(2), row(3)}, batches[1].consumed)
+
+	//errors other than quota errors don't switch stream to batch loading
+	streaming = &fallbackTestStream{consumeErr: errors.New("invalid row")}
+	stream = newFallbackTestStream(streaming, &batches, &completeErr)
+	state, _, err = stream.Consume(ctx, row(1))
+	reqr.EqualError(err, "invalid row")
+	reqr.Nil(state.StreamingFallback)
+
+	//new rows are rejected when buffer is full
+	streaming.consumeErr = errTestStreamingQuota
+	_, _, err = stream.Consume(ctx, row(2))
+	reqr.NoError(err)
+	stream.pending = make([]types.Object, streamingFallbackMaxPendingRows)
+	_, _, err = stream.Consume(ctx, row(3))
+	reqr.ErrorContains(err, "batch loading buffer is full: 100000 rows are waiting for commit")
+}
+
+func TestIsStreamingQuotaError(t *testing.T) {
+	wrap := func(err error) error {
+		return errorj.ExecuteInsertError.Wrap(err, "failed to execute streaming insert")
+	}
+	tests := []struct {
+		name    string
+		checker StreamingQuotaChecker
+		err     error
+		want    bool
+	}{
+		{"bigquery_too_many_requests", &BigQueryStreamingInserts{}, wrap(&googleapi.Error{Code: http.StatusTooManyRequests}), true},
+		{"bigquery_too_large", &BigQueryStreamingInserts{}, wrap(&googleapi.Error{Code: http.StatusRequestEntityTooLarge}), true},
+		{"bigquery_quota_reason", &BigQueryStreamingInserts{}, wrap(&googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "quotaExceeded"}}}), true},
+		{"bigquery_payload_size", &BigQueryStreamingInserts{}, wrap(errors.New("Request payload size exceeds the limit: 10485760 bytes")), true},
+		{"bigquery_not_found", &BigQueryStreamingInserts{}, wrap(&googleapi.Error{Code: http.StatusNotFound, Errors: []googleapi.ErrorItem{{Reason: "notFound"}}}), false},
+		{"snowpipe_limit", &SnowpipeStreaming{}, wrap(fmt.Errorf("failed to open channel: %w", fmt.Errorf("%w: http 429", errSfStreamingLimitExceeded))), true},
+		{"snowpipe_other", &SnowpipeStreaming{}, wrap(errors.New("http 500: internal error")), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, tt.checker.IsStreamingQuotaError(tt.err))
+		})
+	}
+}
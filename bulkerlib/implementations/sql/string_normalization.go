@@ -0,0 +1,126 @@
+package sql
+
+import (
+	"encoding/json"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"strings"
+	"unicode/utf8"
+)
+
+// StringPolicy defines how string values containing problematic characters are treated before marshalling
+type StringPolicy string
+
+const (
+	// StringPolicyKeep leaves value as is
+	StringPolicyKeep StringPolicy = "keep"
+	// StringPolicyStrip removes problematic characters
+	StringPolicyStrip StringPolicy = "strip"
+	// StringPolicyReplace replaces newlines with space, NUL bytes and invalid UTF-8 sequences with U+FFFD replacement character
+	StringPolicyReplace StringPolicy = "replace"
+	// StringPolicyError fails the event
+	StringPolicyError StringPolicy = "error"
+)
+
+// StringNormalizationConfig policies for string values containing characters that break loading of batch files on some warehouses.
+// Empty policy means StringPolicyKeep
+type StringNormalizationConfig struct {
+	Newlines    StringPolicy `json:"newlines,omitempty"`
+	NUL         StringPolicy `json:"nul,omitempty"`
+	InvalidUTF8 StringPolicy `json:"invalidUtf8,omitempty"`
+}
+
+func (sc *StringNormalizationConfig) Validate() error {
+	names := []string{"newlines", "nul", "invalidUtf8"}
+	for i, policy := range []StringPolicy{sc.Newlines, sc.NUL, sc.InvalidUTF8} {
+		switch policy {
+		case "", StringPolicyKeep, StringPolicyStrip, StringPolicyReplace, StringPolicyError:
+		default:
+			return fmt.Errorf("unknown %s policy: %s. Supported: keep, strip, replace, error", names[i], policy)
+		}
+	}
+	return nil
+}
+
+// normalize applies policies to all string values of object in place
+func (sc *StringNormalizationConfig) normalize(object types.Object) error {
+	for name, value := range object {
+		str, ok := value.(string)
+		if !ok {
+			continue
+		}
+		normalized, err := sc.normalizeString(str)
+		if err != nil {
+			return fmt.Errorf("value of '%s' field %v", name, err)
+		}
+		object[name] = normalized
+	}
+	return nil
+}
+
+func (sc *StringNormalizationConfig) normalizeString(value string) (string, error) {
+	if sc.InvalidUTF8 != "" && sc.InvalidUTF8 != StringPolicyKeep && !utf8.ValidString(value) {
+		switch sc.InvalidUTF8 {
+		case StringPolicyError:
+			return "", fmt.Errorf("contains invalid UTF-8 sequence")
+		case StringPolicyStrip:
+			value = strings.ToValidUTF8(value, "")
+		case StringPolicyReplace:
+			value = strings.ToValidUTF8(value, string(utf8.RuneError))
+		}
+	}
+	if sc.NUL != "" && sc.NUL != StringPolicyKeep && strings.IndexByte(value, 0) >= 0 {
+		switch sc.NUL {
+		case StringPolicyError:
+			return "", fmt.Errorf("contains NUL byte")
+		case StringPolicyStrip:
+			value = strings.ReplaceAll(value, "\x00", "")
+		case StringPolicyReplace:
+			value = strings.ReplaceAll(value, "\x00", string(utf8.RuneError))
+		}
+	}
+	if sc.Newlines != "" && sc.Newlines != StringPolicyKeep && strings.ContainsAny(value, "\r\n") {
+		switch sc.Newlines {
+		case StringPolicyError:
+			return "", fmt.Errorf("contains newline")
+		case StringPolicyStrip:
+			value = strings.NewReplacer("\r\n", "", "\r", "", "\n", "").Replace(value)
+		case StringPolicyReplace:
+			value = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ").Replace(value)
+		}
+	}
+	return value, nil
+}
+
+// parseStringNormalizationConfig accepts single policy for all characters classes or config object
+func parseStringNormalizationConfig(serialized any) (*StringNormalizationConfig, error) {
+	var raw []byte
+	switch v := serialized.(type) {
+	case *StringNormalizationConfig:
+		return v, v.Validate()
+	case string:
+		if !strings.HasPrefix(strings.TrimSpace(v), "{") {
+			policy := StringPolicy(v)
+			config := &StringNormalizationConfig{Newlines: policy, NUL: policy, InvalidUTF8: policy}
+			return config, config.Validate()
+		}
+		raw = []byte(v)
+	default:
+		var err error
+		raw, err = json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value type of stringNormalization option: %T", v)
+		}
+	}
+	config := &StringNormalizationConfig{}
+	if err := json.Unmarshal(raw, config); err != nil {
+		return nil, fmt.Errorf("failed to parse stringNormalization config: %v", err)
+	}
+	return config, config.Validate()
+}
+
+// WithStringNormalization sets policies for string values containing newlines, NUL bytes and invalid UTF-8
+func WithStringNormalization(config *StringNormalizationConfig) bulker.StreamOption {
+	return bulker.WithOption(&StringNormalizationOption, config)
+}
@@ -0,0 +1,73 @@
+package sql
+
+import (
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestStringNormalization(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  StringNormalizationConfig
+		value   string
+		want    string
+		wantErr string
+	}{
+		{"keep", StringNormalizationConfig{}, "a\r\nb\x00c\xff", "a\r\nb\x00c\xff", ""},
+		{"newlines_replace", StringNormalizationConfig{Newlines: StringPolicyReplace}, "a\r\nb\nc\rd", "a b c d", ""},
+		{"newlines_strip", StringNormalizationConfig{Newlines: StringPolicyStrip}, "a\r\nb\nc", "abc", ""},
+		{"newlines_error", StringNormalizationConfig{Newlines: StringPolicyError}, "a\nb", "", "contains newline"},
+		{"nul_replace", StringNormalizationConfig{NUL: StringPolicyReplace}, "a\x00b", "a�b", ""},
+		{"nul_strip", StringNormalizationConfig{NUL: StringPolicyStrip}, "a\x00b", "ab", ""},
+		{"nul_error", StringNormalizationConfig{NUL: StringPolicyError}, "a\x00b", "", "contains NUL byte"},
+		{"utf8_replace", StringNormalizationConfig{InvalidUTF8: StringPolicyReplace}, "a\xff\xfeb", "a�b", ""},
+		{"utf8_strip", StringNormalizationConfig{InvalidUTF8: StringPolicyStrip}, "a\xffb", "ab", ""},
+		{"utf8_error", StringNormalizationConfig{InvalidUTF8: StringPolicyError}, "a\xffb", "", "contains invalid UTF-8 sequence"},
+		{"valid_utf8", StringNormalizationConfig{InvalidUTF8: StringPolicyError}, "приве́т", "приве́т", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.config.normalizeString(tt.value)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+
+	config := &StringNormalizationConfig{Newlines: StringPolicyReplace, NUL: StringPolicyError}
+	object := types.Object{"id": 1, "name": "a\nb"}
+	require.NoError(t, config.normalize(object))
+	require.Equal(t, types.Object{"id": 1, "name": "a b"}, object)
+	require.EqualError(t, config.normalize(types.Object{"name": "a\x00"}), "value of 'name' field contains NUL byte")
+}
+
+func TestParseStringNormalizationConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		serialized any
+		want       *StringNormalizationConfig
+		wantErr    string
+	}{
+		{"single_policy", "replace", &StringNormalizationConfig{Newlines: StringPolicyReplace, NUL: StringPolicyReplace, InvalidUTF8: StringPolicyReplace}, ""},
+		{"json", `{"newlines": "strip", "nul": "error"}`, &StringNormalizationConfig{Newlines: StringPolicyStrip, NUL: StringPolicyError}, ""},
+		{"map", map[string]any{"invalidUtf8": "replace"}, &StringNormalizationConfig{InvalidUTF8: StringPolicyReplace}, ""},
+		{"unknown_policy", "drop", nil, "unknown newlines policy: drop"},
+		{"unknown_json_policy", `{"nul": "drop"}`, nil, "unknown nul policy: drop"},
+		{"invalid_json", `{"nul": `, nil, "failed to parse stringNormalization config"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseStringNormalizationConfig(tt.serialized)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -23,7 +23,9 @@ type TableField struct {
 
 // Table is a dto for DWH Table representation
 type Table struct {
-	Name      string
+	Name string
+	// Namespace schema (or database) of the table when it differs from the destination one. See StagingSchemaOption
+	Namespace string
 	Temporary bool
 	Cached    bool
 
@@ -31,9 +33,24 @@ type Table struct {
 	PKFields        utils.Set[string]
 	PrimaryKeyName  string
 	TimestampColumn string
+	// VersionColumn rows with lower version don't overwrite rows with higher version on merge. See bulker.VersionColumnOption.
+	// CopyTables takes it from source table, Insert from target table
+	VersionColumn string
 
 	Partition DatePartition
 
+	// Indexes and NotNullColumns constraints declared with IndexesOption and NotNullOption
+	Indexes        []Index
+	NotNullColumns Columns
+
+	// PartitionColumns and ClusteringColumns declared with PartitionKeyOption and ClusteringKeyOption. Applied when table is created
+	PartitionColumns  []string
+	ClusteringColumns []string
+
+	// Comment and ColumnComments descriptions declared with DescriptionsOption. Set when table is created or columns are added
+	Comment        string
+	ColumnComments map[string]string
+
 	DeletePkFields bool
 }
 
@@ -43,7 +60,7 @@ func (t *Table) Exists() bool {
 		return false
 	}
 
-	return len(t.Columns) > 0 || len(t.PKFields) > 0 || t.DeletePkFields
+	return len(t.Columns) > 0 || len(t.PKFields) > 0 || t.DeletePkFields || len(t.Indexes) > 0 || len(t.NotNullColumns) > 0
 }
 
 // SortedColumnNames return column names sorted in alphabetical order
@@ -56,6 +73,29 @@ func (t *Table) SortedColumnNames() []string {
 	return columns
 }
 
+// CreateColumnNames returns column names in order of physical columns of created table:
+// primary key columns, timestamp column, other columns in alphabetical order and metadata columns (starting with underscore) last.
+// Each group is sorted alphabetically
+func (t *Table) CreateColumnNames() []string {
+	columns := t.SortedColumnNames()
+	rank := func(name string) int {
+		switch {
+		case t.PKFields.Contains(name):
+			return 0
+		case name == t.TimestampColumn:
+			return 1
+		case strings.HasPrefix(name, "_"):
+			return 3
+		default:
+			return 2
+		}
+	}
+	sort.SliceStable(columns, func(i, j int) bool {
+		return rank(columns[i]) < rank(columns[j])
+	})
+	return columns
+}
+
 // Clone returns clone of current table
 func (t *Table) Clone() *Table {
 	clonedColumns := Columns{}
@@ -67,14 +107,24 @@ func (t *Table) Clone() *Table {
 
 	return &Table{
 		Name:            t.Name,
+		Namespace:       t.Namespace,
 		Columns:         clonedColumns,
 		PKFields:        clonedPkFields,
 		PrimaryKeyName:  t.PrimaryKeyName,
 		Temporary:       t.Temporary,
 		TimestampColumn: t.TimestampColumn,
+		VersionColumn:   t.VersionColumn,
 		Partition:       t.Partition,
 		Cached:          t.Cached,
 		DeletePkFields:  t.DeletePkFields,
+		Indexes:         append([]Index(nil), t.Indexes...),
+		NotNullColumns:  t.NotNullColumns.Clone(),
+
+		PartitionColumns:  t.PartitionColumns,
+		ClusteringColumns: t.ClusteringColumns,
+
+		Comment:        t.Comment,
+		ColumnComments: t.ColumnComments,
 	}
 }
 
@@ -102,7 +152,7 @@ func (t *Table) GetPKFieldsSet() utils.Set[string] {
 // 2) all fields from another schema exist in current schema
 // NOTE: Diff method doesn't take types into account
 func (t *Table) Diff(another *Table) *Table {
-	diff := &Table{Name: t.Name, Columns: map[string]types.SQLColumn{}, PKFields: utils.Set[string]{}}
+	diff := &Table{Name: t.Name, Namespace: t.Namespace, Columns: map[string]types.SQLColumn{}, PKFields: utils.Set[string]{}}
 
 	if !another.Exists() {
 		return diff
@@ -112,9 +162,17 @@ func (t *Table) Diff(another *Table) *Table {
 		_, ok := t.Columns[name]
 		if !ok {
 			diff.Columns[name] = column
+			if comment, ok := another.ColumnComments[name]; ok {
+				if diff.ColumnComments == nil {
+					diff.ColumnComments = map[string]string{}
+				}
+				diff.ColumnComments[name] = comment
+			}
 		}
 	}
 
+	t.constraintsDiff(another, diff)
+
 	jitsuPrimaryKeyName := BuildConstraintName(t.Name)
 	//check if primary key is maintained by Jitsu (for Postgres and Redshift)
 	if t.PrimaryKeyName != "" && !strings.HasPrefix(strings.ToLower(t.PrimaryKeyName), BulkerManagedPkConstraintPrefix) {
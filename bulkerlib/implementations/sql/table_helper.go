@@ -10,6 +10,7 @@ import (
 	"github.com/jitsucom/bulker/jitsubase/logging"
 	"github.com/jitsucom/bulker/jitsubase/utils"
 	"regexp"
+	"strings"
 	"sync"
 	"time"
 )
@@ -32,6 +33,8 @@ type TableHelper struct {
 
 	coordinationService coordination.Service
 	tablesCache         map[string]*Table
+	// ensuredConstraints indexes and NOT NULL constraints created by TableHelper. Database schema introspection doesn't return them
+	ensuredConstraints map[string]*Table
 
 	maxColumns int
 
@@ -48,6 +51,7 @@ func NewTableHelper(maxIdentifierLength int, identifierQuoteChar rune) TableHelp
 	return TableHelper{
 		coordinationService: coordination.DummyCoordinationService{},
 		tablesCache:         map[string]*Table{},
+		ensuredConstraints:  map[string]*Table{},
 
 		maxColumns: 1000,
 
@@ -227,6 +231,15 @@ func (th *TableHelper) patchTableWithLock(ctx context.Context, sqlAdapter SQLAda
 	if diff.DeletePkFields {
 		currentSchema.PKFields = utils.Set[string]{}
 	}
+	//indexes and not null constraints
+	currentSchema.Indexes = append(currentSchema.Indexes, diff.Indexes...)
+	if len(diff.NotNullColumns) > 0 {
+		if currentSchema.NotNullColumns == nil {
+			currentSchema.NotNullColumns = Columns{}
+		}
+		utils.MapPutAll(currentSchema.NotNullColumns, diff.NotNullColumns)
+	}
+	th.saveConstraints(currentSchema)
 
 	th.updateCached(diff.Name, currentSchema)
 
@@ -283,7 +296,16 @@ func (th *TableHelper) getOrCreate(ctx context.Context, sqlAdapter SQLAdapter, d
 
 	//create new
 	if !dbTableSchema.Exists() {
-		if err := sqlAdapter.CreateTable(context.Background(), dataSchema); err != nil {
+		tableToCreate := dataSchema
+		if len(dataSchema.Indexes) > 0 || len(dataSchema.NotNullColumns) > 0 {
+			//create only constraints on columns present in data schema
+			constraints := &Table{}
+			(&Table{Name: dataSchema.Name}).constraintsDiff(dataSchema, constraints)
+			tableToCreate = dataSchema.Clone()
+			tableToCreate.Indexes = constraints.Indexes
+			tableToCreate.NotNullColumns = constraints.NotNullColumns
+		}
+		if err := sqlAdapter.CreateTable(context.Background(), tableToCreate); err != nil {
 			return nil, err
 		}
 
@@ -291,11 +313,38 @@ func (th *TableHelper) getOrCreate(ctx context.Context, sqlAdapter SQLAdapter, d
 		dbTableSchema.Columns = dataSchema.Columns
 		dbTableSchema.PKFields = dataSchema.PKFields
 		dbTableSchema.PrimaryKeyName = dataSchema.PrimaryKeyName
+		dbTableSchema.Indexes = tableToCreate.Indexes
+		dbTableSchema.NotNullColumns = tableToCreate.NotNullColumns
+		th.saveConstraints(dbTableSchema)
+	} else {
+		th.restoreConstraints(dbTableSchema)
 	}
 
 	return dbTableSchema, nil
 }
 
+// saveConstraints remembers indexes and NOT NULL constraints created on table
+func (th *TableHelper) saveConstraints(table *Table) {
+	th.Lock()
+	defer th.Unlock()
+	if len(table.Indexes) == 0 && len(table.NotNullColumns) == 0 {
+		delete(th.ensuredConstraints, table.Name)
+		return
+	}
+	th.ensuredConstraints[table.Name] = &Table{Indexes: append([]Index(nil), table.Indexes...), NotNullColumns: table.NotNullColumns.Clone()}
+}
+
+// restoreConstraints sets indexes and NOT NULL constraints previously created by TableHelper on table schema fetched from database
+func (th *TableHelper) restoreConstraints(table *Table) {
+	th.RLock()
+	constraints, ok := th.ensuredConstraints[table.Name]
+	th.RUnlock()
+	if ok {
+		table.Indexes = append([]Index(nil), constraints.Indexes...)
+		table.NotNullColumns = constraints.NotNullColumns.Clone()
+	}
+}
+
 func (th *TableHelper) lockTable(destinationID, tableName, tableIdentifier string) (locks.Lock, error) {
 	tableLock := th.coordinationService.CreateLock(tableIdentifier)
 	locked, err := tableLock.TryLock(tableLockTimeout)
@@ -349,6 +398,20 @@ func (th *TableHelper) quotedTableName(tableName string) string {
 	return quoted
 }
 
+// quotedTable returns quoted name of the table qualified with its namespace, e.g. "staging"."events_tmp".
+// Namespace may consist of several dot-separated parts: database.schema
+func (th *TableHelper) quotedTable(table *Table) string {
+	quoted := th.quotedTableName(table.Name)
+	if table.Namespace == "" {
+		return quoted
+	}
+	parts := strings.Split(table.Namespace, ".")
+	for i, part := range parts {
+		parts[i], _ = th.adaptSqlIdentifier(part, "namespace", th.tableNameFunc)
+	}
+	return strings.Join(parts, ".") + "." + quoted
+}
+
 // quotedColumnName adapts column name to sql identifier rules of database and quotes accordingly (if needed)
 func (th *TableHelper) quotedColumnName(columnName string) string {
 	quoted, _ := th.adaptColumnName(columnName)
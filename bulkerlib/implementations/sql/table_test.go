@@ -0,0 +1,109 @@
+package sql
+
+import (
+	types2 "github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestCreateColumnNames(t *testing.T) {
+	columns := func(names ...string) Columns {
+		c := Columns{}
+		for _, name := range names {
+			c[name] = types2.SQLColumn{Type: "text"}
+		}
+		return c
+	}
+	tests := []struct {
+		name  string
+		table *Table
+		want  []string
+	}{
+		{"alphabetical", &Table{Columns: columns("name", "age", "city")}, []string{"age", "city", "name"}},
+		{"metadata_last", &Table{Columns: columns("_unmapped_data", "name", "__partition_id", "age")},
+			[]string{"age", "name", "__partition_id", "_unmapped_data"}},
+		{"pk_and_timestamp_first",
+			&Table{Columns: columns("name", "id", "_timestamp", "tenant", "__partition_id"), PKFields: utils.NewSet("tenant", "id"), TimestampColumn: "_timestamp"},
+			[]string{"id", "tenant", "_timestamp", "name", "__partition_id"}},
+		{"timestamp_in_pk", &Table{Columns: columns("name", "id", "ts"), PKFields: utils.NewSet("ts", "id"), TimestampColumn: "ts"},
+			[]string{"id", "ts", "name"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, tt.table.CreateColumnNames())
+		})
+	}
+}
+
+func TestConstraintsDiff(t *testing.T) {
+	column := types2.SQLColumn{Type: "text"}
+	userIndex := Index{Columns: []string{"user_id"}}
+	uniqueIndex := Index{Name: "events_message_id", Columns: []string{"message_id"}, Unique: true}
+	tests := []struct {
+		name        string
+		current     *Table
+		desired     *Table
+		wantIndexes []Index
+		wantNotNull Columns
+	}{
+		{"new_constraints",
+			&Table{Name: "events", Columns: Columns{"user_id": column, "message_id": column}},
+			&Table{Name: "events", Columns: Columns{"user_id": column}, Indexes: []Index{userIndex, uniqueIndex}, NotNullColumns: Columns{"message_id": {}}},
+			[]Index{userIndex, uniqueIndex}, Columns{"message_id": column}},
+		{"existing_constraints",
+			&Table{Name: "events", Columns: Columns{"user_id": column}, Indexes: []Index{userIndex}, NotNullColumns: Columns{"user_id": column}},
+			&Table{Name: "events", Columns: Columns{"user_id": column}, Indexes: []Index{userIndex}, NotNullColumns: Columns{"user_id": {}}},
+			nil, nil},
+		{"missing_columns",
+			&Table{Name: "events", Columns: Columns{"user_id": column}},
+			&Table{Name: "events", Columns: Columns{"user_id": column}, Indexes: []Index{uniqueIndex}, NotNullColumns: Columns{"message_id": {}}},
+			nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := tt.current.Diff(tt.desired)
+			require.Equal(t, tt.wantIndexes, diff.Indexes)
+			require.Equal(t, tt.wantNotNull, diff.NotNullColumns)
+			require.Equal(t, len(tt.wantIndexes) > 0 || len(tt.wantNotNull) > 0, diff.Exists())
+		})
+	}
+}
+
+func TestParseIndexes(t *testing.T) {
+	indexes, err := parseIndexes(`[{"columns":["user_id"]},{"name":"events_message_id","columns":["message_id"],"unique":true}]`)
+	require.NoError(t, err)
+	require.Equal(t, []Index{{Columns: []string{"user_id"}}, {Name: "events_message_id", Columns: []string{"message_id"}, Unique: true}}, indexes)
+	require.Equal(t, "events_message_id", indexes[1].IndexName("events"))
+	require.Equal(t, indexes[0].IndexName("events"), indexes[0].IndexName("events"))
+	require.NotEqual(t, indexes[0].IndexName("events"), indexes[0].IndexName("users"))
+
+	_, err = parseIndexes([]any{map[string]any{"name": "idx"}})
+	require.Error(t, err)
+}
+
+func TestQuotedTable(t *testing.T) {
+	reqr := require.New(t)
+	th := NewTableHelper(63, '"')
+	reqr.Equal(`"events_tmp"`, th.quotedTable(&Table{Name: "events_tmp"}))
+	reqr.Equal(`"staging"."events_tmp"`, th.quotedTable(&Table{Name: "events_tmp", Namespace: "staging"}))
+	reqr.Equal(`"staging"."public"."events_tmp"`, th.quotedTable(&Table{Name: "events_tmp", Namespace: "staging.public"}))
+}
+
+func TestDescriptionsDiff(t *testing.T) {
+	column := types2.SQLColumn{Type: "text"}
+	current := &Table{Name: "events", Columns: Columns{"id": column}}
+	desired := &Table{Name: "events", Columns: Columns{"id": column, "email": column}, Comment: "Events",
+		ColumnComments: map[string]string{"id": "Event id", "email": "User email"}}
+	diff := current.Diff(desired)
+	//only descriptions of added columns are set on existing table
+	require.Equal(t, map[string]string{"email": "User email"}, diff.ColumnComments)
+	require.Empty(t, diff.Comment)
+	require.False(t, (&Table{Name: "events", Columns: Columns{"id": column, "email": column}}).Diff(desired).Exists())
+
+	descriptions, err := parseDescriptions(map[string]any{"table": "Events", "columns": map[string]any{"email": "User's email"}})
+	require.NoError(t, err)
+	require.Equal(t, Descriptions{Table: "Events", Columns: map[string]string{"email": "User's email"}}, descriptions)
+	require.Equal(t, `'User''s email'`, quotedComment(descriptions.Columns["email"], false))
+	require.Equal(t, `'C:\\temp'`, quotedComment(`C:\temp`, true))
+}
@@ -0,0 +1,101 @@
+package testcontainers
+
+import (
+	"context"
+	"fmt"
+	"github.com/docker/go-connections/nat"
+	"github.com/jitsucom/bulker/jitsubase/logging"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"github.com/testcontainers/testcontainers-go"
+	tcWait "github.com/testcontainers/testcontainers-go/wait"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	crdbUser     = "root"
+	crdbDatabase = "defaultdb"
+	crdbSchema   = "bulker"
+
+	envCockroachDBPortVariable = "CRDB_TEST_PORT"
+)
+
+// CockroachDBContainer is a single node insecure CockroachDB testcontainer
+type CockroachDBContainer struct {
+	Container testcontainers.Container
+	Context   context.Context
+	Host      string
+	Port      int
+	Database  string
+	Schema    string
+	Username  string
+}
+
+// NewCockroachDBContainer creates new CockroachDB test container if CRDB_TEST_PORT is not defined. Otherwise uses db at defined port.
+// This logic is required for running test at CI environment
+func NewCockroachDBContainer(ctx context.Context) (*CockroachDBContainer, error) {
+	if os.Getenv(envCockroachDBPortVariable) != "" {
+		port, err := strconv.Atoi(os.Getenv(envCockroachDBPortVariable))
+		if err != nil {
+			return nil, err
+		}
+		return &CockroachDBContainer{
+			Context:  ctx,
+			Host:     "localhost",
+			Port:     port,
+			Database: crdbDatabase,
+			Schema:   crdbSchema,
+			Username: crdbUser,
+		}, nil
+	}
+	dbURL := func(host string, port nat.Port) string {
+		return fmt.Sprintf("postgres://%s@%s:%s/%s?sslmode=disable", crdbUser, host, port.Port(), crdbDatabase)
+	}
+
+	exposedPort := fmt.Sprintf("%d:%d", utils.GetPort(), 26257)
+
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        "cockroachdb/cockroach:v23.1.11",
+			ExposedPorts: []string{exposedPort},
+			Cmd:          []string{"start-single-node", "--insecure"},
+			WaitingFor:   tcWait.ForSQL("26257", "postgres", dbURL).WithStartupTimeout(time.Second * 120),
+		},
+		Started: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	host, err := container.Host(ctx)
+	if err != nil {
+		container.Terminate(ctx)
+		return nil, err
+	}
+	port, err := container.MappedPort(ctx, "26257")
+	if err != nil {
+		container.Terminate(ctx)
+		return nil, err
+	}
+
+	return &CockroachDBContainer{
+		Container: container,
+		Context:   ctx,
+		Host:      host,
+		Port:      port.Int(),
+		Database:  crdbDatabase,
+		Schema:    crdbSchema,
+		Username:  crdbUser,
+	}, nil
+}
+
+// Close terminates underlying CockroachDB docker container
+func (c *CockroachDBContainer) Close() error {
+	if c.Container != nil {
+		if err := c.Container.Terminate(c.Context); err != nil {
+			logging.Errorf("Failed to stop CockroachDB container: %v", err)
+		}
+	}
+	return nil
+}
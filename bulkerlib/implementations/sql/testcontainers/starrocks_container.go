@@ -0,0 +1,93 @@
+package testcontainers
+
+import (
+	"context"
+	"fmt"
+	"github.com/jitsucom/bulker/jitsubase/logging"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"github.com/testcontainers/testcontainers-go"
+	tcWait "github.com/testcontainers/testcontainers-go/wait"
+	"time"
+)
+
+const (
+	starRocksUser     = "root"
+	starRocksDatabase = "bulker"
+	// starRocksBEHttpPort FE redirects Stream Load to BE using address known inside container (127.0.0.1:8040),
+	// so BE http port is published on the same host port
+	starRocksBEHttpPort = 8040
+)
+
+// StarRocksContainer is a StarRocks all-in-one (FE + BE) testcontainer
+type StarRocksContainer struct {
+	Container testcontainers.Container
+	Context   context.Context
+	Host      string
+	Port      int
+	HttpPort  int
+	Database  string
+	Username  string
+}
+
+// NewStarRocksContainer creates new StarRocks all-in-one test container and creates test database
+func NewStarRocksContainer(ctx context.Context) (*StarRocksContainer, error) {
+	exposedPortQuery := fmt.Sprintf("%d:%d", utils.GetPort(), 9030)
+	exposedPortHttp := fmt.Sprintf("%d:%d", utils.GetPort(), 8030)
+	exposedPortBEHttp := fmt.Sprintf("%d:%d", starRocksBEHttpPort, starRocksBEHttpPort)
+
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        "starrocks/allin1-ubuntu:3.2.6",
+			ExposedPorts: []string{exposedPortQuery, exposedPortHttp, exposedPortBEHttp},
+			WaitingFor: tcWait.ForAll(
+				tcWait.ForListeningPort("9030/tcp"),
+				tcWait.ForHTTP("/api/health").WithPort("8040/tcp"),
+			).WithDeadline(3 * time.Minute),
+		},
+		Started: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	host, err := container.Host(ctx)
+	if err != nil {
+		container.Terminate(ctx)
+		return nil, err
+	}
+	port, err := container.MappedPort(ctx, "9030")
+	if err != nil {
+		container.Terminate(ctx)
+		return nil, err
+	}
+	httpPort, err := container.MappedPort(ctx, "8030")
+	if err != nil {
+		container.Terminate(ctx)
+		return nil, err
+	}
+	_, _, err = container.Exec(ctx, []string{"mysql", "-h127.0.0.1", "-P9030", "-u" + starRocksUser, "-e", "CREATE DATABASE IF NOT EXISTS " + starRocksDatabase})
+	if err != nil {
+		container.Terminate(ctx)
+		return nil, err
+	}
+
+	return &StarRocksContainer{
+		Container: container,
+		Context:   ctx,
+		Host:      host,
+		Port:      port.Int(),
+		HttpPort:  httpPort.Int(),
+		Database:  starRocksDatabase,
+		Username:  starRocksUser,
+	}, nil
+}
+
+// Close terminates underlying StarRocks docker container
+func (c *StarRocksContainer) Close() error {
+	if c.Container != nil {
+		if err := c.Container.Terminate(c.Context); err != nil {
+			logging.Errorf("Failed to stop StarRocks container: %v", err)
+		}
+	}
+	return nil
+}
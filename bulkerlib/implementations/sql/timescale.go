@@ -0,0 +1,90 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	types2 "github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/errorj"
+	"strings"
+)
+
+const (
+	tsCreateHypertableTemplate         = `SELECT create_hypertable($1::regclass, $2::name, if_not_exists => TRUE)`
+	tsCreateHypertableIntervalTemplate = `SELECT create_hypertable($1::regclass, $2::name, chunk_time_interval => $3::interval, if_not_exists => TRUE)`
+	tsEnableCompressionTemplate        = `ALTER TABLE %s SET (timescaledb.compress%s)`
+	tsAddCompressionPolicyTemplate     = `SELECT add_compression_policy($1::regclass, $2::interval, if_not_exists => TRUE)`
+)
+
+// TimescaleConfig dto for deserialized TimescaleDB config of Postgres destination
+type TimescaleConfig struct {
+	// Hypertables create tables with timestamp column as hypertables partitioned by timestamp column
+	Hypertables bool `mapstructure:"hypertables,omitempty" json:"hypertables,omitempty" yaml:"hypertables,omitempty"`
+	// ChunkTimeInterval time interval covered by each chunk e.g. '1 day'. TimescaleDB default is used when empty
+	ChunkTimeInterval string `mapstructure:"chunkTimeInterval,omitempty" json:"chunkTimeInterval,omitempty" yaml:"chunkTimeInterval,omitempty"`
+	// CompressAfter chunks older than this interval are compressed e.g. '7 days'. Compression is disabled when empty
+	CompressAfter string `mapstructure:"compressAfter,omitempty" json:"compressAfter,omitempty" yaml:"compressAfter,omitempty"`
+	// CompressSegmentBy columns to segment compressed data by
+	CompressSegmentBy []string `mapstructure:"compressSegmentBy,omitempty" json:"compressSegmentBy,omitempty" yaml:"compressSegmentBy,omitempty"`
+}
+
+// hypertable returns true if table must be created as hypertable
+func (p *Postgres) hypertable(table *Table) bool {
+	tc := p.config.Timescale
+	if tc == nil || !tc.Hypertables || table.Temporary || table.TimestampColumn == "" {
+		return false
+	}
+	// unique indexes of hypertable must include partitioning column
+	if len(table.PKFields) > 0 && !table.PKFields.Contains(table.TimestampColumn) {
+		p.Warnf("Table %s won't be created as hypertable: primary key %v doesn't include timestamp column %s", table.Name, table.GetPKFields(), table.TimestampColumn)
+		return false
+	}
+	return true
+}
+
+// createHypertable converts just created table to hypertable and sets up compression policy if configured
+func (p *Postgres) createHypertable(ctx context.Context, table *Table) error {
+	tc := p.config.Timescale
+	quotedTableName := p.quotedTableName(table.Name)
+	statement := tsCreateHypertableTemplate
+	args := []any{quotedTableName, table.TimestampColumn}
+	if tc.ChunkTimeInterval != "" {
+		statement = tsCreateHypertableIntervalTemplate
+		args = append(args, tc.ChunkTimeInterval)
+	}
+	if _, err := p.txOrDb(ctx).ExecContext(ctx, statement, args...); err != nil {
+		return errorj.CreateTableError.Wrap(err, "failed to create hypertable").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Table:     quotedTableName,
+				Statement: statement,
+				Values:    args,
+			})
+	}
+	if tc.CompressAfter == "" {
+		return nil
+	}
+	segmentBy := ""
+	if len(tc.CompressSegmentBy) > 0 {
+		quotedColumns := make([]string, len(tc.CompressSegmentBy))
+		for i, column := range tc.CompressSegmentBy {
+			quotedColumns[i] = p.quotedColumnName(column)
+		}
+		segmentBy = fmt.Sprintf(", timescaledb.compress_segmentby = '%s'", strings.ReplaceAll(strings.Join(quotedColumns, ","), "'", "''"))
+	}
+	statement = fmt.Sprintf(tsEnableCompressionTemplate, quotedTableName, segmentBy)
+	if _, err := p.txOrDb(ctx).ExecContext(ctx, statement); err != nil {
+		return errorj.AlterTableError.Wrap(err, "failed to enable hypertable compression").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Table:     quotedTableName,
+				Statement: statement,
+			})
+	}
+	if _, err := p.txOrDb(ctx).ExecContext(ctx, tsAddCompressionPolicyTemplate, quotedTableName, tc.CompressAfter); err != nil {
+		return errorj.AlterTableError.Wrap(err, "failed to add compression policy").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Table:     quotedTableName,
+				Statement: tsAddCompressionPolicyTemplate,
+				Values:    []any{quotedTableName, tc.CompressAfter},
+			})
+	}
+	return nil
+}
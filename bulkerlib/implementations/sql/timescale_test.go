@@ -0,0 +1,73 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jitsucom/bulker/jitsubase/appbase"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// statementsRecorder records executed statements instead of running them
+type statementsRecorder struct {
+	TxOrDB
+	statements []string
+	args       [][]any
+}
+
+func (r *statementsRecorder) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	r.statements = append(r.statements, query)
+	r.args = append(r.args, args)
+	return nil, nil
+}
+
+func newTimescaleTestPostgres(config *TimescaleConfig) *Postgres {
+	p := &Postgres{SQLAdapterBase: &SQLAdapterBase[PostgresConfig]{Service: appbase.NewServiceBase("timescale_test"), config: &PostgresConfig{Timescale: config}}}
+	p.tableHelper = NewTableHelper(63, '"')
+	return p
+}
+
+func TestHypertable(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *TimescaleConfig
+		table  *Table
+		want   bool
+	}{
+		{"no_timescale", nil, &Table{Name: "events", TimestampColumn: "_timestamp"}, false},
+		{"disabled", &TimescaleConfig{}, &Table{Name: "events", TimestampColumn: "_timestamp"}, false},
+		{"timestamp_column", &TimescaleConfig{Hypertables: true}, &Table{Name: "events", TimestampColumn: "_timestamp"}, true},
+		{"no_timestamp_column", &TimescaleConfig{Hypertables: true}, &Table{Name: "events"}, false},
+		{"temporary", &TimescaleConfig{Hypertables: true}, &Table{Name: "events_tmp", TimestampColumn: "_timestamp", Temporary: true}, false},
+		{"pk_with_timestamp", &TimescaleConfig{Hypertables: true}, &Table{Name: "events", TimestampColumn: "_timestamp", PKFields: utils.NewSet("id", "_timestamp")}, true},
+		{"pk_without_timestamp", &TimescaleConfig{Hypertables: true}, &Table{Name: "events", TimestampColumn: "_timestamp", PKFields: utils.NewSet("id")}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, newTimescaleTestPostgres(tt.config).hypertable(tt.table))
+		})
+	}
+}
+
+func TestCreateHypertable(t *testing.T) {
+	table := &Table{Name: "events", TimestampColumn: "_timestamp"}
+
+	recorder := &statementsRecorder{}
+	ctx := context.WithValue(context.Background(), ContextTransactionKey, recorder)
+	p := newTimescaleTestPostgres(&TimescaleConfig{Hypertables: true})
+	require.NoError(t, p.createHypertable(ctx, table))
+	require.Equal(t, []string{tsCreateHypertableTemplate}, recorder.statements)
+	require.Equal(t, [][]any{{`"events"`, "_timestamp"}}, recorder.args)
+
+	recorder = &statementsRecorder{}
+	ctx = context.WithValue(context.Background(), ContextTransactionKey, recorder)
+	p = newTimescaleTestPostgres(&TimescaleConfig{Hypertables: true, ChunkTimeInterval: "1 day", CompressAfter: "7 days", CompressSegmentBy: []string{"user_id", "event"}})
+	require.NoError(t, p.createHypertable(ctx, table))
+	require.Equal(t, []string{
+		tsCreateHypertableIntervalTemplate,
+		`ALTER TABLE "events" SET (timescaledb.compress, timescaledb.compress_segmentby = '"user_id","event"')`,
+		tsAddCompressionPolicyTemplate,
+	}, recorder.statements)
+	require.Equal(t, [][]any{{`"events"`, "_timestamp", "1 day"}, nil, {`"events"`, "7 days"}}, recorder.args)
+}
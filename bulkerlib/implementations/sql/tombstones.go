@@ -0,0 +1,227 @@
+package sql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/errorj"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"strings"
+	"time"
+)
+
+// Modes of tombstones handling. See TombstonesOption
+const (
+	// TombstonesHard rows matching primary key of tombstone are deleted
+	TombstonesHard = "hard"
+	// TombstonesSoft flag column of rows matching primary key of tombstone is set to true
+	TombstonesSoft = "soft"
+
+	// DefaultDeletedMarkerField field of object that marks object as tombstone
+	DefaultDeletedMarkerField = "__deleted"
+	// DefaultDeletedFlagColumn column that is set to true for soft deleted rows
+	DefaultDeletedFlagColumn = "_deleted"
+)
+
+// TombstonesConfig handling of delete events. See TombstonesOption
+type TombstonesConfig struct {
+	// Mode "hard" or "soft"
+	Mode string `json:"mode"`
+	// Field marker field of tombstone objects. Object is a tombstone when field value is true or "true". Default: __deleted
+	Field string `json:"field,omitempty"`
+	// Column flag column of "soft" mode. Default: _deleted
+	Column string `json:"column,omitempty"`
+}
+
+// Validate returns err if invalid
+func (c *TombstonesConfig) Validate() error {
+	switch c.Mode {
+	case TombstonesHard, TombstonesSoft:
+	default:
+		return fmt.Errorf("unsupported tombstones mode: %s. Supported: %s, %s", c.Mode, TombstonesHard, TombstonesSoft)
+	}
+	if c.Field == "" {
+		c.Field = DefaultDeletedMarkerField
+	}
+	if c.Column == "" {
+		c.Column = DefaultDeletedFlagColumn
+	}
+	return nil
+}
+
+// tombstone removes marker field from object and returns true if object is a tombstone.
+// In soft mode flag column of regular objects is set to false, so rows deleted earlier are restored by upsert.
+// Provided object is not modified
+func (c *TombstonesConfig) tombstone(object types.Object) (types.Object, bool) {
+	marker, hasMarker := object[c.Field]
+	if !hasMarker && c.Mode != TombstonesSoft {
+		return object, false
+	}
+	objCopy := utils.MapCopy(object)
+	delete(objCopy, c.Field)
+	deleted := marker == true || marker == "true"
+	if !deleted && c.Mode == TombstonesSoft {
+		objCopy[c.Column] = false
+	}
+	return objCopy, deleted
+}
+
+func parseTombstonesConfig(serialized any) (*TombstonesConfig, error) {
+	var raw []byte
+	switch v := serialized.(type) {
+	case *TombstonesConfig:
+		return v, v.Validate()
+	case string:
+		if !strings.HasPrefix(strings.TrimSpace(v), "{") {
+			config := &TombstonesConfig{Mode: v}
+			return config, config.Validate()
+		}
+		raw = []byte(v)
+	default:
+		var err error
+		raw, err = json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value type of tombstones option: %T", v)
+		}
+	}
+	config := &TombstonesConfig{}
+	if err := json.Unmarshal(raw, config); err != nil {
+		return nil, fmt.Errorf("failed to parse tombstones config: %v", err)
+	}
+	return config, config.Validate()
+}
+
+// WithHardDeletes makes streams with deduplication delete rows matching primary key of tombstone objects (objects with __deleted: true)
+func WithHardDeletes() bulker.StreamOption {
+	return bulker.WithOption(&TombstonesOption, &TombstonesConfig{Mode: TombstonesHard, Field: DefaultDeletedMarkerField, Column: DefaultDeletedFlagColumn})
+}
+
+// WithDeletedFlagColumn makes streams with deduplication set provided flag column of rows matching primary key
+// of tombstone objects (objects with __deleted: true) instead of deleting them
+func WithDeletedFlagColumn(column string) bulker.StreamOption {
+	return bulker.WithOption(&TombstonesOption, &TombstonesConfig{Mode: TombstonesSoft, Field: DefaultDeletedMarkerField, Column: column})
+}
+
+// validateTombstonesOption checks that stream and adapter support tombstones handling
+func validateTombstonesOption(p SQLAdapter, mode bulker.BulkMode, merge bool, config *TombstonesConfig) error {
+	if config == nil {
+		return nil
+	}
+	if mode != bulker.Batch && mode != bulker.Stream && mode != bulker.CDC {
+		return fmt.Errorf("tombstones option is supported only in %s, %s and %s modes", bulker.Batch, bulker.Stream, bulker.CDC)
+	}
+	if !merge {
+		return fmt.Errorf("tombstones option requires deduplication. Please provide WithDeduplicate and WithPrimaryKey options")
+	}
+	if _, ok := p.(KeysDeleter); !ok {
+		return fmt.Errorf("%s doesn't support deleting rows by tombstones", p.Type())
+	}
+	if _, ok := p.(ColumnsUpdater); !ok && config.Mode == TombstonesSoft {
+		return fmt.Errorf("%s doesn't support flagging rows as deleted by tombstones", p.Type())
+	}
+	return nil
+}
+
+// tombstoneKey returns primary key value and object with primary key columns of processed tombstone object
+func (ps *AbstractSQLStream) tombstoneKey(processedObject types.Object) (string, types.Object, error) {
+	keyObject := make(types.Object, len(ps.pkColumns))
+	keyValues := make([]string, 0, len(ps.pkColumns))
+	for _, pkColumn := range ps.pkColumns {
+		column := ps.sqlAdapter.ColumnName(pkColumn)
+		value, ok := processedObject[column]
+		if !ok || value == nil {
+			return "", nil, fmt.Errorf("tombstone object doesn't contain primary key column: %s", pkColumn)
+		}
+		keyObject[column] = value
+		keyValues = append(keyValues, fmt.Sprint(value))
+	}
+	return strings.Join(keyValues, "_###_"), keyObject, nil
+}
+
+// applyTombstones deletes or flags rows of destination table matching primary keys of tombstones within transaction tx.
+// Keys are loaded to temporary table first, so rows are deleted with a single statement
+func (ps *AbstractSQLStream) applyTombstones(ctx context.Context, tx *TxSQLAdapter, tombstones []types.Object) (state *bulker.WarehouseState, err error) {
+	if len(tombstones) == 0 {
+		return nil, nil
+	}
+	dstTable, err := tx.GetTableSchema(ctx, ps.tableName)
+	if err != nil {
+		return nil, errorj.Decorate(err, "failed to get destination table schema")
+	}
+	if !dstTable.Exists() {
+		//nothing to delete
+		return nil, nil
+	}
+	if ps.tombstones.Mode != TombstonesSoft {
+		return ps.deleteTombstoned(ctx, tx, dstTable, tombstones)
+	}
+	flagColumn := ps.sqlAdapter.ColumnName(ps.tombstones.Column)
+	boolType, _ := ps.sqlAdapter.GetSQLType(types.BOOL)
+	if _, ok := dstTable.Columns[flagColumn]; !ok {
+		//flag column is added to destination table by the first tombstone
+		patchTable := dstTable.Clone()
+		patchTable.Columns[flagColumn] = types.SQLColumn{DataType: types.BOOL, Type: boolType, New: true}
+		dstTable, err = ps.sqlAdapter.TableHelper().EnsureTableWithoutCaching(ctx, tx, ps.id, patchTable)
+		if err != nil {
+			return nil, errorj.Decorate(err, "failed to add deleted flag column")
+		}
+	}
+	flagged := make([]types.Object, len(tombstones))
+	for i, tombstone := range tombstones {
+		flagged[i] = utils.MapCopy(tombstone)
+		flagged[i][flagColumn] = true
+	}
+	keysTable, keyColumns, err := ps.createTombstonesTable(ctx, tx, dstTable, flagged, Columns{flagColumn: types.SQLColumn{DataType: types.BOOL, Type: boolType}})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Drop(ctx, keysTable, true)
+	}()
+	targetTable := dstTable.Clone()
+	targetTable.PKFields = utils.NewSet(keyColumns...)
+	return tx.UpdateColumns(ctx, targetTable, keysTable)
+}
+
+// deleteTombstoned deletes rows of provided table matching primary keys of tombstones within transaction tx
+func (ps *AbstractSQLStream) deleteTombstoned(ctx context.Context, tx *TxSQLAdapter, table *Table, tombstones []types.Object) (*bulker.WarehouseState, error) {
+	keysTable, keyColumns, err := ps.createTombstonesTable(ctx, tx, table, tombstones, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Drop(ctx, keysTable, true)
+	}()
+	return tx.DeleteByKeys(ctx, table, keysTable, keyColumns)
+}
+
+// createTombstonesTable creates temporary table with primary key columns of provided table and extra columns and inserts tombstones into it
+func (ps *AbstractSQLStream) createTombstonesTable(ctx context.Context, tx *TxSQLAdapter, table *Table, tombstones []types.Object, extraColumns Columns) (*Table, []string, error) {
+	keyColumns := make([]string, len(ps.pkColumns))
+	keysTable := &Table{
+		Name:      fmt.Sprintf("%s_del%s", utils.ShortenString(ps.tableName, 47), time.Now().Format("060102150405")),
+		Temporary: true,
+		Columns:   Columns{},
+	}
+	for i, pkColumn := range ps.pkColumns {
+		keyColumns[i] = ps.sqlAdapter.ColumnName(pkColumn)
+		column, ok := table.Columns[keyColumns[i]]
+		if !ok {
+			return nil, nil, fmt.Errorf("table %s doesn't contain primary key column: %s", table.Name, keyColumns[i])
+		}
+		keysTable.Columns[keyColumns[i]] = column
+	}
+	for name, column := range extraColumns {
+		keysTable.Columns[name] = column
+	}
+	if err := tx.CreateTable(ctx, keysTable); err != nil {
+		return nil, nil, errorj.Decorate(err, "failed to create table for tombstones")
+	}
+	if err := tx.Insert(ctx, keysTable, false, tombstones...); err != nil {
+		_ = tx.Drop(ctx, keysTable, true)
+		return nil, nil, errorj.Decorate(err, "failed to insert tombstones")
+	}
+	return keysTable, keyColumns, nil
+}
@@ -0,0 +1,147 @@
+package sql
+
+import (
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+)
+
+// TestTombstonesHardDelete checks that tombstones delete rows with matching primary key
+func TestTombstonesHardDelete(t *testing.T) {
+	t.Parallel()
+	configIds := utils.ArrayIntersection(allBulkerConfigs, []string{BigqueryBulkerTypeId, RedshiftBulkerTypeId, SnowflakeBulkerTypeId, PostgresBulkerTypeId, MySQLBulkerTypeId})
+	runTombstonesTests(t, []bulkerTestConfig{
+		{
+			//delete any table leftovers from previous tests
+			name:      "dummy_test_table_cleanup",
+			tableName: "tombstones_hard_test",
+			modes:     []bulker.BulkMode{bulker.Batch, bulker.Stream},
+			dataFile:  "test_data/empty.ndjson",
+			configIds: configIds,
+		},
+		{
+			name:                "first_load",
+			tableName:           "tombstones_hard_test",
+			modes:               []bulker.BulkMode{bulker.Batch, bulker.Stream},
+			leaveResultingTable: true,
+			dataFile:            "test_data/partition1.ndjson",
+			expectedRowsCount:   5,
+			streamOptions:       []bulker.StreamOption{bulker.WithPrimaryKey("id"), bulker.WithDeduplicate(), WithHardDeletes()},
+			configIds:           configIds,
+		},
+		{
+			name:                "tombstones",
+			tableName:           "tombstones_hard_test",
+			modes:               []bulker.BulkMode{bulker.Batch, bulker.Stream},
+			leaveResultingTable: true,
+			dataFile:            "test_data/tombstones.ndjson",
+			expectedRows: []map[string]any{
+				{"_timestamp": constantTime, "id": 1, "name": "test"},
+				{"_timestamp": constantTime, "id": 3, "name": "test3B"},
+				{"_timestamp": constantTime, "id": 5, "name": "test5B"},
+			},
+			streamOptions: []bulker.StreamOption{bulker.WithPrimaryKey("id"), bulker.WithDeduplicate(), WithHardDeletes()},
+			configIds:     configIds,
+		},
+		{
+			name:      "dummy_test_table_cleanup",
+			tableName: "tombstones_hard_test",
+			modes:     []bulker.BulkMode{bulker.Batch, bulker.Stream},
+			dataFile:  "test_data/empty.ndjson",
+			configIds: configIds,
+		},
+	})
+}
+
+// TestTombstonesSoftDelete checks that tombstones set deleted flag column of rows with matching primary key
+func TestTombstonesSoftDelete(t *testing.T) {
+	t.Parallel()
+	configIds := utils.ArrayIntersection(allBulkerConfigs, []string{BigqueryBulkerTypeId, RedshiftBulkerTypeId, SnowflakeBulkerTypeId, PostgresBulkerTypeId, MySQLBulkerTypeId})
+	runTombstonesTests(t, []bulkerTestConfig{
+		{
+			//delete any table leftovers from previous tests
+			name:      "dummy_test_table_cleanup",
+			tableName: "tombstones_soft_test",
+			modes:     []bulker.BulkMode{bulker.Batch},
+			dataFile:  "test_data/empty.ndjson",
+			configIds: configIds,
+		},
+		{
+			name:                "first_load",
+			tableName:           "tombstones_soft_test",
+			modes:               []bulker.BulkMode{bulker.Batch},
+			leaveResultingTable: true,
+			dataFile:            "test_data/partition1.ndjson",
+			expectedRowsCount:   5,
+			streamOptions:       []bulker.StreamOption{bulker.WithPrimaryKey("id"), bulker.WithDeduplicate()},
+			configIds:           configIds,
+		},
+		{
+			name:                "tombstones",
+			tableName:           "tombstones_soft_test",
+			modes:               []bulker.BulkMode{bulker.Batch},
+			leaveResultingTable: true,
+			dataFile:            "test_data/tombstones.ndjson",
+			expectedRows: []map[string]any{
+				{"_timestamp": constantTime, "id": 1, "name": "test", "_deleted": nil},
+				{"_timestamp": constantTime, "id": 2, "name": "test2", "_deleted": true},
+				{"_timestamp": constantTime, "id": 3, "name": "test3B", "_deleted": false},
+				{"_timestamp": constantTime, "id": 4, "name": "test4", "_deleted": true},
+				{"_timestamp": constantTime, "id": 5, "name": "test5B", "_deleted": false},
+			},
+			streamOptions: []bulker.StreamOption{bulker.WithPrimaryKey("id"), bulker.WithDeduplicate(), WithDeletedFlagColumn("_deleted")},
+			configIds:     configIds,
+		},
+		{
+			name:      "dummy_test_table_cleanup",
+			tableName: "tombstones_soft_test",
+			modes:     []bulker.BulkMode{bulker.Batch},
+			dataFile:  "test_data/empty.ndjson",
+			configIds: configIds,
+		},
+	})
+}
+
+func runTombstonesTests(t *testing.T, tests []bulkerTestConfig) {
+	sequentialGroup := sync.WaitGroup{}
+	sequentialGroup.Add(1)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runTestConfig(t, tt, testStream)
+			sequentialGroup.Done()
+		})
+		sequentialGroup.Wait()
+		sequentialGroup.Add(1)
+	}
+}
+
+func TestParseTombstonesConfig(t *testing.T) {
+	config, err := parseTombstonesConfig("hard")
+	require.NoError(t, err)
+	require.Equal(t, &TombstonesConfig{Mode: TombstonesHard, Field: DefaultDeletedMarkerField, Column: DefaultDeletedFlagColumn}, config)
+
+	config, err = parseTombstonesConfig(`{"mode": "soft", "field": "_op_deleted", "column": "is_deleted"}`)
+	require.NoError(t, err)
+	require.Equal(t, &TombstonesConfig{Mode: TombstonesSoft, Field: "_op_deleted", Column: "is_deleted"}, config)
+
+	_, err = parseTombstonesConfig("archive")
+	require.Error(t, err)
+}
+
+func TestTombstoneMarker(t *testing.T) {
+	hard := &TombstonesConfig{Mode: TombstonesHard, Field: DefaultDeletedMarkerField}
+	object, deleted := hard.tombstone(types.Object{"id": 1, "__deleted": true})
+	require.True(t, deleted)
+	require.Equal(t, types.Object{"id": 1}, object)
+	object, deleted = hard.tombstone(types.Object{"id": 1, "__deleted": "false"})
+	require.False(t, deleted)
+	require.Equal(t, types.Object{"id": 1}, object)
+
+	soft := &TombstonesConfig{Mode: TombstonesSoft, Field: DefaultDeletedMarkerField, Column: DefaultDeletedFlagColumn}
+	object, deleted = soft.tombstone(types.Object{"id": 1})
+	require.False(t, deleted)
+	require.Equal(t, types.Object{"id": 1, "_deleted": false}, object)
+}
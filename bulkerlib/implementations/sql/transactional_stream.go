@@ -17,26 +17,48 @@ type TransactionalStream struct {
 }
 
 func newTransactionalStream(id string, p SQLAdapter, tableName string, streamOptions ...bulker.StreamOption) (bulker.BulkerStream, error) {
+	ps, err := newTransactionalStreamOfMode(id, p, tableName, bulker.Batch, streamOptions...)
+	if err != nil {
+		return nil, err
+	}
+	return ps, nil
+}
+
+// newTransactionalStreamOfMode creates TransactionalStream for modes that are built on top of Batch mode
+func newTransactionalStreamOfMode(id string, p SQLAdapter, tableName string, mode bulker.BulkMode, streamOptions ...bulker.StreamOption) (*TransactionalStream, error) {
 	ps := TransactionalStream{}
 	var err error
-	ps.AbstractTransactionalSQLStream, err = newAbstractTransactionalStream(id, p, tableName, bulker.Batch, streamOptions...)
+	ps.AbstractTransactionalSQLStream, err = newAbstractTransactionalStream(id, p, tableName, mode, streamOptions...)
 	if err != nil {
 		return nil, err
 	}
+	if aggregation := AggregationOption.Get(&ps.options); aggregation != nil {
+		ps.aggregator = newBatchAggregator(aggregation, ps.sqlAdapter)
+	}
+	stagingSchema := StagingSchemaOption.Get(&ps.options)
+	if err = validateStagingSchemaOption(p, mode, stagingSchema); err != nil {
+		return nil, err
+	}
 	ps.existingTable, _ = ps.sqlAdapter.GetTableSchema(context.Background(), ps.tableName)
-	ps.tmpTableFunc = func(ctx context.Context, tableForObject *Table, object types.Object) (table *Table) {
+	ps.tmpTableFunc = func(ctx context.Context, tableForObject *Table, object types.Object) (table *Table, err error) {
 		dstTable := tableForObject
-		ps.adjustTableColumnTypes(dstTable, ps.existingTable, tableForObject, object)
+		if _, err = ps.adjustTableColumnTypes(dstTable, ps.existingTable, tableForObject, object); err != nil {
+			return nil, err
+		}
 		if ps.schemaFromOptions != nil {
-			ps.adjustTableColumnTypes(dstTable, ps.existingTable, ps.schemaFromOptions, object)
+			if _, err = ps.adjustTableColumnTypes(dstTable, ps.existingTable, ps.schemaFromOptions, object); err != nil {
+				return nil, err
+			}
 		}
 		tmpTableName := fmt.Sprintf("%s_tmp%s", utils.ShortenString(tableName, 47), time.Now().Format("060102150405"))
 		return &Table{
 			Name:            tmpTableName,
+			Namespace:       stagingSchema,
 			Columns:         dstTable.Columns,
 			Temporary:       true,
 			TimestampColumn: tableForObject.TimestampColumn,
-		}
+			VersionColumn:   tableForObject.VersionColumn,
+		}, nil
 	}
 	return &ps, nil
 }
@@ -57,27 +79,57 @@ func (ps *TransactionalStream) Complete(ctx context.Context) (state bulker.State
 	}()
 	//if at least one object was inserted
 	if ps.state.SuccessfulRows > 0 {
-		if ps.batchFile != nil {
+		var duplicate bool
+		if duplicate, err = ps.skipDuplicate(ctx); duplicate || err != nil {
+			return ps.state, err
+		}
+		if err = ps.checkQuality(); err != nil {
+			return ps.state, err
+		}
+		if ps.aggregator != nil {
+			if err = ps.flushAggregates(ctx); err != nil {
+				return ps.state, err
+			}
+		}
+		//tmp table is nil when batch consists of tombstones only
+		if ps.batchFile != nil && ps.tmpTable != nil {
 			ws, err := ps.flushBatchFile(ctx)
 			ps.state.AddWarehouseState(ws)
 			if err != nil {
 				return ps.state, err
 			}
 		}
-		var dstTable *Table
-		dstTable, err = ps.sqlAdapter.TableHelper().EnsureTableWithoutCaching(ctx, ps.tx, ps.id, ps.dstTable)
-		if err != nil {
+		if ps.tmpTable != nil {
+			var dstTable *Table
+			dstTable, err = ps.sqlAdapter.TableHelper().EnsureTableWithoutCaching(ctx, ps.tx, ps.id, ps.dstTable)
+			if err != nil {
+				ps.updateRepresentationTable(ps.dstTable)
+				return ps.state, errorj.Decorate(err, "failed to ensure destination table")
+			}
+			ps.dstTable = dstTable
 			ps.updateRepresentationTable(ps.dstTable)
-			return ps.state, errorj.Decorate(err, "failed to ensure destination table")
 		}
-		ps.dstTable = dstTable
-		ps.updateRepresentationTable(ps.dstTable)
-		//copy data from tmp table to destination table
-		ws, err := ps.tx.CopyTables(ctx, ps.dstTable, ps.tmpTable, ps.mergeWindow)
+		if err = ps.runPreCommitHook(ctx); err != nil {
+			return ps.state, err
+		}
+		//delete or flag rows of tombstones before new rows are copied
+		ws, err := ps.applyPendingTombstones(ctx)
 		ps.state.AddWarehouseState(ws)
 		if err != nil {
 			return ps.state, err
 		}
+		if ps.tmpTable != nil {
+			//copy data from tmp table to destination table
+			ws, err = ps.tx.CopyTables(ctx, ps.dstTable, ps.tmpTable, ps.mergeWindow)
+			ps.state.AddWarehouseState(ws)
+			if err != nil {
+				return ps.state, err
+			}
+		}
+		//run transform from raw table to clean table in the same transaction
+		if err = ps.runTransform(ctx); err != nil {
+			return ps.state, err
+		}
 		return ps.state, nil
 	} else {
 		//if was any error - it will trigger transaction rollback in defer func
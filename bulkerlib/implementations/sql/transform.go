@@ -0,0 +1,92 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/jitsubase/errorj"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// transformLastRuns time of the latest successful transform per stream id and raw table.
+// Used to run transforms not more often than 'transformIntervalSec'
+var transformLastRuns = sync.Map{}
+
+// transformTemplateData values available in transform SQL template. Table names are fully qualified and quoted
+type transformTemplateData struct {
+	RawTable   string
+	CleanTable string
+}
+
+// renderTransformSQL substitutes {{.RawTable}} and {{.CleanTable}} placeholders in transform SQL
+func renderTransformSQL(transformSQL, rawTable, cleanTable string) (string, error) {
+	tmpl, err := template.New("transform").Option("missingkey=error").Parse(transformSQL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse transform SQL: %v", err)
+	}
+	var buf strings.Builder
+	if err = tmpl.Execute(&buf, transformTemplateData{RawTable: rawTable, CleanTable: cleanTable}); err != nil {
+		return "", fmt.Errorf("failed to render transform SQL: %v", err)
+	}
+	return buf.String(), nil
+}
+
+func validateTransformSQL(transformSQL string) error {
+	_, err := renderTransformSQL(transformSQL, "raw", "clean")
+	return err
+}
+
+// runTransform runs transform SQL from raw table to clean table within stream transaction.
+// Transform is skipped if 'transformIntervalSec' hasn't passed since the previous run
+func (ps *AbstractTransactionalSQLStream) runTransform(ctx context.Context) error {
+	transformSQL := TransformSQLOption.Get(&ps.options)
+	if transformSQL == "" {
+		return nil
+	}
+	cleanTable := TransformTableOption.Get(&ps.options)
+	if cleanTable == "" {
+		cleanTable = ps.tableName + "_clean"
+	}
+	key := ps.id + ":" + ps.tableName
+	transformState := &bulker.TransformState{CleanTable: cleanTable}
+	ps.state.Transform = transformState
+	interval := time.Duration(TransformIntervalOption.Get(&ps.options)) * time.Second
+	if lastRun, ok := transformLastRuns.Load(key); ok {
+		transformState.LastRunAt = lastRun.(time.Time)
+		if interval > 0 && time.Since(transformState.LastRunAt) < interval {
+			return nil
+		}
+	}
+	startTime := time.Now()
+	ws, err := ps.tx.RunTransform(ctx, transformSQL, ps.tableName, cleanTable)
+	ps.state.AddWarehouseState(ws)
+	if err != nil {
+		return errorj.Decorate(err, "failed to run transform to clean table")
+	}
+	transformState.Executed = true
+	transformState.LastRunAt = startTime
+	transformState.ProcessingTimeSec = time.Since(startTime).Seconds()
+	return nil
+}
+
+// commitTransformRun remembers time of transform run after transaction was committed,
+// so failed transactions don't postpone the next run
+func (ps *AbstractTransactionalSQLStream) commitTransformRun() {
+	if ps.state.Transform != nil && ps.state.Transform.Executed {
+		transformLastRuns.Store(ps.id+":"+ps.tableName, ps.state.Transform.LastRunAt)
+	}
+}
+
+// WithTransform enables two-stage load: batch is landed to the stream table as raw data,
+// then transformSQL is run to populate cleanTable. transformSQL may use {{.RawTable}} and {{.CleanTable}} placeholders.
+// intervalSec > 0 runs transform not more often than once per interval, otherwise it is run after each batch
+func WithTransform(transformSQL, cleanTable string, intervalSec int) bulker.StreamOption {
+	return func(options *bulker.StreamOptions) {
+		TransformSQLOption.Set(options, transformSQL)
+		TransformTableOption.Set(options, cleanTable)
+		TransformIntervalOption.Set(options, intervalSec)
+	}
+}
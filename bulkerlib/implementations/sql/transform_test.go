@@ -0,0 +1,19 @@
+package sql
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestRenderTransformSQL(t *testing.T) {
+	query, err := renderTransformSQL(`INSERT INTO {{.CleanTable}} SELECT DISTINCT id, name FROM {{.RawTable}}`, `"public"."events"`, `"public"."events_clean"`)
+	require.NoError(t, err)
+	require.Equal(t, `INSERT INTO "public"."events_clean" SELECT DISTINCT id, name FROM "public"."events"`, query)
+
+	require.NoError(t, validateTransformSQL("DELETE FROM {{.RawTable}}"))
+	require.ErrorContains(t, validateTransformSQL("INSERT INTO {{.CleanTable} SELECT 1"), "failed to parse transform SQL")
+	require.ErrorContains(t, validateTransformSQL("INSERT INTO {{.Target}} SELECT 1"), "failed to render transform SQL")
+
+	_, err = TransformSQLOption.Parse("INSERT INTO {{.Clean}} SELECT 1")
+	require.ErrorContains(t, err, "failed to render transform SQL")
+}
@@ -0,0 +1,506 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/implementations"
+	types2 "github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/errorj"
+	"github.com/jitsucom/bulker/jitsubase/logging"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+)
+
+func init() {
+	bulker.RegisterBulker(TrinoBulkerTypeId, NewTrino)
+	bulker.RegisterConfigType(TrinoBulkerTypeId, TrinoConfig{})
+}
+
+const (
+	TrinoBulkerTypeId = "trino"
+
+	trinoCreateSchemaIfNotExistsTemplate = `CREATE SCHEMA IF NOT EXISTS %s`
+	trinoTableSchemaQuery                = `SELECT column_name, data_type FROM information_schema.columns WHERE table_schema = ? AND table_name = ?`
+	trinoTableCommentQuery               = `SELECT comment FROM system.metadata.table_comments WHERE catalog_name = ? AND schema_name = ? AND table_name = ?`
+	trinoCommentTemplate                 = `COMMENT ON TABLE %s IS %s`
+	trinoCreateExternalTableTemplate     = `CREATE TABLE %s (%s) WITH (external_location = '%s', format = 'CSV', skip_header_line_count = 1)`
+	trinoInsertFromStagingTemplate       = `INSERT INTO %s (%s) SELECT %s FROM %s`
+
+	trinoMergeStatement = `MERGE INTO {{.TableTo}} T USING (SELECT {{.Columns}} FROM {{.TableFrom}} ) S ON {{.JoinConditions}} WHEN MATCHED THEN UPDATE SET {{.UpdateSet}} WHEN NOT MATCHED THEN INSERT ({{.Columns}}) VALUES ({{.SourceColumns}})`
+
+	// Trino doesn't support primary keys. Bulker keeps primary key in table comment: bulker_primary_key=<name>:<field1>,<field2>
+	trinoPrimaryKeyCommentPrefix = "bulker_primary_key="
+)
+
+var (
+	trinoMergeQueryTemplate, _ = template.New("trinoMergeQuery").Parse(trinoMergeStatement)
+
+	trinoTypes = map[types2.DataType][]string{
+		types2.STRING:    {"varchar", "char%"},
+		types2.INT64:     {"bigint", "integer", "smallint", "tinyint"},
+		types2.FLOAT64:   {"double", "real", "decimal%"},
+		types2.TIMESTAMP: {"timestamp(6) with time zone", "timestamp%"},
+		types2.BOOL:      {"boolean"},
+		types2.JSON:      {"varchar"},
+		types2.UNKNOWN:   {"varchar"},
+	}
+)
+
+// TrinoConfig dto for deserialized datasource config for Trino
+type TrinoConfig struct {
+	Host     string `mapstructure:"host,omitempty" json:"host,omitempty" yaml:"host,omitempty"`
+	Port     int    `mapstructure:"port,omitempty" json:"port,omitempty" yaml:"port,omitempty"`
+	Username string `mapstructure:"username,omitempty" json:"username,omitempty" yaml:"username,omitempty"`
+	Password string `mapstructure:"password,omitempty" json:"password,omitempty" yaml:"password,omitempty"`
+	SSL      bool   `mapstructure:"ssl,omitempty" json:"ssl,omitempty" yaml:"ssl,omitempty"`
+	// Catalog target catalog, e.g. iceberg or hive
+	Catalog string `mapstructure:"catalog,omitempty" json:"catalog,omitempty" yaml:"catalog,omitempty"`
+	Schema  string `mapstructure:"defaultSchema,omitempty" json:"defaultSchema,omitempty" yaml:"defaultSchema,omitempty"`
+	// StagingCatalog Hive catalog where external tables over staged batch files are created. Default: hive
+	StagingCatalog string `mapstructure:"stagingCatalog,omitempty" json:"stagingCatalog,omitempty" yaml:"stagingCatalog,omitempty"`
+	// StagingSchema schema in StagingCatalog for external tables. Default: same as defaultSchema
+	StagingSchema string `mapstructure:"stagingSchema,omitempty" json:"stagingSchema,omitempty" yaml:"stagingSchema,omitempty"`
+	// S3Endpoint custom endpoint of S3 compatible storage used for staging. Deprecated: use endpoint
+	S3Endpoint     string `mapstructure:"s3Endpoint,omitempty" json:"s3Endpoint,omitempty" yaml:"s3Endpoint,omitempty"`
+	S3OptionConfig `mapstructure:",squash" yaml:"-,inline"`
+}
+
+// Validate required fields in TrinoConfig
+func (tc *TrinoConfig) Validate() error {
+	if tc == nil {
+		return errors.New("Trino config is required")
+	}
+	if tc.Host == "" {
+		return errors.New("Trino host is required parameter")
+	}
+	if tc.Username == "" {
+		return errors.New("Trino username is required parameter")
+	}
+	if tc.Catalog == "" {
+		return errors.New("Trino catalog is required parameter")
+	}
+	if tc.Schema == "" {
+		return errors.New("Trino defaultSchema is required parameter")
+	}
+	if tc.Port == 0 {
+		if tc.SSL {
+			tc.Port = 443
+		} else {
+			tc.Port = 8080
+		}
+	}
+	if tc.StagingCatalog == "" {
+		tc.StagingCatalog = "hive"
+	}
+	if tc.StagingSchema == "" {
+		tc.StagingSchema = tc.Schema
+	}
+	return nil
+}
+
+// Trino is adapter for creating, patching (schema or table) and inserting data to Trino catalogs.
+// Batches are staged as CSV files on S3 and loaded through temporary Hive external table.
+// Without S3 configuration rows are inserted with INSERT statements.
+type Trino struct {
+	*SQLAdapterBase[TrinoConfig]
+}
+
+// NewTrino returns configured Trino adapter instance
+func NewTrino(bulkerConfig bulker.Config) (bulker.Bulker, error) {
+	config := &TrinoConfig{}
+	if err := utils.ParseObject(bulkerConfig.DestinationConfig, config); err != nil {
+		return nil, fmt.Errorf("failed to parse destination config: %v", err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	dbConnectFunction := func(config *TrinoConfig) (*sql.DB, error) {
+		dataSource := sql.OpenDB(&trinoConnector{client: newTrinoClient(config)})
+		if err := dataSource.Ping(); err != nil {
+			_ = dataSource.Close()
+			return nil, err
+		}
+		dataSource.SetConnMaxIdleTime(3 * time.Minute)
+		dataSource.SetMaxIdleConns(10)
+		return dataSource, nil
+	}
+	typecastFunc := func(placeholder string, column types2.SQLColumn) string {
+		if column.Override {
+			return fmt.Sprintf("CAST(%s AS %s)", placeholder, column.Type)
+		}
+		return placeholder
+	}
+	var queryLogger *logging.QueryLogger
+	if bulkerConfig.LogLevel == bulker.Verbose {
+		queryLogger = logging.NewQueryLogger(bulkerConfig.Id, os.Stderr, os.Stderr)
+	}
+	sqlAdapter, err := newSQLAdapterBase(bulkerConfig.Id, TrinoBulkerTypeId, config, dbConnectFunction, trinoTypes, queryLogger, typecastFunc, QuestionMarkParameterPlaceholder, trinoColumnDDL, unmappedValue, checkErr)
+	t := &Trino{sqlAdapter}
+	t.temporaryTables = false
+	// Hive CSV tables require all columns to be varchar. Values are cast to target types on insert
+	t.batchFileFormat = types2.FileFormatCSV
+	t.statementTimeout = time.Duration(bulkerConfig.StatementTimeoutSec) * time.Second
+	t.setConnMaxLifetime(time.Duration(bulkerConfig.ConnMaxLifetimeSec) * time.Second)
+	t.tableHelper = NewTableHelper(128, '"')
+	t.tableHelper.tableNameFunc = trinoIdentifierFunction
+	t.tableHelper.columnNameFunc = trinoIdentifierFunction
+	return t, err
+}
+
+func (t *Trino) CreateStream(id, tableName string, mode bulker.BulkMode, streamOptions ...bulker.StreamOption) (bulker.BulkerStream, error) {
+	if t.config.Bucket != "" {
+		streamOptions = append(streamOptions, withLocalBatchFile(fmt.Sprintf("bulker_%s", utils.SanitizeString(id))))
+	}
+	if err := t.validateOptions(streamOptions); err != nil {
+		return nil, err
+	}
+	switch mode {
+	case bulker.Stream:
+		return newAutoCommitStream(id, t, tableName, streamOptions...)
+	case bulker.Batch:
+		return newTransactionalStream(id, t, tableName, streamOptions...)
+	case bulker.ReplaceTable:
+		return newReplaceTableStream(id, t, tableName, streamOptions...)
+	case bulker.ReplacePartition:
+		return newReplacePartitionStream(id, t, tableName, streamOptions...)
+	}
+	return nil, fmt.Errorf("unsupported bulk mode: %s", mode)
+}
+
+func (t *Trino) validateOptions(streamOptions []bulker.StreamOption) error {
+	options := &bulker.StreamOptions{}
+	for _, option := range streamOptions {
+		options.Add(option)
+	}
+	return nil
+}
+
+// SupportsSavepoints Trino has no transactions that span multiple statements
+func (t *Trino) SupportsSavepoints() bool {
+	return false
+}
+
+// OpenTx returns TxSQLAdapter that executes statements without transaction: every statement is committed on its own
+func (t *Trino) OpenTx(ctx context.Context) (*TxSQLAdapter, error) {
+	return &TxSQLAdapter{sqlAdapter: t, tx: NewDbWrapper(t.Type(), t.dataSource, t.queryLogger, t.checkErrFunc, false).WithStatementTimeout(t.statementTimeout)}, nil
+}
+
+// InitDatabase create database schema instance if doesn't exist
+func (t *Trino) InitDatabase(ctx context.Context) error {
+	query := fmt.Sprintf(trinoCreateSchemaIfNotExistsTemplate, t.config.Schema)
+
+	if _, err := t.txOrDb(ctx).ExecContext(ctx, query); err != nil {
+		return errorj.CreateSchemaError.Wrap(err, "failed to create db schema").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Schema:    t.config.Schema,
+				Statement: query,
+			})
+	}
+
+	return nil
+}
+
+// GetTableSchema returns table (name,columns with name and types) representation wrapped in Table struct
+func (t *Trino) GetTableSchema(ctx context.Context, tableName string) (*Table, error) {
+	tableName = t.TableName(tableName)
+	table := &Table{Name: tableName, Columns: Columns{}, PKFields: utils.NewSet[string]()}
+
+	rows, err := t.txOrDb(ctx).QueryContext(ctx, trinoTableSchemaQuery, t.config.Schema, tableName)
+	if err != nil {
+		return nil, errorj.GetTableError.Wrap(err, "failed to get table columns").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Schema:    t.config.Schema,
+				Table:     tableName,
+				Statement: trinoTableSchemaQuery,
+				Values:    []any{t.config.Schema, tableName},
+			})
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var columnName, columnType string
+		if err := rows.Scan(&columnName, &columnType); err != nil {
+			return nil, errorj.GetTableError.Wrap(err, "failed to scan result").
+				WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+					Schema:    t.config.Schema,
+					Table:     tableName,
+					Statement: trinoTableSchemaQuery,
+					Values:    []any{t.config.Schema, tableName},
+				})
+		}
+		dt, _ := t.GetDataType(columnType)
+		table.Columns[columnName] = types2.SQLColumn{Type: columnType, DataType: dt}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errorj.GetTableError.Wrap(err, "failed read last row").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Schema:    t.config.Schema,
+				Table:     tableName,
+				Statement: trinoTableSchemaQuery,
+				Values:    []any{t.config.Schema, tableName},
+			})
+	}
+
+	//don't select primary keys of non-existent table
+	if len(table.Columns) == 0 {
+		return table, nil
+	}
+
+	primaryKeyName, pkFields, err := t.getPrimaryKey(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+	table.PKFields = pkFields
+	table.PrimaryKeyName = primaryKeyName
+	return table, nil
+}
+
+// getPrimaryKey returns primary key name and fields stored in table comment
+func (t *Trino) getPrimaryKey(ctx context.Context, tableName string) (string, utils.Set[string], error) {
+	primaryKeys := utils.NewSet[string]()
+	var comment sql.NullString
+	err := t.txOrDb(ctx).QueryRowContext(ctx, trinoTableCommentQuery, t.config.Catalog, t.config.Schema, tableName).Scan(&comment)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", nil, errorj.GetPrimaryKeysError.Wrap(err, "failed to get primary key").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Schema:    t.config.Schema,
+				Table:     tableName,
+				Statement: trinoTableCommentQuery,
+				Values:    []any{t.config.Catalog, t.config.Schema, tableName},
+			})
+	}
+	if !strings.HasPrefix(comment.String, trinoPrimaryKeyCommentPrefix) {
+		return "", primaryKeys, nil
+	}
+	primaryKeyName, fields, _ := strings.Cut(strings.TrimPrefix(comment.String, trinoPrimaryKeyCommentPrefix), ":")
+	for _, field := range strings.Split(fields, ",") {
+		if field != "" {
+			primaryKeys.Put(field)
+		}
+	}
+	if len(primaryKeys) == 0 {
+		primaryKeyName = ""
+	}
+	return primaryKeyName, primaryKeys, nil
+}
+
+// setPrimaryKey stores primary key in table comment. Empty table.PKFields removes primary key
+func (t *Trino) setPrimaryKey(ctx context.Context, table *Table) error {
+	quotedTableName := t.quotedTableName(table.Name)
+	comment := "NULL"
+	if len(table.PKFields) > 0 {
+		comment = fmt.Sprintf("'%s%s:%s'", trinoPrimaryKeyCommentPrefix, table.PrimaryKeyName, strings.Join(table.GetPKFields(), ","))
+	}
+	statement := fmt.Sprintf(trinoCommentTemplate, quotedTableName, comment)
+	if _, err := t.txOrDb(ctx).ExecContext(ctx, statement); err != nil {
+		return errorj.CreatePrimaryKeysError.Wrap(err, "failed to set primary key").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Schema:      t.config.Schema,
+				Table:       quotedTableName,
+				PrimaryKeys: table.GetPKFields(),
+				Statement:   statement,
+			})
+	}
+	return nil
+}
+
+// CreateTable creates table. Primary key is stored in table comment
+func (t *Trino) CreateTable(ctx context.Context, schemaToCreate *Table) error {
+	quotedTableName := t.quotedTableName(schemaToCreate.Name)
+
+	columns := schemaToCreate.CreateColumnNames()
+	columnsDDL := make([]string, len(columns))
+	for i, columnName := range columns {
+		columnsDDL[i] = t.columnDDL(columnName, schemaToCreate)
+	}
+	query := fmt.Sprintf(createTableTemplate, "", quotedTableName, strings.Join(columnsDDL, ", "))
+
+	if _, err := t.txOrDb(ctx).ExecContext(ctx, query); err != nil {
+		return errorj.CreateTableError.Wrap(err, "failed to create table").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Schema:      t.config.Schema,
+				Table:       quotedTableName,
+				PrimaryKeys: schemaToCreate.GetPKFields(),
+				Statement:   query,
+			})
+	}
+	if len(schemaToCreate.PKFields) > 0 {
+		return t.setPrimaryKey(ctx, schemaToCreate)
+	}
+	return nil
+}
+
+// PatchTableSchema adds columns to table and updates primary key in table comment
+func (t *Trino) PatchTableSchema(ctx context.Context, patchTable *Table) error {
+	quotedTableName := t.quotedTableName(patchTable.Name)
+
+	for _, columnName := range patchTable.SortedColumnNames() {
+		query := fmt.Sprintf(addColumnTemplate, quotedTableName, t.columnDDL(columnName, patchTable))
+		if _, err := t.txOrDb(ctx).ExecContext(ctx, query); err != nil {
+			return errorj.PatchTableError.Wrap(err, "failed to patch table").
+				WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+					Schema:      t.config.Schema,
+					Table:       quotedTableName,
+					PrimaryKeys: patchTable.GetPKFields(),
+					Statement:   query,
+				})
+		}
+	}
+	if patchTable.DeletePkFields || len(patchTable.PKFields) > 0 {
+		return t.setPrimaryKey(ctx, patchTable)
+	}
+	return nil
+}
+
+// LoadTable uploads batch file to S3, creates Hive external table over it and inserts data to the target table
+func (t *Trino) LoadTable(ctx context.Context, targetTable *Table, loadSource *LoadSource) (state *bulker.WarehouseState, err error) {
+	quotedTableName := t.quotedTableName(targetTable.Name)
+	if loadSource.Type != LocalFile {
+		return state, fmt.Errorf("LoadTable: only local file is supported")
+	}
+	if loadSource.Format != t.batchFileFormat {
+		return state, fmt.Errorf("LoadTable: only %s format is supported", t.batchFileFormat)
+	}
+	s3Config := t.config.toS3Config(implementations.FileConfig{Format: t.batchFileFormat, Compression: types2.FileCompressionNONE})
+	s3Config.Endpoint = utils.DefaultString(t.config.S3Endpoint, t.config.Endpoint)
+	s3, err := implementations.NewS3(s3Config)
+	if err != nil {
+		return state, errorj.LoadError.Wrap(err, "failed to setup s3 client")
+	}
+	defer s3.Close()
+	// external table location is a folder. Each batch file gets its own folder
+	stagingName := fmt.Sprintf("%s_stage_%s", utils.ShortenString(targetTable.Name, 40), time.Now().Format("060102150405"))
+	folder := stagingName
+	if t.config.Folder != "" {
+		folder = strings.TrimSuffix(t.config.Folder, "/") + "/" + stagingName
+	}
+	fileKey := folder + "/" + path.Base(loadSource.Path)
+	file, err := os.Open(loadSource.Path)
+	if err != nil {
+		return state, errorj.LoadError.Wrap(err, "failed to open batch file")
+	}
+	err = s3.Upload(fileKey, file)
+	_ = file.Close()
+	if err != nil {
+		return state, err
+	}
+	defer func() {
+		if err2 := s3.DeleteObject(fileKey); err2 != nil {
+			t.Errorf("failed to delete staged file %s: %v", fileKey, err2)
+		}
+	}()
+
+	columns := targetTable.SortedColumnNames()
+	stagingColumns := make([]string, len(columns))
+	columnNames := make([]string, len(columns))
+	selectColumns := make([]string, len(columns))
+	for i, name := range columns {
+		quotedName := t.quotedColumnName(name)
+		columnNames[i] = quotedName
+		stagingColumns[i] = quotedName + " varchar"
+		selectColumns[i] = trinoCastFromVarchar(quotedName, targetTable.Columns[name])
+	}
+	stagingTable := fmt.Sprintf(`"%s"."%s"."%s"`, t.config.StagingCatalog, t.config.StagingSchema, stagingName)
+	createStatement := fmt.Sprintf(trinoCreateExternalTableTemplate, stagingTable, strings.Join(stagingColumns, ", "), fmt.Sprintf("s3://%s/%s/", t.config.Bucket, folder))
+	if _, err = t.txOrDb(ctx).ExecContext(ctx, createStatement); err != nil {
+		return state, errorj.LoadError.Wrap(err, "failed to create staging table").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Schema:    t.config.StagingSchema,
+				Table:     stagingTable,
+				Statement: createStatement,
+			})
+	}
+	defer func() {
+		dropStatement := fmt.Sprintf(dropTableTemplate, "IF EXISTS ", stagingTable)
+		if _, err2 := t.txOrDb(ctx).ExecContext(ctx, dropStatement); err2 != nil {
+			t.Errorf("failed to drop staging table %s: %v", stagingTable, err2)
+		}
+	}()
+
+	statement := fmt.Sprintf(trinoInsertFromStagingTemplate, quotedTableName, strings.Join(columnNames, ", "), strings.Join(selectColumns, ", "), stagingTable)
+	if _, err = t.txOrDb(ctx).ExecContext(ctx, statement); err != nil {
+		return state, errorj.CopyError.Wrap(err, "failed to copy data from staging table").
+			WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+				Schema:    t.config.Schema,
+				Table:     quotedTableName,
+				Statement: statement,
+			})
+	}
+	return state, nil
+}
+
+// Insert inserts data with InsertContext as a single object or a batch into Trino
+func (t *Trino) Insert(ctx context.Context, table *Table, merge bool, objects ...types2.Object) error {
+	if !merge || len(table.GetPKFields()) == 0 {
+		return t.insert(ctx, table, objects)
+	}
+	for _, object := range objects {
+		pkMatchConditions := &WhenConditions{}
+		for _, pkColumn := range table.GetPKFields() {
+			value := object[pkColumn]
+			if value == nil {
+				pkMatchConditions = pkMatchConditions.Add(pkColumn, "IS NULL", nil)
+			} else {
+				pkMatchConditions = pkMatchConditions.Add(pkColumn, "=", value)
+			}
+		}
+		res, err := t.Select(ctx, table.Name, pkMatchConditions, nil)
+		if err != nil {
+			return errorj.ExecuteInsertError.Wrap(err, "failed check primary key collision").
+				WithProperty(errorj.DBInfo, &types2.ErrorPayload{
+					Schema:      t.config.Schema,
+					Table:       t.quotedTableName(table.Name),
+					PrimaryKeys: table.GetPKFields(),
+				})
+		}
+		if len(res) > 0 {
+			err = t.Update(ctx, table, object, pkMatchConditions)
+		} else {
+			err = t.insert(ctx, table, []types2.Object{object})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Trino) CopyTables(ctx context.Context, targetTable *Table, sourceTable *Table, mergeWindow int) (*bulker.WarehouseState, error) {
+	if mergeWindow <= 0 || len(targetTable.PKFields) == 0 {
+		return nil, t.copy(ctx, targetTable, sourceTable)
+	} else {
+		return nil, t.copyOrMerge(ctx, targetTable, sourceTable, trinoMergeQueryTemplate, "S")
+	}
+}
+
+// trinoCastFromVarchar returns expression that converts varchar column of staging table to target column type
+func trinoCastFromVarchar(quotedName string, column types2.SQLColumn) string {
+	value := fmt.Sprintf("NULLIF(%s, '')", quotedName)
+	ddlType := column.GetDDLType()
+	switch {
+	case strings.HasPrefix(strings.ToLower(ddlType), "varchar"):
+		return quotedName
+	case column.DataType == types2.TIMESTAMP:
+		return fmt.Sprintf("CAST(from_iso8601_timestamp(%s) AS %s)", value, ddlType)
+	default:
+		return fmt.Sprintf("CAST(%s AS %s)", value, ddlType)
+	}
+}
+
+// trinoColumnDDL returns column DDL (column name, mapped sql type)
+func trinoColumnDDL(quotedName, name string, table *Table) string {
+	column := table.Columns[name]
+	return fmt.Sprintf(`%s %s`, quotedName, column.GetDDLType())
+}
+
+// trinoIdentifierFunction Trino identifiers are case-insensitive and stored in lower case
+func trinoIdentifierFunction(value string, alphanumeric bool) (adapted string, needQuotes bool) {
+	return strings.ToLower(value), true
+}
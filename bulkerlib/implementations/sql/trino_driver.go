@@ -0,0 +1,388 @@
+package sql
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Minimal database/sql driver on top of Trino client REST protocol:
+// https://trino.io/docs/current/develop/client-protocol.html
+// Query parameters are interpolated on the client side as SQL literals.
+
+const (
+	trinoStatementPath = "/v1/statement"
+	trinoMaxRetries    = 3
+)
+
+type trinoColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type trinoResponse struct {
+	Id      string          `json:"id"`
+	NextUri string          `json:"nextUri"`
+	Columns []trinoColumn   `json:"columns"`
+	Data    [][]interface{} `json:"data"`
+	Error   *struct {
+		Message   string `json:"message"`
+		ErrorName string `json:"errorName"`
+		ErrorType string `json:"errorType"`
+	} `json:"error"`
+}
+
+// trinoClient submits statements to Trino coordinator and follows nextUri until results are exhausted
+type trinoClient struct {
+	config     *TrinoConfig
+	httpClient *http.Client
+}
+
+func newTrinoClient(config *TrinoConfig) *trinoClient {
+	return &trinoClient{config: config, httpClient: &http.Client{Timeout: 5 * time.Minute}}
+}
+
+func (c *trinoClient) serverUrl() string {
+	scheme := "http"
+	if c.config.SSL {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s:%d", scheme, c.config.Host, c.config.Port)
+}
+
+func (c *trinoClient) do(ctx context.Context, method, url string, body []byte) (*trinoResponse, error) {
+	var lastErr error
+	for attempt := 0; attempt < trinoMaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(time.Duration(attempt) * 100 * time.Millisecond):
+			}
+		}
+		var reader io.Reader
+		if body != nil {
+			reader = bytes.NewReader(body)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, url, reader)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("X-Trino-User", c.config.Username)
+		req.Header.Set("X-Trino-Source", "bulker")
+		if c.config.Catalog != "" {
+			req.Header.Set("X-Trino-Catalog", c.config.Catalog)
+		}
+		if c.config.Schema != "" {
+			req.Header.Set("X-Trino-Schema", c.config.Schema)
+		}
+		if c.config.Password != "" {
+			req.SetBasicAuth(c.config.Username, c.config.Password)
+		}
+		res, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		respBody, err := io.ReadAll(res.Body)
+		_ = res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		switch res.StatusCode {
+		case http.StatusOK:
+			resp := &trinoResponse{}
+			dec := json.NewDecoder(bytes.NewReader(respBody))
+			dec.UseNumber()
+			if err = dec.Decode(resp); err != nil {
+				return nil, fmt.Errorf("trino: failed to decode response: %v", err)
+			}
+			if resp.Error != nil {
+				return nil, fmt.Errorf("trino: %s: %s", resp.Error.ErrorName, resp.Error.Message)
+			}
+			return resp, nil
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout, http.StatusTooManyRequests:
+			lastErr = fmt.Errorf("trino: http status %d: %s", res.StatusCode, string(respBody))
+		default:
+			return nil, fmt.Errorf("trino: http status %d: %s", res.StatusCode, string(respBody))
+		}
+	}
+	return nil, lastErr
+}
+
+// submit sends statement and returns first response. Use next to fetch following results
+func (c *trinoClient) submit(ctx context.Context, query string) (*trinoResponse, error) {
+	return c.do(ctx, http.MethodPost, c.serverUrl()+trinoStatementPath, []byte(query))
+}
+
+func (c *trinoClient) next(ctx context.Context, resp *trinoResponse) (*trinoResponse, error) {
+	next, err := c.do(ctx, http.MethodGet, resp.NextUri, nil)
+	if err != nil && ctx.Err() != nil {
+		c.cancel(resp)
+	}
+	return next, err
+}
+
+func (c *trinoClient) cancel(resp *trinoResponse) {
+	if resp.NextUri == "" {
+		return
+	}
+	// context is already cancelled - use background context to deliver cancel request
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, resp.NextUri, nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("X-Trino-User", c.config.Username)
+	if res, err := c.httpClient.Do(req); err == nil {
+		_ = res.Body.Close()
+	}
+}
+
+// trinoInterpolate replaces '?' placeholders outside of quoted strings, identifiers and comments with SQL literals
+func trinoInterpolate(query string, args []driver.NamedValue) (string, error) {
+	if len(args) == 0 {
+		return query, nil
+	}
+	query, placeholders, err := interpolateParams(query, args, func(arg driver.NamedValue) (string, error) {
+		return trinoLiteral(arg.Value)
+	})
+	if err != nil {
+		return "", fmt.Errorf("trino: %v", err)
+	}
+	if placeholders != len(args) {
+		return "", fmt.Errorf("trino: query has %d placeholders but %d arguments provided", placeholders, len(args))
+	}
+	return query, nil
+}
+
+func trinoLiteral(value driver.Value) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "NULL", nil
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'", nil
+	case []byte:
+		return "'" + strings.ReplaceAll(string(v), "'", "''") + "'", nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return "DOUBLE '" + strconv.FormatFloat(v, 'g', -1, 64) + "'", nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case time.Time:
+		return "TIMESTAMP '" + v.UTC().Format("2006-01-02 15:04:05.000000") + " UTC'", nil
+	default:
+		return "", fmt.Errorf("trino: unsupported parameter type %T", v)
+	}
+}
+
+// trinoConnector implements driver.Connector. Use with sql.OpenDB
+type trinoConnector struct {
+	client *trinoClient
+}
+
+func (c *trinoConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return &trinoConn{client: c.client}, nil
+}
+
+func (c *trinoConnector) Driver() driver.Driver {
+	return trinoDriver{}
+}
+
+type trinoDriver struct{}
+
+func (d trinoDriver) Open(name string) (driver.Conn, error) {
+	return nil, errors.New("trino: DSN connections are not supported. Use sql.OpenDB with connector")
+}
+
+type trinoConn struct {
+	client *trinoClient
+}
+
+func (c *trinoConn) Prepare(query string) (driver.Stmt, error) {
+	return &trinoStmt{conn: c, query: query}, nil
+}
+
+func (c *trinoConn) Close() error {
+	return nil
+}
+
+// Begin fails: most of Trino connectors don't support multi-statement write transactions.
+// Trino adapter executes statements without transaction
+func (c *trinoConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("trino: transactions are not supported")
+}
+
+func (c *trinoConn) Ping(ctx context.Context) error {
+	_, err := c.ExecContext(ctx, "SELECT 1", nil)
+	return err
+}
+
+func (c *trinoConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	rows, err := c.QueryContext(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	// statement completes only when all results are consumed
+	if err = rows.(*trinoRows).drain(); err != nil {
+		return nil, err
+	}
+	return driver.ResultNoRows, nil
+}
+
+func (c *trinoConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	query, err := trinoInterpolate(query, args)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.submit(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	rows := &trinoRows{ctx: ctx, client: c.client, resp: resp}
+	// columns may appear in one of the following responses
+	for rows.resp.Columns == nil && rows.resp.NextUri != "" {
+		if rows.resp, err = c.client.next(ctx, rows.resp); err != nil {
+			return nil, err
+		}
+	}
+	rows.columns = rows.resp.Columns
+	return rows, nil
+}
+
+type trinoStmt struct {
+	conn  *trinoConn
+	query string
+}
+
+func (s *trinoStmt) Close() error {
+	return nil
+}
+
+func (s *trinoStmt) NumInput() int {
+	return -1
+}
+
+func (s *trinoStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.conn.ExecContext(context.Background(), s.query, toNamedValues(args))
+}
+
+func (s *trinoStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.conn.QueryContext(context.Background(), s.query, toNamedValues(args))
+}
+
+func (s *trinoStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.conn.ExecContext(ctx, s.query, args)
+}
+
+func (s *trinoStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.conn.QueryContext(ctx, s.query, args)
+}
+
+type trinoRows struct {
+	ctx     context.Context
+	client  *trinoClient
+	resp    *trinoResponse
+	columns []trinoColumn
+	index   int
+}
+
+func (r *trinoRows) Columns() []string {
+	names := make([]string, len(r.columns))
+	for i, col := range r.columns {
+		names[i] = col.Name
+	}
+	return names
+}
+
+func (r *trinoRows) ColumnTypeDatabaseTypeName(index int) string {
+	return strings.ToUpper(r.columns[index].Type)
+}
+
+func (r *trinoRows) Close() error {
+	if r.resp != nil && r.resp.NextUri != "" {
+		r.client.cancel(r.resp)
+	}
+	return nil
+}
+
+func (r *trinoRows) drain() error {
+	for r.resp.NextUri != "" {
+		var err error
+		if r.resp, err = r.client.next(r.ctx, r.resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *trinoRows) Next(dest []driver.Value) error {
+	for r.index >= len(r.resp.Data) {
+		if r.resp.NextUri == "" {
+			return io.EOF
+		}
+		var err error
+		if r.resp, err = r.client.next(r.ctx, r.resp); err != nil {
+			return err
+		}
+		r.index = 0
+	}
+	row := r.resp.Data[r.index]
+	r.index++
+	for i := range dest {
+		if i >= len(row) || row[i] == nil {
+			dest[i] = nil
+			continue
+		}
+		dest[i] = trinoConvertValue(row[i], r.columns[i].Type)
+	}
+	return nil
+}
+
+// trinoConvertValue converts JSON value from Trino response to go type
+func trinoConvertValue(value any, typeName string) driver.Value {
+	baseType := strings.ToLower(typeName)
+	if i := strings.Index(baseType, "("); i > 0 {
+		baseType = baseType[:i]
+	}
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v.String()
+	case bool:
+		return v
+	case string:
+		switch baseType {
+		case "timestamp", "date":
+			for _, layout := range []string{"2006-01-02 15:04:05.999999999 MST", "2006-01-02 15:04:05.999999999 -07:00", "2006-01-02 15:04:05.999999999", time.DateOnly} {
+				if t, err := time.Parse(layout, v); err == nil {
+					return t
+				}
+			}
+		case "double", "real", "decimal":
+			// NaN and Infinity are returned as strings
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				return f
+			}
+		}
+		return v
+	default:
+		// arrays, maps and rows
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+}
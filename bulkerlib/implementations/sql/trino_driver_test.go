@@ -0,0 +1,190 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// trinoTestServer emulates Trino coordinator: responses of the statement are served one by one following nextUri
+type trinoTestServer struct {
+	sync.Mutex
+	t       *testing.T
+	url     string
+	pages   []string
+	queries []string
+	// unavailable number of requests answered with 503 before each page
+	unavailable int
+	failures    int
+	deleted     bool
+}
+
+func (s *trinoTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	require.Equal(s.t, "bulker", r.Header.Get("X-Trino-User"))
+	if r.Method == http.MethodPost && r.URL.Path == trinoStatementPath {
+		query, _ := io.ReadAll(r.Body)
+		s.queries = append(s.queries, string(query))
+		require.Equal(s.t, "iceberg", r.Header.Get("X-Trino-Catalog"))
+		require.Equal(s.t, "bulker", r.Header.Get("X-Trino-Schema"))
+		s.writePage(w, 0)
+		return
+	}
+	var page int
+	if _, err := fmt.Sscanf(r.URL.Path, "/v1/statement/q1/%d", &page); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if r.Method == http.MethodDelete {
+		s.deleted = true
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if s.failures < s.unavailable {
+		s.failures++
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	s.failures = 0
+	s.writePage(w, page)
+}
+
+// writePage writes page with nextUri of the following page, if any
+func (s *trinoTestServer) writePage(w http.ResponseWriter, page int) {
+	body := map[string]any{"id": "q1"}
+	require.NoError(s.t, json.Unmarshal([]byte(s.pages[page]), &body))
+	if page+1 < len(s.pages) {
+		body["nextUri"] = s.url + "/v1/statement/q1/" + strconv.Itoa(page+1)
+	}
+	require.NoError(s.t, json.NewEncoder(w).Encode(body))
+}
+
+func newTrinoTestDB(t *testing.T, server *trinoTestServer) *sql.DB {
+	server.t = t
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+	server.url = httpServer.URL
+	u, err := url.Parse(httpServer.URL)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(u.Port())
+	require.NoError(t, err)
+	client := newTrinoClient(&TrinoConfig{Host: u.Hostname(), Port: port, Username: "bulker", Catalog: "iceberg", Schema: "bulker"})
+	db := sql.OpenDB(&trinoConnector{client: client})
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func TestTrinoDriverPaging(t *testing.T) {
+	reqr := require.New(t)
+	server := &trinoTestServer{
+		pages: []string{
+			`{"stats": {"state": "QUEUED"}}`,
+			`{"columns": [{"name": "id", "type": "bigint"}, {"name": "name", "type": "varchar(10)"}]}`,
+			`{"columns": [{"name": "id", "type": "bigint"}, {"name": "name", "type": "varchar(10)"}], "data": [[1, "a"], [2, null]]}`,
+			`{"data": []}`,
+			`{"data": [[3, "c"]]}`,
+		},
+		unavailable: 1,
+	}
+	db := newTrinoTestDB(t, server)
+
+	rows, err := db.QueryContext(context.Background(), "SELECT id, name FROM events WHERE name <> ?", "it's")
+	reqr.NoError(err)
+	columns, err := rows.Columns()
+	reqr.NoError(err)
+	reqr.Equal([]string{"id", "name"}, columns)
+	var results [][]any
+	for rows.Next() {
+		var id, name any
+		reqr.NoError(rows.Scan(&id, &name))
+		results = append(results, []any{id, name})
+	}
+	reqr.NoError(rows.Err())
+	reqr.NoError(rows.Close())
+	reqr.Equal([][]any{{int64(1), "a"}, {int64(2), nil}, {int64(3), "c"}}, results)
+	reqr.Equal([]string{"SELECT id, name FROM events WHERE name <> 'it''s'"}, server.queries)
+	reqr.False(server.deleted)
+
+	//Exec completes statement by following all pages
+	server.queries = nil
+	_, err = db.ExecContext(context.Background(), "DELETE FROM events WHERE id = ?", int64(1))
+	reqr.NoError(err)
+	reqr.Equal([]string{"DELETE FROM events WHERE id = 1"}, server.queries)
+
+	//query closed before all pages are read is cancelled
+	rows, err = db.QueryContext(context.Background(), "SELECT id, name FROM events")
+	reqr.NoError(err)
+	reqr.True(rows.Next())
+	reqr.NoError(rows.Close())
+	server.Lock()
+	reqr.True(server.deleted)
+	server.Unlock()
+}
+
+func TestTrinoDriverErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		pages       []string
+		unavailable int
+		wantErr     string
+	}{
+		{"query_error", []string{`{}`, `{"error": {"message": "line 1:15: Table 'iceberg.bulker.events' does not exist", "errorName": "TABLE_NOT_FOUND", "errorType": "USER_ERROR"}}`},
+			0, "trino: TABLE_NOT_FOUND: line 1:15: Table 'iceberg.bulker.events' does not exist"},
+		{"error_after_data", []string{`{"columns": [{"name": "id", "type": "bigint"}], "data": [[1]]}`, `{"error": {"message": "Query exceeded memory limit", "errorName": "EXCEEDED_MEMORY_LIMIT"}}`},
+			0, "trino: EXCEEDED_MEMORY_LIMIT: Query exceeded memory limit"},
+		{"unavailable", []string{`{}`, `{"data": []}`}, trinoMaxRetries, "trino: http status 503"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTrinoTestDB(t, &trinoTestServer{pages: tt.pages, unavailable: tt.unavailable})
+			_, err := db.ExecContext(context.Background(), "SELECT id FROM events")
+			require.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestTrinoConvertValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    any
+		typeName string
+		want     any
+	}{
+		{"bigint", json.Number("42"), "bigint", int64(42)},
+		{"double", json.Number("1.5"), "double", 1.5},
+		{"decimal", json.Number("10.25"), "decimal(10,2)", 10.25},
+		{"decimal_string", "10.25", "decimal(10,2)", 10.25},
+		{"infinity", "Infinity", "real", math.Inf(1)},
+		{"boolean", true, "boolean", true},
+		{"varchar", "abc", "varchar(10)", "abc"},
+		{"timestamp", "2024-03-01 12:30:15.123", "timestamp(3)", time.Date(2024, 3, 1, 12, 30, 15, 123000000, time.UTC)},
+		{"timestamp_tz", "2024-03-01 12:30:15.123 UTC", "timestamp(3) with time zone", time.Date(2024, 3, 1, 12, 30, 15, 123000000, time.UTC)},
+		{"timestamp_offset", "2024-03-01 12:30:15.000 +01:00", "timestamp(3) with time zone", time.Date(2024, 3, 1, 12, 30, 15, 0, time.FixedZone("", 3600))},
+		{"date", "2024-03-01", "date", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"array", []any{json.Number("1"), json.Number("2")}, "array(bigint)", "[1,2]"},
+		{"map", map[string]any{"a": "b"}, "map(varchar, varchar)", `{"a":"b"}`},
+	}
+	require.True(t, math.IsNaN(trinoConvertValue("NaN", "double").(float64)))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := trinoConvertValue(tt.value, tt.typeName)
+			if want, ok := tt.want.(time.Time); ok {
+				require.True(t, want.Equal(got.(time.Time)), "expected %s, got %s", want, got)
+				return
+			}
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
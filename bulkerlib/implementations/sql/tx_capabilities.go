@@ -0,0 +1,67 @@
+package sql
+
+import (
+	"github.com/jitsucom/bulker/jitsubase/errorj"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"strings"
+)
+
+// TxSemantics what Commit and Rollback of TxSQLAdapter guarantee
+type TxSemantics string
+
+const (
+	// TxSemanticsAtomic statements are executed in database transaction: Commit applies all of them atomically, Rollback discards them
+	TxSemanticsAtomic TxSemantics = "atomic"
+	// TxSemanticsEmulated database doesn't support multi-statement transactions (e.g. ClickHouse, BigQuery), transaction is emulated with staging:
+	// statements are executed immediately, batch is loaded to tmp table and is applied to destination table with a single statement on Complete,
+	// so destination table gets either all rows of the batch or none of them.
+	// When stream modifies destination tables with several statements (tombstones, transform) and one of them fails, previous ones stay applied.
+	// Rollback can't undo them and returns error listing modified tables. Tables created by the transaction are considered its staging tables and aren't listed
+	TxSemanticsEmulated TxSemantics = "emulated"
+)
+
+// TxCapabilities transaction capabilities of TxSQLAdapter
+type TxCapabilities struct {
+	Semantics TxSemantics
+	// Savepoints whether savepoints may be used inside transaction. See TxSQLAdapter.WithSavepoint
+	Savepoints bool
+}
+
+// Capabilities returns semantics of transaction detected by connection that OpenTx has opened
+func (tx *TxSQLAdapter) Capabilities() TxCapabilities {
+	if tx.tx.tx == nil {
+		return TxCapabilities{Semantics: TxSemanticsEmulated}
+	}
+	return TxCapabilities{Semantics: TxSemanticsAtomic, Savepoints: tx.SupportsSavepoints()}
+}
+
+// trackCreated records table created by successful statement of emulated transaction
+func (tx *TxSQLAdapter) trackCreated(tableName string, err error) {
+	if err != nil || tx.tx.tx != nil {
+		return
+	}
+	if tx.createdTables == nil {
+		tx.createdTables = utils.NewSet[string]()
+	}
+	tx.createdTables.Put(tableName)
+}
+
+// trackModified records destination table modified by successful statement of emulated transaction
+func (tx *TxSQLAdapter) trackModified(tableName string, err error) {
+	if err != nil || tx.tx.tx != nil || tx.createdTables.Contains(tableName) {
+		return
+	}
+	if tx.modifiedTables == nil {
+		tx.modifiedTables = utils.NewSet[string]()
+	}
+	tx.modifiedTables.Put(tableName)
+}
+
+// partialRollbackError returns error if emulated transaction has already modified destination tables
+func (tx *TxSQLAdapter) partialRollbackError() error {
+	if tx.modifiedTables.Size() == 0 {
+		return nil
+	}
+	return errorj.RollbackTransactionError.New("%s doesn't support transactions: changes of tables %s were already applied and can't be rolled back",
+		tx.sqlAdapter.Type(), strings.Join(tx.modifiedTables.ToSlice(), ", "))
+}
@@ -3,10 +3,13 @@ package sql
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
 	"github.com/jitsucom/bulker/jitsubase/errorj"
 	"github.com/jitsucom/bulker/jitsubase/logging"
 	"io"
+	"time"
 )
 
 // TxWrapper is sql transaction wrapper. Used for handling and log errors with db type (postgres, mySQL, redshift or snowflake)
@@ -18,6 +21,14 @@ type TxWrapper struct {
 	queryLogger  *logging.QueryLogger
 	errorAdapter ErrorAdapter
 	closeDb      bool
+	// statementTimeout if set, statements are cancelled after this timeout
+	statementTimeout time.Duration
+	// retryableError if set, statements executed outside of transaction are retried when it returns true for error
+	retryableError func(err error) bool
+	maxRetries     int
+	// dryRun if set, statements passed to ExecContext are recorded instead of being executed. See DryRunOption
+	dryRun     bool
+	statements []string
 }
 
 type TxOrDB interface {
@@ -44,6 +55,45 @@ func NewDummyTxWrapper(dbType string) *TxWrapper {
 	return &TxWrapper{dbType: dbType}
 }
 
+// WithStatementTimeout sets timeout for statements executed with the wrapper. 0 - no timeout
+func (t *TxWrapper) WithStatementTimeout(timeout time.Duration) *TxWrapper {
+	t.statementTimeout = timeout
+	return t
+}
+
+// WithRetries enables retries of statements that failed with retryable error, e.g. serialization failure.
+// Only statements executed outside of transaction are retried: each of them runs in its own implicit transaction
+func (t *TxWrapper) WithRetries(maxRetries int, retryableError func(err error) bool) *TxWrapper {
+	t.maxRetries = maxRetries
+	t.retryableError = retryableError
+	return t
+}
+
+// WithDryRun makes wrapper record statements passed to ExecContext instead of executing them.
+// Queries that return rows are still executed, so schema of existing tables can be read
+func (t *TxWrapper) WithDryRun() *TxWrapper {
+	t.dryRun = true
+	return t
+}
+
+// DryRunStatements returns statements recorded in dry run mode
+func (t *TxWrapper) DryRunStatements() []string {
+	return t.statements
+}
+
+// connected returns true if wrapper runs statements in transaction or database connection
+func (t *TxWrapper) connected() bool {
+	return t.tx != nil || t.db != nil
+}
+
+// recordStatement adds statement to the recorded ones in dry run mode. Statement parameters are omitted
+func (t *TxWrapper) recordStatement(statement string) {
+	t.statements = append(t.statements, statement)
+	if t.queryLogger != nil {
+		t.queryLogger.LogQuery("/* dry run */ "+statement, nil)
+	}
+}
+
 func wrap[R any](ctx context.Context,
 	t *TxWrapper, queryFunction func(tx TxOrDB, query string, args ...any) (R, error),
 	query string, args ...any,
@@ -55,6 +105,15 @@ func wrap[R any](ctx context.Context,
 			return
 		}
 		res, err = queryFunction(t.db, query, args...)
+		for attempt := 1; err != nil && t.retryableError != nil && attempt <= t.maxRetries && t.retryableError(err); attempt++ {
+			logging.Debugf("[%s] retrying statement after retryable error (attempt #%d): %v", t.dbType, attempt, err)
+			select {
+			case <-ctx.Done():
+				return res, ctx.Err()
+			case <-time.After(time.Duration(attempt*attempt) * 50 * time.Millisecond):
+			}
+			res, err = queryFunction(t.db, query, args...)
+		}
 	} else {
 		res, err = queryFunction(tx, query, args...)
 	}
@@ -67,19 +126,53 @@ func wrap[R any](ctx context.Context,
 	return res, err
 }
 
+// statementContext returns context that is cancelled after statement timeout. 0 - no timeout
+func statementContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// statementTimeoutError wraps err with StatementTimeoutError if statement was cancelled because of statement timeout
+func statementTimeoutError(ctx context.Context, timeout time.Duration, err error) error {
+	if err != nil && timeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return errorj.StatementTimeoutError.Wrap(err, "statement was cancelled after %s timeout", timeout)
+	}
+	return err
+}
+
 // ExecContext executes a query that doesn't return rows.
 // For example: an INSERT and UPDATE.
+// If statement timeout is configured, statement is cancelled when it runs longer than timeout.
+// In dry run mode statement is only recorded. See WithDryRun
 func (t *TxWrapper) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
-	return wrap(ctx, t, func(tx TxOrDB, query string, args ...any) (sql.Result, error) {
+	if t.dryRun {
+		t.recordStatement(query)
+		return driver.RowsAffected(0), nil
+	}
+	ctx, cancel := statementContext(ctx, t.statementTimeout)
+	defer cancel()
+	res, err := wrap(ctx, t, func(tx TxOrDB, query string, args ...any) (sql.Result, error) {
 		return tx.ExecContext(ctx, query, args...)
 	}, query, args...)
+	return res, statementTimeoutError(ctx, t.statementTimeout, err)
 }
 
 // QueryContext executes a query that returns rows, typically a SELECT.
+// If statement timeout is configured, query is cancelled when it runs longer than timeout including reading of the rows.
 func (t *TxWrapper) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
-	return wrap(ctx, t, func(tx TxOrDB, query string, args ...any) (*sql.Rows, error) {
+	ctx, cancel := statementContext(ctx, t.statementTimeout)
+	rows, err := wrap(ctx, t, func(tx TxOrDB, query string, args ...any) (*sql.Rows, error) {
 		return tx.QueryContext(ctx, query, args...)
 	}, query, args...)
+	if err != nil {
+		cancel()
+		return nil, statementTimeoutError(ctx, t.statementTimeout, err)
+	}
+	// rows are read after return, so context is released by timeout
+	t.releaseAfterTimeout(cancel)
+	return rows, nil
 }
 
 // QueryRowContext executes a query that is expected to return at most one row.
@@ -88,7 +181,11 @@ func (t *TxWrapper) QueryContext(ctx context.Context, query string, args ...any)
 // If the query selects no rows, the *Row's Scan will return ErrNoRows.
 // Otherwise, the *Row's Scan scans the first selected row and discards
 // the rest.
+// If statement timeout is configured, query is cancelled when it runs longer than timeout.
 func (t *TxWrapper) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	ctx, cancel := statementContext(ctx, t.statementTimeout)
+	// row is scanned after return, so context is released by timeout
+	t.releaseAfterTimeout(cancel)
 	row, _ := wrap(ctx, t, func(tx TxOrDB, query string, args ...any) (*sql.Row, error) {
 		return tx.QueryRowContext(ctx, query, args...), nil
 	}, query, args...)
@@ -105,10 +202,20 @@ func (t *TxWrapper) QueryRowContext(ctx context.Context, query string, args ...a
 // The provided context will be used for the preparation of the context, not
 // for the execution of the returned statement. The returned statement
 // will run in the transaction context.
+// If statement timeout is configured, preparation is cancelled when it runs longer than timeout.
 func (t *TxWrapper) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
-	return wrap(ctx, t, func(tx TxOrDB, query string, args ...any) (*sql.Stmt, error) {
+	ctx, cancel := statementContext(ctx, t.statementTimeout)
+	defer cancel()
+	stmt, err := wrap(ctx, t, func(tx TxOrDB, query string, args ...any) (*sql.Stmt, error) {
 		return tx.PrepareContext(ctx, query)
 	}, query)
+	return stmt, statementTimeoutError(ctx, t.statementTimeout, err)
+}
+
+func (t *TxWrapper) releaseAfterTimeout(cancel context.CancelFunc) {
+	if t.statementTimeout > 0 {
+		time.AfterFunc(t.statementTimeout, cancel)
+	}
 }
 
 // Commit commits underlying transaction and returns err if occurred
@@ -159,6 +266,48 @@ func (t *TxWrapper) Rollback() error {
 	return nil
 }
 
+// Savepoint creates savepoint with provided name in underlying transaction
+func (t *TxWrapper) Savepoint(ctx context.Context, name string) error {
+	return t.savepointStatement(ctx, "SAVEPOINT "+name, "failed to create savepoint")
+}
+
+// RollbackToSavepoint rolls back all statements executed after savepoint was created. Transaction stays open.
+func (t *TxWrapper) RollbackToSavepoint(ctx context.Context, name string) error {
+	return t.savepointStatement(ctx, "ROLLBACK TO SAVEPOINT "+name, "failed to rollback to savepoint")
+}
+
+// ReleaseSavepoint destroys savepoint keeping effects of statements executed after it was created
+func (t *TxWrapper) ReleaseSavepoint(ctx context.Context, name string) error {
+	return t.savepointStatement(ctx, "RELEASE SAVEPOINT "+name, "failed to release savepoint")
+}
+
+func (t *TxWrapper) savepointStatement(ctx context.Context, statement, errMsg string) error {
+	if t.tx == nil {
+		return errorj.SavepointError.New("savepoints are supported only inside transaction")
+	}
+	if _, err := t.ExecContext(ctx, statement); err != nil {
+		return errorj.SavepointError.Wrap(err, errMsg)
+	}
+	return nil
+}
+
+// txBeginner is implemented by *sql.DB and *sql.Conn
+type txBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// BeginTx begins driver transaction on wrapped connection. Used by drivers that send batches on commit, e.g. ClickHouse native protocol
+func (t *TxWrapper) BeginTx(ctx context.Context) (*sql.Tx, error) {
+	if t.tx != nil {
+		return nil, errors.New("transaction is already open")
+	}
+	beginner, ok := t.db.(txBeginner)
+	if !ok {
+		return nil, fmt.Errorf("%s connection doesn't support transactions", t.dbType)
+	}
+	return beginner.BeginTx(ctx, nil)
+}
+
 type ConWithDB struct {
 	db  *sql.DB
 	con *sql.Conn
@@ -184,6 +333,10 @@ func (c *ConWithDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt
 	return c.con.PrepareContext(ctx, query)
 }
 
+func (c *ConWithDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return c.con.BeginTx(ctx, opts)
+}
+
 func (c *ConWithDB) Close() error {
 	_ = c.con.Close()
 	if c.db != nil {
@@ -0,0 +1,125 @@
+package sql
+
+import (
+	"encoding/json"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"strings"
+)
+
+// CoercionPolicy defines what happens with value that cannot be coerced to the type of existing column
+type CoercionPolicy string
+
+const (
+	// CoercionPolicyOverflow moves value to '_unmapped_data' JSON column
+	CoercionPolicyOverflow CoercionPolicy = "overflow"
+	// CoercionPolicyNull drops value so column is left null
+	CoercionPolicyNull CoercionPolicy = "null"
+	// CoercionPolicyDLQ rejects the whole object with bulker.RejectedObjectError: it is moved to dead-letter queue without retries
+	CoercionPolicyDLQ CoercionPolicy = "dlq"
+	// CoercionPolicyFail fails the whole batch
+	CoercionPolicyFail CoercionPolicy = "fail"
+)
+
+// TypeCoercionErrorsConfig policies for values that cannot be coerced to the type of existing column.
+// Empty policy means CoercionPolicyOverflow
+type TypeCoercionErrorsConfig struct {
+	// Default policy for all columns
+	Default CoercionPolicy `json:"default,omitempty"`
+	// Fields policies by column name (flattened field name, e.g. 'context_page_url')
+	Fields map[string]CoercionPolicy `json:"fields,omitempty"`
+}
+
+func (tc *TypeCoercionErrorsConfig) Validate() error {
+	if err := validateCoercionPolicy(tc.Default); err != nil {
+		return err
+	}
+	for field, policy := range tc.Fields {
+		if err := validateCoercionPolicy(policy); err != nil {
+			return fmt.Errorf("field '%s': %v", field, err)
+		}
+	}
+	return nil
+}
+
+func validateCoercionPolicy(policy CoercionPolicy) error {
+	switch policy {
+	case "", CoercionPolicyOverflow, CoercionPolicyNull, CoercionPolicyDLQ, CoercionPolicyFail:
+		return nil
+	default:
+		return fmt.Errorf("unknown type coercion error policy: %s. Supported: overflow, null, dlq, fail", policy)
+	}
+}
+
+// policy returns policy for column. Nil config means CoercionPolicyOverflow for all columns
+func (tc *TypeCoercionErrorsConfig) policy(column string) CoercionPolicy {
+	if tc == nil {
+		return CoercionPolicyOverflow
+	}
+	if policy, ok := tc.Fields[column]; ok && policy != "" {
+		return policy
+	}
+	if tc.Default != "" {
+		return tc.Default
+	}
+	return CoercionPolicyOverflow
+}
+
+// mayReject returns true if any value may cause rejection of the whole object or batch
+func (tc *TypeCoercionErrorsConfig) mayReject() bool {
+	if tc == nil {
+		return false
+	}
+	if tc.Default == CoercionPolicyDLQ || tc.Default == CoercionPolicyFail {
+		return true
+	}
+	for _, policy := range tc.Fields {
+		if policy == CoercionPolicyDLQ || policy == CoercionPolicyFail {
+			return true
+		}
+	}
+	return false
+}
+
+// forAdapter returns config with field names converted to column names of the adapter
+func (tc *TypeCoercionErrorsConfig) forAdapter(p SQLAdapter) *TypeCoercionErrorsConfig {
+	if tc == nil || len(tc.Fields) == 0 {
+		return tc
+	}
+	fields := make(map[string]CoercionPolicy, len(tc.Fields))
+	for field, policy := range tc.Fields {
+		fields[p.ColumnName(field)] = policy
+	}
+	return &TypeCoercionErrorsConfig{Default: tc.Default, Fields: fields}
+}
+
+// parseTypeCoercionErrorsConfig accepts single policy for all columns or config object
+func parseTypeCoercionErrorsConfig(serialized any) (*TypeCoercionErrorsConfig, error) {
+	var raw []byte
+	switch v := serialized.(type) {
+	case *TypeCoercionErrorsConfig:
+		return v, v.Validate()
+	case string:
+		if !strings.HasPrefix(strings.TrimSpace(v), "{") {
+			config := &TypeCoercionErrorsConfig{Default: CoercionPolicy(v)}
+			return config, config.Validate()
+		}
+		raw = []byte(v)
+	default:
+		var err error
+		raw, err = json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value type of typeCoercionErrors option: %T", v)
+		}
+	}
+	config := &TypeCoercionErrorsConfig{}
+	if err := json.Unmarshal(raw, config); err != nil {
+		return nil, fmt.Errorf("failed to parse typeCoercionErrors config: %v", err)
+	}
+	return config, config.Validate()
+}
+
+// WithTypeCoercionErrors sets policies for values that cannot be coerced to the type of existing column
+func WithTypeCoercionErrors(config *TypeCoercionErrorsConfig) bulker.StreamOption {
+	return bulker.WithOption(&TypeCoercionErrorsOption, config)
+}
@@ -6,6 +6,7 @@ import (
 	types2 "github.com/jitsucom/bulker/bulkerlib/types"
 	"github.com/jitsucom/bulker/jitsubase/timestamp"
 	"github.com/jitsucom/bulker/jitsubase/utils"
+	"github.com/stretchr/testify/require"
 	"testing"
 	"time"
 )
@@ -409,3 +410,19 @@ func TestTypeCoalesce(t *testing.T) {
 		})
 	}
 }
+
+func TestColumnTypesOption(t *testing.T) {
+	options := bulker.StreamOptions{}
+	option, err := ColumnTypesOption.Parse(map[string]any{"amount": "NUMERIC(38,9)", "tags": []any{"text[]", "TEXT[] NOT NULL"}})
+	require.NoError(t, err)
+	options.Add(option)
+	options.Add(WithColumnTypesMap(map[string]string{"payload": "JSONB"}))
+	require.Equal(t, types2.SQLTypes{
+		"amount":  {Type: "NUMERIC(38,9)", DdlType: "NUMERIC(38,9)", Override: true},
+		"tags":    {Type: "text[]", DdlType: "TEXT[] NOT NULL", Override: true},
+		"payload": {Type: "JSONB", DdlType: "JSONB", Override: true},
+	}, ColumnTypesOption.Get(&options))
+
+	_, err = ColumnTypesOption.Parse(map[string]any{"amount": 1})
+	require.Error(t, err)
+}
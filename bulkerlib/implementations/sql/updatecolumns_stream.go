@@ -0,0 +1,107 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/errorj"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"time"
+)
+
+// UpdateColumnsStream loads consumed objects to tmp table and then updates only columns present in objects
+// for existing rows of destination table matched by primary key. Other columns are left untouched.
+type UpdateColumnsStream struct {
+	*AbstractTransactionalSQLStream
+}
+
+func newUpdateColumnsStream(id string, p SQLAdapter, tableName string, streamOptions ...bulker.StreamOption) (bulker.BulkerStream, error) {
+	if _, ok := p.(ColumnsUpdater); !ok {
+		return nil, fmt.Errorf("%s doesn't support %s mode", p.Type(), bulker.UpdateColumns)
+	}
+	ps := UpdateColumnsStream{}
+	var err error
+	ps.AbstractTransactionalSQLStream, err = newAbstractTransactionalStream(id, p, tableName, bulker.UpdateColumns, streamOptions...)
+	if err != nil {
+		return nil, err
+	}
+	if len(ps.pkColumns) == 0 {
+		return nil, errors.New("WithPrimaryKey is required option for UpdateColumnsStream")
+	}
+	ps.existingTable, _ = ps.sqlAdapter.GetTableSchema(context.Background(), ps.tableName)
+	ps.tmpTableFunc = func(ctx context.Context, tableForObject *Table, object types.Object) (table *Table, err error) {
+		dstTable := tableForObject
+		if _, err = ps.adjustTableColumnTypes(dstTable, ps.existingTable, tableForObject, object); err != nil {
+			return nil, err
+		}
+		if ps.schemaFromOptions != nil {
+			if _, err = ps.adjustTableColumnTypes(dstTable, ps.existingTable, ps.schemaFromOptions, object); err != nil {
+				return nil, err
+			}
+		}
+		tmpTableName := fmt.Sprintf("%s_tmp%s", utils.ShortenString(tableName, 47), time.Now().Format("060102150405"))
+		return &Table{
+			Name:            tmpTableName,
+			Columns:         dstTable.Columns,
+			Temporary:       true,
+			TimestampColumn: tableForObject.TimestampColumn,
+		}, nil
+	}
+	return &ps, nil
+}
+
+func (ps *UpdateColumnsStream) Complete(ctx context.Context) (state bulker.State, err error) {
+	if ps.state.Status != bulker.Active {
+		return ps.state, errors.New("stream is not active")
+	}
+	defer func() {
+		state, err = ps.postComplete(ctx, err)
+	}()
+	//if at least one object was inserted
+	if ps.state.SuccessfulRows > 0 {
+		var duplicate bool
+		if duplicate, err = ps.skipDuplicate(ctx); duplicate || err != nil {
+			return ps.state, err
+		}
+		if err = ps.checkQuality(); err != nil {
+			return ps.state, err
+		}
+		var existingTable *Table
+		existingTable, err = ps.tx.GetTableSchema(ctx, ps.tableName)
+		if err != nil {
+			return ps.state, errorj.Decorate(err, "failed to check existence of destination table")
+		}
+		if !existingTable.Exists() {
+			return ps.state, fmt.Errorf("destination table %s doesn't exist. %s mode updates only existing rows", ps.tableName, bulker.UpdateColumns)
+		}
+		if ps.batchFile != nil {
+			ws, err := ps.flushBatchFile(ctx)
+			ps.state.AddWarehouseState(ws)
+			if err != nil {
+				return ps.state, err
+			}
+		}
+		//adds new columns to destination table if necessary
+		var dstTable *Table
+		dstTable, err = ps.sqlAdapter.TableHelper().EnsureTableWithoutCaching(ctx, ps.tx, ps.id, ps.dstTable)
+		if err != nil {
+			ps.updateRepresentationTable(ps.dstTable)
+			return ps.state, errorj.Decorate(err, "failed to ensure destination table")
+		}
+		ps.dstTable = dstTable
+		ps.updateRepresentationTable(ps.dstTable)
+		//update columns of destination table from tmp table
+		ws, err := ps.tx.UpdateColumns(ctx, ps.dstTable, ps.tmpTable)
+		ps.state.AddWarehouseState(ws)
+		if err != nil {
+			return ps.state, err
+		}
+		return ps.state, nil
+	} else {
+		//if was any error - it will trigger transaction rollback in defer func
+		err = ps.state.LastError
+		return
+	}
+}
@@ -0,0 +1,67 @@
+package sql
+
+import (
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"sync"
+	"testing"
+)
+
+// TestUpdateColumnsStream loads table in batch mode and then backfills new column for some of existing rows
+func TestUpdateColumnsStream(t *testing.T) {
+	t.Parallel()
+	configIds := utils.ArrayIntersection(allBulkerConfigs, []string{BigqueryBulkerTypeId, RedshiftBulkerTypeId, SnowflakeBulkerTypeId, PostgresBulkerTypeId, MySQLBulkerTypeId})
+	tests := []bulkerTestConfig{
+		{
+			//delete any table leftovers from previous tests
+			name:      "dummy_test_table_cleanup",
+			tableName: "update_columns_test",
+			modes:     []bulker.BulkMode{bulker.Batch},
+			dataFile:  "test_data/empty.ndjson",
+			configIds: configIds,
+		},
+		{
+			name:                "initial_load",
+			tableName:           "update_columns_test",
+			modes:               []bulker.BulkMode{bulker.Batch},
+			leaveResultingTable: true,
+			dataFile:            "test_data/partition1.ndjson",
+			expectedRowsCount:   5,
+			streamOptions:       []bulker.StreamOption{bulker.WithPrimaryKey("id"), bulker.WithDeduplicate()},
+			configIds:           configIds,
+		},
+		{
+			name:                "update_columns",
+			tableName:           "update_columns_test",
+			modes:               []bulker.BulkMode{bulker.UpdateColumns},
+			leaveResultingTable: true,
+			dataFile:            "test_data/update_columns.ndjson",
+			expectedRows: []map[string]any{
+				{"_timestamp": constantTime, "id": 1, "name": "test", "city": nil},
+				{"_timestamp": constantTime, "id": 2, "name": "test2", "city": "Berlin"},
+				{"_timestamp": constantTime, "id": 3, "name": "test3", "city": nil},
+				{"_timestamp": constantTime, "id": 4, "name": "test4", "city": "Paris"},
+				{"_timestamp": constantTime, "id": 5, "name": "test5", "city": nil},
+			},
+			streamOptions: []bulker.StreamOption{bulker.WithPrimaryKey("id")},
+			configIds:     configIds,
+		},
+		{
+			name:      "dummy_test_table_cleanup",
+			tableName: "update_columns_test",
+			modes:     []bulker.BulkMode{bulker.Batch},
+			dataFile:  "test_data/empty.ndjson",
+			configIds: configIds,
+		},
+	}
+	sequentialGroup := sync.WaitGroup{}
+	sequentialGroup.Add(1)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runTestConfig(t, tt, testStream)
+			sequentialGroup.Done()
+		})
+		sequentialGroup.Wait()
+		sequentialGroup.Add(1)
+	}
+}
@@ -0,0 +1,119 @@
+package sql
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/bulkerlib/types"
+	"strings"
+	"time"
+)
+
+// VersionMergeSupport optional interface for SQLAdapter which merge statements respect Table.VersionColumn
+type VersionMergeSupport interface {
+	SupportsVersionMerge() bool
+}
+
+// validateVersionColumnOption returns error if bulker.VersionColumnOption is set but rows aren't merged or adapter doesn't support it
+func validateVersionColumnOption(p SQLAdapter, merge bool) error {
+	if !merge {
+		return fmt.Errorf("'%s' option requires '%s' option", bulker.VersionColumnOption.Key, bulker.DeduplicateOption.Key)
+	}
+	if vm, ok := p.(VersionMergeSupport); !ok || !vm.SupportsVersionMerge() {
+		return fmt.Errorf("'%s' option is not supported by %s", bulker.VersionColumnOption.Key, p.Type())
+	}
+	return nil
+}
+
+// validateDeduplicateLatestOption returns error if DeduplicateLatestOption is set but rows aren't merged or there is no column to compare rows by
+func validateDeduplicateLatestOption(merge bool, timestampColumn, versionColumn string) error {
+	if !merge {
+		return fmt.Errorf("'%s' option requires '%s' option", DeduplicateLatestOption.Key, bulker.DeduplicateOption.Key)
+	}
+	if timestampColumn == "" && versionColumn == "" {
+		return fmt.Errorf("'%s' option requires '%s' or '%s' option", DeduplicateLatestOption.Key, bulker.TimestampOption.Key, bulker.VersionColumnOption.Key)
+	}
+	return nil
+}
+
+// trackBatchFileLine records line of batch file with the latest row of primary key. Line of superseded row is skipped on load.
+// With version column (or timestamp column with DeduplicateLatestOption) the row with the lower value is skipped,
+// so the earlier row wins if it has higher version
+func (ps *AbstractTransactionalSQLStream) trackBatchFileLine(pk string, line int, object types.Object) {
+	prev, ok := ps.batchFileLinesByPK[pk]
+	if ok && ps.dedupColumn != "" && compareVersions(object[ps.dedupColumn], ps.batchFileVersionsByPK[pk]) < 0 {
+		ps.batchFileSkipLines.Put(line)
+		return
+	}
+	if ok {
+		ps.batchFileSkipLines.Put(prev)
+	}
+	ps.batchFileLinesByPK[pk] = line
+	if ps.dedupColumn != "" {
+		ps.batchFileVersionsByPK[pk] = object[ps.dedupColumn]
+	}
+}
+
+// supersededVersion returns true if existing row has higher version than object that is being merged into it
+func supersededVersion(table *Table, object types.Object, existingRow map[string]any) bool {
+	return table.VersionColumn != "" && compareVersions(object[table.VersionColumn], existingRow[table.VersionColumn]) < 0
+}
+
+// compareVersions compares values of version column. Numbers are compared as numbers, timestamps as timestamps,
+// other values as strings. Missing version is lower than any other
+func compareVersions(a, b any) int {
+	if a == nil || b == nil {
+		return cmp.Compare(boolToInt(a != nil), boolToInt(b != nil))
+	}
+	if af, ok := versionNumber(a); ok {
+		if bf, ok := versionNumber(b); ok {
+			return cmp.Compare(af, bf)
+		}
+	}
+	if at, ok := versionTime(a); ok {
+		if bt, ok := versionTime(b); ok {
+			return at.Compare(bt)
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func versionNumber(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func versionTime(v any) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, true
+	case string:
+		parsed, err := time.Parse(time.RFC3339Nano, t)
+		return parsed, err == nil
+	}
+	return time.Time{}, false
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
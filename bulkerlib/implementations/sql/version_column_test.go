@@ -0,0 +1,126 @@
+package sql
+
+import (
+	"encoding/json"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestVersionColumn checks that events with lower version don't overwrite rows with higher version
+func TestVersionColumn(t *testing.T) {
+	t.Parallel()
+	supported := utils.ArrayIntersection(allBulkerConfigs, []string{PostgresBulkerTypeId, BigqueryBulkerTypeId, SnowflakeBulkerTypeId})
+	tests := []bulkerTestConfig{
+		{
+			//delete any table leftovers from previous tests
+			name:      "dummy_test_table_cleanup",
+			tableName: "version_column_test",
+			modes:     []bulker.BulkMode{bulker.Batch},
+			dataFile:  "test_data/empty.ndjson",
+			configIds: supported,
+		},
+		{
+			name:                "first_batch",
+			tableName:           "version_column_test",
+			modes:               []bulker.BulkMode{bulker.Batch},
+			leaveResultingTable: true,
+			dataFile:            "test_data/version_column1.ndjson",
+			streamOptions:       []bulker.StreamOption{bulker.WithPrimaryKey("id"), bulker.WithDeduplicate(), bulker.WithVersionColumn("version")},
+			expectedRows: []map[string]any{
+				{"_timestamp": constantTime, "id": 1, "version": 2, "name": "test2"},
+				{"_timestamp": constantTime, "id": 2, "version": 1, "name": "test3"},
+			},
+			configIds: supported,
+		},
+		{
+			name:          "second_batch",
+			tableName:     "version_column_test",
+			modes:         []bulker.BulkMode{bulker.Batch},
+			dataFile:      "test_data/version_column2.ndjson",
+			streamOptions: []bulker.StreamOption{bulker.WithPrimaryKey("id"), bulker.WithDeduplicate(), bulker.WithVersionColumn("version")},
+			expectedRows: []map[string]any{
+				{"_timestamp": constantTime, "id": 1, "version": 2, "name": "test2"},
+				{"_timestamp": constantTime, "id": 2, "version": 2, "name": "test4"},
+			},
+			configIds: supported,
+		},
+		{
+			name:           "no_deduplicate",
+			tableName:      "version_column_test",
+			modes:          []bulker.BulkMode{bulker.Batch},
+			dataFile:       "test_data/version_column1.ndjson",
+			streamOptions:  []bulker.StreamOption{bulker.WithVersionColumn("version")},
+			expectedErrors: map[string]any{"create_stream": "requires"},
+			configIds:      supported,
+		},
+		{
+			name:           "unsupported",
+			tableName:      "version_column_test",
+			modes:          []bulker.BulkMode{bulker.Batch},
+			dataFile:       "test_data/version_column1.ndjson",
+			streamOptions:  []bulker.StreamOption{bulker.WithPrimaryKey("id"), bulker.WithDeduplicate(), bulker.WithVersionColumn("version")},
+			expectedErrors: map[string]any{"create_stream": "not supported"},
+			configIds:      utils.ArrayIntersection(allBulkerConfigs, []string{RedshiftBulkerTypeId, MySQLBulkerTypeId, ClickHouseBulkerTypeId}),
+		},
+	}
+	sequentialGroup := sync.WaitGroup{}
+	sequentialGroup.Add(1)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runTestConfig(t, tt, testStream)
+			sequentialGroup.Done()
+		})
+		sequentialGroup.Wait()
+		sequentialGroup.Add(1)
+	}
+}
+
+// TestDeduplicateLatest checks that deduplication of batch keeps the row with the latest timestamp instead of the last one
+func TestDeduplicateLatest(t *testing.T) {
+	t.Parallel()
+	tests := []bulkerTestConfig{
+		{
+			name:          "deduplicate_latest",
+			tableName:     "deduplicate_latest_test",
+			modes:         []bulker.BulkMode{bulker.Batch},
+			dataFile:      "test_data/deduplicate_latest.ndjson",
+			streamOptions: []bulker.StreamOption{bulker.WithPrimaryKey("id"), bulker.WithDeduplicate(), bulker.WithTimestamp("_timestamp"), WithDeduplicateLatest()},
+			expectedRows: []map[string]any{
+				{"_timestamp": constantTime.Add(time.Second), "id": 1, "name": "test2"},
+				{"_timestamp": constantTime, "id": 2, "name": "test3"},
+			},
+			configIds: allBulkerConfigs,
+		},
+		{
+			name:           "no_timestamp",
+			tableName:      "deduplicate_latest_test",
+			modes:          []bulker.BulkMode{bulker.Batch},
+			dataFile:       "test_data/deduplicate_latest.ndjson",
+			streamOptions:  []bulker.StreamOption{bulker.WithPrimaryKey("id"), bulker.WithDeduplicate(), WithDeduplicateLatest()},
+			expectedErrors: map[string]any{"create_stream": "requires"},
+			configIds:      allBulkerConfigs,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			runTestConfig(t, tt, testStream)
+		})
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	now := time.Now()
+	require.Equal(t, -1, compareVersions(int64(1), 2.0))
+	require.Equal(t, 1, compareVersions(json.Number("10"), int64(9)))
+	require.Equal(t, 0, compareVersions(json.Number("3"), 3.0))
+	require.Equal(t, -1, compareVersions(now, now.Add(time.Second)))
+	require.Equal(t, 1, compareVersions(now.Add(time.Second).Format(time.RFC3339Nano), now))
+	require.Equal(t, -1, compareVersions(nil, int64(0)))
+	require.Equal(t, 0, compareVersions(nil, nil))
+	require.Equal(t, 1, compareVersions("b", "a"))
+}
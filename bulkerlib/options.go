@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/jitsucom/bulker/bulkerlib/types"
 	"github.com/jitsucom/bulker/jitsubase/utils"
+	"reflect"
 )
 
 type StreamOption func(*StreamOptions)
@@ -40,6 +41,64 @@ var (
 		ParseFunc:    utils.ParseFloat,
 	}
 
+	// BatchScheduleOption cron expression (5 fields, UTC) of batch runs. When set, periodic runs happen only if frequency is set explicitly
+	BatchScheduleOption = ImplementationOption[string]{
+		Key:       "batchSchedule",
+		ParseFunc: utils.ParseString,
+	}
+	// BatchTriggerRowsOption starts batch when estimated number of pending events reaches the threshold
+	BatchTriggerRowsOption = ImplementationOption[int]{
+		Key:          "batchTriggerRows",
+		DefaultValue: 0,
+		ParseFunc:    utils.ParseInt,
+	}
+	// BatchTriggerBytesOption starts batch when estimated size of pending events in bytes reaches the threshold
+	BatchTriggerBytesOption = ImplementationOption[int]{
+		Key:          "batchTriggerBytes",
+		DefaultValue: 0,
+		ParseFunc:    utils.ParseInt,
+	}
+	// BatchTriggerLagOption starts batch when consumer lag (number of pending messages) reaches the threshold
+	BatchTriggerLagOption = ImplementationOption[int]{
+		Key:          "batchTriggerLag",
+		DefaultValue: 0,
+		ParseFunc:    utils.ParseInt,
+	}
+
+	// ConsumerGroupPrefixOption prefix of Kafka consumer groups of destination topics: <prefix><topic id>.
+	// Changing prefix makes consumers start from position selected by OffsetResetOption
+	ConsumerGroupPrefixOption = ImplementationOption[string]{
+		Key:       "consumerGroupPrefix",
+		ParseFunc: utils.ParseString,
+	}
+	// OffsetResetOption position of consumer group without committed offset: "earliest" or "latest"
+	OffsetResetOption = ImplementationOption[string]{
+		Key:          "autoOffsetReset",
+		DefaultValue: "earliest",
+		ParseFunc: func(serialized any) (string, error) {
+			v, err := utils.ParseString(serialized)
+			if err != nil {
+				return "", err
+			}
+			if v != "earliest" && v != "latest" {
+				return "", fmt.Errorf("unknown autoOffsetReset: %s. Supported values: earliest, latest", v)
+			}
+			return v, nil
+		},
+	}
+	// MaxPollIntervalMsOption max interval between polls before consumer is kicked from consumer group
+	MaxPollIntervalMsOption = ImplementationOption[int]{
+		Key:          "maxPollIntervalMs",
+		DefaultValue: 0,
+		ParseFunc:    utils.ParseInt,
+	}
+	// MaxInFlightEventsOption max number of events consumed by batch consumers of destination and not yet committed to destination.
+	// Consumers pause when the bound is reached. 0 - value of global config is used
+	MaxInFlightEventsOption = ImplementationOption[int]{
+		Key:       "maxInFlightEvents",
+		ParseFunc: utils.ParseInt,
+	}
+
 	ModeOption = ImplementationOption[BulkMode]{Key: "mode", ParseFunc: func(serialized any) (BulkMode, error) {
 		switch v := serialized.(type) {
 		case string:
@@ -91,6 +150,13 @@ var (
 		ParseFunc: utils.ParseString,
 	}
 
+	// VersionColumnOption - column with monotonic version (or offset) of row. When rows are merged by primary key
+	// row with lower version never overwrites row with higher version. Requires deduplicate option
+	VersionColumnOption = ImplementationOption[string]{
+		Key:       "versionColumn",
+		ParseFunc: utils.ParseString,
+	}
+
 	SchemaOption = ImplementationOption[types.Schema]{
 		Key: "schema",
 		ParseFunc: func(serialized any) (types.Schema, error) {
@@ -109,6 +175,55 @@ var (
 			}
 		},
 	}
+
+	// CollectColumnStatsOption - collect per-column statistics (nulls, min/max, distinct estimate) of written rows into stream state
+	CollectColumnStatsOption = ImplementationOption[bool]{
+		Key:          "collectColumnStats",
+		DefaultValue: false,
+		ParseFunc:    utils.ParseBool,
+	}
+
+	// IdempotencyKeyOption - key identifying the whole stream. Completed keys are recorded in destination
+	// and Complete of a stream with already completed key is a no-op. Ignored in Stream mode
+	IdempotencyKeyOption = ImplementationOption[string]{
+		Key:       "idempotencyKey",
+		ParseFunc: utils.ParseString,
+	}
+
+	// SchemaVersionFieldOption - name of event field that contains schema version.
+	// When set, events are routed to version-suffixed tables, e.g. events_v1, events_v2.
+	// Events consumed from destination topics (bulkerapp /post endpoint and ingest) are routed. /bulk requests load to the requested table
+	SchemaVersionFieldOption = ImplementationOption[string]{
+		Key:       "schemaVersionField",
+		ParseFunc: utils.ParseString,
+	}
+
+	// SchemaVersionMappingsOption - version-specific field renames: version -> {sourceField: targetField}
+	// Empty targetField removes the field from event
+	SchemaVersionMappingsOption = ImplementationOption[map[string]map[string]string]{
+		Key: "schemaVersionMappings",
+		ParseFunc: func(serialized any) (map[string]map[string]string, error) {
+			var raw []byte
+			switch v := serialized.(type) {
+			case map[string]map[string]string:
+				return v, nil
+			case string:
+				raw = []byte(v)
+			default:
+				var err error
+				raw, err = json.Marshal(v)
+				if err != nil {
+					return nil, fmt.Errorf("invalid value type of schemaVersionMappings option: %T", v)
+				}
+			}
+			mappings := map[string]map[string]string{}
+			err := json.Unmarshal(raw, &mappings)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse schemaVersionMappings: %v", err)
+			}
+			return mappings, nil
+		},
+	}
 )
 
 func init() {
@@ -117,11 +232,24 @@ func init() {
 	RegisterOption(&BatchFrequencyOption)
 	RegisterOption(&RetryFrequencyOption)
 	RegisterOption(&RetryBatchSizeOption)
+	RegisterOption(&BatchScheduleOption)
+	RegisterOption(&BatchTriggerRowsOption)
+	RegisterOption(&BatchTriggerBytesOption)
+	RegisterOption(&BatchTriggerLagOption)
+	RegisterOption(&ConsumerGroupPrefixOption)
+	RegisterOption(&OffsetResetOption)
+	RegisterOption(&MaxPollIntervalMsOption)
+	RegisterOption(&MaxInFlightEventsOption)
 	RegisterOption(&PrimaryKeyOption)
 	RegisterOption(&DeduplicateOption)
 	RegisterOption(&PartitionIdOption)
 	RegisterOption(&TimestampOption)
+	RegisterOption(&VersionColumnOption)
 	RegisterOption(&SchemaOption)
+	RegisterOption(&CollectColumnStatsOption)
+	RegisterOption(&IdempotencyKeyOption)
+	RegisterOption(&SchemaVersionFieldOption)
+	RegisterOption(&SchemaVersionMappingsOption)
 
 	dummyParse := func(_ any) (any, error) { return nil, nil }
 	for _, ignoredOption := range ignoredOptions {
@@ -158,6 +286,8 @@ func (so *StreamOptions) Add(option StreamOption) {
 
 type ParseableOption interface {
 	Parse(serialized any) (StreamOption, error)
+	valueType() reflect.Type
+	defaultValue() any
 }
 
 type ImplementationOption[V any] struct {
@@ -181,6 +311,15 @@ func (io *ImplementationOption[V]) Parse(serializedValue any) (StreamOption, err
 	}
 }
 
+// valueType returns type of option value. See OptionsSchema
+func (io *ImplementationOption[V]) valueType() reflect.Type {
+	return reflect.TypeOf((*V)(nil)).Elem()
+}
+
+func (io *ImplementationOption[V]) defaultValue() any {
+	return io.DefaultValue
+}
+
 func (io *ImplementationOption[V]) Get(so *StreamOptions) V {
 	opt, ok := so.valuesMap[io.Key].(V)
 	if ok {
@@ -234,6 +373,31 @@ func WithTimestamp(timestampField string) StreamOption {
 	return WithOption(&TimestampOption, timestampField)
 }
 
+// WithVersionColumn protects merged rows from being overwritten by events with lower version, e.g. redelivered by retries
+func WithVersionColumn(versionColumn string) StreamOption {
+	return WithOption(&VersionColumnOption, versionColumn)
+}
+
 func WithSchema(schema types.Schema) StreamOption {
 	return WithOption(&SchemaOption, schema)
 }
+
+// WithSchemaVersionField routes events to version-suffixed tables by value of provided field
+func WithSchemaVersionField(versionField string) StreamOption {
+	return WithOption(&SchemaVersionFieldOption, versionField)
+}
+
+// WithSchemaVersionMappings sets version-specific field renames: version -> {sourceField: targetField}
+func WithSchemaVersionMappings(mappings map[string]map[string]string) StreamOption {
+	return WithOption(&SchemaVersionMappingsOption, mappings)
+}
+
+// WithCollectColumnStats enables collection of per-column statistics of written rows into stream state
+func WithCollectColumnStats() StreamOption {
+	return WithOption(&CollectColumnStatsOption, true)
+}
+
+// WithIdempotencyKey makes Complete of the stream a no-op if stream with the same key was already completed
+func WithIdempotencyKey(key string) StreamOption {
+	return WithOption(&IdempotencyKeyOption, key)
+}
@@ -0,0 +1,279 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// VaultScheme reference to HashiCorp Vault secret: vault://<path>#<key>
+	// e.g. vault://secret/data/warehouse#password for KV v2 engine
+	VaultScheme = "vault://"
+	// AwsSecretsManagerScheme reference to AWS Secrets Manager secret: aws-sm://<secret id or arn>[#<key>]
+	// Without key the whole secret string is used. With key secret string is parsed as JSON object
+	AwsSecretsManagerScheme = "aws-sm://"
+
+	vaultRequestTimeout = 10 * time.Second
+)
+
+// Config of secret providers
+type Config struct {
+	VaultAddr      string
+	VaultToken     string
+	VaultNamespace string
+	// AwsRegion default region for secret ids that are not ARNs
+	AwsRegion string
+	// CacheTTLSec how long resolved secrets are cached. Rotated secrets are picked up after cache expiration
+	CacheTTLSec int64
+}
+
+// Resolver replaces secret references in destination configs with secret values
+type Resolver struct {
+	config     Config
+	httpClient *http.Client
+	// secret fields by secret address (reference without #key)
+	cache *utils.Cache[map[string]string]
+
+	sync.Mutex
+	awsClients map[string]*secretsmanager.SecretsManager
+}
+
+func NewResolver(config Config) *Resolver {
+	return &Resolver{
+		config:     config,
+		httpClient: &http.Client{Timeout: vaultRequestTimeout},
+		cache:      utils.NewCache[map[string]string](config.CacheTTLSec),
+		awsClients: map[string]*secretsmanager.SecretsManager{},
+	}
+}
+
+// IsReference returns true if value is a secret reference
+func IsReference(value string) bool {
+	return strings.HasPrefix(value, VaultScheme) || strings.HasPrefix(value, AwsSecretsManagerScheme)
+}
+
+// HasReferences returns true if obj contains secret references
+func HasReferences(obj any) bool {
+	switch v := obj.(type) {
+	case string:
+		return IsReference(v)
+	case map[string]any:
+		for _, value := range v {
+			if HasReferences(value) {
+				return true
+			}
+		}
+	case []any:
+		for _, value := range v {
+			if HasReferences(value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// References returns all secret references found in obj
+func References(obj any) []string {
+	switch v := obj.(type) {
+	case string:
+		if IsReference(v) {
+			return []string{v}
+		}
+	case map[string]any:
+		var refs []string
+		for _, value := range v {
+			refs = append(refs, References(value)...)
+		}
+		return refs
+	case []any:
+		var refs []string
+		for _, value := range v {
+			refs = append(refs, References(value)...)
+		}
+		return refs
+	}
+	return nil
+}
+
+// Resolve returns copy of obj with all secret references replaced with secret values.
+// Supports nested map[string]any and []any. Values of other types are returned as is
+func (r *Resolver) Resolve(ctx context.Context, obj any) (any, error) {
+	switch v := obj.(type) {
+	case string:
+		if !IsReference(v) {
+			return v, nil
+		}
+		return r.resolveReference(ctx, v)
+	case map[string]any:
+		res := make(map[string]any, len(v))
+		for key, value := range v {
+			resolved, err := r.Resolve(ctx, value)
+			if err != nil {
+				return nil, err
+			}
+			res[key] = resolved
+		}
+		return res, nil
+	case []any:
+		res := make([]any, len(v))
+		for i, value := range v {
+			resolved, err := r.Resolve(ctx, value)
+			if err != nil {
+				return nil, err
+			}
+			res[i] = resolved
+		}
+		return res, nil
+	default:
+		return obj, nil
+	}
+}
+
+func (r *Resolver) resolveReference(ctx context.Context, reference string) (string, error) {
+	address, key, _ := strings.Cut(reference, "#")
+	fields, ok := r.cache.Get(address)
+	if !ok {
+		var err error
+		if strings.HasPrefix(address, VaultScheme) {
+			fields, err = r.readVault(ctx, strings.TrimPrefix(address, VaultScheme))
+		} else {
+			fields, err = r.readAwsSecretsManager(ctx, strings.TrimPrefix(address, AwsSecretsManagerScheme))
+		}
+		if err != nil {
+			// don't expose secret values, only reference
+			return "", fmt.Errorf("failed to resolve secret %s: %v", address, err)
+		}
+		r.cache.Set(address, fields)
+	}
+	if key == "" {
+		if value, ok := fields[""]; ok {
+			return value, nil
+		}
+		if len(fields) == 1 {
+			for _, value := range fields {
+				return value, nil
+			}
+		}
+		return "", fmt.Errorf("secret %s has multiple fields. Key is required: %s#<key>", address, address)
+	}
+	value, ok := fields[key]
+	if !ok {
+		return "", fmt.Errorf("secret %s has no key: %s", address, key)
+	}
+	return value, nil
+}
+
+// readVault reads secret with Vault HTTP API. Both KV v1 and KV v2 secret engines are supported
+func (r *Resolver) readVault(ctx context.Context, path string) (map[string]string, error) {
+	if r.config.VaultAddr == "" {
+		return nil, fmt.Errorf("vault address is not configured")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(r.config.VaultAddr, "/")+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", r.config.VaultToken)
+	if r.config.VaultNamespace != "" {
+		req.Header.Set("X-Vault-Namespace", r.config.VaultNamespace)
+	}
+	res, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vault http status: %d body: %s", res.StatusCode, string(body))
+	}
+	vaultResponse := struct {
+		Data map[string]any `json:"data"`
+	}{}
+	if err = json.Unmarshal(body, &vaultResponse); err != nil {
+		return nil, fmt.Errorf("failed to parse vault response: %v", err)
+	}
+	data := vaultResponse.Data
+	// KV v2 wraps secret data with metadata
+	if nested, ok := data["data"].(map[string]any); ok {
+		if _, ok = data["metadata"]; ok {
+			data = nested
+		}
+	}
+	return stringFields(data), nil
+}
+
+func (r *Resolver) readAwsSecretsManager(ctx context.Context, secretId string) (map[string]string, error) {
+	region := r.config.AwsRegion
+	if parsedArn, err := arn.Parse(secretId); err == nil {
+		region = parsedArn.Region
+	}
+	client, err := r.awsClient(region)
+	if err != nil {
+		return nil, err
+	}
+	output, err := client.GetSecretValueWithContext(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(secretId)})
+	if err != nil {
+		return nil, err
+	}
+	secretString := aws.StringValue(output.SecretString)
+	if secretString == "" && output.SecretBinary != nil {
+		secretString = string(output.SecretBinary)
+	}
+	fields := map[string]string{"": secretString}
+	object := map[string]any{}
+	if err = json.Unmarshal([]byte(secretString), &object); err == nil {
+		for key, value := range stringFields(object) {
+			fields[key] = value
+		}
+	}
+	return fields, nil
+}
+
+// awsClient returns Secrets Manager client for the region. Credentials are taken from default AWS credentials chain
+func (r *Resolver) awsClient(region string) (*secretsmanager.SecretsManager, error) {
+	r.Lock()
+	defer r.Unlock()
+	client, ok := r.awsClients[region]
+	if ok {
+		return client, nil
+	}
+	awsConfig := aws.NewConfig()
+	if region != "" {
+		awsConfig.WithRegion(region)
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{Config: *awsConfig, SharedConfigState: session.SharedConfigEnable})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create aws session: %v", err)
+	}
+	client = secretsmanager.New(sess)
+	r.awsClients[region] = client
+	return client, nil
+}
+
+func stringFields(data map[string]any) map[string]string {
+	fields := make(map[string]string, len(data))
+	for key, value := range data {
+		switch v := value.(type) {
+		case string:
+			fields[key] = v
+		default:
+			b, _ := json.Marshal(v)
+			fields[key] = string(b)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,62 @@
+package secrets
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestResolveVault(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/warehouse":
+			_, _ = w.Write([]byte(`{"data":{"data":{"username":"user","password":"pass"},"metadata":{"version":2}}}`))
+		case "/v1/kv/token":
+			_, _ = w.Write([]byte(`{"data":{"value":"secret_token"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	resolver := NewResolver(Config{VaultAddr: server.URL, VaultToken: "token", CacheTTLSec: 60})
+	config := map[string]any{
+		"host":     "localhost",
+		"port":     5432,
+		"username": "vault://secret/data/warehouse#username",
+		"password": "vault://secret/data/warehouse#password",
+		"hosts":    []any{"vault://kv/token"},
+	}
+	require.True(t, HasReferences(config))
+	require.ElementsMatch(t, []string{"vault://secret/data/warehouse#username", "vault://secret/data/warehouse#password", "vault://kv/token"}, References(config))
+	resolved, err := resolver.Resolve(context.Background(), config)
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{
+		"host":     "localhost",
+		"port":     5432,
+		"username": "user",
+		"password": "pass",
+		"hosts":    []any{"secret_token"},
+	}, resolved)
+	require.False(t, HasReferences(resolved))
+	// references must not be modified
+	require.Equal(t, "vault://secret/data/warehouse#password", config["password"])
+	// one request per secret. Second field is taken from cache
+	require.Equal(t, int32(2), requests.Load())
+
+	_, err = resolver.Resolve(context.Background(), map[string]any{"password": "vault://secret/data/warehouse#missing"})
+	require.ErrorContains(t, err, "has no key: missing")
+	_, err = resolver.Resolve(context.Background(), "vault://secret/data/warehouse")
+	require.ErrorContains(t, err, "Key is required")
+	_, err = resolver.Resolve(context.Background(), "vault://secret/data/unknown#password")
+	require.ErrorContains(t, err, "404")
+}
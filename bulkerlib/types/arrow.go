@@ -0,0 +1,269 @@
+package types
+
+import (
+	"fmt"
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/ipc"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+	jsoniter "github.com/json-iterator/go"
+	"io"
+	"reflect"
+	"time"
+)
+
+// arrowRecordBatchRows max number of rows in single record batch of Arrow file
+const arrowRecordBatchRows = 10_000
+
+var arrowTimestampType = &arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"}
+
+// ArrowMarshaller writes objects to Arrow IPC file (aka Feather v2). Requires schema: columns are typed according to DataTypes of schema.
+// Columns of unknown and json types are written as strings
+type ArrowMarshaller struct {
+	AbstractMarshaller
+	schema  *arrow.Schema
+	columns []string
+	builder *array.RecordBuilder
+	writer  *ipc.FileWriter
+	rows    int
+	// row values of the current object converted to types of columns builders
+	row []any
+}
+
+func (a *ArrowMarshaller) Init(writer io.Writer, header []string) error {
+	return fmt.Errorf("Arrow marshaller doesn't support Init method without schema")
+}
+
+func (a *ArrowMarshaller) InitSchema(writer io.Writer, columns []string, table *AvroSchema) error {
+	ws, ok := writer.(io.WriteSeeker)
+	if !ok {
+		return fmt.Errorf("Arrow marshaller requires seekable writer")
+	}
+	fields := make([]arrow.Field, len(columns))
+	for i, column := range columns {
+		var dataType DataType
+		if table != nil {
+			dataType = table.DataTypes[column]
+		}
+		fields[i] = arrow.Field{Name: column, Type: arrowType(dataType), Nullable: true}
+	}
+	a.schema = arrow.NewSchema(fields, nil)
+	a.columns = columns
+	a.row = make([]any, len(columns))
+	a.builder = array.NewRecordBuilder(memory.DefaultAllocator, a.schema)
+	fileWriter, err := ipc.NewFileWriter(ws, ipc.WithSchema(a.schema))
+	if err != nil {
+		a.builder.Release()
+		return err
+	}
+	a.writer = fileWriter
+	return nil
+}
+
+// Marshal appends objects to the current record batch. Full record batches are written to the file.
+// All values of object are converted before appending, so object that fails conversion isn't written at all
+// and columns of record batch keep the same length
+func (a *ArrowMarshaller) Marshal(object ...Object) error {
+	if a.writer == nil {
+		return fmt.Errorf("marshaller wasn't initialized. Run InitSchema() first")
+	}
+	for _, obj := range object {
+		for i, column := range a.columns {
+			v, err := toArrowValue(a.builder.Field(i), obj[column])
+			if err != nil {
+				return fmt.Errorf("failed to marshal value of column %s: %v", column, err)
+			}
+			a.row[i] = v
+		}
+		for i, v := range a.row {
+			appendArrowValue(a.builder.Field(i), v)
+		}
+		a.rows++
+		if a.rows >= arrowRecordBatchRows {
+			if err := a.writeRecord(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (a *ArrowMarshaller) writeRecord() error {
+	record := a.builder.NewRecord()
+	defer record.Release()
+	a.rows = 0
+	return a.writer.Write(record)
+}
+
+func (a *ArrowMarshaller) Flush() error {
+	if a.writer == nil {
+		return fmt.Errorf("marshaller wasn't initialized. Run InitSchema() first")
+	}
+	defer a.builder.Release()
+	if a.rows > 0 {
+		if err := a.writeRecord(); err != nil {
+			return err
+		}
+	}
+	return a.writer.Close()
+}
+
+func (a *ArrowMarshaller) NeedHeader() bool {
+	return true
+}
+
+func (a *ArrowMarshaller) Format() FileFormat {
+	return a.format
+}
+
+func (a *ArrowMarshaller) Compression() FileCompression {
+	return FileCompressionNONE
+}
+
+func (a *ArrowMarshaller) FileExtension() string {
+	return ".arrow"
+}
+
+// ReadArrowFile reads rows of Arrow IPC file and passes them to rowFunc as objects.
+// Passed object is valid only during rowFunc call
+func ReadArrowFile(file ipc.ReadAtSeeker, rowFunc func(row Object) error) error {
+	reader, err := ipc.NewFileReader(file)
+	if err != nil {
+		return fmt.Errorf("failed to open Arrow file: %v", err)
+	}
+	defer reader.Close()
+	fields := reader.Schema().Fields()
+	row := make(Object, len(fields))
+	for i := 0; i < reader.NumRecords(); i++ {
+		record, err := reader.Record(i)
+		if err != nil {
+			return fmt.Errorf("failed to read record batch %d of Arrow file: %v", i, err)
+		}
+		for r := 0; r < int(record.NumRows()); r++ {
+			for c, field := range fields {
+				row[field.Name] = arrowValue(record.Column(c), r)
+			}
+			if err = rowFunc(row); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// arrowType returns Arrow type of column with provided data type
+func arrowType(dataType DataType) arrow.DataType {
+	switch dataType {
+	case BOOL:
+		return arrow.FixedWidthTypes.Boolean
+	case INT64:
+		return arrow.PrimitiveTypes.Int64
+	case FLOAT64:
+		return arrow.PrimitiveTypes.Float64
+	case TIMESTAMP:
+		return arrowTimestampType
+	default:
+		return arrow.BinaryTypes.String
+	}
+}
+
+// toArrowValue converts value to Go type of column builder: string, bool, int64, float64 or time.Time. nil stays nil
+func toArrowValue(builder array.Builder, value any) (any, error) {
+	if value == nil {
+		return nil, nil
+	}
+	value = ReformatValue(value)
+	switch builder.(type) {
+	case *array.StringBuilder:
+		if v, ok := value.(string); ok {
+			return v, nil
+		}
+		//use json marshaller to marshal types like arrays and time in unified way
+		data, err := jsoniter.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) >= 2 && data[0] == quotaByteValue && data[len(data)-1] == quotaByteValue {
+			data = data[1 : len(data)-1]
+		}
+		return string(data), nil
+	case *array.BooleanBuilder:
+		return convertArrowValue[bool](BOOL, value)
+	case *array.Int64Builder:
+		// Convert keeps Go integer types other than int64 as is
+		if rv := reflect.ValueOf(value); rv.CanInt() {
+			return rv.Int(), nil
+		} else if rv.CanUint() {
+			return int64(rv.Uint()), nil
+		}
+		return convertArrowValue[int64](INT64, value)
+	case *array.Float64Builder:
+		if rv := reflect.ValueOf(value); rv.CanFloat() {
+			return rv.Float(), nil
+		} else if rv.CanInt() {
+			return float64(rv.Int()), nil
+		}
+		return convertArrowValue[float64](FLOAT64, value)
+	case *array.TimestampBuilder:
+		return convertArrowValue[time.Time](TIMESTAMP, value)
+	default:
+		return nil, fmt.Errorf("unsupported Arrow builder: %T", builder)
+	}
+}
+
+// appendArrowValue appends value converted with toArrowValue to column builder
+func appendArrowValue(builder array.Builder, value any) {
+	if value == nil {
+		builder.AppendNull()
+		return
+	}
+	switch b := builder.(type) {
+	case *array.StringBuilder:
+		b.Append(value.(string))
+	case *array.BooleanBuilder:
+		b.Append(value.(bool))
+	case *array.Int64Builder:
+		b.Append(value.(int64))
+	case *array.Float64Builder:
+		b.Append(value.(float64))
+	case *array.TimestampBuilder:
+		b.Append(arrow.Timestamp(value.(time.Time).UnixMicro()))
+	}
+}
+
+func convertArrowValue[T any](dataType DataType, value any) (T, error) {
+	if v, ok := value.(T); ok {
+		return v, nil
+	}
+	var empty T
+	converted, _, err := Convert(dataType, value)
+	if err != nil {
+		return empty, err
+	}
+	v, ok := converted.(T)
+	if !ok {
+		return empty, fmt.Errorf("can't convert %v (%T) to %s", value, value, dataType.String())
+	}
+	return v, nil
+}
+
+// arrowValue returns value of column at row index as a Go value
+func arrowValue(column arrow.Array, i int) any {
+	if column.IsNull(i) {
+		return nil
+	}
+	switch c := column.(type) {
+	case *array.String:
+		return c.Value(i)
+	case *array.Boolean:
+		return c.Value(i)
+	case *array.Int64:
+		return c.Value(i)
+	case *array.Float64:
+		return c.Value(i)
+	case *array.Timestamp:
+		return time.UnixMicro(int64(c.Value(i))).UTC()
+	default:
+		return column.ValueStr(i)
+	}
+}
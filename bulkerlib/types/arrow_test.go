@@ -0,0 +1,82 @@
+package types
+
+import (
+	"github.com/stretchr/testify/require"
+	"maps"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestArrowMarshaller(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	columns := []string{"id", "name", "active", "score", "created_at", "tags"}
+	schema := &AvroSchema{DataTypes: map[string]DataType{
+		"id":         INT64,
+		"name":       STRING,
+		"active":     BOOL,
+		"score":      FLOAT64,
+		"created_at": TIMESTAMP,
+		"tags":       JSON,
+	}}
+	tests := []struct {
+		name    string
+		objects []Object
+		// index of object that fails conversion
+		failing int
+		want    []Object
+	}{
+		{
+			name: "typed_values",
+			objects: []Object{
+				{"id": int64(1), "name": "a", "active": true, "score": 1.5, "created_at": ts, "tags": []any{"x", "y"}},
+				{"id": 2, "name": "b", "active": "false", "score": "2.5", "created_at": "2024-05-01T12:30:00Z"},
+			},
+			failing: -1,
+			want: []Object{
+				{"id": int64(1), "name": "a", "active": true, "score": 1.5, "created_at": ts, "tags": `["x","y"]`},
+				{"id": int64(2), "name": "b", "active": false, "score": 2.5, "created_at": ts, "tags": nil},
+			},
+		},
+		{
+			name: "failing_row_is_skipped",
+			objects: []Object{
+				{"id": int64(1), "name": "a"},
+				// id and name are valid but conversion of score fails
+				{"id": int64(2), "name": "b", "score": "not a number"},
+				{"id": int64(3), "name": "c", "score": 3.0},
+			},
+			failing: 1,
+			want: []Object{
+				{"id": int64(1), "name": "a", "active": nil, "score": nil, "created_at": nil, "tags": nil},
+				{"id": int64(3), "name": "c", "active": nil, "score": 3.0, "created_at": nil, "tags": nil},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := os.CreateTemp(t.TempDir(), "*.arrow")
+			require.NoError(t, err)
+			defer file.Close()
+			marshaller, err := NewMarshaller(FileFormatArrow, FileCompressionNONE)
+			require.NoError(t, err)
+			require.NoError(t, marshaller.InitSchema(file, columns, schema))
+			for i, object := range tt.objects {
+				if i == tt.failing {
+					require.Error(t, marshaller.Marshal(object))
+				} else {
+					require.NoError(t, marshaller.Marshal(object))
+				}
+			}
+			require.NoError(t, marshaller.Flush())
+
+			rows := make([]Object, 0)
+			err = ReadArrowFile(file, func(row Object) error {
+				rows = append(rows, maps.Clone(row))
+				return nil
+			})
+			require.NoError(t, err)
+			require.Equal(t, tt.want, rows)
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package types
+
+import (
+	"compress/gzip"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"io"
+)
+
+// ParseFileCompression validates compression of batch files. Empty value means no compression
+func ParseFileCompression(compression FileCompression) (FileCompression, error) {
+	switch compression {
+	case FileCompressionUNKNOWN, FileCompressionNONE:
+		return FileCompressionNONE, nil
+	case FileCompressionGZIP, FileCompressionZSTD, FileCompressionLZ4:
+		return compression, nil
+	default:
+		return "", fmt.Errorf("unsupported compression: %s. Supported: %s, %s, %s", compression, FileCompressionGZIP, FileCompressionZSTD, FileCompressionLZ4)
+	}
+}
+
+// Extension returns file name extension of compressed files, e.g. ".gz"
+func (c FileCompression) Extension() string {
+	switch c {
+	case FileCompressionGZIP:
+		return ".gz"
+	case FileCompressionZSTD:
+		return ".zst"
+	case FileCompressionLZ4:
+		return ".lz4"
+	default:
+		return ""
+	}
+}
+
+// FileContentType returns Content-Type and Content-Encoding headers of uploaded batch file.
+// gzip files keep 'application/gzip' content type without encoding for compatibility with existing consumers.
+// zstd and lz4 files are declared with content type of the format and content encoding
+func FileContentType(format FileFormat, compression FileCompression) (contentType, contentEncoding string) {
+	if compression == FileCompressionGZIP {
+		return "application/gzip", ""
+	}
+	switch format {
+	case FileFormatCSV:
+		contentType = "text/csv"
+	case FileFormatNDJSON, FileFormatNDJSONFLAT:
+		contentType = "application/x-ndjson"
+	case FileFormatAVRO:
+		contentType = "avro/binary"
+	case FileFormatProtobuf:
+		contentType = "application/x-protobuf"
+	case FileFormatXLSX:
+		contentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case FileFormatArrow:
+		contentType = "application/vnd.apache.arrow.file"
+	}
+	switch compression {
+	case FileCompressionZSTD, FileCompressionLZ4:
+		contentEncoding = string(compression)
+	}
+	return contentType, contentEncoding
+}
+
+// NewCompressionWriter returns writer that compresses data written to w. Returns nil if compression is none.
+// Writer must be closed to flush compressed data
+func NewCompressionWriter(w io.Writer, compression FileCompression) (io.WriteCloser, error) {
+	return NewCompressionWriterLevel(w, compression, 0)
+}
+
+// NewCompressionWriterLevel returns writer that compresses data written to w with provided level. 0 - default level of compression.
+// See MarshallerConfig.CompressionLevel for supported levels
+func NewCompressionWriterLevel(w io.Writer, compression FileCompression, level int) (io.WriteCloser, error) {
+	if err := ValidateCompressionLevel(compression, level); err != nil {
+		return nil, err
+	}
+	switch compression {
+	case FileCompressionUNKNOWN, FileCompressionNONE:
+		return nil, nil
+	case FileCompressionGZIP:
+		if level == 0 {
+			return gzip.NewWriter(w), nil
+		}
+		return gzip.NewWriterLevel(w, level)
+	case FileCompressionZSTD:
+		if level == 0 {
+			return zstd.NewWriter(w)
+		}
+		return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+	case FileCompressionLZ4:
+		writer := lz4.NewWriter(w)
+		if level > 0 {
+			if err := writer.Apply(lz4.CompressionLevelOption(lz4.Level1 << (level - 1))); err != nil {
+				return nil, err
+			}
+		}
+		return writer, nil
+	default:
+		return nil, fmt.Errorf("unsupported compression: %s", compression)
+	}
+}
+
+// ValidateCompressionLevel returns err if level isn't supported by compression. 0 - default level is always valid
+func ValidateCompressionLevel(compression FileCompression, level int) error {
+	if level == 0 {
+		return nil
+	}
+	maxLevel := 0
+	switch compression {
+	case FileCompressionGZIP, FileCompressionLZ4:
+		maxLevel = 9
+	case FileCompressionZSTD:
+		maxLevel = 22
+	}
+	if level < 1 || level > maxLevel {
+		if maxLevel == 0 {
+			return fmt.Errorf("compression level is not supported without compression")
+		}
+		return fmt.Errorf("unsupported %s compression level: %d. Supported: 1-%d", compression, level, maxLevel)
+	}
+	return nil
+}
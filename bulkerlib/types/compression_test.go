@@ -0,0 +1,114 @@
+package types
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/stretchr/testify/require"
+	"io"
+	"testing"
+)
+
+func TestCompressionWriter(t *testing.T) {
+	data := bytes.Repeat([]byte(`{"id":1,"name":"test"}`+"\n"), 1000)
+	tests := []struct {
+		compression FileCompression
+		extension   string
+		reader      func(r io.Reader) (io.Reader, error)
+	}{
+		{FileCompressionGZIP, ".gz", func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }},
+		{FileCompressionZSTD, ".zst", func(r io.Reader) (io.Reader, error) { return zstd.NewReader(r) }},
+		{FileCompressionLZ4, ".lz4", func(r io.Reader) (io.Reader, error) { return lz4.NewReader(r), nil }},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.compression), func(t *testing.T) {
+			compression, err := ParseFileCompression(tt.compression)
+			require.NoError(t, err)
+			require.Equal(t, tt.extension, compression.Extension())
+			buf := &bytes.Buffer{}
+			writer, err := NewCompressionWriter(buf, compression)
+			require.NoError(t, err)
+			_, err = writer.Write(data)
+			require.NoError(t, err)
+			require.NoError(t, writer.Close())
+			require.Less(t, buf.Len(), len(data))
+
+			reader, err := tt.reader(buf)
+			require.NoError(t, err)
+			decompressed, err := io.ReadAll(reader)
+			require.NoError(t, err)
+			require.Equal(t, data, decompressed)
+		})
+	}
+	writer, err := NewCompressionWriter(&bytes.Buffer{}, FileCompressionNONE)
+	require.NoError(t, err)
+	require.Nil(t, writer)
+	_, err = ParseFileCompression("brotli")
+	require.Error(t, err)
+}
+
+func TestCompressionLevel(t *testing.T) {
+	data := bytes.Repeat([]byte(`{"id":1,"name":"test"}`+"\n"), 1000)
+	readers := map[FileCompression]func(r io.Reader) (io.Reader, error){
+		FileCompressionGZIP: func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		FileCompressionZSTD: func(r io.Reader) (io.Reader, error) { return zstd.NewReader(r) },
+		FileCompressionLZ4:  func(r io.Reader) (io.Reader, error) { return lz4.NewReader(r), nil },
+	}
+	tests := []struct {
+		compression FileCompression
+		level       int
+		wantErr     bool
+	}{
+		{FileCompressionGZIP, 1, false},
+		{FileCompressionGZIP, 9, false},
+		{FileCompressionGZIP, 10, true},
+		{FileCompressionZSTD, 1, false},
+		{FileCompressionZSTD, 22, false},
+		{FileCompressionZSTD, 23, true},
+		{FileCompressionLZ4, 1, false},
+		{FileCompressionLZ4, 9, false},
+		{FileCompressionLZ4, -1, true},
+		{FileCompressionNONE, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s_%d", tt.compression, tt.level), func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			writer, err := NewCompressionWriterLevel(buf, tt.compression, tt.level)
+			if tt.wantErr {
+				require.Error(t, err)
+				_, err = NewMarshaller(FileFormatNDJSON, tt.compression, WithCompressionLevel(tt.level))
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			_, err = writer.Write(data)
+			require.NoError(t, err)
+			require.NoError(t, writer.Close())
+
+			reader, err := readers[tt.compression](buf)
+			require.NoError(t, err)
+			decompressed, err := io.ReadAll(reader)
+			require.NoError(t, err)
+			require.Equal(t, data, decompressed)
+		})
+	}
+}
+
+func TestMarshallerFlushEvery(t *testing.T) {
+	for _, format := range []FileFormat{FileFormatNDJSON, FileFormatCSV, FileFormatMsgPack} {
+		t.Run(string(format), func(t *testing.T) {
+			marshaller, err := NewMarshaller(format, FileCompressionNONE, WithBufferSize(100), WithFlushEvery(2))
+			require.NoError(t, err)
+			buf := &bytes.Buffer{}
+			require.NoError(t, marshaller.Init(buf, []string{"id"}))
+			require.NoError(t, marshaller.Marshal(Object{"id": 1}))
+			require.Zero(t, buf.Len(), "object must stay in buffer until flushEvery objects are written")
+			require.NoError(t, marshaller.Marshal(Object{"id": 2}))
+			require.NotZero(t, buf.Len())
+		})
+	}
+	_, err := NewMarshaller(FileFormatNDJSON, FileCompressionNONE, WithBufferSize(-1))
+	require.Error(t, err)
+}
@@ -2,13 +2,13 @@ package types
 
 import (
 	"bufio"
-	"compress/gzip"
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"github.com/hamba/avro/v2/ocf"
 	jsoniter "github.com/json-iterator/go"
 	"io"
+	"strconv"
 )
 
 const quotaByteValue = 34
@@ -25,23 +25,126 @@ type Marshaller interface {
 	FileExtension() string
 }
 
+const (
+	// defaultMarshallerBufferSize size of write buffer of marshallers when MarshallerConfig.BufferSize is not set
+	defaultMarshallerBufferSize = 10 * 1024 * 1024
+	// minMarshallerBufferSize smaller buffers are not used so csv.Writer reuses buffer of marshaller instead of wrapping it
+	minMarshallerBufferSize = 4096
+)
+
+// MarshallerConfig tunes compression and buffering of marshallers. Zero values mean defaults
+type MarshallerConfig struct {
+	// CompressionLevel gzip: 1 (fastest) - 9 (best), zstd: 1 - 22 (mapped to the closest encoder level), lz4: 1 - 9 (high compression levels).
+	// Default: default level of compression
+	CompressionLevel int `mapstructure:"compressionLevel,omitempty" json:"compressionLevel,omitempty" yaml:"compressionLevel,omitempty"`
+	// BufferSize size of write buffer in bytes (at least 4096). Default: 10 MB
+	BufferSize int `mapstructure:"bufferSize,omitempty" json:"bufferSize,omitempty" yaml:"bufferSize,omitempty"`
+	// FlushEvery write buffered data to underlying writer after every N objects. Default: only when buffer is full
+	FlushEvery int `mapstructure:"flushEvery,omitempty" json:"flushEvery,omitempty" yaml:"flushEvery,omitempty"`
+}
+
+// Validate returns err if invalid
+func (mc *MarshallerConfig) Validate(compression FileCompression) error {
+	if mc.BufferSize < 0 || mc.FlushEvery < 0 {
+		return fmt.Errorf("bufferSize and flushEvery must not be negative")
+	}
+	return ValidateCompressionLevel(compression, mc.CompressionLevel)
+}
+
+// MarshallerOption sets parameter of MarshallerConfig
+type MarshallerOption func(*MarshallerConfig)
+
+// WithMarshallerConfig sets all parameters of MarshallerConfig
+func WithMarshallerConfig(config MarshallerConfig) MarshallerOption {
+	return func(mc *MarshallerConfig) {
+		*mc = config
+	}
+}
+
+// WithCompressionLevel sets compression level. See MarshallerConfig.CompressionLevel
+func WithCompressionLevel(level int) MarshallerOption {
+	return func(mc *MarshallerConfig) {
+		mc.CompressionLevel = level
+	}
+}
+
+// WithBufferSize sets size of write buffer in bytes
+func WithBufferSize(size int) MarshallerOption {
+	return func(mc *MarshallerConfig) {
+		mc.BufferSize = size
+	}
+}
+
+// WithFlushEvery makes marshaller write buffered data to underlying writer after every n objects
+func WithFlushEvery(n int) MarshallerOption {
+	return func(mc *MarshallerConfig) {
+		mc.FlushEvery = n
+	}
+}
+
 type AbstractMarshaller struct {
 	format      FileFormat
 	compression FileCompression
+	config      MarshallerConfig
+	// marshalled number of objects written since the last flush of buffer
+	marshalled int
 }
 
 func (am *AbstractMarshaller) Equal(m Marshaller) bool {
 	return am.format == m.Format() && am.compression == m.Compression()
 }
 
-func NewMarshaller(format FileFormat, compression FileCompression) (Marshaller, error) {
+// newCompressionWriter returns compressor with configured level. Returns nil if compression is none
+func (am *AbstractMarshaller) newCompressionWriter(w io.Writer) (io.WriteCloser, error) {
+	return NewCompressionWriterLevel(w, am.compression, am.config.CompressionLevel)
+}
+
+// newBufferedWriter returns buffered writer of configured size
+func (am *AbstractMarshaller) newBufferedWriter(w io.Writer) *bufio.Writer {
+	if am.config.BufferSize > 0 {
+		return bufio.NewWriterSize(w, max(am.config.BufferSize, minMarshallerBufferSize))
+	}
+	return bufio.NewWriterSize(w, defaultMarshallerBufferSize)
+}
+
+// afterMarshal flushes buffered writer every FlushEvery objects
+func (am *AbstractMarshaller) afterMarshal(flush func() error) error {
+	if am.config.FlushEvery <= 0 {
+		return nil
+	}
+	am.marshalled++
+	if am.marshalled < am.config.FlushEvery {
+		return nil
+	}
+	am.marshalled = 0
+	return flush()
+}
+
+func NewMarshaller(format FileFormat, compression FileCompression, options ...MarshallerOption) (Marshaller, error) {
+	am := AbstractMarshaller{format: format, compression: compression}
+	for _, option := range options {
+		option(&am.config)
+	}
+	if err := am.config.Validate(compression); err != nil {
+		return nil, err
+	}
 	switch format {
 	case FileFormatCSV:
-		return &CSVMarshaller{AbstractMarshaller: AbstractMarshaller{format: format, compression: compression}}, nil
+		return &CSVMarshaller{AbstractMarshaller: am}, nil
 	case FileFormatNDJSON, FileFormatNDJSONFLAT:
-		return &JSONMarshaller{AbstractMarshaller: AbstractMarshaller{format: format, compression: compression}}, nil
+		return &JSONMarshaller{AbstractMarshaller: am}, nil
 	case FileFormatAVRO:
-		return &AvroMarshaller{AbstractMarshaller: AbstractMarshaller{format: format, compression: compression}}, nil
+		return &AvroMarshaller{AbstractMarshaller: am}, nil
+	case FileFormatArrow:
+		am.compression = FileCompressionNONE
+		return &ArrowMarshaller{AbstractMarshaller: am}, nil
+	case FileFormatProtobuf:
+		return &ProtobufMarshaller{AbstractMarshaller: am}, nil
+	case FileFormatMsgPack:
+		return &MsgPackMarshaller{AbstractMarshaller: am}, nil
+	case FileFormatXLSX:
+		am.compression = FileCompressionNONE
+		return &XLSXMarshaller{AbstractMarshaller: am}, nil
 	default:
 		return nil, fmt.Errorf("Unknown file format: %s", format)
 	}
@@ -49,19 +152,24 @@ func NewMarshaller(format FileFormat, compression FileCompression) (Marshaller,
 
 type JSONMarshaller struct {
 	AbstractMarshaller
-	writer    io.Writer
-	bufWriter *bufio.Writer
-	encoder   *jsoniter.Encoder
+	writer     io.Writer
+	compressor io.WriteCloser
+	bufWriter  *bufio.Writer
+	encoder    *jsoniter.Encoder
 }
 
 func (jm *JSONMarshaller) Init(writer io.Writer, _ []string) error {
 	if jm.writer == nil {
-		if jm.compression == FileCompressionGZIP {
-			jm.writer = gzip.NewWriter(writer)
-		} else {
-			jm.writer = writer
+		compressor, err := jm.newCompressionWriter(writer)
+		if err != nil {
+			return err
+		}
+		jm.writer = writer
+		if compressor != nil {
+			jm.compressor = compressor
+			jm.writer = compressor
 		}
-		jm.bufWriter = bufio.NewWriterSize(jm.writer, 10*1024*1024)
+		jm.bufWriter = jm.newBufferedWriter(jm.writer)
 		jm.encoder = jsoniter.NewEncoder(jm.bufWriter)
 		jm.encoder.SetEscapeHTML(false)
 	}
@@ -82,6 +190,9 @@ func (jm *JSONMarshaller) Marshal(object ...Object) error {
 		if err != nil {
 			return err
 		}
+		if err = jm.afterMarshal(jm.bufWriter.Flush); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -94,8 +205,8 @@ func (jm *JSONMarshaller) Flush() error {
 	if err != nil {
 		return err
 	}
-	if jm.compression == FileCompressionGZIP {
-		return jm.writer.(*gzip.Writer).Close()
+	if jm.compressor != nil {
+		return jm.compressor.Close()
 	}
 	return nil
 }
@@ -113,29 +224,30 @@ func (jm *JSONMarshaller) Compression() FileCompression {
 }
 
 func (jm *JSONMarshaller) FileExtension() string {
-	if jm.compression == FileCompressionGZIP {
-		return ".ndjson.gz"
-	}
-	return ".ndjson"
+	return ".ndjson" + jm.compression.Extension()
 }
 
 type CSVMarshaller struct {
 	AbstractMarshaller
 	writer     *csv.Writer
-	gzipWriter *gzip.Writer
+	compressor io.WriteCloser
 	fields     []string
 }
 
 func (cm *CSVMarshaller) Init(writer io.Writer, header []string) error {
 	if cm.writer == nil {
-		if cm.compression == FileCompressionGZIP {
-			cm.gzipWriter = gzip.NewWriter(writer)
-			cm.writer = csv.NewWriter(cm.gzipWriter)
-		} else {
-			cm.writer = csv.NewWriter(writer)
+		compressor, err := cm.newCompressionWriter(writer)
+		if err != nil {
+			return err
+		}
+		if compressor != nil {
+			cm.compressor = compressor
+			writer = compressor
 		}
+		// csv writer reuses buffered writer of sufficient size
+		cm.writer = csv.NewWriter(cm.newBufferedWriter(writer))
 		cm.fields = header
-		err := cm.writer.Write(header)
+		err = cm.writer.Write(header)
 		if err != nil {
 			return err
 		}
@@ -190,10 +302,18 @@ func (cm *CSVMarshaller) Marshal(object ...Object) error {
 		if err != nil {
 			return err
 		}
+		if err = cm.afterMarshal(cm.flushWriter); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+func (cm *CSVMarshaller) flushWriter() error {
+	cm.writer.Flush()
+	return cm.writer.Error()
+}
+
 func (cm *CSVMarshaller) NeedHeader() bool {
 	return true
 }
@@ -211,17 +331,17 @@ func (cm *CSVMarshaller) Flush() error {
 		return fmt.Errorf("marshaller wasn't initialized. Run Init() first")
 	}
 	cm.writer.Flush()
-	if cm.gzipWriter != nil {
-		return cm.gzipWriter.Close()
+	if err := cm.writer.Error(); err != nil {
+		return err
+	}
+	if cm.compressor != nil {
+		return cm.compressor.Close()
 	}
 	return nil
 }
 
 func (cm *CSVMarshaller) FileExtension() string {
-	if cm.compression == FileCompressionGZIP {
-		return ".csv.gz"
-	}
-	return ".csv"
+	return ".csv" + cm.compression.Extension()
 }
 
 type FileFormat string
@@ -231,12 +351,28 @@ const (
 	FileFormatAVRO       FileFormat = "avro"
 	FileFormatNDJSON     FileFormat = "ndjson"
 	FileFormatNDJSONFLAT FileFormat = "ndjson_flat"
+	// FileFormatArrow Arrow IPC file format (aka Feather v2)
+	FileFormatArrow FileFormat = "arrow"
+	// FileFormatProtobuf size-delimited protobuf messages: varint length prefix before every message
+	FileFormatProtobuf FileFormat = "protobuf"
+	// FileFormatMsgPack stream of MessagePack maps. Supported only as internal format of local batch files
+	FileFormatMsgPack FileFormat = "msgpack"
+	// FileFormatXLSX Excel workbook with single worksheet. Intended for modest datasets delivered to business users
+	FileFormatXLSX FileFormat = "xlsx"
+	// FileFormatDelta Delta Lake table: parquet data files and transaction log. Supported only by file storage bulkers
+	FileFormatDelta FileFormat = "delta"
+	// FileFormatHudi Apache Hudi copy-on-write table: parquet base files and timeline. Supported only by file storage bulkers
+	FileFormatHudi FileFormat = "hudi"
 )
 
 type FileCompression string
 
 const (
-	FileCompressionGZIP    FileCompression = "gzip"
+	FileCompressionGZIP FileCompression = "gzip"
+	// FileCompressionZSTD Zstandard: compresses faster than gzip with similar ratio
+	FileCompressionZSTD FileCompression = "zstd"
+	// FileCompressionLZ4 LZ4 frame format: the fastest, with lower compression ratio
+	FileCompressionLZ4     FileCompression = "lz4"
 	FileCompressionNONE    FileCompression = "none"
 	FileCompressionUNKNOWN FileCompression = ""
 )
@@ -245,6 +381,16 @@ type AvroMarshaller struct {
 	AbstractMarshaller
 	schema  *AvroSchema
 	encoder *ocf.Encoder
+
+	schemaRegistry *SchemaRegistry
+	subject        string
+}
+
+// UseSchemaRegistry makes marshaller register schemas of files in Schema Registry under subject (or use the latest schema of subject)
+// and embed schema id in file metadata
+func (a *AvroMarshaller) UseSchemaRegistry(schemaRegistry *SchemaRegistry, subject string) {
+	a.schemaRegistry = schemaRegistry
+	a.subject = subject
 }
 
 func (a *AvroMarshaller) Init(writer io.Writer, header []string) error {
@@ -254,7 +400,20 @@ func (a *AvroMarshaller) Init(writer io.Writer, header []string) error {
 func (a *AvroMarshaller) InitSchema(writer io.Writer, columns []string, table *AvroSchema) error {
 	avroSchemaStr, _ := json.Marshal(table)
 	//fmt.Println("Avro schema: ", string(avroSchemaStr))
-	enc, err := ocf.NewEncoder(string(avroSchemaStr), writer, ocf.WithCodec(ocf.Snappy))
+	schema := string(avroSchemaStr)
+	opts := []ocf.EncoderFunc{ocf.WithCodec(ocf.Snappy)}
+	if a.schemaRegistry != nil {
+		id, registrySchema, err := a.schemaRegistry.Schema(a.subject, schema)
+		if err != nil {
+			return err
+		}
+		schema = registrySchema
+		opts = append(opts, ocf.WithMetadata(map[string][]byte{
+			AvroSchemaIdMetadataKey:      []byte(strconv.Itoa(id)),
+			AvroSchemaSubjectMetadataKey: []byte(a.subject),
+		}))
+	}
+	enc, err := ocf.NewEncoder(schema, writer, opts...)
 	if err != nil {
 		return err
 	}
@@ -270,9 +429,13 @@ func (a *AvroMarshaller) Marshal(object ...Object) error {
 		for k, v := range obj {
 			dt := a.schema.DataTypes[k]
 			//fmt.Println("Avro marshaller: ", k, v, dt)
+			// numbers of objects decoded with UseNumber
+			v, reformatted := ReformatNumberValue(v)
 			cv, ok, _ := Convert(dt, v)
 			if ok {
 				obj[k] = cv
+			} else if reformatted {
+				obj[k] = v
 			}
 		}
 		err := a.encoder.Encode(obj)
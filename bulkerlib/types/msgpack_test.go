@@ -0,0 +1,38 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestMsgPackMarshaller(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 123000, time.UTC)
+	marshaller, err := NewMarshaller(FileFormatMsgPack, FileCompressionNONE)
+	require.NoError(t, err)
+	buf := &bytes.Buffer{}
+	require.NoError(t, marshaller.InitSchema(buf, nil, nil))
+	require.NoError(t, marshaller.Marshal(
+		Object{"id": json.Number("1"), "score": json.Number("1.5"), "big": json.Number("99999999999999999999"), "name": "a", "timestamp": ts},
+		Object{"id": 2, "neg": int64(-300), "flag": true, "nil": nil, "arr": []any{json.Number("3"), "b"}, "obj": map[string]any{"n": 4}}))
+	require.NoError(t, marshaller.Flush())
+	require.Equal(t, ".msgpack", marshaller.FileExtension())
+
+	reader := NewMsgPackReader(buf)
+	objects := make([]Object, 0)
+	for {
+		obj, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		objects = append(objects, obj)
+	}
+	require.Equal(t, []Object{
+		{"id": int64(1), "score": 1.5, "big": "99999999999999999999", "name": "a", "timestamp": ts},
+		{"id": int64(2), "neg": int64(-300), "flag": true, "nil": nil, "arr": []any{int64(3), "b"}, "obj": map[string]any{"n": int64(4)}},
+	}, objects)
+}
@@ -0,0 +1,340 @@
+package types
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"google.golang.org/protobuf/encoding/protodelim"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"io"
+	"math"
+	"reflect"
+	"time"
+)
+
+// ProtobufSchema user supplied schema of protobuf files
+type ProtobufSchema struct {
+	// DescriptorSet base64 encoded FileDescriptorSet with message type and its dependencies,
+	// e.g. output of: protoc --include_imports --descriptor_set_out=events.desc events.proto
+	DescriptorSet string `mapstructure:"descriptorSet" json:"descriptorSet" yaml:"descriptorSet"`
+	// Message full name of message type of file rows, e.g. "analytics.Event"
+	Message string `mapstructure:"message" json:"message" yaml:"message"`
+}
+
+// MessageDescriptor returns descriptor of configured message type
+func (s *ProtobufSchema) MessageDescriptor() (protoreflect.MessageDescriptor, error) {
+	raw, err := base64.StdEncoding.DecodeString(s.DescriptorSet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode protobuf descriptorSet: %v", err)
+	}
+	descriptorSet := &descriptorpb.FileDescriptorSet{}
+	if err = proto.Unmarshal(raw, descriptorSet); err != nil {
+		return nil, fmt.Errorf("failed to parse protobuf descriptorSet: %v", err)
+	}
+	files, err := protodesc.NewFiles(descriptorSet)
+	if err != nil {
+		return nil, fmt.Errorf("invalid protobuf descriptorSet: %v", err)
+	}
+	descriptor, err := files.FindDescriptorByName(protoreflect.FullName(s.Message))
+	if err != nil {
+		return nil, fmt.Errorf("protobuf message %s not found in descriptorSet: %v", s.Message, err)
+	}
+	md, ok := descriptor.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a protobuf message", s.Message)
+	}
+	return md, nil
+}
+
+// ProtobufMessageDescriptor returns descriptor of proto2 message generated from table schema.
+// Fields are numbered in order of schema fields. Timestamps are int64 microseconds since epoch, json values are strings
+func ProtobufMessageDescriptor(table *AvroSchema) (protoreflect.MessageDescriptor, error) {
+	message := &descriptorpb.DescriptorProto{Name: proto.String(table.Name)}
+	for i, field := range table.Fields {
+		message.Field = append(message.Field, &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(field.Name),
+			JsonName: proto.String(field.Name),
+			Number:   proto.Int32(int32(i + 1)),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     protobufType(table.DataTypes[field.Name]).Enum(),
+		})
+	}
+	file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:        proto.String(table.Name + ".proto"),
+		Package:     proto.String("bulker"),
+		Syntax:      proto.String("proto2"),
+		MessageType: []*descriptorpb.DescriptorProto{message},
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate protobuf schema: %v", err)
+	}
+	return file.Messages().Get(0), nil
+}
+
+// ProtobufDescriptorSet returns serialized FileDescriptorSet with message type and its dependencies
+func ProtobufDescriptorSet(md protoreflect.MessageDescriptor) ([]byte, error) {
+	descriptorSet := &descriptorpb.FileDescriptorSet{}
+	added := map[string]bool{}
+	var addFile func(file protoreflect.FileDescriptor)
+	addFile = func(file protoreflect.FileDescriptor) {
+		if added[file.Path()] {
+			return
+		}
+		added[file.Path()] = true
+		imports := file.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			addFile(imports.Get(i).FileDescriptor)
+		}
+		descriptorSet.File = append(descriptorSet.File, protodesc.ToFileDescriptorProto(file))
+	}
+	addFile(md.ParentFile())
+	return proto.Marshal(descriptorSet)
+}
+
+func protobufType(dataType DataType) descriptorpb.FieldDescriptorProto_Type {
+	switch dataType {
+	case INT64, TIMESTAMP:
+		return descriptorpb.FieldDescriptorProto_TYPE_INT64
+	case FLOAT64:
+		return descriptorpb.FieldDescriptorProto_TYPE_DOUBLE
+	case BOOL:
+		return descriptorpb.FieldDescriptorProto_TYPE_BOOL
+	default:
+		return descriptorpb.FieldDescriptorProto_TYPE_STRING
+	}
+}
+
+// ProtobufMarshaller writes objects as size-delimited protobuf messages (varint length prefix before every message).
+// Message type is either supplied with UseSchema or generated from table schema passed to InitSchema.
+// Object fields missing in message type are skipped
+type ProtobufMarshaller struct {
+	AbstractMarshaller
+	descriptor protoreflect.MessageDescriptor
+	// userSchema descriptor was supplied with UseSchema and isn't generated from table schema
+	userSchema bool
+	writer     io.Writer
+	compressor io.WriteCloser
+	bufWriter  *bufio.Writer
+}
+
+// UseSchema makes marshaller write messages of provided type instead of type generated from table schema
+func (pm *ProtobufMarshaller) UseSchema(descriptor protoreflect.MessageDescriptor) {
+	pm.descriptor = descriptor
+	pm.userSchema = true
+}
+
+// Descriptor returns message type of written messages
+func (pm *ProtobufMarshaller) Descriptor() protoreflect.MessageDescriptor {
+	return pm.descriptor
+}
+
+// GeneratedSchema returns true if message type was generated from table schema
+func (pm *ProtobufMarshaller) GeneratedSchema() bool {
+	return !pm.userSchema
+}
+
+func (pm *ProtobufMarshaller) Init(writer io.Writer, _ []string) error {
+	if pm.descriptor == nil {
+		return fmt.Errorf("Protobuf marshaller doesn't support Init method without schema")
+	}
+	return pm.initWriter(writer)
+}
+
+func (pm *ProtobufMarshaller) InitSchema(writer io.Writer, _ []string, table *AvroSchema) error {
+	if !pm.userSchema {
+		if table == nil {
+			return fmt.Errorf("Protobuf marshaller requires schema")
+		}
+		descriptor, err := ProtobufMessageDescriptor(table)
+		if err != nil {
+			return err
+		}
+		pm.descriptor = descriptor
+	}
+	return pm.initWriter(writer)
+}
+
+func (pm *ProtobufMarshaller) initWriter(writer io.Writer) error {
+	if pm.writer == nil {
+		compressor, err := pm.newCompressionWriter(writer)
+		if err != nil {
+			return err
+		}
+		pm.writer = writer
+		if compressor != nil {
+			pm.compressor = compressor
+			pm.writer = compressor
+		}
+		pm.bufWriter = pm.newBufferedWriter(pm.writer)
+	}
+	return nil
+}
+
+// Marshal writes objects as size-delimited messages
+func (pm *ProtobufMarshaller) Marshal(object ...Object) error {
+	if pm.writer == nil {
+		return fmt.Errorf("marshaller wasn't initialized. Run InitSchema() first")
+	}
+	fields := pm.descriptor.Fields()
+	for _, obj := range object {
+		message := dynamicpb.NewMessage(pm.descriptor)
+		for i := 0; i < fields.Len(); i++ {
+			fd := fields.Get(i)
+			v, ok := obj[string(fd.Name())]
+			if !ok || v == nil {
+				continue
+			}
+			value, err := protobufValue(fd, v)
+			if err != nil {
+				return fmt.Errorf("failed to marshal value of field %s: %v", fd.Name(), err)
+			}
+			message.Set(fd, value)
+		}
+		if _, err := protodelim.MarshalTo(pm.bufWriter, message); err != nil {
+			return err
+		}
+		if err := pm.afterMarshal(pm.bufWriter.Flush); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// protobufValue converts object value to value of scalar protobuf field. Values of repeated and message fields aren't supported
+func protobufValue(fd protoreflect.FieldDescriptor, v any) (protoreflect.Value, error) {
+	if fd.IsList() || fd.IsMap() || fd.Message() != nil {
+		return protoreflect.Value{}, fmt.Errorf("only scalar fields are supported")
+	}
+	v, _ = ReformatNumberValue(v)
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		switch s := v.(type) {
+		case string:
+			return protoreflect.ValueOfString(s), nil
+		case time.Time:
+			return protoreflect.ValueOfString(s.Format(time.RFC3339Nano)), nil
+		default:
+			str, _, err := Convert(STRING, v)
+			if err != nil {
+				return protoreflect.Value{}, err
+			}
+			return protoreflect.ValueOfString(fmt.Sprint(str)), nil
+		}
+	case protoreflect.BoolKind:
+		b, _, err := Convert(BOOL, v)
+		if err != nil {
+			return protoreflect.Value{}, err
+		}
+		return protoreflect.ValueOfBool(reflect.ValueOf(b).Bool()), nil
+	case protoreflect.DoubleKind, protoreflect.FloatKind:
+		f, _, err := Convert(FLOAT64, v)
+		if err != nil {
+			return protoreflect.Value{}, err
+		}
+		rv := reflect.ValueOf(f)
+		var float float64
+		switch {
+		case rv.CanFloat():
+			float = rv.Float()
+		case rv.CanInt():
+			float = float64(rv.Int())
+		case rv.CanUint():
+			float = float64(rv.Uint())
+		default:
+			return protoreflect.Value{}, fmt.Errorf("can't convert %T to double", f)
+		}
+		if fd.Kind() == protoreflect.FloatKind {
+			return protoreflect.ValueOfFloat32(float32(float)), nil
+		}
+		return protoreflect.ValueOfFloat64(float), nil
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind, protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		i, err := protobufInt(v)
+		if err != nil {
+			return protoreflect.Value{}, err
+		}
+		switch fd.Kind() {
+		case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+			if i < math.MinInt32 || i > math.MaxInt32 {
+				return protoreflect.Value{}, fmt.Errorf("value %d overflows int32", i)
+			}
+			return protoreflect.ValueOfInt32(int32(i)), nil
+		case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+			if i < 0 {
+				return protoreflect.Value{}, fmt.Errorf("negative value %d of unsigned field", i)
+			}
+			return protoreflect.ValueOfUint64(uint64(i)), nil
+		case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+			if i < 0 || i > math.MaxUint32 {
+				return protoreflect.Value{}, fmt.Errorf("value %d overflows uint32", i)
+			}
+			return protoreflect.ValueOfUint32(uint32(i)), nil
+		default:
+			return protoreflect.ValueOfInt64(i), nil
+		}
+	default:
+		return protoreflect.Value{}, fmt.Errorf("unsupported field type: %s", fd.Kind())
+	}
+}
+
+// protobufInt converts value to int64. Timestamps are converted to microseconds since epoch
+func protobufInt(v any) (int64, error) {
+	if tm, ok := v.(time.Time); ok {
+		return tm.UnixMicro(), nil
+	}
+	if tm, ok := ReformatTimeValue(v, false); ok {
+		return tm.UnixMicro(), nil
+	}
+	converted, _, err := Convert(INT64, v)
+	if err != nil {
+		return 0, err
+	}
+	rv := reflect.ValueOf(converted)
+	switch {
+	case rv.CanInt():
+		return rv.Int(), nil
+	case rv.CanUint():
+		if rv.Uint() > math.MaxInt64 {
+			return 0, fmt.Errorf("value %d overflows int64", rv.Uint())
+		}
+		return int64(rv.Uint()), nil
+	case rv.CanFloat():
+		return int64(rv.Float()), nil
+	default:
+		return 0, fmt.Errorf("can't convert %T to integer", converted)
+	}
+}
+
+func (pm *ProtobufMarshaller) Flush() error {
+	if pm.writer == nil {
+		return fmt.Errorf("marshaller wasn't initialized. Run InitSchema() first")
+	}
+	if err := pm.bufWriter.Flush(); err != nil {
+		return err
+	}
+	if pm.compressor != nil {
+		return pm.compressor.Close()
+	}
+	return nil
+}
+
+func (pm *ProtobufMarshaller) NeedHeader() bool {
+	return false
+}
+
+func (pm *ProtobufMarshaller) Format() FileFormat {
+	return pm.format
+}
+
+func (pm *ProtobufMarshaller) Compression() FileCompression {
+	return pm.compression
+}
+
+func (pm *ProtobufMarshaller) FileExtension() string {
+	return ".pb" + pm.compression.Extension()
+}
@@ -0,0 +1,89 @@
+package types
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protodelim"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestProtobufMarshaller(t *testing.T) {
+	table := &AvroSchema{
+		Type: "record",
+		Name: "events",
+		Fields: []AvroType{{Name: "id", Type: INT64.AvroType()}, {Name: "name", Type: STRING.AvroType()},
+			{Name: "score", Type: FLOAT64.AvroType()}, {Name: "timestamp", Type: TIMESTAMP.AvroType()}},
+		DataTypes: map[string]DataType{"id": INT64, "name": STRING, "score": FLOAT64, "timestamp": TIMESTAMP},
+	}
+	generated, err := ProtobufMessageDescriptor(table)
+	require.NoError(t, err)
+	descriptorSet, err := ProtobufDescriptorSet(generated)
+	require.NoError(t, err)
+	userSchema, err := (&ProtobufSchema{DescriptorSet: base64.StdEncoding.EncodeToString(descriptorSet), Message: "bulker.events"}).MessageDescriptor()
+	require.NoError(t, err)
+
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name        string
+		compression FileCompression
+		schema      protoreflect.MessageDescriptor
+	}{
+		{"generated_schema", FileCompressionNONE, nil},
+		{"generated_schema_zstd", FileCompressionZSTD, nil},
+		{"user_schema", FileCompressionNONE, userSchema},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			marshaller, err := NewMarshaller(FileFormatProtobuf, tt.compression)
+			require.NoError(t, err)
+			pm := marshaller.(*ProtobufMarshaller)
+			if tt.schema != nil {
+				pm.UseSchema(tt.schema)
+			}
+			buf := &bytes.Buffer{}
+			require.NoError(t, marshaller.InitSchema(buf, nil, table))
+			require.Equal(t, tt.schema == nil, pm.GeneratedSchema())
+			require.NoError(t, marshaller.Marshal(
+				Object{"id": json.Number("1"), "name": "a", "score": 1.5, "timestamp": ts, "unknown": "skipped"},
+				Object{"id": int64(2), "timestamp": ts.Format(time.RFC3339)}))
+			require.NoError(t, marshaller.Flush())
+
+			var reader io.Reader = buf
+			if tt.compression == FileCompressionZSTD {
+				decoder, err := zstd.NewReader(buf)
+				require.NoError(t, err)
+				reader = decoder
+			}
+			bufReader := bufio.NewReader(reader)
+			fields := pm.Descriptor().Fields()
+			rows := make([]map[string]any, 0)
+			for {
+				message := dynamicpb.NewMessage(pm.Descriptor())
+				if err := protodelim.UnmarshalFrom(bufReader, message); err == io.EOF {
+					break
+				} else {
+					require.NoError(t, err)
+				}
+				row := map[string]any{}
+				for i := 0; i < fields.Len(); i++ {
+					if fd := fields.Get(i); message.Has(fd) {
+						row[string(fd.Name())] = message.Get(fd).Interface()
+					}
+				}
+				rows = append(rows, row)
+			}
+			require.Equal(t, []map[string]any{
+				{"id": int64(1), "name": "a", "score": 1.5, "timestamp": ts.UnixMicro()},
+				{"id": int64(2), "timestamp": ts.UnixMicro()},
+			}, rows)
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	schemaRegistryTimeout     = time.Minute
+	schemaRegistryContentType = "application/vnd.schemaregistry.v1+json"
+
+	// AvroSchemaIdMetadataKey key of Avro container file metadata with Schema Registry ID of the file schema
+	AvroSchemaIdMetadataKey = "schema.registry.id"
+	// AvroSchemaSubjectMetadataKey key of Avro container file metadata with Schema Registry subject of the file schema
+	AvroSchemaSubjectMetadataKey = "schema.registry.subject"
+)
+
+// SchemaRegistryConfig Confluent Schema Registry used for schemas of Avro files
+type SchemaRegistryConfig struct {
+	URL      string `mapstructure:"url,omitempty" json:"url,omitempty" yaml:"url,omitempty"`
+	Username string `mapstructure:"username,omitempty" json:"username,omitempty" yaml:"username,omitempty"`
+	Password string `mapstructure:"password,omitempty" json:"password,omitempty" yaml:"password,omitempty"`
+	// Subject of schemas. Default: <table name>-value
+	Subject string `mapstructure:"subject,omitempty" json:"subject,omitempty" yaml:"subject,omitempty"`
+	// UseLatestVersion files are written with the latest registered schema of subject instead of registering schema inferred from data
+	UseLatestVersion bool `mapstructure:"useLatestVersion,omitempty" json:"useLatestVersion,omitempty" yaml:"useLatestVersion,omitempty"`
+}
+
+// Validate returns err if invalid
+func (c *SchemaRegistryConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.URL == "" {
+		return errors.New("schemaRegistry url is required parameter")
+	}
+	if _, err := url.Parse(c.URL); err != nil {
+		return fmt.Errorf("invalid schemaRegistry url: %v", err)
+	}
+	return nil
+}
+
+// SubjectName returns configured subject or default subject of table
+func (c *SchemaRegistryConfig) SubjectName(tableName string) string {
+	if c.Subject != "" {
+		return c.Subject
+	}
+	return tableName + "-value"
+}
+
+// SchemaRegistryError error response of Schema Registry
+type SchemaRegistryError struct {
+	StatusCode int    `json:"-"`
+	ErrorCode  int    `json:"error_code"`
+	Message    string `json:"message"`
+}
+
+func (e *SchemaRegistryError) Error() string {
+	return fmt.Sprintf("schema registry error %d (%d): %s", e.StatusCode, e.ErrorCode, e.Message)
+}
+
+// SchemaRegistry client of Confluent Schema Registry REST API
+type SchemaRegistry struct {
+	config *SchemaRegistryConfig
+	client *http.Client
+
+	sync.Mutex
+	// registered schema ids by subject and schema
+	registered map[string]int
+}
+
+func NewSchemaRegistry(config *SchemaRegistryConfig) *SchemaRegistry {
+	return &SchemaRegistry{config: config, client: &http.Client{Timeout: schemaRegistryTimeout}, registered: map[string]int{}}
+}
+
+// SubjectName returns subject of schemas of table
+func (sr *SchemaRegistry) SubjectName(tableName string) string {
+	return sr.config.SubjectName(tableName)
+}
+
+// Schema returns schema that Avro file of subject must be written with and its id.
+// Registers provided schema unless UseLatestVersion is set. Then the latest version of subject is returned
+func (sr *SchemaRegistry) Schema(subject, schema string) (id int, registrySchema string, err error) {
+	if sr.config.UseLatestVersion {
+		return sr.Latest(subject)
+	}
+	id, err = sr.Register(subject, schema)
+	return id, schema, err
+}
+
+// Register registers schema under subject and returns its id. Registering the same schema again returns existing id
+func (sr *SchemaRegistry) Register(subject, schema string) (int, error) {
+	key := subject + "\x00" + schema
+	sr.Lock()
+	id, ok := sr.registered[key]
+	sr.Unlock()
+	if ok {
+		return id, nil
+	}
+	result := struct {
+		ID int `json:"id"`
+	}{}
+	if err := sr.do(http.MethodPost, "subjects/"+url.PathEscape(subject)+"/versions", map[string]string{"schema": schema}, &result); err != nil {
+		return 0, fmt.Errorf("failed to register schema of subject %s: %w", subject, err)
+	}
+	sr.Lock()
+	sr.registered[key] = result.ID
+	sr.Unlock()
+	return result.ID, nil
+}
+
+// Latest returns id and schema of the latest version of subject
+func (sr *SchemaRegistry) Latest(subject string) (int, string, error) {
+	result := struct {
+		ID     int    `json:"id"`
+		Schema string `json:"schema"`
+	}{}
+	if err := sr.do(http.MethodGet, "subjects/"+url.PathEscape(subject)+"/versions/latest", nil, &result); err != nil {
+		return 0, "", fmt.Errorf("failed to get latest schema of subject %s: %w", subject, err)
+	}
+	return result.ID, result.Schema, nil
+}
+
+func (sr *SchemaRegistry) do(method, path string, payload any, result any) error {
+	var body []byte
+	if payload != nil {
+		var err error
+		if body, err = json.Marshal(payload); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(sr.config.URL, "/")+"/"+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", schemaRegistryContentType)
+	if payload != nil {
+		req.Header.Set("Content-Type", schemaRegistryContentType)
+	}
+	if sr.config.Username != "" {
+		req.SetBasicAuth(sr.config.Username, sr.config.Password)
+	}
+	resp, err := sr.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		registryErr := &SchemaRegistryError{}
+		if err = json.Unmarshal(respBody, registryErr); err != nil || registryErr.Message == "" {
+			registryErr.Message = strings.TrimSpace(string(respBody))
+		}
+		registryErr.StatusCode = resp.StatusCode
+		return registryErr
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
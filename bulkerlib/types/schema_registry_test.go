@@ -0,0 +1,91 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/hamba/avro/v2/ocf"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const latestSchema = `{"type":"record","name":"events","namespace":"com.example","fields":[{"name":"id","type":["null","long"],"default":null}]}`
+
+func TestAvroMarshallerSchemaRegistry(t *testing.T) {
+	registered := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, _ := r.BasicAuth()
+		require.Equal(t, "user", user)
+		require.Equal(t, "secret", password)
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/subjects/events-value/versions":
+			request := map[string]string{}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+			require.NotEmpty(t, request["schema"])
+			registered++
+			_, _ = w.Write([]byte(`{"id":7}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/subjects/events-value/versions/latest":
+			_ = json.NewEncoder(w).Encode(map[string]any{"id": 3, "version": 2, "schema": latestSchema})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error_code":40401,"message":"Subject not found."}`))
+		}
+	}))
+	defer server.Close()
+
+	schema := &AvroSchema{
+		Type:      "record",
+		Name:      "events",
+		Fields:    []AvroType{{Name: "id", Type: INT64.AvroType()}, {Name: "name", Type: STRING.AvroType()}},
+		DataTypes: map[string]DataType{"id": INT64, "name": STRING},
+	}
+	tests := []struct {
+		name             string
+		useLatestVersion bool
+		subject          string
+		wantId           string
+		wantFields       int
+		wantErr          bool
+	}{
+		{"register", false, "events-value", "7", 2, false},
+		{"latest_version", true, "events-value", "3", 1, false},
+		{"unknown_subject", true, "unknown", "", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := NewSchemaRegistry(&SchemaRegistryConfig{URL: server.URL, Username: "user", Password: "secret", UseLatestVersion: tt.useLatestVersion})
+			marshaller, err := NewMarshaller(FileFormatAVRO, FileCompressionNONE)
+			require.NoError(t, err)
+			marshaller.(*AvroMarshaller).UseSchemaRegistry(registry, tt.subject)
+			buf := &bytes.Buffer{}
+			err = marshaller.InitSchema(buf, nil, schema)
+			if tt.wantErr {
+				var registryErr *SchemaRegistryError
+				require.ErrorAs(t, err, &registryErr)
+				require.Equal(t, 40401, registryErr.ErrorCode)
+				return
+			}
+			require.NoError(t, err)
+			require.NoError(t, marshaller.Marshal(Object{"id": json.Number("1"), "name": "a"}, Object{"id": int64(2)}))
+			require.NoError(t, marshaller.Flush())
+
+			decoder, err := ocf.NewDecoder(buf)
+			require.NoError(t, err)
+			require.Equal(t, tt.wantId, string(decoder.Metadata()[AvroSchemaIdMetadataKey]))
+			require.Equal(t, tt.subject, string(decoder.Metadata()[AvroSchemaSubjectMetadataKey]))
+			ids := make([]any, 0)
+			for decoder.HasNext() {
+				row := map[string]any{}
+				require.NoError(t, decoder.Decode(&row))
+				require.Len(t, row, tt.wantFields)
+				ids = append(ids, row["id"])
+			}
+			require.NoError(t, decoder.Error())
+			// nullable union values are decoded as maps
+			require.Equal(t, []any{map[string]any{"long": int64(1)}, map[string]any{"long": int64(2)}}, ids)
+		})
+	}
+	// schema is registered once per subject
+	require.Equal(t, 1, registered)
+}
@@ -0,0 +1,228 @@
+package types
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	jsoniter "github.com/json-iterator/go"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+const (
+	// xlsxMaxRows max number of rows of worksheet including header row
+	xlsxMaxRows = 1_048_576
+	// xlsxMaxCellLength max number of characters in cell. Longer strings are truncated
+	xlsxMaxCellLength = 32_767
+
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`
+	xlsxRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets></workbook>`
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`
+	xlsxSheetStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+	xlsxSheetEnd = `</sheetData></worksheet>`
+)
+
+// XLSXMarshaller writes objects to the single worksheet of Excel workbook. The first row contains header.
+// Numbers and booleans are written as typed cells, other values as strings. Intended for modest datasets:
+// worksheet is limited to 1,048,576 rows
+type XLSXMarshaller struct {
+	AbstractMarshaller
+	zipWriter *zip.Writer
+	bufWriter *bufio.Writer
+	fields    []string
+	// columns references of columns: A, B, ..., AA, ...
+	columns []string
+	rows    int
+}
+
+func (xm *XLSXMarshaller) Init(writer io.Writer, header []string) error {
+	if xm.zipWriter != nil {
+		return nil
+	}
+	zipWriter := zip.NewWriter(writer)
+	for _, part := range []struct{ name, content string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRels},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+	} {
+		w, err := zipWriter.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err = io.WriteString(w, part.content); err != nil {
+			return err
+		}
+	}
+	// worksheet is the last part of file, so rows are streamed into it
+	sheetWriter, err := zipWriter.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	xm.zipWriter = zipWriter
+	xm.bufWriter = xm.newBufferedWriter(sheetWriter)
+	xm.fields = header
+	xm.columns = make([]string, len(header))
+	for i := range header {
+		xm.columns[i] = xlsxColumnName(i)
+	}
+	if _, err = xm.bufWriter.WriteString(xlsxSheetStart); err != nil {
+		return err
+	}
+	headerRow := make(Object, len(header))
+	for _, field := range header {
+		headerRow[field] = field
+	}
+	return xm.writeRow(headerRow, false)
+}
+
+func (xm *XLSXMarshaller) InitSchema(writer io.Writer, columns []string, table *AvroSchema) error {
+	return xm.Init(writer, columns)
+}
+
+// Marshal writes objects as rows of worksheet
+func (xm *XLSXMarshaller) Marshal(object ...Object) error {
+	if xm.zipWriter == nil {
+		return fmt.Errorf("marshaller wasn't initialized. Run Init() first")
+	}
+	for _, obj := range object {
+		if err := xm.writeRow(obj, true); err != nil {
+			return err
+		}
+		if err := xm.afterMarshal(xm.bufWriter.Flush); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeRow writes values of object fields as cells of the next row. reformat - convert json numbers and time strings to typed values
+func (xm *XLSXMarshaller) writeRow(obj Object, reformat bool) error {
+	if xm.rows >= xlsxMaxRows {
+		return fmt.Errorf("XLSX worksheet can't contain more than %d rows", xlsxMaxRows)
+	}
+	xm.rows++
+	rowNumber := strconv.Itoa(xm.rows)
+	w := xm.bufWriter
+	_, _ = w.WriteString(`<row r="` + rowNumber + `">`)
+	for i, field := range xm.fields {
+		v := obj[field]
+		if reformat {
+			v = ReformatValue(v)
+		}
+		if v == nil {
+			continue
+		}
+		ref := xm.columns[i] + rowNumber
+		if b, ok := v.(bool); ok {
+			value := "0"
+			if b {
+				value = "1"
+			}
+			_, _ = w.WriteString(`<c r="` + ref + `" t="b"><v>` + value + `</v></c>`)
+			continue
+		}
+		if number, ok := xlsxNumber(v); ok {
+			_, _ = w.WriteString(`<c r="` + ref + `"><v>` + number + `</v></c>`)
+			continue
+		}
+		s, err := xlsxString(v)
+		if err != nil {
+			return err
+		}
+		_, _ = w.WriteString(`<c r="` + ref + `" t="inlineStr"><is><t xml:space="preserve">`)
+		if err = xml.EscapeText(w, []byte(s)); err != nil {
+			return err
+		}
+		_, _ = w.WriteString(`</t></is></c>`)
+	}
+	_, err := w.WriteString(`</row>`)
+	return err
+}
+
+func (xm *XLSXMarshaller) Flush() error {
+	if xm.zipWriter == nil {
+		return fmt.Errorf("marshaller wasn't initialized. Run Init() first")
+	}
+	if _, err := xm.bufWriter.WriteString(xlsxSheetEnd); err != nil {
+		return err
+	}
+	if err := xm.bufWriter.Flush(); err != nil {
+		return err
+	}
+	return xm.zipWriter.Close()
+}
+
+func (xm *XLSXMarshaller) NeedHeader() bool {
+	return true
+}
+
+func (xm *XLSXMarshaller) Format() FileFormat {
+	return xm.format
+}
+
+func (xm *XLSXMarshaller) Compression() FileCompression {
+	return FileCompressionNONE
+}
+
+func (xm *XLSXMarshaller) FileExtension() string {
+	return ".xlsx"
+}
+
+// xlsxNumber returns string representation of numeric value of cell. Returns false if value isn't a number
+func xlsxNumber(value any) (string, bool) {
+	rv := reflect.ValueOf(value)
+	switch {
+	case rv.CanInt():
+		return strconv.FormatInt(rv.Int(), 10), true
+	case rv.CanUint():
+		return strconv.FormatUint(rv.Uint(), 10), true
+	case rv.CanFloat():
+		f := rv.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return "", false
+		}
+		return strconv.FormatFloat(f, 'g', -1, 64), true
+	}
+	return "", false
+}
+
+// xlsxString returns string value of cell. Values like arrays and time are marshalled with json marshaller the same way as in CSV files
+func xlsxString(value any) (string, error) {
+	s, ok := value.(string)
+	if !ok {
+		b, err := jsoniter.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		if len(b) >= 2 && b[0] == quotaByteValue && b[len(b)-1] == quotaByteValue {
+			b = b[1 : len(b)-1]
+		}
+		s = string(b)
+	}
+	if len(s) > xlsxMaxCellLength {
+		if runes := []rune(s); len(runes) > xlsxMaxCellLength {
+			s = string(runes[:xlsxMaxCellLength])
+		}
+	}
+	return s, nil
+}
+
+// xlsxColumnName returns reference of column with zero based index: A, B, ..., Z, AA, AB, ...
+func xlsxColumnName(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
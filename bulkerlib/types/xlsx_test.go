@@ -0,0 +1,47 @@
+package types
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"io"
+	"testing"
+)
+
+func TestXLSXMarshaller(t *testing.T) {
+	marshaller, err := NewMarshaller(FileFormatXLSX, FileCompressionGZIP)
+	require.NoError(t, err)
+	require.Equal(t, FileCompressionNONE, marshaller.Compression())
+	require.True(t, marshaller.NeedHeader())
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, marshaller.Init(buf, []string{"id", "name", "active", "tags"}))
+	require.NoError(t, marshaller.Marshal(
+		Object{"id": json.Number("1"), "name": "John <Doe> & co", "active": true, "tags": []any{"a", "b"}},
+		Object{"id": json.Number("2.5"), "active": false},
+	))
+	require.NoError(t, marshaller.Flush())
+
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	parts := map[string]string{}
+	for _, file := range reader.File {
+		r, err := file.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(r)
+		require.NoError(t, err)
+		parts[file.Name] = string(content)
+	}
+	require.Contains(t, parts, "[Content_Types].xml")
+	require.Contains(t, parts, "xl/workbook.xml")
+	require.Equal(t, xlsxSheetStart+
+		`<row r="1"><c r="A1" t="inlineStr"><is><t xml:space="preserve">id</t></is></c><c r="B1" t="inlineStr"><is><t xml:space="preserve">name</t></is></c>`+
+		`<c r="C1" t="inlineStr"><is><t xml:space="preserve">active</t></is></c><c r="D1" t="inlineStr"><is><t xml:space="preserve">tags</t></is></c></row>`+
+		`<row r="2"><c r="A2"><v>1</v></c><c r="B2" t="inlineStr"><is><t xml:space="preserve">John &lt;Doe&gt; &amp; co</t></is></c>`+
+		`<c r="C2" t="b"><v>1</v></c><c r="D2" t="inlineStr"><is><t xml:space="preserve">[&#34;a&#34;,&#34;b&#34;]</t></is></c></row>`+
+		`<row r="3"><c r="A3"><v>2.5</v></c><c r="C3" t="b"><v>0</v></c></row>`+
+		xlsxSheetEnd, parts["xl/worksheets/sheet1.xml"])
+
+	require.Equal(t, []string{"A", "Z", "AA", "AZ", "BA", "XFD"}, []string{xlsxColumnName(0), xlsxColumnName(25), xlsxColumnName(26), xlsxColumnName(51), xlsxColumnName(52), xlsxColumnName(16383)})
+}
@@ -19,7 +19,7 @@ func TestEventsLog(t *testing.T) {
 
 	//1519073278252
 	//1668686118735
-	redisEl, err := NewRedisEventsLog(redis.URL(), "", 1000)
+	redisEl, err := NewRedisEventsLog(redis.URL(), nil, 1000)
 	reqr.NoError(err)
 
 	var tsStart, tsEnd time.Time
@@ -1,12 +1,12 @@
 package eventslog
 
 import (
-	"crypto/tls"
-	"crypto/x509"
 	"fmt"
 	"github.com/gomodule/redigo/redis"
 	"github.com/jitsucom/bulker/jitsubase/appbase"
+	"github.com/jitsucom/bulker/jitsubase/redispool"
 	"github.com/jitsucom/bulker/jitsubase/safego"
+	"github.com/jitsucom/bulker/jitsubase/utils"
 	jsoniter "github.com/json-iterator/go"
 	"regexp"
 	"strings"
@@ -30,10 +30,13 @@ type RedisEventsLog struct {
 	closeChan             chan struct{}
 }
 
-func NewRedisEventsLog(redisUrl, redisTLSCA string, maxLogSize int) (EventsLogService, error) {
+func NewRedisEventsLog(redisUrl string, redisTLS *utils.TLSConfig, maxLogSize int) (EventsLogService, error) {
 	base := appbase.NewServiceBase(redisEventsLogServiceName)
 	base.Debugf("Creating RedisEventsLog with redisURL: %s", redisUrl)
-	redisPool := newPool(redisUrl, redisTLSCA)
+	redisPool, err := redispool.NewRedisPool(redisUrl, redisTLS)
+	if err != nil {
+		return nil, err
+	}
 	r := RedisEventsLog{
 		Service:               base,
 		redisPool:             redisPool,
@@ -208,29 +211,6 @@ func (r *RedisEventsLog) Close() error {
 	return nil
 }
 
-func newPool(redisURL string, ca string) *redis.Pool {
-	opts := make([]redis.DialOption, 0)
-	if ca != "" || strings.HasPrefix(redisURL, "rediss://") {
-		tlsConfig := tls.Config{InsecureSkipVerify: true}
-		if ca != "" {
-			rootCAs, _ := x509.SystemCertPool()
-			if rootCAs == nil {
-				rootCAs = x509.NewCertPool()
-			}
-			rootCAs.AppendCertsFromPEM([]byte(ca))
-			tlsConfig.RootCAs = rootCAs
-		}
-		opts = append(opts, redis.DialUseTLS(true), redis.DialTLSConfig(&tlsConfig))
-	}
-
-	return &redis.Pool{
-		MaxIdle:     3,
-		IdleTimeout: 240 * time.Second,
-		// Dial or DialContext must be set. When both are set, DialContext takes precedence over Dial.
-		Dial: func() (redis.Conn, error) { return redis.DialURL(redisURL, opts...) },
-	}
-}
-
 func RedisError(err error) string {
 	if err == nil {
 		return ""
@@ -14,16 +14,20 @@ import (
 )
 
 type Context struct {
-	config           *Config
-	kafkaConfig      *kafka.ConfigMap
-	repository       appbase.Repository[Streams]
-	scriptRepository appbase.Repository[Script]
-	producer         *kafkabase.Producer
-	eventsLogService eventslog.EventsLogService
-	server           *http.Server
-	metricsServer    *MetricsServer
-	backupsLogger    *BackupLogger
-	consumerMonitor  *ConsumerMonitor
+	config             *Config
+	kafkaConfig        *kafka.ConfigMap
+	repository         appbase.Repository[Streams]
+	scriptRepository   appbase.Repository[Script]
+	producer           *kafkabase.Producer
+	envelope           *kafkabase.EnvelopeNegotiator
+	eventsLogService   eventslog.EventsLogService
+	server             *http.Server
+	metricsServer      *MetricsServer
+	backupsLogger      *BackupLogger
+	sessionStore       *SessionStore
+	keyRotations       *KeyRotationStore
+	contractViolations *ContractViolationsReport
+	consumerMonitor    *ConsumerMonitor
 }
 
 func (a *Context) InitContext(settings *appbase.AppSettings) error {
@@ -42,11 +46,27 @@ func (a *Context) InitContext(settings *appbase.AppSettings) error {
 			return err
 		}
 	} else if a.config.RedisURL != "" {
-		a.eventsLogService, err = eventslog.NewRedisEventsLog(a.config.RedisURL, a.config.RedisTLSCA, a.config.EventsLogMaxSize)
+		a.eventsLogService, err = eventslog.NewRedisEventsLog(a.config.RedisURL, a.config.RedisTLS(), a.config.EventsLogMaxSize)
 		if err != nil {
 			return err
 		}
 	}
+	if a.config.SessionizationEnabled {
+		a.sessionStore, err = NewSessionStore(a.config)
+		if err != nil {
+			return err
+		}
+	}
+	if a.config.KeyRotationEnabled {
+		a.keyRotations, err = NewKeyRotationStore(a.config)
+		if err != nil {
+			return err
+		}
+	}
+	a.contractViolations, err = NewContractViolationsReport(a.config)
+	if err != nil {
+		return err
+	}
 	a.kafkaConfig = a.config.GetKafkaConfig()
 	//batch producer uses higher linger.ms and doesn't suit for sync delivery used by stream consumer when retrying messages
 	producerConfig := kafka.ConfigMap(utils.MapPutAll(kafka.ConfigMap{
@@ -63,10 +83,19 @@ func (a *Context) InitContext(settings *appbase.AppSettings) error {
 		}
 		partitionSelector = a.consumerMonitor
 	}
+	a.envelope, err = kafkabase.NewEnvelopeNegotiator(&a.config.KafkaConfig, a.kafkaConfig, "ingest", a.config.InstanceId, false)
+	if err != nil {
+		return err
+	}
+	err = a.envelope.Start()
+	if err != nil {
+		return err
+	}
 	a.producer, err = kafkabase.NewProducer(&a.config.KafkaConfig, &producerConfig, true, nil)
 	if err != nil {
 		return err
 	}
+	a.producer.SetEnvelopeNegotiator(a.envelope)
 	a.producer.Start()
 
 	a.backupsLogger = NewBackupLogger(a.config)
@@ -84,10 +113,18 @@ func (a *Context) InitContext(settings *appbase.AppSettings) error {
 
 func (a *Context) Cleanup() error {
 	_ = a.producer.Close()
+	_ = a.envelope.Close()
 	if a.consumerMonitor != nil {
 		_ = a.consumerMonitor.Close()
 	}
 	_ = a.backupsLogger.Close()
+	if a.sessionStore != nil {
+		_ = a.sessionStore.Close()
+	}
+	if a.keyRotations != nil {
+		_ = a.keyRotations.Close()
+	}
+	_ = a.contractViolations.Close()
 	if a.config.ShutdownExtraDelay > 0 {
 		logging.Infof("Waiting %d seconds before http server shutdown...", a.config.ShutdownExtraDelay)
 		time.Sleep(time.Duration(a.config.ShutdownExtraDelay) * time.Second)
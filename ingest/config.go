@@ -44,9 +44,27 @@ type Config struct {
 
 	// # EVENTS REDIS LOGGING
 
-	RedisURL         string `mapstructure:"REDIS_URL"`
-	RedisTLSCA       string `mapstructure:"REDIS_TLS_CA"`
-	EventsLogMaxSize int    `mapstructure:"EVENTS_LOG_MAX_SIZE" default:"1000"`
+	RedisURL   string `mapstructure:"REDIS_URL"`
+	RedisTLSCA string `mapstructure:"REDIS_TLS_CA"`
+	// RedisTLSCert and RedisTLSKey client certificate and private key for mutual TLS. PEM content or path to PEM file
+	RedisTLSCert       string `mapstructure:"REDIS_TLS_CERT"`
+	RedisTLSKey        string `mapstructure:"REDIS_TLS_KEY"`
+	RedisTLSServerName string `mapstructure:"REDIS_TLS_SERVER_NAME"`
+	// RedisTLSSkipVerify disables verification of Redis server certificate. Not recommended outside of development
+	RedisTLSSkipVerify bool `mapstructure:"REDIS_TLS_SKIP_VERIFY" default:"false"`
+	EventsLogMaxSize   int  `mapstructure:"EVENTS_LOG_MAX_SIZE" default:"1000"`
+
+	// # SESSIONIZATION - server-side session_id and session_start derived from anonymousId. Requires REDIS_URL
+
+	SessionizationEnabled bool `mapstructure:"SESSIONIZATION_ENABLED" default:"false"`
+	// session ends after this period of inactivity measured by event timestamps
+	SessionTimeoutMin int `mapstructure:"SESSION_TIMEOUT_MIN" default:"30"`
+
+	// # WRITE KEY ROTATION - old key stays valid for grace period after rotation. Requires REDIS_URL
+
+	KeyRotationEnabled bool `mapstructure:"KEY_ROTATION_ENABLED" default:"false"`
+	// default period during which rotated key is still accepted
+	KeyRotationGracePeriodHours int `mapstructure:"KEY_ROTATION_GRACE_PERIOD_HOURS" default:"24"`
 
 	RotorURL                 string `mapstructure:"ROTOR_URL"`
 	RotorAuthKey             string `mapstructure:"ROTOR_AUTH_KEY"`
@@ -76,3 +94,14 @@ func (ac *Config) PostInit(settings *appbase.AppSettings) error {
 	ac.GlobalHashSecrets = strings.Split(ac.GlobalHashSecret, ",")
 	return nil
 }
+
+// RedisTLS returns TLS configuration for Redis connections
+func (ac *Config) RedisTLS() *utils.TLSConfig {
+	return &utils.TLSConfig{
+		CA:                 ac.RedisTLSCA,
+		ClientCert:         ac.RedisTLSCert,
+		ClientKey:          ac.RedisTLSKey,
+		ServerName:         ac.RedisTLSServerName,
+		InsecureSkipVerify: ac.RedisTLSSkipVerify,
+	}
+}
@@ -5,10 +5,12 @@ go 1.22
 require (
 	github.com/confluentinc/confluent-kafka-go/v2 v2.3.0
 	github.com/gin-gonic/gin v1.9.1
+	github.com/gomodule/redigo v1.8.9
 	github.com/mroth/weightedrand/v2 v2.1.0
 	github.com/penglongli/gin-metrics v0.1.10
 	github.com/prometheus/client_golang v1.17.0
 	github.com/spf13/viper v1.17.0
+	github.com/stretchr/testify v1.9.0
 	github.com/vearne/gin-timeout v0.1.7
 	gopkg.in/natefinch/lumberjack.v2 v2.2.1
 )
@@ -51,7 +53,6 @@ require (
 	github.com/spf13/afero v1.10.0 // indirect
 	github.com/spf13/cast v1.5.1 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
-	github.com/stretchr/testify v1.9.0 // indirect
 	github.com/subosito/gotenv v1.6.0 // indirect
 	github.com/testcontainers/testcontainers-go v0.28.0 // indirect
 	github.com/twitchyliquid64/golang-asm v0.15.1 // indirect
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gomodule/redigo/redis"
+	"github.com/jitsucom/bulker/jitsubase/appbase"
+	"github.com/jitsucom/bulker/jitsubase/redispool"
+	"github.com/jitsucom/bulker/jitsubase/safego"
+	"github.com/jitsucom/bulker/jitsubase/uuid"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const keyRotationServiceName = "key_rotation"
+
+// key_rotations hash: newKeyId -> json of KeyRotation
+const keyRotationsKey = "key_rotations"
+
+// key_rotations_old hash: oldKeyId -> newKeyId. Guards against concurrent rotations of the same key
+const keyRotationsOldKey = "key_rotations_old"
+
+const keyRotationsRefreshPeriod = 5 * time.Second
+
+// KeyRotation replaces stream key with a new one. Old key is accepted along with the new one until OldKeyExpiresAt,
+// so clients can be migrated without downtime.
+type KeyRotation struct {
+	StreamId        string    `json:"streamId"`
+	KeyType         string    `json:"keyType"`
+	OldKeyId        string    `json:"oldKeyId"`
+	OldKeyExpiresAt time.Time `json:"oldKeyExpiresAt"`
+	NewKeyId        string    `json:"newKeyId"`
+	NewKeyHash      string    `json:"newKeyHash"`
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+// ErrKeyAlreadyRotated key was already rotated. Each key may be rotated only once: rotate the new key instead
+var ErrKeyAlreadyRotated = errors.New("key was already rotated")
+
+// keyRotationsIndex rotations by old and new key ids.
+// Key may be the new key of one rotation and the old key of the following one
+type keyRotationsIndex struct {
+	byOldKey map[string]*KeyRotation
+	byNewKey map[string]*KeyRotation
+}
+
+// newKeyRotationsIndex indexes rotations. If the same key was rotated more than once, the first rotation wins
+func newKeyRotationsIndex(rotations []*KeyRotation) *keyRotationsIndex {
+	sort.SliceStable(rotations, func(i, j int) bool {
+		return rotations[i].CreatedAt.Before(rotations[j].CreatedAt)
+	})
+	index := &keyRotationsIndex{
+		byOldKey: make(map[string]*KeyRotation, len(rotations)),
+		byNewKey: make(map[string]*KeyRotation, len(rotations)),
+	}
+	for _, rotation := range rotations {
+		if _, ok := index.byOldKey[rotation.OldKeyId]; ok {
+			continue
+		}
+		index.byOldKey[rotation.OldKeyId] = rotation
+		index.byNewKey[rotation.NewKeyId] = rotation
+	}
+	return index
+}
+
+// Binding returns binding for key created by rotation or applies expiration to binding of rotated key
+func (idx *keyRotationsIndex) Binding(keyId string, binding *ApiKeyBinding) *ApiKeyBinding {
+	if rotation, ok := idx.byNewKey[keyId]; ok {
+		binding = &ApiKeyBinding{Hash: rotation.NewKeyHash, KeyType: rotation.KeyType, StreamId: rotation.StreamId}
+	}
+	rotation, ok := idx.byOldKey[keyId]
+	if !ok || binding == nil {
+		return binding
+	}
+	expiresAt := rotation.OldKeyExpiresAt
+	if binding.ExpiresAt != nil && binding.ExpiresAt.Before(expiresAt) {
+		expiresAt = *binding.ExpiresAt
+	}
+	b := *binding
+	b.ExpiresAt = &expiresAt
+	return &b
+}
+
+// KeyRotationStore keeps key rotations in Redis so all ingest instances accept the same keys.
+// Rotations are cached in memory and reloaded periodically.
+type KeyRotationStore struct {
+	appbase.Service
+	redisPool   *redis.Pool
+	gracePeriod time.Duration
+	rotations   atomic.Pointer[keyRotationsIndex]
+	closed      chan struct{}
+}
+
+func NewKeyRotationStore(config *Config) (*KeyRotationStore, error) {
+	base := appbase.NewServiceBase(keyRotationServiceName)
+	if config.RedisURL == "" {
+		return nil, fmt.Errorf("%sREDIS_URL is required for key rotation", config.AppSetting.EnvPrefixWithUnderscore())
+	}
+	if config.KeyRotationGracePeriodHours <= 0 {
+		return nil, fmt.Errorf("%sKEY_ROTATION_GRACE_PERIOD_HOURS must be positive: %d", config.AppSetting.EnvPrefixWithUnderscore(), config.KeyRotationGracePeriodHours)
+	}
+	redisPool, err := redispool.NewRedisPool(config.RedisURL, config.RedisTLS())
+	if err != nil {
+		return nil, err
+	}
+	s := &KeyRotationStore{
+		Service:     base,
+		redisPool:   redisPool,
+		gracePeriod: time.Duration(config.KeyRotationGracePeriodHours) * time.Hour,
+		closed:      make(chan struct{}),
+	}
+	s.rotations.Store(newKeyRotationsIndex(nil))
+	if err := s.refresh(); err != nil {
+		s.Errorf("Failed to load key rotations: %v", err)
+	}
+	s.start()
+	return s, nil
+}
+
+func (s *KeyRotationStore) start() {
+	safego.RunWithRestart(func() {
+		ticker := time.NewTicker(keyRotationsRefreshPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.closed:
+				return
+			case <-ticker.C:
+				if err := s.refresh(); err != nil {
+					s.Errorf("Failed to refresh key rotations: %v", err)
+				}
+			}
+		}
+	})
+}
+
+func (s *KeyRotationStore) refresh() error {
+	conn := s.redisPool.Get()
+	defer conn.Close()
+	values, err := redis.StringMap(conn.Do("HGETALL", keyRotationsKey))
+	if err != nil {
+		return err
+	}
+	rotations := make([]*KeyRotation, 0, len(values))
+	for newKeyId, value := range values {
+		rotation := &KeyRotation{}
+		if err = json.Unmarshal([]byte(value), rotation); err != nil {
+			s.Errorf("Failed to parse key rotation %s: %v", newKeyId, err)
+			continue
+		}
+		rotations = append(rotations, rotation)
+	}
+	s.rotations.Store(newKeyRotationsIndex(rotations))
+	return nil
+}
+
+// Binding returns binding for key created by rotation or applies expiration to binding of rotated key
+func (s *KeyRotationStore) Binding(keyId string, binding *ApiKeyBinding) *ApiKeyBinding {
+	return s.rotations.Load().Binding(keyId, binding)
+}
+
+// Rotate creates new key for the stream bound to the old key. Returns rotation and plaintext of the new key.
+// Returns ErrKeyAlreadyRotated if the old key was already rotated
+func (s *KeyRotationStore) Rotate(oldKeyId string, binding *ApiKeyBinding, gracePeriod time.Duration, hashSecret string) (*KeyRotation, string, error) {
+	if _, ok := s.rotations.Load().byOldKey[oldKeyId]; ok {
+		return nil, "", ErrKeyAlreadyRotated
+	}
+	if gracePeriod <= 0 {
+		gracePeriod = s.gracePeriod
+	}
+	now := time.Now().UTC()
+	newKeyId := uuid.NewLettersNumbers()
+	secret := uuid.NewLettersNumbers()
+	salt := uuid.NewLettersNumbers()
+	rotation := &KeyRotation{
+		StreamId:        binding.StreamId,
+		KeyType:         binding.KeyType,
+		OldKeyId:        oldKeyId,
+		OldKeyExpiresAt: now.Add(gracePeriod),
+		NewKeyId:        newKeyId,
+		NewKeyHash:      salt + "." + hashApiKey(secret, salt, hashSecret),
+		CreatedAt:       now,
+	}
+	value, err := json.Marshal(rotation)
+	if err != nil {
+		return nil, "", err
+	}
+	conn := s.redisPool.Get()
+	defer conn.Close()
+	// the other instance may have rotated the same key after last refresh
+	reserved, err := redis.Bool(conn.Do("HSETNX", keyRotationsOldKey, oldKeyId, newKeyId))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to save key rotation: %v", err)
+	}
+	if !reserved {
+		return nil, "", ErrKeyAlreadyRotated
+	}
+	if _, err = conn.Do("HSET", keyRotationsKey, newKeyId, value); err != nil {
+		_, _ = conn.Do("HDEL", keyRotationsOldKey, oldKeyId)
+		return nil, "", fmt.Errorf("failed to save key rotation: %v", err)
+	}
+	if err = s.refresh(); err != nil {
+		s.Errorf("Failed to refresh key rotations: %v", err)
+	}
+	return rotation, newKeyId + ":" + secret, nil
+}
+
+func (s *KeyRotationStore) Close() error {
+	close(s.closed)
+	return s.redisPool.Close()
+}
+
+// KeyRotationHandler rotates stream key: creates new key and sets expiration of the old key.
+// Plaintext of the new key is returned only once
+func (r *Router) KeyRotationHandler(c *gin.Context) {
+	if r.keyRotations == nil {
+		_ = r.ResponseError(c, http.StatusBadRequest, "key rotation is disabled", false, nil, true)
+		return
+	}
+	keyId := c.Param("keyId")
+	binding := r.repository.GetData().getStreamByKeyId(keyId)
+	if binding == nil {
+		_ = r.ResponseError(c, http.StatusNotFound, "key not found", false, fmt.Errorf("key id: %s", keyId), true)
+		return
+	}
+	var gracePeriod time.Duration
+	if gp := c.Query("gracePeriodHours"); gp != "" {
+		hours, err := strconv.Atoi(gp)
+		if err != nil || hours <= 0 {
+			_ = r.ResponseError(c, http.StatusBadRequest, "invalid gracePeriodHours", false, fmt.Errorf("%s", gp), true)
+			return
+		}
+		gracePeriod = time.Duration(hours) * time.Hour
+	}
+	rotation, writeKey, err := r.keyRotations.Rotate(keyId, binding, gracePeriod, r.config.GlobalHashSecrets[0])
+	if errors.Is(err, ErrKeyAlreadyRotated) {
+		_ = r.ResponseError(c, http.StatusConflict, "key was already rotated", false, fmt.Errorf("key id: %s", keyId), true)
+		return
+	} else if err != nil {
+		_ = r.ResponseError(c, http.StatusInternalServerError, "key rotation error", false, err, true)
+		return
+	}
+	r.Infof("Key %s of stream %s rotated. New key: %s. Old key expires at: %s", keyId, rotation.StreamId, rotation.NewKeyId, rotation.OldKeyExpiresAt)
+	c.JSON(http.StatusOK, gin.H{"ok": true, "writeKey": writeKey, "rotation": rotation})
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestKeyRotationsIndex(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	original := &ApiKeyBinding{Hash: "hashA", KeyType: "browser", StreamId: "stream1"}
+	first := &KeyRotation{StreamId: "stream1", KeyType: "browser", OldKeyId: "A", OldKeyExpiresAt: now.Add(time.Hour),
+		NewKeyId: "B", NewKeyHash: "hashB", CreatedAt: now}
+	// the second rotation of the same key during its grace period
+	second := &KeyRotation{StreamId: "stream1", KeyType: "browser", OldKeyId: "A", OldKeyExpiresAt: now.Add(2 * time.Hour),
+		NewKeyId: "C", NewKeyHash: "hashC", CreatedAt: now.Add(time.Minute)}
+	// rotation of the new key
+	chained := &KeyRotation{StreamId: "stream1", KeyType: "browser", OldKeyId: "B", OldKeyExpiresAt: now.Add(3 * time.Hour),
+		NewKeyId: "D", NewKeyHash: "hashD", CreatedAt: now.Add(2 * time.Minute)}
+
+	for _, order := range [][]*KeyRotation{{first, second, chained}, {chained, second, first}, {second, chained, first}} {
+		index := newKeyRotationsIndex(order)
+
+		a := index.Binding("A", original)
+		require.Equal(t, "hashA", a.Hash)
+		require.Equal(t, now.Add(time.Hour), *a.ExpiresAt, "the first rotation of key wins regardless of order")
+
+		require.Nil(t, index.Binding("C", nil), "key of rejected rotation must not be accepted")
+
+		b := index.Binding("B", nil)
+		require.Equal(t, "hashB", b.Hash)
+		require.Equal(t, "stream1", b.StreamId)
+		require.Equal(t, now.Add(3*time.Hour), *b.ExpiresAt, "rotated new key expires after grace period of its rotation")
+
+		d := index.Binding("D", nil)
+		require.Equal(t, "hashD", d.Hash)
+		require.Nil(t, d.ExpiresAt)
+
+		require.Same(t, original, index.Binding("E", original))
+	}
+}
+
+func TestKeyRotationsIndexKeepsEarlierExpiration(t *testing.T) {
+	now := time.Now().UTC()
+	expiresAt := now.Add(time.Minute)
+	original := &ApiKeyBinding{Hash: "hashA", StreamId: "stream1", ExpiresAt: &expiresAt}
+	index := newKeyRotationsIndex([]*KeyRotation{{OldKeyId: "A", OldKeyExpiresAt: now.Add(time.Hour), NewKeyId: "B", CreatedAt: now}})
+	require.Equal(t, expiresAt, *index.Binding("A", original).ExpiresAt)
+}
@@ -36,6 +36,26 @@ var (
 		return deviceFunctions.WithLabelValues(destinationId, status)
 	}
 
+	validationFunctions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "bulkerapp",
+		Subsystem: "ingest",
+		Name:      "validation_functions",
+		Help:      "Stream validation function results by stream Id",
+	}, []string{"streamId", "status"})
+	ValidationFunctions = func(streamId, status string) prometheus.Counter {
+		return validationFunctions.WithLabelValues(streamId, status)
+	}
+
+	schemaContractViolations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "bulkerapp",
+		Subsystem: "ingest",
+		Name:      "schema_contract_violations",
+		Help:      "Events violating stream schema contract by stream Id and action",
+	}, []string{"streamId", "action"})
+	SchemaContractViolations = func(streamId, action string) prometheus.Counter {
+		return schemaContractViolations.WithLabelValues(streamId, action)
+	}
+
 	repositoryErrors = promauto.NewCounter(prometheus.CounterOpts{
 		Namespace: "ingest",
 		Subsystem: "repository",
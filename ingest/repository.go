@@ -77,16 +77,18 @@ func (s *StreamsRepositoryData) Init(reader io.Reader, tag any) error {
 		}
 		for _, key := range swd.Stream.PublicKeys {
 			apiKeyBindings[key.Id] = &ApiKeyBinding{
-				Hash:     key.Hash,
-				KeyType:  "browser",
-				StreamId: swd.Stream.Id,
+				Hash:      key.Hash,
+				KeyType:   "browser",
+				StreamId:  swd.Stream.Id,
+				ExpiresAt: key.ExpiresAt,
 			}
 		}
 		for _, key := range swd.Stream.PrivateKeys {
 			apiKeyBindings[key.Id] = &ApiKeyBinding{
-				Hash:     key.Hash,
-				KeyType:  "s2s",
-				StreamId: swd.Stream.Id,
+				Hash:      key.Hash,
+				KeyType:   "s2s",
+				StreamId:  swd.Stream.Id,
+				ExpiresAt: key.ExpiresAt,
 			}
 		}
 	}
@@ -141,12 +143,19 @@ type ApiKey struct {
 	Plaintext string `json:"plaintext"`
 	Hash      string `json:"hash"`
 	Hint      string `json:"hint"`
+	// ExpiresAt key is rejected after this time. Used to keep old key valid for a while after rotation
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
 }
 
 type ApiKeyBinding struct {
-	Hash     string `json:"hash"`
-	KeyType  string `json:"keyType"`
-	StreamId string `json:"streamId"`
+	Hash      string     `json:"hash"`
+	KeyType   string     `json:"keyType"`
+	StreamId  string     `json:"streamId"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+func (b *ApiKeyBinding) Expired(now time.Time) bool {
+	return b.ExpiresAt != nil && now.After(*b.ExpiresAt)
 }
 
 type StreamConfig struct {
@@ -158,6 +167,12 @@ type StreamConfig struct {
 	AuthorizedJavaScriptDomains string   `json:"authorizedJavaScriptDomains"`
 	PublicKeys                  []ApiKey `json:"publicKeys"`
 	PrivateKeys                 []ApiKey `json:"privateKeys"`
+	// SchemaContract optional restriction of fields accepted by the stream
+	SchemaContract *SchemaContract `json:"schemaContract,omitempty"`
+	// ValidationFunction optional function that may reject or enrich events before they are produced to Kafka
+	ValidationFunction *ValidationFunction `json:"validationFunction,omitempty"`
+	// ClientSettings optional settings for browser SDK: consent, cookie policy, custom endpoints
+	ClientSettings *ClientSettings `json:"clientSettings,omitempty"`
 }
 
 type ShortDestinationConfig struct {
@@ -186,6 +201,9 @@ type StreamWithDestinations struct {
 func (s *StreamWithDestinations) init() {
 	s.SynchronousDestinations = make([]*ShortDestinationConfig, 0)
 	s.AsynchronousDestinations = make([]*ShortDestinationConfig, 0)
+	if s.Stream.SchemaContract != nil {
+		s.Stream.SchemaContract.init()
+	}
 	for _, d := range s.Destinations {
 		if d.Id == "" || d.DestinationType == "" {
 			continue
@@ -42,16 +42,19 @@ var messageIdUnsupportedChars = regexp.MustCompile(`[^a-zA-Z0-9._-]`)
 
 type Router struct {
 	*appbase.Router
-	config            *Config
-	kafkaConfig       *kafka.ConfigMap
-	repository        appbase.Repository[Streams]
-	scriptRepository  appbase.Repository[Script]
-	producer          *kafkabase.Producer
-	eventsLogService  eventslog.EventsLogService
-	backupsLogger     *BackupLogger
-	httpClient        *http.Client
-	dataHosts         []string
-	partitionSelector kafkabase.PartitionSelector
+	config             *Config
+	kafkaConfig        *kafka.ConfigMap
+	repository         appbase.Repository[Streams]
+	scriptRepository   appbase.Repository[Script]
+	producer           *kafkabase.Producer
+	eventsLogService   eventslog.EventsLogService
+	backupsLogger      *BackupLogger
+	sessionStore       *SessionStore
+	keyRotations       *KeyRotationStore
+	contractViolations *ContractViolationsReport
+	httpClient         *http.Client
+	dataHosts          []string
+	partitionSelector  kafkabase.PartitionSelector
 }
 
 type IngestType string
@@ -85,6 +88,7 @@ func NewRouter(appContext *Context, partitionSelector kafkabase.PartitionSelecto
 		"/b",
 		"/batch",
 		"/api/s/s2s/batch",
+		"/api/s/settings",
 		"/api/s/:tp",
 		"/api/s/s2s/:tp",
 	})
@@ -107,17 +111,20 @@ func NewRouter(appContext *Context, partitionSelector kafkabase.PartitionSelecto
 	base.Infof("Data hosts: %s", dataHosts)
 
 	router := &Router{
-		Router:            base,
-		config:            appContext.config,
-		kafkaConfig:       appContext.kafkaConfig,
-		producer:          appContext.producer,
-		eventsLogService:  appContext.eventsLogService,
-		backupsLogger:     appContext.backupsLogger,
-		repository:        appContext.repository,
-		scriptRepository:  appContext.scriptRepository,
-		httpClient:        httpClient,
-		dataHosts:         dataHosts,
-		partitionSelector: partitionSelector,
+		Router:             base,
+		config:             appContext.config,
+		kafkaConfig:        appContext.kafkaConfig,
+		producer:           appContext.producer,
+		eventsLogService:   appContext.eventsLogService,
+		backupsLogger:      appContext.backupsLogger,
+		sessionStore:       appContext.sessionStore,
+		keyRotations:       appContext.keyRotations,
+		contractViolations: appContext.contractViolations,
+		repository:         appContext.repository,
+		scriptRepository:   appContext.scriptRepository,
+		httpClient:         httpClient,
+		dataHosts:          dataHosts,
+		partitionSelector:  partitionSelector,
 	}
 	engine := router.Engine()
 	// get global Monitor object
@@ -138,11 +145,15 @@ func NewRouter(appContext *Context, partitionSelector kafkabase.PartitionSelecto
 	fast.Match([]string{"OPTIONS", "POST"}, "/b", router.BatchHandler)
 	fast.Match([]string{"OPTIONS", "POST"}, "/api/s/s2s/batch", router.BatchHandler)
 
+	fast.Match([]string{"GET", "OPTIONS"}, "/api/s/settings", router.SDKSettingsHandler)
 	fast.Match([]string{"OPTIONS", "POST"}, "/api/s/:tp", router.IngestHandler)
 	fast.Match([]string{"OPTIONS", "POST"}, "/api/s/s2s/:tp", router.IngestHandler)
 
 	fast.Match([]string{"GET", "HEAD", "OPTIONS"}, "/p.js", router.ScriptHandler)
 
+	engine.GET("/schema-contracts/violations", router.ContractViolationsHandler)
+	engine.POST("/keys/:keyId/rotate", router.KeyRotationHandler)
+
 	engine.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"status": "pass"})
 	})
@@ -389,7 +400,36 @@ func (r *Router) processSyncDestination(message *IngestMessage, stream *StreamWi
 }
 
 func (r *Router) buildIngestMessage(c *gin.Context, messageId string, event *AnalyticsServerEvent, analyticContext map[string]any, tp string, loc StreamCredentials, stream *StreamWithDestinations) (ingestMessage *IngestMessage, ingestMessageBytes []byte, err error) {
-	err = patchEvent(c, messageId, event, tp, loc.IngestType, analyticContext)
+	err = r.prepareEvent(c, messageId, event, analyticContext, tp, loc, stream)
+	if err == nil {
+		r.stampSessions(stream, []*AnalyticsServerEvent{event})
+	}
+	ingestMessage = r.newIngestMessage(c, messageId, event, tp, loc, stream)
+	errs := []error{err}
+	r.applyValidationFunction(stream, []*IngestMessage{ingestMessage}, errs)
+	ingestMessageBytes, err = r.marshalIngestMessage(ingestMessage, errs[0])
+	return ingestMessage, ingestMessageBytes, err
+}
+
+// prepareEvent applies schema contract of the stream and patches event with server side properties
+func (r *Router) prepareEvent(c *gin.Context, messageId string, event *AnalyticsServerEvent, analyticContext map[string]any, tp string, loc StreamCredentials, stream *StreamWithDestinations) error {
+	contractErr := r.applySchemaContract(messageId, event, stream)
+	return utils.Nvl(contractErr, patchEvent(c, messageId, event, tp, loc.IngestType, analyticContext))
+}
+
+// stampSessions sets session properties on prepared events with a single Redis round-trip
+func (r *Router) stampSessions(stream *StreamWithDestinations, events []*AnalyticsServerEvent) {
+	if r.sessionStore == nil || len(events) == 0 {
+		return
+	}
+	if err := r.sessionStore.StampBatch(stream.Stream.Id, events); err != nil {
+		//sessionization is best effort. don't lose events because of it
+		r.Errorf("Failed to stamp sessions for %d events of stream %s: %v", len(events), stream.Stream.Id, err)
+	}
+}
+
+// newIngestMessage builds ingest message for prepared event
+func (r *Router) newIngestMessage(c *gin.Context, messageId string, event *AnalyticsServerEvent, tp string, loc StreamCredentials, stream *StreamWithDestinations) *IngestMessage {
 	headers := utils.MapMap(utils.MapFilter(c.Request.Header, func(k string, v []string) bool {
 		return len(v) > 0 && !isInternalHeader(k)
 	}), func(k string, v []string) string {
@@ -399,7 +439,7 @@ func (r *Router) buildIngestMessage(c *gin.Context, messageId string, event *Ana
 		return strings.Join(v, ",")
 	})
 	bodyType, _ := (*event)["type"].(string)
-	ingestMessage = &IngestMessage{
+	return &IngestMessage{
 		IngestType:     loc.IngestType,
 		MessageCreated: time.Now(),
 		MessageId:      messageId,
@@ -414,6 +454,11 @@ func (r *Router) buildIngestMessage(c *gin.Context, messageId string, event *Ana
 		HttpHeaders: headers,
 		HttpPayload: event,
 	}
+}
+
+// marshalIngestMessage serializes ingest message. err is an error of event processing if any.
+// Message is serialized even if err is not nil so it can be logged
+func (r *Router) marshalIngestMessage(ingestMessage *IngestMessage, err error) ([]byte, error) {
 	ingestMessageBytes, err1 := json.Marshal(ingestMessage)
 	if err1 != nil {
 		err = utils.Nvl(err, err1)
@@ -422,7 +467,7 @@ func (r *Router) buildIngestMessage(c *gin.Context, messageId string, event *Ana
 			err = fmt.Errorf("message size is too big. max allowed: %d", len(ingestMessageBytes)/2)
 		}
 	}
-	return
+	return ingestMessageBytes, err
 }
 
 func hashApiKey(token string, salt string, secret string) string {
@@ -489,9 +534,14 @@ func (r *Router) WriteKeyStreamLocator(loc *StreamCredentials) *StreamWithDestin
 			return r.repository.GetData().GetStreamById(loc.WriteKey)
 		} else {
 			binding := r.repository.GetData().getStreamByKeyId(parts[0])
+			if r.keyRotations != nil {
+				binding = r.keyRotations.Binding(parts[0], binding)
+			}
 			if binding != nil {
 				if loc.IngestType != IngestTypeWriteKeyDefined && binding.KeyType != string(loc.IngestType) {
 					r.Errorf("invalid key type: found %s, expected %s", binding.KeyType, loc.IngestType)
+				} else if binding.Expired(time.Now()) {
+					r.Errorf("key %s expired at %s", parts[0], binding.ExpiresAt)
 				} else if !r.checkHash(binding.Hash, parts[1]) {
 					r.Errorf("invalid key secret")
 				} else {
@@ -14,6 +14,20 @@ import (
 	"strings"
 )
 
+// BatchResultsHeader request header that opts in for 207 and 422 statuses of batch response
+const BatchResultsHeader = "X-Jitsu-Batch-Results"
+
+// BatchEventResult status of a single event of batch submission.
+// Results are returned in the same order as events in the batch
+type BatchEventResult struct {
+	MessageId string `json:"messageId"`
+	// Status http-like status code of event: 200 - accepted, 400 - invalid event, 404 - no destinations, 422 - rejected by validation, 500 - internal error
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Retryable true if the same event may succeed on retry
+	Retryable bool `json:"retryable,omitempty"`
+}
+
 func (r *Router) BatchHandler(c *gin.Context) {
 	var rError *appbase.RouterError
 	var payload BatchPayload
@@ -66,54 +80,135 @@ func (r *Router) BatchHandler(c *gin.Context) {
 		return
 	}
 	eventsLogId := stream.Stream.Id
-	okEvents := 0
 	errors := make([]string, 0)
-	for _, event := range payload.Batch {
-		messageId, _ := event["messageId"].(string)
+	results := make([]BatchEventResult, 0, len(payload.Batch))
+	messageIds := make([]string, len(payload.Batch))
+	prepareErrors := make([]error, len(payload.Batch))
+	preparedEvents := make([]*AnalyticsServerEvent, 0, len(payload.Batch))
+	for i := range payload.Batch {
+		event := &payload.Batch[i]
+		messageId, _ := (*event)["messageId"].(string)
 		if messageId == "" {
 			messageId = uuid.New()
 		} else {
 			messageId = utils.ShortenString(messageIdUnsupportedChars.ReplaceAllString(messageId, "_"), 64)
 		}
+		messageIds[i] = messageId
+		prepareErrors[i] = r.prepareEvent(c, messageId, event, payload.Context, "event", loc, stream)
+		if prepareErrors[i] == nil {
+			preparedEvents = append(preparedEvents, event)
+		}
+	}
+	r.stampSessions(stream, preparedEvents)
+	ingestMessages := make([]*IngestMessage, len(payload.Batch))
+	for i := range payload.Batch {
+		ingestMessages[i] = r.newIngestMessage(c, messageIds[i], &payload.Batch[i], "event", loc, stream)
+	}
+	// events of the batch are validated concurrently
+	r.applyValidationFunction(stream, ingestMessages, prepareErrors)
+	for i := range payload.Batch {
+		messageId := messageIds[i]
 		c.Set(appbase.ContextMessageId, messageId)
-		_, ingestMessageBytes, err1 := r.buildIngestMessage(c, messageId, &event, payload.Context, "event", loc, stream)
+		ingestMessageBytes, err1 := r.marshalIngestMessage(ingestMessages[i], prepareErrors[i])
 		var asyncDestinations, tagsDestinations []string
+		// error of the event. rError is reserved for errors of the whole request
+		var eError *appbase.RouterError
 		if err1 == nil {
 			if len(stream.AsynchronousDestinations) == 0 {
-				rError = r.ResponseError(c, http.StatusOK, ErrNoDst, false, fmt.Errorf(stream.Stream.Id), false)
+				eError = r.ResponseError(c, http.StatusOK, ErrNoDst, false, fmt.Errorf(stream.Stream.Id), false)
 			} else {
-				asyncDestinations, tagsDestinations, rError = r.sendToBulker(c, ingestMessageBytes, stream, false)
+				asyncDestinations, tagsDestinations, eError = r.sendToBulker(c, ingestMessageBytes, stream, false)
 			}
+		} else if isValidationRejected(err1) {
+			eError = r.ResponseError(c, http.StatusOK, ErrValidationRejected, false, err1, false)
 		} else {
-			rError = r.ResponseError(c, http.StatusOK, "event error", false, err1, false)
+			eError = r.ResponseError(c, http.StatusOK, "event error", false, err1, false)
 		}
 		if len(ingestMessageBytes) >= 0 {
 			_ = r.backupsLogger.Log(utils.DefaultString(eventsLogId, "UNKNOWN"), ingestMessageBytes)
 		}
-		if rError != nil && rError.ErrorType != ErrNoDst {
-			obj := map[string]any{"body": string(ingestMessageBytes), "error": rError.PublicError.Error(), "status": "FAILED"}
+		if eError != nil && eError.ErrorType != ErrNoDst {
+			obj := map[string]any{"body": string(ingestMessageBytes), "error": eError.PublicError.Error(), "status": "FAILED"}
 			r.eventsLogService.PostAsync(&eventslog.ActorEvent{EventType: eventslog.EventTypeIncoming, Level: eventslog.LevelError, ActorId: eventsLogId, Event: obj})
-			IngestHandlerRequests(domain, "error", rError.ErrorType).Inc()
-			_ = r.producer.ProduceAsync(r.config.KafkaDestinationsDeadLetterTopicName, uuid.New(), ingestMessageBytes, map[string]string{"error": rError.Error.Error()}, kafka2.PartitionAny)
-			errors = append(errors, fmt.Sprintf("Message ID: %s: %v", messageId, rError.PublicError))
+			IngestHandlerRequests(domain, "error", eError.ErrorType).Inc()
+			_ = r.producer.ProduceAsync(r.config.KafkaDestinationsDeadLetterTopicName, uuid.New(), ingestMessageBytes, deadLetterHeaders(eError), kafka2.PartitionAny)
+			errors = append(errors, fmt.Sprintf("Message ID: %s: %v", messageId, eError.PublicError))
+			results = append(results, batchEventError(messageId, eError))
 		} else {
 			obj := map[string]any{"body": string(ingestMessageBytes), "asyncDestinations": asyncDestinations, "tags": tagsDestinations}
 			if len(asyncDestinations) > 0 || len(tagsDestinations) > 0 {
-				okEvents++
 				obj["status"] = "SUCCESS"
+				results = append(results, BatchEventResult{MessageId: messageId, Status: http.StatusOK})
 			} else {
 				obj["status"] = "SKIPPED"
 				obj["error"] = "no destinations found for stream"
-				errors = append(errors, fmt.Sprintf("Message ID: %s: %v", messageId, rError.PublicError))
+				if eError == nil {
+					// all destinations were filtered out
+					eError = r.ResponseError(c, http.StatusOK, ErrNoDst, false, fmt.Errorf(stream.Stream.Id), false)
+				}
+				errors = append(errors, fmt.Sprintf("Message ID: %s: %v", messageId, eError.PublicError))
+				results = append(results, batchEventError(messageId, eError))
 			}
 			r.eventsLogService.PostAsync(&eventslog.ActorEvent{EventType: eventslog.EventTypeIncoming, Level: eventslog.LevelInfo, ActorId: eventsLogId, Event: obj})
 			IngestHandlerRequests(domain, "success", "").Inc()
 		}
 	}
-	batchSize := len(payload.Batch)
-	if batchSize == okEvents {
-		c.JSON(http.StatusOK, gin.H{"ok": true, "receivedEvents": batchSize, "okEvents": okEvents})
-	} else {
-		c.JSON(http.StatusOK, gin.H{"ok": false, "errors": errors, "receivedEvents": batchSize, "okEvents": okEvents})
+	detailed := c.Query("results") == "true" || c.GetHeader(BatchResultsHeader) == "true"
+	writeBatchResponse(c, detailed, errors, results)
+}
+
+// writeBatchResponse responds with per-event results.
+// Status is 200 unless client opted in for detailed statuses with 'results=true' query parameter or BatchResultsHeader:
+// then it is 422 if all events were rejected by validation function and 207 if some events failed.
+// Events skipped because stream has no destinations are not failures
+func writeBatchResponse(c *gin.Context, detailed bool, errors []string, results []BatchEventResult) {
+	okEvents, failedEvents, rejectedEvents := 0, 0, 0
+	for _, result := range results {
+		switch result.Status {
+		case http.StatusOK:
+			okEvents++
+		case http.StatusNotFound:
+		case http.StatusUnprocessableEntity:
+			rejectedEvents++
+			failedEvents++
+		default:
+			failedEvents++
+		}
+	}
+	status := http.StatusOK
+	if detailed && failedEvents > 0 {
+		if failedEvents == len(results) && rejectedEvents == failedEvents {
+			status = http.StatusUnprocessableEntity
+		} else {
+			// partial failure: per-event statuses let clients retry only failed events
+			status = http.StatusMultiStatus
+		}
+	}
+	body := gin.H{"ok": failedEvents == 0, "receivedEvents": len(results), "okEvents": okEvents}
+	if len(errors) > 0 {
+		body["errors"] = errors
+	}
+	if detailed {
+		body["results"] = results
+	}
+	c.JSON(status, body)
+}
+
+func batchEventError(messageId string, rError *appbase.RouterError) BatchEventResult {
+	if rError == nil {
+		return BatchEventResult{MessageId: messageId, Status: http.StatusNotFound, Error: ErrNoDst}
+	}
+	res := BatchEventResult{MessageId: messageId, Error: rError.PublicError.Error()}
+	switch rError.ErrorType {
+	case ErrValidationRejected:
+		res.Status = http.StatusUnprocessableEntity
+	case ErrNoDst:
+		res.Status = http.StatusNotFound
+	case "event error":
+		res.Status = http.StatusBadRequest
+	default:
+		res.Status = http.StatusInternalServerError
+		res.Retryable = true
 	}
+	return res
 }
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/jitsucom/bulker/jitsubase/appbase"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteBatchResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	accepted := BatchEventResult{MessageId: "1", Status: http.StatusOK}
+	rejected := batchEventError("2", &appbase.RouterError{ErrorType: ErrValidationRejected, PublicError: errors.New("missing userId")})
+	internal := batchEventError("3", &appbase.RouterError{ErrorType: "producer error", PublicError: errors.New("kafka is down")})
+	noDst := batchEventError("4", nil)
+	tests := []struct {
+		name       string
+		detailed   bool
+		results    []BatchEventResult
+		wantStatus int
+		wantOK     bool
+		wantOKs    int
+	}{
+		{"all_accepted", true, []BatchEventResult{accepted, accepted}, http.StatusOK, true, 2},
+		{"empty_batch", true, []BatchEventResult{}, http.StatusOK, true, 0},
+		{"no_destinations", true, []BatchEventResult{accepted, noDst}, http.StatusOK, true, 1},
+		{"partial_failure", true, []BatchEventResult{accepted, rejected, internal}, http.StatusMultiStatus, false, 1},
+		{"all_failed", true, []BatchEventResult{rejected, internal}, http.StatusMultiStatus, false, 0},
+		{"all_rejected", true, []BatchEventResult{rejected, rejected}, http.StatusUnprocessableEntity, false, 0},
+		{"partial_failure_not_detailed", false, []BatchEventResult{accepted, rejected, internal}, http.StatusOK, false, 1},
+		{"all_rejected_not_detailed", false, []BatchEventResult{rejected}, http.StatusOK, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			writeBatchResponse(c, tt.detailed, nil, tt.results)
+			require.Equal(t, tt.wantStatus, w.Code)
+			var body struct {
+				OK             bool               `json:"ok"`
+				ReceivedEvents int                `json:"receivedEvents"`
+				OKEvents       int                `json:"okEvents"`
+				Results        []BatchEventResult `json:"results"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+			require.Equal(t, tt.wantOK, body.OK)
+			require.Equal(t, len(tt.results), body.ReceivedEvents)
+			require.Equal(t, tt.wantOKs, body.OKEvents)
+			if tt.detailed {
+				require.Equal(t, tt.results, body.Results)
+			} else {
+				require.Nil(t, body.Results)
+			}
+		})
+	}
+}
+
+func TestBatchHandler(t *testing.T) {
+	router := newTestRouter(t, &Config{}, `[
+{"stream": {"id": "stream1"}, "destinations": [{"id": "d1", "connectionId": "c1", "destinationType": "postgres"}]},
+{"stream": {"id": "nodst"}}
+]`)
+	valid := `{"type": "track", "event": "signup", "messageId": "valid", "properties": {"plan": "pro"}}`
+	invalid := `{"type": "track", "messageId": "invalid"}`
+	tests := []struct {
+		name         string
+		writeKey     string
+		events       string
+		query        string
+		headers      []string
+		wantStatus   int
+		wantStatuses []int
+	}{
+		{"accepted", "stream1", valid, "", nil, http.StatusOK, []int{}},
+		{"no_destinations", "nodst", valid, "?results=true", nil, http.StatusOK, []int{http.StatusNotFound}},
+		{"partial_failure", "stream1", valid + "," + invalid, "", []string{BatchResultsHeader, "true"}, http.StatusMultiStatus,
+			[]int{http.StatusOK, http.StatusBadRequest}},
+		{"partial_failure_not_detailed", "stream1", valid + "," + invalid, "", nil, http.StatusOK, []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := router.request("POST", "/api/s/s2s/batch"+tt.query, tt.writeKey, `{"batch": [`+tt.events+`]}`, tt.headers...)
+			require.Equal(t, tt.wantStatus, w.Code, w.Body.String())
+			var body struct {
+				Results []BatchEventResult `json:"results"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+			require.Equal(t, tt.wantStatuses, utils.ArrayMap(body.Results, func(r BatchEventResult) int { return r.Status }))
+		})
+	}
+}
+
+func TestBatchEventError(t *testing.T) {
+	require.Equal(t, BatchEventResult{MessageId: "1", Status: http.StatusNotFound, Error: ErrNoDst}, batchEventError("1", nil))
+	require.Equal(t, BatchEventResult{MessageId: "2", Status: http.StatusUnprocessableEntity, Error: "missing userId"},
+		batchEventError("2", &appbase.RouterError{ErrorType: ErrValidationRejected, PublicError: errors.New("missing userId")}))
+	require.Equal(t, BatchEventResult{MessageId: "3", Status: http.StatusBadRequest, Error: "invalid json"},
+		batchEventError("3", &appbase.RouterError{ErrorType: "event error", PublicError: errors.New("invalid json")}))
+	require.Equal(t, BatchEventResult{MessageId: "4", Status: http.StatusInternalServerError, Error: "kafka is down", Retryable: true},
+		batchEventError("4", &appbase.RouterError{ErrorType: "producer error", PublicError: errors.New("kafka is down")}))
+}
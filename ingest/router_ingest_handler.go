@@ -37,7 +37,7 @@ func (r *Router) IngestHandler(c *gin.Context) {
 			obj := map[string]any{"body": string(ingestMessageBytes), "error": rError.PublicError.Error(), "status": "FAILED"}
 			r.eventsLogService.PostAsync(&eventslog.ActorEvent{EventType: eventslog.EventTypeIncoming, Level: eventslog.LevelError, ActorId: eventsLogId, Event: obj})
 			IngestHandlerRequests(domain, "error", rError.ErrorType).Inc()
-			_ = r.producer.ProduceAsync(r.config.KafkaDestinationsDeadLetterTopicName, uuid.New(), ingestMessageBytes, map[string]string{"error": rError.Error.Error()}, kafka2.PartitionAny)
+			_ = r.producer.ProduceAsync(r.config.KafkaDestinationsDeadLetterTopicName, uuid.New(), ingestMessageBytes, deadLetterHeaders(rError), kafka2.PartitionAny)
 		} else {
 			obj := map[string]any{"body": string(ingestMessageBytes), "asyncDestinations": asyncDestinations, "tags": tagsDestinations}
 			if len(asyncDestinations) > 0 || len(tagsDestinations) > 0 {
@@ -101,7 +101,10 @@ func (r *Router) IngestHandler(c *gin.Context) {
 	}
 	eventsLogId = stream.Stream.Id
 	ingestMessage, ingestMessageBytes, err := r.buildIngestMessage(c, messageId, &message, nil, tp, loc, stream)
-	if err != nil {
+	if isValidationRejected(err) {
+		rError = r.ResponseError(c, http.StatusUnprocessableEntity, ErrValidationRejected, false, err, true)
+		return
+	} else if err != nil {
 		rError = r.ResponseError(c, http.StatusOK, "event error", false, err, true)
 		return
 	}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/jitsucom/bulker/jitsubase/appbase"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"net/http"
+)
+
+// ClientSettings stream settings that browser SDK applies on bootstrap
+type ClientSettings struct {
+	// ConsentRequired SDK must not send events until user gives consent
+	ConsentRequired bool `json:"consentRequired,omitempty"`
+	// ConsentCategories consent categories SDK asks user for. E.g. analytics, marketing
+	ConsentCategories []string `json:"consentCategories,omitempty"`
+	// CookiePolicy how SDK uses cookies: keep (default), strict - no cookies, comply - cookies only after consent
+	CookiePolicy string `json:"cookiePolicy,omitempty"`
+	// CookieDomain domain for SDK cookies. Default: top level domain of the page
+	CookieDomain string `json:"cookieDomain,omitempty"`
+	// CustomEndpoints custom endpoints that SDK should use instead of default ones by endpoint name. E.g. ingest, script
+	CustomEndpoints map[string]string `json:"customEndpoints,omitempty"`
+}
+
+type SDKDestinationSettings struct {
+	Id              string         `json:"id"`
+	ConnectionId    string         `json:"connectionId"`
+	DestinationType string         `json:"destinationType"`
+	Options         map[string]any `json:"options,omitempty"`
+	Credentials     map[string]any `json:"credentials,omitempty"`
+	DeviceOptions   any            `json:"deviceOptions,omitempty"`
+}
+
+type SDKSettings struct {
+	StreamId string `json:"streamId"`
+	ClientSettings
+	// Destinations device destinations enabled for the stream
+	Destinations []SDKDestinationSettings `json:"destinations"`
+}
+
+// SDKSettingsHandler returns settings of the stream for browser SDK so it can bootstrap with a single request
+func (r *Router) SDKSettingsHandler(c *gin.Context) {
+	var rError *appbase.RouterError
+	domain := "SETTINGS"
+	defer func() {
+		if rError != nil {
+			IngestHandlerRequests(domain, "error", rError.ErrorType).Inc()
+		}
+	}()
+	c.Set(appbase.ContextLoggerName, "settings")
+	loc, err := r.getDataLocator(c, IngestTypeBrowser, func() string { return c.Query("writeKey") })
+	if err != nil {
+		rError = r.ResponseError(c, http.StatusBadRequest, "error processing request", false, err, true)
+		return
+	}
+	domain = utils.DefaultString(loc.Slug, loc.Domain)
+	c.Set(appbase.ContextDomain, domain)
+	stream := r.getStream(&loc)
+	if stream == nil {
+		rError = r.ResponseError(c, http.StatusNotFound, "stream not found", false, fmt.Errorf("for: %+v", loc), true)
+		return
+	}
+	settings := SDKSettings{StreamId: stream.Stream.Id, Destinations: make([]SDKDestinationSettings, 0, len(stream.SynchronousDestinations))}
+	if stream.Stream.ClientSettings != nil {
+		settings.ClientSettings = *stream.Stream.ClientSettings
+	}
+	for _, d := range stream.SynchronousDestinations {
+		settings.Destinations = append(settings.Destinations, SDKDestinationSettings{
+			Id:              d.Id,
+			ConnectionId:    d.ConnectionId,
+			DestinationType: d.DestinationType,
+			Options:         d.Options,
+			Credentials:     d.Credentials,
+			DeviceOptions:   DeviceOptions[d.DestinationType],
+		})
+	}
+	c.Header("Cache-Control", "public, max-age=60")
+	c.JSON(http.StatusOK, settings)
+}
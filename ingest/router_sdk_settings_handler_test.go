@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+func TestSDKSettingsHandler(t *testing.T) {
+	router := newTestRouter(t, &Config{}, `[
+{"stream": {"id": "web", "clientSettings": {"consentRequired": true, "consentCategories": ["analytics"], "cookiePolicy": "comply", "customEndpoints": {"ingest": "https://t.example.com"}}},
+ "destinations": [{"id": "d1", "connectionId": "c1", "destinationType": "logrocket", "options": {"appId": "app1"}}, {"id": "d2", "connectionId": "c2", "destinationType": "postgres"}]},
+{"stream": {"id": "plain"}, "destinations": []}
+]`)
+
+	w := router.request("GET", "/api/s/settings?writeKey=web", "", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "public, max-age=60", w.Header().Get("Cache-Control"))
+	var settings SDKSettings
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &settings))
+	require.Equal(t, SDKSettings{
+		StreamId: "web",
+		ClientSettings: ClientSettings{
+			ConsentRequired:   true,
+			ConsentCategories: []string{"analytics"},
+			CookiePolicy:      "comply",
+			CustomEndpoints:   map[string]string{"ingest": "https://t.example.com"},
+		},
+		//only device destinations are returned
+		Destinations: []SDKDestinationSettings{{Id: "d1", ConnectionId: "c1", DestinationType: "logrocket", Options: map[string]any{"appId": "app1"},
+			DeviceOptions: map[string]any{"type": "internal-plugin", "name": "logrocket"}}},
+	}, settings)
+
+	//stream without client settings, write key in header
+	w = router.request("GET", "/api/s/settings", "plain", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"streamId": "plain", "destinations": []}`, w.Body.String())
+
+	w = router.request("GET", "/api/s/settings?writeKey=unknown", "", "")
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/jitsucom/bulker/eventslog"
+	"github.com/jitsucom/bulker/jitsubase/appbase"
+	"github.com/jitsucom/bulker/kafkabase"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testDestinationsTopic = "destination-messages"
+	testDeadLetterTopic   = "destination-messages-dead-letter"
+)
+
+// testStreamsRepository serves fixed streams
+type testStreamsRepository struct {
+	streams *Streams
+}
+
+func (r *testStreamsRepository) GetData() *Streams {
+	return r.streams
+}
+
+func (r *testStreamsRepository) ChangesChannel() <-chan bool {
+	return nil
+}
+
+func (r *testStreamsRepository) Close() error {
+	return nil
+}
+
+// testRouter router of ingest handlers with producer connected to mock Kafka cluster
+type testRouter struct {
+	*Router
+	cluster *kafka.MockCluster
+}
+
+// newTestRouter creates router serving streams from streamsJson (the same format as streams repository)
+func newTestRouter(t *testing.T, config *Config, streamsJson string) *testRouter {
+	cluster, err := kafka.NewMockCluster(1)
+	require.NoError(t, err)
+	t.Cleanup(cluster.Close)
+	for _, topic := range []string{testDestinationsTopic, testDeadLetterTopic} {
+		require.NoError(t, cluster.CreateTopic(topic, 1, 1))
+	}
+	config.KafkaDestinationsTopicName = testDestinationsTopic
+	config.KafkaDestinationsDeadLetterTopicName = testDeadLetterTopic
+	config.MaxIngestPayloadSize = 1_000_000
+	producer, err := kafkabase.NewProducer(&config.KafkaConfig, &kafka.ConfigMap{"bootstrap.servers": cluster.BootstrapServers()}, false, nil)
+	require.NoError(t, err)
+	producer.Start()
+	t.Cleanup(func() { _ = producer.Close() })
+
+	contractViolations, err := NewContractViolationsReport(config)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = contractViolations.Close() })
+
+	streamsData := &StreamsRepositoryData{}
+	require.NoError(t, streamsData.Init(strings.NewReader(streamsJson), nil))
+
+	router := &Router{
+		Router:             appbase.NewRouterBase(config.Config, nil),
+		config:             config,
+		repository:         &testStreamsRepository{streams: streamsData.GetData()},
+		producer:           producer,
+		eventsLogService:   &eventslog.DummyEventsLogService{},
+		backupsLogger:      NewBackupLogger(config),
+		contractViolations: contractViolations,
+		httpClient:         &http.Client{Timeout: time.Duration(config.DeviceFunctionsTimeoutMs) * time.Millisecond},
+		partitionSelector:  &kafkabase.DummyPartitionSelector{},
+	}
+	engine := router.Engine()
+	engine.POST("/api/s/:tp", router.IngestHandler)
+	engine.POST("/api/s/s2s/:tp", router.IngestHandler)
+	engine.POST("/api/s/s2s/batch", router.BatchHandler)
+	engine.GET("/api/s/settings", router.SDKSettingsHandler)
+	engine.GET("/schema-contracts/violations", router.ContractViolationsHandler)
+	return &testRouter{Router: router, cluster: cluster}
+}
+
+// request sends request to the router and returns recorded response
+func (r *testRouter) request(method, path, writeKey, body string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Write-Key", writeKey)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	r.Engine().ServeHTTP(w, req)
+	return w
+}
+
+// readMessages reads count messages from topic
+func (r *testRouter) readMessages(t *testing.T, topic string, count int) []*kafka.Message {
+	consumer, err := kafka.NewConsumer(&kafka.ConfigMap{
+		"bootstrap.servers": r.cluster.BootstrapServers(),
+		"group.id":          topic,
+	})
+	require.NoError(t, err)
+	defer consumer.Close()
+	require.NoError(t, consumer.Assign([]kafka.TopicPartition{{Topic: &topic, Partition: 0, Offset: kafka.OffsetBeginning}}))
+	messages := make([]*kafka.Message, 0, count)
+	for len(messages) < count {
+		message, err := consumer.ReadMessage(10 * time.Second)
+		require.NoError(t, err)
+		messages = append(messages, message)
+	}
+	return messages
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gomodule/redigo/redis"
+	"github.com/jitsucom/bulker/jitsubase/appbase"
+	"github.com/jitsucom/bulker/jitsubase/redispool"
+	"github.com/jitsucom/bulker/jitsubase/safego"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type SchemaContractAction string
+
+const (
+	// SchemaContractActionStrip removes violating fields from event and ingests the rest
+	SchemaContractActionStrip SchemaContractAction = "strip"
+	// SchemaContractActionReject sends the whole event to the dead letter topic
+	SchemaContractActionReject SchemaContractAction = "reject"
+)
+
+// contractReservedFields are always allowed by allowlist contracts since they are required for event processing
+var contractReservedFields = utils.NewSet("type", "event", "messageId", "timestamp", "sentAt", "anonymousId", "userId", "groupId", "previousId", "writeKey")
+
+// SchemaContract restricts fields that producers may send to the stream.
+// Fields are addressed by dot separated paths, e.g. 'properties.price'. Rule for a path covers all nested fields.
+// When AllowedFields is not empty only listed fields (and reserved ones) are accepted.
+// DeniedFields are never accepted.
+type SchemaContract struct {
+	AllowedFields []string             `json:"allowedFields,omitempty"`
+	DeniedFields  []string             `json:"deniedFields,omitempty"`
+	Action        SchemaContractAction `json:"action,omitempty"`
+
+	allowed utils.Set[string]
+	denied  utils.Set[string]
+	// allowedParents contains all intermediate paths of allowed fields: we need to descend into them
+	allowedParents utils.Set[string]
+}
+
+func (sc *SchemaContract) init() {
+	sc.allowed = utils.NewSet(sc.AllowedFields...)
+	sc.denied = utils.NewSet(sc.DeniedFields...)
+	sc.allowedParents = utils.NewSet[string]()
+	for _, f := range sc.AllowedFields {
+		parts := strings.Split(f, ".")
+		for i := 1; i < len(parts); i++ {
+			sc.allowedParents.Put(strings.Join(parts[:i], "."))
+		}
+	}
+	if sc.Action == "" {
+		sc.Action = SchemaContractActionStrip
+	}
+}
+
+// Apply checks event against contract. Violating fields are removed from event when action is 'strip'.
+// Returns list of violating field paths and error if event must be rejected
+func (sc *SchemaContract) Apply(event *AnalyticsServerEvent) (violations []string, err error) {
+	violations = sc.check("", *event, violations)
+	if len(violations) > 0 && sc.Action == SchemaContractActionReject {
+		return violations, fmt.Errorf("schema contract violation. Fields not allowed: %s", strings.Join(violations, ", "))
+	}
+	return violations, nil
+}
+
+func (sc *SchemaContract) check(prefix string, obj map[string]any, violations []string) []string {
+	for key, value := range obj {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		if sc.denied.Contains(path) {
+			violations = append(violations, path)
+			sc.strip(obj, key)
+			continue
+		}
+		if len(sc.allowed) == 0 || sc.allowed.Contains(path) || (prefix == "" && contractReservedFields.Contains(path)) {
+			if len(sc.denied) > 0 {
+				// still need to look for denied nested fields
+				if nested, ok := value.(map[string]any); ok {
+					violations = sc.checkDenied(path, nested, violations)
+				}
+			}
+			continue
+		}
+		if sc.allowedParents.Contains(path) {
+			if nested, ok := value.(map[string]any); ok {
+				violations = sc.check(path, nested, violations)
+				continue
+			}
+		}
+		violations = append(violations, path)
+		sc.strip(obj, key)
+	}
+	return violations
+}
+
+func (sc *SchemaContract) checkDenied(prefix string, obj map[string]any, violations []string) []string {
+	for key, value := range obj {
+		path := prefix + "." + key
+		if sc.denied.Contains(path) {
+			violations = append(violations, path)
+			sc.strip(obj, key)
+		} else if nested, ok := value.(map[string]any); ok {
+			violations = sc.checkDenied(path, nested, violations)
+		}
+	}
+	return violations
+}
+
+func (sc *SchemaContract) strip(obj map[string]any, key string) {
+	if sc.Action == SchemaContractActionStrip {
+		delete(obj, key)
+	}
+}
+
+const contractViolationsServiceName = "contract_violations"
+
+// schema_contract_violations:<streamId>:count hash: field -> number of violations
+// schema_contract_violations:<streamId>:rejected hash: field -> number of rejected events
+// schema_contract_violations:<streamId>:last hash: field -> json of last violation {lastMessageId, lastSeen}
+const contractViolationsKey = "schema_contract_violations:%s:%s"
+
+// schema_contract_violations_streams set: ids of streams with violations
+const contractViolationsStreamsKey = "schema_contract_violations_streams"
+
+const contractViolationsFlushPeriod = 5 * time.Second
+
+type FieldViolation struct {
+	Field         string    `json:"field"`
+	Count         int64     `json:"count"`
+	Rejected      int64     `json:"rejected"`
+	LastMessageId string    `json:"lastMessageId"`
+	LastSeen      time.Time `json:"lastSeen"`
+}
+
+func (fv *FieldViolation) merge(other *FieldViolation) {
+	fv.Count += other.Count
+	fv.Rejected += other.Rejected
+	if other.LastSeen.After(fv.LastSeen) {
+		fv.LastMessageId = other.LastMessageId
+		fv.LastSeen = other.LastSeen
+	}
+}
+
+// ContractViolationsReport aggregates schema contract violations by stream and field.
+// When REDIS_URL is configured violations are accumulated in memory and periodically added to counters in Redis,
+// so the report is shared by all ingest instances and survives restarts.
+// Otherwise, report contains violations seen by the current instance since its start.
+type ContractViolationsReport struct {
+	appbase.Service
+	sync.Mutex
+	redisPool *redis.Pool
+	// streams violations not yet flushed to Redis (or all violations if Redis is not configured)
+	streams map[string]map[string]*FieldViolation
+	closed  chan struct{}
+}
+
+func NewContractViolationsReport(config *Config) (*ContractViolationsReport, error) {
+	r := &ContractViolationsReport{
+		Service: appbase.NewServiceBase(contractViolationsServiceName),
+		streams: map[string]map[string]*FieldViolation{},
+		closed:  make(chan struct{}),
+	}
+	if config.RedisURL == "" {
+		return r, nil
+	}
+	var err error
+	r.redisPool, err = redispool.NewRedisPool(config.RedisURL, config.RedisTLS())
+	if err != nil {
+		return nil, err
+	}
+	r.start()
+	return r, nil
+}
+
+func (r *ContractViolationsReport) start() {
+	safego.RunWithRestart(func() {
+		ticker := time.NewTicker(contractViolationsFlushPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.closed:
+				return
+			case <-ticker.C:
+				if err := r.flush(); err != nil {
+					r.Errorf("Failed to flush schema contract violations: %v", err)
+				}
+			}
+		}
+	})
+}
+
+func (r *ContractViolationsReport) Add(streamId, messageId string, action SchemaContractAction, fields []string) {
+	r.Lock()
+	defer r.Unlock()
+	now := time.Now().UTC()
+	for _, field := range fields {
+		fv := &FieldViolation{Field: field, Count: 1, LastMessageId: messageId, LastSeen: now}
+		if action == SchemaContractActionReject {
+			fv.Rejected = 1
+		}
+		r.add(r.streams, streamId, fv)
+	}
+	SchemaContractViolations(streamId, string(action)).Inc()
+}
+
+func (r *ContractViolationsReport) add(streams map[string]map[string]*FieldViolation, streamId string, fv *FieldViolation) {
+	stream, ok := streams[streamId]
+	if !ok {
+		stream = map[string]*FieldViolation{}
+		streams[streamId] = stream
+	}
+	existing, ok := stream[fv.Field]
+	if !ok {
+		existing = &FieldViolation{Field: fv.Field}
+		stream[fv.Field] = existing
+	}
+	existing.merge(fv)
+}
+
+// flush adds accumulated violations to counters in Redis. Violations are kept in memory if Redis is unavailable
+func (r *ContractViolationsReport) flush() error {
+	r.Lock()
+	pending := r.streams
+	r.streams = map[string]map[string]*FieldViolation{}
+	r.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+	err := r.write(pending)
+	if err != nil {
+		r.Lock()
+		for streamId, stream := range pending {
+			for _, fv := range stream {
+				r.add(r.streams, streamId, fv)
+			}
+		}
+		r.Unlock()
+	}
+	return err
+}
+
+func (r *ContractViolationsReport) write(pending map[string]map[string]*FieldViolation) error {
+	conn := r.redisPool.Get()
+	defer conn.Close()
+	_ = conn.Send("MULTI")
+	for streamId, stream := range pending {
+		_ = conn.Send("SADD", contractViolationsStreamsKey, streamId)
+		for field, fv := range stream {
+			_ = conn.Send("HINCRBY", fmt.Sprintf(contractViolationsKey, streamId, "count"), field, fv.Count)
+			if fv.Rejected > 0 {
+				_ = conn.Send("HINCRBY", fmt.Sprintf(contractViolationsKey, streamId, "rejected"), field, fv.Rejected)
+			}
+			last, _ := json.Marshal(FieldViolation{LastMessageId: fv.LastMessageId, LastSeen: fv.LastSeen})
+			_ = conn.Send("HSET", fmt.Sprintf(contractViolationsKey, streamId, "last"), field, last)
+		}
+	}
+	_, err := conn.Do("EXEC")
+	return err
+}
+
+// read returns violations of streams stored in Redis. If streamId is empty - violations for all streams are returned
+func (r *ContractViolationsReport) read(streamId string) (map[string]map[string]*FieldViolation, error) {
+	conn := r.redisPool.Get()
+	defer conn.Close()
+	var streamIds []string
+	if streamId != "" {
+		streamIds = []string{streamId}
+	} else {
+		var err error
+		streamIds, err = redis.Strings(conn.Do("SMEMBERS", contractViolationsStreamsKey))
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, id := range streamIds {
+		_ = conn.Send("HGETALL", fmt.Sprintf(contractViolationsKey, id, "count"))
+		_ = conn.Send("HGETALL", fmt.Sprintf(contractViolationsKey, id, "rejected"))
+		_ = conn.Send("HGETALL", fmt.Sprintf(contractViolationsKey, id, "last"))
+	}
+	if err := conn.Flush(); err != nil {
+		return nil, err
+	}
+	res := map[string]map[string]*FieldViolation{}
+	var firstErr error
+	for _, id := range streamIds {
+		counts, err1 := redis.Int64Map(conn.Receive())
+		rejected, err2 := redis.Int64Map(conn.Receive())
+		lasts, err3 := redis.StringMap(conn.Receive())
+		if err := utils.Nvl(err1, err2, err3); err != nil {
+			firstErr = utils.Nvl(firstErr, err)
+			continue
+		}
+		for field, count := range counts {
+			fv := &FieldViolation{Field: field, Count: count, Rejected: rejected[field]}
+			last := FieldViolation{}
+			if err := json.Unmarshal([]byte(lasts[field]), &last); err == nil {
+				fv.LastMessageId, fv.LastSeen = last.LastMessageId, last.LastSeen
+			}
+			r.add(res, id, fv)
+		}
+	}
+	return res, firstErr
+}
+
+// Get returns violations for stream sorted by count. If streamId is empty - violations for all streams are returned
+func (r *ContractViolationsReport) Get(streamId string) (map[string][]FieldViolation, error) {
+	streams := map[string]map[string]*FieldViolation{}
+	if r.redisPool != nil {
+		var err error
+		streams, err = r.read(streamId)
+		if err != nil {
+			return nil, err
+		}
+	}
+	r.Lock()
+	for id, stream := range r.streams {
+		if streamId != "" && id != streamId {
+			continue
+		}
+		for _, fv := range stream {
+			r.add(streams, id, fv)
+		}
+	}
+	r.Unlock()
+	res := map[string][]FieldViolation{}
+	for id, stream := range streams {
+		fields := make([]FieldViolation, 0, len(stream))
+		for _, fv := range stream {
+			fields = append(fields, *fv)
+		}
+		sort.Slice(fields, func(i, j int) bool {
+			return fields[i].Count > fields[j].Count
+		})
+		res[id] = fields
+	}
+	return res, nil
+}
+
+func (r *ContractViolationsReport) Close() error {
+	if r.redisPool == nil {
+		return nil
+	}
+	close(r.closed)
+	if err := r.flush(); err != nil {
+		r.Errorf("Failed to flush schema contract violations: %v", err)
+	}
+	return r.redisPool.Close()
+}
+
+func (r *Router) applySchemaContract(messageId string, event *AnalyticsServerEvent, stream *StreamWithDestinations) error {
+	contract := stream.Stream.SchemaContract
+	if contract == nil {
+		return nil
+	}
+	violations, err := contract.Apply(event)
+	if len(violations) > 0 {
+		r.contractViolations.Add(stream.Stream.Id, messageId, contract.Action, violations)
+	}
+	return err
+}
+
+func (r *Router) ContractViolationsHandler(c *gin.Context) {
+	violations, err := r.contractViolations.Get(c.Query("streamId"))
+	if err != nil {
+		_ = r.ResponseError(c, http.StatusInternalServerError, "failed to load schema contract violations", false, err, true)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "violations": violations})
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/jitsucom/bulker/eventslog/testcontainers"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+func TestSchemaContractApply(t *testing.T) {
+	event := func() AnalyticsServerEvent {
+		return AnalyticsServerEvent{
+			"type":        "track",
+			"event":       "purchase",
+			"anonymousId": "anon1",
+			"properties":  map[string]any{"price": 10, "currency": "USD", "card": map[string]any{"number": "4242", "brand": "visa"}},
+			"context":     map[string]any{"ip": "127.0.0.1", "traits": map[string]any{"email": "john@example.com"}},
+		}
+	}
+	tests := []struct {
+		name           string
+		contract       SchemaContract
+		wantViolations []string
+		wantErr        bool
+		wantEvent      func(e AnalyticsServerEvent)
+	}{
+		{name: "empty_contract", contract: SchemaContract{}},
+		{name: "allowed_nested_paths", contract: SchemaContract{AllowedFields: []string{"properties.price", "properties.card.brand", "context"}},
+			wantViolations: []string{"properties.currency", "properties.card.number"},
+			wantEvent: func(e AnalyticsServerEvent) {
+				e["properties"] = map[string]any{"price": 10, "card": map[string]any{"brand": "visa"}}
+			}},
+		{name: "denied_nested_paths", contract: SchemaContract{DeniedFields: []string{"properties.card.number", "context.traits.email"}},
+			wantViolations: []string{"properties.card.number", "context.traits.email"},
+			wantEvent: func(e AnalyticsServerEvent) {
+				delete(e["properties"].(map[string]any)["card"].(map[string]any), "number")
+				delete(e["context"].(map[string]any)["traits"].(map[string]any), "email")
+			}},
+		{name: "denied_within_allowed", contract: SchemaContract{AllowedFields: []string{"properties", "context"}, DeniedFields: []string{"properties.card"}},
+			wantViolations: []string{"properties.card"},
+			wantEvent: func(e AnalyticsServerEvent) {
+				delete(e["properties"].(map[string]any), "card")
+			}},
+		{name: "reject_keeps_event", contract: SchemaContract{AllowedFields: []string{"properties"}, Action: SchemaContractActionReject},
+			wantViolations: []string{"context"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.contract.init()
+			e := event()
+			violations, err := tt.contract.Apply(&e)
+			require.ElementsMatch(t, tt.wantViolations, violations)
+			if tt.wantErr {
+				require.ErrorContains(t, err, "schema contract violation")
+			} else {
+				require.NoError(t, err)
+			}
+			expected := event()
+			if tt.wantEvent != nil {
+				tt.wantEvent(expected)
+			}
+			require.Equal(t, expected, e)
+		})
+	}
+}
+
+func TestContractViolationsReport(t *testing.T) {
+	reqr := require.New(t)
+	report, err := NewContractViolationsReport(&Config{})
+	reqr.NoError(err)
+	defer report.Close()
+
+	report.Add("stream1", "m1", SchemaContractActionStrip, []string{"properties.a", "properties.b"})
+	report.Add("stream1", "m2", SchemaContractActionReject, []string{"properties.b"})
+	report.Add("stream2", "m3", SchemaContractActionStrip, []string{"properties.c"})
+
+	violations, err := report.Get("stream1")
+	reqr.NoError(err)
+	reqr.Len(violations, 1)
+	fields := violations["stream1"]
+	reqr.Len(fields, 2)
+	//sorted by count
+	reqr.Equal("properties.b", fields[0].Field)
+	reqr.Equal(int64(2), fields[0].Count)
+	reqr.Equal(int64(1), fields[0].Rejected)
+	reqr.Equal("m2", fields[0].LastMessageId)
+	reqr.Equal("properties.a", fields[1].Field)
+	reqr.Equal(int64(0), fields[1].Rejected)
+
+	violations, err = report.Get("")
+	reqr.NoError(err)
+	reqr.Len(violations, 2)
+}
+
+func TestContractViolationsReportRedis(t *testing.T) {
+	t.Parallel()
+	reqr := require.New(t)
+
+	redis, err := testcontainers.NewRedisContainer(context.Background())
+	reqr.NoError(err)
+	defer redis.Close()
+
+	// two ingest instances share the report
+	config := &Config{RedisURL: redis.URL()}
+	first, err := NewContractViolationsReport(config)
+	reqr.NoError(err)
+	defer first.Close()
+	second, err := NewContractViolationsReport(config)
+	reqr.NoError(err)
+	defer second.Close()
+
+	first.Add("stream1", "m1", SchemaContractActionStrip, []string{"properties.a"})
+	second.Add("stream1", "m2", SchemaContractActionReject, []string{"properties.a", "properties.b"})
+	reqr.NoError(first.flush())
+
+	//flushed violations of one instance are merged with not yet flushed of another
+	violations, err := second.Get("stream1")
+	reqr.NoError(err)
+	reqr.Equal(int64(2), violations["stream1"][0].Count)
+	reqr.Equal(int64(1), violations["stream1"][0].Rejected)
+	reqr.Equal("m2", violations["stream1"][0].LastMessageId)
+
+	//periodic flush
+	reqr.Eventually(func() bool {
+		violations, err := first.read("")
+		return err == nil && len(violations["stream1"]) == 2 && violations["stream1"]["properties.a"].Count == 2
+	}, 3*contractViolationsFlushPeriod, contractViolationsFlushPeriod/5)
+	second.Lock()
+	reqr.Empty(second.streams)
+	second.Unlock()
+}
+
+func TestContractViolationsHandler(t *testing.T) {
+	router := newTestRouter(t, &Config{}, `[
+{"stream": {"id": "stream1", "schemaContract": {"allowedFields": ["properties.price"]}}, "destinations": [{"id": "d1", "connectionId": "c1", "destinationType": "postgres"}]},
+{"stream": {"id": "stream2", "schemaContract": {"deniedFields": ["properties.email"], "action": "reject"}}, "destinations": [{"id": "d1", "connectionId": "c2", "destinationType": "postgres"}]}
+]`)
+	w := router.request("POST", "/api/s/s2s/track", "stream1", `{"event": "purchase", "messageId": "m1", "properties": {"price": 1, "currency": "USD"}}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	w = router.request("POST", "/api/s/s2s/track", "stream2", `{"event": "signup", "messageId": "m2", "properties": {"email": "john@example.com"}}`)
+	require.Contains(t, w.Body.String(), "schema contract violation")
+
+	w = router.request("GET", "/schema-contracts/violations?streamId=stream2", "", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var body struct {
+		OK         bool                        `json:"ok"`
+		Violations map[string][]FieldViolation `json:"violations"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.True(t, body.OK)
+	require.Len(t, body.Violations, 1)
+	require.Len(t, body.Violations["stream2"], 1)
+	require.Equal(t, FieldViolation{Field: "properties.email", Count: 1, Rejected: 1, LastMessageId: "m2", LastSeen: body.Violations["stream2"][0].LastSeen},
+		body.Violations["stream2"][0])
+
+	w = router.request("GET", "/schema-contracts/violations", "", "")
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Equal(t, []string{"properties.currency"}, []string{body.Violations["stream1"][0].Field})
+}
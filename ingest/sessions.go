@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gomodule/redigo/redis"
+	"github.com/jitsucom/bulker/jitsubase/appbase"
+	"github.com/jitsucom/bulker/jitsubase/redispool"
+	"github.com/jitsucom/bulker/jitsubase/timestamp"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"time"
+)
+
+const sessionStoreServiceName = "session_store"
+
+// sessions:<streamId>:<anonymousId> -> hash {id, start, last}. start and last are event times in unix ms
+const sessionKey = "sessions:%s:%s"
+
+const (
+	SessionIdProperty    = "session_id"
+	SessionStartProperty = "session_start"
+)
+
+// SessionStore derives server-side session ids for incoming events.
+// Session is identified by stream id and anonymousId and lasts until no events were received for inactivity timeout.
+// Session state is kept in Redis so all ingest instances share the same sessions.
+type SessionStore struct {
+	appbase.Service
+	redisPool *redis.Pool
+	timeout   time.Duration
+}
+
+func NewSessionStore(config *Config) (*SessionStore, error) {
+	base := appbase.NewServiceBase(sessionStoreServiceName)
+	if config.RedisURL == "" {
+		return nil, fmt.Errorf("%sREDIS_URL is required for sessionization", config.AppSetting.EnvPrefixWithUnderscore())
+	}
+	if config.SessionTimeoutMin <= 0 {
+		return nil, fmt.Errorf("%sSESSION_TIMEOUT_MIN must be positive: %d", config.AppSetting.EnvPrefixWithUnderscore(), config.SessionTimeoutMin)
+	}
+	redisPool, err := redispool.NewRedisPool(config.RedisURL, config.RedisTLS())
+	if err != nil {
+		return nil, err
+	}
+	base.Infof("Sessionization enabled. Inactivity timeout: %d min", config.SessionTimeoutMin)
+	return &SessionStore{
+		Service:   base,
+		redisPool: redisPool,
+		timeout:   time.Duration(config.SessionTimeoutMin) * time.Minute,
+	}, nil
+}
+
+// StampBatch sets session_id and session_start properties on all events of the batch.
+// Events without anonymousId are left untouched.
+// Session of each event is resolved by the event timestamp, so late or replayed events land in the session they belong to.
+// Requests for all events are pipelined to Redis in a single round-trip.
+func (s *SessionStore) StampBatch(streamId string, events []*AnalyticsServerEvent) error {
+	type pendingStamp struct {
+		event       *AnalyticsServerEvent
+		anonymousId string
+		eventTime   time.Time
+	}
+	pending := make([]pendingStamp, 0, len(events))
+	conn := s.redisPool.Get()
+	defer conn.Close()
+	for _, event := range events {
+		anonymousId := event.GetS("anonymousId")
+		if anonymousId == "" {
+			continue
+		}
+		eventTime := sessionEventTime(event)
+		key := fmt.Sprintf(sessionKey, streamId, anonymousId)
+		if err := sessionScript.Send(conn, key, eventTime.UnixMilli(), s.timeout.Milliseconds(), newSessionId(anonymousId, eventTime)); err != nil {
+			return fmt.Errorf("failed to update session: %v", err)
+		}
+		pending = append(pending, pendingStamp{event: event, anonymousId: anonymousId, eventTime: eventTime})
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	if err := conn.Flush(); err != nil {
+		return fmt.Errorf("failed to update session: %v", err)
+	}
+	var firstErr error
+	for _, p := range pending {
+		// all replies must be read even if some of them are errors
+		sessionId, sessionStart, err := parseSessionReply(conn.Receive())
+		if err != nil {
+			firstErr = utils.Nvl(firstErr, err)
+			continue
+		}
+		if sessionId == "" {
+			// late event from one of the previous sessions. Current session is not affected
+			sessionId, sessionStart = newSessionId(p.anonymousId, p.eventTime), p.eventTime.UnixMilli()
+		}
+		(*p.event)[SessionIdProperty] = sessionId
+		(*p.event)[SessionStartProperty] = time.UnixMilli(sessionStart).UTC().Format(timestamp.JsonISO)
+	}
+	return firstErr
+}
+
+// sessionScript returns current session for event time or starts a new one.
+// Event belongs to the current session if it is not further than inactivity timeout from session bounds.
+// Events older than session start by more than timeout don't change the current session: empty id is returned for them.
+// KEYS[1] - session key, ARGV[1] - event time (unix ms), ARGV[2] - inactivity timeout (ms), ARGV[3] - id for a new session
+var sessionScript = redis.NewScript(1, `
+local t = tonumber(ARGV[1])
+local timeout = tonumber(ARGV[2])
+local s = redis.call('HMGET', KEYS[1], 'id', 'start', 'last')
+local start = tonumber(s[2])
+local last = tonumber(s[3])
+if s[1] and start and last then
+  if t >= start - timeout and t <= last + timeout then
+    if t > last then
+      redis.call('HSET', KEYS[1], 'last', ARGV[1])
+    end
+    redis.call('PEXPIRE', KEYS[1], timeout)
+    return {s[1], s[2]}
+  end
+  if t < start - timeout then
+    return {'', ARGV[1]}
+  end
+end
+redis.call('HSET', KEYS[1], 'id', ARGV[3], 'start', ARGV[1], 'last', ARGV[1])
+redis.call('PEXPIRE', KEYS[1], timeout)
+return {ARGV[3], ARGV[1]}
+`)
+
+func parseSessionReply(reply any, err error) (sessionId string, sessionStart int64, _ error) {
+	values, err := redis.Values(reply, err)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to update session: %v", err)
+	}
+	if len(values) != 2 {
+		return "", 0, fmt.Errorf("failed to update session: unexpected redis response: %v", values)
+	}
+	sessionId, err = redis.String(values[0], nil)
+	if err == nil {
+		sessionStart, err = redis.Int64(values[1], nil)
+	}
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read session: %v", err)
+	}
+	return sessionId, sessionStart, nil
+}
+
+// sessionEventTime returns event timestamp. Current time is used when timestamp is missing or invalid
+func sessionEventTime(event *AnalyticsServerEvent) time.Time {
+	if ts, err := timestamp.ParseISOFormat(event.GetS("timestamp")); err == nil {
+		return ts.UTC()
+	}
+	return time.Now().UTC()
+}
+
+func newSessionId(anonymousId string, start time.Time) string {
+	return fmt.Sprintf("%x", utils.HashString(anonymousId+start.Format(timestamp.JsonISO)))
+}
+
+func (s *SessionStore) Close() error {
+	return s.redisPool.Close()
+}
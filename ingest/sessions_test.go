@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"github.com/jitsucom/bulker/eventslog/testcontainers"
+	"github.com/jitsucom/bulker/jitsubase/timestamp"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestSessionStore(t *testing.T) {
+	t.Parallel()
+	reqr := require.New(t)
+
+	redis, err := testcontainers.NewRedisContainer(context.Background())
+	reqr.NoError(err)
+	defer redis.Close()
+
+	store, err := NewSessionStore(&Config{RedisURL: redis.URL(), SessionTimeoutMin: 30})
+	reqr.NoError(err)
+	defer store.Close()
+
+	start := time.Now().UTC().Truncate(time.Second)
+	event := func(anonymousId string, eventTime time.Time) *AnalyticsServerEvent {
+		return &AnalyticsServerEvent{"anonymousId": anonymousId, "timestamp": eventTime.Format(timestamp.JsonISO)}
+	}
+	stamp := func(events ...*AnalyticsServerEvent) {
+		reqr.NoError(store.StampBatch("stream1", events))
+	}
+	requireSession := func(event *AnalyticsServerEvent, anonymousId string, sessionStart time.Time) {
+		reqr.Equal(newSessionId(anonymousId, sessionStart), (*event)[SessionIdProperty])
+		reqr.Equal(sessionStart.Format(timestamp.JsonISO), (*event)[SessionStartProperty])
+	}
+
+	//new session
+	first := event("anon1", start)
+	noAnonymousId := &AnalyticsServerEvent{"timestamp": start.Format(timestamp.JsonISO)}
+	other := event("anon2", start)
+	stamp(first, noAnonymousId, other)
+	requireSession(first, "anon1", start)
+	requireSession(other, "anon2", start)
+	reqr.NotContains(*noAnonymousId, SessionIdProperty)
+
+	//continuing session: events within inactivity timeout from the last event
+	second := event("anon1", start.Add(20*time.Minute))
+	third := event("anon1", start.Add(45*time.Minute))
+	stamp(second, third)
+	requireSession(second, "anon1", start)
+	requireSession(third, "anon1", start)
+
+	//late event within timeout before session start belongs to the session
+	late := event("anon1", start.Add(-10*time.Minute))
+	stamp(late)
+	requireSession(late, "anon1", start)
+
+	//timeout rollover: new session starts after inactivity timeout
+	rolloverTime := start.Add(45*time.Minute + 31*time.Minute)
+	rollover := event("anon1", rolloverTime)
+	stamp(rollover)
+	requireSession(rollover, "anon1", rolloverTime)
+	next := event("anon1", rolloverTime.Add(time.Minute))
+	stamp(next)
+	requireSession(next, "anon1", rolloverTime)
+
+	//event from one of the previous sessions gets its own session and doesn't affect the current one
+	old := event("anon1", start)
+	stamp(old)
+	requireSession(old, "anon1", start)
+	current := event("anon1", rolloverTime.Add(2*time.Minute))
+	stamp(current)
+	requireSession(current, "anon1", rolloverTime)
+
+	//sessions of streams are independent
+	otherStream := event("anon1", rolloverTime.Add(3*time.Minute))
+	reqr.NoError(store.StampBatch("stream2", []*AnalyticsServerEvent{otherStream}))
+	requireSession(otherStream, "anon1", rolloverTime.Add(3*time.Minute))
+}
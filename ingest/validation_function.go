@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jitsucom/bulker/jitsubase/appbase"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+)
+
+const ErrValidationRejected = "rejected by validation function"
+
+// ValidationFunction per-stream function executed by rotor (the same runtime as transformation functions)
+// before event is produced to Kafka. Function may reject event or return enriched version of it.
+// Function is called through rotor's /func/multi endpoint, one call per event (events of a batch are validated concurrently).
+// Result of the function is interpreted as follows:
+//   - object, non-empty array or true: event is accepted. Object (or the first element of array) replaces event payload
+//   - null, false, empty array or "drop": event is rejected
+//   - any other string: event is rejected with the string as a reason
+//
+// Rejected events are reported to the client and sent to dead letter topic with the reason of rejection.
+type ValidationFunction struct {
+	FunctionId string `json:"functionId"`
+	// RejectOnError rejects events when function cannot be executed (timeout, rotor unavailable).
+	// By default, such events are accepted as is
+	RejectOnError bool `json:"rejectOnError,omitempty"`
+}
+
+// ValidationRejectedError event was rejected by validation function. Reported to the client with 4xx status
+type ValidationRejectedError struct {
+	Reason string
+}
+
+func (e *ValidationRejectedError) Error() string {
+	return e.Reason
+}
+
+func isValidationRejected(err error) bool {
+	var rejected *ValidationRejectedError
+	return errors.As(err, &rejected)
+}
+
+// applyValidationFunction sends ingest messages to rotor for validation.
+// errs contains errors of events preparation: events with errors are not validated.
+// Validation errors are stored in errs. Enriched events returned by function replace messages payload
+func (r *Router) applyValidationFunction(stream *StreamWithDestinations, ingestMessages []*IngestMessage, errs []error) {
+	vf := stream.Stream.ValidationFunction
+	if vf == nil || vf.FunctionId == "" {
+		return
+	}
+	wg := sync.WaitGroup{}
+	for i, ingestMessage := range ingestMessages {
+		if errs[i] != nil {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, ingestMessage *IngestMessage) {
+			defer wg.Done()
+			event, err := r.callValidationFunction(vf.FunctionId, ingestMessage)
+			if err != nil {
+				if isValidationRejected(err) {
+					ValidationFunctions(stream.Stream.Id, "rejected").Inc()
+					errs[i] = err
+					return
+				}
+				ValidationFunctions(stream.Stream.Id, "error").Inc()
+				r.Errorf("Failed to run validation function %s for stream %s: %v", vf.FunctionId, stream.Stream.Id, err)
+				if vf.RejectOnError {
+					errs[i] = fmt.Errorf("failed to run validation function: %v", err)
+				}
+				return
+			}
+			ValidationFunctions(stream.Stream.Id, "success").Inc()
+			if len(event) > 0 {
+				*ingestMessage.HttpPayload = event
+			}
+		}(i, ingestMessage)
+	}
+	wg.Wait()
+}
+
+// callValidationFunction runs validation function for the ingest message.
+// Returns enriched event (empty if function didn't return an object) or ValidationRejectedError if event was rejected
+func (r *Router) callValidationFunction(functionId string, ingestMessage *IngestMessage) (AnalyticsServerEvent, error) {
+	if r.config.RotorURL == "" {
+		return nil, fmt.Errorf("rotor URL is not configured")
+	}
+	messageBytes, err := json.Marshal(ingestMessage)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", r.config.RotorURL+"/func/multi?ids="+url.QueryEscape(functionId), bytes.NewReader(messageBytes))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Request-Timeout-Ms", strconv.Itoa(r.config.DeviceFunctionsTimeoutMs))
+	if r.config.RotorAuthKey != "" {
+		req.Header.Set("Authorization", "Bearer "+r.config.RotorAuthKey)
+	}
+	res, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status: %d body: %s", res.StatusCode, string(body))
+	}
+	var functionsResults map[string]any
+	if err = json.Unmarshal(body, &functionsResults); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal rotor response: %v", err)
+	}
+	result, ok := functionsResults[functionId]
+	if !ok {
+		return nil, fmt.Errorf("rotor response has no result of function %s", functionId)
+	}
+	return validationResult(result)
+}
+
+// validationResult interprets result of validation function. See ValidationFunction
+func validationResult(result any) (AnalyticsServerEvent, error) {
+	switch v := result.(type) {
+	case map[string]any:
+		return v, nil
+	case []any:
+		if len(v) > 0 {
+			event, _ := v[0].(map[string]any)
+			return event, nil
+		}
+	case string:
+		if v != "" && v != "drop" {
+			return nil, &ValidationRejectedError{Reason: v}
+		}
+	case bool:
+		if v {
+			return nil, nil
+		}
+	}
+	return nil, &ValidationRejectedError{Reason: "event is not valid"}
+}
+
+// deadLetterHeaders Kafka headers of message sent to dead letter topic. Contain error type and error or reason of rejection
+func deadLetterHeaders(rError *appbase.RouterError) map[string]string {
+	return map[string]string{"error": rError.Error.Error(), "error_type": rError.ErrorType}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/jitsucom/bulker/kafkabase"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestValidationResult(t *testing.T) {
+	tests := []struct {
+		name          string
+		result        any
+		wantEvent     AnalyticsServerEvent
+		wantRejection string
+	}{
+		{"object", map[string]any{"userId": "1"}, AnalyticsServerEvent{"userId": "1"}, ""},
+		{"array", []any{map[string]any{"userId": "1"}, map[string]any{"userId": "2"}}, AnalyticsServerEvent{"userId": "1"}, ""},
+		{"true", true, nil, ""},
+		{"null", nil, nil, "event is not valid"},
+		{"false", false, nil, "event is not valid"},
+		{"empty_array", []any{}, nil, "event is not valid"},
+		{"drop", "drop", nil, "event is not valid"},
+		{"reason", "missing userId", nil, "missing userId"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := validationResult(tt.result)
+			if tt.wantRejection != "" {
+				require.True(t, isValidationRejected(err))
+				require.EqualError(t, err, tt.wantRejection)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tt.wantEvent, event)
+		})
+	}
+}
+
+// newTestRotor runs rotor that validates events with function 'validate':
+// events named 'invalid' are rejected, 'slow' events are validated longer than functions timeout, others are enriched
+func newTestRotor(t *testing.T) *httptest.Server {
+	rotor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/func/multi" || r.URL.Query().Get("ids") != "validate" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var message IngestMessage
+		if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var result any
+		switch message.HttpPayload.GetS("event") {
+		case "invalid":
+			result = "missing userId"
+		case "slow":
+			time.Sleep(500 * time.Millisecond)
+			result = true
+		default:
+			event := *message.HttpPayload
+			event["validated"] = true
+			result = event
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"validate": result})
+	}))
+	t.Cleanup(rotor.Close)
+	return rotor
+}
+
+func TestValidationFunction(t *testing.T) {
+	rotor := newTestRotor(t)
+	config := &Config{RotorURL: rotor.URL, DeviceFunctionsTimeoutMs: 100}
+	router := newTestRouter(t, config, `[
+{"stream": {"id": "lenient", "validationFunction": {"functionId": "validate"}}, "destinations": [{"id": "d1", "connectionId": "c1", "destinationType": "postgres"}]},
+{"stream": {"id": "strict", "validationFunction": {"functionId": "validate", "rejectOnError": true}}, "destinations": [{"id": "d1", "connectionId": "c2", "destinationType": "postgres"}]}
+]`)
+
+	w := router.request("POST", "/api/s/track", "lenient", `{"event": "page_opened", "messageId": "accepted"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = router.request("POST", "/api/s/track", "lenient", `{"event": "invalid", "messageId": "rejected"}`)
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	require.Contains(t, w.Body.String(), "missing userId")
+
+	//functions timeout: event is accepted as is unless stream rejects events on errors
+	w = router.request("POST", "/api/s/track", "lenient", `{"event": "slow", "messageId": "timeout_accepted"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	w = router.request("POST", "/api/s/track", "strict", `{"event": "slow", "messageId": "timeout_rejected"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), "failed to run validation function")
+
+	destinationMessages := map[string]IngestMessage{}
+	for _, message := range router.readMessages(t, testDestinationsTopic, 2) {
+		var ingestMessage IngestMessage
+		require.NoError(t, json.Unmarshal(message.Value, &ingestMessage))
+		destinationMessages[ingestMessage.MessageId] = ingestMessage
+	}
+	require.Len(t, destinationMessages, 2)
+	require.Equal(t, true, (*destinationMessages["accepted"].HttpPayload)["validated"])
+	require.NotContains(t, *destinationMessages["timeout_accepted"].HttpPayload, "validated")
+
+	deadLetters := map[string]*kafka.Message{}
+	for _, message := range router.readMessages(t, testDeadLetterTopic, 2) {
+		var ingestMessage IngestMessage
+		require.NoError(t, json.Unmarshal(message.Value, &ingestMessage))
+		deadLetters[ingestMessage.MessageId] = message
+	}
+	require.Len(t, deadLetters, 2)
+	require.Equal(t, ErrValidationRejected, kafkabase.GetKafkaHeader(deadLetters["rejected"], "error_type"))
+	require.Contains(t, kafkabase.GetKafkaHeader(deadLetters["rejected"], "error"), "missing userId")
+	require.Equal(t, "event error", kafkabase.GetKafkaHeader(deadLetters["timeout_rejected"], "error_type"))
+}
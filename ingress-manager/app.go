@@ -44,6 +44,7 @@ func (a *Context) InitContext(settings *appbase.AppSettings) error {
 }
 
 func (a *Context) Cleanup() error {
+	a.manager.Close()
 	_ = a.certMgr.Close()
 	return nil
 }
@@ -28,6 +28,13 @@ type Config struct {
 	AddGoogleCerts bool `mapstructure:"ADD_GOOGLE_CERTS" default:"false"`
 	// CleanupCerts if true, ingress-manager will delete Certificates and CertificateMapEntry for domain names that no longer leads to a valid cnames
 	CleanupCerts bool `mapstructure:"CLEANUP_CERTS" default:"false"`
+
+	// CertIssuanceLimitPerHour max number of certificate issuance attempts per hour. Domains above the limit wait in the queue. 0 - unlimited
+	CertIssuanceLimitPerHour int `mapstructure:"CERT_ISSUANCE_LIMIT_PER_HOUR" default:"50"`
+	// CertIssuanceMaxRetries max number of attempts to issue certificate for a domain before giving up
+	CertIssuanceMaxRetries int `mapstructure:"CERT_ISSUANCE_MAX_RETRIES" default:"5"`
+	// CertIssuanceRetryBackoffSec initial delay before retrying failed issuance. Doubles with every attempt
+	CertIssuanceRetryBackoffSec int `mapstructure:"CERT_ISSUANCE_RETRY_BACKOFF_SEC" default:"60"`
 }
 
 func init() {
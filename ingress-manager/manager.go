@@ -10,6 +10,8 @@ import (
 	"github.com/jitsucom/bulker/jitsubase/appbase"
 	"github.com/jitsucom/bulker/jitsubase/utils"
 	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/fieldmaskpb"
 
 	"sync"
@@ -28,6 +30,7 @@ type Manager struct {
 	config   *Config
 	cnames   utils.Set[string]
 	cmParent string
+	queue    *IssuanceQueue
 }
 
 func NewManager(appContext *Context) *Manager {
@@ -35,6 +38,10 @@ func NewManager(appContext *Context) *Manager {
 	cnames := strings.Split(appContext.config.JitsuCnames, ",")
 	m := &Manager{Service: base, certMgr: appContext.certMgr, config: appContext.config, cnames: utils.NewSet(cnames...),
 		cmParent: fmt.Sprintf("projects/%s/locations/global", appContext.config.GoogleCloudProject)}
+	m.queue = NewIssuanceQueue(appContext.config, func(domain string) error {
+		_, err := m.IssueGoogleCert(domain, nil)
+		return err
+	})
 	err := m.Init()
 	if err != nil {
 		panic(err)
@@ -455,43 +462,72 @@ const (
 	DomainStatusCNAME       DomainStatus = "dns_error"
 	DomainStatusOK          DomainStatus = "ok"
 	DomainStatusIssuingCert DomainStatus = "pending_ssl"
+	// DomainStatusQueued domain is waiting in certificate issuance queue
+	DomainStatusQueued DomainStatus = "queued"
 )
 
-func (m *Manager) AddDomain(domain string) (status DomainStatus, err error) {
+// AddDomain starts certificate issuance for domain if necessary and returns domain status.
+// New certificates are issued through rate-limited queue, queuePosition is returned for domains that are still in the queue
+func (m *Manager) AddDomain(domain string) (status DomainStatus, queuePosition int, err error) {
 	m.Infof("[%s] adding domain...", domain)
 	// first check that domain leads to the cna e
 	cname, _ := m.checkCname(domain)
 	if !cname {
-		return DomainStatusCNAME, nil
+		return DomainStatusCNAME, 0, nil
+	}
+	if position, ok := m.queue.Position(domain); ok {
+		return DomainStatusQueued, position, nil
+	}
+	if failed, ok := m.queue.PopFailed(domain); ok {
+		m.Errorf("[%s] error issuing google certificate: %s", domain, failed.LastError)
+		return DomainStatusError, 0, fmt.Errorf("certificate issuance failed after %d attempts: %s", failed.Attempts, failed.LastError)
+	}
+	_, err = m.certMgr.GetCertificate(context.Background(), &certificatemanagerpb.GetCertificateRequest{Name: fmt.Sprintf("%s/certificates/%s", m.cmParent, name(domain))})
+	if grpcstatus.Code(err) == codes.NotFound {
+		// new certificate is issued through the queue
+		return DomainStatusQueued, m.queue.Enqueue(domain), nil
+	}
+	if err != nil {
+		m.Errorf("[%s] error getting google certificate: %v", domain, err)
+		return DomainStatusError, 0, err
 	}
 
 	alreadyExists, err := m.IssueGoogleCert(domain, nil)
 	if err != nil {
 		m.Errorf("[%s] error issuing google certificate: %v", domain, err)
-		return DomainStatusError, err
+		return DomainStatusError, 0, err
 	}
 	if !alreadyExists {
 		// domain was just added to ingress, so it's pending
-		return DomainStatusIssuingCert, nil
+		return DomainStatusIssuingCert, 0, nil
 	}
 
 	certStatus, err := m.checkCertificate(domain)
 	switch certStatus {
 	case CertificateStatusError:
 		m.Errorf("[%s] check certificate error: %v", domain, err)
-		return DomainStatusError, err
+		return DomainStatusError, 0, err
 	case CertificateStatusPending:
 		m.Infof("[%s] issuing certificate", domain)
-		return DomainStatusIssuingCert, nil
+		return DomainStatusIssuingCert, 0, nil
 	case CertificateStatusOK:
 		m.Infof("[%s] certificate is OK.", domain)
-		return DomainStatusOK, nil
+		return DomainStatusOK, 0, nil
 	default:
 		m.Errorf("[%s] unknown certificate status: %v", domain, certStatus)
-		return DomainStatusError, fmt.Errorf("unknown certificate status: %v", certStatus)
+		return DomainStatusError, 0, fmt.Errorf("unknown certificate status: %v", certStatus)
 	}
 }
 
+// QueuedDomains returns domains waiting for certificate issuance
+func (m *Manager) QueuedDomains() []IssuanceItem {
+	return m.queue.Items()
+}
+
+func (m *Manager) Close() {
+	m.queue.Close()
+}
+
 type CertificateStatus string
 
 const (
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"github.com/jitsucom/bulker/jitsubase/appbase"
+	"github.com/jitsucom/bulker/jitsubase/safego"
+	"sync"
+	"time"
+)
+
+const issuanceWindow = time.Hour
+
+// IssuanceItem domain waiting for certificate issuance
+type IssuanceItem struct {
+	Domain      string    `json:"domain"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"nextAttempt"`
+	LastError   string    `json:"lastError,omitempty"`
+}
+
+// IssuanceQueue issues certificates one by one with per-hour limit of issuance attempts,
+// so adding many domains at once doesn't trip CA rate limits. Failed attempts are retried with exponential backoff.
+type IssuanceQueue struct {
+	sync.Mutex
+	appbase.Service
+	issueFunc    func(domain string) error
+	limitPerHour int
+	maxRetries   int
+	retryBackoff time.Duration
+
+	items   []*IssuanceItem
+	current *IssuanceItem
+	// failed domains that exceeded max retries
+	failed map[string]*IssuanceItem
+	// times of issuance attempts within issuanceWindow
+	attempts []time.Time
+	wakeup   chan struct{}
+	closed   chan struct{}
+}
+
+func NewIssuanceQueue(config *Config, issueFunc func(domain string) error) *IssuanceQueue {
+	q := &IssuanceQueue{
+		Service:      appbase.NewServiceBase("issuance-queue"),
+		issueFunc:    issueFunc,
+		limitPerHour: config.CertIssuanceLimitPerHour,
+		maxRetries:   config.CertIssuanceMaxRetries,
+		retryBackoff: time.Duration(config.CertIssuanceRetryBackoffSec) * time.Second,
+		failed:       map[string]*IssuanceItem{},
+		wakeup:       make(chan struct{}, 1),
+		closed:       make(chan struct{}),
+	}
+	q.start()
+	return q
+}
+
+// Enqueue adds domain to the queue if it isn't there yet. Returns position of domain in the queue
+func (q *IssuanceQueue) Enqueue(domain string) int {
+	q.Lock()
+	defer q.Unlock()
+	if position, ok := q.position(domain); ok {
+		return position
+	}
+	delete(q.failed, domain)
+	q.items = append(q.items, &IssuanceItem{Domain: domain, NextAttempt: time.Now()})
+	select {
+	case q.wakeup <- struct{}{}:
+	default:
+	}
+	position, _ := q.position(domain)
+	q.Infof("[%s] queued for certificate issuance. Position: %d", domain, position)
+	return position
+}
+
+// Position returns 1-based position of domain in the queue. Domain which certificate is being issued has position 1
+func (q *IssuanceQueue) Position(domain string) (int, bool) {
+	q.Lock()
+	defer q.Unlock()
+	return q.position(domain)
+}
+
+func (q *IssuanceQueue) position(domain string) (int, bool) {
+	offset := 1
+	if q.current != nil {
+		if q.current.Domain == domain {
+			return 1, true
+		}
+		offset = 2
+	}
+	for i, item := range q.items {
+		if item.Domain == domain {
+			return i + offset, true
+		}
+	}
+	return 0, false
+}
+
+// PopFailed returns and forgets domain that exceeded max retries
+func (q *IssuanceQueue) PopFailed(domain string) (*IssuanceItem, bool) {
+	q.Lock()
+	defer q.Unlock()
+	item, ok := q.failed[domain]
+	if ok {
+		delete(q.failed, domain)
+	}
+	return item, ok
+}
+
+// Items returns snapshot of queued domains in order of processing
+func (q *IssuanceQueue) Items() []IssuanceItem {
+	q.Lock()
+	defer q.Unlock()
+	items := make([]IssuanceItem, 0, len(q.items)+1)
+	if q.current != nil {
+		items = append(items, *q.current)
+	}
+	for _, item := range q.items {
+		items = append(items, *item)
+	}
+	return items
+}
+
+func (q *IssuanceQueue) start() {
+	safego.RunWithRestart(func() {
+		for {
+			item, wait := q.next()
+			if item == nil {
+				select {
+				case <-q.closed:
+					return
+				case <-q.wakeup:
+				case <-time.After(wait):
+				}
+				continue
+			}
+			err := q.issueFunc(item.Domain)
+			q.done(item, err)
+		}
+	})
+}
+
+// next returns item ready for issuance or duration to wait for the next one
+func (q *IssuanceQueue) next() (*IssuanceItem, time.Duration) {
+	q.Lock()
+	defer q.Unlock()
+	now := time.Now()
+	for len(q.attempts) > 0 && now.Sub(q.attempts[0]) >= issuanceWindow {
+		q.attempts = q.attempts[1:]
+	}
+	if q.limitPerHour > 0 && len(q.attempts) >= q.limitPerHour {
+		return nil, q.attempts[0].Add(issuanceWindow).Sub(now)
+	}
+	wait := issuanceWindow
+	for i, item := range q.items {
+		if !item.NextAttempt.After(now) {
+			q.items = append(q.items[:i:i], q.items[i+1:]...)
+			q.current = item
+			q.attempts = append(q.attempts, now)
+			return item, 0
+		}
+		if w := item.NextAttempt.Sub(now); w < wait {
+			wait = w
+		}
+	}
+	return nil, wait
+}
+
+func (q *IssuanceQueue) done(item *IssuanceItem, err error) {
+	q.Lock()
+	defer q.Unlock()
+	q.current = nil
+	if err == nil {
+		q.Infof("[%s] certificate issuance started", item.Domain)
+		return
+	}
+	item.Attempts++
+	item.LastError = err.Error()
+	if item.Attempts >= q.maxRetries {
+		q.Errorf("[%s] certificate issuance failed after %d attempts: %v", item.Domain, item.Attempts, err)
+		q.failed[item.Domain] = item
+		return
+	}
+	item.NextAttempt = time.Now().Add(q.retryBackoff * time.Duration(1<<(item.Attempts-1)))
+	q.Warnf("[%s] certificate issuance attempt %d failed: %v. Next attempt at: %s", item.Domain, item.Attempts, err, item.NextAttempt.Format(time.RFC3339))
+	q.items = append(q.items, item)
+}
+
+func (q *IssuanceQueue) Close() {
+	close(q.closed)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testIssuer records issued domains. Issuance of each domain blocks until released when release channel is set
+type testIssuer struct {
+	sync.Mutex
+	issued  []string
+	err     error
+	release chan struct{}
+}
+
+func (i *testIssuer) issue(domain string) error {
+	if i.release != nil {
+		<-i.release
+	}
+	i.Lock()
+	defer i.Unlock()
+	i.issued = append(i.issued, domain)
+	return i.err
+}
+
+func (i *testIssuer) Issued() []string {
+	i.Lock()
+	defer i.Unlock()
+	return append([]string{}, i.issued...)
+}
+
+func newTestQueue(t *testing.T, config *Config, issuer *testIssuer) *IssuanceQueue {
+	queue := NewIssuanceQueue(config, issuer.issue)
+	t.Cleanup(queue.Close)
+	return queue
+}
+
+func TestIssuanceQueueOrder(t *testing.T) {
+	reqr := require.New(t)
+	issuer := &testIssuer{release: make(chan struct{})}
+	queue := newTestQueue(t, &Config{CertIssuanceMaxRetries: 1}, issuer)
+
+	reqr.Equal(1, queue.Enqueue("a.com"))
+	//a.com is being issued and stays at the first position
+	reqr.Eventually(func() bool {
+		items := queue.Items()
+		return len(items) == 1 && items[0].Domain == "a.com"
+	}, time.Second, 10*time.Millisecond)
+	reqr.Equal(2, queue.Enqueue("b.com"))
+	reqr.Equal(3, queue.Enqueue("c.com"))
+	//duplicates keep their position
+	reqr.Equal(2, queue.Enqueue("b.com"))
+	position, ok := queue.Position("c.com")
+	reqr.True(ok)
+	reqr.Equal(3, position)
+	_, ok = queue.Position("d.com")
+	reqr.False(ok)
+
+	close(issuer.release)
+	reqr.Eventually(func() bool { return len(queue.Items()) == 0 }, time.Second, 10*time.Millisecond)
+	reqr.Equal([]string{"a.com", "b.com", "c.com"}, issuer.Issued())
+	_, ok = queue.Position("a.com")
+	reqr.False(ok)
+}
+
+func TestIssuanceQueueLimit(t *testing.T) {
+	reqr := require.New(t)
+	issuer := &testIssuer{}
+	queue := newTestQueue(t, &Config{CertIssuanceLimitPerHour: 2, CertIssuanceMaxRetries: 1}, issuer)
+
+	for _, domain := range []string{"a.com", "b.com", "c.com"} {
+		queue.Enqueue(domain)
+	}
+	reqr.Eventually(func() bool { return len(issuer.Issued()) == 2 }, time.Second, 10*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	//domain above the limit waits for the next window
+	reqr.Equal([]string{"a.com", "b.com"}, issuer.Issued())
+	position, ok := queue.Position("c.com")
+	reqr.True(ok)
+	reqr.Equal(1, position)
+}
+
+func TestIssuanceQueueRetries(t *testing.T) {
+	reqr := require.New(t)
+	issuer := &testIssuer{err: fmt.Errorf("quota exceeded")}
+	queue := newTestQueue(t, &Config{CertIssuanceMaxRetries: 2}, issuer)
+
+	queue.Enqueue("a.com")
+	var failed *IssuanceItem
+	reqr.Eventually(func() bool {
+		var ok bool
+		failed, ok = queue.PopFailed("a.com")
+		return ok
+	}, time.Second, 10*time.Millisecond)
+	reqr.Equal(2, failed.Attempts)
+	reqr.Equal("quota exceeded", failed.LastError)
+	reqr.Equal([]string{"a.com", "a.com"}, issuer.Issued())
+	_, ok := queue.PopFailed("a.com")
+	reqr.False(ok)
+	_, ok = queue.Position("a.com")
+	reqr.False(ok)
+}
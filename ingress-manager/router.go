@@ -23,6 +23,7 @@ func NewRouter(appContext *Context) *Router {
 	engine := router.Engine()
 	engine.GET("/api/domain", router.DomainHandler)
 	engine.POST("/api/domain", router.DomainsHandler)
+	engine.GET("/api/queue", router.QueueHandler)
 
 	engine.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"status": "pass"})
@@ -48,12 +49,24 @@ func (r *Router) DomainHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "domain is required"})
 		return
 	}
-	status, err := r.manager.AddDomain(domain)
+	status, position, err := r.manager.AddDomain(domain)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"status": status})
+	c.JSON(http.StatusOK, domainResult(status, position))
+}
+
+func (r *Router) QueueHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"queue": r.manager.QueuedDomains()})
+}
+
+func domainResult(status DomainStatus, queuePosition int) map[string]any {
+	res := map[string]any{"status": status}
+	if status == DomainStatusQueued {
+		res["queuePosition"] = queuePosition
+	}
+	return res
 }
 
 type DomainsPayload struct {
@@ -70,12 +83,10 @@ func (r *Router) DomainsHandler(c *gin.Context) {
 	result := map[string]map[string]any{}
 
 	for _, domain := range payload.Domains {
-		status, err := r.manager.AddDomain(domain)
+		status, position, err := r.manager.AddDomain(domain)
+		result[domain] = domainResult(status, position)
 		if err != nil {
-			result[domain] = map[string]any{"status": status, "error": err.Error()}
-			return
-		} else {
-			result[domain] = map[string]any{"status": status}
+			result[domain]["error"] = err.Error()
 		}
 	}
 
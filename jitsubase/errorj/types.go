@@ -1,6 +1,7 @@
 package errorj
 
 import (
+	"errors"
 	"github.com/joomcode/errorx"
 )
 
@@ -12,6 +13,7 @@ var (
 	BeginTransactionError     = sqlError.NewSubtype("begin_transaction")
 	CommitTransactionError    = sqlError.NewSubtype("commit_transaction")
 	RollbackTransactionError  = sqlError.NewSubtype("rollback_transaction")
+	SavepointError            = sqlError.NewSubtype("savepoint")
 	CreateSchemaError         = sqlError.NewSubtype("create_schema")
 	CreateTableError          = sqlError.NewSubtype("create_table")
 	PatchTableError           = sqlError.NewSubtype("patch_table")
@@ -31,6 +33,10 @@ var (
 	BulkMergeError            = sqlError.NewSubtype("bulk_merge")
 	LoadError                 = sqlError.NewSubtype("load")
 	CopyError                 = sqlError.NewSubtype("copy")
+	StatementTimeoutError     = sqlError.NewSubtype("statement_timeout")
+	TransformError            = sqlError.NewSubtype("transform")
+	MaintenanceError          = sqlError.NewSubtype("maintenance")
+	PreCommitHookError        = sqlError.NewSubtype("pre_commit_hook")
 
 	stageErr             = reportedErrors.NewType("stage")
 	SaveOnStageError     = stageErr.NewSubtype("save_on_stage")
@@ -84,3 +90,14 @@ func IsSystemError(err error) bool {
 
 	return false
 }
+
+// Cause returns the innermost cause of errorx error. errorx wrapping is opaque for errors.Is and errors.As
+func Cause(err error) error {
+	for {
+		var e *errorx.Error
+		if !errors.As(err, &e) || e.Cause() == nil {
+			return err
+		}
+		err = e.Cause()
+	}
+}
@@ -0,0 +1,32 @@
+package redispool
+
+import (
+	"fmt"
+	"github.com/gomodule/redigo/redis"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"strings"
+	"time"
+)
+
+// NewRedisPool creates redis connection pool. TLS is used for rediss:// urls or when certificates are configured.
+// Server certificate is verified unless tlsConfig explicitly sets InsecureSkipVerify
+func NewRedisPool(redisURL string, tlsConfig *utils.TLSConfig) (*redis.Pool, error) {
+	opts := make([]redis.DialOption, 0)
+	if tlsConfig.HasCertificates() || strings.HasPrefix(redisURL, "rediss://") {
+		if tlsConfig == nil {
+			tlsConfig = &utils.TLSConfig{}
+		}
+		tc, err := tlsConfig.Build()
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis TLS config: %v", err)
+		}
+		opts = append(opts, redis.DialUseTLS(true), redis.DialTLSConfig(tc))
+	}
+
+	return &redis.Pool{
+		MaxIdle:     3,
+		IdleTimeout: 240 * time.Second,
+		// Dial or DialContext must be set. When both are set, DialContext takes precedence over Dial.
+		Dial: func() (redis.Conn, error) { return redis.DialURL(redisURL, opts...) },
+	}, nil
+}
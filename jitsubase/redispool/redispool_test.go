@@ -0,0 +1,34 @@
+package redispool
+
+import (
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestNewRedisPool(t *testing.T) {
+	tests := []struct {
+		name      string
+		url       string
+		tlsConfig *utils.TLSConfig
+		wantErr   bool
+	}{
+		{name: "plain", url: "redis://localhost:6379"},
+		{name: "tls_without_config", url: "rediss://localhost:6379"},
+		{name: "tls_skip_verify", url: "rediss://localhost:6379", tlsConfig: &utils.TLSConfig{InsecureSkipVerify: true}},
+		{name: "invalid_ca", url: "rediss://localhost:6379", tlsConfig: &utils.TLSConfig{CA: "-----BEGIN CERTIFICATE-----\nbroken\n-----END CERTIFICATE-----"}, wantErr: true},
+		{name: "client_cert_without_key", url: "redis://localhost:6379", tlsConfig: &utils.TLSConfig{ClientCert: "-----BEGIN CERTIFICATE-----"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool, err := NewRedisPool(tt.url, tt.tlsConfig)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.NotNil(t, pool)
+			_ = pool.Close()
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const pemPrefix = "-----BEGIN"
+
+// TLSConfig is a uniform TLS/mTLS configuration for client connections.
+// CA, ClientCert and ClientKey accept either PEM content or path to PEM file.
+type TLSConfig struct {
+	// CA bundle used to verify server certificate. System cert pool is used when empty
+	CA string `mapstructure:"ca,omitempty" json:"ca,omitempty" yaml:"ca,omitempty"`
+	// ClientCert and ClientKey client certificate for mutual TLS
+	ClientCert string `mapstructure:"clientCert,omitempty" json:"clientCert,omitempty" yaml:"clientCert,omitempty"`
+	ClientKey  string `mapstructure:"clientKey,omitempty" json:"clientKey,omitempty" yaml:"clientKey,omitempty"`
+	// ServerName overrides server name used for SNI and certificate verification
+	ServerName         string `mapstructure:"serverName,omitempty" json:"serverName,omitempty" yaml:"serverName,omitempty"`
+	InsecureSkipVerify bool   `mapstructure:"insecureSkipVerify,omitempty" json:"insecureSkipVerify,omitempty" yaml:"insecureSkipVerify,omitempty"`
+}
+
+// IsPEM returns true if value is PEM content rather than path to PEM file
+func IsPEM(value string) bool {
+	return strings.Contains(value, pemPrefix)
+}
+
+// ReadPEM returns PEM content of value. If value isn't PEM content it is read from file
+func ReadPEM(value string) ([]byte, error) {
+	if IsPEM(value) {
+		return []byte(value), nil
+	}
+	return os.ReadFile(value)
+}
+
+// HasCertificates returns true if CA or client certificate is configured
+func (c *TLSConfig) HasCertificates() bool {
+	return c != nil && (c.CA != "" || c.ClientCert != "" || c.ClientKey != "")
+}
+
+// Build returns tls.Config
+func (c *TLSConfig) Build() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+	if c.CA != "" {
+		ca, err := ReadPEM(c.CA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA: %v", err)
+		}
+		rootCAs, _ := x509.SystemCertPool()
+		if rootCAs == nil {
+			rootCAs = x509.NewCertPool()
+		}
+		if !rootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in CA")
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+	if c.ClientCert != "" || c.ClientKey != "" {
+		if c.ClientCert == "" || c.ClientKey == "" {
+			return nil, fmt.Errorf("both client certificate and client key are required for mutual TLS")
+		}
+		certPEM, err := ReadPEM(c.ClientCert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client certificate: %v", err)
+		}
+		keyPEM, err := ReadPEM(c.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client key: %v", err)
+		}
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,419 @@
+package kafkabase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/jitsucom/bulker/jitsubase/appbase"
+	"github.com/jitsucom/bulker/jitsubase/safego"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EnvelopeVersionHeader - version of message envelope: format of message value and meaning of headers.
+// Messages without header were produced by releases prior to envelope versioning and are treated as version 1
+const EnvelopeVersionHeader = "envelope_version"
+
+// Range of envelope versions this release is able to consume.
+// Version 2: message may be a frame of multiple events. See EnvelopeFrameHeader
+const (
+	MinEnvelopeVersion = 1
+	MaxEnvelopeVersion = 2
+)
+
+const envelopeAnnounceInterval = 30 * time.Second
+
+// envelopeAnnouncementTTL announcements of instances that didn't report for longer period are not taken into account
+const envelopeAnnouncementTTL = 3 * envelopeAnnounceInterval
+
+// envelopeNegotiatorGroupPrefix consumer groups of negotiators read announcements only and are not taken into account
+const envelopeNegotiatorGroupPrefix = "envelope-negotiator-"
+
+// EnvelopeVersionError message envelope version is not supported by this instance
+type EnvelopeVersionError struct {
+	Version int
+}
+
+func (e *EnvelopeVersionError) Error() string {
+	return fmt.Sprintf("unsupported message envelope version %d. Supported versions: %d-%d", e.Version, MinEnvelopeVersion, MaxEnvelopeVersion)
+}
+
+// TooNew message was produced by newer release. It must be left for upgraded instances
+func (e *EnvelopeVersionError) TooNew() bool {
+	return e.Version > MaxEnvelopeVersion
+}
+
+// GetEnvelopeVersion returns envelope version of message
+func GetEnvelopeVersion(message *kafka.Message) int {
+	v := GetKafkaHeader(message, EnvelopeVersionHeader)
+	if v == "" {
+		return MinEnvelopeVersion
+	}
+	version, err := strconv.Atoi(v)
+	if err != nil {
+		// unparseable header can only come from some future incompatible format
+		return MaxEnvelopeVersion + 1
+	}
+	return version
+}
+
+// CheckEnvelopeVersion returns *EnvelopeVersionError if envelope version of message is not supported.
+// Counts consumed messages per envelope version
+func CheckEnvelopeVersion(message *kafka.Message) error {
+	version := GetEnvelopeVersion(message)
+	if version < MinEnvelopeVersion {
+		EnvelopeMessages("consumed", version, "too_old").Inc()
+		return &EnvelopeVersionError{Version: version}
+	}
+	if version > MaxEnvelopeVersion {
+		EnvelopeMessages("consumed", version, "too_new").Inc()
+		return &EnvelopeVersionError{Version: version}
+	}
+	EnvelopeMessages("consumed", version, "ok").Inc()
+	return nil
+}
+
+// EnvelopeVersionTooNew returns true if message was produced with envelope version that is newer than supported by this instance
+func EnvelopeVersionTooNew(message *kafka.Message) bool {
+	return GetEnvelopeVersion(message) > MaxEnvelopeVersion
+}
+
+// envelopeAnnouncement supported envelope versions range of running instance
+type envelopeAnnouncement struct {
+	Service    string    `json:"service"`
+	InstanceId string    `json:"instanceId"`
+	Consumer   bool      `json:"consumer"`
+	MinVersion int       `json:"minVersion"`
+	MaxVersion int       `json:"maxVersion"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// consumerGroupMember member of consumer group of Kafka cluster
+type consumerGroupMember struct {
+	GroupId         string
+	GroupInstanceId string
+	ClientId        string
+	Host            string
+}
+
+// EnvelopeNegotiator selects envelope version of produced messages during rolling upgrades.
+// Each instance periodically announces range of supported versions to compacted topic.
+// Releases prior to envelope versioning never announce themselves, so announcements alone can't prove that all consumers are upgraded.
+// Producers use MinEnvelopeVersion until every member of consumer groups of the cluster is matched with live announcement,
+// then the highest version supported by all of them. See negotiateVersion
+type EnvelopeNegotiator struct {
+	sync.RWMutex
+	appbase.Service
+	config       *KafkaConfig
+	announcement envelopeAnnouncement
+	producer     *kafka.Producer
+	consumer     *kafka.Consumer
+	peers        map[string]envelopeAnnouncement
+	// members of consumer groups. nil until the first successful describe of consumer groups
+	members []consumerGroupMember
+	version atomic.Int32
+	closed  chan struct{}
+}
+
+// NewEnvelopeNegotiator creates EnvelopeNegotiator. consumer - whether instance consumes messages produced by other instances
+func NewEnvelopeNegotiator(config *KafkaConfig, kafkaConfig *kafka.ConfigMap, service, instanceId string, consumer bool) (*EnvelopeNegotiator, error) {
+	base := appbase.NewServiceBase("envelope-negotiator")
+	if config.EnvelopeVersion != 0 && (config.EnvelopeVersion < MinEnvelopeVersion || config.EnvelopeVersion > MaxEnvelopeVersion) {
+		return nil, base.NewError("ENVELOPE_VERSION=%d is not supported. Supported versions: %d-%d", config.EnvelopeVersion, MinEnvelopeVersion, MaxEnvelopeVersion)
+	}
+	producer, err := kafka.NewProducer(kafkaConfig)
+	if err != nil {
+		return nil, base.NewError("error creating kafka producer: %v", err)
+	}
+	consumerConfig := kafka.ConfigMap{
+		"group.id":           fmt.Sprintf("%s%s-%s", envelopeNegotiatorGroupPrefix, service, instanceId),
+		"enable.auto.commit": false,
+	}
+	for k, v := range *kafkaConfig {
+		consumerConfig[k] = v
+	}
+	kafkaConsumer, err := kafka.NewConsumer(&consumerConfig)
+	if err != nil {
+		producer.Close()
+		return nil, base.NewError("error creating kafka consumer: %v", err)
+	}
+	en := &EnvelopeNegotiator{
+		Service: base,
+		config:  config,
+		announcement: envelopeAnnouncement{
+			Service:    service,
+			InstanceId: instanceId,
+			Consumer:   consumer,
+			MinVersion: MinEnvelopeVersion,
+			MaxVersion: MaxEnvelopeVersion,
+		},
+		producer: producer,
+		consumer: kafkaConsumer,
+		peers:    map[string]envelopeAnnouncement{},
+		closed:   make(chan struct{}),
+	}
+	// until announcements of other instances are read we assume the oldest format
+	en.version.Store(MinEnvelopeVersion)
+	if config.EnvelopeVersion != 0 {
+		en.version.Store(int32(config.EnvelopeVersion))
+	}
+	NegotiatedEnvelopeVersion.Set(float64(en.version.Load()))
+	return en, nil
+}
+
+// Start creates negotiation topic if necessary and starts announcing and reading announcements
+func (en *EnvelopeNegotiator) Start() error {
+	if err := en.ensureTopic(); err != nil {
+		return err
+	}
+	topic := en.config.KafkaEnvelopeTopicName
+	err := en.consumer.Assign([]kafka.TopicPartition{{Topic: &topic, Partition: 0, Offset: kafka.OffsetBeginning}})
+	if err != nil {
+		return en.NewError("failed to assign envelope negotiation topic %s: %v", topic, err)
+	}
+	safego.RunWithRestart(func() {
+		for e := range en.producer.Events() {
+			if m, ok := e.(*kafka.Message); ok && m.TopicPartition.Error != nil {
+				en.Errorf("Failed to announce envelope versions: %v", m.TopicPartition.Error)
+			}
+		}
+	})
+	safego.RunWithRestart(func() {
+		for {
+			select {
+			case <-en.closed:
+				_ = en.consumer.Close()
+				return
+			default:
+				message, err := en.consumer.ReadMessage(time.Second)
+				if err != nil {
+					if kafkaErr, ok := err.(kafka.Error); !ok || kafkaErr.Code() != kafka.ErrTimedOut {
+						en.Errorf("Failed to read envelope negotiation topic: %v", err)
+						time.Sleep(5 * time.Second)
+					}
+					continue
+				}
+				en.onAnnouncement(message)
+			}
+		}
+	})
+	en.announce()
+	safego.RunWithRestart(func() {
+		ticker := time.NewTicker(envelopeAnnounceInterval)
+		defer ticker.Stop()
+		en.refreshMembers()
+		en.negotiate()
+		for {
+			select {
+			case <-en.closed:
+				return
+			case <-ticker.C:
+				en.announce()
+				en.refreshMembers()
+				en.negotiate()
+			}
+		}
+	})
+	return nil
+}
+
+// Version returns envelope version for produced messages
+func (en *EnvelopeNegotiator) Version() int {
+	if en == nil {
+		return MinEnvelopeVersion
+	}
+	return int(en.version.Load())
+}
+
+func (en *EnvelopeNegotiator) key() string {
+	return en.announcement.Service + "/" + en.announcement.InstanceId
+}
+
+func (en *EnvelopeNegotiator) announce() {
+	announcement := en.announcement
+	announcement.Timestamp = time.Now().UTC()
+	value, _ := json.Marshal(announcement)
+	en.produce(value)
+}
+
+func (en *EnvelopeNegotiator) produce(value []byte) {
+	topic := en.config.KafkaEnvelopeTopicName
+	err := en.producer.Produce(&kafka.Message{
+		Key:            []byte(en.key()),
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: kafka.PartitionAny},
+		Value:          value,
+	}, nil)
+	if err != nil {
+		en.Errorf("Failed to announce envelope versions: %v", err)
+	}
+}
+
+func (en *EnvelopeNegotiator) onAnnouncement(message *kafka.Message) {
+	key := string(message.Key)
+	en.Lock()
+	if len(message.Value) == 0 {
+		// tombstone of stopped instance
+		delete(en.peers, key)
+	} else {
+		announcement := envelopeAnnouncement{}
+		if err := json.Unmarshal(message.Value, &announcement); err != nil {
+			en.Unlock()
+			en.Errorf("Failed to parse envelope announcement of %s: %v", key, err)
+			return
+		}
+		en.peers[key] = announcement
+	}
+	en.Unlock()
+	en.negotiate()
+}
+
+// negotiate selects envelope version of produced messages unless it is pinned with ENVELOPE_VERSION
+func (en *EnvelopeNegotiator) negotiate() {
+	if en.config.EnvelopeVersion != 0 {
+		return
+	}
+	en.RLock()
+	version, unknown := negotiateVersion(en.members, en.peers, time.Now())
+	en.RUnlock()
+	if previous := en.version.Swap(int32(version)); int(previous) != version {
+		en.Infof("Envelope version of produced messages changed: %d -> %d", previous, version)
+		for _, member := range unknown {
+			en.Infof("Member of consumer group %s didn't announce supported envelope versions. group.instance.id: %q client.id: %q host: %s",
+				member.GroupId, member.GroupInstanceId, member.ClientId, member.Host)
+		}
+	}
+	NegotiatedEnvelopeVersion.Set(float64(version))
+}
+
+// negotiateVersion returns the highest envelope version supported by all consumers and members of consumer groups
+// that don't match any live consuming instance announcement.
+// Member matches announcement when its group.instance.id is instance id or ends with "-" + instance id (static membership of Bulker consumers).
+// Unmatched members are instances of releases prior to envelope versioning or unknown consumers: MinEnvelopeVersion is used while any of them is present.
+// MinEnvelopeVersion is also used while membership is not known or there are no members at all
+func negotiateVersion(members []consumerGroupMember, peers map[string]envelopeAnnouncement, now time.Time) (version int, unknown []consumerGroupMember) {
+	if len(members) == 0 {
+		return MinEnvelopeVersion, nil
+	}
+	version = MaxEnvelopeVersion
+	live := make([]envelopeAnnouncement, 0, len(peers))
+	for _, peer := range peers {
+		if !peer.Consumer || now.Sub(peer.Timestamp) > envelopeAnnouncementTTL || peer.MaxVersion < MinEnvelopeVersion {
+			continue
+		}
+		live = append(live, peer)
+		version = min(version, peer.MaxVersion)
+	}
+	for _, member := range members {
+		if member.GroupInstanceId == "" || !slices.ContainsFunc(live, func(peer envelopeAnnouncement) bool {
+			return member.GroupInstanceId == peer.InstanceId || strings.HasSuffix(member.GroupInstanceId, "-"+peer.InstanceId)
+		}) {
+			unknown = append(unknown, member)
+		}
+	}
+	if len(unknown) > 0 {
+		return MinEnvelopeVersion, unknown
+	}
+	return version, nil
+}
+
+// refreshMembers loads members of all active consumer groups of the cluster except negotiators' ones.
+// On error membership is considered unknown
+func (en *EnvelopeNegotiator) refreshMembers() {
+	members, err := en.describeMembers()
+	if err != nil {
+		en.Errorf("Failed to describe consumer groups: %v", err)
+	}
+	en.Lock()
+	en.members = members
+	en.Unlock()
+}
+
+func (en *EnvelopeNegotiator) describeMembers() ([]consumerGroupMember, error) {
+	admin, err := kafka.NewAdminClientFromProducer(en.producer)
+	if err != nil {
+		return nil, err
+	}
+	defer admin.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), envelopeAnnounceInterval/2)
+	defer cancel()
+	groups, err := admin.ListConsumerGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	groupIds := make([]string, 0, len(groups.Valid))
+	for _, group := range groups.Valid {
+		if group.IsSimpleConsumerGroup || strings.HasPrefix(group.GroupID, envelopeNegotiatorGroupPrefix) ||
+			group.State == kafka.ConsumerGroupStateEmpty || group.State == kafka.ConsumerGroupStateDead {
+			continue
+		}
+		groupIds = append(groupIds, group.GroupID)
+	}
+	members := make([]consumerGroupMember, 0)
+	if len(groupIds) == 0 {
+		return members, nil
+	}
+	descriptions, err := admin.DescribeConsumerGroups(ctx, groupIds)
+	if err != nil {
+		return nil, err
+	}
+	for _, description := range descriptions.ConsumerGroupDescriptions {
+		if description.Error.Code() != kafka.ErrNoError {
+			return nil, fmt.Errorf("group %s: %v", description.GroupID, description.Error)
+		}
+		for _, member := range description.Members {
+			members = append(members, consumerGroupMember{GroupId: description.GroupID, GroupInstanceId: member.GroupInstanceID,
+				ClientId: member.ClientID, Host: member.Host})
+		}
+	}
+	return members, nil
+}
+
+func (en *EnvelopeNegotiator) ensureTopic() error {
+	admin, err := kafka.NewAdminClientFromProducer(en.producer)
+	if err != nil {
+		return en.NewError("error creating kafka admin client: %v", err)
+	}
+	defer admin.Close()
+	topicRes, err := admin.CreateTopics(context.Background(), []kafka.TopicSpecification{
+		{
+			Topic:             en.config.KafkaEnvelopeTopicName,
+			NumPartitions:     1,
+			ReplicationFactor: en.config.KafkaTopicReplicationFactor,
+			Config: map[string]string{
+				"cleanup.policy": "compact",
+				"segment.ms":     fmt.Sprint(en.config.KafkaTopicSegmentHours * 60 * 60 * 1000),
+			},
+		},
+	})
+	if err != nil {
+		return en.NewError("error creating topic %s: %v", en.config.KafkaEnvelopeTopicName, err)
+	}
+	for _, res := range topicRes {
+		if res.Error.Code() != kafka.ErrNoError && res.Error.Code() != kafka.ErrTopicAlreadyExists {
+			return en.NewError("error creating topic %s: %v", res.Topic, res.Error)
+		}
+	}
+	return nil
+}
+
+// Close removes announcement of this instance and stops negotiator
+func (en *EnvelopeNegotiator) Close() error {
+	if en == nil {
+		return nil
+	}
+	select {
+	case <-en.closed:
+		return nil
+	default:
+	}
+	close(en.closed)
+	en.produce(nil)
+	en.producer.Flush(3000)
+	en.producer.Close()
+	return nil
+}
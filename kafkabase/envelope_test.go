@@ -0,0 +1,96 @@
+package kafkabase
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestNegotiateVersion(t *testing.T) {
+	now := time.Now()
+	announcement := func(instanceId string, consumer bool, maxVersion int, age time.Duration) envelopeAnnouncement {
+		return envelopeAnnouncement{Service: "bulker", InstanceId: instanceId, Consumer: consumer,
+			MinVersion: MinEnvelopeVersion, MaxVersion: maxVersion, Timestamp: now.Add(-age)}
+	}
+	member := func(groupInstanceId string) consumerGroupMember {
+		return consumerGroupMember{GroupId: "in.id.dst.m.batch.t.events", GroupInstanceId: groupInstanceId, ClientId: "bulkerapp", Host: "/10.0.0.1"}
+	}
+	tests := []struct {
+		name        string
+		members     []consumerGroupMember
+		peers       []envelopeAnnouncement
+		wantVersion int
+		wantUnknown int
+	}{
+		{
+			name:        "membership_not_known",
+			members:     nil,
+			peers:       []envelopeAnnouncement{announcement("a", true, 2, 0)},
+			wantVersion: 1,
+		},
+		{
+			name:        "no_members",
+			members:     []consumerGroupMember{},
+			peers:       []envelopeAnnouncement{announcement("a", true, 2, 0)},
+			wantVersion: 1,
+		},
+		{
+			name:        "all_members_announced_v2",
+			members:     []consumerGroupMember{member("3f-a"), member("a"), member("0-b")},
+			peers:       []envelopeAnnouncement{announcement("a", true, 2, 0), announcement("b", true, 2, time.Minute)},
+			wantVersion: 2,
+		},
+		{
+			name:        "old_instance_never_announces",
+			members:     []consumerGroupMember{member("3f-a"), member("1c-old")},
+			peers:       []envelopeAnnouncement{announcement("a", true, 2, 0)},
+			wantVersion: 1,
+			wantUnknown: 1,
+		},
+		{
+			name:        "member_without_static_membership",
+			members:     []consumerGroupMember{member("3f-a"), member("")},
+			peers:       []envelopeAnnouncement{announcement("a", true, 2, 0)},
+			wantVersion: 1,
+			wantUnknown: 1,
+		},
+		{
+			name:        "announced_v1_only",
+			members:     []consumerGroupMember{member("3f-a"), member("0-b")},
+			peers:       []envelopeAnnouncement{announcement("a", true, 2, 0), announcement("b", true, 1, 0)},
+			wantVersion: 1,
+		},
+		{
+			name:        "expired_announcement",
+			members:     []consumerGroupMember{member("3f-a"), member("0-b")},
+			peers:       []envelopeAnnouncement{announcement("a", true, 2, 0), announcement("b", true, 2, 2*envelopeAnnouncementTTL)},
+			wantVersion: 1,
+			wantUnknown: 1,
+		},
+		{
+			name:        "producer_announcement_doesnt_match_member",
+			members:     []consumerGroupMember{member("3f-a"), member("0-ingest1")},
+			peers:       []envelopeAnnouncement{announcement("a", true, 2, 0), announcement("ingest1", false, 2, 0)},
+			wantVersion: 1,
+			wantUnknown: 1,
+		},
+		{
+			name:        "suffix_must_follow_dash",
+			members:     []consumerGroupMember{member("3f-ba")},
+			peers:       []envelopeAnnouncement{announcement("a", true, 2, 0)},
+			wantVersion: 1,
+			wantUnknown: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			peers := map[string]envelopeAnnouncement{}
+			for _, peer := range tt.peers {
+				peers[peer.Service+"/"+peer.InstanceId] = peer
+			}
+			version, unknown := negotiateVersion(tt.members, peers, now)
+			require.Equal(t, tt.wantVersion, version)
+			require.Len(t, unknown, tt.wantUnknown)
+		})
+	}
+}
@@ -0,0 +1,285 @@
+package kafkabase
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/jitsucom/bulker/jitsubase/safego"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"github.com/jitsucom/bulker/jitsubase/uuid"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvelopeFrameHeader marks message that packs multiple events into single frame. Value is compression codec of the frame.
+// Frame is a sequence of events each prefixed with its length as unsigned varint
+const EnvelopeFrameHeader = "envelope_frame"
+
+// FrameEnvelopeVersion the first envelope version that supports framed messages
+const FrameEnvelopeVersion = 2
+
+// Compression codecs of frames
+const (
+	FrameCompressionNone = "none"
+	FrameCompressionGzip = "gzip"
+)
+
+// maxFrameEvents protects consumers from corrupted frames
+const maxFrameEvents = 1 << 20
+
+// producerFrame events waiting to be packed into single message
+type producerFrame struct {
+	topic   string
+	headers map[string]string
+	events  [][]byte
+	size    int
+	created time.Time
+	// done is closed when frame is delivered to Kafka or failed. err is set before
+	done chan struct{}
+	err  error
+}
+
+func newProducerFrame(topic string, headers map[string]string) *producerFrame {
+	return &producerFrame{topic: topic, headers: headers, created: time.Now(), done: make(chan struct{})}
+}
+
+func (f *producerFrame) complete(err error) {
+	f.err = err
+	close(f.done)
+}
+
+// PackFrame packs events into frame compressed with codec
+func PackFrame(events [][]byte, codec string) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	var w io.Writer = buf
+	var gz *gzip.Writer
+	switch codec {
+	case FrameCompressionNone:
+	case FrameCompressionGzip:
+		gz = gzip.NewWriter(buf)
+		w = gz
+	default:
+		return nil, fmt.Errorf("unsupported frame compression: %s", codec)
+	}
+	lenBuf := make([]byte, binary.MaxVarintLen64)
+	for _, event := range events {
+		n := binary.PutUvarint(lenBuf, uint64(len(event)))
+		if _, err := w.Write(lenBuf[:n]); err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(event); err != nil {
+			return nil, err
+		}
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// UnpackEvents returns events of message: events of frame or message value for not framed message
+func UnpackEvents(message *kafka.Message) ([][]byte, error) {
+	codec := GetKafkaHeader(message, EnvelopeFrameHeader)
+	if codec == "" {
+		return [][]byte{message.Value}, nil
+	}
+	data := message.Value
+	switch codec {
+	case FrameCompressionNone:
+	case FrameCompressionGzip:
+		gz, err := gzip.NewReader(bytes.NewReader(message.Value))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress frame: %v", err)
+		}
+		data, err = io.ReadAll(gz)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress frame: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported frame compression: %s", codec)
+	}
+	events := make([][]byte, 0)
+	for len(data) > 0 {
+		size, n := binary.Uvarint(data)
+		if n <= 0 || size > uint64(len(data)-n) || len(events) >= maxFrameEvents {
+			return nil, fmt.Errorf("corrupted frame at event %d", len(events))
+		}
+		events = append(events, data[n:n+int(size)])
+		data = data[n+int(size):]
+	}
+	return events, nil
+}
+
+// FrameEventMessage returns copy of framed message that carries single event of the frame.
+// Used to retry or dead-letter events of frame individually
+func FrameEventMessage(message *kafka.Message, event []byte) *kafka.Message {
+	headers := make([]kafka.Header, 0, len(message.Headers))
+	for _, h := range message.Headers {
+		if h.Key != EnvelopeFrameHeader {
+			headers = append(headers, h)
+		}
+	}
+	return &kafka.Message{
+		TopicPartition: message.TopicPartition,
+		Key:            message.Key,
+		Headers:        headers,
+		Value:          event,
+		Timestamp:      message.Timestamp,
+	}
+}
+
+func (p *Producer) framingEnabled() bool {
+	return p.frameMaxEvents > 1
+}
+
+// ProduceFramed produces event to topic. When framing is enabled and consumers support framed envelope
+// events with the same headers are packed into single compressed message that is produced when frame is full or
+// PRODUCER_FRAME_LINGER_MS passed. Otherwise, event is produced as separate message.
+// With framing enabled call blocks until the frame with the event is delivered to Kafka, so events acknowledged to clients
+// are never lost in memory buffer of crashed instance
+func (p *Producer) ProduceFramed(topic string, event []byte, headers map[string]string) error {
+	if !p.framingEnabled() || p.envelope.Version() < FrameEnvelopeVersion {
+		return p.ProduceAsync(topic, uuid.New(), event, headers, kafka.PartitionAny)
+	}
+	if p.isClosed() {
+		return p.NewError("producer is closed")
+	}
+	key := frameKey(topic, headers)
+	p.framesLock.Lock()
+	frame, ok := p.frames[key]
+	if !ok {
+		frame = newProducerFrame(topic, headers)
+		p.frames[key] = frame
+	}
+	frame.events = append(frame.events, event)
+	frame.size += len(event)
+	full := len(frame.events) >= p.frameMaxEvents || frame.size >= p.frameMaxBytes
+	if full {
+		delete(p.frames, key)
+	}
+	p.framesLock.Unlock()
+	if full {
+		p.produceFrame(frame)
+	}
+	select {
+	case <-frame.done:
+		return frame.err
+	case <-p.closed:
+		return p.NewError("producer is closed")
+	}
+}
+
+// flushFrames produces pending frames that were created before deadline
+func (p *Producer) flushFrames(deadline time.Time) {
+	p.framesLock.Lock()
+	ready := make([]*producerFrame, 0)
+	for key, frame := range p.frames {
+		if !frame.created.After(deadline) {
+			ready = append(ready, frame)
+			delete(p.frames, key)
+		}
+	}
+	p.framesLock.Unlock()
+	for _, frame := range ready {
+		p.produceFrame(frame)
+	}
+}
+
+// produceFrame produces frame and completes it when delivery reports of all its messages are received
+func (p *Producer) produceFrame(frame *producerFrame) {
+	messages, framed, err := p.frameMessages(frame)
+	if err != nil {
+		p.Errorf("Failed to pack frame of %d events to topic %s: %v", len(frame.events), frame.topic, err)
+		frame.complete(err)
+		return
+	}
+	deliveryChan := make(chan kafka.Event, len(messages))
+	produced := 0
+	for _, message := range messages {
+		p.stampEnvelope(&message.Headers)
+		if err = p.producer.Produce(message, deliveryChan); err != nil {
+			ProducerMessages(p.metricsLabelFunc(frame.topic, "error", KafkaErrorCode(err))).Inc()
+			break
+		}
+		ProducerMessages(p.metricsLabelFunc(frame.topic, "produced", "")).Inc()
+		produced++
+	}
+	safego.Run(func() {
+		for i := 0; i < produced; i++ {
+			m := (<-deliveryChan).(*kafka.Message)
+			if m.TopicPartition.Error != nil {
+				ProducerMessages(p.metricsLabelFunc(frame.topic, "error", KafkaErrorCode(m.TopicPartition.Error))).Inc()
+				if err == nil {
+					err = m.TopicPartition.Error
+				}
+			} else {
+				ProducerMessages(p.metricsLabelFunc(frame.topic, "delivered", "")).Inc()
+			}
+		}
+		if err != nil {
+			p.Errorf("Failed to produce frame of %d events to topic %s: %v", len(frame.events), frame.topic, err)
+		} else if framed {
+			ProducerFramedEvents.Add(float64(len(frame.events)))
+		}
+		frame.complete(err)
+	})
+}
+
+// frameMessages returns single message with packed events or message per event
+// if consumers don't support frames anymore (e.g. during rollback) or there is nothing to pack
+func (p *Producer) frameMessages(frame *producerFrame) (messages []*kafka.Message, framed bool, err error) {
+	message := func(value []byte, headers map[string]string) *kafka.Message {
+		topic := frame.topic
+		return &kafka.Message{
+			Key: []byte(uuid.New()),
+			Headers: utils.MapToSlice(headers, func(k string, v string) kafka.Header {
+				return kafka.Header{Key: k, Value: []byte(v)}
+			}),
+			TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: kafka.PartitionAny},
+			Value:          value,
+		}
+	}
+	version := p.envelope.Version()
+	if version < FrameEnvelopeVersion || len(frame.events) == 1 {
+		for _, event := range frame.events {
+			messages = append(messages, message(event, frame.headers))
+		}
+		return messages, false, nil
+	}
+	value, err := PackFrame(frame.events, p.frameCompression)
+	if err != nil {
+		return nil, false, err
+	}
+	headers := make(map[string]string, len(frame.headers)+2)
+	for k, v := range frame.headers {
+		headers[k] = v
+	}
+	headers[EnvelopeVersionHeader] = strconv.Itoa(version)
+	headers[EnvelopeFrameHeader] = p.frameCompression
+	return []*kafka.Message{message(value, headers)}, true, nil
+}
+
+// frameKey events with equal topic and headers share frame
+func frameKey(topic string, headers map[string]string) string {
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	sb := strings.Builder{}
+	sb.WriteString(topic)
+	for _, k := range keys {
+		sb.WriteString("\x00")
+		sb.WriteString(k)
+		sb.WriteString("=")
+		sb.WriteString(headers[k])
+	}
+	return sb.String()
+}
@@ -0,0 +1,63 @@
+package kafkabase
+
+import (
+	"bytes"
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		events [][]byte
+	}{
+		{"single_event", [][]byte{[]byte(`{"id":1}`)}},
+		{"multiple_events", [][]byte{[]byte(`{"id":1}`), []byte(`{"id":2,"name":"b"}`), []byte(`{"id":3}`)}},
+		{"empty_event", [][]byte{[]byte(`{"id":1}`), {}, []byte(`{"id":3}`)}},
+		// length prefix takes more than one byte
+		{"large_event", [][]byte{bytes.Repeat([]byte("a"), 100_000), []byte(`{"id":2}`)}},
+	}
+	for _, codec := range []string{FrameCompressionNone, FrameCompressionGzip} {
+		for _, tt := range tests {
+			t.Run(codec+"_"+tt.name, func(t *testing.T) {
+				value, err := PackFrame(tt.events, codec)
+				require.NoError(t, err)
+				message := &kafka.Message{Value: value, Headers: []kafka.Header{{Key: EnvelopeFrameHeader, Value: []byte(codec)}}}
+				events, err := UnpackEvents(message)
+				require.NoError(t, err)
+				require.Len(t, events, len(tt.events))
+				for i := range tt.events {
+					require.Equal(t, string(tt.events[i]), string(events[i]))
+				}
+			})
+		}
+	}
+}
+
+func TestUnpackEvents(t *testing.T) {
+	notFramed := &kafka.Message{Value: []byte(`{"id":1}`)}
+	events, err := UnpackEvents(notFramed)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte(`{"id":1}`)}, events)
+
+	value, err := PackFrame([][]byte{[]byte(`{"id":1}`), []byte(`{"id":2}`)}, FrameCompressionNone)
+	require.NoError(t, err)
+	tests := []struct {
+		name  string
+		codec string
+		value []byte
+	}{
+		{"truncated_frame", FrameCompressionNone, value[:len(value)-1]},
+		{"not_gzipped", FrameCompressionGzip, value},
+		{"unsupported_codec", "zstd", value},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := UnpackEvents(&kafka.Message{Value: tt.value, Headers: []kafka.Header{{Key: EnvelopeFrameHeader, Value: []byte(tt.codec)}}})
+			require.Error(t, err)
+		})
+	}
+	_, err = PackFrame(nil, "zstd")
+	require.Error(t, err)
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
 	"github.com/hjson/hjson-go/v4"
 	"github.com/jitsucom/bulker/jitsubase/appbase"
+	"github.com/jitsucom/bulker/jitsubase/utils"
 )
 
 type KafkaConfig struct {
@@ -12,6 +13,12 @@ type KafkaConfig struct {
 	KafkaBootstrapServers string `mapstructure:"KAFKA_BOOTSTRAP_SERVERS"`
 	KafkaSSL              bool   `mapstructure:"KAFKA_SSL" default:"false"`
 	KafkaSSLSkipVerify    bool   `mapstructure:"KAFKA_SSL_SKIP_VERIFY" default:"false"`
+	// KafkaSSLCA CA bundle to verify brokers certificates. PEM content or path to PEM file
+	KafkaSSLCA string `mapstructure:"KAFKA_SSL_CA"`
+	// KafkaSSLCert and KafkaSSLKey client certificate and private key for mutual TLS. PEM content or path to PEM file
+	KafkaSSLCert        string `mapstructure:"KAFKA_SSL_CERT"`
+	KafkaSSLKey         string `mapstructure:"KAFKA_SSL_KEY"`
+	KafkaSSLKeyPassword string `mapstructure:"KAFKA_SSL_KEY_PASSWORD"`
 	//Kafka authorization as JSON object {"mechanism": "SCRAM-SHA-256|PLAIN", "username": "user", "password": "password"}
 	KafkaSASL string `mapstructure:"KAFKA_SASL"`
 
@@ -39,6 +46,21 @@ type KafkaConfig struct {
 	ProducerBatchSize         int `mapstructure:"PRODUCER_BATCH_SIZE" default:"65535"`
 	ProducerLingerMs          int `mapstructure:"PRODUCER_LINGER_MS" default:"1000"`
 	ProducerWaitForDeliveryMs int `mapstructure:"PRODUCER_WAIT_FOR_DELIVERY_MS" default:"1000"`
+
+	// ProducerFrameMaxEvents max number of events packed into single message of destination topic. 0 or 1 - framing is disabled.
+	// Frames are produced only when envelope version 2 is pinned or negotiated with all consumer group members. See EnvelopeNegotiator
+	ProducerFrameMaxEvents int `mapstructure:"PRODUCER_FRAME_MAX_EVENTS" default:"0"`
+	// ProducerFrameMaxBytes max uncompressed size of frame
+	ProducerFrameMaxBytes int `mapstructure:"PRODUCER_FRAME_MAX_BYTES" default:"262144"`
+	// ProducerFrameLingerMs max time event waits in not full frame
+	ProducerFrameLingerMs int `mapstructure:"PRODUCER_FRAME_LINGER_MS" default:"100"`
+	// ProducerFrameCompression compression of frames: "gzip" or "none"
+	ProducerFrameCompression string `mapstructure:"PRODUCER_FRAME_COMPRESSION" default:"gzip"`
+
+	// KafkaEnvelopeTopicName compacted topic where instances announce supported message envelope versions
+	KafkaEnvelopeTopicName string `mapstructure:"KAFKA_ENVELOPE_TOPIC_NAME" default:"envelope-versions"`
+	// EnvelopeVersion pins envelope version of produced messages. 0 - negotiate with consumer group members: MinEnvelopeVersion until all of them announce newer version
+	EnvelopeVersion int `mapstructure:"ENVELOPE_VERSION" default:"0"`
 }
 
 // GetKafkaConfig returns kafka config
@@ -60,6 +82,14 @@ func (ac *KafkaConfig) GetKafkaConfig() *kafka.ConfigMap {
 		}
 		if ac.KafkaSSLSkipVerify {
 			_ = kafkaConfig.SetKey("enable.ssl.certificate.verification", false)
+			_ = kafkaConfig.SetKey("ssl.endpoint.identification.algorithm", "none")
+		}
+		// librdkafka doesn't allow to override SNI: broker hostname is always used
+		setPEM(kafkaConfig, "ssl.ca", ac.KafkaSSLCA)
+		setPEM(kafkaConfig, "ssl.certificate", ac.KafkaSSLCert)
+		setPEM(kafkaConfig, "ssl.key", ac.KafkaSSLKey)
+		if ac.KafkaSSLKeyPassword != "" {
+			_ = kafkaConfig.SetKey("ssl.key.password", ac.KafkaSSLKeyPassword)
 		}
 	}
 	if ac.KafkaSASL != "" {
@@ -76,6 +106,18 @@ func (ac *KafkaConfig) GetKafkaConfig() *kafka.ConfigMap {
 	return kafkaConfig
 }
 
+// setPEM sets librdkafka property to PEM content (<prefix>.pem) or path to PEM file (<prefix>.location)
+func setPEM(kafkaConfig *kafka.ConfigMap, prefix, value string) {
+	if value == "" {
+		return
+	}
+	if utils.IsPEM(value) {
+		_ = kafkaConfig.SetKey(prefix+".pem", value)
+	} else {
+		_ = kafkaConfig.SetKey(prefix+".location", value)
+	}
+}
+
 func (c *KafkaConfig) PostInit(settings *appbase.AppSettings) error {
 	return nil
 }
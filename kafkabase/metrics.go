@@ -5,6 +5,7 @@ import (
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"strconv"
 )
 
 var (
@@ -22,6 +23,27 @@ var (
 		Subsystem: "producer",
 		Name:      "queue_length",
 	})
+
+	ProducerFramedEvents = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "bulkerapp",
+		Subsystem: "producer",
+		Name:      "framed_events",
+	})
+
+	envelopeMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "bulkerapp",
+		Subsystem: "envelope",
+		Name:      "messages",
+	}, []string{"direction", "version", "status"})
+	EnvelopeMessages = func(direction string, version int, status string) prometheus.Counter {
+		return envelopeMessages.WithLabelValues(direction, strconv.Itoa(version), status)
+	}
+
+	NegotiatedEnvelopeVersion = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "bulkerapp",
+		Subsystem: "envelope",
+		Name:      "negotiated_version",
+	})
 )
 
 func KafkaErrorCode(err error) string {
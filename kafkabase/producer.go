@@ -7,6 +7,8 @@ import (
 	"github.com/jitsucom/bulker/jitsubase/appbase"
 	"github.com/jitsucom/bulker/jitsubase/safego"
 	"github.com/jitsucom/bulker/jitsubase/utils"
+	"strconv"
+	"sync"
 	"time"
 )
 
@@ -35,6 +37,14 @@ type Producer struct {
 	waitForDelivery      time.Duration
 	closed               chan struct{}
 	metricsLabelFunc     MetricsLabelsFunc
+	envelope             *EnvelopeNegotiator
+
+	frameMaxEvents   int
+	frameMaxBytes    int
+	frameLinger      time.Duration
+	frameCompression string
+	framesLock       sync.Mutex
+	frames           map[string]*producerFrame
 }
 
 // NewProducer creates new Producer
@@ -48,6 +58,11 @@ func NewProducer(config *KafkaConfig, kafkaConfig *kafka.ConfigMap, reportQueueL
 	if metricsLabelFunc == nil {
 		metricsLabelFunc = defaultMetricsLabelFunc
 	}
+	frameCompression := utils.NvlString(config.ProducerFrameCompression, FrameCompressionNone)
+	if _, err = PackFrame(nil, frameCompression); err != nil {
+		producer.Close()
+		return nil, base.NewError("PRODUCER_FRAME_COMPRESSION: %v", err)
+	}
 	return &Producer{
 		Service:              base,
 		producer:             producer,
@@ -56,9 +71,33 @@ func NewProducer(config *KafkaConfig, kafkaConfig *kafka.ConfigMap, reportQueueL
 		closed:               make(chan struct{}),
 		waitForDelivery:      time.Millisecond * time.Duration(config.ProducerWaitForDeliveryMs),
 		metricsLabelFunc:     metricsLabelFunc,
+		frameMaxEvents:       config.ProducerFrameMaxEvents,
+		frameMaxBytes:        config.ProducerFrameMaxBytes,
+		frameLinger:          time.Millisecond * time.Duration(config.ProducerFrameLingerMs),
+		frameCompression:     frameCompression,
+		frames:               map[string]*producerFrame{},
 	}, nil
 }
 
+// SetEnvelopeNegotiator sets negotiator that selects envelope version of produced messages.
+// Without negotiator messages are produced with MinEnvelopeVersion
+func (p *Producer) SetEnvelopeNegotiator(envelope *EnvelopeNegotiator) {
+	p.envelope = envelope
+}
+
+// stampEnvelope sets envelope version header unless message already has one:
+// messages moved between topics keep version of original payload
+func (p *Producer) stampEnvelope(headers *[]kafka.Header) {
+	for _, h := range *headers {
+		if h.Key == EnvelopeVersionHeader {
+			return
+		}
+	}
+	version := p.envelope.Version()
+	PutKafkaHeader(headers, EnvelopeVersionHeader, strconv.Itoa(version))
+	EnvelopeMessages("produced", version, "ok").Inc()
+}
+
 func (p *Producer) Start() {
 	safego.RunWithRestart(func() {
 		for e := range p.producer.Events() {
@@ -79,6 +118,21 @@ func (p *Producer) Start() {
 		}
 		p.Infof("Producer closed")
 	})
+	if p.framingEnabled() {
+		// produce frames that didn't fill up during linger period
+		safego.RunWithRestart(func() {
+			ticker := time.NewTicker(max(p.frameLinger/4, 10*time.Millisecond))
+			defer ticker.Stop()
+			for {
+				select {
+				case <-p.closed:
+					return
+				case <-ticker.C:
+					p.flushFrames(time.Now().Add(-p.frameLinger))
+				}
+			}
+		})
+	}
 	if p.reportQueueLength {
 		// report size metrics
 		safego.RunWithRestart(func() {
@@ -104,6 +158,7 @@ func (p *Producer) ProduceSync(topic string, event kafka.Message) error {
 	}
 	started := time.Now()
 	deliveryChan := make(chan kafka.Event, 1)
+	p.stampEnvelope(&event.Headers)
 	err := p.producer.Produce(&event, deliveryChan)
 	if err != nil {
 		ProducerMessages(p.metricsLabelFunc(topic, "error", KafkaErrorCode(err))).Inc()
@@ -145,11 +200,13 @@ func (p *Producer) ProduceAsync(topic string, messageKey string, event []byte, h
 	if messageKey != "" {
 		key = []byte(messageKey)
 	}
+	kafkaHeaders := utils.MapToSlice(headers, func(k string, v string) kafka.Header {
+		return kafka.Header{Key: k, Value: []byte(v)}
+	})
+	p.stampEnvelope(&kafkaHeaders)
 	err := p.producer.Produce(&kafka.Message{
-		Key: key,
-		Headers: utils.MapToSlice(headers, func(k string, v string) kafka.Header {
-			return kafka.Header{Key: k, Value: []byte(v)}
-		}),
+		Key:            key,
+		Headers:        kafkaHeaders,
 		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: partition},
 		Value:          event,
 	}, nil)
@@ -167,6 +224,7 @@ func (p *Producer) Close() error {
 	if p == nil || p.isClosed() {
 		return nil
 	}
+	p.flushFrames(time.Now())
 	notProduced := p.producer.Flush(3000)
 	if notProduced > 0 {
 		p.Errorf("%d message left unsent in producer queue.", notProduced)